@@ -0,0 +1,347 @@
+package main
+
+import (
+	stdjson "encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/vpoluyaktov/biblio-ebook-parser/formats/fb2"
+	"github.com/vpoluyaktov/biblio-ebook-parser/parser"
+	"github.com/vpoluyaktov/biblio-ebook-parser/renderer/html"
+	"github.com/vpoluyaktov/biblio-ebook-parser/renderer/json"
+	"github.com/vpoluyaktov/biblio-ebook-parser/renderer/plaintext"
+)
+
+// newFlagSet creates the flag set of a command with the shared --format flag
+func newFlagSet(name string, format *string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.StringVar(format, "format", "", "input format (fb2, epub, txt, markdown, cbz, mobi), detected if empty")
+	return fs
+}
+
+// openOutput returns the file named by -o, or stdout when it is empty or "-"
+func openOutput(path string) (*os.File, func() error, error) {
+	if path == "" || path == "-" {
+		return os.Stdout, func() error { return nil }, nil
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create output: %w", err)
+	}
+	return f, f.Close, nil
+}
+
+func runMeta(args []string) error {
+	var format string
+	fs := newFlagSet("meta", &format)
+	table := fs.Bool("table", false, "print a table instead of JSON")
+	path, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+
+	in, err := openInput(path, format)
+	if err != nil {
+		return err
+	}
+
+	var metadata parser.Metadata
+	if in.isDir() {
+		metadata, err = parser.ExtractMetadataFromFile(in.path)
+	} else {
+		r, size, release, openErr := in.reader()
+		if openErr != nil {
+			return openErr
+		}
+		defer release()
+		metadata, err = parser.ExtractMetadataFromReader(r, size, in.format)
+	}
+	if err != nil {
+		return err
+	}
+
+	if !*table {
+		rendered, err := json.NewRenderer(json.Config{}).RenderMetadata(&parser.Book{Metadata: metadata})
+		if err != nil {
+			return err
+		}
+		encoder := stdjson.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(rendered)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	row := func(name, value string) {
+		if value != "" {
+			fmt.Fprintf(w, "%s\t%s\n", name, value)
+		}
+	}
+	row("Format", in.format)
+	row("Title", metadata.Title)
+	authors := make([]string, len(metadata.Authors))
+	for i, author := range metadata.Authors {
+		authors[i] = author.FullName()
+	}
+	row("Authors", strings.Join(authors, "; "))
+	row("Language", metadata.Language)
+	row("Publisher", metadata.Publisher)
+	row("Date", metadata.PublicationDate)
+	row("Modified", metadata.ModifiedDate)
+	if metadata.Series != "" {
+		series := metadata.Series
+		if metadata.SeriesIndex > 0 {
+			series = fmt.Sprintf("%s #%d", series, metadata.SeriesIndex)
+		}
+		row("Series", series)
+	}
+	row("Genres", strings.Join(metadata.Genres, ", "))
+	for _, id := range metadata.Identifiers {
+		row(strings.ToUpper(id.Scheme), id.Value)
+	}
+	if len(metadata.CoverData) > 0 {
+		cover := fmt.Sprintf("%s, %d bytes", metadata.CoverType, len(metadata.CoverData))
+		if metadata.CoverWidth > 0 {
+			cover = fmt.Sprintf("%s, %dx%d, %d bytes", metadata.CoverType, metadata.CoverWidth, metadata.CoverHeight, len(metadata.CoverData))
+		}
+		row("Cover", cover)
+	}
+	return w.Flush()
+}
+
+func runCover(args []string) error {
+	var format string
+	fs := newFlagSet("cover", &format)
+	out := fs.String("o", "", "output file, stdout if empty")
+	path, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+
+	in, err := openInput(path, format)
+	if err != nil {
+		return err
+	}
+
+	var data []byte
+	if in.isDir() {
+		data, _, err = parser.ExtractCoverFromFile(in.path)
+	} else {
+		r, size, release, openErr := in.reader()
+		if openErr != nil {
+			return openErr
+		}
+		defer release()
+		data, _, err = parser.ExtractCoverFromReader(r, size, in.format)
+	}
+	if err != nil {
+		return err
+	}
+	if len(data) == 0 {
+		return fmt.Errorf("book has no cover")
+	}
+
+	f, closeOutput, err := openOutput(*out)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		closeOutput()
+		return fmt.Errorf("failed to write cover: %w", err)
+	}
+	return closeOutput()
+}
+
+func runTOC(args []string) error {
+	var format string
+	fs := newFlagSet("toc", &format)
+	path, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+
+	in, err := openInput(path, format)
+	if err != nil {
+		return err
+	}
+	book, err := in.parse()
+	if err != nil {
+		return err
+	}
+
+	for _, ch := range book.Content.Chapters {
+		title := ch.Title
+		if title == "" {
+			title = "(untitled)"
+		}
+		fmt.Printf("%s%s\t%s\n", strings.Repeat("  ", ch.Level), ch.ID, title)
+	}
+	return nil
+}
+
+func runText(args []string) error {
+	var format string
+	var config plaintext.Config
+	fs := newFlagSet("text", &format)
+	out := fs.String("o", "", "output file, stdout if empty")
+	fs.BoolVar(&config.AddPeriods, "add-periods", false, "end paragraphs and titles without punctuation with a period")
+	fs.BoolVar(&config.NormalizeText, "normalize", false, "spell out numbers, abbreviations and units for speech")
+	fs.BoolVar(&config.Dehyphenate, "dehyphenate", false, "rejoin words hyphenated across line breaks and paragraphs broken at page ends")
+	fs.BoolVar(&config.InlineNotes, "inline-notes", false, "read footnotes after the paragraph that references them")
+	fs.BoolVar(&config.SentencePerLine, "sentence-per-line", false, "put each sentence on its own line")
+	fs.IntVar(&config.WrapColumn, "wrap", 0, "word-wrap paragraphs at this column, 0 to disable")
+	fs.BoolVar(&config.IncludeBookHeader, "book-header", false, "start with a title and author block")
+	fs.BoolVar(&config.SkipEmptyChapters, "skip-empty", false, "leave out chapters without text")
+	fs.BoolVar(&config.SkipRepeatedHeadings, "skip-repeated-headings", false, "leave out headings repeating the chapter or book title")
+	path, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+
+	in, err := openInput(path, format)
+	if err != nil {
+		return err
+	}
+	book, err := in.parse()
+	if err != nil {
+		return err
+	}
+
+	f, closeOutput, err := openOutput(*out)
+	if err != nil {
+		return err
+	}
+	if err := plaintext.NewRenderer(config).RenderTo(f, book); err != nil {
+		closeOutput()
+		return err
+	}
+	return closeOutput()
+}
+
+func runHTML(args []string) error {
+	var format string
+	fs := newFlagSet("html", &format)
+	dir := fs.String("o", "", "output directory (required)")
+	skipRepeated := fs.Bool("skip-repeated-headings", false, "leave out headings repeating the chapter or book title")
+	path, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if *dir == "" {
+		return &usageError{msg: "the -o output directory is required"}
+	}
+
+	in, err := openInput(path, format)
+	if err != nil {
+		return err
+	}
+	book, err := in.parse()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(*dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	// Images are written next to the document, named by their position
+	var imageErr error
+	images := make(map[string]string)
+	rewrite := func(href string, data []byte) string {
+		if len(data) == 0 {
+			return href
+		}
+		if src, ok := images[href]; ok {
+			return src
+		}
+		src := fmt.Sprintf("images/%03d%s", len(images)+1, imageExt(href))
+		images[href] = src
+		if err := writeFile(filepath.Join(*dir, filepath.FromSlash(src)), data); err != nil && imageErr == nil {
+			imageErr = err
+		}
+		return src
+	}
+
+	renderer := html.NewRenderer(html.Config{
+		ImageSrcRewriter:     rewrite,
+		IncludeTOC:           true,
+		IncludeCover:         true,
+		SkipRepeatedHeadings: *skipRepeated,
+	})
+
+	f, err := os.Create(filepath.Join(*dir, "index.html"))
+	if err != nil {
+		return fmt.Errorf("failed to create output: %w", err)
+	}
+	if err := renderer.RenderTo(f, book); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return imageErr
+}
+
+// imageExt returns the extension of an image href, without any fragment
+func imageExt(href string) string {
+	if idx := strings.IndexAny(href, "#?"); idx >= 0 {
+		href = href[:idx]
+	}
+	ext := strings.ToLower(filepath.Ext(href))
+	if len(ext) > 5 {
+		return ""
+	}
+	return ext
+}
+
+func writeFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", filepath.Base(path), err)
+	}
+	return nil
+}
+
+func runValidate(args []string) error {
+	var format string
+	fs := newFlagSet("validate", &format)
+	path, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+
+	in, err := openInput(path, format)
+	if err != nil {
+		return err
+	}
+
+	// FB2 files get the strict schema checks, everything else must parse
+	if in.format == "fb2" && in.data == nil {
+		issues, err := fb2.ValidateFB2(in.path)
+		if err != nil {
+			return err
+		}
+		if len(issues) > 0 {
+			for _, issue := range issues {
+				fmt.Println(issue)
+			}
+			return &fb2.ValidationError{Issues: issues}
+		}
+	}
+
+	book, err := in.parse()
+	if err != nil {
+		return err
+	}
+	for _, warning := range book.Warnings {
+		fmt.Println("warning:", warning)
+	}
+	fmt.Printf("%s: valid %s\n", path, in.format)
+	return nil
+}
@@ -0,0 +1,208 @@
+// Command ebookparse parses ebooks from the command line: it prints metadata
+// and tables of contents, extracts covers, renders text and HTML, and
+// validates files. All the work is done by the library packages.
+//
+// Usage:
+//
+//	ebookparse meta [--table] FILE
+//	ebookparse cover [-o out.jpg] FILE
+//	ebookparse toc FILE
+//	ebookparse text [-o out.txt] [--add-periods] [...] FILE
+//	ebookparse html -o DIR FILE
+//	ebookparse validate FILE
+//
+// FILE may be "-" to read from stdin. The format is detected from the
+// content; --format overrides it, and is needed for text formats on stdin.
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	_ "github.com/vpoluyaktov/biblio-ebook-parser/formats"
+	"github.com/vpoluyaktov/biblio-ebook-parser/parser"
+)
+
+// command is a subcommand. run returns an error for failures and a
+// usageError for bad arguments.
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) error
+}
+
+var commands = []command{
+	{"meta", "print metadata as JSON or a table", runMeta},
+	{"cover", "write the cover image to a file or stdout", runCover},
+	{"toc", "print the table of contents", runTOC},
+	{"text", "render the book as plain text", runText},
+	{"html", "render the book as an HTML document into a directory", runHTML},
+	{"validate", "check that the book parses, reporting problems", runValidate},
+}
+
+// usageError reports invalid command-line arguments
+type usageError struct {
+	msg string
+}
+
+func (e *usageError) Error() string { return e.msg }
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	name := os.Args[1]
+	if name == "help" || name == "-h" || name == "--help" {
+		usage()
+		return
+	}
+
+	for _, cmd := range commands {
+		if cmd.name != name {
+			continue
+		}
+		err := cmd.run(os.Args[2:])
+		var ue *usageError
+		switch {
+		case err == nil:
+			return
+		case errors.As(err, &ue):
+			fmt.Fprintf(os.Stderr, "ebookparse %s: %s\n", name, ue.msg)
+			os.Exit(2)
+		case errors.Is(err, flag.ErrHelp):
+			return
+		default:
+			fmt.Fprintf(os.Stderr, "ebookparse %s: %s: %v\n", name, errorName(err), err)
+			os.Exit(1)
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "ebookparse: unknown command %q\n", name)
+	usage()
+	os.Exit(2)
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: ebookparse COMMAND [options] FILE")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-9s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, `FILE may be "-" for stdin. Run "ebookparse COMMAND -h" for the options of a command.`)
+}
+
+// errorName returns the type of the first typed error in the chain, such as
+// *fb2.ValidationError, skipping plain wrapping errors
+func errorName(err error) string {
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		switch t := fmt.Sprintf("%T", e); t {
+		case "*fmt.wrapError", "*fmt.wrapErrors", "*errors.errorString":
+		default:
+			return t
+		}
+	}
+	return "error"
+}
+
+// parseArgs parses flags that may come before or after the single FILE
+// argument
+func parseArgs(fs *flag.FlagSet, args []string) (string, error) {
+	fs.SetOutput(os.Stderr)
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return "", err
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+
+	if len(positional) != 1 {
+		return "", &usageError{msg: "expected exactly one FILE argument"}
+	}
+	return positional[0], nil
+}
+
+// input is an ebook named on the command line
+type input struct {
+	path   string // File path, "-" for stdin
+	format string
+	data   []byte // Contents read from stdin
+}
+
+// openInput detects the format of the named file, or reads stdin
+func openInput(path, format string) (*input, error) {
+	in := &input{path: path, format: format}
+
+	if path == "-" {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read stdin: %w", err)
+		}
+		in.data = data
+		if in.format == "" {
+			in.format = parser.DetectFormatReader(bytes.NewReader(data), int64(len(data)))
+		}
+	} else if in.format == "" {
+		detected, err := parser.DetectFormat(path)
+		if err != nil {
+			return nil, err
+		}
+		in.format = detected
+	}
+
+	if in.format == "unknown" {
+		return nil, &usageError{msg: "cannot detect the format, use --format"}
+	}
+	in.format = strings.ToLower(in.format)
+	return in, nil
+}
+
+// parse parses the whole book
+func (in *input) parse() (*parser.Book, error) {
+	if in.data != nil {
+		return parser.ParseReader(in.format, bytes.NewReader(in.data), int64(len(in.data)))
+	}
+	return parser.Parse(in.format, in.path)
+}
+
+// reader returns the book as an io.ReaderAt for the fast extraction
+// functions, with a function releasing it
+func (in *input) reader() (io.ReaderAt, int64, func(), error) {
+	if in.data != nil {
+		return bytes.NewReader(in.data), int64(len(in.data)), func() {}, nil
+	}
+
+	f, err := os.Open(in.path)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, nil, err
+	}
+	return f, stat.Size(), func() { f.Close() }, nil
+}
+
+// isDir reports whether the input is a directory (an exploded EPUB), which
+// only the path-based functions can read
+func (in *input) isDir() bool {
+	if in.data != nil {
+		return false
+	}
+	info, err := os.Stat(in.path)
+	return err == nil && info.IsDir()
+}
@@ -0,0 +1,83 @@
+package cover
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"image"
+	"io/fs"
+	"sync"
+
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goitalic"
+)
+
+//go:embed fonts/*.ttf images/BookCover.png
+var embeddedAssets embed.FS
+
+// assetsFS is where Preload reads the fonts and cover template from
+var assetsFS fs.FS = embeddedAssets
+
+// Embedded assets, decoded on first use by Preload
+var (
+	boldFont    *truetype.Font
+	italicFont  *truetype.Font
+	templateImg image.Image
+
+	// Last fallbacks for the title and author, covering Latin, Greek and
+	// Cyrillic in the Go font family
+	bundledBoldFont   *truetype.Font
+	bundledItalicFont *truetype.Font
+
+	assetsOnce sync.Once
+	assetsErr  error
+)
+
+// Preload decodes the embedded fonts and cover template. Covers are
+// generated without calling it, which loads the assets on first use; call it
+// at startup to fail fast, or to keep the decoding cost off the first cover.
+func Preload() error {
+	assetsOnce.Do(func() {
+		assetsErr = loadAssets()
+	})
+	return assetsErr
+}
+
+func loadAssets() error {
+	var err error
+	if boldFont, err = loadFont(assetsFS, "fonts/Cormorant-Bold.ttf"); err != nil {
+		return err
+	}
+	if italicFont, err = loadFont(assetsFS, "fonts/Cormorant-Italic.ttf"); err != nil {
+		return err
+	}
+
+	templateData, err := fs.ReadFile(assetsFS, "images/BookCover.png")
+	if err != nil {
+		return fmt.Errorf("failed to load cover template: %w", err)
+	}
+	if templateImg, _, err = image.Decode(bytes.NewReader(templateData)); err != nil {
+		return fmt.Errorf("failed to decode cover template: %w", err)
+	}
+
+	if bundledBoldFont, err = truetype.Parse(gobold.TTF); err != nil {
+		return fmt.Errorf("failed to parse fallback bold font: %w", err)
+	}
+	if bundledItalicFont, err = truetype.Parse(goitalic.TTF); err != nil {
+		return fmt.Errorf("failed to parse fallback italic font: %w", err)
+	}
+	return nil
+}
+
+func loadFont(fsys fs.FS, name string) (*truetype.Font, error) {
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load font %s: %w", name, err)
+	}
+	f, err := truetype.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse font %s: %w", name, err)
+	}
+	return f, nil
+}
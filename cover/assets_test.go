@@ -0,0 +1,116 @@
+package cover
+
+import (
+	"io/fs"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+)
+
+// resetAssets forgets the loaded assets, so that the next cover loads them
+// from fsys. The embedded assets are loaded again after the test.
+func resetAssets(t *testing.T, fsys fs.FS) {
+	t.Helper()
+	reset := func(fsys fs.FS) {
+		assetsOnce = sync.Once{}
+		assetsErr = nil
+		assetsFS = fsys
+		boldFont, italicFont, templateImg = nil, nil, nil
+		bundledBoldFont, bundledItalicFont = nil, nil
+	}
+	reset(fsys)
+	t.Cleanup(func() { reset(embeddedAssets) })
+}
+
+// brokenAssets returns the embedded assets with one file replaced, or left
+// out if data is nil
+func brokenAssets(t *testing.T, name string, data []byte) fs.FS {
+	t.Helper()
+	fsys := fstest.MapFS{}
+	err := fs.WalkDir(embeddedAssets, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		content, err := fs.ReadFile(embeddedAssets, path)
+		fsys[path] = &fstest.MapFile{Data: content}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data == nil {
+		delete(fsys, name)
+	} else {
+		fsys[name] = &fstest.MapFile{Data: data}
+	}
+	return fsys
+}
+
+func TestAssetsLoadOnFirstCover(t *testing.T) {
+	resetAssets(t, embeddedAssets)
+	if boldFont != nil || templateImg != nil {
+		t.Fatal("assets are loaded before the first cover")
+	}
+
+	// Covers generated at once share one load
+	var wg sync.WaitGroup
+	errs := make([]error, 8)
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = GeneratePlaceholder("Lazy", "Loader")
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Fatalf("GeneratePlaceholder: %v", err)
+		}
+	}
+	if boldFont == nil || italicFont == nil || templateImg == nil || bundledBoldFont == nil || bundledItalicFont == nil {
+		t.Error("assets are not loaded after the first cover")
+	}
+
+	// Preload after the fact is a no-op
+	loaded := boldFont
+	if err := Preload(); err != nil || boldFont != loaded {
+		t.Errorf("Preload after a cover: %v, font reloaded %v", err, boldFont != loaded)
+	}
+}
+
+func TestAssetLoadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		data []byte
+		want string
+	}{
+		{"missing font", "fonts/Cormorant-Italic.ttf", nil, "failed to load font fonts/Cormorant-Italic.ttf"},
+		{"corrupt font", "fonts/Cormorant-Bold.ttf", []byte("not a font"), "failed to parse font fonts/Cormorant-Bold.ttf"},
+		{"missing template", "images/BookCover.png", nil, "failed to load cover template"},
+		{"corrupt template", "images/BookCover.png", []byte("\x89PNG\r\n\x1a\nbroken"), "failed to decode cover template"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetAssets(t, brokenAssets(t, tt.file, tt.data))
+
+			err := Preload()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Preload() = %v, want %q", err, tt.want)
+			}
+			// Covers report the same error instead of panicking on a nil asset
+			for _, style := range []string{"classic", "flat"} {
+				if data, err := GeneratePlaceholderWithOptions("Title", "Author", Options{Style: style}); err == nil || data != nil {
+					t.Errorf("%s cover: %d bytes, error %v", style, len(data), err)
+				} else if !strings.Contains(err.Error(), tt.want) {
+					t.Errorf("%s cover: error %v, want %q", style, err, tt.want)
+				}
+			}
+			if _, err := GeneratePlaceholderImage("Title", "Author"); err == nil {
+				t.Error("GeneratePlaceholderImage succeeded")
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package cover
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"strings"
+
+	"github.com/vpoluyaktov/biblio-ebook-parser/internal/webp"
+)
+
+// encode writes the cover in the requested format and returns it with its
+// MIME type
+func encode(img image.Image, opts Options) ([]byte, string, error) {
+	var buf bytes.Buffer
+
+	switch strings.ToLower(opts.Format) {
+	case "jpeg", "jpg":
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: opts.Quality}); err != nil {
+			return nil, "", err
+		}
+		if opts.DPI > 0 {
+			return withJFIFDensity(buf.Bytes(), opts.DPI), "image/jpeg", nil
+		}
+		return buf.Bytes(), "image/jpeg", nil
+
+	case "png":
+		encoder := png.Encoder{CompressionLevel: opts.PNGCompression}
+		if err := encoder.Encode(&buf, img); err != nil {
+			return nil, "", err
+		}
+		if opts.DPI > 0 {
+			return withPNGDensity(buf.Bytes(), opts.DPI), "image/png", nil
+		}
+		return buf.Bytes(), "image/png", nil
+
+	case "webp":
+		if err := webp.EncodeLossless(&buf, img); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), "image/webp", nil
+	}
+
+	return nil, "", fmt.Errorf("unsupported cover format: %q", opts.Format)
+}
+
+// withJFIFDensity inserts a JFIF APP0 segment recording the resolution in
+// dots per inch after the JPEG start marker
+func withJFIFDensity(data []byte, dpi int) []byte {
+	if len(data) < 2 || dpi > 0xFFFF {
+		return data
+	}
+	app0 := []byte{
+		0xFF, 0xE0, 0x00, 0x10, 'J', 'F', 'I', 'F', 0x00,
+		0x01, 0x01, // Version 1.1
+		0x01, // Units: dots per inch
+		byte(dpi >> 8), byte(dpi), byte(dpi >> 8), byte(dpi),
+		0x00, 0x00, // No thumbnail
+	}
+	out := make([]byte, 0, len(data)+len(app0))
+	out = append(out, data[:2]...)
+	out = append(out, app0...)
+	return append(out, data[2:]...)
+}
+
+// withPNGDensity inserts a pHYs chunk recording the resolution after the
+// IHDR chunk, which follows the 8-byte signature
+func withPNGDensity(data []byte, dpi int) []byte {
+	const ihdrEnd = 8 + 8 + 13 + 4
+	if len(data) < ihdrEnd {
+		return data
+	}
+
+	// PNG stores pixels per meter
+	ppm := uint32(float64(dpi)/0.0254 + 0.5)
+	chunk := make([]byte, 8+9+4)
+	binary.BigEndian.PutUint32(chunk[0:], 9)
+	copy(chunk[4:], "pHYs")
+	binary.BigEndian.PutUint32(chunk[8:], ppm)
+	binary.BigEndian.PutUint32(chunk[12:], ppm)
+	chunk[16] = 1 // Unit: meter
+	binary.BigEndian.PutUint32(chunk[17:], crc32.ChecksumIEEE(chunk[4:17]))
+
+	out := make([]byte, 0, len(data)+len(chunk))
+	out = append(out, data[:ihdrEnd]...)
+	out = append(out, chunk...)
+	return append(out, data[ihdrEnd:]...)
+}
@@ -0,0 +1,143 @@
+package cover
+
+import (
+	"hash/fnv"
+	"image/color"
+	"math"
+	"strings"
+
+	"github.com/fogleman/gg"
+	"github.com/golang/freetype/truetype"
+
+	"github.com/vpoluyaktov/biblio-ebook-parser/parser"
+)
+
+const (
+	// Margin around the text of flat covers, as a fraction of the shorter side
+	flatMargin = 0.08
+
+	// Largest title size of flat covers, in points at the default cover size
+	flatMaxTitleSize = 48.0
+
+	// Contrast ratio the background must have with the text (WCAG AA)
+	minContrast = 4.5
+)
+
+// Flat cover backgrounds: deep colors for light text and pale ones for dark
+// text. Only those contrasting enough with the text color are used.
+var flatPalette = []color.RGBA{
+	{183, 28, 28, 255},   // Red
+	{173, 20, 87, 255},   // Pink
+	{106, 27, 154, 255},  // Purple
+	{69, 39, 160, 255},   // Deep purple
+	{40, 53, 147, 255},   // Indigo
+	{21, 101, 192, 255},  // Blue
+	{0, 96, 100, 255},    // Cyan
+	{0, 105, 92, 255},    // Teal
+	{46, 125, 50, 255},   // Green
+	{191, 54, 12, 255},   // Deep orange
+	{78, 52, 46, 255},    // Brown
+	{55, 71, 79, 255},    // Blue grey
+	{38, 50, 56, 255},    // Charcoal
+	{255, 245, 157, 255}, // Pale yellow
+	{255, 204, 128, 255}, // Peach
+	{178, 223, 219, 255}, // Pale teal
+	{197, 202, 233, 255}, // Lavender
+	{200, 230, 201, 255}, // Pale green
+	{248, 187, 208, 255}, // Pale pink
+	{236, 239, 241, 255}, // Light grey
+}
+
+// flatColor picks the background of a flat cover from a hash of the title
+// and author, so a book always gets the same color
+func flatColor(title, author string, text color.Color) color.Color {
+	var usable []color.RGBA
+	for _, c := range flatPalette {
+		if contrast(c, text) >= minContrast {
+			usable = append(usable, c)
+		}
+	}
+	if len(usable) == 0 {
+		// A mid-tone text color: use whichever of black and white is further
+		if contrast(color.Black, text) > contrast(color.White, text) {
+			return color.Black
+		}
+		return color.White
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(strings.TrimSpace(title)))
+	h.Write([]byte{0})
+	h.Write([]byte(strings.TrimSpace(author)))
+	return usable[h.Sum32()%uint32(len(usable))]
+}
+
+// contrast returns the WCAG contrast ratio of two colors, from 1 to 21
+func contrast(a, b color.Color) float64 {
+	la, lb := luminance(a), luminance(b)
+	return (max(la, lb) + 0.05) / (min(la, lb) + 0.05)
+}
+
+// luminance returns the relative luminance of a color
+func luminance(c color.Color) float64 {
+	r, g, b, _ := c.RGBA()
+	linear := func(v uint32) float64 {
+		s := float64(v) / 0xffff
+		if s <= 0.03928 {
+			return s / 12.92
+		}
+		return math.Pow((s+0.055)/1.055, 2.4)
+	}
+	return 0.2126*linear(r) + 0.7152*linear(g) + 0.0722*linear(b)
+}
+
+// drawFlatText draws the title in large type with the author below it,
+// centered together in the text area above bottom
+func drawFlatText(dc *gg.Context, l layout, title, author string, titleFont, authorFont *truetype.Font, bottom float64) {
+	if titleFont == nil || authorFont == nil {
+		return
+	}
+	title = parser.TrimTitleQuotes(title)
+	maxWidth := l.frameWidth
+	dc.SetColor(l.color)
+
+	authorSize := 24.0 * l.fontScale
+	authorStyle := newTextStyle(authorFont, bundledItalicFont, authorSize)
+	authorLineHeight := authorSize * 1.3
+	authorLines := truncateLines(wrapText(dc, authorStyle, author, maxWidth), 2)
+
+	gap := 0.0
+	if len(authorLines) > 0 {
+		gap = 20 * l.fontScale
+	}
+	authorHeight := float64(len(authorLines)) * authorLineHeight
+	maxHeight := bottom - l.frameTop - authorHeight - gap
+
+	// Use the largest size at which the wrapped title fits above the author
+	var style *textStyle
+	var lines []string
+	var lineHeight float64
+	for size := flatMaxTitleSize; ; size-- {
+		fontSize := size * l.fontScale
+		lineHeight = fontSize * 1.2
+		style = newTextStyle(titleFont, bundledBoldFont, fontSize)
+		lines = wrapText(dc, style, title, maxWidth)
+		if size <= minTitleSize || fits(dc, style, lines, maxWidth, maxHeight, lineHeight) {
+			break
+		}
+	}
+	lines = truncateLines(lines, maxLines)
+
+	// Center the block, nudged up a little as text looks low when centered
+	titleHeight := float64(len(lines)) * lineHeight
+	blockHeight := titleHeight + gap + authorHeight
+	top := max(l.frameTop, l.frameTop+(bottom-l.frameTop-blockHeight)*0.45)
+
+	for i, line := range lines {
+		style.drawCentered(dc, line, l.centerX, top+(float64(i)+0.5)*lineHeight)
+	}
+	top += titleHeight + gap
+	for i, line := range authorLines {
+		authorStyle.drawCentered(dc, line, l.centerX, top+(float64(i)+0.5)*authorLineHeight)
+	}
+}
@@ -0,0 +1,230 @@
+package cover
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/fogleman/gg"
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font"
+	"golang.org/x/text/unicode/bidi"
+)
+
+var (
+	// Fonts registered with RegisterFallbackFont, tried in order
+	fallbackFonts   []*truetype.Font
+	fallbackFontsMu sync.RWMutex
+)
+
+// RegisterFallbackFont adds a TrueType font for characters the cover fonts
+// have no glyphs for, such as CJK or Hebrew titles (e.g., a Noto Sans font
+// for the scripts of your catalog). Fallbacks are tried in registration order.
+func RegisterFallbackFont(ttf []byte) error {
+	f, err := truetype.Parse(ttf)
+	if err != nil {
+		return fmt.Errorf("failed to parse fallback font: %w", err)
+	}
+
+	fallbackFontsMu.Lock()
+	defer fallbackFontsMu.Unlock()
+	fallbackFonts = append(fallbackFonts, f)
+	return nil
+}
+
+// parseFont parses user-supplied TTF bytes, returning def when there are none
+func parseFont(ttf []byte, def *truetype.Font, name string) (*truetype.Font, error) {
+	if len(ttf) == 0 {
+		return def, nil
+	}
+	f, err := truetype.Parse(ttf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s font: %w", name, err)
+	}
+	return f, nil
+}
+
+// textStyle draws text with a primary font, switching to the first fallback
+// that has a glyph for characters the primary font lacks
+type textStyle struct {
+	fonts []*truetype.Font
+	faces []font.Face
+}
+
+func newTextStyle(primary, bundled *truetype.Font, size float64) *textStyle {
+	fallbackFontsMu.RLock()
+	fonts := append([]*truetype.Font{primary}, fallbackFonts...)
+	fallbackFontsMu.RUnlock()
+	fonts = append(fonts, bundled)
+
+	s := &textStyle{fonts: fonts, faces: make([]font.Face, len(fonts))}
+	for i, f := range fonts {
+		s.faces[i] = truetype.NewFace(f, &truetype.Options{Size: size})
+	}
+	return s
+}
+
+// segment is a piece of a line drawn with one font
+type segment struct {
+	text string
+	face int
+}
+
+// simple reports whether the primary font draws the whole line left to right
+func (s *textStyle) simple(line string) bool {
+	for _, r := range line {
+		if isRTL(r) || (!unicode.IsSpace(r) && s.fonts[0].Index(r) == 0) {
+			return false
+		}
+	}
+	return true
+}
+
+// fontFor returns the first font with a glyph for r, the primary one if
+// none has it
+func (s *textStyle) fontFor(r rune) int {
+	for i, f := range s.fonts {
+		if f.Index(r) != 0 {
+			return i
+		}
+	}
+	return 0
+}
+
+// segments splits a line into runs of one font each, in visual order.
+// Right-to-left runs are reversed, as the fonts are drawn left to right.
+func (s *textStyle) segments(line string) []segment {
+	var runs []string
+	rtl := false
+	for _, r := range line {
+		if isRTL(r) {
+			rtl = true
+			break
+		}
+	}
+
+	if rtl {
+		var p bidi.Paragraph
+		if _, err := p.SetString(line); err == nil {
+			if order, err := p.Order(); err == nil {
+				baseRTL := false
+				for _, r := range line {
+					if isRTL(r) {
+						baseRTL = true
+						break
+					}
+					if unicode.IsLetter(r) {
+						break
+					}
+				}
+				for i := 0; i < order.NumRuns(); i++ {
+					run := order.Run(i)
+					text := run.String()
+					if run.Direction() == bidi.RightToLeft {
+						text = bidi.ReverseString(text)
+					}
+					if baseRTL {
+						runs = append([]string{text}, runs...)
+					} else {
+						runs = append(runs, text)
+					}
+				}
+			}
+		}
+	}
+	if runs == nil {
+		runs = []string{line}
+	}
+
+	var segs []segment
+	for _, run := range runs {
+		for _, r := range run {
+			face := -1
+			if n := len(segs); n > 0 && unicode.IsSpace(r) {
+				// Spaces stay with the text before them
+				face = segs[n-1].face
+			} else {
+				face = s.fontFor(r)
+			}
+			if n := len(segs); n > 0 && segs[n-1].face == face {
+				segs[n-1].text += string(r)
+			} else {
+				segs = append(segs, segment{text: string(r), face: face})
+			}
+		}
+	}
+	return segs
+}
+
+// measure returns the width of a line
+func (s *textStyle) measure(dc *gg.Context, line string) float64 {
+	if s.simple(line) {
+		dc.SetFontFace(s.faces[0])
+		w, _ := dc.MeasureString(line)
+		return w
+	}
+
+	width := 0.0
+	for _, seg := range s.segments(line) {
+		width += float64(font.MeasureString(s.faces[seg.face], seg.text)) / 64
+	}
+	return width
+}
+
+// drawCentered draws a line centered on x and y
+func (s *textStyle) drawCentered(dc *gg.Context, line string, x, y float64) {
+	dc.SetFontFace(s.faces[0])
+	if s.simple(line) {
+		dc.DrawStringAnchored(line, x, y, 0.5, 0.5)
+		return
+	}
+
+	// Vertical placement follows the primary font, as for simple lines
+	_, height := dc.MeasureString(line)
+	x -= s.measure(dc, line) / 2
+	y += height / 2
+	for _, seg := range s.segments(line) {
+		dc.SetFontFace(s.faces[seg.face])
+		dc.DrawString(seg.text, x, y)
+		x += float64(font.MeasureString(s.faces[seg.face], seg.text)) / 64
+	}
+}
+
+// isRTL reports whether r belongs to a right-to-left script
+func isRTL(r rune) bool {
+	props, _ := bidi.LookupRune(r)
+	class := props.Class()
+	return class == bidi.R || class == bidi.AL
+}
+
+// isWide reports whether r is an ideograph or kana, which lines may break
+// between without spaces
+func isWide(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana)
+}
+
+// breakTokens splits text into the pieces lines may break between. A wide
+// character is a piece of its own, joined to its neighbours without a space.
+func breakTokens(text string) (tokens []string, spaced []bool) {
+	for _, word := range strings.Fields(text) {
+		start := 0
+		first := true
+		add := func(token string) {
+			if token != "" {
+				tokens = append(tokens, token)
+				spaced = append(spaced, first)
+				first = false
+			}
+		}
+		for i, r := range word {
+			if isWide(r) {
+				add(word[start:i])
+				add(string(r))
+				start = i + len(string(r))
+			}
+		}
+		add(word[start:])
+	}
+	return tokens, spaced
+}
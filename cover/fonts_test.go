@@ -0,0 +1,182 @@
+package cover
+
+import (
+	"encoding/binary"
+	"slices"
+	"strings"
+	"testing"
+	"unicode"
+
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font/gofont/gobold"
+)
+
+// scriptFont returns a TrueType font with a glyph for each of the characters
+// and nothing else: the Go Bold font with its cmap replaced by one mapping
+// the characters to the glyph of "M"
+func scriptFont(t *testing.T, chars string) []byte {
+	t.Helper()
+	base, err := truetype.Parse(gobold.TTF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	glyph := uint32(base.Index('M'))
+
+	runes := []rune(chars)
+	slices.Sort(runes)
+	runes = slices.Compact(runes)
+
+	// A format 12 subtable for Unicode, full repertoire, with a group of one
+	// character each
+	be := binary.BigEndian
+	cmap := be.AppendUint16(nil, 0)
+	cmap = be.AppendUint16(cmap, 1)
+	cmap = be.AppendUint16(cmap, 0)
+	cmap = be.AppendUint16(cmap, 4)
+	cmap = be.AppendUint32(cmap, 12)
+	cmap = be.AppendUint16(cmap, 12)
+	cmap = be.AppendUint16(cmap, 0)
+	cmap = be.AppendUint32(cmap, uint32(16+12*len(runes)))
+	cmap = be.AppendUint32(cmap, 0)
+	cmap = be.AppendUint32(cmap, uint32(len(runes)))
+	for _, r := range runes {
+		cmap = be.AppendUint32(cmap, uint32(r))
+		cmap = be.AppendUint32(cmap, uint32(r))
+		cmap = be.AppendUint32(cmap, glyph)
+	}
+
+	// Copy the other tables, replacing the cmap
+	src := gobold.TTF
+	n := int(be.Uint16(src[4:]))
+	out := append([]byte(nil), src[:12+16*n]...)
+	for i := range n {
+		rec := 12 + 16*i
+		data := src[be.Uint32(src[rec+8:]):][:be.Uint32(src[rec+12:])]
+		if string(src[rec:rec+4]) == "cmap" {
+			data = cmap
+		}
+		for len(out)%4 != 0 {
+			out = append(out, 0)
+		}
+		be.PutUint32(out[rec+8:], uint32(len(out)))
+		be.PutUint32(out[rec+12:], uint32(len(data)))
+		out = append(out, data...)
+	}
+	return out
+}
+
+const (
+	hebrew = "אבגדהוזחטיךכלםמןנסעףפץצקרשת"
+	cjk    = "中文書名"
+)
+
+// withFallbacks registers fallback fonts for a test, removing them after it
+func withFallbacks(t *testing.T, fonts ...[]byte) {
+	t.Helper()
+	if err := Preload(); err != nil {
+		t.Fatal(err)
+	}
+	fallbackFontsMu.Lock()
+	saved := fallbackFonts
+	fallbackFontsMu.Unlock()
+	t.Cleanup(func() {
+		fallbackFontsMu.Lock()
+		fallbackFonts = saved
+		fallbackFontsMu.Unlock()
+	})
+	for _, ttf := range fonts {
+		if err := RegisterFallbackFont(ttf); err != nil {
+			t.Fatalf("RegisterFallbackFont: %v", err)
+		}
+	}
+}
+
+// tofu returns the characters of a line drawn with a font that has no glyph
+// for them
+func tofu(s *textStyle, line string) string {
+	var missing []rune
+	for _, seg := range s.segments(line) {
+		for _, r := range seg.text {
+			if !unicode.IsSpace(r) && s.fonts[seg.face].Index(r) == 0 {
+				missing = append(missing, r)
+			}
+		}
+	}
+	return string(missing)
+}
+
+// faces describes the segments of a line as text/face pairs
+func faces(s *textStyle, line string) string {
+	var parts []string
+	for _, seg := range s.segments(line) {
+		parts = append(parts, seg.text+"/"+string(rune('0'+seg.face)))
+	}
+	return strings.Join(parts, " | ")
+}
+
+func TestFallbackFontDrawsOtherScripts(t *testing.T) {
+	titles := []string{"中文書名", "שלום עולם", "Война и 中文"}
+
+	withFallbacks(t)
+	style := newTextStyle(boldFont, bundledBoldFont, 20)
+	for _, title := range titles {
+		if tofu(style, title) == "" {
+			t.Fatalf("%q has glyphs without a fallback font; the test needs another script", title)
+		}
+	}
+
+	withFallbacks(t, scriptFont(t, hebrew+cjk))
+	style = newTextStyle(boldFont, bundledBoldFont, 20)
+	for _, title := range titles {
+		if missing := tofu(style, title); missing != "" {
+			t.Errorf("%q: no glyph for %q", title, missing)
+		}
+		if style.simple(title) {
+			t.Errorf("%q is drawn with the primary font alone", title)
+		}
+	}
+
+	// Cyrillic stays in the primary font, and Hebrew is laid out right to left
+	tests := map[string]string{
+		"Война и 中文":     "Война и /0 | 中文/1",
+		"שלום עולם":      "םלוע םולש/1",
+		"Book of שלום 3": "Book of  /0 | םולש/1 | 3/0",
+	}
+	for line, want := range tests {
+		if got := faces(style, line); got != want {
+			t.Errorf("segments of %q = %q, want %q", line, got, want)
+		}
+	}
+}
+
+func TestFallbackFontsInRegistrationOrder(t *testing.T) {
+	withFallbacks(t, scriptFont(t, hebrew), scriptFont(t, hebrew+cjk))
+	style := newTextStyle(boldFont, bundledBoldFont, 20)
+
+	if got, want := faces(style, "中 ש"), "中 /2 | ש/1"; got != want {
+		t.Errorf("segments = %q, want %q", got, want)
+	}
+	// The bundled Go font comes last
+	if got := style.fontFor('Ω'); got != 0 && got != 3 {
+		t.Errorf("Ω is drawn with font %d", got)
+	}
+}
+
+func TestRegisterFallbackFontRejectsBadData(t *testing.T) {
+	withFallbacks(t)
+	if err := RegisterFallbackFont([]byte("not a font")); err == nil {
+		t.Error("RegisterFallbackFont accepted bad data")
+	}
+	if n := len(newTextStyle(boldFont, bundledBoldFont, 20).fonts); n != 2 {
+		t.Errorf("style has %d fonts after a failed registration, want 2", n)
+	}
+}
+
+func TestCoverWithFallbackFont(t *testing.T) {
+	withFallbacks(t, scriptFont(t, hebrew+cjk))
+	for _, title := range []string{"中文書名", "שלום עולם"} {
+		if _, err := GeneratePlaceholder(title, "Автор"); err != nil {
+			t.Errorf("GeneratePlaceholder(%q): %v", title, err)
+		}
+	}
+}
@@ -1,4 +1,5 @@
-// Package cover provides functionality for generating placeholder book covers.
+// Package cover provides functionality for generating placeholder book covers
+// and normalizing extracted ones.
 //
 // When an ebook doesn't have an embedded cover image, this package can generate
 // a beautiful placeholder cover with the book's title and author name, using
@@ -15,26 +16,23 @@ package cover
 
 import (
 	"bytes"
-	"embed"
+	"fmt"
 	"image"
 	"image/color"
 	"image/jpeg"
-	_ "image/png"
+	"image/png"
 	"strings"
 
 	"github.com/fogleman/gg"
 	"github.com/golang/freetype/truetype"
-)
-
-//go:embed fonts/*.ttf
-var fontsFS embed.FS
 
-//go:embed images/BookCover.png
-var coverTemplateFS embed.FS
+	"github.com/vpoluyaktov/biblio-ebook-parser/parser"
+)
 
 const (
-	coverWidth  = 300
-	coverHeight = 426
+	coverWidth   = 300
+	coverHeight  = 426
+	coverQuality = 85
 
 	// Frame boundaries (scaled from 845x1196 template with ~60px borders)
 	// Added extra padding to ensure text never touches the ornate border
@@ -44,158 +42,341 @@ const (
 	frameBottom = 391
 	frameWidth  = frameRight - frameLeft // ~230px usable width
 	frameHeight = frameBottom - frameTop // ~356px usable height
-)
 
-// Bright gold/yellow color for better contrast with the dark background
-var goldColor = color.RGBA{255, 225, 140, 255}
+	// Title font sizes in points at the default cover size. The title is set
+	// at the largest size that fits, and truncated only at the smallest.
+	maxTitleSize = 38.0
+	minTitleSize = 14.0
+	maxLines     = 6
 
-var (
-	boldFont    *truetype.Font
-	italicFont  *truetype.Font
-	templateImg image.Image
+	// Top of the title area as a fraction of the frame height, below the author
+	titleTopRatio = 0.35
 )
 
-func init() {
-	boldData, err := fontsFS.ReadFile("fonts/Cormorant-Bold.ttf")
-	if err != nil {
-		panic("failed to load bold font: " + err.Error())
+// Options controls the size, background and encoding of a generated cover
+type Options struct {
+	Width  int // Width in pixels, 300 if zero
+	Height int // Height in pixels, 426 if zero
+	DPI    int // Resolution recorded in the JPEG or PNG header, not recorded if zero
+
+	// Style is "classic" (the default), the ornate template, or "flat": a
+	// solid color picked from the title and author, the same for every run,
+	// with the title in large type and the author below. Flat covers ignore
+	// the template and background options.
+	Style string
+
+	// Format is the image format: "jpeg" (the default), "png", or "webp",
+	// which is lossless
+	Format         string
+	Quality        int                  // JPEG quality (1-100), 85 if zero
+	PNGCompression png.CompressionLevel // PNG compression level
+
+	// Template replaces the built-in ornate background. TemplateData is the
+	// same as PNG or JPEG bytes, used when Template is nil.
+	Template     image.Image
+	TemplateData []byte
+	Scale        ScaleMode // How a template with another aspect ratio is fitted
+
+	// NoTemplate draws a flat Background color instead of a template, or a
+	// vertical gradient from Background to BackgroundEnd when that is set
+	NoTemplate    bool
+	Background    color.Color // Also fills the margins of ScaleContain, brown if nil
+	BackgroundEnd color.Color
+
+	// TextArea is where the author and title are drawn, in output pixels. If
+	// empty, the frame of the built-in template is used, scaled to the cover.
+	TextArea  image.Rectangle
+	TextColor color.Color // Gold if nil
+
+	// Series and SeriesIndex add a line at the bottom of the frame, omitted
+	// when Series is empty
+	Series      string
+	SeriesIndex int
+
+	// TitleFont and AuthorFont replace the embedded Cormorant fonts with TTF
+	// data; the author font is used for the series too. Characters a font
+	// lacks are drawn with the fonts registered with RegisterFallbackFont,
+	// then with a bundled Go font.
+	TitleFont  []byte
+	AuthorFont []byte
+}
+
+// withDefaults fills in the zero fields
+func (o Options) withDefaults() Options {
+	if o.Width <= 0 {
+		o.Width = coverWidth
 	}
-	boldFont, err = truetype.Parse(boldData)
-	if err != nil {
-		panic("failed to parse bold font: " + err.Error())
+	if o.Height <= 0 {
+		o.Height = coverHeight
 	}
-
-	italicData, err := fontsFS.ReadFile("fonts/Cormorant-Italic.ttf")
-	if err != nil {
-		panic("failed to load italic font: " + err.Error())
+	if o.Quality <= 0 {
+		o.Quality = coverQuality
 	}
-	italicFont, err = truetype.Parse(italicData)
-	if err != nil {
-		panic("failed to parse italic font: " + err.Error())
+	if o.Format == "" {
+		o.Format = "jpeg"
+	}
+	if o.Quality > 100 {
+		o.Quality = 100
+	}
+	if o.Background == nil {
+		o.Background = brownColor
+	}
+	if o.Style == "" {
+		o.Style = "classic"
 	}
+	if o.TextColor == nil {
+		o.TextColor = goldColor
+		if o.Style == "flat" {
+			o.TextColor = color.White
+		}
+	}
+	return o
+}
 
-	// Load the cover template
-	templateData, err := coverTemplateFS.ReadFile("images/BookCover.png")
-	if err != nil {
-		panic("failed to load cover template: " + err.Error())
+// layout holds the text area of a cover. Font sizes scale with the smaller
+// of the cover's scale factors from the 300x426 default so text fits.
+type layout struct {
+	centerX     float64
+	frameTop    float64
+	frameBottom float64
+	frameWidth  float64
+	frameHeight float64
+	fontScale   float64
+	color       color.Color
+}
+
+func newLayout(opts Options) layout {
+	sx := float64(opts.Width) / coverWidth
+	sy := float64(opts.Height) / coverHeight
+
+	l := layout{
+		centerX:     float64(opts.Width) / 2,
+		frameTop:    frameTop * sy,
+		frameBottom: frameBottom * sy,
+		frameWidth:  frameWidth * sx,
+		frameHeight: frameHeight * sy,
+		fontScale:   min(sx, sy),
+		color:       opts.TextColor,
 	}
-	templateImg, _, err = image.Decode(bytes.NewReader(templateData))
-	if err != nil {
-		panic("failed to decode cover template: " + err.Error())
+	area := opts.TextArea
+	if area.Empty() && opts.Style == "flat" {
+		// No frame: the text area is the cover inside a margin
+		area = image.Rect(0, 0, opts.Width, opts.Height).Inset(int(flatMargin * float64(min(opts.Width, opts.Height))))
+	}
+	if !area.Empty() {
+		l.centerX = float64(area.Min.X+area.Max.X) / 2
+		l.frameTop = float64(area.Min.Y)
+		l.frameBottom = float64(area.Max.Y)
+		l.frameWidth = float64(area.Dx())
+		l.frameHeight = float64(area.Dy())
 	}
+	return l
 }
 
+var (
+	// Bright gold/yellow color for better contrast with the dark background
+	goldColor = color.RGBA{255, 225, 140, 255}
+
+	// Background when there is no template
+	brownColor = color.RGBA{92, 51, 46, 255}
+)
+
 // GeneratePlaceholder creates a book cover image with title and author
 // using the embedded template image
 func GeneratePlaceholder(title, author string) ([]byte, error) {
-	dc := gg.NewContext(coverWidth, coverHeight)
-
-	// Draw the template image scaled to fit
-	if templateImg != nil {
-		dc.DrawImageAnchored(templateImg, coverWidth/2, coverHeight/2, 0.5, 0.5)
-		// Scale the template to fit our cover dimensions
-		scaleX := float64(coverWidth) / float64(templateImg.Bounds().Dx())
-		scaleY := float64(coverHeight) / float64(templateImg.Bounds().Dy())
-		dc.Clear()
-		dc.Push()
-		dc.Scale(scaleX, scaleY)
-		dc.DrawImage(templateImg, 0, 0)
-		dc.Pop()
-	} else {
-		// Fallback: draw a simple brown background if template not loaded
-		dc.SetColor(color.RGBA{92, 51, 46, 255})
-		dc.DrawRectangle(0, 0, coverWidth, coverHeight)
-		dc.Fill()
+	return GeneratePlaceholderWithOptions(title, author, Options{})
+}
+
+// GeneratePlaceholderWithOptions creates a book cover of the given size. The
+// frame, font sizes and line heights scale with the cover, and the text is
+// rendered at the target resolution.
+func GeneratePlaceholderWithOptions(title, author string, opts Options) ([]byte, error) {
+	data, _, err := GeneratePlaceholderTyped(title, author, opts)
+	return data, err
+}
+
+// GeneratePlaceholderTyped is GeneratePlaceholderWithOptions returning the
+// MIME type of the image as well, which depends on Options.Format
+func GeneratePlaceholderTyped(title, author string, opts Options) ([]byte, string, error) {
+	if err := Preload(); err != nil {
+		return nil, "", err
 	}
 
-	// Draw author at the top
-	drawAuthor(dc, author)
+	opts = opts.withDefaults()
+	switch opts.Style {
+	case "classic":
+	case "flat":
+		opts.NoTemplate = true
+		opts.Background = flatColor(title, author, opts.TextColor)
+		opts.BackgroundEnd = nil
+	default:
+		return nil, "", fmt.Errorf("unsupported cover style: %q", opts.Style)
+	}
+	l := newLayout(opts)
 
-	// Draw title in the center
-	drawTitle(dc, title)
+	canvas, err := background(opts)
+	if err != nil {
+		return nil, "", err
+	}
+	dc := gg.NewContextForRGBA(canvas)
 
-	// Encode to JPEG
-	var buf bytes.Buffer
-	if err := jpeg.Encode(&buf, dc.Image(), &jpeg.Options{Quality: 85}); err != nil {
-		return nil, err
+	titleFont, err := parseFont(opts.TitleFont, boldFont, "title")
+	if err != nil {
+		return nil, "", err
+	}
+	authorFont, err := parseFont(opts.AuthorFont, italicFont, "author")
+	if err != nil {
+		return nil, "", err
 	}
 
-	return buf.Bytes(), nil
+	// Draw the series near the bottom, and the title and author above it
+	titleBottom := drawSeries(dc, l, opts.Series, opts.SeriesIndex, authorFont)
+	if opts.Style == "flat" {
+		drawFlatText(dc, l, title, author, titleFont, authorFont, titleBottom)
+	} else {
+		drawAuthor(dc, l, author, authorFont)
+		drawTitle(dc, l, title, titleFont, titleBottom)
+	}
+
+	return encode(dc.Image(), opts)
 }
 
-func drawTitle(dc *gg.Context, title string) {
-	if boldFont == nil {
+// drawTitle draws the title centered in the frame, above bottom
+func drawTitle(dc *gg.Context, l layout, title string, f *truetype.Font, bottom float64) {
+	if f == nil {
 		return
 	}
 
-	// Remove surrounding quotes if present
-	title = strings.Trim(title, `"'`)
-	title = strings.TrimPrefix(title, "\u00AB") // «
-	title = strings.TrimSuffix(title, "\u00BB") // »
-	title = strings.TrimPrefix(title, "\u201E") // „
-	title = strings.TrimSuffix(title, "\u201C") // "
-	title = strings.TrimPrefix(title, "\u201C") // "
-	title = strings.TrimSuffix(title, "\u201D") // "
+	title = parser.TrimTitleQuotes(title)
+	centerY, maxWidth, maxHeight := titleBox(l, bottom)
+	style, lines, fontSize := fitTitle(dc, title, f, l.fontScale, maxWidth, maxHeight)
+	lineHeight := fontSize * 1.3
+	dc.SetColor(l.color)
+
+	totalHeight := float64(len(lines)) * lineHeight
+	startY := centerY - totalHeight/2 + lineHeight/2
 
-	// Calculate font size based on title length (larger sizes for readability)
-	fontSize := 38.0
-	if len(title) > 60 {
-		fontSize = 24.0
-	} else if len(title) > 40 {
-		fontSize = 28.0
-	} else if len(title) > 25 {
-		fontSize = 32.0
+	for i, line := range lines {
+		y := startY + float64(i)*lineHeight
+		style.drawCentered(dc, line, l.centerX, y)
 	}
+}
 
-	face := truetype.NewFace(boldFont, &truetype.Options{Size: fontSize})
-	dc.SetFontFace(face)
-	dc.SetColor(goldColor)
+// titleBox returns the center line and size of the space for the title above
+// bottom
+func titleBox(l layout, bottom float64) (centerY, maxWidth, maxHeight float64) {
+	// Center title vertically in the frame area, shifted down by 10%, below
+	// the author
+	centerY = (l.frameTop+l.frameBottom)/2 + l.frameHeight*0.10
+	maxHeight = 2 * min(bottom-centerY, centerY-(l.frameTop+l.frameHeight*titleTopRatio))
 
 	// Wrap text to fit within the frame with padding
-	maxWidth := float64(frameWidth) - 40
-	lines := wrapText(dc, title, maxWidth)
+	maxWidth = l.frameWidth - 40*l.fontScale
+	return centerY, maxWidth, maxHeight
+}
+
+// fitTitle wraps the title at the largest font size at which it fits
+// maxWidth x maxHeight, and returns the style, lines and size. At the
+// smallest size, lines beyond maxLines are truncated.
+func fitTitle(dc *gg.Context, title string, f *truetype.Font, scale, maxWidth, maxHeight float64) (*textStyle, []string, float64) {
+	var style *textStyle
+	var lines []string
+	var fontSize float64
+	for size := maxTitleSize; ; size-- {
+		fontSize = size * scale
+		style = newTextStyle(f, bundledBoldFont, fontSize)
+		lines = wrapText(dc, style, title, maxWidth)
+		if size <= minTitleSize || fits(dc, style, lines, maxWidth, maxHeight, fontSize*1.3) {
+			break
+		}
+	}
+	return style, truncateLines(lines, maxLines), fontSize
+}
+
+// drawSeries draws the series name and number ("Wheel of Time · Book 7") at
+// the bottom of the frame and returns the top of the space it takes, the
+// frame bottom when there is no series
+func drawSeries(dc *gg.Context, l layout, series string, index int, f *truetype.Font) float64 {
+	series = strings.TrimSpace(series)
+	if f == nil || series == "" {
+		return l.frameBottom
+	}
+
+	number := ""
+	if index > 0 {
+		number = fmt.Sprintf(" \u00B7 Book %d", index)
+	}
 
-	// Center title vertically in the frame area, shifted down by 10%
+	fontSize := 18.0 * l.fontScale
+	style := newTextStyle(f, bundledItalicFont, fontSize)
+	dc.SetColor(l.color)
+
+	maxWidth := l.frameWidth - 40*l.fontScale
+	lines := wrapText(dc, style, series+number, maxWidth)
+	if len(lines) > 2 {
+		// Shorten the name on the second line, keeping the number
+		words := strings.Fields(lines[1])
+		for len(words) > 1 && style.measure(dc, strings.Join(words, " ")+"..."+number) > maxWidth {
+			words = words[:len(words)-1]
+		}
+		lines = []string{lines[0], strings.Join(words, " ") + "..." + number}
+	}
+
+	// The last line sits above the ornaments at the bottom of the frame
 	lineHeight := fontSize * 1.3
-	totalHeight := float64(len(lines)) * lineHeight
-	centerY := float64(frameTop+frameBottom)/2 + float64(frameHeight)*0.10
-	startY := centerY - totalHeight/2 + lineHeight/2
+	lastY := l.frameBottom - 40*l.fontScale
+	startY := lastY - float64(len(lines)-1)*lineHeight
 
 	for i, line := range lines {
-		y := startY + float64(i)*lineHeight
-		dc.DrawStringAnchored(line, float64(coverWidth)/2, y, 0.5, 0.5)
+		style.drawCentered(dc, line, l.centerX, startY+float64(i)*lineHeight)
 	}
+
+	// Keep a gap between the title and the series
+	return startY - lineHeight/2 - 8*l.fontScale
 }
 
-func drawAuthor(dc *gg.Context, author string) {
-	if italicFont == nil || author == "" {
+// fits reports whether wrapped lines fit within maxWidth x maxHeight
+func fits(dc *gg.Context, style *textStyle, lines []string, maxWidth, maxHeight, lineHeight float64) bool {
+	if len(lines) > maxLines || float64(len(lines))*lineHeight > maxHeight {
+		return false
+	}
+	for _, line := range lines {
+		if style.measure(dc, line) > maxWidth {
+			return false
+		}
+	}
+	return true
+}
+
+func drawAuthor(dc *gg.Context, l layout, author string, f *truetype.Font) {
+	if f == nil || author == "" {
 		return
 	}
 
-	fontSize := 24.0
-	face := truetype.NewFace(italicFont, &truetype.Options{Size: fontSize})
-	dc.SetFontFace(face)
-	dc.SetColor(goldColor)
+	fontSize := 24.0 * l.fontScale
+	style := newTextStyle(f, bundledItalicFont, fontSize)
+	dc.SetColor(l.color)
 
 	// Wrap author text to fit inside the frame with padding
-	maxWidth := float64(frameWidth) - 20
-	lines := wrapText(dc, author, maxWidth)
+	maxWidth := l.frameWidth - 20*l.fontScale
+	lines := truncateLines(wrapText(dc, style, author, maxWidth), maxLines)
 
 	// Position author at the top of the frame area, shifted down by 10%
 	lineHeight := fontSize * 1.3
-	startY := float64(frameTop) + 45 + float64(frameHeight)*0.10
+	startY := l.frameTop + 45*l.fontScale + l.frameHeight*0.10
 
 	for i, line := range lines {
 		if i >= 2 { // Limit to 2 lines for author
 			break
 		}
 		y := startY + float64(i)*lineHeight
-		dc.DrawStringAnchored(line, float64(coverWidth)/2, y, 0.5, 0.5)
+		style.drawCentered(dc, line, l.centerX, y)
 	}
 }
 
-func wrapText(dc *gg.Context, text string, maxWidth float64) []string {
-	words := strings.Fields(text)
+// wrapText breaks text into lines at spaces, and between CJK characters
+func wrapText(dc *gg.Context, style *textStyle, text string, maxWidth float64) []string {
+	words, spaced := breakTokens(text)
 	if len(words) == 0 {
 		return nil
 	}
@@ -203,14 +384,14 @@ func wrapText(dc *gg.Context, text string, maxWidth float64) []string {
 	var lines []string
 	var currentLine string
 
-	for _, word := range words {
+	for i, word := range words {
 		testLine := currentLine
-		if testLine != "" {
+		if testLine != "" && spaced[i] {
 			testLine += " "
 		}
 		testLine += word
 
-		w, _ := dc.MeasureString(testLine)
+		w := style.measure(dc, testLine)
 		if w > maxWidth && currentLine != "" {
 			lines = append(lines, currentLine)
 			currentLine = word
@@ -223,15 +404,28 @@ func wrapText(dc *gg.Context, text string, maxWidth float64) []string {
 		lines = append(lines, currentLine)
 	}
 
-	// Limit to reasonable number of lines
-	if len(lines) > 6 {
-		lines = lines[:6]
-		lines[5] = lines[5] + "..."
-	}
+	return lines
+}
 
+// truncateLines limits text to a reasonable number of lines
+func truncateLines(lines []string, limit int) []string {
+	if len(lines) > limit {
+		lines = lines[:limit]
+		lines[limit-1] += "..."
+	}
 	return lines
 }
 
+// GeneratePlaceholderFromMetadata creates a default-size book cover with the
+// title, first author and series of a book's metadata
+func GeneratePlaceholderFromMetadata(md parser.Metadata) ([]byte, error) {
+	author := ""
+	if len(md.Authors) > 0 {
+		author = md.Authors[0].FullName()
+	}
+	return GeneratePlaceholderWithOptions(md.Title, author, Options{Series: md.Series, SeriesIndex: md.SeriesIndex})
+}
+
 // GeneratePlaceholderImage returns an image.Image instead of bytes
 func GeneratePlaceholderImage(title, author string) (image.Image, error) {
 	data, err := GeneratePlaceholder(title, author)
@@ -0,0 +1,85 @@
+package cover
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/fogleman/gg"
+)
+
+// titleFit returns the lines and font size, in points, of a title on a
+// default cover without a series
+func titleFit(t *testing.T, title string) ([]string, float64) {
+	t.Helper()
+	if err := Preload(); err != nil {
+		t.Fatal(err)
+	}
+	l := newLayout(Options{}.withDefaults())
+	dc := gg.NewContext(coverWidth, coverHeight)
+	_, maxWidth, maxHeight := titleBox(l, l.frameBottom)
+	_, lines, size := fitTitle(dc, title, boldFont, l.fontScale, maxWidth, maxHeight)
+	return lines, size / l.fontScale
+}
+
+func TestTitleSizeFollowsWidthNotBytes(t *testing.T) {
+	// Latin and Cyrillic titles of about the same width at one size; each
+	// Cyrillic letter is two bytes in UTF-8
+	pairs := [][2]string{
+		{"Oblomov", "Обломов"},
+		{"Dead Souls", "Тихая река"},
+		{"Anna Karenina", "Анна Каренина"},
+		{"The Captain's Daughter", "Герой нашего времени"},
+		{"A Short History of the Long Winter in the Old Town", "Жизнь и приключения моряка из северных морей"},
+	}
+	if err := Preload(); err != nil {
+		t.Fatal(err)
+	}
+	dc := gg.NewContext(coverWidth, coverHeight)
+	style := newTextStyle(boldFont, bundledBoldFont, maxTitleSize)
+	for _, pair := range pairs {
+		latin, cyrillic := pair[0], pair[1]
+		wl, wc := style.measure(dc, latin), style.measure(dc, cyrillic)
+		if math.Abs(wl-wc) > 0.08*wl {
+			t.Fatalf("%q and %q are %.0f and %.0f wide; the test needs titles of about the same width", latin, cyrillic, wl, wc)
+		}
+
+		latinLines, latinSize := titleFit(t, latin)
+		cyrillicLines, cyrillicSize := titleFit(t, cyrillic)
+		if math.Abs(latinSize-cyrillicSize) > 2 {
+			t.Errorf("%q is set at %v pt, %q at %v pt", latin, latinSize, cyrillic, cyrillicSize)
+		}
+		if len(latinLines) != len(cyrillicLines) {
+			t.Errorf("%q takes %d lines, %q %d", latin, len(latinLines), cyrillic, len(cyrillicLines))
+		}
+	}
+
+	// A short title gets the largest size, whatever its byte length, and a
+	// long one a smaller size
+	if _, size := titleFit(t, pairs[len(pairs)-1][1]); size >= maxTitleSize {
+		t.Errorf("long Cyrillic title is set at %v pt", size)
+	}
+	for _, title := range []string{"Oblomov", "Обломов", "Идиот"} {
+		if _, size := titleFit(t, title); size != maxTitleSize {
+			t.Errorf("%q is set at %v pt, want %v", title, size, maxTitleSize)
+		}
+	}
+}
+
+func TestLongTitleShrinksBeforeTruncating(t *testing.T) {
+	long := "Жизнь и удивительные приключения Робинзона Крузо, моряка из Йорка, прожившего двадцать восемь лет на необитаемом острове"
+	lines, size := titleFit(t, long)
+	if size >= maxTitleSize || size < minTitleSize {
+		t.Errorf("long title is set at %v pt", size)
+	}
+	if joined := strings.Join(lines, " "); joined != long {
+		t.Errorf("long title is cut to %q", joined)
+	}
+
+	// Only a title too long for the smallest size is truncated
+	huge := strings.Repeat(long+" ", 4)
+	lines, size = titleFit(t, huge)
+	if size != minTitleSize || len(lines) != maxLines || !strings.HasSuffix(lines[len(lines)-1], "...") {
+		t.Errorf("huge title: %d lines at %v pt, last %q", len(lines), size, lines[len(lines)-1])
+	}
+}
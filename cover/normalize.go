@@ -0,0 +1,113 @@
+package cover
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+
+	"github.com/vpoluyaktov/biblio-ebook-parser/parser"
+)
+
+const (
+	defaultMaxDimension = 1200
+
+	// Covers whose aspect ratio is off from 2:3 by more than this factor are
+	// cropped when NormalizeOptions.CropAspect is set
+	aspectTolerance = 1.25
+)
+
+// NormalizeOptions controls how Normalize re-encodes a cover
+type NormalizeOptions struct {
+	MaxDimension int  // Longest side in pixels, 1200 if zero; smaller images are not enlarged
+	Quality      int  // JPEG quality (1-100), 85 if zero
+	CropAspect   bool // Crop covers far from 2:3, such as scans of a whole spread, to 2:3
+}
+
+// Normalize decodes a cover image (JPEG, PNG, GIF or WebP), turns it upright
+// following its EXIF orientation, optionally crops it to 2:3, scales it down
+// to MaxDimension, flattens transparency onto white and returns it as a
+// baseline JPEG with its MIME type
+func Normalize(data []byte, opts NormalizeOptions) ([]byte, string, error) {
+	if opts.MaxDimension == 0 {
+		opts.MaxDimension = defaultMaxDimension
+	}
+	if opts.Quality == 0 {
+		opts.Quality = coverQuality
+	}
+	if opts.MaxDimension < 0 || opts.Quality < 1 || opts.Quality > 100 {
+		return nil, "", fmt.Errorf("invalid normalize options: max dimension %d, quality %d", opts.MaxDimension, opts.Quality)
+	}
+
+	src, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to decode cover image: %w", err)
+	}
+	if format == "jpeg" {
+		src = orient(src, jpegOrientation(data))
+	}
+
+	crop := src.Bounds()
+	if opts.CropAspect {
+		crop = cropToAspect(crop, 2, 3)
+	}
+
+	width, height := crop.Dx(), crop.Dy()
+	if longest := max(width, height); longest > opts.MaxDimension {
+		width = max(width*opts.MaxDimension/longest, 1)
+		height = max(height*opts.MaxDimension/longest, 1)
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	if width == crop.Dx() && height == crop.Dy() {
+		draw.Draw(dst, dst.Bounds(), src, crop.Min, draw.Over)
+	} else {
+		draw.CatmullRom.Scale(dst, dst.Bounds(), src, crop, draw.Over, nil)
+	}
+
+	// The standard library encoder only writes baseline JPEGs
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: opts.Quality}); err != nil {
+		return nil, "", fmt.Errorf("failed to encode cover image: %w", err)
+	}
+	return buf.Bytes(), "image/jpeg", nil
+}
+
+// cropToAspect returns the centered part of r with the aspect ratio
+// num:den, or r itself if its ratio is within aspectTolerance of it
+func cropToAspect(r image.Rectangle, num, den int) image.Rectangle {
+	width, height := r.Dx(), r.Dy()
+	ratio := float64(width*den) / float64(height*num)
+	switch {
+	case ratio > aspectTolerance:
+		// Too wide
+		w := height * num / den
+		x := r.Min.X + (width-w)/2
+		return image.Rect(x, r.Min.Y, x+w, r.Max.Y)
+	case ratio < 1/aspectTolerance:
+		// Too tall
+		h := width * den / num
+		y := r.Min.Y + (height-h)/2
+		return image.Rect(r.Min.X, y, r.Max.X, y+h)
+	}
+	return r
+}
+
+// ExtractCoverNormalized extracts the cover of an ebook file and normalizes
+// it. It returns no data and no error when the book has no cover.
+func ExtractCoverNormalized(filePath string, opts NormalizeOptions) ([]byte, string, error) {
+	data, _, err := parser.ExtractCoverFromFile(filePath)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(data) == 0 {
+		return nil, "", nil
+	}
+	return Normalize(data, opts)
+}
@@ -0,0 +1,110 @@
+package cover
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"sync"
+
+	"github.com/fogleman/gg"
+)
+
+// ScaleMode controls how a template is fitted to the cover size
+type ScaleMode int
+
+const (
+	// ScaleStretch stretches the template to the cover, ignoring its aspect ratio
+	ScaleStretch ScaleMode = iota
+	// ScaleCover scales the template to fill the cover, cropping the overflow
+	ScaleCover
+	// ScaleContain scales the template to fit inside the cover, filling the
+	// margins with the background color
+	ScaleContain
+)
+
+type templateKey struct {
+	size image.Point
+	mode ScaleMode
+}
+
+var (
+	// Built-in template rendered at each requested size
+	scaledTemplates   = make(map[templateKey]*image.RGBA)
+	scaledTemplatesMu sync.Mutex
+)
+
+// background returns a canvas of the cover size holding the template or the
+// background color, ready to draw the text on
+func background(opts Options) (*image.RGBA, error) {
+	switch {
+	case opts.NoTemplate:
+		dc := gg.NewContext(opts.Width, opts.Height)
+		fillBackground(dc, opts)
+		return dc.Image().(*image.RGBA), nil
+
+	case opts.Template != nil:
+		return renderTemplate(opts.Template, opts), nil
+
+	case len(opts.TemplateData) > 0:
+		tmpl, _, err := image.Decode(bytes.NewReader(opts.TemplateData))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode cover template: %w", err)
+		}
+		return renderTemplate(tmpl, opts), nil
+	}
+
+	// The built-in template is scaled once per size and copied for each cover
+	key := templateKey{size: image.Pt(opts.Width, opts.Height), mode: opts.Scale}
+	scaledTemplatesMu.Lock()
+	scaled, ok := scaledTemplates[key]
+	if !ok {
+		scaled = renderTemplate(templateImg, opts)
+		scaledTemplates[key] = scaled
+	}
+	scaledTemplatesMu.Unlock()
+
+	canvas := image.NewRGBA(scaled.Bounds())
+	copy(canvas.Pix, scaled.Pix)
+	return canvas, nil
+}
+
+// renderTemplate draws a template scaled to the cover size
+func renderTemplate(tmpl image.Image, opts Options) *image.RGBA {
+	dc := gg.NewContext(opts.Width, opts.Height)
+
+	width, height := float64(opts.Width), float64(opts.Height)
+	scaleX := width / float64(tmpl.Bounds().Dx())
+	scaleY := height / float64(tmpl.Bounds().Dy())
+	switch opts.Scale {
+	case ScaleCover:
+		scaleX = max(scaleX, scaleY)
+		scaleY = scaleX
+	case ScaleContain:
+		scaleX = min(scaleX, scaleY)
+		scaleY = scaleX
+		fillBackground(dc, opts)
+	}
+
+	dc.Push()
+	dc.Translate((width-float64(tmpl.Bounds().Dx())*scaleX)/2, (height-float64(tmpl.Bounds().Dy())*scaleY)/2)
+	dc.Scale(scaleX, scaleY)
+	dc.DrawImage(tmpl, -tmpl.Bounds().Min.X, -tmpl.Bounds().Min.Y)
+	dc.Pop()
+
+	return dc.Image().(*image.RGBA)
+}
+
+// fillBackground fills the cover with the background color, or a vertical
+// gradient when BackgroundEnd is set
+func fillBackground(dc *gg.Context, opts Options) {
+	if opts.BackgroundEnd != nil {
+		gradient := gg.NewLinearGradient(0, 0, 0, float64(opts.Height))
+		gradient.AddColorStop(0, opts.Background)
+		gradient.AddColorStop(1, opts.BackgroundEnd)
+		dc.SetFillStyle(gradient)
+	} else {
+		dc.SetColor(opts.Background)
+	}
+	dc.DrawRectangle(0, 0, float64(opts.Width), float64(opts.Height))
+	dc.Fill()
+}
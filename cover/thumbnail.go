@@ -0,0 +1,44 @@
+package cover
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+
+	"golang.org/x/image/draw"
+)
+
+// Thumbnail scales cover image data down to fit within maxWidth x maxHeight,
+// keeping the aspect ratio, and returns it as JPEG. Smaller images are not enlarged.
+func Thumbnail(data []byte, maxWidth, maxHeight int) ([]byte, error) {
+	if maxWidth <= 0 || maxHeight <= 0 {
+		return nil, fmt.Errorf("invalid thumbnail size: %dx%d", maxWidth, maxHeight)
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode cover image: %w", err)
+	}
+
+	width, height := src.Bounds().Dx(), src.Bounds().Dy()
+	if width > maxWidth {
+		height = max(height*maxWidth/width, 1)
+		width = maxWidth
+	}
+	if height > maxHeight {
+		width = max(width*maxHeight/height, 1)
+		height = maxHeight
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, src.Bounds(), draw.Src, nil)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 85}); err != nil {
+		return nil, fmt.Errorf("failed to encode thumbnail: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
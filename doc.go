@@ -6,8 +6,15 @@
 // # Supported Formats
 //
 // Currently supported formats:
-//   - EPUB (2.0, 3.0)
-//   - FB2 (FictionBook 2.0)
+//   - EPUB (2.0, 3.0), packaged or as an unzipped directory
+//   - FB2 (FictionBook 2.0), including .fb2.zip and .fb2.gz
+//   - MOBI/AZW (uncompressed and PalmDOC)
+//   - Plain text and Markdown
+//   - CBZ comic archives
+//
+// DetectFormat sniffs the format of a file from its content. The
+// cmd/ebookparse tool exposes parsing, extraction and rendering on the
+// command line.
 //
 // # Basic Usage
 //
@@ -24,6 +31,9 @@
 //	    log.Fatal(err)
 //	}
 //
+// When parts of a book fail to parse, the EPUB and FB2 parsers return the
+// rest of it together with a *parser.PartialError, found with errors.As.
+//
 // # Fast Extraction
 //
 // Extract cover, annotation, or metadata without parsing full content (much faster):
@@ -40,6 +50,19 @@
 //	// Extract metadata from file
 //	metadata, err := parser.ExtractMetadataFromFile("/path/to/book.epub")
 //
+// # Fingerprints
+//
+// Detect duplicate books that were re-packaged by different tools:
+//
+//	// Stable hash over normalized paragraph text ("v1:sha256:...")
+//	fp := book.Fingerprint()
+//
+//	// Same value computed without building the element tree where supported
+//	fp, err := parser.ExtractFingerprint("/path/to/book.fb2")
+//
+//	// Short hash over normalized title and authors
+//	metaFP := book.Metadata.Fingerprint()
+//
 // # Rendering
 //
 // Render parsed content in different formats:
@@ -67,6 +90,14 @@
 //
 // # Thread Safety
 //
-// All parsers and extractors are safe for concurrent use. The parser registry
-// uses proper locking to ensure thread-safe registration and retrieval.
+// Parsers, extractors and renderers keep no state between calls, so one
+// instance can parse or render any number of books concurrently. Their
+// exported fields are configuration: set them before first use and don't
+// change them afterwards. To parse with other settings, configure a new
+// parser or a copy from Clone instead of changing a parser other goroutines
+// may be using. GetParser returns a copy of the registered parser, so its
+// fields can be set freely.
+//
+// The parser, extractor and renderer registries are guarded by locks, so
+// registering and looking up formats is safe at any time.
 package parser
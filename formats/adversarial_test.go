@@ -0,0 +1,133 @@
+package formats_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/fs"
+	"strings"
+	"testing"
+
+	"github.com/vpoluyaktov/biblio-ebook-parser/formats/cbz"
+	"github.com/vpoluyaktov/biblio-ebook-parser/formats/fb2"
+	"github.com/vpoluyaktov/biblio-ebook-parser/parser"
+	"github.com/vpoluyaktov/biblio-ebook-parser/testutil/fb2test"
+)
+
+// zipEntry is an entry of a crafted archive
+type zipEntry struct {
+	name    string
+	content []byte
+	mode    fs.FileMode // Regular file if zero
+}
+
+func craftZip(t *testing.T, entries ...zipEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, e := range entries {
+		header := &zip.FileHeader{Name: e.name, Method: zip.Deflate}
+		if e.mode != 0 {
+			header.SetMode(e.mode)
+		}
+		w, err := zw.CreateHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(e.content)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestCraftedFB2Zip(t *testing.T) {
+	book := func(title string, padding int) []byte {
+		return fb2test.New().WithTitle(title).WithSection("One", strings.Repeat("Text. ", padding)).Bytes()
+	}
+	// The unsafe entries are the largest, so they would be picked if kept
+	data := craftZip(t,
+		zipEntry{name: "book.fb2", content: book("Safe", 1)},
+		zipEntry{name: "./book.fb2", content: book("Duplicate", 1000)},
+		zipEntry{name: "../../evil.fb2", content: book("Traversal", 1000)},
+		zipEntry{name: "/abs/evil.fb2", content: book("Absolute", 1000)},
+		zipEntry{name: "link.fb2", content: []byte("/etc/passwd"), mode: fs.ModeSymlink | 0o777},
+	)
+
+	entries, err := fb2.ListArchiveEntriesReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("ListArchiveEntriesReader: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Name != "book.fb2" {
+		t.Errorf("ListArchiveEntriesReader = %+v, want only book.fb2", entries)
+	}
+
+	got, err := parser.ParseReader("fb2.zip", bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("ParseReader: %v", err)
+	}
+	if got.Metadata.Title != "Safe" {
+		t.Errorf("ParseReader parsed %q, want the safe entry", got.Metadata.Title)
+	}
+	m, err := parser.ExtractMetadataFromReader(bytes.NewReader(data), int64(len(data)), "fb2")
+	if err != nil || m.Title != "Safe" {
+		t.Errorf("ExtractMetadataFromReader = %q, %v; want the safe entry", m.Title, err)
+	}
+
+	for _, name := range []string{"../../evil.fb2", "/abs/evil.fb2", "link.fb2"} {
+		p := fb2.NewParser()
+		p.ArchiveEntry = name
+		if book, err := p.ParseReader(bytes.NewReader(data), int64(len(data))); err == nil {
+			t.Errorf("ArchiveEntry %q parsed %q", name, book.Metadata.Title)
+		}
+	}
+}
+
+func TestCraftedCBZ(t *testing.T) {
+	data := craftZip(t,
+		zipEntry{name: "001.png", content: pngHeader},
+		zipEntry{name: "./001.png", content: []byte("duplicate")},
+		zipEntry{name: "002.png", content: []byte("/etc/passwd"), mode: fs.ModeSymlink | 0o777},
+		zipEntry{name: "../003.png", content: []byte("traversal")},
+		zipEntry{name: "/004.png", content: []byte("absolute")},
+		zipEntry{name: "C:/005.png", content: []byte("drive")},
+	)
+
+	p := cbz.NewParser()
+	p.LoadImages = true
+	book, err := p.ParseReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("ParseReader: %v", err)
+	}
+	var pages []string
+	for _, ch := range book.Content.Chapters {
+		for _, elem := range ch.Elements {
+			if img, ok := elem.(*parser.Image); ok {
+				pages = append(pages, img.Href)
+				if !bytes.Equal(img.Data, pngHeader) {
+					t.Errorf("page %q has data %q", img.Href, img.Data)
+				}
+			}
+		}
+	}
+	if len(pages) != 1 || pages[0] != "001.png" {
+		t.Errorf("pages = %q, want only 001.png", pages)
+	}
+
+	cover, _, err := parser.ExtractCoverFromReader(bytes.NewReader(data), int64(len(data)), "cbz")
+	if err != nil || !bytes.Equal(cover, pngHeader) {
+		t.Errorf("ExtractCoverFromReader = %q, %v", cover, err)
+	}
+}
+
+// A symbolic link must not be taken for the cover even when it is the only
+// candidate
+func TestCraftedCBZSymlinkCover(t *testing.T) {
+	data := craftZip(t,
+		zipEntry{name: "cover.png", content: []byte("/etc/passwd"), mode: fs.ModeSymlink | 0o777},
+	)
+	cover, _, _ := parser.ExtractCoverFromReader(bytes.NewReader(data), int64(len(data)), "cbz")
+	if len(cover) > 0 {
+		t.Errorf("ExtractCoverFromReader read the symbolic link: %q", cover)
+	}
+}
@@ -0,0 +1,127 @@
+package cbz
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"unicode"
+
+	"github.com/vpoluyaktov/biblio-ebook-parser/internal/zipindex"
+)
+
+// Archive is the read access the parser needs from a comic archive. CBZ
+// files are read with the zip reader; other containers such as RAR for CBR
+// files plug in by implementing it and passing their ArchiveOpener to
+// NewArchiveParser and NewArchiveExtractor.
+type Archive interface {
+	// Names returns the paths of the files in the archive
+	Names() []string
+	// ReadFile returns the contents of the named file
+	ReadFile(name string) ([]byte, error)
+}
+
+// ArchiveOpener opens an archive from a reader
+type ArchiveOpener func(r io.ReaderAt, size int64) (Archive, error)
+
+// OpenZip opens a zip archive (CBZ)
+func OpenZip(r io.ReaderAt, size int64) (Archive, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open CBZ as zip: %w", err)
+	}
+	return &zipArchive{index: zipindex.New(zr)}, nil
+}
+
+// zipArchive reads a CBZ. Names are normalized, and entries with unsafe or
+// duplicate names are left out.
+type zipArchive struct {
+	index *zipindex.Index
+}
+
+func (a *zipArchive) Names() []string {
+	files := a.index.Files()
+	names := make([]string, 0, len(files))
+	for _, f := range files {
+		if !f.FileInfo().IsDir() {
+			names = append(names, a.index.Name(f))
+		}
+	}
+	return names
+}
+
+func (a *zipArchive) ReadFile(name string) ([]byte, error) {
+	f, ok := a.index.Find(name)
+	if !ok {
+		return nil, fmt.Errorf("file not found: %s", name)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+// imageExtensions lists the page image types found in comic archives
+var imageExtensions = map[string]bool{
+	".jpg":  true,
+	".jpeg": true,
+	".png":  true,
+	".gif":  true,
+	".webp": true,
+	".bmp":  true,
+	".avif": true,
+	".jxl":  true,
+}
+
+// isPage reports whether an archive entry is a page image. Hidden files and
+// macOS resource forks are skipped.
+func isPage(name string) bool {
+	if strings.HasPrefix(name, "__MACOSX/") || strings.HasPrefix(path.Base(name), ".") {
+		return false
+	}
+	return imageExtensions[strings.ToLower(path.Ext(name))]
+}
+
+// naturalLess orders names the way a reader expects: case-insensitively,
+// with runs of digits compared by value, so "page2" sorts before "page10"
+func naturalLess(a, b string) bool {
+	x, y := strings.ToLower(a), strings.ToLower(b)
+	for x != "" && y != "" {
+		if isDigit(x[0]) && isDigit(y[0]) {
+			nx, ny := digitRun(x), digitRun(y)
+			vx, vy := strings.TrimLeft(x[:nx], "0"), strings.TrimLeft(y[:ny], "0")
+			if len(vx) != len(vy) {
+				return len(vx) < len(vy)
+			}
+			if vx != vy {
+				return vx < vy
+			}
+			x, y = x[nx:], y[ny:]
+			continue
+		}
+		if x[0] != y[0] {
+			return x[0] < y[0]
+		}
+		x, y = x[1:], y[1:]
+	}
+	if len(x) != len(y) {
+		return len(x) < len(y)
+	}
+	// Names that only differ in case or zero padding keep a stable order
+	return a < b
+}
+
+func digitRun(s string) int {
+	n := 0
+	for n < len(s) && isDigit(s[n]) {
+		n++
+	}
+	return n
+}
+
+func isDigit(c byte) bool {
+	return c < 0x80 && unicode.IsDigit(rune(c))
+}
@@ -0,0 +1,187 @@
+// Package cbz parses comic book archives: every page image becomes an Image
+// element, and ComicInfo.xml supplies the metadata and chapter bookmarks
+package cbz
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/vpoluyaktov/biblio-ebook-parser/parser"
+)
+
+// Parser implements the parser.Parser interface for comic archives
+type Parser struct {
+	// LoadImages reads the page images into Image.Data. Otherwise only
+	// Image.Href (the path inside the archive) is set.
+	LoadImages bool
+
+	format string
+	open   ArchiveOpener
+}
+
+// NewParser creates a new CBZ parser
+func NewParser() *Parser {
+	return NewArchiveParser("cbz", OpenZip)
+}
+
+// NewArchiveParser creates a parser for comic archives opened by open, such
+// as CBR files with a RAR reader
+func NewArchiveParser(format string, open ArchiveOpener) *Parser {
+	return &Parser{format: format, open: open}
+}
+
+func init() {
+	// Register CBZ fast extractor
+	parser.RegisterExtractor("cbz", &Extractor{})
+}
+
+// Clone returns a copy of the parser, to configure without changing p
+func (p *Parser) Clone() parser.Parser {
+	clone := *p
+	return &clone
+}
+
+// Format returns the format identifier
+func (p *Parser) Format() string {
+	return p.format
+}
+
+// Parse extracts book structure from a comic archive. The file name is used
+// as the title when ComicInfo.xml doesn't give one.
+func (p *Parser) Parse(filePath string) (*parser.Book, error) {
+	f, size, err := openFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	book, err := p.ParseReader(f, size)
+	if err != nil {
+		return nil, err
+	}
+	if book.Metadata.Title == "" {
+		book.Metadata.Title = fileTitle(filePath)
+		if len(book.Content.Chapters) > 0 && book.Content.Chapters[0].Title == "" {
+			book.Content.Chapters[0].Title = book.Metadata.Title
+		}
+	}
+	return book, nil
+}
+
+// ParseReader extracts book structure from an io.ReaderAt
+func (p *Parser) ParseReader(r io.ReaderAt, size int64) (*parser.Book, error) {
+	archive, err := p.open(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := readComicInfo(archive)
+	if err != nil {
+		return nil, err
+	}
+
+	book := &parser.Book{}
+	if info != nil {
+		book.Metadata = info.metadata()
+	}
+
+	pages := pageNames(archive)
+	if cover := coverPage(pages, info); cover != "" {
+		if data, err := archive.ReadFile(cover); err == nil {
+			book.SetCover(data, parser.ImageType(data, ""))
+		}
+	}
+
+	images := make([]*parser.Image, len(pages))
+	for i, name := range pages {
+		images[i] = &parser.Image{Alt: fmt.Sprintf("Page %d", i+1), Href: name}
+		if p.LoadImages {
+			data, err := archive.ReadFile(name)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read page %s: %w", name, err)
+			}
+			images[i].Data = data
+		}
+	}
+
+	book.Content.Chapters = chapters(images, info, book.Metadata.Title)
+	return book, nil
+}
+
+// fileTitle returns the file name without its extension
+func fileTitle(filePath string) string {
+	name := filepath.Base(filePath)
+	return strings.TrimSuffix(name, filepath.Ext(name))
+}
+
+// pageNames returns the page images in reading order
+func pageNames(archive Archive) []string {
+	var pages []string
+	for _, name := range archive.Names() {
+		if isPage(name) {
+			pages = append(pages, name)
+		}
+	}
+	sort.SliceStable(pages, func(i, j int) bool {
+		return naturalLess(pages[i], pages[j])
+	})
+	return pages
+}
+
+// coverPage returns the page marked as the front cover in ComicInfo.xml,
+// otherwise the first page
+func coverPage(pages []string, info *comicInfo) string {
+	if len(pages) == 0 {
+		return ""
+	}
+	if info != nil {
+		for _, page := range info.Pages {
+			if page.Type == "FrontCover" && page.Image >= 0 && page.Image < len(pages) {
+				return pages[page.Image]
+			}
+		}
+	}
+	return pages[0]
+}
+
+// chapters groups the pages into chapters at the ComicInfo.xml bookmarks. A
+// comic without bookmarks is a single chapter, and pages before the first
+// bookmark open the book under its title.
+func chapters(images []*parser.Image, info *comicInfo, title string) []parser.Chapter {
+	bookmarks := make(map[int]string)
+	deleted := make(map[int]bool)
+	if info != nil {
+		for _, page := range info.Pages {
+			if bookmark := strings.TrimSpace(page.Bookmark); bookmark != "" {
+				bookmarks[page.Image] = bookmark
+			}
+			if page.Type == "Deleted" {
+				deleted[page.Image] = true
+			}
+		}
+	}
+
+	var result []parser.Chapter
+	for i, img := range images {
+		bookmark, ok := bookmarks[i]
+		if ok || len(result) == 0 {
+			if !ok {
+				bookmark = title
+			}
+			result = append(result, parser.Chapter{
+				ID:    fmt.Sprintf("chapter-%d", len(result)+1),
+				Title: bookmark,
+				Role:  parser.RoleChapter,
+			})
+		}
+		if deleted[i] {
+			continue
+		}
+		ch := &result[len(result)-1]
+		ch.Elements = append(ch.Elements, img)
+	}
+	return result
+}
@@ -0,0 +1,136 @@
+package cbz
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/vpoluyaktov/biblio-ebook-parser/parser"
+)
+
+// comicInfo is the ComicInfo.xml schema used by ComicRack and most comic
+// managers
+type comicInfo struct {
+	Title       string      `xml:"Title"`
+	Series      string      `xml:"Series"`
+	Number      string      `xml:"Number"`
+	Summary     string      `xml:"Summary"`
+	Year        int         `xml:"Year"`
+	Month       int         `xml:"Month"`
+	Day         int         `xml:"Day"`
+	Writer      string      `xml:"Writer"`
+	Publisher   string      `xml:"Publisher"`
+	Genre       string      `xml:"Genre"`
+	LanguageISO string      `xml:"LanguageISO"`
+	GTIN        string      `xml:"GTIN"`
+	Pages       []comicPage `xml:"Pages>Page"`
+}
+
+// comicPage describes a page by its index among the archive images
+type comicPage struct {
+	Image    int    `xml:"Image,attr"`
+	Type     string `xml:"Type,attr"`
+	Bookmark string `xml:"Bookmark,attr"`
+}
+
+// findComicInfo returns the name of the ComicInfo.xml entry, if any
+func findComicInfo(archive Archive) string {
+	for _, name := range archive.Names() {
+		if strings.EqualFold(name, "ComicInfo.xml") {
+			return name
+		}
+	}
+	// Some tools put it in the page directory
+	for _, name := range archive.Names() {
+		if strings.EqualFold(name[strings.LastIndex(name, "/")+1:], "ComicInfo.xml") {
+			return name
+		}
+	}
+	return ""
+}
+
+// readComicInfo parses ComicInfo.xml, returning nil if the archive has none
+func readComicInfo(archive Archive) (*comicInfo, error) {
+	name := findComicInfo(archive)
+	if name == "" {
+		return nil, nil
+	}
+
+	data, err := archive.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ComicInfo.xml: %w", err)
+	}
+
+	var info comicInfo
+	if err := xml.Unmarshal(data, &info); err != nil {
+		return nil, fmt.Errorf("failed to parse ComicInfo.xml: %w", err)
+	}
+	return &info, nil
+}
+
+// metadata converts ComicInfo fields to book metadata. Untitled issues are
+// named after their series and number.
+func (info *comicInfo) metadata() parser.Metadata {
+	m := parser.Metadata{
+		Title:       strings.TrimSpace(info.Title),
+		Description: strings.TrimSpace(info.Summary),
+		Language:    strings.TrimSpace(info.LanguageISO),
+		Publisher:   strings.TrimSpace(info.Publisher),
+		Genres:      splitList(info.Genre),
+	}
+
+	series := strings.TrimSpace(info.Series)
+	number := strings.TrimSpace(info.Number)
+	if series != "" {
+		// Issue numbers can be fractional ("1.5"), only the whole part is kept
+		index, _ := strconv.Atoi(strings.SplitN(number, ".", 2)[0])
+		m.Series = series
+		m.SeriesIndex = index
+		m.Sequences = []parser.Sequence{{Name: series, Number: index}}
+
+		if m.Title == "" {
+			m.Title = series
+			if number != "" {
+				m.Title += " #" + number
+			}
+		}
+	}
+
+	for _, name := range splitList(info.Writer) {
+		m.Authors = append(m.Authors, parser.ParseAuthor(name, ""))
+	}
+
+	if info.Year > 0 {
+		m.PublicationYear = info.Year
+		m.PublicationDate = strconv.Itoa(info.Year)
+		if info.Month > 0 {
+			m.PublicationDate += fmt.Sprintf("-%02d", info.Month)
+			if info.Day > 0 {
+				m.PublicationDate += fmt.Sprintf("-%02d", info.Day)
+			}
+		}
+		m.PublicationTime = parser.ParseDate(m.PublicationDate)
+	}
+
+	for _, gtin := range splitList(info.GTIN) {
+		scheme := "gtin"
+		if len(gtin) == 13 && (strings.HasPrefix(gtin, "978") || strings.HasPrefix(gtin, "979")) {
+			scheme = "isbn"
+		}
+		m.Identifiers = append(m.Identifiers, parser.Identifier{Scheme: scheme, Value: gtin})
+	}
+
+	return m
+}
+
+// splitList splits a comma-separated ComicInfo list
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,74 @@
+package cbz
+
+import (
+	"io"
+
+	"github.com/vpoluyaktov/biblio-ebook-parser/parser"
+)
+
+// Extractor implements the FastExtractor interface for comic archives. The
+// zero value reads CBZ files.
+type Extractor struct {
+	open ArchiveOpener
+}
+
+// NewArchiveExtractor creates an extractor for comic archives opened by open
+func NewArchiveExtractor(open ArchiveOpener) *Extractor {
+	return &Extractor{open: open}
+}
+
+func (e *Extractor) opener() ArchiveOpener {
+	if e.open == nil {
+		return OpenZip
+	}
+	return e.open
+}
+
+// ExtractCoverFromFile extracts only the cover image from a comic archive
+func (e *Extractor) ExtractCoverFromFile(filePath string) ([]byte, string, error) {
+	f, size, err := openFile(filePath)
+	if err != nil {
+		return nil, "", err
+	}
+	defer f.Close()
+
+	return e.ExtractCoverFromReader(f, size)
+}
+
+// ExtractCoverFromReader extracts only the cover image from a comic archive reader
+func (e *Extractor) ExtractCoverFromReader(r io.ReaderAt, size int64) ([]byte, string, error) {
+	return extractCover(e.opener(), r, size)
+}
+
+// ExtractAnnotationFromFile extracts only the summary from a comic archive
+func (e *Extractor) ExtractAnnotationFromFile(filePath string) (string, error) {
+	m, err := e.ExtractMetadataFromFile(filePath)
+	return m.Description, err
+}
+
+// ExtractAnnotationFromReader extracts only the summary from a comic archive reader
+func (e *Extractor) ExtractAnnotationFromReader(r io.ReaderAt, size int64) (string, error) {
+	m, err := e.ExtractMetadataFromReader(r, size)
+	return m.Description, err
+}
+
+// ExtractMetadataFromFile extracts only metadata from a comic archive. The
+// file name is used as the title when ComicInfo.xml doesn't give one.
+func (e *Extractor) ExtractMetadataFromFile(filePath string) (parser.Metadata, error) {
+	f, size, err := openFile(filePath)
+	if err != nil {
+		return parser.Metadata{}, err
+	}
+	defer f.Close()
+
+	m, err := e.ExtractMetadataFromReader(f, size)
+	if err == nil && m.Title == "" {
+		m.Title = fileTitle(filePath)
+	}
+	return m, err
+}
+
+// ExtractMetadataFromReader extracts only metadata from a comic archive reader
+func (e *Extractor) ExtractMetadataFromReader(r io.ReaderAt, size int64) (parser.Metadata, error) {
+	return extractMetadata(e.opener(), r, size)
+}
@@ -0,0 +1,89 @@
+package cbz
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/vpoluyaktov/biblio-ebook-parser/parser"
+)
+
+// ExtractCoverOnly extracts only the cover image from a CBZ file without reading the other pages
+func ExtractCoverOnly(filePath string) ([]byte, string, error) {
+	return NewArchiveExtractor(OpenZip).ExtractCoverFromFile(filePath)
+}
+
+// ExtractCoverOnlyReader extracts only the cover image from a CBZ reader without reading the other pages
+func ExtractCoverOnlyReader(r io.ReaderAt, size int64) ([]byte, string, error) {
+	return extractCover(OpenZip, r, size)
+}
+
+// ExtractAnnotationOnly extracts only the ComicInfo.xml summary from a CBZ file
+func ExtractAnnotationOnly(filePath string) (string, error) {
+	m, err := ExtractMetadataOnly(filePath)
+	return m.Description, err
+}
+
+// ExtractAnnotationOnlyReader extracts only the ComicInfo.xml summary from a CBZ reader
+func ExtractAnnotationOnlyReader(r io.ReaderAt, size int64) (string, error) {
+	m, err := ExtractMetadataOnlyReader(r, size)
+	return m.Description, err
+}
+
+// ExtractMetadataOnly extracts only metadata from a CBZ file without reading the pages
+func ExtractMetadataOnly(filePath string) (parser.Metadata, error) {
+	return NewArchiveExtractor(OpenZip).ExtractMetadataFromFile(filePath)
+}
+
+// ExtractMetadataOnlyReader extracts only metadata from a CBZ reader without reading the pages
+func ExtractMetadataOnlyReader(r io.ReaderAt, size int64) (parser.Metadata, error) {
+	return extractMetadata(OpenZip, r, size)
+}
+
+func extractCover(open ArchiveOpener, r io.ReaderAt, size int64) ([]byte, string, error) {
+	archive, err := open(r, size)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// A broken ComicInfo.xml only loses the cover marker
+	info, _ := readComicInfo(archive)
+	cover := coverPage(pageNames(archive), info)
+	if cover == "" {
+		return nil, "", nil
+	}
+
+	data, err := archive.ReadFile(cover)
+	if err != nil {
+		return nil, "", err
+	}
+	return data, parser.ImageType(data, ""), nil
+}
+
+func extractMetadata(open ArchiveOpener, r io.ReaderAt, size int64) (parser.Metadata, error) {
+	archive, err := open(r, size)
+	if err != nil {
+		return parser.Metadata{}, err
+	}
+
+	info, err := readComicInfo(archive)
+	if err != nil || info == nil {
+		return parser.Metadata{}, err
+	}
+	return info.metadata(), nil
+}
+
+// openFile opens a file for reading as an io.ReaderAt
+func openFile(filePath string) (*os.File, int64, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to open file: %w", err)
+	}
+
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	return f, stat.Size(), nil
+}
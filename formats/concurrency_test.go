@@ -0,0 +1,241 @@
+package formats_test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/vpoluyaktov/biblio-ebook-parser/formats/epub"
+	"github.com/vpoluyaktov/biblio-ebook-parser/formats/fb2"
+	"github.com/vpoluyaktov/biblio-ebook-parser/parser"
+	"github.com/vpoluyaktov/biblio-ebook-parser/testutil/epubtest"
+	"github.com/vpoluyaktov/biblio-ebook-parser/testutil/fb2test"
+
+	_ "github.com/vpoluyaktov/biblio-ebook-parser/formats"
+)
+
+// These tests are meant for the race detector (go test -race): they share
+// parsers, extractors and the registries between goroutines
+
+const goroutines = 16
+
+// pngHeader is the start of a PNG, enough for type detection
+var pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR\x00\x00\x00\x01\x00\x00\x00\x01\x08\x06\x00\x00\x00\x1f\x15\xc4\x89")
+
+type fixture struct {
+	format string
+	data   []byte
+	path   string
+}
+
+func fixtures(t *testing.T) []fixture {
+	t.Helper()
+	dir := t.TempDir()
+	fixtures := []fixture{
+		{format: "epub", data: epubtest.New().
+			WithTitle("Shared").
+			WithAuthor("Jane Doe").
+			WithMetadata("<dc:description>About it</dc:description>").
+			WithChapter("One", "<p>First.</p>").
+			WithChapter("Two", "<p>Second.</p>").
+			WithCover(pngHeader).
+			Bytes()},
+		{format: "fb2", data: fb2test.New().
+			WithTitle("Shared").
+			WithAuthor("Jane Doe").
+			WithAnnotation("About it").
+			WithSection("One", "First.").
+			WithSectionMarkup("Two", `<p>See<a l:href="#n1" type="note">1</a></p>`).
+			WithNote("n1", "A note.").
+			WithCover(pngHeader).
+			Bytes()},
+	}
+	for i := range fixtures {
+		fixtures[i].path = filepath.Join(dir, "book."+fixtures[i].format)
+		if err := os.WriteFile(fixtures[i].path, fixtures[i].data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return fixtures
+}
+
+// summary describes a parse result for comparison between goroutines
+func summary(book *parser.Book) string {
+	return fmt.Sprintf("%s/%d chapters/%d bytes of cover", book.Metadata.Title, len(book.Content.Chapters), len(book.Metadata.CoverData))
+}
+
+// run calls f from many goroutines at once and reports its errors
+func run(t *testing.T, f func() error) {
+	t.Helper()
+	var wg sync.WaitGroup
+	errs := make(chan error, goroutines)
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := f(); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestConcurrentParseAndExtract(t *testing.T) {
+	for _, fx := range fixtures(t) {
+		t.Run(fx.format, func(t *testing.T) {
+			want, err := parser.Parse(fx.format, fx.path)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+
+			run(t, func() error {
+				book, err := parser.Parse(fx.format, fx.path)
+				if err != nil {
+					return fmt.Errorf("Parse: %w", err)
+				}
+				if summary(book) != summary(want) {
+					return fmt.Errorf("Parse = %s, want %s", summary(book), summary(want))
+				}
+
+				book, err = parser.ParseReader("", bytes.NewReader(fx.data), int64(len(fx.data)))
+				if err != nil {
+					return fmt.Errorf("ParseReader: %w", err)
+				}
+				if summary(book) != summary(want) {
+					return fmt.Errorf("ParseReader = %s, want %s", summary(book), summary(want))
+				}
+
+				m, err := parser.ExtractMetadataFromReader(bytes.NewReader(fx.data), int64(len(fx.data)), fx.format)
+				if err != nil || m.Title != "Shared" {
+					return fmt.Errorf("ExtractMetadataFromReader = %q, %v", m.Title, err)
+				}
+				if _, err := parser.ExtractMetadataFromFile(fx.path); err != nil {
+					return fmt.Errorf("ExtractMetadataFromFile: %w", err)
+				}
+				cover, _, err := parser.ExtractCoverFromReader(bytes.NewReader(fx.data), int64(len(fx.data)), fx.format)
+				if err != nil || !bytes.Equal(cover, pngHeader) {
+					return fmt.Errorf("ExtractCoverFromReader = %d bytes, %v", len(cover), err)
+				}
+				annotation, err := parser.ExtractAnnotationFromReader(bytes.NewReader(fx.data), int64(len(fx.data)), fx.format)
+				if err != nil || annotation == "" {
+					return fmt.Errorf("ExtractAnnotationFromReader = %q, %v", annotation, err)
+				}
+				return nil
+			})
+		})
+	}
+}
+
+func TestConcurrentSharedParserInstance(t *testing.T) {
+	fxs := fixtures(t)
+	fb2Parser := fb2.NewParser()
+	fb2Parser.ParseNotes = true
+	epubParser := epub.NewParser()
+	epubParser.SkipEmptyChapters = true
+
+	parsers := map[string]parser.Parser{"epub": epubParser, "fb2": fb2Parser}
+	for _, fx := range fxs {
+		p := parsers[fx.format]
+		run(t, func() error {
+			book, err := p.ParseReader(bytes.NewReader(fx.data), int64(len(fx.data)))
+			if err != nil {
+				return fmt.Errorf("%s ParseReader: %w", fx.format, err)
+			}
+			if fx.format == "fb2" && len(book.Notes) != 1 {
+				return fmt.Errorf("fb2 ParseReader found %d notes, want 1", len(book.Notes))
+			}
+			return nil
+		})
+	}
+}
+
+// Configuring the parsers GetParser returns while others parse with the
+// registered ones must not race
+func TestConcurrentConfigureGetParser(t *testing.T) {
+	fxs := fixtures(t)
+	run(t, func() error {
+		for _, fx := range fxs {
+			p, err := parser.GetParser(fx.format)
+			if err != nil {
+				return err
+			}
+			switch p := p.(type) {
+			case *fb2.Parser:
+				p.ParseNotes = true
+				p.TOCMaxDepth = 1
+			case *epub.Parser:
+				p.KeepHTML = false
+			}
+			if _, err := p.ParseReader(bytes.NewReader(fx.data), int64(len(fx.data))); err != nil {
+				return err
+			}
+			if _, err := parser.ParseReader(fx.format, bytes.NewReader(fx.data), int64(len(fx.data))); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	// The registered parsers keep their defaults
+	p, _ := parser.GetParser("fb2")
+	if p.(*fb2.Parser).ParseNotes {
+		t.Error("configuring a parser from GetParser changed the registered one")
+	}
+}
+
+func TestGetParserReturnsCopies(t *testing.T) {
+	for _, format := range []string{"epub", "fb2", "fb2.zip", "txt", "markdown", "cbz"} {
+		a, err := parser.GetParser(format)
+		if err != nil {
+			t.Fatalf("GetParser(%q): %v", format, err)
+		}
+		b, _ := parser.GetParser(format)
+		if a == b {
+			t.Errorf("GetParser(%q) returned the same parser twice", format)
+		}
+		if a.Format() != b.Format() {
+			t.Errorf("GetParser(%q) copies differ in format: %q, %q", format, a.Format(), b.Format())
+		}
+	}
+}
+
+// stubParser is a parser without configuration, registered by the tests
+type stubParser struct{ format string }
+
+func (p stubParser) Parse(string) (*parser.Book, error) { return &parser.Book{}, nil }
+func (p stubParser) ParseReader(io.ReaderAt, int64) (*parser.Book, error) {
+	return &parser.Book{}, nil
+}
+func (p stubParser) Format() string { return p.format }
+
+func TestConcurrentRegistry(t *testing.T) {
+	var next atomic.Int64
+	run(t, func() error {
+		format := fmt.Sprintf("race-test-%d", next.Add(1))
+
+		parser.Register(format, stubParser{format: format})
+		parser.RegisterExtractor(format, nil)
+		for i := 0; i < 50; i++ {
+			if _, err := parser.GetParser(format); err != nil {
+				return err
+			}
+			if _, err := parser.GetParser("epub"); err != nil {
+				return err
+			}
+			if len(parser.RegisteredFormats()) == 0 {
+				return fmt.Errorf("RegisteredFormats is empty")
+			}
+		}
+		return nil
+	})
+}
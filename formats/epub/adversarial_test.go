@@ -0,0 +1,237 @@
+package epub_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/vpoluyaktov/biblio-ebook-parser/formats/epub"
+	"github.com/vpoluyaktov/biblio-ebook-parser/parser"
+	"github.com/vpoluyaktov/biblio-ebook-parser/testutil/epubtest"
+)
+
+// entry is a zip entry of a crafted archive
+type entry struct {
+	name    string
+	content string
+	mode    fs.FileMode // Regular file if zero
+}
+
+func craft(t testing.TB, entries ...entry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, e := range entries {
+		header := &zip.FileHeader{Name: e.name, Method: zip.Deflate}
+		if e.mode != 0 {
+			header.SetMode(e.mode)
+		}
+		w, err := zw.CreateHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(w, e.content)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+const container = `<?xml version="1.0"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+<rootfiles><rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/></rootfiles>
+</container>`
+
+// opf lists the chapters by href in the spine, and a cover
+func opf(cover string, hrefs ...string) string {
+	var manifest, spine strings.Builder
+	for i, href := range hrefs {
+		id := "ch" + string(rune('a'+i))
+		manifest.WriteString(`<item id="` + id + `" href="` + href + `" media-type="application/xhtml+xml"/>`)
+		spine.WriteString(`<itemref idref="` + id + `"/>`)
+	}
+	manifest.WriteString(`<item id="cover" href="` + cover + `" media-type="image/png" properties="cover-image"/>`)
+	return `<?xml version="1.0"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="id">
+<metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+<dc:identifier id="id">crafted</dc:identifier><dc:title>Crafted</dc:title><dc:language>en</dc:language>
+<meta name="cover" content="cover"/>
+</metadata>
+<manifest>` + manifest.String() + `</manifest>
+<spine>` + spine.String() + `</spine>
+</package>`
+}
+
+func xhtml(text string) string {
+	return `<?xml version="1.0"?><html xmlns="http://www.w3.org/1999/xhtml"><head><title>x</title></head><body><p>` + text + `</p></body></html>`
+}
+
+// bookText joins the text of all paragraphs
+func bookText(book *parser.Book) string {
+	var text strings.Builder
+	for _, ch := range book.Content.Chapters {
+		for _, elem := range ch.Elements {
+			if p, ok := elem.(*parser.Paragraph); ok {
+				text.WriteString(p.Text + "\n")
+			}
+		}
+	}
+	return text.String()
+}
+
+// pngHeader is the start of a PNG, enough for type detection
+const pngHeader = "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR\x00\x00\x00\x01\x00\x00\x00\x01\x08\x06\x00\x00\x00\x1f\x15\xc4\x89"
+
+func TestCraftedEntryNames(t *testing.T) {
+	data := craft(t,
+		entry{name: "mimetype", content: "application/epub+zip"},
+		entry{name: "META-INF/container.xml", content: container},
+		entry{name: "OEBPS/content.opf", content: opf("cover.png",
+			"ch1.xhtml", "../../secret.xhtml", "/OEBPS/abs.xhtml", "caf\u00e9.xhtml", "Ch1.xhtml")},
+		entry{name: "OEBPS/ch1.xhtml", content: xhtml("First chapter.")},
+		entry{name: "OEBPS/ch1.xhtml", content: xhtml("DUPLICATE")},
+		entry{name: "OEBPS/./ch1.xhtml", content: xhtml("DUPLICATE")},
+		entry{name: "OEBPS/Ch1.xhtml", content: xhtml("Other case.")},
+		entry{name: "../secret.xhtml", content: xhtml("SECRET")},
+		entry{name: "/OEBPS/abs.xhtml", content: xhtml("ABSOLUTE")},
+		entry{name: "OEBPS/cafe\u0301.xhtml", content: xhtml("Accented name.")},
+		entry{name: "OEBPS/cover.png", content: "/etc/passwd", mode: fs.ModeSymlink | 0o777},
+	)
+
+	// The entries left out for their names are chapters the book misses
+	book, err := epub.NewParser().ParseReader(bytes.NewReader(data), int64(len(data)))
+	var partial *parser.PartialError
+	if !errors.As(err, &partial) {
+		t.Fatalf("ParseReader: %v, want a PartialError", err)
+	}
+	var missing []string
+	for _, issue := range partial.Issues {
+		missing = append(missing, issue.Part)
+	}
+	if want := []string{"../secret.xhtml", "OEBPS/OEBPS/abs.xhtml"}; !slices.Equal(missing, want) {
+		t.Errorf("issues for %q, want %q", missing, want)
+	}
+	text := bookText(book)
+	for _, want := range []string{"First chapter.", "Accented name.", "Other case."} {
+		if !strings.Contains(text, want) {
+			t.Errorf("text does not contain %q:\n%s", want, text)
+		}
+	}
+	for _, unwanted := range []string{"SECRET", "ABSOLUTE", "DUPLICATE", "/etc/passwd"} {
+		if strings.Contains(text, unwanted) {
+			t.Errorf("text contains %q:\n%s", unwanted, text)
+		}
+	}
+	if len(book.Metadata.CoverData) > 0 {
+		t.Errorf("the symbolic link was read as the cover: %q", book.Metadata.CoverData)
+	}
+
+	warnings := strings.Join(book.Warnings, "\n")
+	for _, want := range []string{"unsafe name", "symbolic link", "duplicate of an earlier entry", "differ only by case"} {
+		if !strings.Contains(warnings, want) {
+			t.Errorf("warnings do not mention %q:\n%s", want, warnings)
+		}
+	}
+
+	// The fast extractors see the same entries
+	r := bytes.NewReader(data)
+	m, err := epub.ExtractMetadataOnlyReader(r, int64(len(data)))
+	if err != nil || m.Title != "Crafted" {
+		t.Errorf("ExtractMetadataOnlyReader = %q, %v", m.Title, err)
+	}
+	if len(m.CoverData) > 0 {
+		t.Errorf("ExtractMetadataOnlyReader read the symbolic link as the cover")
+	}
+	if cover, _, _ := epub.ExtractCoverOnlyReader(r, int64(len(data))); len(cover) > 0 {
+		t.Errorf("ExtractCoverOnlyReader read the symbolic link as the cover: %q", cover)
+	}
+}
+
+func TestCraftedCoverPath(t *testing.T) {
+	for _, cover := range []string{"../../cover.png", "/cover.png", "C:/cover.png"} {
+		t.Run(cover, func(t *testing.T) {
+			data := craft(t,
+				entry{name: "mimetype", content: "application/epub+zip"},
+				entry{name: "META-INF/container.xml", content: container},
+				entry{name: "OEBPS/content.opf", content: opf(cover, "ch1.xhtml")},
+				entry{name: "OEBPS/ch1.xhtml", content: xhtml("Text.")},
+				entry{name: strings.TrimPrefix(cover, "../"), content: pngHeader},
+				entry{name: cover, content: pngHeader},
+			)
+			got, _, err := epub.ExtractCoverOnlyReader(bytes.NewReader(data), int64(len(data)))
+			if err == nil && len(got) > 0 {
+				t.Errorf("ExtractCoverOnlyReader read a cover outside the package")
+			}
+		})
+	}
+}
+
+func TestCraftedAssetsStayInDestDir(t *testing.T) {
+	root := t.TempDir()
+	bookPath := filepath.Join(root, "book.epub")
+	data := craft(t,
+		entry{name: "mimetype", content: "application/epub+zip"},
+		entry{name: "META-INF/container.xml", content: container},
+		entry{name: "OEBPS/content.opf", content: strings.Replace(opf("cover.png", "ch1.xhtml"),
+			"</manifest>", `<item id="x1" href="../../../evil.png" media-type="image/png"/>`+
+				`<item id="x2" href="/abs.png" media-type="image/png"/>`+
+				`<item id="x3" href="link.png" media-type="image/png"/></manifest>`, 1)},
+		entry{name: "OEBPS/ch1.xhtml", content: xhtml("Text.")},
+		entry{name: "OEBPS/cover.png", content: pngHeader},
+		entry{name: "../../evil.png", content: pngHeader},
+		entry{name: "/abs.png", content: pngHeader},
+		entry{name: "OEBPS/link.png", content: "/etc/passwd", mode: fs.ModeSymlink | 0o777},
+	)
+	if err := os.WriteFile(bookPath, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	dest := filepath.Join(root, "a", "b", "dest")
+	assets, _ := epub.ExtractAssets(bookPath, dest, parser.AssetOptions{})
+	for _, asset := range assets {
+		if rel, err := filepath.Rel(dest, asset.Path); err != nil || !filepath.IsLocal(rel) {
+			t.Errorf("asset written to %q", asset.Path)
+		}
+	}
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() && path != bookPath && !strings.HasPrefix(path, dest+string(filepath.Separator)) {
+			t.Errorf("file written outside the destination: %s", path)
+		}
+		if err == nil && d.Type()&fs.ModeSymlink != 0 {
+			t.Errorf("symbolic link written: %s", path)
+		}
+		return nil
+	})
+}
+
+func FuzzParseReader(f *testing.F) {
+	f.Add(epubtest.New().WithTitle("Seed").WithChapter("One", "<p>Text.</p>").WithCover([]byte(pngHeader)).Bytes())
+	f.Add(epubtest.New().EPUB2().WithEncodedHrefs().WithChapter("One", "<p>Text.</p>").Bytes())
+	f.Add(craft(f,
+		entry{name: "mimetype", content: "application/epub+zip"},
+		entry{name: "META-INF/container.xml", content: container},
+		entry{name: "OEBPS/content.opf", content: opf("../cover.png", "ch1.xhtml", "../x.xhtml")},
+		entry{name: "OEBPS/ch1.xhtml", content: xhtml("a")},
+		entry{name: "OEBPS/ch1.xhtml", content: xhtml("b")},
+		entry{name: "../x.xhtml", content: xhtml("c")},
+		entry{name: "cover.png", content: "x", mode: fs.ModeSymlink | 0o777},
+	))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		r := bytes.NewReader(data)
+		size := int64(len(data))
+		// Errors are fine, panics and hangs are not
+		epub.NewParser().ParseReader(r, size)
+		epub.ExtractMetadataOnlyReader(r, size)
+		epub.ExtractCoverOnlyReader(r, size)
+		epub.ExtractAnnotationOnlyReader(r, size)
+	})
+}
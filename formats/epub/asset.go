@@ -0,0 +1,90 @@
+package epub
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"path"
+	"strings"
+
+	"github.com/vpoluyaktov/biblio-ebook-parser/parser"
+)
+
+// contentMediaTypes are the manifest items ExtractAssets leaves out: the
+// documents read as the book's text and navigation rather than resources
+var contentMediaTypes = map[string]bool{
+	"application/xhtml+xml":         true,
+	"text/html":                     true,
+	"application/x-dtbncx+xml":      true,
+	"application/oebps-package+xml": true,
+}
+
+// ExtractAssets writes the images, fonts, stylesheets and other resources
+// the manifest of an EPUB file or directory lists under destDir, keeping
+// their paths in the container. Items missing from the container or over the
+// size limit are left out.
+func ExtractAssets(filePath, destDir string, opts parser.AssetOptions) ([]parser.AssetInfo, error) {
+	files, closer, err := openFiles(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer closer.Close()
+
+	info, err := extractPackageInfo(files)
+	if err != nil {
+		return nil, err
+	}
+
+	limit := int64(DefaultMaxFileSize)
+	if opts.MaxSize > 0 {
+		limit = opts.MaxSize
+	}
+
+	var assets []parser.AssetInfo
+	seen := make(map[string]bool)
+	for _, item := range info.Manifest {
+		mediaType := item.MediaType
+		if mediaType == "" {
+			mediaType = mime.TypeByExtension(path.Ext(item.Path))
+		}
+		mediaType, _, _ = strings.Cut(strings.ToLower(mediaType), ";")
+		// Paths differing only by case would overwrite each other on some
+		// file systems
+		key := strings.ToLower(item.Path)
+		if contentMediaTypes[mediaType] || seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		f, err := files.findFile(item.Path)
+		if err != nil {
+			continue
+		}
+		if size, known := fileSize(f); known && !opts.Keeps(mediaType, size) {
+			continue
+		}
+		data, err := readFile(f, limit)
+		if errors.Is(err, ErrFileTooLarge) {
+			continue
+		}
+		if err != nil {
+			return assets, fmt.Errorf("failed to read %s: %w", item.Path, err)
+		}
+		if !opts.Keeps(mediaType, int64(len(data))) {
+			continue
+		}
+
+		written, err := parser.WriteAsset(destDir, item.Path, data, opts)
+		if err != nil {
+			return assets, err
+		}
+		assets = append(assets, parser.AssetInfo{
+			ID:        item.ID,
+			Href:      item.Href,
+			MediaType: mediaType,
+			Size:      int64(len(data)),
+			Path:      written,
+		})
+	}
+	return assets, nil
+}
@@ -0,0 +1,130 @@
+package epub_test
+
+import (
+	"bytes"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/vpoluyaktov/biblio-ebook-parser/formats/epub"
+	"github.com/vpoluyaktov/biblio-ebook-parser/parser"
+	"github.com/vpoluyaktov/biblio-ebook-parser/testutil/epubtest"
+)
+
+// parseBroken parses a book expected to fail in part, returning it with the
+// parts that failed
+func parseBroken(t *testing.T, data []byte) (*parser.Book, []string) {
+	t.Helper()
+	book, err := epub.NewParser().ParseReader(bytes.NewReader(data), int64(len(data)))
+	var partial *parser.PartialError
+	if !errors.As(err, &partial) {
+		t.Fatalf("ParseReader: %v, want a PartialError", err)
+	}
+	if book == nil {
+		t.Fatal("no book with the PartialError")
+	}
+	var parts []string
+	for _, issue := range partial.Issues {
+		if !strings.Contains(issue.Error(), "failed to read chapter") {
+			t.Errorf("issue %q does not say the chapter failed", issue.Error())
+		}
+		parts = append(parts, issue.Part)
+	}
+	return book, parts
+}
+
+func TestBrokenSpineChapters(t *testing.T) {
+	blank := `<?xml version="1.0"?><html xmlns="http://www.w3.org/1999/xhtml"><head><title>x</title></head><body></body></html>`
+	data := craft(t,
+		entry{name: "mimetype", content: "application/epub+zip"},
+		entry{name: "META-INF/container.xml", content: container},
+		entry{name: "OEBPS/content.opf", content: strings.Replace(
+			opf("cover.png", "one.xhtml", "missing.xhtml", "bad.xhtml", "empty.xhtml", "blank.xhtml", "last.xhtml"),
+			"<spine>", `<spine><itemref idref="gone"/>`, 1)},
+		entry{name: "OEBPS/one.xhtml", content: xhtml("First chapter.")},
+		entry{name: "OEBPS/bad.xhtml", content: `<html><body><p>Unclosed <b>bold<p>Stray & ampersand</body>`},
+		entry{name: "OEBPS/empty.xhtml", content: " \n"},
+		entry{name: "OEBPS/blank.xhtml", content: blank},
+		entry{name: "OEBPS/last.xhtml", content: xhtml("Last chapter.")},
+	)
+
+	book, parts := parseBroken(t, data)
+	if want := []string{"OEBPS/missing.xhtml"}; !slices.Equal(parts, want) {
+		t.Errorf("issues for %q, want %q", parts, want)
+	}
+
+	// Malformed markup is read leniently, and a chapter without text kept
+	var ids []string
+	for _, ch := range book.Content.Chapters {
+		ids = append(ids, ch.ID)
+	}
+	if want := []string{"cha", "chc", "che", "chf"}; !slices.Equal(ids, want) {
+		t.Errorf("chapters %q, want %q", ids, want)
+	}
+	text := bookText(book)
+	for _, want := range []string{"First chapter.", "Unclosed bold", "Stray & ampersand", "Last chapter."} {
+		if !strings.Contains(text, want) {
+			t.Errorf("text does not contain %q:\n%s", want, text)
+		}
+	}
+
+	want := []string{
+		`spine item "gone" skipped: not in the manifest`,
+		"OEBPS/missing.xhtml: failed to read chapter: file not found: OEBPS/missing.xhtml",
+		"chapter OEBPS/empty.xhtml skipped: empty file",
+	}
+	for _, w := range want {
+		if !slices.Contains(book.Warnings, w) {
+			t.Errorf("warnings do not include %q:\n%s", w, strings.Join(book.Warnings, "\n"))
+		}
+	}
+	if len(book.Warnings) != len(want) {
+		t.Errorf("warnings:\n%s\nwant:\n%s", strings.Join(book.Warnings, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestBrokenTOCChapters(t *testing.T) {
+	built := epubtest.New().WithTitle("Broken").
+		WithChapterFile("one.xhtml", "One", "<p>First chapter.</p>").
+		WithChapterFile("two.xhtml", "Two", "<p>Lost chapter.</p>").
+		WithChapterFile("empty.xhtml", "Empty", "<p>Emptied.</p>").
+		WithChapterFile("three.xhtml", "Three", "<p>Unclosed <b>bold<p>Stray & ampersand</p>").
+		WithNav().Bytes()
+
+	// The second chapter's file is left out of the container, and the
+	// third's emptied
+	var entries []entry
+	for _, e := range unzip(t, built) {
+		switch e.name {
+		case "OEBPS/two.xhtml":
+		case "OEBPS/empty.xhtml":
+			entries = append(entries, entry{name: e.name})
+		default:
+			entries = append(entries, entry{name: e.name, content: string(e.data)})
+		}
+	}
+	book, parts := parseBroken(t, craft(t, entries...))
+	if want := []string{"OEBPS/two.xhtml"}; !slices.Equal(parts, want) {
+		t.Errorf("issues for %q, want %q", parts, want)
+	}
+
+	var titles []string
+	for _, ch := range book.Content.Chapters {
+		titles = append(titles, ch.Title)
+	}
+	if want := []string{"One", "Three"}; !slices.Equal(titles, want) {
+		t.Errorf("chapters %q, want %q", titles, want)
+	}
+	text := bookText(book)
+	if !strings.Contains(text, "Stray & ampersand") || strings.Contains(text, "Lost") || strings.Contains(text, "Emptied") {
+		t.Errorf("text:\n%s", text)
+	}
+	want := []string{
+		`TOC entry "Empty" skipped: OEBPS/empty.xhtml is empty`,
+		"OEBPS/two.xhtml: failed to read chapter: file not found: OEBPS/two.xhtml",
+	}
+	if !slices.Equal(book.Warnings, want) {
+		t.Errorf("warnings %q, want %q", book.Warnings, want)
+	}
+}
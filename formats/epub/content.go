@@ -1,17 +1,48 @@
 package epub
 
 import (
-	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
 	"fmt"
 	"io"
+	"net/url"
 	"path/filepath"
 	"regexp"
 	"strings"
+	"unicode"
 
 	"github.com/vpoluyaktov/biblio-ebook-parser/parser"
 )
 
-func extractContent(zr *zip.Reader, baseDir string, pkg epubPackage) parser.Content {
+var (
+	reControlChars  = regexp.MustCompile(`[\x00-\x08\x0B\x0C\x0E-\x1F]`)
+	reStrayLessThan = regexp.MustCompile(`<([^A-Za-z/!?]|$)`)
+	reLineBreak     = regexp.MustCompile(`(?i)<br\b[^>]*>`)
+)
+
+// blockTags end a paragraph left open before them, as in browsers
+var blockTags = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true,
+	"body": true, "dd": true, "div": true, "dl": true, "dt": true,
+	"figcaption": true, "figure": true, "footer": true, "header": true,
+	"hr": true, "li": true, "nav": true, "ol": true, "pre": true,
+	"section": true, "table": true, "td": true, "th": true, "tr": true,
+	"ul": true,
+}
+
+// skippedTags are dropped together with their content
+var skippedTags = map[string]bool{
+	"head":   true,
+	"script": true,
+	"style":  true,
+	"title":  true,
+}
+
+// extractContent reads the chapters, returning warnings for those skipped
+// for their size or left out of the TOC, and issues for those that failed to
+// read
+func (p *Parser) extractContent(files fileOpener, baseDir string, pkg epubPackage, bookTitle string, marks []landmark) (parser.Content, []string, []parser.Issue) {
 	content := parser.Content{
 		Chapters: []parser.Chapter{},
 	}
@@ -25,83 +56,120 @@ func extractContent(zr *zip.Reader, baseDir string, pkg epubPackage) parser.Cont
 	}
 
 	// Try TOC-based extraction first
-	tocChapters := extractChaptersFromTOC(zr, baseDir, manifestMap, manifestMediaTypeMap, pkg.Spine.TOC)
+	firstSpinePath := ""
+	if len(pkg.Spine.ItemRefs) > 0 {
+		if href, ok := manifestMap[pkg.Spine.ItemRefs[0].IDRef]; ok {
+			firstSpinePath = normalizeEPUBPath(baseDir, href)
+		}
+	}
+	tocChapters, warnings, issues := p.extractChaptersFromTOC(files, baseDir, manifestMap, manifestMediaTypeMap, pkg.Spine.TOC, bookTitle, firstSpinePath, marks)
 	if len(tocChapters) > 0 {
 		content.Chapters = tocChapters
-		return content
+		return content, warnings, issues
+	}
+	warnings, issues = nil, nil
+	if log := parser.Logger(); log != nil {
+		log.Debug("EPUB has no usable TOC, chapters from spine", "items", len(pkg.Spine.ItemRefs))
 	}
 
-	// Fallback to spine-based extraction
+	// Fallback to spine-based extraction, with titles from the headings as
+	// there are no TOC titles
 	for i, itemRef := range pkg.Spine.ItemRefs {
 		href, ok := manifestMap[itemRef.IDRef]
 		if !ok {
+			warnings = append(warnings, fmt.Sprintf("spine item %q skipped: not in the manifest", itemRef.IDRef))
 			continue
 		}
 
 		fullPath := normalizeEPUBPath(baseDir, href)
-		chapterFile, err := findFileInZip(zr, fullPath)
+		chapterFile, err := files.findFile(fullPath)
 		if err != nil {
+			issues = append(issues, parser.Issue{Part: fullPath, Err: fmt.Errorf("failed to read chapter: %w", err)})
 			continue
 		}
 
-		rc, err := chapterFile.Open()
+		chapterData, err := readContentFile(chapterFile, p.maxFileSize())
 		if err != nil {
+			if errors.Is(err, ErrFileTooLarge) {
+				warnings = append(warnings, fmt.Sprintf("chapter %s skipped: %v", fullPath, err))
+			} else {
+				issues = append(issues, parser.Issue{Part: fullPath, Err: fmt.Errorf("failed to read chapter: %w", err)})
+			}
 			continue
 		}
 
-		chapterData, err := io.ReadAll(rc)
-		rc.Close()
-		if err != nil {
+		htmlContent := string(chapterData)
+		if strings.TrimSpace(htmlContent) == "" {
+			warnings = append(warnings, fmt.Sprintf("chapter %s skipped: empty file", fullPath))
 			continue
 		}
-
-		htmlContent := string(chapterData)
 		defaultTitle := fmt.Sprintf("Chapter %d", i+1)
 		chapterTitle := extractChapterTitle(htmlContent, defaultTitle)
 
-		elements := htmlToElements(htmlContent)
-		content.Chapters = append(content.Chapters, parser.Chapter{
-			ID:       itemRef.IDRef,
-			Title:    strings.TrimSpace(chapterTitle),
-			Level:    0,
-			Elements: elements,
-		})
+		elements := htmlToElements(htmlContent, p.ElementFilter, p.KeepHTML)
+		chapter := parser.Chapter{
+			ID:         itemRef.IDRef,
+			Title:      strings.TrimSpace(chapterTitle),
+			Level:      0,
+			Elements:   elements,
+			SourcePath: fullPath,
+			SourceEnd:  len(chapterData),
+		}
+		chapter.Role = chapterRole(newRoleScanner(htmlContent).roleAt(0), landmarkRole(marks, chapter))
+		content.Chapters = append(content.Chapters, chapter)
 	}
 
-	return content
+	return content, warnings, issues
 }
 
-func extractChaptersFromTOC(zr *zip.Reader, packageBaseDir string, manifestMap map[string]string, manifestMediaTypeMap map[string]string, spineTOCID string) []parser.Chapter {
-	entries := extractTOCEntries(zr, packageBaseDir, manifestMap, manifestMediaTypeMap, spineTOCID)
+// extractChaptersFromTOC splits the content at the TOC entries, titling the
+// chapters with the entries. With HeadingTitles, the first heading of each
+// chapter replaces the entry title. A leading entry that only names the book
+// and leads to the first spine item, a title page rather than a chapter, is
+// left out.
+func (p *Parser) extractChaptersFromTOC(files fileOpener, packageBaseDir string, manifestMap map[string]string, manifestMediaTypeMap map[string]string, spineTOCID, bookTitle, firstSpinePath string, marks []landmark) ([]parser.Chapter, []string, []parser.Issue) {
+	entries, warnings := extractTOCEntries(files, packageBaseDir, manifestMap, manifestMediaTypeMap, spineTOCID)
 	if len(entries) == 0 {
-		return nil
+		return nil, nil, nil
+	}
+	if len(entries) > 1 && entries[0].Path == firstSpinePath && sameTitle(entries[0].Title, bookTitle) {
+		warnings = append(warnings, fmt.Sprintf("TOC entry %q skipped: repeats the book title on the first spine item", entries[0].Title))
+		entries = entries[1:]
 	}
 
-	htmlCache := make(map[string]string)
+	// Only the file of the current entry is kept, as entries of the same file
+	// are usually consecutive
+	var htmlPath, htmlContent string
+	var roles *roleScanner
+	skipped := make(map[string]bool)
+	var issues []parser.Issue
 	chapters := make([]parser.Chapter, 0, len(entries))
+	level := -1 // Of the previous chapter
 
 	for i, entry := range entries {
-		if entry.Path == "" || strings.TrimSpace(entry.Title) == "" {
+		if entry.Path == "" || strings.TrimSpace(entry.Title) == "" || skipped[entry.Path] {
 			continue
 		}
 
-		htmlContent, ok := htmlCache[entry.Path]
-		if !ok {
-			chapterFile, err := findFileInZip(zr, entry.Path)
+		if entry.Path != htmlPath {
+			chapterFile, err := files.findFile(entry.Path)
 			if err != nil {
+				skipped[entry.Path] = true
+				issues = append(issues, parser.Issue{Part: entry.Path, Err: fmt.Errorf("failed to read chapter: %w", err)})
 				continue
 			}
-			rc, err := chapterFile.Open()
-			if err != nil {
-				continue
-			}
-			data, err := io.ReadAll(rc)
-			rc.Close()
+			data, err := readContentFile(chapterFile, p.maxFileSize())
 			if err != nil {
+				skipped[entry.Path] = true
+				if errors.Is(err, ErrFileTooLarge) {
+					warnings = append(warnings, fmt.Sprintf("chapter %s skipped: %v", entry.Path, err))
+				} else {
+					issues = append(issues, parser.Issue{Part: entry.Path, Err: fmt.Errorf("failed to read chapter: %w", err)})
+				}
 				continue
 			}
-			htmlContent = string(data)
-			htmlCache[entry.Path] = htmlContent
+			htmlPath, htmlContent = entry.Path, string(data)
+			roles = newRoleScanner(htmlContent)
 		}
 
 		start := findAnchorStart(htmlContent, entry.Anchor)
@@ -119,93 +187,260 @@ func extractChaptersFromTOC(zr *zip.Reader, packageBaseDir string, manifestMap m
 			end = len(htmlContent)
 		}
 
-		segment := strings.TrimSpace(htmlContent[start:end])
+		// Trim the range too, so it still locates the segment
+		segment := strings.TrimLeftFunc(htmlContent[start:end], unicode.IsSpace)
+		start = end - len(segment)
+		segment = strings.TrimRightFunc(segment, unicode.IsSpace)
+		end = start + len(segment)
 		if segment == "" {
+			warnings = append(warnings, fmt.Sprintf("TOC entry %q skipped: %s is empty", entry.Title, entry.Path))
 			continue
 		}
 
+		// The curated TOC title wins over headings, which are often a banner
+		// with the book title repeated in every file
 		title := strings.TrimSpace(entry.Title)
-		title = extractChapterTitle(segment, title)
-
-		elements := htmlToElements(segment)
-		chapters = append(chapters, parser.Chapter{
-			ID:       fmt.Sprintf("toc-%d", i+1),
-			Title:    title,
-			Level:    0,
-			Elements: elements,
-		})
+		if p.HeadingTitles {
+			title = extractChapterTitle(segment, title)
+		}
+
+		// The TOC nesting, with entries left out, can skip levels
+		level = min(entry.Level, level+1)
+
+		elements := htmlToElements(segment, p.ElementFilter, p.KeepHTML)
+		chapter := parser.Chapter{
+			ID:           fmt.Sprintf("toc-%d", i+1),
+			Title:        title,
+			Level:        level,
+			Elements:     elements,
+			SourcePath:   entry.Path,
+			SourceAnchor: entry.Anchor,
+			SourceStart:  start,
+			SourceEnd:    end,
+		}
+		chapter.Role = chapterRole(entry.Role, roles.roleAt(start), landmarkRole(marks, chapter))
+		chapters = append(chapters, chapter)
 	}
 
-	return chapters
+	return chapters, warnings, issues
 }
 
-func htmlToElements(htmlContent string) []parser.Element {
-	elements := []parser.Element{}
-
-	// Remove head, script, style tags
-	reHead := regexp.MustCompile(`(?is)<head[^>]*>.*?</head>`)
-	reScript := regexp.MustCompile(`(?is)<script[^>]*>.*?</script>`)
-	reStyle := regexp.MustCompile(`(?is)<style[^>]*>.*?</style>`)
-
-	htmlContent = reHead.ReplaceAllString(htmlContent, "")
-	htmlContent = reScript.ReplaceAllString(htmlContent, "")
-	htmlContent = reStyle.ReplaceAllString(htmlContent, "")
-
-	// Extract headings (match each level separately since Go regexp doesn't support backreferences)
-	headingPatterns := []struct {
-		pattern *regexp.Regexp
-		level   int
-	}{
-		{regexp.MustCompile(`(?is)<h1[^>]*>(.*?)</h1>`), 1},
-		{regexp.MustCompile(`(?is)<h2[^>]*>(.*?)</h2>`), 2},
-		{regexp.MustCompile(`(?is)<h3[^>]*>(.*?)</h3>`), 3},
-		{regexp.MustCompile(`(?is)<h4[^>]*>(.*?)</h4>`), 4},
-		{regexp.MustCompile(`(?is)<h5[^>]*>(.*?)</h5>`), 5},
-		{regexp.MustCompile(`(?is)<h6[^>]*>(.*?)</h6>`), 6},
+// newLenientDecoder returns a decoder for XHTML that is often tag soup,
+// already converted to UTF-8 whatever charset its prolog still declares
+func newLenientDecoder(content string) *xml.Decoder {
+	decoder := xml.NewDecoder(strings.NewReader(content))
+	decoder.Strict = false
+	decoder.AutoClose = xml.HTMLAutoClose
+	decoder.Entity = xml.HTMLEntity
+	decoder.CharsetReader = func(label string, input io.Reader) (io.Reader, error) {
+		return input, nil
 	}
+	return decoder
+}
 
-	for _, hp := range headingPatterns {
-		matches := hp.pattern.FindAllStringSubmatch(htmlContent, -1)
-		for _, match := range matches {
-			if len(match) >= 2 {
-				text := strings.TrimSpace(stripHTMLTags(match[1]))
-				if text != "" {
-					elements = append(elements, &parser.Heading{
-						Text:  text,
-						Level: hp.level,
-					})
-				}
+// htmlToElements converts chapter markup to headings, paragraphs and images
+// in document order. Text outside <p>, such as in a bare <div>, makes
+// paragraphs too. Images become elements unless they sit in a paragraph
+// with text, whose markup keeps them; a figcaption following an image in a
+// figure becomes its caption. It tolerates tag soup: a paragraph left open
+// ends at the next block-level tag, stray ampersands and angle brackets are
+// kept as text and markup inside comments is ignored. Paragraphs and images
+// are only built if the filter keeps them, and paragraphs only keep their
+// markup with keepHTML.
+func htmlToElements(htmlContent string, filter parser.ElementFilter, keepHTML bool) []parser.Element {
+	elements := []parser.Element{}
+	keepParagraphs := filter.Keeps(parser.ElementTypeParagraph)
+	keepImages := filter.Keeps(parser.ElementTypeImage)
+	htmlContent = cleanMarkup(htmlContent)
+
+	decoder := newLenientDecoder(htmlContent)
+
+	var text strings.Builder
+	level := -1 // Level of the open heading, 0 for a paragraph, -1 for none
+	blockStart := 0
+	skip, skipDepth := "", 0
+	var blockImages []*parser.Image // Images in the open paragraph or heading
+	figureDepth := 0
+	var figureImage *parser.Image // Last image of the open figure
+	var caption strings.Builder
+	inCaption := false
+
+	flush := func(end int64) {
+		value := strings.TrimSpace(text.String())
+		if value == "" {
+			for _, img := range blockImages {
+				elements = append(elements, img)
+			}
+		}
+		blockImages = nil
+		switch {
+		case level < 0 || value == "":
+		case level == 0 && keepParagraphs:
+			para := &parser.Paragraph{Text: value}
+			if keepHTML {
+				para.HTML = strings.TrimSpace(htmlContent[blockStart:end])
+			}
+			elements = append(elements, para)
+		case level > 0:
+			if value = joinTitleLines(value); value != "" {
+				elements = append(elements, &parser.Heading{Text: value, Level: level})
 			}
 		}
+		text.Reset()
+		level = -1
 	}
 
-	// Extract paragraphs
-	reParagraph := regexp.MustCompile(`(?is)<p[^>]*>(.*?)</p>`)
-	paragraphMatches := reParagraph.FindAllStringSubmatch(htmlContent, -1)
-	for _, match := range paragraphMatches {
-		if len(match) >= 2 {
-			text := stripHTMLTags(match[1])
-			if strings.TrimSpace(text) != "" {
-				elements = append(elements, &parser.Paragraph{
-					Text: strings.TrimSpace(text),
-					HTML: match[0],
-				})
+	for {
+		offset := decoder.InputOffset()
+		token, err := decoder.RawToken()
+		if err != nil {
+			// io.EOF, or markup too broken to go on: keep what was read
+			flush(offset)
+			break
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			name := strings.ToLower(t.Name.Local)
+			if skip != "" {
+				if name == skip {
+					skipDepth++
+				}
+				continue
+			}
+			if skippedTags[name] {
+				skip, skipDepth = name, 1
+				continue
+			}
+
+			if name == "p" || headingLevel(name) > 0 || blockTags[name] {
+				flush(offset)
+			}
+			if name == "p" {
+				level, blockStart = 0, int(offset)
+			} else if l := headingLevel(name); l > 0 {
+				level = l
+			}
+
+			switch name {
+			case "br":
+				if level > 0 {
+					text.WriteRune(titleLineBreak)
+				}
+			case "figure":
+				figureDepth++
+			case "figcaption":
+				inCaption = figureImage != nil
+				caption.Reset()
+			case "img", "image":
+				img := imageElement(t)
+				if img == nil || !keepImages {
+					break
+				}
+				if figureDepth > 0 {
+					figureImage = img
+				}
+				if level >= 0 {
+					blockImages = append(blockImages, img)
+				} else {
+					elements = append(elements, img)
+				}
+			}
+
+		case xml.EndElement:
+			name := strings.ToLower(t.Name.Local)
+			if skip != "" {
+				if name == skip {
+					skipDepth--
+					if skipDepth == 0 {
+						skip = ""
+					}
+				}
+				continue
+			}
+			if name == "p" || headingLevel(name) > 0 {
+				flush(decoder.InputOffset())
+			} else if blockTags[name] {
+				flush(offset)
+			}
+
+			switch {
+			case name == "figcaption" && inCaption:
+				figureImage.Caption = strings.Join(strings.Fields(caption.String()), " ")
+				inCaption = false
+			case name == "figure" && figureDepth > 0:
+				figureDepth--
+				if figureDepth == 0 {
+					figureImage = nil
+				}
+			}
+
+		case xml.CharData:
+			if skip != "" {
+				continue
+			}
+			if inCaption {
+				caption.Write(t)
+				continue
+			}
+			// Text outside paragraphs, such as in a bare <div>, starts one
+			if level < 0 && len(bytes.TrimSpace(t)) > 0 {
+				level, blockStart = 0, int(offset)
+			}
+			if level > 0 || keepParagraphs {
+				text.Write(t)
 			}
 		}
 	}
 
-	// If no structured content found, treat entire content as one paragraph
-	if len(elements) == 0 {
-		text := stripHTMLTags(htmlContent)
-		if strings.TrimSpace(text) != "" {
-			elements = append(elements, &parser.Paragraph{
-				Text: strings.TrimSpace(text),
-				HTML: htmlContent,
-			})
+	return elements
+}
+
+// imageElement returns the image an img tag, or an SVG image, refers to,
+// with its alt text or else its title. Returns nil without a source.
+func imageElement(t xml.StartElement) *parser.Image {
+	var src, alt, title string
+	for _, attr := range t.Attr {
+		switch strings.ToLower(attr.Name.Local) {
+		case "src", "href":
+			if src == "" {
+				src = strings.TrimSpace(attr.Value)
+			}
+		case "alt":
+			alt = strings.TrimSpace(attr.Value)
+		case "title":
+			title = strings.TrimSpace(attr.Value)
 		}
 	}
+	if src == "" {
+		return nil
+	}
+	if alt == "" {
+		alt = title
+	}
+	return &parser.Image{Href: src, Alt: alt}
+}
 
-	return elements
+// sameTitle reports whether two titles are equal ignoring case and whitespace
+func sameTitle(a, b string) bool {
+	a, b = strings.Join(strings.Fields(a), " "), strings.Join(strings.Fields(b), " ")
+	return a != "" && strings.EqualFold(a, b)
+}
+
+// cleanMarkup fixes what stops the XML tokenizer even in non-strict mode:
+// invalid UTF-8, control characters and a < that starts no tag
+func cleanMarkup(markup string) string {
+	markup = strings.ToValidUTF8(markup, "\uFFFD")
+	markup = reControlChars.ReplaceAllString(markup, "")
+	return reStrayLessThan.ReplaceAllString(markup, "&lt;$1")
+}
+
+// headingLevel returns the level of an h1-h6 tag name, 0 for other tags
+func headingLevel(name string) int {
+	if len(name) == 2 && name[0] == 'h' && name[1] >= '1' && name[1] <= '6' {
+		return int(name[1] - '0')
+	}
+	return 0
 }
 
 func extractChapterTitle(htmlContent, fallback string) string {
@@ -218,8 +453,7 @@ func extractChapterTitle(htmlContent, fallback string) string {
 		if len(matches) < 2 {
 			continue
 		}
-		title := strings.TrimSpace(stripHTMLTags(matches[1]))
-		if title != "" {
+		if title := titleText(matches[1]); title != "" {
 			return title
 		}
 	}
@@ -227,8 +461,7 @@ func extractChapterTitle(htmlContent, fallback string) string {
 	titlePattern := regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
 	titleMatches := titlePattern.FindStringSubmatch(htmlContent)
 	if len(titleMatches) >= 2 {
-		title := strings.TrimSpace(stripHTMLTags(titleMatches[1]))
-		if title != "" {
+		if title := titleText(titleMatches[1]); title != "" {
 			return title
 		}
 	}
@@ -237,8 +470,15 @@ func extractChapterTitle(htmlContent, fallback string) string {
 }
 
 func findAnchorStart(htmlContent, anchor string) int {
+	start, _ := anchorPosition(htmlContent, anchor)
+	return start
+}
+
+// anchorPosition returns the offset of the tag with the given id or name,
+// 0 for an empty anchor. Reports false if the anchor isn't there.
+func anchorPosition(htmlContent, anchor string) (int, bool) {
 	if anchor == "" {
-		return 0
+		return 0, true
 	}
 	quotedAnchor := regexp.QuoteMeta(anchor)
 	patterns := []*regexp.Regexp{
@@ -250,10 +490,38 @@ func findAnchorStart(htmlContent, anchor string) int {
 	for _, pattern := range patterns {
 		loc := pattern.FindStringIndex(htmlContent)
 		if loc != nil {
-			return loc[0]
+			return loc[0], true
 		}
 	}
-	return 0
+	return 0, false
+}
+
+// titleSeparator joins the lines of a title broken with <br>, as
+// fb2.DefaultTitleSeparator does those of FB2 titles
+const titleSeparator = " — "
+
+// titleLineBreak stands for a <br> in title text until the lines are joined
+const titleLineBreak = '\u2028'
+
+// titleText returns the text of title markup, its lines joined
+func titleText(markup string) string {
+	return joinTitleLines(stripHTMLTags(reLineBreak.ReplaceAllString(markup, string(titleLineBreak))))
+}
+
+// joinTitleLines joins the lines of a title with titleSeparator, collapsing
+// the whitespace of each and dropping empty ones. A single line is only
+// trimmed.
+func joinTitleLines(title string) string {
+	if !strings.ContainsRune(title, titleLineBreak) {
+		return strings.TrimSpace(title)
+	}
+	var lines []string
+	for line := range strings.SplitSeq(title, string(titleLineBreak)) {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, titleSeparator)
 }
 
 func stripHTMLTags(s string) string {
@@ -279,5 +547,9 @@ func normalizeEPUBPath(baseDir, href string) string {
 	if i := strings.Index(href, "?"); i >= 0 {
 		href = href[:i]
 	}
+	// Hrefs are URLs, so "chapter%201.xhtml" names "chapter 1.xhtml"
+	if unescaped, err := url.PathUnescape(href); err == nil {
+		href = unescaped
+	}
 	return filepath.ToSlash(filepath.Clean(filepath.Join(baseDir, href)))
 }
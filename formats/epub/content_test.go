@@ -0,0 +1,142 @@
+package epub_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/vpoluyaktov/biblio-ebook-parser/formats/epub"
+	"github.com/vpoluyaktov/biblio-ebook-parser/parser"
+	"github.com/vpoluyaktov/biblio-ebook-parser/testutil/epubtest"
+)
+
+// bannerBook opens every chapter file with an h1 banner repeating the book
+// title, before the chapter's own heading
+func bannerBook() *epubtest.Builder {
+	return epubtest.New().
+		WithTitle("The Long Siege").
+		WithChapter("Chapter 1: The Walls", `<h1 class="banner">The Long Siege</h1><h2>I</h2><p>The walls were old.</p>`).
+		WithChapter("Chapter 12: The Siege", `<h1 class="banner">The Long Siege</h1><p>The siege began at dawn.</p>`).
+		WithChapter("Epilogue", `<h1 class="banner">The Long Siege</h1><h2>After</h2><p>It was over.</p>`)
+}
+
+func chapterTitles(t *testing.T, p *epub.Parser, data []byte) string {
+	t.Helper()
+	book, err := p.ParseReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("ParseReader: %v", err)
+	}
+	var titles []string
+	for _, ch := range book.Content.Chapters {
+		titles = append(titles, ch.Title)
+	}
+	return strings.Join(titles, " | ")
+}
+
+func TestTOCTitlesWinOverBannerHeadings(t *testing.T) {
+	books := map[string][]byte{
+		"nav": bannerBook().WithNav().Bytes(),
+		"ncx": bannerBook().EPUB2().Bytes(),
+	}
+	for name, data := range books {
+		t.Run(name, func(t *testing.T) {
+			want := "Chapter 1: The Walls | Chapter 12: The Siege | Epilogue"
+			if got := chapterTitles(t, epub.NewParser(), data); got != want {
+				t.Errorf("titles = %q, want %q", got, want)
+			}
+
+			// HeadingTitles brings back the first heading, here the banner
+			p := epub.NewParser()
+			p.HeadingTitles = true
+			want = "The Long Siege | The Long Siege | The Long Siege"
+			if got := chapterTitles(t, p, data); got != want {
+				t.Errorf("titles with HeadingTitles = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestSpineChaptersTitledByHeadings(t *testing.T) {
+	// No chapter is in the TOC, so the chapters come from the spine
+	data := epubtest.New().
+		WithTitle("No TOC").
+		WithChapter("", `<h1>Prologue</h1><p>Before it all.</p>`).
+		WithChapter("", `<h2>The Middle</h2><p>During it all.</p>`).
+		Bytes()
+	for _, headingTitles := range []bool{false, true} {
+		p := epub.NewParser()
+		p.HeadingTitles = headingTitles
+		if got, want := chapterTitles(t, p, data), "Prologue | The Middle"; got != want {
+			t.Errorf("HeadingTitles %v: titles = %q, want %q", headingTitles, got, want)
+		}
+	}
+}
+
+func TestTOCTitleKeepsChapterText(t *testing.T) {
+	data := bannerBook().Bytes()
+	book, err := epub.NewParser().ParseReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("ParseReader: %v", err)
+	}
+	// The banner stays in the text, as a heading
+	first := book.Content.Chapters[0]
+	if len(first.Elements) == 0 {
+		t.Fatal("first chapter has no elements")
+	}
+	if h, ok := first.Elements[0].(*parser.Heading); !ok || h.Text != "The Long Siege" {
+		t.Errorf("first element = %#v, want the banner heading", first.Elements[0])
+	}
+}
+
+// withLineBreaks turns the escaped <br/> the builder writes for titles back
+// into markup, in the headings and navigation documents
+func withLineBreaks(t *testing.T, data []byte) []byte {
+	var entries []entry
+	for _, e := range unzip(t, data) {
+		content := string(e.data)
+		if !strings.HasSuffix(e.name, ".ncx") {
+			content = strings.ReplaceAll(content, "&lt;br/&gt;", "<br/>")
+		}
+		entries = append(entries, entry{name: e.name, content: content})
+	}
+	return craft(t, entries...)
+}
+
+func TestMultiLineTitles(t *testing.T) {
+	const title, body = "Part One<br/>The Road", "<h1>Part One<br />\n  The Road</h1><p>Text.</p>"
+	tests := []struct {
+		name          string
+		b             *epubtest.Builder
+		headingTitles bool
+	}{
+		{"spine", epubtest.New().WithChapter("", body), false},
+		{"nav", epubtest.New().WithChapter(title, body).WithNav(), false},
+		{"nav with heading titles", epubtest.New().WithChapter("Other", body).WithNav(), true},
+		// An NCX label is text only, so its <br/> is escaped
+		{"ncx", epubtest.New().WithChapter(title, body).EPUB2(), false},
+	}
+	const want = "Part One — The Road"
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := withLineBreaks(t, tt.b.WithTitle("Lines").Bytes())
+			p := epub.NewParser()
+			p.HeadingTitles = tt.headingTitles
+			book, err := p.ParseReader(bytes.NewReader(data), int64(len(data)))
+			if err != nil {
+				t.Fatalf("ParseReader: %v", err)
+			}
+			if len(book.Content.Chapters) != 1 {
+				t.Fatalf("%d chapters, want 1", len(book.Content.Chapters))
+			}
+
+			// The TOC entry, and the heading in the chapter text
+			ch := book.Content.Chapters[0]
+			if ch.Title != want {
+				t.Errorf("chapter title = %q, want %q", ch.Title, want)
+			}
+			if h, ok := ch.Elements[0].(*parser.Heading); !ok || h.Text != want {
+				t.Errorf("first element = %#v, want the heading %q", ch.Elements[0], want)
+			}
+		})
+	}
+}
@@ -2,21 +2,61 @@ package epub
 
 import (
 	"archive/zip"
+	"bytes"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 
+	"github.com/vpoluyaktov/biblio-ebook-parser/internal/charset"
 	"github.com/vpoluyaktov/biblio-ebook-parser/parser"
 )
 
 // Parser implements the parser.Parser interface for EPUB files
-type Parser struct{}
+type Parser struct {
+	// DetectLanguage classifies the text to fill in a missing language, and
+	// warns when it contradicts the declared one
+	DetectLanguage bool
+
+	// HeadingTitles titles chapters found through the TOC with the first
+	// h1/h2 of their text, as older versions did, instead of the TOC entry
+	HeadingTitles bool
+
+	// KeepRawMetadata keeps the OPF package document and its path in
+	// Metadata.Raw
+	KeepRawMetadata bool
+
+	// MaxFileSize is the largest chapter or cover read, in bytes,
+	// DefaultMaxFileSize if zero. Larger chapters are skipped with a warning
+	// and a larger cover is left out, checked before anything is allocated.
+	MaxFileSize int64
+
+	// SkipEmptyChapters drops chapters with less than MinChapterChars of text
+	// besides their title, such as image-only cover pages, and the cover and
+	// title pages the guide or landmarks mark unless they hold a paragraph of
+	// that length. Dropped chapters are reported in Book.Warnings.
+	SkipEmptyChapters bool
+
+	// MinChapterChars is the threshold of SkipEmptyChapters,
+	// DefaultMinChapterChars if zero
+	MinChapterChars int
+	// ElementFilter selects the element types built, all if nil; headings
+	// are always kept
+	ElementFilter parser.ElementFilter
+
+	// KeepHTML keeps the markup of each paragraph in Paragraph.HTML. On in
+	// NewParser; turn it off to save memory when only the text is used.
+	KeepHTML bool
+}
 
 // NewParser creates a new EPUB parser
 func NewParser() *Parser {
-	return &Parser{}
+	return &Parser{KeepHTML: true}
 }
 
 func init() {
@@ -24,20 +64,37 @@ func init() {
 	parser.RegisterExtractor("epub", &Extractor{})
 }
 
+// Clone returns a copy of the parser, to configure without changing p
+func (p *Parser) Clone() parser.Parser {
+	clone := *p
+	return &clone
+}
+
 // Format returns the format identifier
 func (p *Parser) Format() string {
 	return "epub"
 }
 
-// Parse extracts book structure from an EPUB file
+// Parse extracts book structure from an EPUB file or exploded EPUB directory
 func (p *Parser) Parse(filePath string) (*parser.Book, error) {
-	r, err := zip.OpenReader(filePath)
+	files, closer, err := openFiles(filePath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open EPUB: %w", err)
+		return nil, err
 	}
-	defer r.Close()
+	defer closer.Close()
+
+	return p.parseFromFiles(files)
+}
+
+// ParseDir extracts book structure from an exploded EPUB: a directory
+// holding META-INF/container.xml and the files it references
+func (p *Parser) ParseDir(dir string) (*parser.Book, error) {
+	return p.ParseFS(os.DirFS(dir))
+}
 
-	return p.parseFromZip(&r.Reader)
+// ParseFS extracts book structure from an exploded EPUB in a file system
+func (p *Parser) ParseFS(fsys fs.FS) (*parser.Book, error) {
+	return p.parseFromFiles(fsFiles{fsys: fsys})
 }
 
 // ParseReader extracts book structure from an io.ReaderAt
@@ -47,45 +104,117 @@ func (p *Parser) ParseReader(r io.ReaderAt, size int64) (*parser.Book, error) {
 		return nil, fmt.Errorf("failed to open EPUB as zip: %w", err)
 	}
 
-	return p.parseFromZip(zipReader)
+	return p.parseFromFiles(newZipFiles(zipReader))
 }
 
-func (p *Parser) parseFromZip(zr *zip.Reader) (*parser.Book, error) {
+func (p *Parser) parseFromFiles(files fileOpener) (*parser.Book, error) {
 	// Find and parse container.xml
-	containerFile, err := findFileInZip(zr, "META-INF/container.xml")
+	containerFile, err := files.findFile("META-INF/container.xml")
 	if err != nil {
 		return nil, fmt.Errorf("container.xml not found: %w", err)
 	}
 
 	var container epubContainer
-	if err := parseXMLFromZipFile(containerFile, &container); err != nil {
+	if err := parseXMLFromFile(containerFile, &container); err != nil {
 		return nil, fmt.Errorf("failed to parse container.xml: %w", err)
 	}
 
 	// Find and parse the package file (content.opf)
-	packageFile, err := findFileInZip(zr, container.RootFile.FullPath)
+	packageFile, err := files.findFile(container.rootFile())
 	if err != nil {
 		return nil, fmt.Errorf("package file not found: %w", err)
 	}
 
 	var pkg epubPackage
-	if err := parseXMLFromZipFile(packageFile, &pkg); err != nil {
+	if err := parseXMLFromFile(packageFile, &pkg); err != nil {
 		return nil, fmt.Errorf("failed to parse package file: %w", err)
 	}
 
 	book := &parser.Book{}
+	if z, ok := files.(zipFiles); ok {
+		book.Warnings = append(book.Warnings, z.index.Problems...)
+	}
 
 	// Extract metadata
-	book.Metadata = extractMetadata(pkg, container.RootFile.FullPath, zr)
+	var coverWarning string
+	var coverIssue *parser.Issue
+	book.Metadata, coverWarning, coverIssue = extractMetadata(pkg, container.rootFile(), files, p.maxFileSize())
+	if coverWarning != "" {
+		book.Warnings = append(book.Warnings, coverWarning)
+	}
+	if coverIssue != nil {
+		book.AddIssue(coverIssue.Part, coverIssue.Err)
+	}
+	if p.KeepRawMetadata {
+		book.Metadata.Raw = rawMetadata(packageFile, container.rootFile())
+	}
 
 	// Extract content
-	baseDir := filepath.Dir(container.RootFile.FullPath)
-	book.Content = extractContent(zr, baseDir, pkg)
+	baseDir := filepath.Dir(container.rootFile())
+	marks := landmarks(files, baseDir, pkg)
+	content, warnings, issues := p.extractContent(files, baseDir, pkg, book.Metadata.Title, marks)
+	book.Content = content
+	book.Warnings = append(book.Warnings, warnings...)
+	for _, issue := range issues {
+		book.AddIssue(issue.Part, issue.Err)
+	}
+	if p.SkipEmptyChapters {
+		var skipped []string
+		book.Content.Chapters, skipped = p.skipEmptyChapters(book.Content.Chapters, book.Metadata.Title, frontMatterPaths(marks))
+		book.Warnings = append(book.Warnings, skipped...)
+	}
+
+	var pageWarnings []string
+	book.PageList, pageWarnings = p.extractPageList(files, baseDir, pkg, book.Content.Chapters)
+	book.Warnings = append(book.Warnings, pageWarnings...)
+
+	if p.DetectLanguage {
+		book.DetectLanguage()
+	}
+
+	book.LogWarnings("epub")
+	return book, book.Err()
+}
+
+// maxFileSize returns the size limit for chapters and the cover
+func (p *Parser) maxFileSize() int64 {
+	if p.MaxFileSize > 0 {
+		return p.MaxFileSize
+	}
+	return DefaultMaxFileSize
+}
+
+// extractMetadata reads the metadata and the cover, returning a warning if
+// the cover's dimensions can't be read and an issue if the cover failed to
+// read
+func extractMetadata(pkg epubPackage, rootFilePath string, files fileOpener, maxFileSize int64) (parser.Metadata, string, *parser.Issue) {
+	metadata := metadataFromPackage(pkg)
+
+	// Extract cover image
+	baseDir := filepath.Dir(rootFilePath)
+	coverHref, coverMediaType := extractCoverHref(pkg, baseDir)
+	if coverHref != "" {
+		coverFile, err := files.findFile(coverHref)
+		if err == nil {
+			coverData, err := readFile(coverFile, maxFileSize)
+			if err == nil {
+				// Covers that aren't images (e.g., XHTML pages) are dropped
+				if coverType := parser.ImageType(coverData, coverMediaType); coverType != "" {
+					if err := metadata.SetCover(coverData, coverType); err != nil {
+						return metadata, err.Error(), nil
+					}
+				}
+			} else if !errors.Is(err, ErrFileTooLarge) {
+				return metadata, "", &parser.Issue{Part: coverHref, Err: fmt.Errorf("failed to read cover: %w", err)}
+			}
+		}
+	}
 
-	return book, nil
+	return metadata, "", nil
 }
 
-func extractMetadata(pkg epubPackage, rootFilePath string, zr *zip.Reader) parser.Metadata {
+// metadataFromPackage reads the OPF metadata fields, without the cover
+func metadataFromPackage(pkg epubPackage) parser.Metadata {
 	metadata := parser.Metadata{}
 
 	// Title
@@ -94,7 +223,7 @@ func extractMetadata(pkg epubPackage, rootFilePath string, zr *zip.Reader) parse
 	}
 
 	// Authors
-	metadata.Authors = parseAuthors(pkg.Metadata.Creators)
+	metadata.Authors = parseAuthors(pkg.Metadata.Creators, pkg.Metadata.Metas)
 
 	// Language
 	if len(pkg.Metadata.Languages) > 0 {
@@ -121,80 +250,129 @@ func extractMetadata(pkg epubPackage, rootFilePath string, zr *zip.Reader) parse
 		}
 	}
 
+	if metadata.Series != "" {
+		metadata.Sequences = []parser.Sequence{{Name: metadata.Series, Number: metadata.SeriesIndex}}
+	}
+
 	// Genres from subjects
 	metadata.Genres = pkg.Metadata.Subjects
 
-	// Extract cover image
-	baseDir := filepath.Dir(rootFilePath)
-	coverHref := extractCoverHref(pkg, baseDir)
-	if coverHref != "" {
-		coverFile, err := findFileInZip(zr, coverHref)
-		if err == nil {
-			rc, err := coverFile.Open()
-			if err == nil {
-				defer rc.Close()
-				coverData, err := io.ReadAll(rc)
-				if err == nil {
-					metadata.CoverData = coverData
-					if strings.HasSuffix(strings.ToLower(coverHref), ".png") {
-						metadata.CoverType = "image/png"
-					} else {
-						metadata.CoverType = "image/jpeg"
-					}
-				}
-			}
+	if len(pkg.Metadata.Publishers) > 0 {
+		metadata.Publisher = strings.TrimSpace(pkg.Metadata.Publishers[0])
+	}
+	for _, id := range pkg.Metadata.Identifiers {
+		if identifier, ok := packageIdentifier(id); ok {
+			metadata.Identifiers = append(metadata.Identifiers, identifier)
 		}
 	}
 
+	publicationDate, modifiedDate := packageDates(pkg.Metadata)
+	// Calibre writes year 101 for unknown dates
+	if year, err := strconv.Atoi(strings.SplitN(publicationDate, "-", 2)[0]); err == nil && year > 1000 {
+		metadata.PublicationDate = publicationDate
+		metadata.PublicationTime = parser.ParseDate(publicationDate)
+		metadata.PublicationYear = year
+	}
+	metadata.ModifiedDate = modifiedDate
+	metadata.ModifiedTime = parser.ParseDate(modifiedDate)
+
 	return metadata
 }
 
-func parseAuthors(creators []epubCreator) []parser.Author {
-	var authors []parser.Author
+// packageIdentifier reads a dc:identifier. The scheme is the EPUB 2
+// opf:scheme attribute or else a URN prefix, as in "urn:isbn:..."; Calibre
+// marks its uuid by the element id.
+func packageIdentifier(id epubIdentifier) (parser.Identifier, bool) {
+	value := strings.TrimSpace(id.Value)
+	if value == "" {
+		return parser.Identifier{}, false
+	}
+	scheme := strings.ToLower(id.Scheme)
+	if scheme == "" {
+		for _, urn := range []string{"isbn", "uuid"} {
+			if prefix := "urn:" + urn + ":"; len(value) > len(prefix) && strings.EqualFold(value[:len(prefix)], prefix) {
+				scheme, value = urn, value[len(prefix):]
+				break
+			}
+		}
+	}
+	if scheme == "" && id.ID == "uuid_id" {
+		scheme = "uuid"
+	}
+	return parser.Identifier{Scheme: scheme, Value: value}, true
+}
 
-	for _, creator := range creators {
-		// Skip if not an author (role might be editor, illustrator, etc.)
-		if creator.Role != "" && creator.Role != "aut" {
+// packageDates returns the publication date, from the dc:date with the
+// publication event or else the first without one, and the modification
+// date, from the EPUB 3 dcterms:modified meta or else the dc:date with the
+// modification event
+func packageDates(m epubMetadata) (publication, modified string) {
+	var unqualified, modificationEvent string
+	for _, date := range m.Dates {
+		value := strings.TrimSpace(date.Value)
+		if value == "" {
 			continue
 		}
+		switch strings.ToLower(strings.TrimSpace(date.Event)) {
+		case "publication":
+			if publication == "" {
+				publication = value
+			}
+		case "modification":
+			if modificationEvent == "" {
+				modificationEvent = value
+			}
+		case "":
+			if unqualified == "" {
+				unqualified = value
+			}
+		}
+	}
+	if publication == "" {
+		publication = unqualified
+	}
 
-		name := strings.TrimSpace(creator.Name)
-		if name == "" {
-			continue
+	for _, meta := range m.Metas {
+		if meta.Property == "dcterms:modified" && strings.TrimSpace(meta.Refines) == "" {
+			if modified = strings.TrimSpace(meta.Value); modified != "" {
+				return publication, modified
+			}
 		}
+	}
+	return publication, modificationEvent
+}
+
+func parseAuthors(creators []epubCreator, metas []epubMeta) []parser.Author {
+	var authors []parser.Author
 
-		author := parser.Author{}
-
-		// Try to parse "LastName, FirstName" format
-		if strings.Contains(name, ",") {
-			parts := strings.SplitN(name, ",", 2)
-			author.LastName = strings.TrimSpace(parts[0])
-			if len(parts) > 1 {
-				// FirstName might contain middle name
-				nameParts := strings.Fields(strings.TrimSpace(parts[1]))
-				if len(nameParts) > 0 {
-					author.FirstName = nameParts[0]
+	for _, creator := range creators {
+		// EPUB 3 gives the role and sort form in metas refining the creator
+		role, fileAs := strings.TrimSpace(creator.Role), strings.TrimSpace(creator.FileAs)
+		if id := strings.TrimSpace(creator.ID); id != "" {
+			for _, meta := range metas {
+				if strings.TrimPrefix(strings.TrimSpace(meta.Refines), "#") != id {
+					continue
 				}
-				if len(nameParts) > 1 {
-					author.MiddleName = strings.Join(nameParts[1:], " ")
+				switch meta.Property {
+				case "role":
+					if role == "" {
+						role = strings.TrimSpace(meta.Value)
+					}
+				case "file-as":
+					if fileAs == "" {
+						fileAs = strings.TrimSpace(meta.Value)
+					}
 				}
 			}
-		} else {
-			// Try to parse "FirstName LastName" format
-			nameParts := strings.Fields(name)
-			if len(nameParts) == 1 {
-				author.LastName = nameParts[0]
-			} else if len(nameParts) == 2 {
-				author.FirstName = nameParts[0]
-				author.LastName = nameParts[1]
-			} else if len(nameParts) > 2 {
-				author.FirstName = nameParts[0]
-				author.MiddleName = strings.Join(nameParts[1:len(nameParts)-1], " ")
-				author.LastName = nameParts[len(nameParts)-1]
-			}
 		}
 
-		if !author.IsEmpty() {
+		// Skip if not an author (role might be editor, illustrator, etc.)
+		if role != "" && role != "aut" {
+			continue
+		}
+
+		author := parser.ParseAuthor(creator.Name, fileAs)
+		if strings.TrimSpace(creator.Name) != "" && !author.IsEmpty() {
 			authors = append(authors, author)
 		}
 	}
@@ -202,96 +380,178 @@ func parseAuthors(creators []epubCreator) []parser.Author {
 	return authors
 }
 
-func extractCoverHref(pkg epubPackage, baseDir string) string {
-	// Look for items that might be cover images
+// extractCoverHref returns the path and manifest media-type of the cover image
+func extractCoverHref(pkg epubPackage, baseDir string) (string, string) {
+	// Look for items that might be cover images. The media-type only has to
+	// say image, as the data is sniffed for the real type.
 	for _, item := range pkg.Manifest.Items {
 		id := strings.ToLower(item.ID)
 		href := strings.ToLower(item.Href)
 		if (strings.Contains(id, "cover") || strings.Contains(href, "cover")) &&
-			(item.MediaType == "image/jpeg" || item.MediaType == "image/png" ||
-				item.MediaType == "image/jpg") {
-			return filepath.Join(baseDir, item.Href)
+			strings.HasPrefix(strings.ToLower(item.MediaType), "image/") {
+			if log := parser.Logger(); log != nil {
+				log.Debug("EPUB cover found by manifest name", "id", item.ID, "href", item.Href)
+			}
+			return normalizeEPUBPath(baseDir, item.Href), item.MediaType
 		}
 	}
 
-	return ""
+	return "", ""
 }
 
-func findFileInZip(zr *zip.Reader, name string) (*zip.File, error) {
-	for _, f := range zr.File {
-		if f.Name == name {
-			return f, nil
-		}
+// rawMetadata returns the OPF package document as raw metadata, nil if it
+// can't be read
+func rawMetadata(packageFile bookFile, rootFile string) *parser.RawMetadata {
+	data, err := readFile(packageFile, DefaultMaxFileSize)
+	if err != nil {
+		return nil
 	}
-	return nil, fmt.Errorf("file not found: %s", name)
+	return &parser.RawMetadata{Format: "epub", Data: data, RootFile: rootFile}
 }
 
-func parseXMLFromZipFile(f *zip.File, v interface{}) error {
-	rc, err := f.Open()
+// parseXMLFromFile decodes an XML file of the container, such as the OPF,
+// in UTF-8, UTF-16 or a legacy encoding, with or without a BOM
+func parseXMLFromFile(f bookFile, v interface{}) error {
+	data, err := readXMLFile(f)
 	if err != nil {
 		return err
 	}
-	defer rc.Close()
+	return unmarshalUTF8(data, v)
+}
+
+// unmarshalUTF8 decodes XML already converted to UTF-8, ignoring the charset
+// its prolog still declares
+func unmarshalUTF8(data []byte, v interface{}) error {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.CharsetReader = func(label string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+	return decoder.Decode(v)
+}
 
-	data, err := io.ReadAll(rc)
+// readContentFile reads a content document converted to UTF-8 as
+// readXMLFile does, up to limit bytes
+func readContentFile(f bookFile, limit int64) ([]byte, error) {
+	data, err := readFile(f, limit)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	return charset.DecodeXML(data)
+}
 
-	return xml.Unmarshal(data, v)
+// readXMLFile reads an XML file of the container converted to UTF-8
+func readXMLFile(f bookFile) ([]byte, error) {
+	return readContentFile(f, DefaultMaxFileSize)
 }
 
 // XML structures for EPUB parsing
 
 type epubContainer struct {
-	XMLName  xml.Name `xml:"container"`
-	RootFile struct {
-		FullPath string `xml:"full-path,attr"`
+	XMLName   xml.Name `xml:"container"`
+	RootFiles []struct {
+		FullPath  string `xml:"full-path,attr"`
+		MediaType string `xml:"media-type,attr"`
 	} `xml:"rootfiles>rootfile"`
 }
 
+// rootFile returns the path of the package document of the default
+// rendition: the first rootfile that is a package document, or the first
+// rootfile if none says what it is
+func (c epubContainer) rootFile() string {
+	for _, rf := range c.RootFiles {
+		if strings.TrimSpace(rf.MediaType) == "application/oebps-package+xml" {
+			return rf.FullPath
+		}
+	}
+	if len(c.RootFiles) > 0 && c.RootFiles[0].MediaType == "" {
+		return c.RootFiles[0].FullPath
+	}
+	return ""
+}
+
 type epubPackage struct {
 	XMLName  xml.Name     `xml:"package"`
+	Version  string       `xml:"version,attr"`
 	Metadata epubMetadata `xml:"metadata"`
 	Manifest struct {
 		Items []epubManifestItem `xml:"item"`
 	} `xml:"manifest"`
 	Spine struct {
-		TOC      string `xml:"toc,attr"`
-		ItemRefs []struct {
-			IDRef string `xml:"idref,attr"`
-		} `xml:"itemref"`
+		TOC                      string        `xml:"toc,attr"`
+		PageProgressionDirection string        `xml:"page-progression-direction,attr"`
+		ItemRefs                 []epubItemRef `xml:"itemref"`
 	} `xml:"spine"`
+	Guide struct {
+		References []epubReference `xml:"reference"`
+	} `xml:"guide"`
+}
+
+type epubReference struct {
+	Type  string `xml:"type,attr"`
+	Title string `xml:"title,attr"`
+	Href  string `xml:"href,attr"`
 }
 
 type epubMetadata struct {
-	Titles      []string      `xml:"title"`
-	Creators    []epubCreator `xml:"creator"`
-	Languages   []string      `xml:"language"`
-	Subjects    []string      `xml:"subject"`
-	Description string        `xml:"description"`
-	Metas       []epubMeta    `xml:"meta"`
+	Titles      []string         `xml:"title"`
+	Creators    []epubCreator    `xml:"creator"`
+	Languages   []string         `xml:"language"`
+	Subjects    []string         `xml:"subject"`
+	Description string           `xml:"description"`
+	Publishers  []string         `xml:"publisher"`
+	Dates       []epubDate       `xml:"date"`
+	Identifiers []epubIdentifier `xml:"identifier"`
+	Metas       []epubMeta       `xml:"meta"`
+}
+
+type epubIdentifier struct {
+	ID     string `xml:"id,attr"`
+	Scheme string `xml:"scheme,attr"`
+	Value  string `xml:",chardata"`
+}
+
+// epubDate is a dc:date, which EPUB 2 qualifies with an opf:event such as
+// "publication" or "modification"
+type epubDate struct {
+	Event string `xml:"event,attr"`
+	Value string `xml:",chardata"`
 }
 
 type epubCreator struct {
+	ID     string `xml:"id,attr"`
 	Name   string `xml:",chardata"`
 	FileAs string `xml:"file-as,attr"`
 	Role   string `xml:"role,attr"`
 }
 
+// epubMeta is an EPUB 2 name/content meta or an EPUB 3 property meta, which
+// may refine another element by id
 type epubMeta struct {
-	Name    string `xml:"name,attr"`
-	Content string `xml:"content,attr"`
+	Name     string `xml:"name,attr"`
+	Content  string `xml:"content,attr"`
+	Property string `xml:"property,attr"`
+	Refines  string `xml:"refines,attr"`
+	Value    string `xml:",chardata"`
 }
 
 type epubManifestItem struct {
-	ID        string `xml:"id,attr"`
-	Href      string `xml:"href,attr"`
-	MediaType string `xml:"media-type,attr"`
+	ID         string `xml:"id,attr"`
+	Href       string `xml:"href,attr"`
+	MediaType  string `xml:"media-type,attr"`
+	Properties string `xml:"properties,attr"`
+	Fallback   string `xml:"fallback,attr"`
+}
+
+type epubItemRef struct {
+	IDRef      string `xml:"idref,attr"`
+	Linear     string `xml:"linear,attr"`
+	Properties string `xml:"properties,attr"`
 }
 
 type epubTOCEntry struct {
 	Title  string
 	Path   string
 	Anchor string
+	Role   string // From the epub:type of the link or its list item
+	Level  int    // Nesting depth in the TOC, 0 for top-level entries
 }
@@ -0,0 +1,146 @@
+package epub
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+
+	"github.com/vpoluyaktov/biblio-ebook-parser/internal/zipindex"
+)
+
+// DefaultMaxFileSize is the largest file read from an EPUB container when
+// Parser.MaxFileSize is zero, and the limit used by the fast extractors
+const DefaultMaxFileSize = 256 << 20
+
+// ErrFileTooLarge is returned for a file in the container larger than the
+// size limit. Chapters that large are skipped with a warning instead.
+var ErrFileTooLarge = errors.New("file exceeds the size limit")
+
+// fileOpener looks up files in an EPUB container by their path, so the same
+// extraction code reads zipped and exploded books
+type fileOpener interface {
+	findFile(name string) (bookFile, error)
+}
+
+// bookFile is a file in an EPUB container
+type bookFile interface {
+	Open() (io.ReadCloser, error)
+}
+
+// zipFiles reads an EPUB from its zip archive. Names are matched in Unicode
+// NFC, and entries with unsafe or duplicate names are left out.
+type zipFiles struct {
+	index *zipindex.Index
+}
+
+func newZipFiles(zr *zip.Reader) zipFiles {
+	return zipFiles{index: zipindex.New(zr)}
+}
+
+func (z zipFiles) findFile(name string) (bookFile, error) {
+	if f, ok := z.index.Find(name); ok {
+		return f, nil
+	}
+	return nil, fmt.Errorf("file not found: %s", name)
+}
+
+// fsFiles reads an exploded EPUB from a file system, such as a directory
+type fsFiles struct {
+	fsys fs.FS
+}
+
+func (d fsFiles) findFile(name string) (bookFile, error) {
+	name = path.Clean(name)
+	if !fs.ValidPath(name) {
+		return nil, fmt.Errorf("file not found: %s", name)
+	}
+	info, err := fs.Stat(d.fsys, name)
+	if err != nil || info.IsDir() {
+		return nil, fmt.Errorf("file not found: %s", name)
+	}
+	return fsFile{fsys: d.fsys, name: name}, nil
+}
+
+type fsFile struct {
+	fsys fs.FS
+	name string
+}
+
+func (f fsFile) Open() (io.ReadCloser, error) {
+	return f.fsys.Open(f.name)
+}
+
+// readFile reads a whole file of the container. Files declaring a size over
+// limit are rejected before anything is allocated, and the limit also holds
+// while reading, as a zip entry may declare the wrong size.
+func readFile(f bookFile, limit int64) ([]byte, error) {
+	size, known := fileSize(f)
+	if known && size > limit {
+		return nil, fmt.Errorf("declared size %d: %w", size, ErrFileTooLarge)
+	}
+
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	var buf bytes.Buffer
+	if known {
+		buf.Grow(int(size))
+	}
+	n, err := buf.ReadFrom(io.LimitReader(rc, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if n > limit {
+		return nil, fmt.Errorf("over %d bytes: %w", limit, ErrFileTooLarge)
+	}
+	return buf.Bytes(), nil
+}
+
+// fileSize returns the size a file declares, from the zip directory or the
+// file system, without reading it
+func fileSize(f bookFile) (int64, bool) {
+	switch f := f.(type) {
+	case *zip.File:
+		if f.UncompressedSize64 > 1<<62 {
+			return 1 << 62, true
+		}
+		return int64(f.UncompressedSize64), true
+	case fsFile:
+		if info, err := fs.Stat(f.fsys, f.name); err == nil {
+			return info.Size(), true
+		}
+	}
+	return 0, false
+}
+
+// IsDir reports whether path is an exploded EPUB: a directory holding
+// META-INF/container.xml
+func IsDir(dir string) bool {
+	info, err := os.Stat(dir)
+	if err != nil || !info.IsDir() {
+		return false
+	}
+	_, err = fs.Stat(os.DirFS(dir), "META-INF/container.xml")
+	return err == nil
+}
+
+// openFiles opens an EPUB file or exploded EPUB directory
+func openFiles(filePath string) (fileOpener, io.Closer, error) {
+	if info, err := os.Stat(filePath); err == nil && info.IsDir() {
+		return fsFiles{fsys: os.DirFS(filePath)}, io.NopCloser(nil), nil
+	}
+
+	r, err := zip.OpenReader(filePath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open EPUB: %w", err)
+	}
+	return newZipFiles(&r.Reader), r, nil
+}
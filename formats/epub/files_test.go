@@ -0,0 +1,350 @@
+package epub_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/vpoluyaktov/biblio-ebook-parser/formats/epub"
+	"github.com/vpoluyaktov/biblio-ebook-parser/parser"
+	"github.com/vpoluyaktov/biblio-ebook-parser/testutil/epubtest"
+)
+
+// zip64Entry is a stored file of a Zip64 archive
+type zip64Entry struct {
+	name string
+	data []byte
+	size uint64 // Declared uncompressed size, len(data) if zero
+}
+
+// zip64Archive writes entries the way archivers write files over 4 GB: every
+// size and offset is in a Zip64 extra field, and the directory ends with a
+// Zip64 end record. It returns the archive and the byte range of each entry,
+// header and data.
+func zip64Archive(entries []zip64Entry) ([]byte, [][2]int) {
+	le := binary.LittleEndian
+	var out, dir []byte
+	var spans [][2]int
+	for _, e := range entries {
+		size := e.size
+		if size == 0 {
+			size = uint64(len(e.data))
+		}
+		crc := crc32.ChecksumIEEE(e.data)
+		offset := uint64(len(out))
+
+		// Local header
+		out = le.AppendUint32(out, 0x04034b50)
+		out = le.AppendUint16(out, 45)
+		out = le.AppendUint16(out, 0x800)
+		out = le.AppendUint16(out, zip.Store)
+		out = le.AppendUint32(out, 0x00210000)
+		out = le.AppendUint32(out, crc)
+		out = le.AppendUint32(out, 0xFFFFFFFF)
+		out = le.AppendUint32(out, 0xFFFFFFFF)
+		out = le.AppendUint16(out, uint16(len(e.name)))
+		out = le.AppendUint16(out, 20)
+		out = append(out, e.name...)
+		out = le.AppendUint16(out, 0x0001)
+		out = le.AppendUint16(out, 16)
+		out = le.AppendUint64(out, size)
+		out = le.AppendUint64(out, uint64(len(e.data)))
+		out = append(out, e.data...)
+		spans = append(spans, [2]int{int(offset), len(out)})
+
+		// Central directory header
+		dir = le.AppendUint32(dir, 0x02014b50)
+		dir = le.AppendUint16(dir, 45)
+		dir = le.AppendUint16(dir, 45)
+		dir = le.AppendUint16(dir, 0x800)
+		dir = le.AppendUint16(dir, zip.Store)
+		dir = le.AppendUint32(dir, 0x00210000)
+		dir = le.AppendUint32(dir, crc)
+		dir = le.AppendUint32(dir, 0xFFFFFFFF)
+		dir = le.AppendUint32(dir, 0xFFFFFFFF)
+		dir = le.AppendUint16(dir, uint16(len(e.name)))
+		dir = le.AppendUint16(dir, 28)
+		dir = le.AppendUint16(dir, 0)
+		dir = le.AppendUint16(dir, 0)
+		dir = le.AppendUint16(dir, 0)
+		dir = le.AppendUint32(dir, 0)
+		dir = le.AppendUint32(dir, 0xFFFFFFFF)
+		dir = append(dir, e.name...)
+		dir = le.AppendUint16(dir, 0x0001)
+		dir = le.AppendUint16(dir, 24)
+		dir = le.AppendUint64(dir, size)
+		dir = le.AppendUint64(dir, uint64(len(e.data)))
+		dir = le.AppendUint64(dir, offset)
+	}
+
+	dirOffset := uint64(len(out))
+	out = append(out, dir...)
+	end64 := uint64(len(out))
+
+	// Zip64 end of central directory record and its locator
+	out = le.AppendUint32(out, 0x06064b50)
+	out = le.AppendUint64(out, 44)
+	out = le.AppendUint16(out, 45)
+	out = le.AppendUint16(out, 45)
+	out = le.AppendUint32(out, 0)
+	out = le.AppendUint32(out, 0)
+	out = le.AppendUint64(out, uint64(len(entries)))
+	out = le.AppendUint64(out, uint64(len(entries)))
+	out = le.AppendUint64(out, uint64(len(dir)))
+	out = le.AppendUint64(out, dirOffset)
+	out = le.AppendUint32(out, 0x07064b50)
+	out = le.AppendUint32(out, 0)
+	out = le.AppendUint64(out, end64)
+	out = le.AppendUint32(out, 1)
+
+	// End of central directory record, deferring to the Zip64 one
+	out = le.AppendUint32(out, 0x06054b50)
+	out = le.AppendUint16(out, 0)
+	out = le.AppendUint16(out, 0)
+	out = le.AppendUint16(out, 0xFFFF)
+	out = le.AppendUint16(out, 0xFFFF)
+	out = le.AppendUint32(out, 0xFFFFFFFF)
+	out = le.AppendUint32(out, 0xFFFFFFFF)
+	out = le.AppendUint16(out, 0)
+	return out, spans
+}
+
+// unzip returns the files of an archive in order
+func unzip(t *testing.T, data []byte) []zip64Entry {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entries []zip64Entry
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, zip64Entry{name: f.Name, data: content})
+	}
+	return entries
+}
+
+// declare sets the declared size of an entry
+func declare(entries []zip64Entry, name string, size uint64) {
+	for i := range entries {
+		if entries[i].name == name {
+			entries[i].size = size
+		}
+	}
+}
+
+func fixtureBook() *epubtest.Builder {
+	return epubtest.New().
+		WithTitle("Big Book").
+		WithAuthor("Jane Doe").
+		WithChapter("One", "<p>The first chapter.</p>").
+		WithChapter("Two", "<p>The second chapter.</p>").
+		WithCover([]byte(pngHeader))
+}
+
+func TestZip64Archive(t *testing.T) {
+	plain := fixtureBook().Bytes()
+	data, _ := zip64Archive(unzip(t, plain))
+
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("the fixture is not a valid zip: %v", err)
+	}
+	if !bytes.Contains(data, []byte{0x50, 0x4b, 0x06, 0x06}) || zr.File[0].CompressedSize != 0xFFFFFFFF {
+		t.Fatal("the fixture is not a Zip64 archive")
+	}
+
+	want, err := epub.NewParser().ParseReader(bytes.NewReader(plain), int64(len(plain)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := epub.NewParser().ParseReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("ParseReader: %v", err)
+	}
+	if bookText(got) != bookText(want) || len(got.Content.Chapters) != len(want.Content.Chapters) {
+		t.Errorf("text of the Zip64 archive:\n%s\nwant:\n%s", bookText(got), bookText(want))
+	}
+	if got.Metadata.Title != "Big Book" || !bytes.Equal(got.Metadata.CoverData, []byte(pngHeader)) {
+		t.Errorf("metadata = %q, %d cover bytes", got.Metadata.Title, len(got.Metadata.CoverData))
+	}
+
+	if m, err := epub.ExtractMetadataOnlyReader(bytes.NewReader(data), int64(len(data))); err != nil || m.Title != "Big Book" {
+		t.Errorf("ExtractMetadataOnlyReader = %q, %v", m.Title, err)
+	}
+	if cover, _, err := epub.ExtractCoverOnlyReader(bytes.NewReader(data), int64(len(data))); err != nil || !bytes.Equal(cover, []byte(pngHeader)) {
+		t.Errorf("ExtractCoverOnlyReader = %d bytes, %v", len(cover), err)
+	}
+}
+
+// heapGrowth returns how much memory f allocates, in bytes
+func heapGrowth(f func()) uint64 {
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	f()
+	runtime.ReadMemStats(&after)
+	return after.TotalAlloc - before.TotalAlloc
+}
+
+func TestAbsurdDeclaredSize(t *testing.T) {
+	const absurd = 1 << 40
+	entries := unzip(t, fixtureBook().Bytes())
+	declare(entries, "OEBPS/chapter2.xhtml", absurd)
+	declare(entries, "OEBPS/images/cover.png", absurd)
+	data, _ := zip64Archive(entries)
+
+	// The chapter and cover are left out without reading them, so nothing
+	// near their declared size is allocated
+	var book *parser.Book
+	var err error
+	growth := heapGrowth(func() {
+		book, err = epub.NewParser().ParseReader(bytes.NewReader(data), int64(len(data)))
+	})
+	if err != nil {
+		t.Fatalf("ParseReader: %v", err)
+	}
+	if growth > 16<<20 {
+		t.Errorf("parsing allocated %d MB", growth>>20)
+	}
+	if chapters := book.Content.Chapters; len(chapters) != 1 || chapters[0].Title != "One" {
+		t.Errorf("%d chapters, want only the first", len(chapters))
+	}
+	if book.Metadata.CoverData != nil {
+		t.Errorf("cover of %d bytes was read", len(book.Metadata.CoverData))
+	}
+	if !strings.Contains(strings.Join(book.Warnings, "\n"), "chapter2.xhtml skipped") {
+		t.Errorf("warnings = %q", book.Warnings)
+	}
+
+	// The fast extractors report the cover as too large
+	if _, _, err := epub.ExtractCoverOnlyReader(bytes.NewReader(data), int64(len(data))); !errors.Is(err, epub.ErrFileTooLarge) {
+		t.Errorf("ExtractCoverOnlyReader error = %v, want ErrFileTooLarge", err)
+	}
+
+	// And so is a package document that large, which the book cannot do without
+	entries = unzip(t, fixtureBook().Bytes())
+	declare(entries, "OEBPS/content.opf", absurd)
+	data, _ = zip64Archive(entries)
+	if _, err := epub.NewParser().ParseReader(bytes.NewReader(data), int64(len(data))); !errors.Is(err, epub.ErrFileTooLarge) {
+		t.Errorf("ParseReader with a huge package document: error %v, want ErrFileTooLarge", err)
+	}
+}
+
+func TestMaxFileSize(t *testing.T) {
+	long := "<p>" + strings.Repeat("Many words in a long chapter. ", 4000) + "</p>"
+	data := epubtest.New().
+		WithChapter("Short", "<p>A short chapter.</p>").
+		WithChapter("Long", long).
+		Bytes()
+
+	p := epub.NewParser()
+	p.MaxFileSize = 64 << 10
+	book, err := p.ParseReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("ParseReader: %v", err)
+	}
+	if len(book.Content.Chapters) != 1 || book.Content.Chapters[0].Title != "Short" {
+		t.Errorf("%d chapters, want only the short one", len(book.Content.Chapters))
+	}
+
+	p.MaxFileSize = 0
+	if book, err := p.ParseReader(bytes.NewReader(data), int64(len(data))); err != nil || len(book.Content.Chapters) != 2 {
+		t.Errorf("with the default limit: %v", err)
+	}
+}
+
+// readLog is an io.ReaderAt recording the ranges read
+type readLog struct {
+	r     io.ReaderAt
+	mu    sync.Mutex
+	reads [][2]int
+}
+
+func (l *readLog) ReadAt(p []byte, off int64) (int, error) {
+	n, err := l.r.ReadAt(p, off)
+	l.mu.Lock()
+	l.reads = append(l.reads, [2]int{int(off), int(off) + n})
+	l.mu.Unlock()
+	return n, err
+}
+
+// touches reports whether any read overlaps span
+func (l *readLog) touches(span [2]int) bool {
+	for _, r := range l.reads {
+		if r[0] < span[1] && span[0] < r[1] {
+			return true
+		}
+	}
+	return false
+}
+
+func TestFastPathsSkipChapters(t *testing.T) {
+	// Large chapters first, so that the end of the archive, which the zip
+	// reader scans for the directory, holds only the small files
+	big := func(text string) string {
+		return "<p>" + strings.Repeat(text+" ", 20000) + "</p>"
+	}
+	entries := unzip(t, fixtureBook().
+		WithChapter("Three", big("third")).
+		WithChapter("Four", big("fourth")).
+		Bytes())
+	var ordered, rest []zip64Entry
+	for _, e := range entries {
+		if e.name == "mimetype" || strings.Contains(e.name, "chapter") {
+			ordered = append(ordered, e)
+		} else {
+			rest = append(rest, e)
+		}
+	}
+	data, spans := zip64Archive(append(ordered, rest...))
+	chapter1 := spans[1]
+	if ordered[1].name != "OEBPS/chapter1.xhtml" {
+		t.Fatalf("entry 1 is %s", ordered[1].name)
+	}
+
+	extractors := map[string]func(io.ReaderAt, int64) error{
+		"metadata": func(r io.ReaderAt, size int64) error {
+			_, err := epub.ExtractMetadataOnlyReader(r, size)
+			return err
+		},
+		"cover": func(r io.ReaderAt, size int64) error {
+			_, _, err := epub.ExtractCoverOnlyReader(r, size)
+			return err
+		},
+		"annotation": func(r io.ReaderAt, size int64) error {
+			_, err := epub.ExtractAnnotationOnlyReader(r, size)
+			return err
+		},
+	}
+	for name, extract := range extractors {
+		log := &readLog{r: bytes.NewReader(data)}
+		if err := extract(log, int64(len(data))); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+		if log.touches(chapter1) {
+			t.Errorf("%s extraction read the first chapter", name)
+		}
+	}
+
+	// The full parse does read it, which shows the log works
+	log := &readLog{r: bytes.NewReader(data)}
+	if _, err := epub.NewParser().ParseReader(log, int64(len(data))); err != nil || !log.touches(chapter1) {
+		t.Errorf("ParseReader: %v, read the first chapter %v", err, log.touches(chapter1))
+	}
+}
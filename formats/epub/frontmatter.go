@@ -0,0 +1,64 @@
+package epub
+
+import (
+	"fmt"
+
+	"github.com/vpoluyaktov/biblio-ebook-parser/parser"
+)
+
+// DefaultMinChapterChars is the text a chapter needs, besides its title, to
+// be kept when SkipEmptyChapters is set and MinChapterChars is zero
+const DefaultMinChapterChars = 20
+
+// frontMatterRoles are the roles of pages skipped even with a little text
+var frontMatterRoles = map[string]bool{
+	"cover":     true,
+	"titlepage": true,
+}
+
+// frontMatterPaths returns the files the OPF guide or the EPUB 3 landmarks
+// mark as the cover or title page
+func frontMatterPaths(marks []landmark) map[string]bool {
+	paths := make(map[string]bool)
+	for _, mark := range marks {
+		if frontMatterRoles[mark.Role] {
+			paths[mark.Path] = true
+		}
+	}
+	return paths
+}
+
+// skipEmptyChapters drops chapters with less than MinChapterChars of text
+// besides their title, and cover and title pages without a paragraph that
+// long. Chapters with such a paragraph are always kept. Returns a warning for
+// each chapter dropped.
+func (p *Parser) skipEmptyChapters(chapters []parser.Chapter, bookTitle string, frontMatter map[string]bool) ([]parser.Chapter, []string) {
+	minChars := p.MinChapterChars
+	if minChars <= 0 {
+		minChars = DefaultMinChapterChars
+	}
+
+	var warnings []string
+	kept := chapters[:0]
+	for _, ch := range chapters {
+		chars, hasParagraph := 0, false
+		for _, elem := range ch.BodyElements(bookTitle) {
+			chars += elem.CharCount()
+			if paragraph, ok := elem.(*parser.Paragraph); ok && paragraph.CharCount() >= minChars {
+				hasParagraph = true
+			}
+		}
+
+		switch {
+		case hasParagraph:
+			kept = append(kept, ch)
+		case frontMatter[ch.SourcePath]:
+			warnings = append(warnings, fmt.Sprintf("chapter %q skipped: front matter (%s)", ch.Title, ch.SourcePath))
+		case chars < minChars:
+			warnings = append(warnings, fmt.Sprintf("chapter %q skipped: %d characters of text", ch.Title, chars))
+		default:
+			kept = append(kept, ch)
+		}
+	}
+	return kept, warnings
+}
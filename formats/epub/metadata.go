@@ -14,13 +14,13 @@ import (
 // ExtractCoverOnly extracts only the cover image from an EPUB file without parsing the full content.
 // This is much faster than Parse() when you only need the cover.
 func ExtractCoverOnly(filePath string) ([]byte, string, error) {
-	r, err := zip.OpenReader(filePath)
+	files, closer, err := openFiles(filePath)
 	if err != nil {
-		return nil, "", fmt.Errorf("failed to open EPUB: %w", err)
+		return nil, "", err
 	}
-	defer r.Close()
+	defer closer.Close()
 
-	return extractCoverFromZip(&r.Reader)
+	return extractCover(files)
 }
 
 // ExtractCoverOnlyReader extracts only the cover image from an EPUB reader without parsing the full content.
@@ -30,18 +30,18 @@ func ExtractCoverOnlyReader(r io.ReaderAt, size int64) ([]byte, string, error) {
 		return nil, "", fmt.Errorf("failed to open EPUB as zip: %w", err)
 	}
 
-	return extractCoverFromZip(zipReader)
+	return extractCover(newZipFiles(zipReader))
 }
 
 // ExtractAnnotationOnly extracts only the description/annotation from an EPUB file without parsing the full content.
 func ExtractAnnotationOnly(filePath string) (string, error) {
-	r, err := zip.OpenReader(filePath)
+	files, closer, err := openFiles(filePath)
 	if err != nil {
-		return "", fmt.Errorf("failed to open EPUB: %w", err)
+		return "", err
 	}
-	defer r.Close()
+	defer closer.Close()
 
-	return extractAnnotationFromZip(&r.Reader)
+	return extractAnnotation(files)
 }
 
 // ExtractAnnotationOnlyReader extracts only the description/annotation from an EPUB reader without parsing the full content.
@@ -51,83 +51,77 @@ func ExtractAnnotationOnlyReader(r io.ReaderAt, size int64) (string, error) {
 		return "", fmt.Errorf("failed to open EPUB as zip: %w", err)
 	}
 
-	return extractAnnotationFromZip(zipReader)
+	return extractAnnotation(newZipFiles(zipReader))
 }
 
-func extractCoverFromZip(zr *zip.Reader) ([]byte, string, error) {
+func extractCover(files fileOpener) ([]byte, string, error) {
 	// Find and parse container.xml
-	containerFile, err := findFileInZip(zr, "META-INF/container.xml")
+	containerFile, err := files.findFile("META-INF/container.xml")
 	if err != nil {
 		return nil, "", fmt.Errorf("container.xml not found: %w", err)
 	}
 
 	var container epubContainer
-	if err := parseXMLFromZipFile(containerFile, &container); err != nil {
+	if err := parseXMLFromFile(containerFile, &container); err != nil {
 		return nil, "", fmt.Errorf("failed to parse container.xml: %w", err)
 	}
 
 	// Find and parse the package file (content.opf)
-	packageFile, err := findFileInZip(zr, container.RootFile.FullPath)
+	packageFile, err := files.findFile(container.rootFile())
 	if err != nil {
 		return nil, "", fmt.Errorf("package file not found: %w", err)
 	}
 
 	var pkg epubPackage
-	if err := parseXMLFromZipFile(packageFile, &pkg); err != nil {
+	if err := parseXMLFromFile(packageFile, &pkg); err != nil {
 		return nil, "", fmt.Errorf("failed to parse package file: %w", err)
 	}
 
 	// Extract cover image
-	baseDir := filepath.Dir(container.RootFile.FullPath)
-	coverHref := extractCoverHref(pkg, baseDir)
+	baseDir := filepath.Dir(container.rootFile())
+	coverHref, coverMediaType := extractCoverHref(pkg, baseDir)
 	if coverHref == "" {
 		return nil, "", nil
 	}
 
-	coverFile, err := findFileInZip(zr, coverHref)
+	coverFile, err := files.findFile(coverHref)
 	if err != nil {
 		return nil, "", nil
 	}
 
-	rc, err := coverFile.Open()
-	if err != nil {
-		return nil, "", err
-	}
-	defer rc.Close()
-
-	coverData, err := io.ReadAll(rc)
+	coverData, err := readFile(coverFile, DefaultMaxFileSize)
 	if err != nil {
-		return nil, "", err
+		return nil, "", fmt.Errorf("failed to read cover %s: %w", coverHref, err)
 	}
 
-	coverType := "image/jpeg"
-	if strings.HasSuffix(strings.ToLower(coverHref), ".png") {
-		coverType = "image/png"
+	coverType := parser.ImageType(coverData, coverMediaType)
+	if coverType == "" {
+		return nil, "", fmt.Errorf("cover %s: %w", coverHref, parser.ErrNoCover)
 	}
 
 	return coverData, coverType, nil
 }
 
-func extractAnnotationFromZip(zr *zip.Reader) (string, error) {
+func extractAnnotation(files fileOpener) (string, error) {
 	// Find and parse container.xml
-	containerFile, err := findFileInZip(zr, "META-INF/container.xml")
+	containerFile, err := files.findFile("META-INF/container.xml")
 	if err != nil {
 		return "", fmt.Errorf("container.xml not found: %w", err)
 	}
 
 	var container epubContainer
-	if err := parseXMLFromZipFile(containerFile, &container); err != nil {
+	if err := parseXMLFromFile(containerFile, &container); err != nil {
 		return "", fmt.Errorf("failed to parse container.xml: %w", err)
 	}
 
 	// Find and parse the package file (content.opf)
-	packageFile, err := findFileInZip(zr, container.RootFile.FullPath)
+	packageFile, err := files.findFile(container.rootFile())
 	if err != nil {
 		return "", fmt.Errorf("package file not found: %w", err)
 	}
 
 	var pkg epubPackage
-	if err := parseXMLFromZipFile(packageFile, &pkg); err != nil {
+	if err := parseXMLFromFile(packageFile, &pkg); err != nil {
 		return "", fmt.Errorf("failed to parse package file: %w", err)
 	}
 
@@ -142,6 +136,19 @@ func extractAnnotationFromZip(zr *zip.Reader) (string, error) {
 
 // ExtractMetadataOnly extracts only metadata from an EPUB file without parsing the full content.
 func ExtractMetadataOnly(filePath string) (parser.Metadata, error) {
+	return extractMetadataOnly(filePath, false)
+}
+
+// ExtractMetadataOnlyReader extracts only metadata from an EPUB reader without parsing the full content.
+func ExtractMetadataOnlyReader(r io.ReaderAt, size int64) (parser.Metadata, error) {
+	return extractMetadataOnlyReader(r, size, false)
+}
+
+func extractMetadataOnly(filePath string, keepRaw bool) (parser.Metadata, error) {
+	if IsDir(filePath) {
+		return extractMetadataFromFiles(fsFiles{fsys: os.DirFS(filePath)}, keepRaw)
+	}
+
 	f, err := os.Open(filePath)
 	if err != nil {
 		return parser.Metadata{}, fmt.Errorf("failed to open file: %w", err)
@@ -153,37 +160,44 @@ func ExtractMetadataOnly(filePath string) (parser.Metadata, error) {
 		return parser.Metadata{}, err
 	}
 
-	return ExtractMetadataOnlyReader(f, stat.Size())
+	return extractMetadataOnlyReader(f, stat.Size(), keepRaw)
 }
 
-// ExtractMetadataOnlyReader extracts only metadata from an EPUB reader without parsing the full content.
-func ExtractMetadataOnlyReader(r io.ReaderAt, size int64) (parser.Metadata, error) {
+func extractMetadataOnlyReader(r io.ReaderAt, size int64, keepRaw bool) (parser.Metadata, error) {
 	zipReader, err := zip.NewReader(r, size)
 	if err != nil {
 		return parser.Metadata{}, fmt.Errorf("failed to open EPUB as zip: %w", err)
 	}
 
+	return extractMetadataFromFiles(newZipFiles(zipReader), keepRaw)
+}
+
+func extractMetadataFromFiles(files fileOpener, keepRaw bool) (parser.Metadata, error) {
 	// Find and parse container.xml
-	containerFile, err := findFileInZip(zipReader, "META-INF/container.xml")
+	containerFile, err := files.findFile("META-INF/container.xml")
 	if err != nil {
 		return parser.Metadata{}, fmt.Errorf("container.xml not found: %w", err)
 	}
 
 	var container epubContainer
-	if err := parseXMLFromZipFile(containerFile, &container); err != nil {
+	if err := parseXMLFromFile(containerFile, &container); err != nil {
 		return parser.Metadata{}, fmt.Errorf("failed to parse container.xml: %w", err)
 	}
 
 	// Find and parse the package file (content.opf)
-	packageFile, err := findFileInZip(zipReader, container.RootFile.FullPath)
+	packageFile, err := files.findFile(container.rootFile())
 	if err != nil {
 		return parser.Metadata{}, fmt.Errorf("package file not found: %w", err)
 	}
 
 	var pkg epubPackage
-	if err := parseXMLFromZipFile(packageFile, &pkg); err != nil {
+	if err := parseXMLFromFile(packageFile, &pkg); err != nil {
 		return parser.Metadata{}, fmt.Errorf("failed to parse package file: %w", err)
 	}
 
-	return extractMetadata(pkg, container.RootFile.FullPath, zipReader), nil
+	metadata, _, _ := extractMetadata(pkg, container.rootFile(), files, DefaultMaxFileSize)
+	if keepRaw {
+		metadata.Raw = rawMetadata(packageFile, container.rootFile())
+	}
+	return metadata, nil
 }
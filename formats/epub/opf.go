@@ -0,0 +1,230 @@
+package epub
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vpoluyaktov/biblio-ebook-parser/internal/charset"
+	"github.com/vpoluyaktov/biblio-ebook-parser/parser"
+)
+
+const calibreUserMetadataPrefix = "calibre:user_metadata:"
+
+// OPFMetadata is the book metadata kept in a standalone Calibre metadata.opf
+type OPFMetadata struct {
+	parser.Metadata
+	Rating       int                        // Calibre rating, 0-10 (two per star)
+	Timestamp    time.Time                  // When the book was added to the library
+	TitleSort    string                     // Sort form of the title
+	UserMetadata map[string]json.RawMessage // Custom columns keyed by lookup name (e.g., "#read")
+}
+
+// ReadOPF reads a standalone OPF file, such as Calibre's metadata.opf. The
+// cover referenced from the guide is loaded from the same directory.
+func ReadOPF(filePath string) (*OPFMetadata, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open OPF: %w", err)
+	}
+	defer f.Close()
+
+	opf, pkg, err := readOPF(f)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ref := range pkg.Guide.References {
+		if ref.Type != "cover" || ref.Href == "" {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(filepath.Dir(filePath), filepath.FromSlash(ref.Href)))
+		if err != nil {
+			break
+		}
+		if coverType := parser.ImageType(data, ""); coverType != "" {
+			opf.SetCover(data, coverType)
+		}
+		break
+	}
+
+	return opf, nil
+}
+
+// ReadOPFReader reads a standalone OPF document from r. Covers are not loaded.
+func ReadOPFReader(r io.Reader) (*OPFMetadata, error) {
+	opf, _, err := readOPF(r)
+	return opf, err
+}
+
+func readOPF(r io.Reader) (*OPFMetadata, epubPackage, error) {
+	var pkg epubPackage
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, pkg, fmt.Errorf("failed to read OPF: %w", err)
+	}
+	if data, err = charset.DecodeXML(data); err != nil {
+		return nil, pkg, fmt.Errorf("failed to decode OPF: %w", err)
+	}
+	if err := unmarshalUTF8(data, &pkg); err != nil {
+		return nil, pkg, fmt.Errorf("failed to parse OPF: %w", err)
+	}
+
+	opf := &OPFMetadata{Metadata: metadataFromPackage(pkg)}
+	m := &opf.Metadata
+
+	// Subjects are kept as genres only
+	m.Description = strings.TrimSpace(pkg.Metadata.Description)
+
+	for _, meta := range pkg.Metadata.Metas {
+		switch {
+		case meta.Name == "calibre:rating":
+			if rating, err := strconv.ParseFloat(meta.Content, 64); err == nil {
+				opf.Rating = int(rating)
+			}
+		case meta.Name == "calibre:timestamp":
+			if t, err := time.Parse(time.RFC3339Nano, meta.Content); err == nil {
+				opf.Timestamp = t
+			}
+		case meta.Name == "calibre:title_sort":
+			opf.TitleSort = meta.Content
+		case strings.HasPrefix(meta.Name, calibreUserMetadataPrefix):
+			if !json.Valid([]byte(meta.Content)) {
+				continue
+			}
+			if opf.UserMetadata == nil {
+				opf.UserMetadata = make(map[string]json.RawMessage)
+			}
+			opf.UserMetadata[strings.TrimPrefix(meta.Name, calibreUserMetadataPrefix)] = json.RawMessage(meta.Content)
+		}
+	}
+
+	return opf, pkg, nil
+}
+
+// WriteOPF writes the metadata as a Calibre-style metadata.opf. Elements are
+// always written in the same order, so the output diffs cleanly. A cover is
+// referenced as cover.jpg (or cover.png) next to the OPF file.
+func WriteOPF(w io.Writer, opf *OPFMetadata) error {
+	m := &opf.Metadata
+	var b strings.Builder
+
+	b.WriteString("<?xml version='1.0' encoding='utf-8'?>\n")
+	b.WriteString("<package xmlns=\"http://www.idpf.org/2007/opf\" unique-identifier=\"uuid_id\" version=\"2.0\">\n")
+	b.WriteString("    <metadata xmlns:dc=\"http://purl.org/dc/elements/1.1/\" xmlns:opf=\"http://www.idpf.org/2007/opf\">\n")
+
+	// Calibre puts its own identifiers first
+	var identifiers []parser.Identifier
+	for _, scheme := range []string{"calibre", "uuid"} {
+		for _, id := range m.Identifiers {
+			if id.Scheme == scheme {
+				identifiers = append(identifiers, id)
+			}
+		}
+	}
+	for _, id := range m.Identifiers {
+		if id.Scheme != "calibre" && id.Scheme != "uuid" {
+			identifiers = append(identifiers, id)
+		}
+	}
+	uuidWritten := false
+	for _, id := range identifiers {
+		attrs := ""
+		switch id.Scheme {
+		case "calibre":
+			attrs = ` opf:scheme="calibre" id="calibre_id"`
+		case "uuid":
+			attrs = ` opf:scheme="uuid"`
+			if !uuidWritten {
+				attrs += ` id="uuid_id"`
+				uuidWritten = true
+			}
+		case "":
+		default:
+			attrs = fmt.Sprintf(` opf:scheme="%s"`, escapeXML(strings.ToUpper(id.Scheme)))
+		}
+		fmt.Fprintf(&b, "        <dc:identifier%s>%s</dc:identifier>\n", attrs, escapeXML(id.Value))
+	}
+
+	fmt.Fprintf(&b, "        <dc:title>%s</dc:title>\n", escapeXML(m.Title))
+	for _, a := range m.Authors {
+		if a.IsEmpty() {
+			continue
+		}
+		fmt.Fprintf(&b, "        <dc:creator opf:file-as=\"%s\" opf:role=\"aut\">%s</dc:creator>\n",
+			escapeXML(a.SortName()), escapeXML(a.FullName()))
+	}
+	if m.PublicationDate != "" {
+		fmt.Fprintf(&b, "        <dc:date>%s</dc:date>\n", escapeXML(m.PublicationDate))
+	}
+	if m.Description != "" {
+		fmt.Fprintf(&b, "        <dc:description>%s</dc:description>\n", escapeXML(m.Description))
+	}
+	if m.Publisher != "" {
+		fmt.Fprintf(&b, "        <dc:publisher>%s</dc:publisher>\n", escapeXML(m.Publisher))
+	}
+	if m.Language != "" {
+		fmt.Fprintf(&b, "        <dc:language>%s</dc:language>\n", escapeXML(m.Language))
+	}
+	for _, genre := range m.Genres {
+		fmt.Fprintf(&b, "        <dc:subject>%s</dc:subject>\n", escapeXML(genre))
+	}
+
+	meta := func(name, content string) {
+		fmt.Fprintf(&b, "        <meta name=\"%s\" content=\"%s\"/>\n", escapeXML(name), escapeXML(content))
+	}
+	series, seriesIndex := m.Series, m.SeriesIndex
+	if series == "" && len(m.Sequences) > 0 {
+		series, seriesIndex = m.Sequences[0].Name, m.Sequences[0].Number
+	}
+	if series != "" {
+		meta("calibre:series", series)
+		meta("calibre:series_index", strconv.Itoa(seriesIndex))
+	}
+	if opf.Rating > 0 {
+		meta("calibre:rating", strconv.Itoa(opf.Rating))
+	}
+	if !opf.Timestamp.IsZero() {
+		meta("calibre:timestamp", opf.Timestamp.UTC().Format("2006-01-02T15:04:05-07:00"))
+	}
+	if opf.TitleSort != "" {
+		meta("calibre:title_sort", opf.TitleSort)
+	}
+	names := make([]string, 0, len(opf.UserMetadata))
+	for name := range opf.UserMetadata {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		meta(calibreUserMetadataPrefix+name, string(opf.UserMetadata[name]))
+	}
+
+	b.WriteString("    </metadata>\n")
+
+	if len(m.CoverData) > 0 {
+		coverFile := "cover.jpg"
+		if m.CoverType == "image/png" {
+			coverFile = "cover.png"
+		}
+		fmt.Fprintf(&b, "    <guide>\n        <reference type=\"cover\" title=\"Cover\" href=\"%s\"/>\n    </guide>\n", coverFile)
+	}
+
+	b.WriteString("</package>\n")
+
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return fmt.Errorf("failed to write OPF: %w", err)
+	}
+	return nil
+}
+
+var xmlEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;", "'", "&apos;")
+
+func escapeXML(s string) string {
+	return xmlEscaper.Replace(s)
+}
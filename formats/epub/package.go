@@ -0,0 +1,168 @@
+package epub
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// PackageInfo describes the package document of an EPUB: the resources it
+// lists and their reading order, without parsing any content
+type PackageInfo struct {
+	RootFile string // Path of the package document (OPF) in the container
+	// Version is the EPUB version the package declares (e.g., "2.0", "3.0"),
+	// or one detected from a navigation document (3.0) or an NCX (2.0)
+	Version string
+	// PageProgressionDirection is "ltr", "rtl" or "" (default) as set on the spine
+	PageProgressionDirection string
+	TOC                      string         // Manifest id of the NCX named by the spine (EPUB 2)
+	Manifest                 []ManifestItem // In document order
+	Spine                    []SpineItem    // Reading order
+}
+
+// ManifestItem is a resource listed in the manifest
+type ManifestItem struct {
+	ID         string
+	Href       string // As written in the manifest
+	Path       string // Path in the container: resolved against the OPF and percent-decoded
+	MediaType  string
+	Properties []string // EPUB 3 properties, e.g., "nav", "cover-image", "scripted"
+	Fallback   string   // Id of the fallback item, if any
+	// Refines holds the EPUB 3 metadata refining the item, by property
+	// (e.g., "media:duration" of a media overlay)
+	Refines map[string]string
+}
+
+// SpineItem is an entry of the reading order
+type SpineItem struct {
+	IDRef      string
+	Path       string // Path of the referenced item, "" if it isn't in the manifest
+	MediaType  string
+	Linear     bool     // False for linear="no" items, such as notes only reached through links
+	Properties []string // EPUB 3 properties, e.g., "page-spread-left"
+}
+
+// HasProperty reports whether the item has an EPUB 3 property
+func (m ManifestItem) HasProperty(property string) bool {
+	for _, p := range m.Properties {
+		if p == property {
+			return true
+		}
+	}
+	return false
+}
+
+// ExtractPackageInfo reads the manifest and spine of an EPUB file or
+// unzipped EPUB directory, without parsing chapters
+func ExtractPackageInfo(filePath string) (*PackageInfo, error) {
+	files, closer, err := openFiles(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer closer.Close()
+
+	return extractPackageInfo(files)
+}
+
+// ExtractPackageInfoReader reads the manifest and spine of an EPUB from a
+// reader, without parsing chapters
+func ExtractPackageInfoReader(r io.ReaderAt, size int64) (*PackageInfo, error) {
+	zipReader, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open EPUB as zip: %w", err)
+	}
+
+	return extractPackageInfo(newZipFiles(zipReader))
+}
+
+func extractPackageInfo(files fileOpener) (*PackageInfo, error) {
+	containerFile, err := files.findFile("META-INF/container.xml")
+	if err != nil {
+		return nil, fmt.Errorf("container.xml not found: %w", err)
+	}
+
+	var container epubContainer
+	if err := parseXMLFromFile(containerFile, &container); err != nil {
+		return nil, fmt.Errorf("failed to parse container.xml: %w", err)
+	}
+
+	packageFile, err := files.findFile(container.rootFile())
+	if err != nil {
+		return nil, fmt.Errorf("package file not found: %w", err)
+	}
+
+	var pkg epubPackage
+	if err := parseXMLFromFile(packageFile, &pkg); err != nil {
+		return nil, fmt.Errorf("failed to parse package file: %w", err)
+	}
+
+	return packageInfo(pkg, container.rootFile()), nil
+}
+
+// packageInfo converts a parsed package document
+func packageInfo(pkg epubPackage, rootFile string) *PackageInfo {
+	baseDir := filepath.Dir(rootFile)
+	info := &PackageInfo{
+		RootFile:                 rootFile,
+		Version:                  strings.TrimSpace(pkg.Version),
+		PageProgressionDirection: strings.TrimSpace(pkg.Spine.PageProgressionDirection),
+		TOC:                      pkg.Spine.TOC,
+		Manifest:                 make([]ManifestItem, 0, len(pkg.Manifest.Items)),
+		Spine:                    make([]SpineItem, 0, len(pkg.Spine.ItemRefs)),
+	}
+
+	// EPUB 3 metadata refining manifest items, keyed by item id
+	refines := make(map[string]map[string]string)
+	for _, meta := range pkg.Metadata.Metas {
+		id := strings.TrimPrefix(strings.TrimSpace(meta.Refines), "#")
+		if id == "" || meta.Property == "" {
+			continue
+		}
+		if refines[id] == nil {
+			refines[id] = make(map[string]string)
+		}
+		refines[id][meta.Property] = strings.TrimSpace(meta.Value)
+	}
+
+	items := make(map[string]ManifestItem, len(pkg.Manifest.Items))
+	hasNav, hasNCX := false, false
+	for _, item := range pkg.Manifest.Items {
+		manifestItem := ManifestItem{
+			ID:         item.ID,
+			Href:       item.Href,
+			Path:       normalizeEPUBPath(baseDir, item.Href),
+			MediaType:  strings.TrimSpace(item.MediaType),
+			Properties: strings.Fields(item.Properties),
+			Fallback:   item.Fallback,
+			Refines:    refines[item.ID],
+		}
+		hasNav = hasNav || manifestItem.HasProperty("nav")
+		hasNCX = hasNCX || manifestItem.MediaType == "application/x-dtbncx+xml"
+		info.Manifest = append(info.Manifest, manifestItem)
+		items[item.ID] = manifestItem
+	}
+
+	for _, ref := range pkg.Spine.ItemRefs {
+		item := items[ref.IDRef]
+		info.Spine = append(info.Spine, SpineItem{
+			IDRef:      ref.IDRef,
+			Path:       item.Path,
+			MediaType:  item.MediaType,
+			Linear:     strings.TrimSpace(ref.Linear) != "no",
+			Properties: strings.Fields(ref.Properties),
+		})
+	}
+
+	if info.Version == "" {
+		switch {
+		case hasNav:
+			info.Version = "3.0"
+		case hasNCX:
+			info.Version = "2.0"
+		}
+	}
+
+	return info
+}
@@ -0,0 +1,205 @@
+package epub_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/vpoluyaktov/biblio-ebook-parser/formats/epub"
+	"github.com/vpoluyaktov/biblio-ebook-parser/testutil/epubtest"
+)
+
+func TestExtractPackageInfo(t *testing.T) {
+	builder := epubtest.New().
+		WithTitle("Package").
+		WithChapter("One", "<p>One.</p>").
+		WithChapter("Two", "<p>Two.</p>").
+		WithCover([]byte(pngHeader)).
+		WithNav()
+	data := builder.Bytes()
+
+	// From a reader, a file and an unzipped directory
+	dir := t.TempDir()
+	file := filepath.Join(dir, "book.epub")
+	if err := os.WriteFile(file, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	unzipped := filepath.Join(dir, "unzipped")
+	for _, e := range unzip(t, data) {
+		path := filepath.Join(unzipped, filepath.FromSlash(e.name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, e.data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	extract := map[string]func() (*epub.PackageInfo, error){
+		"reader": func() (*epub.PackageInfo, error) {
+			return epub.ExtractPackageInfoReader(bytes.NewReader(data), int64(len(data)))
+		},
+		"file":      func() (*epub.PackageInfo, error) { return epub.ExtractPackageInfo(file) },
+		"directory": func() (*epub.PackageInfo, error) { return epub.ExtractPackageInfo(unzipped) },
+	}
+	for name, extract := range extract {
+		t.Run(name, func(t *testing.T) {
+			info, err := extract()
+			if err != nil {
+				t.Fatalf("ExtractPackageInfo: %v", err)
+			}
+			if info.RootFile != "OEBPS/content.opf" || info.Version != "3.0" {
+				t.Errorf("root file %q, version %q", info.RootFile, info.Version)
+			}
+
+			var spine []string
+			for _, item := range info.Spine {
+				spine = append(spine, item.Path)
+				if item.MediaType != "application/xhtml+xml" || !item.Linear {
+					t.Errorf("spine item %+v", item)
+				}
+			}
+			if got := strings.Join(spine, " "); got != "OEBPS/chapter1.xhtml OEBPS/chapter2.xhtml" {
+				t.Errorf("spine = %s", got)
+			}
+
+			var nav, cover bool
+			for _, item := range info.Manifest {
+				if !strings.HasPrefix(item.Path, "OEBPS/") || item.Path != "OEBPS/"+item.Href {
+					t.Errorf("manifest item %q has path %q", item.Href, item.Path)
+				}
+				nav = nav || (item.HasProperty("nav") && item.Path == "OEBPS/nav.xhtml")
+				cover = cover || (item.HasProperty("cover-image") && item.MediaType == "image/png")
+			}
+			if !nav || !cover {
+				t.Errorf("manifest %+v has no nav or cover image", info.Manifest)
+			}
+		})
+	}
+}
+
+func TestExtractPackageInfoErrors(t *testing.T) {
+	book := opf("cover.png", "a.xhtml")
+	tests := []struct {
+		name    string
+		entries []entry
+		want    string
+	}{
+		{
+			name:    "missing container",
+			entries: []entry{{name: "OEBPS/content.opf", content: book}},
+			want:    "container.xml not found",
+		},
+		{
+			name: "malformed container",
+			entries: []entry{
+				{name: "META-INF/container.xml", content: `<container><rootfiles><rootfile full-path="OEBPS/content.opf"`},
+				{name: "OEBPS/content.opf", content: book},
+			},
+			want: "failed to parse container.xml",
+		},
+		{
+			name: "container without rootfile",
+			entries: []entry{
+				{name: "META-INF/container.xml", content: `<container><rootfiles/></container>`},
+				{name: "OEBPS/content.opf", content: book},
+			},
+			want: "package file not found",
+		},
+		{
+			name:    "missing package document",
+			entries: []entry{{name: "META-INF/container.xml", content: container}},
+			want:    "package file not found",
+		},
+		{
+			name: "malformed package document",
+			entries: []entry{
+				{name: "META-INF/container.xml", content: container},
+				{name: "OEBPS/content.opf", content: `<package><manifest><item`},
+			},
+			want: "failed to parse package file",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := craft(t, tt.entries...)
+			info, err := epub.ExtractPackageInfoReader(bytes.NewReader(data), int64(len(data)))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("ExtractPackageInfoReader = %+v, %v, want error %q", info, err, tt.want)
+			}
+		})
+	}
+
+	if _, err := epub.ExtractPackageInfoReader(strings.NewReader("not a zip"), 9); err == nil {
+		t.Error("ExtractPackageInfoReader of a non-zip succeeded")
+	}
+	if _, err := epub.ExtractPackageInfo(filepath.Join(t.TempDir(), "missing.epub")); err == nil {
+		t.Error("ExtractPackageInfo of a missing file succeeded")
+	}
+}
+
+func TestMultipleRootFiles(t *testing.T) {
+	rootfiles := func(rootfiles string) string {
+		return `<?xml version="1.0"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+<rootfiles>` + rootfiles + `</rootfiles>
+</container>`
+	}
+	tests := []struct {
+		name      string
+		container string
+		want      string
+		text      string // Of the rendition's chapter
+	}{
+		{
+			// The first is the default rendition
+			name: "two renditions",
+			container: rootfiles(`<rootfile full-path="first/content.opf" media-type="application/oebps-package+xml"/>
+<rootfile full-path="second/content.opf" media-type="application/oebps-package+xml"/>`),
+			want: "first/content.opf",
+			text: "First.",
+		},
+		{
+			name: "other formats first",
+			container: rootfiles(`<rootfile full-path="book.pdf" media-type="application/pdf"/>
+<rootfile full-path="second/content.opf" media-type="application/oebps-package+xml"/>`),
+			want: "second/content.opf",
+			text: "Second.",
+		},
+		{
+			name:      "no media type",
+			container: rootfiles(`<rootfile full-path="first/content.opf"/><rootfile full-path="second/content.opf"/>`),
+			want:      "first/content.opf",
+			text:      "First.",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := craft(t,
+				entry{name: "META-INF/container.xml", content: tt.container},
+				entry{name: "first/content.opf", content: opf("cover.png", "first.xhtml")},
+				entry{name: "first/first.xhtml", content: xhtml("First.")},
+				entry{name: "second/content.opf", content: opf("cover.png", "second.xhtml")},
+				entry{name: "second/second.xhtml", content: xhtml("Second.")},
+			)
+			info, err := epub.ExtractPackageInfoReader(bytes.NewReader(data), int64(len(data)))
+			if err != nil {
+				t.Fatalf("ExtractPackageInfoReader: %v", err)
+			}
+			if info.RootFile != tt.want {
+				t.Errorf("root file = %q, want %q", info.RootFile, tt.want)
+			}
+
+			// The parser reads the same rendition
+			book, err := epub.NewParser().ParseReader(bytes.NewReader(data), int64(len(data)))
+			if err != nil {
+				t.Fatalf("ParseReader: %v", err)
+			}
+			if text := strings.TrimSpace(bookText(book)); text != tt.text {
+				t.Errorf("book text %q, want %q", text, tt.text)
+			}
+		})
+	}
+}
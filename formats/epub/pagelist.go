@@ -0,0 +1,227 @@
+package epub
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/vpoluyaktov/biblio-ebook-parser/parser"
+)
+
+var (
+	rePageListNav = regexp.MustCompile(`(?is)<nav\s[^>]*epub:type\s*=\s*["'][^"']*\bpage-list\b[^"']*["'][^>]*>(.*?)</nav>`)
+	reNavLink     = regexp.MustCompile(`(?is)<a(\s[^>]*)?>(.*?)</a>`)
+)
+
+// pageListEntry is a page of the print page map before it is placed in the
+// chapters
+type pageListEntry struct {
+	Label  string
+	Path   string
+	Anchor string
+}
+
+// extractPageList reads the print page map from the EPUB 3 navigation
+// document, or else from the pageList of the NCX, and places each page in
+// the chapter and element it starts in. Returns warnings for the entries
+// that are malformed or can't be placed.
+func (p *Parser) extractPageList(files fileOpener, baseDir string, pkg epubPackage, chapters []parser.Chapter) ([]parser.PageTarget, []string) {
+	entries, warnings := readPageList(files, baseDir, pkg)
+	if len(entries) == 0 {
+		return nil, warnings
+	}
+
+	// Indexes of the chapters made from each file, in file order
+	byPath := make(map[string][]int)
+	for i, ch := range chapters {
+		byPath[ch.SourcePath] = append(byPath[ch.SourcePath], i)
+	}
+
+	// Only the file of the current entry is kept, as the pages of a file are
+	// consecutive
+	var htmlPath, htmlContent string
+	var pages []parser.PageTarget
+	for _, entry := range entries {
+		indexes := byPath[entry.Path]
+		if len(indexes) == 0 {
+			warnings = append(warnings, fmt.Sprintf("page %q skipped: %s is not in any chapter", entry.Label, entry.Path))
+			continue
+		}
+
+		if entry.Path != htmlPath {
+			chapterFile, err := files.findFile(entry.Path)
+			if err != nil {
+				warnings = append(warnings, fmt.Sprintf("page %q skipped: %v", entry.Label, err))
+				continue
+			}
+			data, err := readContentFile(chapterFile, p.maxFileSize())
+			if err != nil {
+				warnings = append(warnings, fmt.Sprintf("page %q skipped: %v", entry.Label, err))
+				continue
+			}
+			htmlPath, htmlContent = entry.Path, string(data)
+		}
+
+		pos, ok := anchorPosition(htmlContent, entry.Anchor)
+		if !ok {
+			warnings = append(warnings, fmt.Sprintf("page %q skipped: anchor %q not found in %s", entry.Label, entry.Anchor, entry.Path))
+			continue
+		}
+
+		// The last chapter starting at or before the page break; a page
+		// starting before the first chapter of the file starts with it
+		index := indexes[0]
+		for _, i := range indexes {
+			if chapters[i].SourceStart <= pos && chapters[i].SourceStart >= chapters[index].SourceStart {
+				index = i
+			}
+		}
+
+		// A page starting after the last element starts with the next chapter
+		offset := p.pageOffset(htmlContent, chapters[index], pos)
+		if offset == len(chapters[index].Elements) && index+1 < len(chapters) {
+			index, offset = index+1, 0
+		}
+
+		pages = append(pages, parser.PageTarget{
+			Label:         entry.Label,
+			ChapterID:     chapters[index].ID,
+			ElementOffset: offset,
+			Anchor:        entry.Anchor,
+		})
+	}
+
+	return pages, warnings
+}
+
+// pageOffset returns the index of the chapter element a page break at pos
+// in the chapter file falls in
+func (p *Parser) pageOffset(htmlContent string, ch parser.Chapter, pos int) int {
+	if pos <= ch.SourceStart {
+		return 0
+	}
+	if pos >= ch.SourceEnd {
+		return len(ch.Elements)
+	}
+
+	// Count the elements before the break, less one it cuts short
+	before := htmlToElements(htmlContent[ch.SourceStart:pos], p.ElementFilter, false)
+	n := min(len(before), len(ch.Elements))
+	if n > 0 && elementText(before[n-1]) != elementText(ch.Elements[n-1]) {
+		n--
+	}
+	return n
+}
+
+// elementText returns the text of the elements htmlToElements makes
+func elementText(elem parser.Element) string {
+	switch e := elem.(type) {
+	case *parser.Paragraph:
+		return e.Text
+	case *parser.Heading:
+		return e.Text
+	}
+	return ""
+}
+
+// readPageList returns the page-list nav of the EPUB 3 navigation document,
+// or else the pageList of the NCX, with warnings for malformed entries
+func readPageList(files fileOpener, baseDir string, pkg epubPackage) ([]pageListEntry, []string) {
+	for _, item := range pkg.Manifest.Items {
+		if !strings.Contains(" "+item.Properties+" ", " nav ") {
+			continue
+		}
+		navPath := normalizeEPUBPath(baseDir, item.Href)
+		navFile, err := files.findFile(navPath)
+		if err != nil {
+			continue
+		}
+		data, err := readXMLFile(navFile)
+		if err != nil {
+			continue
+		}
+		if pageList := rePageListNav.FindSubmatch(data); pageList != nil {
+			return navPageList(string(pageList[1]), filepath.Dir(navPath))
+		}
+	}
+
+	for _, item := range pkg.Manifest.Items {
+		if item.ID != pkg.Spine.TOC && item.MediaType != "application/x-dtbncx+xml" {
+			continue
+		}
+		ncxPath := normalizeEPUBPath(baseDir, item.Href)
+		ncxFile, err := files.findFile(ncxPath)
+		if err != nil {
+			continue
+		}
+		if entries, warnings := ncxPageList(ncxFile, filepath.Dir(ncxPath)); len(entries) > 0 || len(warnings) > 0 {
+			return entries, warnings
+		}
+	}
+
+	return nil, nil
+}
+
+// navPageList reads the links of a page-list nav
+func navPageList(nav, navBaseDir string) ([]pageListEntry, []string) {
+	var entries []pageListEntry
+	var warnings []string
+	for i, m := range reNavLink.FindAllStringSubmatch(nav, -1) {
+		label := strings.TrimSpace(stripHTMLTags(m[2]))
+		href := reAnchorHref.FindStringSubmatch(m[1])
+		if href == nil || strings.TrimSpace(href[1]) == "" || label == "" {
+			warnings = append(warnings, fmt.Sprintf("page list entry %d skipped: missing label or href", i+1))
+			continue
+		}
+		filePath, anchor := splitEPUBHref(href[1])
+		entries = append(entries, pageListEntry{
+			Label:  label,
+			Path:   normalizeEPUBPath(navBaseDir, filePath),
+			Anchor: anchor,
+		})
+	}
+	return entries, warnings
+}
+
+// ncxPageList reads the page targets of an NCX, labeled by their navLabel
+// or else their value
+func ncxPageList(f bookFile, ncxBaseDir string) ([]pageListEntry, []string) {
+	var ncx struct {
+		PageList struct {
+			PageTargets []struct {
+				Value    string `xml:"value,attr"`
+				NavLabel struct {
+					Text string `xml:"text"`
+				} `xml:"navLabel"`
+				Content struct {
+					Src string `xml:"src,attr"`
+				} `xml:"content"`
+			} `xml:"pageTarget"`
+		} `xml:"pageList"`
+	}
+	if err := parseXMLFromFile(f, &ncx); err != nil {
+		return nil, nil
+	}
+
+	var entries []pageListEntry
+	var warnings []string
+	for i, target := range ncx.PageList.PageTargets {
+		label := strings.TrimSpace(stripHTMLTags(target.NavLabel.Text))
+		if label == "" {
+			label = strings.TrimSpace(target.Value)
+		}
+		src := strings.TrimSpace(target.Content.Src)
+		if label == "" || src == "" {
+			warnings = append(warnings, fmt.Sprintf("page list entry %d skipped: missing label or src", i+1))
+			continue
+		}
+		filePath, anchor := splitEPUBHref(src)
+		entries = append(entries, pageListEntry{
+			Label:  label,
+			Path:   normalizeEPUBPath(ncxBaseDir, filePath),
+			Anchor: anchor,
+		})
+	}
+	return entries, warnings
+}
@@ -0,0 +1,235 @@
+package epub
+
+import (
+	"encoding/xml"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/vpoluyaktov/biblio-ebook-parser/parser"
+)
+
+var (
+	reAnchorTag   = regexp.MustCompile(`(?is)<a\s[^>]*>`)
+	reEPUBType    = regexp.MustCompile(`(?i)\bepub:type\s*=\s*["']([^"']*)["']`)
+	reAnchorHref  = regexp.MustCompile(`(?i)\bhref\s*=\s*["']([^"']*)["']`)
+	reLandmarkNav = regexp.MustCompile(`(?is)<nav\s[^>]*epub:type\s*=\s*["'][^"']*\blandmarks\b[^"']*["'][^>]*>(.*?)</nav>`)
+)
+
+// chapterRoles are the EPUB 3 structural semantics types taken as chapter
+// roles. The divisions frontmatter, bodymatter and backmatter are only used
+// when nothing more specific is given.
+var chapterRoles = map[string]bool{
+	"cover": true, "titlepage": true, "halftitlepage": true, "copyright-page": true,
+	"seriespage": true, "imprint": true, "dedication": true, "epigraph": true,
+	"acknowledgments": true, "foreword": true, "preface": true, "introduction": true,
+	"preamble": true, "prologue": true, "abstract": true, "toc": true, "loi": true,
+	"lot": true, "part": true, "chapter": true, "volume": true, "epilogue": true,
+	"afterword": true, "conclusion": true, "appendix": true, "glossary": true,
+	"bibliography": true, "index": true, "colophon": true, "errata": true,
+	"contributors": true, "other-credits": true, "endnotes": true, "footnotes": true,
+	"rearnotes": true,
+}
+
+// divisionRoles are the broad divisions of a book
+var divisionRoles = map[string]bool{
+	"frontmatter": true,
+	"bodymatter":  true,
+	"backmatter":  true,
+}
+
+// guideRoles maps EPUB 2 guide types to the EPUB 3 roles they stand for,
+// where the names differ
+var guideRoles = map[string]string{
+	"title-page":       "titlepage",
+	"acknowledgements": "acknowledgments",
+	"notes":            "endnotes",
+	"text":             "bodymatter",
+}
+
+// landmark is a page the OPF guide or the EPUB 3 landmarks give a role
+type landmark struct {
+	Path   string
+	Anchor string
+	Role   string
+}
+
+// roleOf returns the role named by an epub:type or guide type value, which
+// may list several types: the first specific role, or else the first
+// division. Empty if none is known.
+func roleOf(types string) string {
+	division := ""
+	for _, t := range strings.Fields(strings.ToLower(types)) {
+		if role, ok := guideRoles[t]; ok {
+			t = role
+		}
+		if chapterRoles[t] {
+			return t
+		}
+		if division == "" && divisionRoles[t] {
+			division = t
+		}
+	}
+	return division
+}
+
+// chapterRole picks the role of a chapter from candidates in order of
+// precedence: the first specific role, or else the first division.
+// Chapters of the body matter, or with no role given, are chapters.
+func chapterRole(candidates ...string) string {
+	division := ""
+	for _, role := range candidates {
+		if chapterRoles[role] {
+			return role
+		}
+		if division == "" && divisionRoles[role] {
+			division = role
+		}
+	}
+	if division == "" || division == "bodymatter" {
+		return parser.RoleChapter
+	}
+	return division
+}
+
+// landmarks returns the pages the OPF guide and the landmarks nav of the
+// navigation document give a role
+func landmarks(files fileOpener, baseDir string, pkg epubPackage) []landmark {
+	var marks []landmark
+
+	for _, ref := range pkg.Guide.References {
+		if role := roleOf(ref.Type); role != "" {
+			filePath, anchor := splitEPUBHref(ref.Href)
+			marks = append(marks, landmark{Path: normalizeEPUBPath(baseDir, filePath), Anchor: anchor, Role: role})
+		}
+	}
+
+	for _, item := range pkg.Manifest.Items {
+		if !strings.Contains(" "+item.Properties+" ", " nav ") {
+			continue
+		}
+		navPath := normalizeEPUBPath(baseDir, item.Href)
+		navFile, err := files.findFile(navPath)
+		if err != nil {
+			continue
+		}
+		data, err := readXMLFile(navFile)
+		if err != nil {
+			continue
+		}
+		nav := reLandmarkNav.FindSubmatch(data)
+		if nav == nil {
+			continue
+		}
+		for _, tag := range reAnchorTag.FindAll(nav[1], -1) {
+			epubType, href := reEPUBType.FindSubmatch(tag), reAnchorHref.FindSubmatch(tag)
+			if epubType == nil || href == nil {
+				continue
+			}
+			if role := roleOf(string(epubType[1])); role != "" {
+				filePath, anchor := splitEPUBHref(string(href[1]))
+				marks = append(marks, landmark{Path: normalizeEPUBPath(filepath.Dir(navPath), filePath), Anchor: anchor, Role: role})
+			}
+		}
+	}
+
+	return marks
+}
+
+// landmarkRole returns the role the landmarks give a chapter: that of its
+// file and anchor, or of its file alone if it starts the file
+func landmarkRole(marks []landmark, ch parser.Chapter) string {
+	for _, mark := range marks {
+		if mark.Path == ch.SourcePath && (mark.Anchor == ch.SourceAnchor || mark.Anchor == "" && ch.SourceStart == 0) {
+			return mark.Role
+		}
+	}
+	return ""
+}
+
+// epubTypeAttr returns the epub:type attribute of an element
+func epubTypeAttr(t xml.StartElement) string {
+	for _, attr := range t.Attr {
+		if strings.EqualFold(attr.Name.Space, "epub") && strings.EqualFold(attr.Name.Local, "type") {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// roleScanner finds the roles a content document gives its chapters by the
+// epub:type of the body and the sections they start in. Chapters are looked
+// up in document order, so the document is read once.
+type roleScanner struct {
+	html    string
+	decoder *xml.Decoder
+	open    []openElement
+}
+
+// openElement is an element a roleScanner is in
+type openElement struct {
+	name string
+	role string
+}
+
+func newRoleScanner(htmlContent string) *roleScanner {
+	s := &roleScanner{html: htmlContent}
+	s.reset()
+	return s
+}
+
+func (s *roleScanner) reset() {
+	s.decoder = newLenientDecoder(s.html)
+	s.open = s.open[:0]
+}
+
+// roleAt returns the role of the content at an offset: the innermost
+// specific role of the elements open at its first text or image, or else
+// the innermost division. Empty if none is given.
+func (s *roleScanner) roleAt(offset int) string {
+	if s.decoder.InputOffset() > int64(offset) {
+		s.reset()
+	}
+	for {
+		start := s.decoder.InputOffset()
+		token, err := s.decoder.RawToken()
+		if err != nil {
+			return s.role()
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			name := strings.ToLower(t.Name.Local)
+			s.open = append(s.open, openElement{name: name, role: roleOf(epubTypeAttr(t))})
+			if start >= int64(offset) && (name == "img" || name == "image") {
+				return s.role()
+			}
+		case xml.EndElement:
+			name := strings.ToLower(t.Name.Local)
+			for i := len(s.open) - 1; i >= 0; i-- {
+				if s.open[i].name == name {
+					s.open = s.open[:i]
+					break
+				}
+			}
+		case xml.CharData:
+			if start >= int64(offset) && strings.TrimSpace(string(t)) != "" {
+				return s.role()
+			}
+		}
+	}
+}
+
+// role returns the innermost role of the open elements
+func (s *roleScanner) role() string {
+	division := ""
+	for i := len(s.open) - 1; i >= 0; i-- {
+		role := s.open[i].role
+		if chapterRoles[role] {
+			return role
+		}
+		if division == "" && divisionRoles[role] {
+			division = role
+		}
+	}
+	return division
+}
@@ -1,14 +1,25 @@
 package epub
 
 import (
-	"archive/zip"
-	"io"
+	"encoding/xml"
+	"fmt"
 	"path/filepath"
 	"regexp"
 	"strings"
+
+	"github.com/vpoluyaktov/biblio-ebook-parser/parser"
+)
+
+var (
+	reTOCNav      = regexp.MustCompile(`(?is)<nav\s[^>]*epub:type\s*=\s*["'][^"']*\btoc\b[^"']*["'][^>]*>(.*?)</nav>`)
+	reDisplayNone = regexp.MustCompile(`(?i)\bdisplay\s*:\s*none\b`)
 )
 
-func extractTOCEntries(zr *zip.Reader, packageBaseDir string, manifestMap map[string]string, manifestMediaTypeMap map[string]string, spineTOCID string) []epubTOCEntry {
+// extractTOCEntries reads the entries of the first table of contents that
+// has any, NCX or navigation document, with warnings for the entries left
+// out. Only the navMap of an NCX is read: its docTitle and docAuthor are
+// never entries.
+func extractTOCEntries(files fileOpener, packageBaseDir string, manifestMap map[string]string, manifestMediaTypeMap map[string]string, spineTOCID string) ([]epubTOCEntry, []string) {
 	tocIDs := make([]string, 0, 4)
 	if spineTOCID != "" {
 		tocIDs = append(tocIDs, spineTOCID)
@@ -25,7 +36,7 @@ func extractTOCEntries(zr *zip.Reader, packageBaseDir string, manifestMap map[st
 			continue
 		}
 		tocPath := normalizeEPUBPath(packageBaseDir, tocHref)
-		tocFile, err := findFileInZip(zr, tocPath)
+		tocFile, err := files.findFile(tocPath)
 		if err != nil {
 			continue
 		}
@@ -35,33 +46,39 @@ func extractTOCEntries(zr *zip.Reader, packageBaseDir string, manifestMap map[st
 		if mediaType == "application/x-dtbncx+xml" {
 			entries, err := parseNCXTOCEntries(tocFile, tocBaseDir)
 			if err == nil && len(entries) > 0 {
-				return entries
+				if log := parser.Logger(); log != nil {
+					log.Debug("EPUB chapters from NCX", "path", tocPath, "entries", len(entries))
+				}
+				return entries, nil
 			}
 			continue
 		}
 		if mediaType == "application/xhtml+xml" {
-			entries, err := parseNavXHTMLTOCEntries(tocFile, tocBaseDir)
+			entries, warnings, err := parseNavXHTMLTOCEntries(tocFile, tocBaseDir)
 			if err == nil && len(entries) > 0 {
-				return entries
+				if log := parser.Logger(); log != nil {
+					log.Debug("EPUB chapters from navigation document", "path", tocPath, "entries", len(entries))
+				}
+				return entries, warnings
 			}
 		}
 	}
 
-	return nil
+	return nil, nil
 }
 
-func parseNCXTOCEntries(f *zip.File, tocBaseDir string) ([]epubTOCEntry, error) {
+func parseNCXTOCEntries(f bookFile, tocBaseDir string) ([]epubTOCEntry, error) {
 	var ncx struct {
 		NavMap struct {
 			NavPoints []ncxNavPoint `xml:"navPoint"`
 		} `xml:"navMap"`
 	}
-	if err := parseXMLFromZipFile(f, &ncx); err != nil {
+	if err := parseXMLFromFile(f, &ncx); err != nil {
 		return nil, err
 	}
 
 	entries := make([]epubTOCEntry, 0, len(ncx.NavMap.NavPoints))
-	collectNCXTOCEntries(ncx.NavMap.NavPoints, tocBaseDir, &entries)
+	collectNCXTOCEntries(ncx.NavMap.NavPoints, tocBaseDir, 0, &entries)
 	return entries, nil
 }
 
@@ -75,9 +92,9 @@ type ncxNavPoint struct {
 	NavPoints []ncxNavPoint `xml:"navPoint"`
 }
 
-func collectNCXTOCEntries(points []ncxNavPoint, tocBaseDir string, out *[]epubTOCEntry) {
+func collectNCXTOCEntries(points []ncxNavPoint, tocBaseDir string, level int, out *[]epubTOCEntry) {
 	for _, point := range points {
-		title := strings.TrimSpace(stripHTMLTags(point.NavLabel.Text))
+		title := titleText(point.NavLabel.Text)
 		src := strings.TrimSpace(point.Content.Src)
 		if title != "" && src != "" {
 			filePath, anchor := splitEPUBHref(src)
@@ -85,45 +102,139 @@ func collectNCXTOCEntries(points []ncxNavPoint, tocBaseDir string, out *[]epubTO
 				Title:  title,
 				Path:   normalizeEPUBPath(tocBaseDir, filePath),
 				Anchor: anchor,
+				Level:  level,
 			})
 		}
 		if len(point.NavPoints) > 0 {
-			collectNCXTOCEntries(point.NavPoints, tocBaseDir, out)
+			collectNCXTOCEntries(point.NavPoints, tocBaseDir, level+1, out)
 		}
 	}
 }
 
-func parseNavXHTMLTOCEntries(f *zip.File, tocBaseDir string) ([]epubTOCEntry, error) {
-	rc, err := f.Open()
+// parseNavXHTMLTOCEntries reads the links of the toc nav of a navigation
+// document, returning a warning for each link left out because it, or a
+// list or item holding it, is hidden (with the hidden attribute or
+// display: none)
+func parseNavXHTMLTOCEntries(f bookFile, tocBaseDir string) ([]epubTOCEntry, []string, error) {
+	data, err := readXMLFile(f)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	defer rc.Close()
 
-	data, err := io.ReadAll(rc)
-	if err != nil {
-		return nil, err
+	// Only the toc nav holds chapters; landmarks and the page list repeat them
+	if toc := reTOCNav.FindSubmatch(data); toc != nil {
+		data = toc[1]
 	}
 
-	// Lenient fallback parser for nav.xhtml when XML namespaces are inconsistent
-	re := regexp.MustCompile(`(?is)<a[^>]*href\s*=\s*"([^"]+)"[^>]*>(.*?)</a>`)
-	matches := re.FindAllStringSubmatch(string(data), -1)
-	entries := make([]epubTOCEntry, 0, len(matches))
-	for _, m := range matches {
-		href := strings.TrimSpace(m[1])
-		title := strings.TrimSpace(stripHTMLTags(m[2]))
-		if href == "" || title == "" {
-			continue
+	// Lenient, as navigation documents are often tag soup
+	decoder := newLenientDecoder(cleanMarkup(string(data)))
+
+	var entries []epubTOCEntry
+	var warnings []string
+	hidden, hiddenDepth := "", 0 // Hidden element the tokens are in
+	inLink, linkHidden := false, false
+	lists := 0 // Depth of the ol the tokens are in
+	var href, itemRole, linkRole string
+	var title strings.Builder
+
+	for {
+		token, err := decoder.RawToken()
+		if err != nil {
+			// io.EOF, or markup too broken to go on: keep what was read
+			break
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			name := strings.ToLower(t.Name.Local)
+			if hidden != "" {
+				if name == hidden {
+					hiddenDepth++
+				}
+			} else if isHiddenElement(t) {
+				hidden, hiddenDepth = name, 1
+			}
+			switch name {
+			case "ol":
+				lists++
+			case "li":
+				itemRole = roleOf(epubTypeAttr(t))
+			case "a":
+				inLink, linkHidden = true, hidden != ""
+				href, _ = attrValue(t, "href")
+				if linkRole = roleOf(epubTypeAttr(t)); linkRole == "" {
+					linkRole = itemRole
+				}
+				title.Reset()
+			case "br":
+				if inLink {
+					title.WriteRune(titleLineBreak)
+				}
+			}
+
+		case xml.EndElement:
+			name := strings.ToLower(t.Name.Local)
+			if name == "a" && inLink {
+				inLink = false
+				entryTitle := strings.Join(strings.Fields(joinTitleLines(title.String())), " ")
+				href = strings.TrimSpace(href)
+				switch {
+				case href == "" || entryTitle == "":
+				case linkHidden:
+					warnings = append(warnings, fmt.Sprintf("TOC entry %q skipped: hidden in the navigation document", entryTitle))
+				default:
+					filePath, anchor := splitEPUBHref(href)
+					entries = append(entries, epubTOCEntry{
+						Title:  entryTitle,
+						Path:   normalizeEPUBPath(tocBaseDir, filePath),
+						Anchor: anchor,
+						Role:   linkRole,
+						Level:  max(lists-1, 0),
+					})
+				}
+			}
+			if name == "li" {
+				itemRole = ""
+			}
+			if name == "ol" && lists > 0 {
+				lists--
+			}
+			if hidden != "" && name == hidden {
+				hiddenDepth--
+				if hiddenDepth == 0 {
+					hidden = ""
+				}
+			}
+
+		case xml.CharData:
+			if inLink {
+				title.Write(t)
+			}
 		}
-		filePath, anchor := splitEPUBHref(href)
-		entries = append(entries, epubTOCEntry{
-			Title:  title,
-			Path:   normalizeEPUBPath(tocBaseDir, filePath),
-			Anchor: anchor,
-		})
 	}
 
-	return entries, nil
+	return entries, warnings, nil
+}
+
+// isHiddenElement reports whether an element of a navigation document is
+// hidden from readers, and the entries in it with it
+func isHiddenElement(t xml.StartElement) bool {
+	if _, ok := attrValue(t, "hidden"); ok {
+		return true
+	}
+	style, _ := attrValue(t, "style")
+	return reDisplayNone.MatchString(style)
+}
+
+// attrValue returns the value of an attribute, matching its local name
+// regardless of case
+func attrValue(t xml.StartElement, name string) (string, bool) {
+	for _, attr := range t.Attr {
+		if strings.EqualFold(attr.Name.Local, name) {
+			return attr.Value, true
+		}
+	}
+	return "", false
 }
 
 func splitEPUBHref(href string) (string, string) {
@@ -0,0 +1,141 @@
+package fb2
+
+import (
+	"encoding/xml"
+	"html"
+	"io"
+	"strings"
+)
+
+// annotationBlock is a single paragraph-level piece of an annotation
+type annotationBlock struct {
+	Text string
+	HTML string // Inline markup limited to em and strong
+}
+
+// parseAnnotation flattens annotation markup into paragraph blocks. Paragraphs, poem
+// verses, subtitles and text-authors become separate blocks wherever they are nested
+// (cite, poem, stanza), and empty-line acts as a paragraph break.
+func parseAnnotation(content string) []annotationBlock {
+	if strings.TrimSpace(content) == "" {
+		return nil
+	}
+
+	decoder := xml.NewDecoder(strings.NewReader("<annotation>" + content + "</annotation>"))
+	decoder.Strict = false
+	decoder.AutoClose = xml.HTMLAutoClose
+	decoder.Entity = xml.HTMLEntity
+
+	var blocks []annotationBlock
+	var text, markup strings.Builder
+	var inline []string
+
+	flush := func() {
+		for i := len(inline) - 1; i >= 0; i-- {
+			markup.WriteString("</" + inline[i] + ">")
+		}
+		t := strings.TrimSpace(text.String())
+		if t != "" {
+			blocks = append(blocks, annotationBlock{
+				Text: t,
+				HTML: strings.TrimSpace(markup.String()),
+			})
+		}
+		text.Reset()
+		markup.Reset()
+		for _, tag := range inline {
+			markup.WriteString("<" + tag + ">")
+		}
+	}
+
+	for {
+		tok, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// Keep whatever was parsed before the malformed markup
+			break
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "p", "v", "subtitle", "text-author", "empty-line":
+				flush()
+			case "emphasis":
+				inline = append(inline, "em")
+				markup.WriteString("<em>")
+			case "strong":
+				inline = append(inline, "strong")
+				markup.WriteString("<strong>")
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "p", "v", "subtitle", "text-author":
+				flush()
+			case "emphasis", "strong":
+				if len(inline) > 0 {
+					markup.WriteString("</" + inline[len(inline)-1] + ">")
+					inline = inline[:len(inline)-1]
+				}
+			}
+		case xml.CharData:
+			s := collapseSpaces(string(t))
+			if s == "" {
+				continue
+			}
+			if text.Len() == 0 {
+				s = strings.TrimLeft(s, " ")
+			}
+			text.WriteString(s)
+			markup.WriteString(html.EscapeString(s))
+		}
+	}
+	// Close the inline elements truncated markup leaves open
+	flush()
+
+	return blocks
+}
+
+// annotationToText returns the annotation as plain text with blank lines between paragraphs
+func annotationToText(content string) string {
+	blocks := parseAnnotation(content)
+	parts := make([]string, len(blocks))
+	for i, b := range blocks {
+		parts[i] = b.Text
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// annotationToHTML returns the annotation as cleaned HTML using only p, em and strong
+func annotationToHTML(content string) string {
+	blocks := parseAnnotation(content)
+	parts := make([]string, len(blocks))
+	for i, b := range blocks {
+		parts[i] = "<p>" + b.HTML + "</p>"
+	}
+	return strings.Join(parts, "\n")
+}
+
+// collapseSpaces replaces runs of whitespace (including non-breaking spaces) with a single space
+func collapseSpaces(s string) string {
+	var b strings.Builder
+	b.Grow(len(s))
+	space := false
+	for _, r := range s {
+		if r == ' ' || r == '\t' || r == '\n' || r == '\r' || r == '\u00A0' {
+			space = true
+			continue
+		}
+		if space {
+			b.WriteByte(' ')
+			space = false
+		}
+		b.WriteRune(r)
+	}
+	if space {
+		b.WriteByte(' ')
+	}
+	return b.String()
+}
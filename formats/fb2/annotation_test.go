@@ -0,0 +1,97 @@
+package fb2
+
+import "testing"
+
+func TestAnnotation(t *testing.T) {
+	tests := []struct {
+		name       string
+		content    string
+		text, html string
+	}{
+		{
+			name:    "paragraphs",
+			content: "<p>Первый  абзац.</p>\n<p>Второй абзац.</p>",
+			text:    "Первый абзац.\n\nВторой абзац.",
+			html:    "<p>Первый абзац.</p>\n<p>Второй абзац.</p>",
+		},
+		{
+			name:    "poem",
+			content: `<poem><title><p>Стихи</p></title><stanza><v>Мороз и солнце;</v><v>день чудесный!</v></stanza><text-author>А. Пушкин</text-author></poem>`,
+			text:    "Стихи\n\nМороз и солнце;\n\nдень чудесный!\n\nА. Пушкин",
+			html:    "<p>Стихи</p>\n<p>Мороз и солнце;</p>\n<p>день чудесный!</p>\n<p>А. Пушкин</p>",
+		},
+		{
+			name:    "empty line",
+			content: `<p>До</p><empty-line/><p>После</p>`,
+			text:    "До\n\nПосле",
+			html:    "<p>До</p>\n<p>После</p>",
+		},
+		{
+			name:    "empty line inside a paragraph",
+			content: `<p>One<empty-line/>two</p>`,
+			text:    "One\n\ntwo",
+			html:    "<p>One</p>\n<p>two</p>",
+		},
+		{
+			name:    "emphasis",
+			content: `<p>A <emphasis>very</emphasis> <strong>good</strong> book &amp; more</p>`,
+			text:    "A very good book & more",
+			html:    "<p>A <em>very</em> <strong>good</strong> book &amp; more</p>",
+		},
+		{
+			name:    "emphasis across paragraphs",
+			content: `<emphasis><p>One</p><p>Two</p></emphasis>`,
+			text:    "One\n\nTwo",
+			html:    "<p><em>One</em></p>\n<p><em>Two</em></p>",
+		},
+		{
+			name:    "cite",
+			content: `<cite><p>Цитата</p><text-author>Автор</text-author></cite><p>Текст</p>`,
+			text:    "Цитата\n\nАвтор\n\nТекст",
+			html:    "<p>Цитата</p>\n<p>Автор</p>\n<p>Текст</p>",
+		},
+		{
+			name:    "text without paragraphs",
+			content: "Just text",
+			text:    "Just text",
+			html:    "<p>Just text</p>",
+		},
+		{
+			name:    "unclosed emphasis",
+			content: `<p>Kept</p><p>Closed <emphasis>here</p>`,
+			text:    "Kept\n\nClosed here",
+			html:    "<p>Kept</p>\n<p>Closed <em>here</em></p>",
+		},
+		// Cut off in a tag, the markup stops the decoder with inline
+		// elements open
+		{
+			name:    "truncated in an end tag",
+			content: `<p>Kept</p><p>Cut <strong>short <emphasis>right here</emph`,
+			text:    "Kept\n\nCut short right here",
+			html:    "<p>Kept</p>\n<p>Cut <strong>short <em>right here</em></strong></p>",
+		},
+		{
+			name:    "truncated in an attribute",
+			content: `<p>See <emphasis>the note <a l:href="#n`,
+			text:    "See the note",
+			html:    "<p>See <em>the note </em></p>",
+		},
+		{
+			name:    "truncated text without paragraphs",
+			content: `Just <strong>bold <emphasis>text</p`,
+			text:    "Just bold text",
+			html:    "<p>Just <strong>bold <em>text</em></strong></p>",
+		},
+		{name: "empty", content: "  \n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := annotationToText(tt.content); got != tt.text {
+				t.Errorf("annotationToText = %q, want %q", got, tt.text)
+			}
+			if got := annotationToHTML(tt.content); got != tt.html {
+				t.Errorf("annotationToHTML = %q, want %q", got, tt.html)
+			}
+		})
+	}
+}
@@ -0,0 +1,231 @@
+package fb2
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/vpoluyaktov/biblio-ebook-parser/internal/zipindex"
+	"github.com/vpoluyaktov/biblio-ebook-parser/parser"
+)
+
+// ArchiveEntry describes an FB2 file stored in a .fb2.zip archive
+type ArchiveEntry struct {
+	Index int    // 1-based position among the FB2 entries of the archive
+	Name  string // Path inside the archive
+	Size  int64  // Uncompressed size in bytes
+}
+
+// ListArchiveEntries lists the FB2 entries of a .fb2.zip file.
+// Entries under __MACOSX/ and empty files are left out.
+func ListArchiveEntries(filePath string) ([]ArchiveEntry, error) {
+	r, err := zip.OpenReader(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open ZIP: %w", err)
+	}
+	defer r.Close()
+
+	return listEntries(&r.Reader), nil
+}
+
+// ListArchiveEntriesReader lists the FB2 entries of a .fb2.zip archive read from an io.ReaderAt
+func ListArchiveEntriesReader(r io.ReaderAt, size int64) ([]ArchiveEntry, error) {
+	zipReader, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open ZIP: %w", err)
+	}
+
+	return listEntries(zipReader), nil
+}
+
+// ParseAll parses every FB2 entry of a .fb2.zip file, in archive order.
+// A plain FB2 file yields a single book. When parts of some books failed to
+// parse, all the books are returned with a *parser.PartialError listing
+// those parts under their entry names.
+func (p *Parser) ParseAll(filePath string) ([]*parser.Book, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+
+	return p.parseAllFromBytes(data)
+}
+
+// ParseAllReader parses every FB2 entry of a .fb2.zip archive read from an io.ReaderAt
+func (p *Parser) ParseAllReader(r io.ReaderAt, size int64) ([]*parser.Book, error) {
+	data := make([]byte, size)
+	_, err := r.ReadAt(data, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read FB2: %w", err)
+	}
+
+	return p.parseAllFromBytes(data)
+}
+
+func (p *Parser) parseAllFromBytes(data []byte) ([]*parser.Book, error) {
+	if !isZip(data) {
+		book, err := p.parseFromBytes(data)
+		if book == nil {
+			return nil, err
+		}
+		return []*parser.Book{book}, err
+	}
+
+	zipReader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open ZIP: %w", err)
+	}
+
+	files := fb2Entries(zipReader)
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no FB2 file found in archive")
+	}
+
+	books := make([]*parser.Book, 0, len(files))
+	var issues []parser.Issue
+	for _, f := range files {
+		book, err := p.parseZipEntry(f)
+		if book == nil {
+			return nil, fmt.Errorf("%s: %w", f.Name, err)
+		}
+		for _, issue := range book.Issues {
+			if issue.Part != f.Name {
+				issue.Part = f.Name + "/" + issue.Part
+			}
+			issues = append(issues, issue)
+		}
+		books = append(books, book)
+	}
+
+	if len(issues) > 0 {
+		return books, &parser.PartialError{Issues: issues}
+	}
+	return books, nil
+}
+
+func (p *Parser) parseFromZip(data []byte) (*parser.Book, error) {
+	zipReader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open ZIP: %w", err)
+	}
+
+	fb2File, err := selectFB2Entry(zipReader, p.ArchiveEntry, p.ArchiveEntryIndex)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.parseZipEntry(fb2File)
+}
+
+// parseZipEntry parses an FB2 entry of an archive. A corrupt entry still
+// gives the book up to the damage, with an issue for the entry.
+func (p *Parser) parseZipEntry(f *zip.File) (*parser.Book, error) {
+	fb2Data, readErr := readZipEntry(f)
+	if readErr != nil && len(fb2Data) == 0 {
+		return nil, readErr
+	}
+
+	book, err := p.parseFromBytes(fb2Data)
+	if readErr == nil {
+		return book, err
+	}
+	if book == nil {
+		return nil, readErr
+	}
+	book.AddIssue(f.Name, readErr)
+	book.LogWarnings("fb2")
+	return book, book.Err()
+}
+
+func isZip(data []byte) bool {
+	return len(data) > 4 && bytes.Equal(data[0:4], []byte{0x50, 0x4B, 0x03, 0x04})
+}
+
+func isGzip(data []byte) bool {
+	return len(data) > 2 && data[0] == 0x1F && data[1] == 0x8B
+}
+
+// readZipEntry reads an FB2 entry of an archive. On a read error, such as a
+// corrupt deflate stream, what was read before it is returned with the error.
+func readZipEntry(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open FB2 file: %w", err)
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return data, fmt.Errorf("failed to read FB2 file: %w", err)
+	}
+
+	return data, nil
+}
+
+// fb2Entries returns the usable FB2 entries of an archive in archive order.
+// Entries with unsafe names and later entries with the name of an earlier
+// one are left out.
+func fb2Entries(zr *zip.Reader) []*zip.File {
+	index := zipindex.New(zr)
+	var files []*zip.File
+	for _, f := range index.Files() {
+		name := strings.ToLower(index.Name(f))
+		if !strings.HasSuffix(name, ".fb2") || f.UncompressedSize64 == 0 {
+			continue
+		}
+		if strings.HasPrefix(name, "__macosx/") || strings.Contains(name, "/__macosx/") {
+			continue
+		}
+		files = append(files, f)
+	}
+	return files
+}
+
+func listEntries(zr *zip.Reader) []ArchiveEntry {
+	files := fb2Entries(zr)
+	entries := make([]ArchiveEntry, len(files))
+	for i, f := range files {
+		entries[i] = ArchiveEntry{
+			Index: i + 1,
+			Name:  f.Name,
+			Size:  int64(f.UncompressedSize64),
+		}
+	}
+	return entries
+}
+
+// selectFB2Entry picks the entry to parse: by name or 1-based index when given,
+// otherwise the largest FB2 entry of the archive
+func selectFB2Entry(zr *zip.Reader, name string, index int) (*zip.File, error) {
+	files := fb2Entries(zr)
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no FB2 file found in archive")
+	}
+
+	if name != "" {
+		for _, f := range files {
+			if f.Name == name {
+				return f, nil
+			}
+		}
+		return nil, fmt.Errorf("FB2 entry not found in archive: %s", name)
+	}
+
+	if index > 0 {
+		if index > len(files) {
+			return nil, fmt.Errorf("FB2 entry index %d out of range (archive has %d)", index, len(files))
+		}
+		return files[index-1], nil
+	}
+
+	largest := files[0]
+	for _, f := range files[1:] {
+		if f.UncompressedSize64 > largest.UncompressedSize64 {
+			largest = f
+		}
+	}
+	return largest, nil
+}
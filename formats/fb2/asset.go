@@ -0,0 +1,110 @@
+package fb2
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/vpoluyaktov/biblio-ebook-parser/parser"
+)
+
+// ExtractAssets decodes every binary of an FB2 file (plain, zipped or
+// gzipped) into destDir, named by its id with the extension of the type its
+// bytes show. Binaries that aren't valid base64 are left out.
+func ExtractAssets(filePath, destDir string, opts parser.AssetOptions) ([]parser.AssetInfo, error) {
+	f, size, err := openFB2File(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	rc, err := openFB2Stream(f, size)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	decoder, _, err := newFB2Decoder(rc)
+	if err != nil {
+		return nil, err
+	}
+
+	var assets []parser.AssetInfo
+	names := make(map[string]bool)
+	for {
+		tok, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return assets, fmt.Errorf("failed to parse FB2: %w", err)
+		}
+
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Local == "FictionBook" {
+			continue
+		}
+		if start.Name.Local != "binary" {
+			if err := decoder.Skip(); err != nil {
+				return assets, fmt.Errorf("failed to parse FB2: %w", err)
+			}
+			continue
+		}
+
+		var binary fb2Binary
+		if err := decoder.DecodeElement(&binary, &start); err != nil {
+			return assets, fmt.Errorf("failed to parse FB2: %w", err)
+		}
+		// Base64 is a third larger than the data it holds
+		if opts.MaxSize > 0 && int64(len(binary.Data))*3/4 > opts.MaxSize+3 {
+			continue
+		}
+		data, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(binary.Data), ""))
+		if err != nil {
+			continue
+		}
+
+		mediaType := parser.ImageType(data, binary.ContentType)
+		if mediaType == "" {
+			mediaType = strings.ToLower(strings.TrimSpace(binary.ContentType))
+		}
+		if !opts.Keeps(mediaType, int64(len(data))) {
+			continue
+		}
+
+		name := assetName(binary.ID, parser.AssetExtension(data, binary.ContentType), len(assets), names)
+		written, err := parser.WriteAsset(destDir, name, data, opts)
+		if err != nil {
+			return assets, err
+		}
+		assets = append(assets, parser.AssetInfo{
+			ID:        binary.ID,
+			MediaType: mediaType,
+			Size:      int64(len(data)),
+			Path:      written,
+		})
+	}
+	return assets, nil
+}
+
+// assetName returns the file name of a binary: its id, kept flat, with ext
+// unless the id already ends in it, and a number added if taken
+func assetName(id, ext string, index int, taken map[string]bool) string {
+	base := strings.NewReplacer("/", "_", `\`, "_").Replace(strings.TrimSpace(id))
+	if base == "" || strings.Trim(base, ".") == "" {
+		base = fmt.Sprintf("binary-%d", index+1)
+	}
+	if strings.EqualFold(path.Ext(base), ext) {
+		base = strings.TrimSuffix(base, path.Ext(base))
+	}
+
+	name := base + ext
+	for n := 2; taken[strings.ToLower(name)]; n++ {
+		name = fmt.Sprintf("%s-%d%s", base, n, ext)
+	}
+	taken[strings.ToLower(name)] = true
+	return name
+}
@@ -0,0 +1,162 @@
+package fb2
+
+import (
+	"bufio"
+	"bytes"
+	"html"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// maxBinaryTag caps the bytes of a start tag kept to tell a binary element
+// and read its attributes
+const maxBinaryTag = 1024
+
+// reBinaryTag matches the start of a binary element's start tag, with or
+// without a namespace prefix
+var reBinaryTag = regexp.MustCompile(`^<(?:[\w.-]+:)?binary[\s>]`)
+
+// binaryFilter reads an FB2 document as a stream without the content of its
+// binary elements, which can be many times the size of the rest of the book
+// (e.g., a whole audiobook as MP3). The elements themselves are kept, empty.
+// Binaries that want accepts are collected and handed to found instead of
+// being dropped. It only looks for markup in the ASCII range, so the document
+// must be in UTF-8 or a single-byte encoding.
+type binaryFilter struct {
+	r       *bufio.Reader
+	state   int
+	pending []byte // Read but not yet returned
+	tag     []byte // Start of the tag being read
+
+	want    func(id, contentType string) bool
+	found   func(fb2Binary)
+	binary  *fb2Binary // Binary being collected
+	content strings.Builder
+}
+
+// States of a binaryFilter
+const (
+	inText   = iota // Character data and markup other than tags
+	inTag           // After a <, up to the closing >
+	inBinary        // Content of a binary element
+)
+
+func newBinaryFilter(r io.Reader) *binaryFilter {
+	return &binaryFilter{r: bufio.NewReader(r)}
+}
+
+// stripBinaries returns a document without the content of its binaries.
+// UTF-16 documents, whose markup can't be found byte by byte, are returned
+// as they are.
+func stripBinaries(data []byte) []byte {
+	if bytes.IndexByte(data, 0) >= 0 {
+		return data
+	}
+	stripped, _ := io.ReadAll(newBinaryFilter(bytes.NewReader(data)))
+	return stripped
+}
+
+func (f *binaryFilter) Read(p []byte) (int, error) {
+	for len(f.pending) == 0 {
+		if err := f.fill(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, f.pending)
+	f.pending = f.pending[n:]
+	return n, nil
+}
+
+// fill reads the next piece of the document into pending, which may be left
+// empty when only binary content was read
+func (f *binaryFilter) fill() error {
+	switch f.state {
+	case inText:
+		chunk, err := f.r.ReadSlice('<')
+		f.pending = chunk
+		if err == nil {
+			f.state, f.tag = inTag, append(f.tag[:0], '<')
+		}
+		return readErr(err, len(chunk))
+
+	case inTag:
+		chunk, err := f.r.ReadSlice('>')
+		f.pending = chunk
+		if len(f.tag) < maxBinaryTag {
+			f.tag = append(f.tag, chunk[:min(len(chunk), maxBinaryTag-len(f.tag))]...)
+		}
+		if err == nil {
+			f.state = inText
+			if reBinaryTag.Match(f.tag) && !bytes.HasSuffix(f.tag, []byte("/>")) {
+				f.state = inBinary
+				f.startBinary()
+			}
+		}
+		return readErr(err, len(chunk))
+
+	default:
+		chunk, err := f.r.ReadSlice('<')
+		content := chunk
+		if err == nil {
+			content = chunk[:len(chunk)-1]
+		}
+		if f.binary != nil {
+			f.content.Write(content)
+		}
+		switch err {
+		case nil:
+			f.endBinary()
+			// The < of the end tag
+			f.pending = chunk[len(chunk)-1:]
+			f.state, f.tag = inTag, append(f.tag[:0], '<')
+		case io.EOF:
+			// A document cut short in a binary
+			f.endBinary()
+			f.state = inText
+		}
+		return readErr(err, 1)
+	}
+}
+
+// startBinary starts collecting the binary just opened if want accepts it
+func (f *binaryFilter) startBinary() {
+	if f.want == nil {
+		return
+	}
+	binary := fb2Binary{}
+	for _, m := range reFB2Attr.FindAllSubmatch(f.tag, -1) {
+		value := html.UnescapeString(string(m[2]) + string(m[3]))
+		switch name := string(m[1]); name[strings.LastIndexByte(name, ':')+1:] {
+		case "id":
+			binary.ID = value
+		case "content-type":
+			binary.ContentType = value
+		}
+	}
+	if f.want(binary.ID, binary.ContentType) {
+		f.binary = &binary
+		f.content.Reset()
+	}
+}
+
+// endBinary hands the binary being collected, if any, to found
+func (f *binaryFilter) endBinary() {
+	if f.binary == nil {
+		return
+	}
+	f.binary.Data = f.content.String()
+	f.content.Reset()
+	binary := *f.binary
+	f.binary = nil
+	f.found(binary)
+}
+
+// readErr returns the error of a ReadSlice to pass on: none while a long run
+// fills the buffer, and io.EOF only once nothing was read
+func readErr(err error, n int) error {
+	if err == bufio.ErrBufferFull || (err == io.EOF && n > 0) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,104 @@
+package fb2_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/vpoluyaktov/biblio-ebook-parser/formats/fb2"
+	"github.com/vpoluyaktov/biblio-ebook-parser/parser"
+	"github.com/vpoluyaktov/biblio-ebook-parser/testutil/fb2test"
+)
+
+var coverPNG = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+// audioBook returns a book with an image in its text and, ahead of the
+// cover, an MP3 binary of size bytes
+func audioBook(size int, b *fb2test.Builder) []byte {
+	doc := string(b.
+		WithTitle("Audiobook").
+		WithSection("One", "Text before the picture.").
+		WithImage("pic", []byte("\x89PNG\r\n\x1a\npicture")).
+		WithCover(coverPNG).
+		Bytes())
+	audio := `<binary id="audio.mp3" content-type="audio/mpeg">` +
+		base64.StdEncoding.EncodeToString(bytes.Repeat([]byte("ID3\x04"), size/4)) +
+		"</binary>\n"
+	return []byte(strings.Replace(doc, `<binary id="cover"`, audio+`<binary id="cover"`, 1))
+}
+
+// parseMeasured parses a book, returning the bytes allocated while parsing
+// and those the book still holds
+func parseMeasured(t testing.TB, data []byte) (book *parser.Book, allocated, retained uint64) {
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	book, err := fb2.NewParser().ParseReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("ParseReader: %v", err)
+	}
+	runtime.ReadMemStats(&after)
+	allocated = after.TotalAlloc - before.TotalAlloc
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+	if after.HeapAlloc > before.HeapAlloc {
+		retained = after.HeapAlloc - before.HeapAlloc
+	}
+	runtime.KeepAlive(book)
+	return book, allocated, retained
+}
+
+func TestParseDropsOtherBinaries(t *testing.T) {
+	books := map[string]*fb2test.Builder{
+		"well-formed": fb2test.New(),
+		// Broken markup takes the sanitizer's second pass
+		"malformed": fb2test.New().WithInvalidTagStarts().WithSection("Sizes", "Take x <5 y."),
+	}
+	for name, b := range books {
+		t.Run(name, func(t *testing.T) {
+			data := audioBook(16<<20, b)
+			book, allocated, retained := parseMeasured(t, data)
+
+			if !bytes.Equal(book.Metadata.CoverData, coverPNG) {
+				t.Errorf("cover = %q, want %q", book.Metadata.CoverData, coverPNG)
+			}
+			var images []string
+			for _, ch := range book.Content.Chapters {
+				for _, elem := range ch.Elements {
+					if img, ok := elem.(*parser.Image); ok {
+						images = append(images, img.Href)
+					}
+				}
+			}
+			if len(images) != 1 || images[0] != "#pic" {
+				t.Errorf("images = %q, want [#pic]", images)
+			}
+
+			// Besides the copy ParseReader reads the file into, the MP3 is
+			// neither copied nor kept. The race detector's allocations
+			// count too, so only what the book holds is checked under it.
+			if extra := int64(allocated) - int64(len(data)); extra > 1<<20 && !fb2.RaceEnabled {
+				t.Errorf("parsing %d MB allocated %d KB more than the file", len(data)>>20, extra>>10)
+			}
+			if retained > 1<<20 {
+				t.Errorf("the book holds %d KB", retained>>10)
+			}
+		})
+	}
+}
+
+func BenchmarkParseHugeBinary(b *testing.B) {
+	data := audioBook(50<<20, fb2test.New())
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	var allocated uint64
+	for b.Loop() {
+		_, n, _ := parseMeasured(b, data)
+		allocated = max(allocated, n)
+	}
+	// Memory allocated while parsing as a share of the file's size, which
+	// includes the copy ParseReader reads the file into
+	b.ReportMetric(float64(allocated)/float64(len(data)), "alloc/file")
+}
@@ -1,69 +1,431 @@
 package fb2
 
 import (
+	"encoding/xml"
 	"html"
+	"io"
 	"regexp"
 	"strings"
+	"unicode"
 
 	"github.com/vpoluyaktov/biblio-ebook-parser/parser"
 )
 
-func sectionToElements(section fb2Section) []parser.Element {
+// sectionToElements converts a section to elements. Note references found in
+// paragraphs are resolved against notes and emitted as Footnote elements.
+// Only the element types the filter keeps are built. The lines of the title
+// are joined with titleSep. Paragraphs carry their markup as HTML with
+// keepHTML.
+func sectionToElements(section fb2Section, notes map[string]parser.Note, filter parser.ElementFilter, titleSep string, keepHTML bool) []parser.Element {
+	return sectionElements(section, 2, notes, filter, titleSep, keepHTML)
+}
+
+// sectionElements converts a section to elements using the given heading level for its title
+func sectionElements(section fb2Section, headingLevel int, notes map[string]parser.Note, filter parser.ElementFilter, titleSep string, keepHTML bool) []parser.Element {
 	elements := []parser.Element{}
 
 	// Add title as heading if present
 	if section.Title.Content != "" {
-		titleText := fb2XMLToText(section.Title.Content)
+		titleText := fb2TitleToText(section.Title.Content, titleSep)
 		if strings.TrimSpace(titleText) != "" {
 			elements = append(elements, &parser.Heading{
 				Text:  strings.TrimSpace(titleText),
-				Level: 2,
+				Level: headingLevel,
 			})
 		}
 	}
 
-	// Add epigraphs
-	for _, epigraph := range section.Epigraphs {
-		epigraphParas := []parser.Paragraph{}
-		for _, p := range epigraph.Paragraphs {
-			text := fb2XMLToText(p.Content)
-			if strings.TrimSpace(text) != "" {
-				epigraphParas = append(epigraphParas, parser.Paragraph{
-					Text: strings.TrimSpace(text),
-					HTML: p.Content,
-				})
-			}
+	// Add content children in document order
+	pendingEmptyLine := false
+	appendElement := func(elem parser.Element) {
+		if pendingEmptyLine && len(elements) > 0 {
+			elements = append(elements, &parser.EmptyLine{})
 		}
-		if len(epigraphParas) > 0 {
-			elements = append(elements, &parser.Epigraph{
-				Paragraphs: epigraphParas,
-			})
+		pendingEmptyLine = false
+		elements = append(elements, elem)
+	}
+
+	for _, child := range section.Children {
+		if child.Name == "empty-line" {
+			// Only kept between content, consecutive empty lines collapse into one
+			pendingEmptyLine = filter.Keeps(parser.ElementTypeEmptyLine)
+			continue
+		}
+		for _, elem := range childToElements(child, notes, filter, keepHTML) {
+			if elem.Type() == parser.ElementTypeFootnote {
+				elements = append(elements, elem)
+				continue
+			}
+			appendElement(elem)
 		}
 	}
 
-	// Add paragraphs
-	for _, p := range section.Paragraphs {
-		text := fb2XMLToText(p.Content)
-		if strings.TrimSpace(text) != "" {
-			elements = append(elements, &parser.Paragraph{
-				Text: strings.TrimSpace(text),
-				HTML: p.Content,
-			})
+	return elements
+}
+
+// childToElements converts a single section content child to elements of the
+// types the filter keeps
+func childToElements(child fb2SectionChild, notes map[string]parser.Note, filter parser.ElementFilter, keepHTML bool) []parser.Element {
+	elements := []parser.Element{}
+	keepParagraphs := filter.Keeps(parser.ElementTypeParagraph)
+	if !filter.Keeps(parser.ElementTypeFootnote) {
+		notes = nil
+	}
+
+	switch child.Name {
+	case "p":
+		if !keepParagraphs {
+			break
+		}
+		if para := paraToElement(child.Para, keepHTML); para != nil {
+			elements = append(elements, para)
+			elements = append(elements, resolveFootnotes(child.Para.Content, notes)...)
+		}
+
+	case "subtitle":
+		if text := fb2XMLToText(child.Para.Content); text != "" {
+			elements = append(elements, &parser.Heading{Text: text, Level: 3})
+		}
+
+	case "epigraph":
+		if !filter.Keeps(parser.ElementTypeEpigraph) {
+			break
+		}
+		if epigraph := epigraphToElement(child.Epigraph, keepHTML); epigraph != nil {
+			elements = append(elements, epigraph)
+		}
+
+	case "poem":
+		if title := fb2XMLToText(child.Poem.Title.Content); title != "" {
+			elements = append(elements, &parser.Heading{Text: title, Level: 3})
+		}
+		if !keepParagraphs {
+			break
+		}
+		for _, stanza := range child.Poem.Stanzas {
+			if stanzaPara := stanzaToElement(stanza, keepHTML); stanzaPara != nil {
+				elements = append(elements, stanzaPara)
+			}
+		}
+		for _, a := range child.Poem.TextAuthors {
+			if para := paraToElement(a, keepHTML); para != nil {
+				elements = append(elements, para)
+			}
+		}
+
+	case "cite":
+		if !keepParagraphs {
+			break
+		}
+		for _, p := range child.Cite.Paragraphs {
+			if para := paraToElement(p, keepHTML); para != nil {
+				elements = append(elements, para)
+				elements = append(elements, resolveFootnotes(p.Content, notes)...)
+			}
+		}
+		for _, a := range child.Cite.TextAuthors {
+			if para := paraToElement(a, keepHTML); para != nil {
+				elements = append(elements, para)
+			}
+		}
+
+	case "table":
+		if filter.Keeps(parser.ElementTypeTable) {
+			elements = append(elements, &parser.Table{})
+		}
+
+	case "image":
+		if !filter.Keeps(parser.ElementTypeImage) {
+			break
+		}
+		if href := child.Image.href(); href != "" {
+			// The title child is the caption, and the alt text if there is
+			// no better one
+			caption := strings.Join(strings.Fields(fb2XMLToText(child.Image.Caption.Content)), " ")
+			alt := strings.TrimSpace(child.Image.Alt)
+			if alt == "" {
+				alt = strings.TrimSpace(child.Image.Title)
+			}
+			if alt == "" {
+				alt = caption
+			}
+			elements = append(elements, &parser.Image{Href: href, Alt: alt, Caption: caption})
 		}
 	}
 
 	return elements
 }
 
+// paraToElement converts a paragraph, with its markup converted to HTML if
+// keepHTML is set
+func paraToElement(p fb2Para, keepHTML bool) *parser.Paragraph {
+	text, links := fb2XMLToLinkedText(p.Content)
+	if text == "" {
+		return nil
+	}
+	para := &parser.Paragraph{Text: text, Links: links}
+	if keepHTML {
+		para.HTML = "<p>" + fb2MarkupToHTML(p.Content) + "</p>"
+	}
+	return para
+}
+
+// stanzaToElement joins the verses of a stanza into one paragraph, one verse per line
+func stanzaToElement(stanza fb2Stanza, keepHTML bool) *parser.Paragraph {
+	lines := []string{}
+	markup := []string{}
+	for _, v := range stanza.Lines {
+		if text := fb2XMLToText(v.Content); text != "" {
+			lines = append(lines, text)
+			if keepHTML {
+				markup = append(markup, fb2MarkupToHTML(v.Content))
+			}
+		}
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	para := &parser.Paragraph{Text: strings.Join(lines, "\n")}
+	if keepHTML {
+		para.HTML = "<p>" + strings.Join(markup, "<br/>\n") + "</p>"
+	}
+	return para
+}
+
+func epigraphToElement(epigraph fb2Epigraph, keepHTML bool) *parser.Epigraph {
+	epigraphParas := []parser.Paragraph{}
+	for _, p := range epigraph.Paragraphs {
+		if para := paraToElement(p, keepHTML); para != nil {
+			epigraphParas = append(epigraphParas, *para)
+		}
+	}
+
+	authors := []string{}
+	for _, a := range epigraph.TextAuthors {
+		if text := fb2XMLToText(a.Content); text != "" {
+			authors = append(authors, text)
+		}
+	}
+
+	if len(epigraphParas) == 0 && len(authors) == 0 {
+		return nil
+	}
+	return &parser.Epigraph{
+		Paragraphs: epigraphParas,
+		Author:     strings.Join(authors, ", "),
+	}
+}
+
+var (
+	reFB2LinkParts = regexp.MustCompile(`(?is)<a\s([^>]*)>(.*?)</a>`)
+	reFB2Attr      = regexp.MustCompile(`([\w:.-]+)\s*=\s*(?:"([^"]*)"|'([^']*)')`)
+)
+
+// resolveFootnotes returns Footnote elements for internal links in paragraph
+// markup that point at a known note
+func resolveFootnotes(content string, notes map[string]parser.Note) []parser.Element {
+	if len(notes) == 0 {
+		return nil
+	}
+
+	var footnotes []parser.Element
+	for _, link := range reFB2LinkParts.FindAllStringSubmatch(content, -1) {
+		href, _ := linkAttrs(link[1])
+		if !strings.HasPrefix(href, "#") {
+			continue
+		}
+		note, ok := notes[strings.TrimPrefix(href, "#")]
+		if !ok {
+			continue
+		}
+		footnotes = append(footnotes, &parser.Footnote{
+			ID:       note.ID,
+			Label:    strings.TrimSpace(html.UnescapeString(reFB2Tags.ReplaceAllString(link[2], ""))),
+			Elements: note.Elements,
+		})
+	}
+	return footnotes
+}
+
+// linkAttrs returns the href (l:href or xlink:href) and type attributes of a link
+func linkAttrs(attrs string) (href, linkType string) {
+	for _, attr := range reFB2Attr.FindAllStringSubmatch(attrs, -1) {
+		name := strings.ToLower(attr[1])
+		switch {
+		case name == "href" || strings.HasSuffix(name, ":href"):
+			href = html.UnescapeString(attr[2] + attr[3])
+		case name == "type":
+			linkType = strings.ToLower(attr[2] + attr[3])
+		}
+	}
+	return href, linkType
+}
+
+var (
+	reFB2Section   = regexp.MustCompile(`(?is)<section[^>]*>.*?</section>`)
+	reFB2Table     = regexp.MustCompile(`(?i)<table[^>]*>.*?</table>`)
+	reFB2Image     = regexp.MustCompile(`(?i)<image[^>]*/?>`)
+	reFB2EmptyLine = regexp.MustCompile(`(?i)<empty-line\s*/?>`)
+	reFB2NoteMark  = regexp.MustCompile(`^[\[({]?\s*(?:\d+|\*+)\s*[\])}]?$`)
+
+	reFB2PClose     = regexp.MustCompile(`(?i)</p>`)
+	reFB2POpen      = regexp.MustCompile(`(?i)<p[^>]*>`)
+	reFB2TitleClose = regexp.MustCompile(`(?i)</title>`)
+	reFB2TitleOpen  = regexp.MustCompile(`(?i)<title[^>]*>`)
+	reFB2SubClose   = regexp.MustCompile(`(?i)</subtitle>`)
+	reFB2SubOpen    = regexp.MustCompile(`(?i)<subtitle[^>]*>`)
+
+	reFB2Tags     = regexp.MustCompile(`<[^>]+>`)
+	reFB2Spaces   = regexp.MustCompile(`[ \t]+`)
+	reFB2Newlines = regexp.MustCompile(`\n{2,}`)
+)
+
+// Private use characters marking the start and end of link text while markup
+// is converted to text
+const (
+	linkStartMark = "\uE001"
+	linkEndMark   = "\uE002"
+)
+
+// fb2TitleToText converts a title to one line: its paragraphs, often split
+// by empty lines, are joined with separator, and stray punctuation at their
+// ends is trimmed. A title that is only an image gives the image's alt or
+// title text.
+func fb2TitleToText(content, separator string) string {
+	var lines []string
+	for _, line := range strings.Split(fb2XMLToText(reFB2Image.ReplaceAllString(content, "")), "\n") {
+		if line = trimStrayPunctuation(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) > 0 {
+		return strings.Join(lines, separator)
+	}
+
+	for _, image := range reFB2Image.FindAllString(content, -1) {
+		attrs := make(map[string]string)
+		for _, m := range reFB2Attr.FindAllStringSubmatch(image, -1) {
+			attrs[strings.ToLower(m[1])] = m[2] + m[3]
+		}
+		for _, name := range []string{"alt", "title"} {
+			if text := strings.TrimSpace(html.UnescapeString(attrs[name])); text != "" {
+				return text
+			}
+		}
+	}
+	return ""
+}
+
+// trimStrayPunctuation trims the separators left at the ends of a title line,
+// such as a final period or a leading dash, and its spaces. Ellipses, and
+// question and exclamation marks are kept.
+func trimStrayPunctuation(line string) string {
+	line = strings.TrimFunc(line, func(r rune) bool {
+		return unicode.IsSpace(r) || strings.ContainsRune(",;:-–—", r)
+	})
+	if strings.HasSuffix(line, ".") && !strings.HasSuffix(line, "..") {
+		line = strings.TrimRightFunc(strings.TrimSuffix(line, "."), unicode.IsSpace)
+	}
+	if strings.HasPrefix(line, ".") && !strings.HasPrefix(line, "..") {
+		line = strings.TrimLeftFunc(strings.TrimPrefix(line, "."), unicode.IsSpace)
+	}
+	return line
+}
+
+// fb2HTMLTags maps the FB2 inline elements kept in paragraph HTML to their
+// HTML tags; the others are dropped, keeping their text
+var fb2HTMLTags = map[string]string{
+	"emphasis":      "em",
+	"strong":        "strong",
+	"strikethrough": "s",
+	"sub":           "sub",
+	"sup":           "sup",
+	"code":          "code",
+	"a":             "a",
+	"empty-line":    "br",
+}
+
+// fb2MarkupToHTML converts the inline markup of an FB2 paragraph to minimal
+// HTML: emphasis and the like become their HTML tags, links keep their href
+// and other elements only their text. Markup that can't be tokenized gives
+// its text, escaped.
+func fb2MarkupToHTML(content string) string {
+	decoder := xml.NewDecoder(strings.NewReader(content))
+	decoder.Strict = false
+	decoder.Entity = xml.HTMLEntity
+
+	var out strings.Builder
+	var open []string
+	for {
+		token, err := decoder.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return html.EscapeString(fb2XMLToText(content))
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			tag, ok := fb2HTMLTags[t.Name.Local]
+			switch {
+			case !ok:
+			case tag == "br":
+				out.WriteString("<br/>")
+			case tag == "a":
+				href := ""
+				for _, attr := range t.Attr {
+					if attr.Name.Local == "href" {
+						href = attr.Value
+					}
+				}
+				out.WriteString(`<a href="` + html.EscapeString(href) + `">`)
+				open = append(open, tag)
+			default:
+				out.WriteString("<" + tag + ">")
+				open = append(open, tag)
+			}
+		case xml.EndElement:
+			tag, ok := fb2HTMLTags[t.Name.Local]
+			if !ok || tag == "br" {
+				continue
+			}
+			// Close up to the matching tag, as the lenient decoder does
+			for i := len(open) - 1; i >= 0; i-- {
+				if open[i] == tag {
+					for j := len(open) - 1; j >= i; j-- {
+						out.WriteString("</" + open[j] + ">")
+					}
+					open = open[:i]
+					break
+				}
+			}
+		case xml.CharData:
+			out.WriteString(html.EscapeString(string(t)))
+		}
+	}
+	for i := len(open) - 1; i >= 0; i-- {
+		out.WriteString("</" + open[i] + ">")
+	}
+	return strings.TrimSpace(out.String())
+}
+
 func fb2XMLToText(xmlContent string) string {
+	text, _ := fb2XMLToLinkedText(xmlContent)
+	return text
+}
+
+// fb2XMLToLinkedText converts FB2 markup to text, keeping the text of links
+// and returning where they are. Note references are left out: notes become
+// Footnote elements.
+func fb2XMLToLinkedText(xmlContent string) (string, []parser.Link) {
 	if xmlContent == "" {
-		return ""
+		return "", nil
 	}
 
 	text := xmlContent
 
 	// Remove nested section tags
-	reFB2Section := regexp.MustCompile(`(?is)<section[^>]*>.*?</section>`)
 	for {
 		newText := reFB2Section.ReplaceAllString(text, "")
 		if newText == text {
@@ -73,24 +435,25 @@ func fb2XMLToText(xmlContent string) string {
 	}
 
 	// Handle special elements
-	reFB2Table := regexp.MustCompile(`(?i)<table[^>]*>.*?</table>`)
-	reFB2Image := regexp.MustCompile(`(?i)<image[^>]*/?>`)
-	reFB2EmptyLine := regexp.MustCompile(`(?i)<empty-line\s*/?>`)
-	reFB2Link := regexp.MustCompile(`(?is)<a[^>]*>.*?</a>`)
-
 	text = reFB2Table.ReplaceAllString(text, "\n[Table]\n")
 	text = reFB2Image.ReplaceAllString(text, "\n[Image]\n")
 	text = reFB2EmptyLine.ReplaceAllString(text, "\n")
-	text = reFB2Link.ReplaceAllString(text, "")
+	var hrefs []string
+	text = reFB2LinkParts.ReplaceAllStringFunc(text, func(link string) string {
+		parts := reFB2LinkParts.FindStringSubmatch(link)
+		href, linkType := linkAttrs(parts[1])
+		label := strings.TrimSpace(html.UnescapeString(reFB2Tags.ReplaceAllString(parts[2], "")))
+		if linkType == "note" || (strings.HasPrefix(href, "#") && reFB2NoteMark.MatchString(label)) {
+			return ""
+		}
+		if href == "" {
+			return parts[2]
+		}
+		hrefs = append(hrefs, href)
+		return linkStartMark + parts[2] + linkEndMark
+	})
 
 	// Handle paragraphs and titles
-	reFB2PClose := regexp.MustCompile(`(?i)</p>`)
-	reFB2POpen := regexp.MustCompile(`(?i)<p[^>]*>`)
-	reFB2TitleClose := regexp.MustCompile(`(?i)</title>`)
-	reFB2TitleOpen := regexp.MustCompile(`(?i)<title[^>]*>`)
-	reFB2SubClose := regexp.MustCompile(`(?i)</subtitle>`)
-	reFB2SubOpen := regexp.MustCompile(`(?i)<subtitle[^>]*>`)
-
 	text = reFB2PClose.ReplaceAllString(text, "\n")
 	text = reFB2POpen.ReplaceAllString(text, "")
 	text = reFB2TitleClose.ReplaceAllString(text, "\n")
@@ -99,18 +462,70 @@ func fb2XMLToText(xmlContent string) string {
 	text = reFB2SubOpen.ReplaceAllString(text, "\n")
 
 	// Remove remaining XML tags
-	reFB2Tags := regexp.MustCompile(`<[^>]+>`)
 	text = reFB2Tags.ReplaceAllString(text, "")
 
 	// Decode HTML entities
 	text = html.UnescapeString(text)
 
-	// Clean up whitespace
+	// Clean up whitespace and invisible hyphenation hints
+	text = parser.RemoveSoftHyphens(text)
 	text = strings.ReplaceAll(text, "\u00A0", " ")
-	reFB2Spaces := regexp.MustCompile(`[ \t]+`)
-	reFB2Newlines := regexp.MustCompile(`\n{2,}`)
 	text = reFB2Spaces.ReplaceAllString(text, " ")
 	text = reFB2Newlines.ReplaceAllString(text, "\n")
 
-	return strings.TrimSpace(text)
+	return extractLinks(strings.TrimSpace(text), hrefs)
+}
+
+// extractLinks removes the link marks from text, returning the links they
+// delimit with the given hrefs, in order
+func extractLinks(text string, hrefs []string) (string, []parser.Link) {
+	if len(hrefs) == 0 {
+		return text, nil
+	}
+
+	var out strings.Builder
+	var links []parser.Link
+	start, next := -1, 0
+	for {
+		i := strings.IndexAny(text, linkStartMark+linkEndMark)
+		if i < 0 {
+			out.WriteString(text)
+			break
+		}
+		out.WriteString(text[:i])
+		if strings.HasPrefix(text[i:], linkStartMark) {
+			start = out.Len()
+			text = text[i+len(linkStartMark):]
+			continue
+		}
+		if start >= 0 && next < len(hrefs) {
+			links = append(links, parser.Link{Start: start, End: out.Len(), Href: hrefs[next]})
+		}
+		start = -1
+		next++
+		text = text[i+len(linkEndMark):]
+	}
+
+	// Trimming may have moved the text, and links don't cover whitespace
+	result := out.String()
+	trimmed := strings.TrimSpace(result)
+	lead := len(result) - len(strings.TrimLeftFunc(result, unicode.IsSpace))
+	kept := links[:0]
+	for _, link := range links {
+		link.Start = min(max(link.Start-lead, 0), len(trimmed))
+		link.End = min(max(link.End-lead, 0), len(trimmed))
+		for link.Start < link.End && unicode.IsSpace(rune(trimmed[link.Start])) {
+			link.Start++
+		}
+		for link.End > link.Start && unicode.IsSpace(rune(trimmed[link.End-1])) {
+			link.End--
+		}
+		if link.Start < link.End {
+			kept = append(kept, link)
+		}
+	}
+	if len(kept) == 0 {
+		kept = nil
+	}
+	return trimmed, kept
 }
@@ -0,0 +1,75 @@
+package fb2
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/vpoluyaktov/biblio-ebook-parser/testutil"
+)
+
+const benchParagraph = `<p>Степан Аркадьич<a l:href="#n1" type="note">1</a> был человек <emphasis>правдивый</emphasis> в отношении к себе самому. ` +
+	`Он не мог обманывать себя и уверять себя, что <strong>раскаивается</strong> в своём поступке. ` +
+	`См. <a l:href="https://example.com/book">сайт</a>.</p>`
+
+func TestMarkupToTextAllocs(t *testing.T) {
+	if RaceEnabled {
+		t.Skip("the race detector adds allocations")
+	}
+	fb2XMLToText(benchParagraph)
+	// Compiling its regular expressions on each call would take hundreds more
+	allocs := testing.AllocsPerRun(100, func() { fb2XMLToText(benchParagraph) })
+	if allocs > 100 {
+		t.Errorf("fb2XMLToText of a paragraph takes %.0f allocations", allocs)
+	}
+}
+
+// markupCases are fragments of FB2 markup fb2XMLToText meets in paragraphs,
+// verses, titles and annotations
+var markupCases = []struct {
+	name, markup string
+}{
+	{"plain", `<p>Just text.</p>`},
+	{"inline styles", `<p>Text <emphasis>with</emphasis> <strong>styles</strong>, <strikethrough>gone</strikethrough> <code>x := 1</code> <sup>2</sup><sub>i</sub>.</p>`},
+	{"paragraphs", `<p>One.</p><p id="p2" style="x">Two.</p><P>Three.</P>`},
+	{"title and subtitle", `<title><p>Chapter</p><p>One</p></title><subtitle>Sub</subtitle><p>Text.</p>`},
+	{"empty lines", `<p>Before.</p><empty-line/><empty-line /><p>After.</p>`},
+	{"image", `<p>See</p><image l:href="#pic.png"/><p>above.</p>`},
+	{"table", `<table><tr><td>a</td><td>b</td></tr></table><p>After the table.</p>`},
+	{"nested sections", `<p>Own.</p><section><p>Nested <section><p>deeper</p></section> away.</p></section><p>Own again.</p>`},
+	{"multi-line section", "<p>Kept.</p><section>\n<p>Dropped.</p>\n</section>"},
+	{"entities", `<p>Tom &amp; Jerry &lt;3 &quot;quoted&quot; &#169; &#x2014; &nbsp;end</p>`},
+	{"whitespace", "<p>  Spaced \t out  </p>\n\n\n<p> non-breaking  spaces </p>"},
+	{"russian", `<p>Степан Аркадьич был человек <emphasis>правдивый</emphasis> в отношении к себе самому.</p>`},
+	{"unknown tags", `<p>Some <foo bar="1">unknown</foo> <style name="x">markup</style>.</p>`},
+	{"stray brackets", `<p>a > b and c</p>`},
+	{"text only", `No tags at all.`},
+	{"empty", ``},
+	{"blank", "<p> </p>\n<p></p>"},
+}
+
+// The golden file was written by fb2XMLToText as it was before its regular
+// expressions were compiled once, and holds the text of each case in turn
+func TestMarkupToTextGolden(t *testing.T) {
+	var b strings.Builder
+	for _, c := range markupCases {
+		b.WriteString("== " + c.name + " ==\n" + fb2XMLToText(c.markup) + "\n")
+	}
+	testutil.GoldenBytes(t, filepath.Join("testdata", "markup-to-text.golden.txt"), []byte(b.String()))
+}
+
+func BenchmarkFB2XMLToText(b *testing.B) {
+	b.ReportAllocs()
+	b.SetBytes(int64(len(benchParagraph)))
+	for b.Loop() {
+		fb2XMLToText(benchParagraph)
+	}
+}
+
+func BenchmarkFB2TitleToText(b *testing.B) {
+	title := `<title><p>Часть первая.</p><empty-line/><p>Глава I</p></title>`
+	b.ReportAllocs()
+	for b.Loop() {
+		fb2TitleToText(title, ". ")
+	}
+}
@@ -0,0 +1,135 @@
+package fb2
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// coverResolver picks the cover among the binaries of a document, which may be
+// offered one at a time while streaming. Coverpage images are tried in order and
+// an exact id match beats a case-insensitive one. When the document has no
+// coverpage, the first JPEG/PNG binary can optionally be used instead.
+type coverResolver struct {
+	ids                []string
+	firstImageFallback bool
+
+	rank     int // Lower is better, -1 when nothing was found yet
+	id       string
+	data     []byte
+	mimeType string
+}
+
+func newCoverResolver(desc fb2Description, firstImageFallback bool) *coverResolver {
+	c := &coverResolver{firstImageFallback: firstImageFallback, rank: -1}
+	for _, img := range desc.TitleInfo.Coverpage.Images {
+		if href := img.href(); href != "" {
+			c.ids = append(c.ids, strings.TrimPrefix(href, "#"))
+		}
+	}
+	return c
+}
+
+// enabled reports whether any binary can become the cover
+func (c *coverResolver) enabled() bool {
+	return len(c.ids) > 0 || c.firstImageFallback
+}
+
+// match returns the rank a binary with this id would get, or false if it can't be the cover
+func (c *coverResolver) match(id string) (int, bool) {
+	for i, coverID := range c.ids {
+		if id == coverID {
+			return 2 * i, true
+		}
+		if strings.EqualFold(id, coverID) {
+			return 2*i + 1, true
+		}
+	}
+	if len(c.ids) == 0 && c.firstImageFallback {
+		return 0, true
+	}
+	return 0, false
+}
+
+// wants reports whether a binary with this id could improve on the current choice
+func (c *coverResolver) wants(id string) bool {
+	rank, ok := c.match(id)
+	return ok && (c.rank < 0 || rank < c.rank)
+}
+
+// wantsBinary reports whether a binary could improve on the current choice,
+// given its content type too: looking for the first image, binaries declared
+// as something else, such as audio, are passed over rather than decoded
+func (c *coverResolver) wantsBinary(id, contentType string) bool {
+	if !c.wants(id) {
+		return false
+	}
+	if len(c.ids) > 0 {
+		return true
+	}
+	contentType = strings.ToLower(strings.TrimSpace(contentType))
+	return contentType == "" || contentType == "application/octet-stream" || strings.HasPrefix(contentType, "image/")
+}
+
+// scan offers the binaries of a document read as a stream, collecting only
+// those it wants and stopping as soon as no later one can improve on the
+// choice. Markup outside the binaries, even broken, doesn't stop it.
+func (c *coverResolver) scan(r io.Reader) error {
+	input, _, err := newFB2Reader(r)
+	if err != nil {
+		return err
+	}
+	filter := newBinaryFilter(input)
+	filter.want = c.wantsBinary
+	filter.found = c.offer
+
+	buf := make([]byte, 32*1024)
+	for !c.done() {
+		if _, err := filter.Read(buf); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return fmt.Errorf("failed to read FB2: %w", err)
+		}
+	}
+	return nil
+}
+
+// offer considers a binary as the cover
+func (c *coverResolver) offer(binary fb2Binary) {
+	if !c.wants(binary.ID) {
+		return
+	}
+	// Only real images qualify, whatever the content-type says
+	data, mimeType := decodeCoverBinary(binary)
+	if len(data) == 0 {
+		return
+	}
+	c.rank, _ = c.match(binary.ID)
+	c.id = binary.ID
+	c.data = data
+	c.mimeType = mimeType
+}
+
+// done reports whether no later binary can improve on the current choice
+func (c *coverResolver) done() bool {
+	return c.rank == 0
+}
+
+// warning describes the fallback used to find the cover, if any
+func (c *coverResolver) warning() string {
+	switch {
+	case c.rank < 0:
+		if len(c.ids) > 0 {
+			return fmt.Sprintf("cover image not found: %s", strings.Join(c.ids, ", "))
+		}
+		return ""
+	case len(c.ids) == 0:
+		return fmt.Sprintf("no coverpage, used first image binary %q as cover", c.id)
+	case c.rank%2 == 1:
+		return fmt.Sprintf("cover binary %q matched coverpage reference %q case-insensitively", c.id, c.ids[c.rank/2])
+	case c.rank > 0:
+		return fmt.Sprintf("cover image %q not found, used coverpage image %q", c.ids[0], c.id)
+	}
+	return ""
+}
@@ -0,0 +1,101 @@
+package fb2
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+
+	"github.com/vpoluyaktov/biblio-ebook-parser/internal/charset"
+)
+
+// encodingInfo describes the encoding declared by a document and the one actually used
+type encodingInfo struct {
+	Declared  string // Canonical label from the XML declaration, empty if none
+	Detected  string // Canonical label used for decoding
+	BOMLength int
+}
+
+// Warning returns a human-readable note when the detected encoding differs from
+// the declaration, or an empty string when they agree
+func (e encodingInfo) Warning() string {
+	declared := e.Declared
+	if declared == "" {
+		declared = "utf-8"
+	}
+	if declared == e.Detected {
+		return ""
+	}
+	if e.Declared == "" {
+		return fmt.Sprintf("no encoding declared, detected %s", e.Detected)
+	}
+	return fmt.Sprintf("declared encoding %s does not match content, detected %s", e.Declared, e.Detected)
+}
+
+// detectEncoding determines the encoding of an FB2 document from a sample of its
+// first bytes. A BOM wins; otherwise the declared charset is validated against the
+// content and replaced by the best-scoring candidate when it clearly doesn't fit.
+func detectEncoding(sample []byte) encodingInfo {
+	info := encodingInfo{Declared: charset.DeclaredXML(sample)}
+
+	info.Detected, info.BOMLength = charset.Detect(sample, info.Declared)
+	if info.BOMLength > 0 {
+		// Whatever the declaration says, it was written in the BOM's encoding
+		info.Declared = info.Detected
+	}
+
+	return info
+}
+
+// newFB2Decoder creates a lenient XML decoder that converts the document to UTF-8
+// using the detected encoding, regardless of what the XML declaration claims
+func newFB2Decoder(r io.Reader) (*xml.Decoder, encodingInfo, error) {
+	input, info, err := newFB2Reader(r)
+	if err != nil {
+		return nil, info, err
+	}
+	return newXMLDecoder(input), info, nil
+}
+
+// newContentDecoder creates a decoder as newFB2Decoder does for reading the
+// description and bodies: the content of binaries is left out unread, so
+// their data is never held in memory
+func newContentDecoder(r io.Reader) (*xml.Decoder, encodingInfo, error) {
+	input, info, err := newFB2Reader(r)
+	if err != nil {
+		return nil, info, err
+	}
+	return newXMLDecoder(newBinaryFilter(input)), info, nil
+}
+
+// newFB2Reader returns the document converted to UTF-8 using the detected
+// encoding
+func newFB2Reader(r io.Reader) (io.Reader, encodingInfo, error) {
+	br := bufio.NewReaderSize(r, charset.SampleSize)
+	sample, err := br.Peek(charset.SampleSize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, encodingInfo{}, fmt.Errorf("failed to read FB2: %w", err)
+	}
+
+	info := detectEncoding(sample)
+	if _, err := br.Discard(info.BOMLength); err != nil {
+		return nil, info, fmt.Errorf("failed to read FB2: %w", err)
+	}
+
+	input, err := charset.NewReader(info.Detected, br)
+	if err != nil {
+		return nil, info, err
+	}
+	return input, info, nil
+}
+
+// newXMLDecoder creates a lenient XML decoder for UTF-8 input
+func newXMLDecoder(input io.Reader) *xml.Decoder {
+	decoder := xml.NewDecoder(input)
+	// The input is already UTF-8, so ignore the declared charset
+	decoder.CharsetReader = func(label string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+	decoder.Strict = false
+	return decoder
+}
@@ -0,0 +1,89 @@
+package fb2_test
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+
+	"github.com/vpoluyaktov/biblio-ebook-parser/formats/fb2"
+	"github.com/vpoluyaktov/biblio-ebook-parser/parser"
+	"github.com/vpoluyaktov/biblio-ebook-parser/testutil/fb2test"
+)
+
+// declaring replaces the encoding a document declares, leaving its bytes as
+// they are
+func declaring(data []byte, from, to string) []byte {
+	return bytes.Replace(data, []byte(`encoding="`+from+`"`), []byte(`encoding="`+to+`"`), 1)
+}
+
+func TestLyingDeclaration(t *testing.T) {
+	book := func(encoding string) []byte {
+		return fb2test.New().
+			WithTitle("Анна Каренина").
+			WithSection("Часть первая", "Все счастливые семьи похожи друг на друга, каждая несчастливая семья несчастлива по-своему.").
+			WithEncoding(encoding).
+			Bytes()
+	}
+	tests := []struct {
+		name    string
+		data    []byte
+		warning string
+	}{
+		{
+			name:    "utf-8 declared over windows-1251",
+			data:    declaring(book("windows-1251"), "windows-1251", "utf-8"),
+			warning: "declared encoding utf-8 does not match content, detected windows-1251",
+		},
+		{
+			name:    "windows-1251 declared over utf-8",
+			data:    declaring(book("UTF-8"), "UTF-8", "windows-1251"),
+			warning: "declared encoding windows-1251 does not match content, detected utf-8",
+		},
+		{
+			name:    "windows-1251 declared over koi8-r",
+			data:    declaring(book("koi8-r"), "koi8-r", "windows-1251"),
+			warning: "declared encoding windows-1251 does not match content, detected koi8-r",
+		},
+		{
+			name:    "koi8-r undeclared",
+			data:    declaring(book("koi8-r"), "koi8-r", ""),
+			warning: "no encoding declared, detected koi8-r",
+		},
+		{
+			name: "declaration that holds",
+			data: book("windows-1251"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := fb2.NewParser().ParseReader(bytes.NewReader(tt.data), int64(len(tt.data)))
+			if err != nil {
+				t.Fatalf("ParseReader: %v", err)
+			}
+			if b.Metadata.Title != "Анна Каренина" {
+				t.Errorf("title = %q", b.Metadata.Title)
+			}
+			var texts []string
+			for _, ch := range b.Content.Chapters {
+				texts = append(texts, ch.Title)
+				for _, elem := range ch.Elements {
+					if p, ok := elem.(*parser.Paragraph); ok {
+						texts = append(texts, p.Text)
+					}
+				}
+			}
+			want := []string{"Часть первая", "Все счастливые семьи похожи друг на друга, каждая несчастливая семья несчастлива по-своему."}
+			if !slices.Equal(texts, want) {
+				t.Errorf("text = %q, want %q", texts, want)
+			}
+
+			if tt.warning == "" {
+				if len(b.Warnings) > 0 {
+					t.Errorf("warnings %q, want none", b.Warnings)
+				}
+			} else if !slices.Contains(b.Warnings, tt.warning) {
+				t.Errorf("warnings %q, want %q", b.Warnings, tt.warning)
+			}
+		})
+	}
+}
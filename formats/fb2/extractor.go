@@ -7,7 +7,11 @@ import (
 )
 
 // Extractor implements the FastExtractor interface for FB2 files
-type Extractor struct{}
+type Extractor struct {
+	// KeepRawMetadata keeps the inner XML of the description element in
+	// Metadata.Raw of extracted metadata
+	KeepRawMetadata bool
+}
 
 // ExtractCoverFromFile extracts only the cover image from an FB2 file
 func (e *Extractor) ExtractCoverFromFile(filePath string) ([]byte, string, error) {
@@ -31,10 +35,15 @@ func (e *Extractor) ExtractAnnotationFromReader(r io.ReaderAt, size int64) (stri
 
 // ExtractMetadataFromFile extracts only metadata from an FB2 file
 func (e *Extractor) ExtractMetadataFromFile(filePath string) (parser.Metadata, error) {
-	return ExtractMetadataOnly(filePath)
+	return extractMetadataOnly(filePath, e.KeepRawMetadata)
 }
 
 // ExtractMetadataFromReader extracts only metadata from an FB2 reader
 func (e *Extractor) ExtractMetadataFromReader(r io.ReaderAt, size int64) (parser.Metadata, error) {
-	return ExtractMetadataOnlyReader(r, size)
+	return extractMetadataFromReaderAt(r, size, true, e.KeepRawMetadata)
+}
+
+// ExtractAssetsFromFile writes the binaries of an FB2 file under destDir
+func (e *Extractor) ExtractAssetsFromFile(filePath, destDir string, opts parser.AssetOptions) ([]parser.AssetInfo, error) {
+	return ExtractAssets(filePath, destDir, opts)
 }
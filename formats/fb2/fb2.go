@@ -1,33 +1,68 @@
 package fb2
 
 import (
-	"archive/zip"
 	"bytes"
+	"compress/gzip"
 	"encoding/base64"
 	"encoding/xml"
 	"fmt"
 	"io"
 	"os"
+	"regexp"
 	"strconv"
 	"strings"
 
 	"github.com/vpoluyaktov/biblio-ebook-parser/parser"
-	"golang.org/x/text/encoding/charmap"
-	"golang.org/x/text/encoding/ianaindex"
-	"golang.org/x/text/encoding/unicode"
 )
 
 // Parser implements the parser.Parser interface for FB2 files
 type Parser struct {
 	TOCMaxDepth int
-	ParseNotes  bool
+	// ParseNotes collects the notes and comments bodies into Book.Notes and
+	// resolves note references in the text to Footnote elements
+	ParseNotes bool
+	// IncludeNotesAsChapters additionally keeps the notes bodies as chapters
+	IncludeNotesAsChapters bool
+	// CoverFallbackToFirstImage uses the first JPEG/PNG binary as the cover when
+	// the document has no coverpage; it may pick an interior illustration
+	CoverFallbackToFirstImage bool
+	// Strict rejects malformed documents with a *ValidationError instead of
+	// sanitizing and decoding them leniently
+	Strict bool
+	// ArchiveEntry selects the FB2 entry to parse from a .fb2.zip by name
+	ArchiveEntry string
+	// ArchiveEntryIndex selects the FB2 entry by its 1-based position in
+	// ListArchiveEntries; 0 picks the largest FB2 entry
+	ArchiveEntryIndex int
+	// DetectLanguage classifies the text to fill in a missing language, and
+	// warns when it contradicts the declared one
+	DetectLanguage bool
+	// KeepRawMetadata keeps the inner XML of the description element in
+	// Metadata.Raw
+	KeepRawMetadata bool
+	// ElementFilter selects the element types built for chapters and notes,
+	// all if nil; headings are always kept. Excluding ElementTypeFootnote
+	// keeps the notes of ParseNotes out of the text.
+	ElementFilter parser.ElementFilter
+	// TitleSeparator joins the lines of multi-line titles, such as "Part One"
+	// and its name split by an empty line; DefaultTitleSeparator if empty
+	TitleSeparator string
+	// KeepHTML keeps the markup of each paragraph in Paragraph.HTML,
+	// converted to HTML (em, strong, links and line breaks). On in
+	// NewParser; turn it off to save memory when only the text is used.
+	KeepHTML bool
 }
 
+// DefaultTitleSeparator joins the lines of multi-line titles when
+// Parser.TitleSeparator is empty
+const DefaultTitleSeparator = " — "
+
 // NewParser creates a new FB2 parser
 func NewParser() *Parser {
 	return &Parser{
 		TOCMaxDepth: 3,
 		ParseNotes:  false,
+		KeepHTML:    true,
 	}
 }
 
@@ -36,11 +71,25 @@ func init() {
 	parser.RegisterExtractor("fb2", &Extractor{})
 }
 
+// Clone returns a copy of the parser, to configure without changing p
+func (p *Parser) Clone() parser.Parser {
+	clone := *p
+	return &clone
+}
+
 // Format returns the format identifier
 func (p *Parser) Format() string {
 	return "fb2"
 }
 
+// titleSeparator returns the separator of the lines of multi-line titles
+func (p *Parser) titleSeparator() string {
+	if p.TitleSeparator != "" {
+		return p.TitleSeparator
+	}
+	return DefaultTitleSeparator
+}
+
 // Parse extracts book structure from an FB2 file
 func (p *Parser) Parse(filePath string) (*parser.Book, error) {
 	f, err := os.Open(filePath)
@@ -49,12 +98,16 @@ func (p *Parser) Parse(filePath string) (*parser.Book, error) {
 	}
 	defer f.Close()
 
-	data, err := io.ReadAll(f)
-	if err != nil {
+	// Read into a buffer of the file's size, not one grown by doubling
+	var buf bytes.Buffer
+	if info, err := f.Stat(); err == nil {
+		buf.Grow(int(info.Size()) + bytes.MinRead)
+	}
+	if _, err := buf.ReadFrom(f); err != nil {
 		return nil, fmt.Errorf("failed to read FB2: %w", err)
 	}
 
-	return p.parseFromBytes(data)
+	return p.parseFromBytes(buf.Bytes())
 }
 
 // ParseReader extracts book structure from an io.ReaderAt
@@ -70,189 +123,421 @@ func (p *Parser) ParseReader(r io.ReaderAt, size int64) (*parser.Book, error) {
 
 func (p *Parser) parseFromBytes(data []byte) (*parser.Book, error) {
 	// Check if it's a ZIP file (FB2.ZIP)
-	if len(data) > 4 && bytes.Equal(data[0:4], []byte{0x50, 0x4B, 0x03, 0x04}) {
+	if isZip(data) {
 		return p.parseFromZip(data)
 	}
 
-	// Parse FB2 XML - try with original data first to preserve charset
-	var fb2 fb2Document
-	decoder := xml.NewDecoder(bytes.NewReader(data))
-	decoder.CharsetReader = charsetReader
-	decoder.Strict = false
-
-	if err := decoder.Decode(&fb2); err != nil {
-		// If that fails, try with sanitized data
-		sanitizedData := sanitizeFB2XML(data)
-		decoder2 := xml.NewDecoder(bytes.NewReader(sanitizedData))
-		decoder2.CharsetReader = charsetReader
-		decoder2.Strict = false
+	// Check if it's a gzip file (FB2.GZ)
+	if isGzip(data) {
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to open gzip: %w", err)
+		}
+		defer gz.Close()
+		fb2Data, readErr := io.ReadAll(gz)
+		if readErr != nil && len(fb2Data) == 0 {
+			return nil, fmt.Errorf("failed to read FB2: %w", readErr)
+		}
 
-		if err2 := decoder2.Decode(&fb2); err2 != nil {
-			return nil, fmt.Errorf("failed to parse FB2: %w", err)
+		// A corrupt stream still gives the book up to the damage
+		book, err := p.parseFromBytes(fb2Data)
+		if readErr == nil {
+			return book, err
+		}
+		if book == nil {
+			return nil, fmt.Errorf("failed to read FB2: %w", readErr)
 		}
+		part := gz.Name
+		if part == "" {
+			part = "gzip stream"
+		}
+		book.AddIssue(part, readErr)
+		book.LogWarnings("fb2")
+		return book, book.Err()
 	}
 
-	book := &parser.Book{}
+	if p.Strict {
+		issues, err := validateFB2(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		if len(issues) > 0 {
+			return nil, &ValidationError{Issues: issues}
+		}
+	}
 
-	// Extract metadata
-	book.Metadata = extractMetadata(fb2)
+	// Parse FB2 XML - try with original data first to preserve charset.
+	// Binaries are read separately, only the cover among them.
+	var fb2 fb2Document
+	decoder, encoding, err := newContentDecoder(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	decoder.Strict = p.Strict
+	if log := parser.Logger(); log != nil {
+		log.Debug("FB2 charset detected", "charset", encoding.Detected, "declared", encoding.Declared)
+	}
 
-	// Extract content
-	book.Content = p.extractContent(fb2)
+	var cutPart string
+	var cutErr error
+	if err := decoder.Decode(&fb2); err != nil {
+		if p.Strict {
+			return nil, fmt.Errorf("failed to parse FB2: %w", err)
+		}
 
-	return book, nil
-}
+		// If that fails, try with sanitized data. A failed decode leaves
+		// what it read behind, so each attempt starts afresh. Binaries are
+		// stripped first so the copies only hold the text.
+		if log := parser.Logger(); log != nil {
+			log.Debug("FB2 is malformed, parsing it sanitized", "error", err)
+		}
+		sanitizedData, _ := Sanitize(stripBinaries(data), DefaultSanitizeOptions())
+		fb2 = fb2Document{}
+		err2 := decodeFB2(sanitizedData, &fb2)
+		if err2 != nil {
+			// Keep what comes before the markup that fails, such as the
+			// end of a truncated file
+			var cut []byte
+			fb2 = fb2Document{}
+			if log := parser.Logger(); log != nil {
+				log.Debug("sanitized FB2 is still malformed, parsing it up to the error", "error", err2)
+			}
+			cut, cutPart, cutErr = cutAtError(sanitizedData)
+			if cutErr == nil || decodeFB2(cut, &fb2) != nil || (len(fb2.Bodies) == 0 && fb2.Description.TitleInfo.BookTitle == "") {
+				return nil, fmt.Errorf("failed to parse FB2: %w", err)
+			}
+		}
+	}
 
-func (p *Parser) parseFromZip(data []byte) (*parser.Book, error) {
-	zipReader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
-	if err != nil {
-		return nil, fmt.Errorf("failed to open ZIP: %w", err)
+	book := &parser.Book{}
+	if warning := encoding.Warning(); warning != "" {
+		book.Warnings = append(book.Warnings, warning)
+	}
+	if cutErr != nil {
+		book.AddIssue(cutPart, fmt.Errorf("document cut short: %w", cutErr))
 	}
 
-	var fb2File *zip.File
-	for _, f := range zipReader.File {
-		if strings.HasSuffix(strings.ToLower(f.Name), ".fb2") {
-			fb2File = f
-			break
+	// Extract metadata
+	book.Metadata = metadataFromDescription(fb2.Description)
+	cover := newCoverResolver(fb2.Description, p.CoverFallbackToFirstImage)
+	if cover.enabled() {
+		if err := cover.scan(bytes.NewReader(data)); err != nil {
+			book.Warnings = append(book.Warnings, err.Error())
 		}
 	}
+	book.SetCover(cover.data, cover.mimeType)
+	if warning := cover.warning(); warning != "" {
+		book.Warnings = append(book.Warnings, warning)
+	}
+	if p.KeepRawMetadata {
+		book.Metadata.Raw = rawMetadata(fb2.Description)
+	}
 
-	if fb2File == nil {
-		return nil, fmt.Errorf("no FB2 file found in archive")
+	// Extract notes before content so references can be resolved
+	if p.ParseNotes {
+		book.Notes = extractNotes(fb2, p.ElementFilter, p.titleSeparator(), p.KeepHTML)
 	}
 
-	rc, err := fb2File.Open()
-	if err != nil {
-		return nil, fmt.Errorf("failed to open FB2 file: %w", err)
+	// Extract content
+	book.Content = p.extractContent(fb2, book.Notes)
+
+	if p.DetectLanguage {
+		book.DetectLanguage()
 	}
-	defer rc.Close()
 
-	fb2Data, err := io.ReadAll(rc)
+	book.LogWarnings("fb2")
+	return book, book.Err()
+}
+
+// decodeFB2 decodes a document leniently, as a second attempt after the
+// first one failed
+func decodeFB2(data []byte, fb2 *fb2Document) error {
+	decoder, _, err := newContentDecoder(bytes.NewReader(data))
 	if err != nil {
-		return nil, fmt.Errorf("failed to read FB2 file: %w", err)
+		return err
 	}
+	return decoder.Decode(fb2)
+}
 
-	return p.parseFromBytes(fb2Data)
+// rawMetadata returns the description block as raw metadata
+func rawMetadata(desc fb2Description) *parser.RawMetadata {
+	return &parser.RawMetadata{Format: "fb2", Data: []byte(desc.Raw)}
 }
 
-func extractMetadata(fb2 fb2Document) parser.Metadata {
+// metadataFromDescription converts the description block into metadata without the cover image
+func metadataFromDescription(desc fb2Description) parser.Metadata {
 	metadata := parser.Metadata{}
 
-	metadata.Title = strings.TrimSpace(fb2.Description.TitleInfo.BookTitle)
-	metadata.Language = strings.TrimSpace(fb2.Description.TitleInfo.Lang)
+	metadata.Title = strings.TrimSpace(desc.TitleInfo.BookTitle)
+	metadata.Language = strings.TrimSpace(desc.TitleInfo.Lang)
 
 	// Description from annotation
-	annotation := strings.Join(fb2.Description.TitleInfo.Annotation.Paragraphs, "\n\n")
-	metadata.Description = strings.TrimSpace(annotation)
+	metadata.Description = annotationToText(desc.TitleInfo.Annotation.Content)
+	metadata.DescriptionHTML = annotationToHTML(desc.TitleInfo.Annotation.Content)
 
-	// Series
-	metadata.Series = strings.TrimSpace(fb2.Description.TitleInfo.Sequence.Name)
-	metadata.SeriesIndex = parseSeriesNumber(fb2.Description.TitleInfo.Sequence.Number)
+	// Sequences: title-info first, then publisher sequences
+	collectSequences(desc.TitleInfo.Sequences, false, &metadata.Sequences)
+	collectSequences(desc.PublishInfo.Sequences, true, &metadata.Sequences)
+
+	// Series points at the first sequence for compatibility
+	if len(metadata.Sequences) > 0 {
+		metadata.Series = metadata.Sequences[0].Name
+		metadata.SeriesIndex = metadata.Sequences[0].Number
+	}
 
 	// Genres
-	metadata.Genres = fb2.Description.TitleInfo.Genres
+	metadata.Genres = desc.TitleInfo.Genres
 
 	// Author
 	author := parser.Author{
-		FirstName:  strings.TrimSpace(fb2.Description.TitleInfo.Author.FirstName),
-		LastName:   strings.TrimSpace(fb2.Description.TitleInfo.Author.LastName),
-		MiddleName: strings.TrimSpace(fb2.Description.TitleInfo.Author.MiddleName),
+		FirstName:  strings.TrimSpace(desc.TitleInfo.Author.FirstName),
+		LastName:   strings.TrimSpace(desc.TitleInfo.Author.LastName),
+		MiddleName: strings.TrimSpace(desc.TitleInfo.Author.MiddleName),
 	}
 	if !author.IsEmpty() {
 		metadata.Authors = []parser.Author{author}
 	}
 
-	// Cover image
-	var coverID string
-	for _, img := range fb2.Description.TitleInfo.Coverpage.Images {
-		href := img.Href
-		if href == "" {
-			href = img.XlinkHref
+	// Publish info
+	metadata.Publisher = strings.TrimSpace(desc.PublishInfo.Publisher)
+	metadata.PublishCity = strings.TrimSpace(desc.PublishInfo.City)
+	metadata.PublicationDate = strings.TrimSpace(desc.PublishInfo.Year)
+	metadata.PublicationTime = parser.ParseDate(metadata.PublicationDate)
+	metadata.PublicationYear = parseYear(metadata.PublicationDate)
+	if isbn := strings.TrimSpace(desc.PublishInfo.ISBN); isbn != "" {
+		metadata.Identifiers = append(metadata.Identifiers, parser.Identifier{Scheme: "isbn", Value: isbn})
+	}
+
+	metadata.DocumentInfo = documentInfoFromDescription(desc)
+	if metadata.DocumentInfo != nil {
+		// The document-info date is when the file was last made or edited
+		metadata.ModifiedDate = metadata.DocumentInfo.Date
+		metadata.ModifiedTime = parser.ParseDate(metadata.ModifiedDate)
+	}
+
+	return metadata
+}
+
+// documentInfoFromDescription converts document-info into provenance metadata, or nil if absent
+func documentInfoFromDescription(desc fb2Description) *parser.DocumentInfo {
+	src := desc.DocumentInfo
+	if src == nil {
+		return nil
+	}
+
+	info := &parser.DocumentInfo{
+		ID:          strings.TrimSpace(src.ID),
+		Version:     strings.TrimSpace(src.Version),
+		ProgramUsed: strings.TrimSpace(src.ProgramUsed),
+		SrcOCR:      strings.TrimSpace(src.SrcOCR),
+	}
+
+	info.Date = strings.TrimSpace(src.Date.Value)
+	if info.Date == "" {
+		info.Date = strings.TrimSpace(src.Date.Text)
+	}
+
+	for _, a := range src.Authors {
+		name := strings.TrimSpace(a.Nickname)
+		if name == "" {
+			name = parser.Author{
+				FirstName:  strings.TrimSpace(a.FirstName),
+				MiddleName: strings.TrimSpace(a.MiddleName),
+				LastName:   strings.TrimSpace(a.LastName),
+			}.FullName()
 		}
-		if href == "" {
-			href = img.LHref
+		if name != "" {
+			info.Authors = append(info.Authors, name)
 		}
-		if href != "" {
-			coverID = strings.TrimPrefix(href, "#")
-			break
+	}
+
+	for _, u := range src.SrcURLs {
+		if u = strings.TrimSpace(u); u != "" {
+			info.SrcURLs = append(info.SrcURLs, u)
 		}
 	}
 
-	if coverID != "" {
-		for _, binary := range fb2.Binaries {
-			if binary.ID == coverID {
-				decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(binary.Data))
-				if err == nil {
-					metadata.CoverData = decoded
-					metadata.CoverType = binary.ContentType
-					if metadata.CoverType == "" {
-						if bytes.HasPrefix(decoded, []byte{0xFF, 0xD8, 0xFF}) {
-							metadata.CoverType = "image/jpeg"
-						} else if bytes.HasPrefix(decoded, []byte{0x89, 0x50, 0x4E, 0x47}) {
-							metadata.CoverType = "image/png"
-						} else {
-							metadata.CoverType = "image/jpeg"
-						}
-					}
-				}
-				break
+	return info
+}
+
+// collectSequences flattens nested sequence elements in declaration order
+func collectSequences(sequences []fb2Sequence, publisher bool, out *[]parser.Sequence) {
+	for _, seq := range sequences {
+		if name := strings.TrimSpace(seq.Name); name != "" {
+			*out = append(*out, parser.Sequence{
+				Name:      name,
+				Number:    parseSeriesNumber(seq.Number),
+				Publisher: publisher,
+			})
+		}
+		collectSequences(seq.Sequences, publisher, out)
+	}
+}
+
+// decodeCoverBinary decodes a binary element and determines its MIME type
+// from the data, returning nothing if it is not an image
+func decodeCoverBinary(binary fb2Binary) ([]byte, string) {
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(binary.Data))
+	if err != nil {
+		return nil, ""
+	}
+	coverType := parser.ImageType(decoded, binary.ContentType)
+	if coverType == "" {
+		return nil, ""
+	}
+	return decoded, coverType
+}
+
+// extractNotes collects every section with an id from the notes and comments bodies
+func extractNotes(fb2 fb2Document, filter parser.ElementFilter, titleSep string, keepHTML bool) map[string]parser.Note {
+	notes := make(map[string]parser.Note)
+	for _, body := range fb2.Bodies {
+		if isNotesBody(body) {
+			collectNotes(body.Sections, notes, filter, titleSep, keepHTML)
+		}
+	}
+	return notes
+}
+
+func collectNotes(sections []fb2Section, notes map[string]parser.Note, filter parser.ElementFilter, titleSep string, keepHTML bool) {
+	for _, section := range sections {
+		if section.ID != "" {
+			// The note title is kept separately, so drop its heading element
+			elements := sectionToElements(section, nil, filter, titleSep, keepHTML)
+			if len(elements) > 0 && elements[0].Type() == parser.ElementTypeHeading {
+				elements = elements[1:]
+			}
+			notes[section.ID] = parser.Note{
+				ID:       section.ID,
+				Title:    fb2TitleToText(section.Title.Content, titleSep),
+				Elements: elements,
 			}
 		}
+		collectNotes(section.Sections, notes, filter, titleSep, keepHTML)
 	}
+}
 
-	return metadata
+func isNotesBody(body fb2Body) bool {
+	return body.Name == "notes" || body.Name == "comments"
+}
+
+// contentState carries chapter numbering and id bookkeeping through section traversal
+type contentState struct {
+	chapterNum int
+	notes      map[string]parser.Note
+	usedIDs    map[string]bool
+	role       string // Role of the chapters of the current body
 }
 
-func (p *Parser) extractContent(fb2 fb2Document) parser.Content {
+// chapterID returns the section id when present, made unique against earlier
+// chapters and the synthetic "section-N" scheme, or a synthetic id otherwise
+func (s *contentState) chapterID(sectionID string) string {
+	id := sectionID
+	if id == "" || s.usedIDs[id] || reSyntheticID.MatchString(id) {
+		id = fmt.Sprintf("section-%d", s.chapterNum)
+		if sectionID != "" {
+			id = fmt.Sprintf("%s-%d", sectionID, s.chapterNum)
+		}
+	}
+	s.usedIDs[id] = true
+	return id
+}
+
+var reSyntheticID = regexp.MustCompile(`^(section|body-title)-\d+$`)
+
+func (p *Parser) extractContent(fb2 fb2Document, notes map[string]parser.Note) parser.Content {
 	content := parser.Content{
-		Chapters: []parser.Chapter{},
+		Chapters:     []parser.Chapter{},
+		ChapterIndex: make(map[string]int),
 	}
 
-	chapterNum := 1
-	for _, body := range fb2.Bodies {
+	state := &contentState{
+		chapterNum: 1,
+		notes:      notes,
+		usedIDs:    make(map[string]bool),
+	}
+	for bodyIndex, body := range fb2.Bodies {
+		bodyPath := fmt.Sprintf("body[%d]", bodyIndex)
+
 		// Skip notes and comments unless configured
-		if body.Name == "notes" || body.Name == "comments" {
-			if !p.ParseNotes {
-				continue
-			}
+		if isNotesBody(body) && !(p.ParseNotes && p.IncludeNotesAsChapters) {
+			continue
+		}
+		state.role = parser.RoleChapter
+		if isNotesBody(body) {
+			state.role = parser.RoleFootnotes
 		}
 
 		// Add body title as chapter if present
 		if body.Title.Content != "" {
-			titleText := fb2XMLToText(body.Title.Content)
+			titleText := fb2TitleToText(body.Title.Content, p.titleSeparator())
 			elements := []parser.Element{
 				&parser.Heading{Text: titleText, Level: 1},
 			}
 			content.Chapters = append(content.Chapters, parser.Chapter{
-				ID:       fmt.Sprintf("body-title-%d", chapterNum),
-				Title:    titleText,
-				Level:    0,
-				Elements: elements,
+				ID:         fmt.Sprintf("body-title-%d", state.chapterNum),
+				Title:      titleText,
+				Level:      0,
+				Elements:   elements,
+				SourcePath: bodyPath + "/title",
+				Role:       state.role,
 			})
-			chapterNum++
+			state.chapterNum++
 		}
 
 		// Process sections
-		for _, section := range body.Sections {
-			p.addSections(&content, section, 0, &chapterNum)
+		for i, section := range body.Sections {
+			p.addSections(&content, section, 0, state, fmt.Sprintf("%s/section[%d]", bodyPath, i))
+		}
+	}
+
+	// Drop ids of trailing sections that never produced a chapter
+	for id, index := range content.ChapterIndex {
+		if index >= len(content.Chapters) {
+			delete(content.ChapterIndex, id)
 		}
 	}
 
 	return content
 }
 
-func (p *Parser) addSections(content *parser.Content, section fb2Section, depth int, chapterNum *int) {
+// addSections adds a chapter per section up to TOCMaxDepth. Sections nested deeper
+// don't get chapters of their own; their content is merged into the chapter of the
+// nearest ancestor at the maximum depth, with their titles as headings. The
+// path locates the section in the document, as in "body[0]/section[3]".
+//
+// FB2 allows no text next to subsections, so the FB2 writer puts a section's
+// own text in a first subsection with a "leading-text-N" id. Such a
+// subsection is merged into the section's chapter rather than becoming a
+// "Chapter N" of its own.
+func (p *Parser) addSections(content *parser.Content, section fb2Section, depth int, state *contentState, path string) {
 	depth++
-	if depth > p.TOCMaxDepth {
-		return
-	}
 
-	title := fb2XMLToText(section.Title.Content)
+	title := fb2TitleToText(section.Title.Content, p.titleSeparator())
 	if title == "" {
-		title = fmt.Sprintf("Chapter %d", *chapterNum)
+		title = fmt.Sprintf("Chapter %d", state.chapterNum)
+	}
+
+	// A section without a chapter of its own resolves to the next chapter added
+	chapterIndex := len(content.Chapters)
+	if section.ID != "" {
+		content.ChapterIndex[section.ID] = chapterIndex
 	}
 
-	elements := sectionToElements(section)
+	elements := sectionToElements(section, state.notes, p.ElementFilter, p.titleSeparator(), p.KeepHTML)
+	atMaxDepth := depth >= p.TOCMaxDepth
+	subsections := section.Sections
+	if !atMaxDepth && len(subsections) > 0 && isLeadingText(subsections[0]) {
+		elements = append(elements, sectionToElements(subsections[0], state.notes, p.ElementFilter, p.titleSeparator(), p.KeepHTML)...)
+		indexSectionIDs(subsections[0], chapterIndex, content.ChapterIndex)
+		subsections = subsections[1:]
+	}
+	if atMaxDepth {
+		for _, subsection := range section.Sections {
+			elements = append(elements, flattenSection(subsection, 3, state.notes, p.ElementFilter, p.titleSeparator(), p.KeepHTML)...)
+			indexSectionIDs(subsection, chapterIndex, content.ChapterIndex)
+		}
+	}
 
 	// Only add if has content or no nested sections
 	hasNestedSections := len(section.Sections) > 0
@@ -260,50 +545,59 @@ func (p *Parser) addSections(content *parser.Content, section fb2Section, depth
 
 	if hasContent || !hasNestedSections {
 		content.Chapters = append(content.Chapters, parser.Chapter{
-			ID:       fmt.Sprintf("section-%d", *chapterNum),
-			Title:    strings.TrimSpace(title),
-			Level:    depth - 1,
-			Elements: elements,
+			ID:           state.chapterID(section.ID),
+			Title:        strings.TrimSpace(title),
+			Level:        depth - 1,
+			Elements:     elements,
+			SourcePath:   path,
+			SourceAnchor: section.ID,
+			Role:         state.role,
 		})
-		*chapterNum++
+		state.chapterNum++
+	}
+
+	if atMaxDepth {
+		return
 	}
 
 	// Process nested sections
+	skipped := len(section.Sections) - len(subsections)
+	for i, subsection := range subsections {
+		p.addSections(content, subsection, depth, state, fmt.Sprintf("%s/section[%d]", path, skipped+i))
+	}
+}
+
+// isLeadingText reports whether a first subsection is the one the FB2 writer
+// makes for its parent's own text: marked by its id, with no title and no
+// subsections. Untitled subsections of other files stay chapters.
+func isLeadingText(section fb2Section) bool {
+	return reLeadingTextID.MatchString(section.ID) &&
+		strings.TrimSpace(section.Title.Content) == "" && len(section.Sections) == 0
+}
+
+var reLeadingTextID = regexp.MustCompile(`^leading-text-\d+$`)
+
+// indexSectionIDs maps the ids of a section and all its subsections to one chapter
+func indexSectionIDs(section fb2Section, chapterIndex int, index map[string]int) {
+	if section.ID != "" {
+		index[section.ID] = chapterIndex
+	}
 	for _, subsection := range section.Sections {
-		p.addSections(content, subsection, depth, chapterNum)
-	}
-}
-
-func charsetReader(charset string, input io.Reader) (io.Reader, error) {
-	charset = strings.ToLower(charset)
-
-	switch charset {
-	case "windows-1251":
-		return charmap.Windows1251.NewDecoder().Reader(input), nil
-	case "windows-1252":
-		return charmap.Windows1252.NewDecoder().Reader(input), nil
-	case "iso-8859-1", "latin1":
-		return charmap.ISO8859_1.NewDecoder().Reader(input), nil
-	case "koi8-r":
-		return charmap.KOI8R.NewDecoder().Reader(input), nil
-	case "koi8-u":
-		return charmap.KOI8U.NewDecoder().Reader(input), nil
-	case "utf-8", "":
-		return input, nil
-	case "utf-16", "utf-16le":
-		return unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM).NewDecoder().Reader(input), nil
-	case "utf-16be":
-		return unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM).NewDecoder().Reader(input), nil
-	default:
-		enc, err := ianaindex.IANA.Encoding(charset)
-		if err != nil {
-			return input, nil
-		}
-		if enc == nil {
-			return input, nil
-		}
-		return enc.NewDecoder().Reader(input), nil
+		indexSectionIDs(subsection, chapterIndex, index)
+	}
+}
+
+// flattenSection returns the elements of a section and all its subsections in
+// document order, with section titles as headings of increasing level
+func flattenSection(section fb2Section, headingLevel int, notes map[string]parser.Note, filter parser.ElementFilter, titleSep string, keepHTML bool) []parser.Element {
+	elements := sectionElements(section, headingLevel, notes, filter, titleSep, keepHTML)
+	if headingLevel < 6 {
+		headingLevel++
+	}
+	for _, subsection := range section.Sections {
+		elements = append(elements, flattenSection(subsection, headingLevel, notes, filter, titleSep, keepHTML)...)
 	}
+	return elements
 }
 
 func parseSeriesNumber(s string) int {
@@ -322,34 +616,78 @@ func parseSeriesNumber(s string) int {
 	return 1
 }
 
+// parseYear returns the leading four-digit year of a date string, or 0
+func parseYear(s string) int {
+	if len(s) < 4 {
+		return 0
+	}
+	year, err := strconv.Atoi(s[:4])
+	if err != nil || year <= 0 {
+		return 0
+	}
+	return year
+}
+
 // XML structures for FB2 parsing
 
 type fb2Document struct {
-	XMLName     xml.Name `xml:"http://www.gribuser.ru/xml/fictionbook/2.0 FictionBook"`
-	Description struct {
-		TitleInfo struct {
-			Author struct {
-				FirstName  string `xml:"http://www.gribuser.ru/xml/fictionbook/2.0 first-name"`
-				LastName   string `xml:"http://www.gribuser.ru/xml/fictionbook/2.0 last-name"`
-				MiddleName string `xml:"http://www.gribuser.ru/xml/fictionbook/2.0 middle-name"`
-			} `xml:"http://www.gribuser.ru/xml/fictionbook/2.0 author"`
-			BookTitle  string   `xml:"http://www.gribuser.ru/xml/fictionbook/2.0 book-title"`
-			Genres     []string `xml:"http://www.gribuser.ru/xml/fictionbook/2.0 genre"`
-			Lang       string   `xml:"http://www.gribuser.ru/xml/fictionbook/2.0 lang"`
-			Annotation struct {
-				Paragraphs []string `xml:"http://www.gribuser.ru/xml/fictionbook/2.0 p"`
-			} `xml:"http://www.gribuser.ru/xml/fictionbook/2.0 annotation"`
-			Sequence struct {
-				Name   string `xml:"name,attr"`
-				Number string `xml:"number,attr"`
-			} `xml:"http://www.gribuser.ru/xml/fictionbook/2.0 sequence"`
-			Coverpage struct {
-				Images []fb2Image `xml:"http://www.gribuser.ru/xml/fictionbook/2.0 image"`
-			} `xml:"http://www.gribuser.ru/xml/fictionbook/2.0 coverpage"`
-		} `xml:"http://www.gribuser.ru/xml/fictionbook/2.0 title-info"`
-	} `xml:"http://www.gribuser.ru/xml/fictionbook/2.0 description"`
-	Bodies   []fb2Body   `xml:"http://www.gribuser.ru/xml/fictionbook/2.0 body"`
-	Binaries []fb2Binary `xml:"http://www.gribuser.ru/xml/fictionbook/2.0 binary"`
+	XMLName     xml.Name       `xml:"http://www.gribuser.ru/xml/fictionbook/2.0 FictionBook"`
+	Description fb2Description `xml:"http://www.gribuser.ru/xml/fictionbook/2.0 description"`
+	Bodies      []fb2Body      `xml:"http://www.gribuser.ru/xml/fictionbook/2.0 body"`
+}
+
+type fb2Description struct {
+	Raw       string `xml:",innerxml"`
+	TitleInfo struct {
+		Author struct {
+			FirstName  string `xml:"http://www.gribuser.ru/xml/fictionbook/2.0 first-name"`
+			LastName   string `xml:"http://www.gribuser.ru/xml/fictionbook/2.0 last-name"`
+			MiddleName string `xml:"http://www.gribuser.ru/xml/fictionbook/2.0 middle-name"`
+		} `xml:"http://www.gribuser.ru/xml/fictionbook/2.0 author"`
+		BookTitle  string   `xml:"http://www.gribuser.ru/xml/fictionbook/2.0 book-title"`
+		Genres     []string `xml:"http://www.gribuser.ru/xml/fictionbook/2.0 genre"`
+		Lang       string   `xml:"http://www.gribuser.ru/xml/fictionbook/2.0 lang"`
+		Annotation struct {
+			Content string `xml:",innerxml"`
+		} `xml:"http://www.gribuser.ru/xml/fictionbook/2.0 annotation"`
+		Sequences []fb2Sequence `xml:"http://www.gribuser.ru/xml/fictionbook/2.0 sequence"`
+		Coverpage struct {
+			Images []fb2Image `xml:"http://www.gribuser.ru/xml/fictionbook/2.0 image"`
+		} `xml:"http://www.gribuser.ru/xml/fictionbook/2.0 coverpage"`
+	} `xml:"http://www.gribuser.ru/xml/fictionbook/2.0 title-info"`
+	PublishInfo struct {
+		BookName  string        `xml:"http://www.gribuser.ru/xml/fictionbook/2.0 book-name"`
+		Publisher string        `xml:"http://www.gribuser.ru/xml/fictionbook/2.0 publisher"`
+		City      string        `xml:"http://www.gribuser.ru/xml/fictionbook/2.0 city"`
+		Year      string        `xml:"http://www.gribuser.ru/xml/fictionbook/2.0 year"`
+		ISBN      string        `xml:"http://www.gribuser.ru/xml/fictionbook/2.0 isbn"`
+		Sequences []fb2Sequence `xml:"http://www.gribuser.ru/xml/fictionbook/2.0 sequence"`
+	} `xml:"http://www.gribuser.ru/xml/fictionbook/2.0 publish-info"`
+	DocumentInfo *fb2DocumentInfo `xml:"http://www.gribuser.ru/xml/fictionbook/2.0 document-info"`
+}
+
+type fb2Sequence struct {
+	Name      string        `xml:"name,attr"`
+	Number    string        `xml:"number,attr"`
+	Sequences []fb2Sequence `xml:"http://www.gribuser.ru/xml/fictionbook/2.0 sequence"`
+}
+
+type fb2DocumentInfo struct {
+	Authors []struct {
+		FirstName  string `xml:"http://www.gribuser.ru/xml/fictionbook/2.0 first-name"`
+		MiddleName string `xml:"http://www.gribuser.ru/xml/fictionbook/2.0 middle-name"`
+		LastName   string `xml:"http://www.gribuser.ru/xml/fictionbook/2.0 last-name"`
+		Nickname   string `xml:"http://www.gribuser.ru/xml/fictionbook/2.0 nickname"`
+	} `xml:"http://www.gribuser.ru/xml/fictionbook/2.0 author"`
+	ProgramUsed string `xml:"http://www.gribuser.ru/xml/fictionbook/2.0 program-used"`
+	Date        struct {
+		Text  string `xml:",chardata"`
+		Value string `xml:"value,attr"`
+	} `xml:"http://www.gribuser.ru/xml/fictionbook/2.0 date"`
+	SrcURLs []string `xml:"http://www.gribuser.ru/xml/fictionbook/2.0 src-url"`
+	SrcOCR  string   `xml:"http://www.gribuser.ru/xml/fictionbook/2.0 src-ocr"`
+	ID      string   `xml:"http://www.gribuser.ru/xml/fictionbook/2.0 id"`
+	Version string   `xml:"http://www.gribuser.ru/xml/fictionbook/2.0 version"`
 }
 
 type fb2Body struct {
@@ -359,10 +697,85 @@ type fb2Body struct {
 }
 
 type fb2Section struct {
-	Title      fb2Title      `xml:"http://www.gribuser.ru/xml/fictionbook/2.0 title"`
-	Paragraphs []fb2Para     `xml:"http://www.gribuser.ru/xml/fictionbook/2.0 p"`
-	Epigraphs  []fb2Epigraph `xml:"http://www.gribuser.ru/xml/fictionbook/2.0 epigraph"`
-	Sections   []fb2Section  `xml:"http://www.gribuser.ru/xml/fictionbook/2.0 section"`
+	ID       string
+	Title    fb2Title
+	Children []fb2SectionChild // Content children in document order
+	Sections []fb2Section
+}
+
+// fb2SectionChild is a content element of a section, identified by its local name
+type fb2SectionChild struct {
+	Name     string  // "p", "subtitle", "empty-line", "epigraph", "poem", "cite", "table" or "image"
+	Para     fb2Para // Inner markup of p, subtitle and table
+	Epigraph fb2Epigraph
+	Poem     fb2Poem
+	Cite     fb2Cite
+	Image    fb2Image
+}
+
+// UnmarshalXML decodes a section while preserving the order of its content children
+func (s *fb2Section) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	for _, attr := range start.Attr {
+		if attr.Name.Local == "id" {
+			s.ID = attr.Value
+		}
+	}
+
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "title":
+				if err := d.DecodeElement(&s.Title, &t); err != nil {
+					return err
+				}
+			case "section":
+				var sub fb2Section
+				if err := d.DecodeElement(&sub, &t); err != nil {
+					return err
+				}
+				s.Sections = append(s.Sections, sub)
+			default:
+				child, ok, err := decodeSectionChild(d, t)
+				if err != nil {
+					return err
+				}
+				if ok {
+					s.Children = append(s.Children, child)
+				}
+			}
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
+
+// decodeSectionChild decodes a section content element. Unknown elements are
+// skipped and reported with ok set to false.
+func decodeSectionChild(d *xml.Decoder, start xml.StartElement) (child fb2SectionChild, ok bool, err error) {
+	child.Name = start.Name.Local
+	switch child.Name {
+	case "p", "subtitle", "table":
+		err = d.DecodeElement(&child.Para, &start)
+	case "epigraph":
+		err = d.DecodeElement(&child.Epigraph, &start)
+	case "poem":
+		err = d.DecodeElement(&child.Poem, &start)
+	case "cite":
+		err = d.DecodeElement(&child.Cite, &start)
+	case "image":
+		err = d.DecodeElement(&child.Image, &start)
+	case "empty-line":
+		err = d.Skip()
+	default:
+		return child, false, d.Skip()
+	}
+	return child, err == nil, err
 }
 
 type fb2Title struct {
@@ -374,13 +787,44 @@ type fb2Para struct {
 }
 
 type fb2Epigraph struct {
-	Paragraphs []fb2Para `xml:"http://www.gribuser.ru/xml/fictionbook/2.0 p"`
+	Paragraphs  []fb2Para `xml:"http://www.gribuser.ru/xml/fictionbook/2.0 p"`
+	TextAuthors []fb2Para `xml:"http://www.gribuser.ru/xml/fictionbook/2.0 text-author"`
+}
+
+type fb2Poem struct {
+	Title       fb2Title    `xml:"http://www.gribuser.ru/xml/fictionbook/2.0 title"`
+	Stanzas     []fb2Stanza `xml:"http://www.gribuser.ru/xml/fictionbook/2.0 stanza"`
+	TextAuthors []fb2Para   `xml:"http://www.gribuser.ru/xml/fictionbook/2.0 text-author"`
+}
+
+type fb2Stanza struct {
+	Title fb2Title  `xml:"http://www.gribuser.ru/xml/fictionbook/2.0 title"`
+	Lines []fb2Para `xml:"http://www.gribuser.ru/xml/fictionbook/2.0 v"`
+}
+
+type fb2Cite struct {
+	Paragraphs  []fb2Para `xml:"http://www.gribuser.ru/xml/fictionbook/2.0 p"`
+	TextAuthors []fb2Para `xml:"http://www.gribuser.ru/xml/fictionbook/2.0 text-author"`
 }
 
 type fb2Image struct {
-	Href      string `xml:"href,attr"`
-	XlinkHref string `xml:"http://www.w3.org/1999/xlink href,attr"`
-	LHref     string `xml:"http://www.gribuser.ru/xml/fictionbook/2.0 href,attr"`
+	Href      string   `xml:"href,attr"`
+	XlinkHref string   `xml:"http://www.w3.org/1999/xlink href,attr"`
+	LHref     string   `xml:"http://www.gribuser.ru/xml/fictionbook/2.0 href,attr"`
+	Alt       string   `xml:"alt,attr"`
+	Title     string   `xml:"title,attr"`
+	Caption   fb2Title `xml:"http://www.gribuser.ru/xml/fictionbook/2.0 title"`
+}
+
+// href returns the image reference regardless of the namespace prefix used
+func (img fb2Image) href() string {
+	if img.Href != "" {
+		return img.Href
+	}
+	if img.XlinkHref != "" {
+		return img.XlinkHref
+	}
+	return img.LHref
 }
 
 type fb2Binary struct {
@@ -0,0 +1,244 @@
+package fb2
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/vpoluyaktov/biblio-ebook-parser/parser"
+)
+
+const interleavedSection = `<section xmlns="http://www.gribuser.ru/xml/fictionbook/2.0" xmlns:l="http://www.w3.org/1999/xlink" id="s1">
+<title><p>Глава</p></title>
+<epigraph><p>Первый эпиграф</p><text-author>Автор</text-author></epigraph>
+<p>Первый абзац</p>
+<poem><title><p>Песня</p></title><stanza><v>Строка один</v><v>Строка два</v></stanza></poem>
+<subtitle>Подзаголовок</subtitle>
+<p>Второй абзац</p>
+<unknown><p>Пропущено</p></unknown>
+<epigraph><p>Эпиграф в середине</p></epigraph>
+<empty-line/>
+<cite><p>Цитата</p></cite>
+<image l:href="#pic.png"/>
+<section><title><p>Вложенная</p></title><p>Вложенный текст</p></section>
+<p>Абзац после вложенной</p>
+</section>`
+
+func TestSectionKeepsChildOrder(t *testing.T) {
+	var section fb2Section
+	if err := xml.Unmarshal([]byte(interleavedSection), &section); err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, child := range section.Children {
+		names = append(names, child.Name)
+	}
+	// The nested section is apart from the children, and the unknown element
+	// is skipped
+	want := "epigraph p poem subtitle p epigraph empty-line cite image p"
+	if got := strings.Join(names, " "); got != want {
+		t.Errorf("children = %s, want %s", got, want)
+	}
+	if section.ID != "s1" || len(section.Sections) != 1 || strings.TrimSpace(section.Sections[0].Title.Content) != "<p>Вложенная</p>" {
+		t.Errorf("id %q, sections %+v", section.ID, section.Sections)
+	}
+
+	var elements []string
+	for _, elem := range sectionToElements(section, nil, nil, ". ", false) {
+		switch e := elem.(type) {
+		case *parser.Heading:
+			elements = append(elements, fmt.Sprintf("h%d %s", e.Level, e.Text))
+		case *parser.Paragraph:
+			elements = append(elements, "p "+e.Text)
+		case *parser.Epigraph:
+			elements = append(elements, "epigraph "+e.Paragraphs[0].Text)
+		case *parser.Image:
+			elements = append(elements, "image "+e.Href)
+		default:
+			elements = append(elements, fmt.Sprintf("%T", elem))
+		}
+	}
+	wantElements := []string{
+		"h2 Глава",
+		"epigraph Первый эпиграф",
+		"p Первый абзац",
+		"h3 Песня",
+		"p Строка один\nСтрока два",
+		"h3 Подзаголовок",
+		"p Второй абзац",
+		"epigraph Эпиграф в середине",
+		"*parser.EmptyLine",
+		"p Цитата",
+		"image #pic.png",
+		"p Абзац после вложенной",
+	}
+	if got := strings.Join(elements, " | "); got != strings.Join(wantElements, " | ") {
+		t.Errorf("elements:\n%s\nwant:\n%s", strings.Join(elements, "\n"), strings.Join(wantElements, "\n"))
+	}
+}
+
+const deepBook = `<?xml version="1.0" encoding="utf-8"?>
+<FictionBook xmlns="http://www.gribuser.ru/xml/fictionbook/2.0">
+<description><title-info><book-title>Deep</book-title><lang>en</lang></title-info></description>
+<body>
+<section id="l1"><title><p>Level 1</p></title>
+<section id="l2"><title><p>Level 2</p></title><p>Text two.</p>
+<section id="l3"><title><p>Level 3</p></title><p>Text three.</p>
+<section id="l4"><title><p>Level 4</p></title><p>Text four.</p><epigraph><p>Deep epigraph.</p></epigraph>
+<section id="l5"><title><p>Level 5</p></title><p>Text five.</p></section>
+</section>
+<section id="l4b"><title><p>Level 4b</p></title><p>Text four b.</p></section>
+</section>
+</section>
+<section id="l2b"><title><p>Level 2b</p></title><p>Last text.</p></section>
+</section>
+</body>
+</FictionBook>`
+
+func TestDeepSectionsFoldIntoAncestor(t *testing.T) {
+	p := NewParser()
+	p.TOCMaxDepth = 2
+	book, err := p.ParseReader(strings.NewReader(deepBook), int64(len(deepBook)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var chapters []string
+	for _, ch := range book.Content.Chapters {
+		chapters = append(chapters, fmt.Sprintf("%d %s", ch.Level, ch.Title))
+	}
+	if got, want := strings.Join(chapters, ", "), "0 Level 1, 1 Level 2, 1 Level 2b"; got != want {
+		t.Fatalf("chapters = %s, want %s", got, want)
+	}
+
+	// The sections below the maximum depth are in their ancestor's chapter,
+	// in order, their titles as headings one level deeper each
+	var elements []string
+	for _, elem := range book.Content.Chapters[1].Elements {
+		switch e := elem.(type) {
+		case *parser.Heading:
+			elements = append(elements, fmt.Sprintf("h%d %s", e.Level, e.Text))
+		case *parser.Paragraph:
+			elements = append(elements, e.Text)
+		case *parser.Epigraph:
+			elements = append(elements, "epigraph "+e.Paragraphs[0].Text)
+		}
+	}
+	want := []string{
+		"h2 Level 2", "Text two.",
+		"h3 Level 3", "Text three.",
+		"h4 Level 4", "Text four.", "epigraph Deep epigraph.",
+		"h5 Level 5", "Text five.",
+		"h4 Level 4b", "Text four b.",
+	}
+	if got := strings.Join(elements, " | "); got != strings.Join(want, " | ") {
+		t.Errorf("elements:\n%s\nwant:\n%s", strings.Join(elements, "\n"), strings.Join(want, "\n"))
+	}
+
+	// Links to the folded sections lead to the chapter holding them
+	for id, want := range map[string]int{"l1": 0, "l2": 1, "l3": 1, "l4": 1, "l5": 1, "l4b": 1, "l2b": 2} {
+		if got, ok := book.Content.ChapterIndex[id]; !ok || got != want {
+			t.Errorf("ChapterIndex[%q] = %d, %v, want %d", id, got, ok, want)
+		}
+	}
+
+	// No words are lost to the folding
+	p.TOCMaxDepth = 10
+	full, err := p.ParseReader(strings.NewReader(deepBook), int64(len(deepBook)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(full.Content.Chapters) != 7 {
+		t.Errorf("unlimited depth gives %d chapters, want 7", len(full.Content.Chapters))
+	}
+	if got, want := book.GetTotalWords(), full.GetTotalWords(); got != want {
+		t.Errorf("folded book has %d words, want %d", got, want)
+	}
+}
+
+func TestUntitledFirstSubsection(t *testing.T) {
+	doc := func(id string) string {
+		return `<?xml version="1.0" encoding="utf-8"?>
+<FictionBook xmlns="http://www.gribuser.ru/xml/fictionbook/2.0">
+<description><title-info><book-title>Parts</book-title></title-info></description>
+<body>
+<section id="part"><title><p>Part</p></title>
+<section` + id + `><p>Untitled chapter.</p></section>
+<section><title><p>Titled</p></title><p>Titled text.</p></section>
+</section>
+</body>
+</FictionBook>`
+	}
+	tests := []struct {
+		name, id, want string
+	}{
+		// An untitled first chapter of a real file is a chapter of its own
+		{"untitled", "", "0 Part: 1 words | 1 Chapter 2: 2 words | 1 Titled: 3 words"},
+		{"untitled with id", ` id="c1"`, "0 Part: 1 words | 1 Chapter 2: 2 words | 1 Titled: 3 words"},
+		// The one the FB2 writer marks holds its parent's own text
+		{"leading text", ` id="leading-text-1"`, "0 Part: 3 words | 1 Titled: 3 words"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := doc(tt.id)
+			book, err := NewParser().ParseReader(strings.NewReader(data), int64(len(data)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var chapters []string
+			for _, ch := range book.Content.Chapters {
+				words := 0
+				for _, elem := range ch.Elements {
+					words += elem.WordCount()
+				}
+				chapters = append(chapters, fmt.Sprintf("%d %s: %d words", ch.Level, ch.Title, words))
+			}
+			if got := strings.Join(chapters, " | "); got != tt.want {
+				t.Errorf("chapters = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMultiLineTitles(t *testing.T) {
+	data := fb2Doc(`<body><title><p>Лев Толстой</p><p>Война и мир</p></title>
+<section><title><p>ЧАСТЬ ПЕРВАЯ.</p><empty-line/><p><strong>Анна</strong> Павловна</p></title><p>Текст.</p>
+<section><title><p>Глава I</p>
+<p>— Салон —</p></title><p>Ещё текст.</p></section>
+</section>
+<section><title><image l:href="#t.png" alt="Эпилог"/></title><p>Конец.</p></section>
+</body>`)
+	tests := []struct {
+		separator string
+		want      []string
+	}{
+		{"", []string{"Лев Толстой — Война и мир", "ЧАСТЬ ПЕРВАЯ — Анна Павловна", "Глава I — Салон", "Эпилог"}},
+		{". ", []string{"Лев Толстой. Война и мир", "ЧАСТЬ ПЕРВАЯ. Анна Павловна", "Глава I. Салон", "Эпилог"}},
+	}
+	for _, tt := range tests {
+		p := NewParser()
+		p.TitleSeparator = tt.separator
+		book, err := p.ParseReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var titles, headings []string
+		for _, ch := range book.Content.Chapters {
+			titles = append(titles, ch.Title)
+			if h, ok := ch.Elements[0].(*parser.Heading); ok {
+				headings = append(headings, h.Text)
+			}
+		}
+		// The TOC entries, and the headings in the chapter text
+		if !slices.Equal(titles, tt.want) {
+			t.Errorf("separator %q: chapter titles %q, want %q", tt.separator, titles, tt.want)
+		}
+		if !slices.Equal(headings, tt.want) {
+			t.Errorf("separator %q: headings %q, want %q", tt.separator, headings, tt.want)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package fb2
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+
+	"github.com/vpoluyaktov/biblio-ebook-parser/parser"
+)
+
+// ExtractFingerprint computes the content fingerprint of an FB2 file without building
+// the element tree. The result matches Book.Fingerprint() for a book parsed with any TOCMaxDepth.
+func ExtractFingerprint(filePath string) (string, error) {
+	f, size, err := openFB2File(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	rc, err := openFB2Stream(f, size)
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+
+	return fingerprintFromStream(rc)
+}
+
+// ExtractFingerprintFromFile implements parser.FingerprintExtractor
+func (e *Extractor) ExtractFingerprintFromFile(filePath string) (string, error) {
+	return ExtractFingerprint(filePath)
+}
+
+// sectionText holds the paragraphs of an open section: its own, and those of
+// its subsections, which the full parser puts after all of its own
+type sectionText struct {
+	own, nested []string
+}
+
+// fingerprintFromStream streams the FB2 bodies and feeds section paragraphs to the
+// fingerprint hasher in the same order the full parser emits them: each
+// section's own text, wherever it stands among its subsections, then theirs.
+func fingerprintFromStream(r io.Reader) (string, error) {
+	decoder, _, err := newContentDecoder(r)
+	if err != nil {
+		return "", err
+	}
+
+	hasher := parser.NewFingerprintHasher()
+	var stack []string
+	inBody := false
+	skipBody := false
+	sectionDepth := 0
+	var open []*sectionText // Sections of the bodies hashed
+
+	for {
+		tok, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to parse FB2: %w", err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			name := t.Name.Local
+			switch {
+			case name == "description" || name == "binary":
+				if err := decoder.Skip(); err != nil {
+					return "", fmt.Errorf("failed to parse FB2: %w", err)
+				}
+				continue
+			case name == "body":
+				inBody = true
+				skipBody = false
+				for _, attr := range t.Attr {
+					if attr.Name.Local == "name" && (attr.Value == "notes" || attr.Value == "comments") {
+						skipBody = true
+					}
+				}
+			case name == "section" && inBody:
+				sectionDepth++
+				if !skipBody {
+					open = append(open, &sectionText{})
+				}
+			case name != "title" && inBody && !skipBody && sectionDepth > 0 &&
+				len(stack) > 0 && stack[len(stack)-1] == "section":
+				// Convert one section child at a time, exactly as the full parser does
+				child, ok, err := decodeSectionChild(decoder, t)
+				if err != nil {
+					return "", fmt.Errorf("failed to parse FB2: %w", err)
+				}
+				if ok {
+					for _, elem := range childToElements(child, nil, nil, false) {
+						if para, isPara := elem.(*parser.Paragraph); isPara && len(open) > 0 {
+							open[len(open)-1].own = append(open[len(open)-1].own, para.Text)
+						}
+					}
+				}
+				continue
+			}
+			stack = append(stack, name)
+
+		case xml.EndElement:
+			if len(stack) == 0 {
+				continue
+			}
+			name := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			switch name {
+			case "body":
+				inBody = false
+			case "section":
+				if !inBody {
+					break
+				}
+				sectionDepth--
+				if skipBody || len(open) == 0 {
+					break
+				}
+				section := open[len(open)-1]
+				open = open[:len(open)-1]
+				texts := append(section.own, section.nested...)
+				if len(open) > 0 {
+					parent := open[len(open)-1]
+					parent.nested = append(parent.nested, texts...)
+					break
+				}
+				for _, text := range texts {
+					hasher.AddParagraph(text)
+				}
+			}
+		}
+	}
+
+	return hasher.Sum(), nil
+}
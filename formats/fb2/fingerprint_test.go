@@ -0,0 +1,101 @@
+package fb2
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// fb2Doc wraps bodies in a minimal FB2 document
+func fb2Doc(bodies string) []byte {
+	return []byte(`<?xml version="1.0" encoding="utf-8"?>
+<FictionBook xmlns="http://www.gribuser.ru/xml/fictionbook/2.0" xmlns:l="http://www.w3.org/1999/xlink">
+<description><title-info><book-title>Fingerprint</book-title><lang>en</lang></title-info></description>
+` + bodies + `
+</FictionBook>`)
+}
+
+func TestFingerprintMatchesParse(t *testing.T) {
+	tests := []struct {
+		name   string
+		bodies string
+	}{
+		{
+			name: "nested with trailing text",
+			bodies: `<body><section><title><p>Part</p></title><p>x</p>
+<section><title><p>One</p></title><p>d1</p></section>
+<p>after</p>
+<section><title><p>Two</p></title><p>d2</p></section>
+<p>last</p></section></body>`,
+		},
+		{
+			name: "mixed content",
+			bodies: `<body><title><p>Book</p></title><section><title><p>One</p></title>
+<epigraph><p>Epigraph.</p><text-author>Someone</text-author></epigraph>
+<p>Text with <emphasis>emphasis</emphasis> and a note<a l:href="#n1" type="note">1</a>.</p>
+<poem><stanza><v>A verse.</v></stanza></poem>
+<cite><p>Cited.</p></cite>
+<empty-line/><subtitle>Sub</subtitle><p>More.</p></section></body>
+<body name="notes"><section id="n1"><title><p>1</p></title><p>The note.</p></section></body>`,
+		},
+		{
+			name: "deeper than any cap",
+			bodies: `<body><section><title><p>L0</p></title><p>a</p>
+<section><title><p>L1</p></title><p>b</p>
+<section><title><p>L2</p></title><p>c</p>
+<section><title><p>L3</p></title><p>d</p>
+<section><title><p>L4</p></title><p>e</p></section>
+<p>after L4</p></section>
+<p>after L3</p></section>
+<p>after L2</p></section>
+<p>after L1</p></section>
+<section><title><p>Next</p></title><p>f</p></section></body>`,
+		},
+		{
+			name: "empty titles",
+			bodies: `<body><section><p>Untitled first.</p>
+<section><title><p></p></title><p>Blank title.</p></section>
+<p>Between.</p>
+<section><p>No title.</p></section></section>
+<section><title><p> </p></title><p>Top blank.</p></section></body>`,
+		},
+		{
+			name: "leading text",
+			bodies: `<body><section><title><p>Part</p></title><epigraph><p>Motto.</p></epigraph>
+<section id="leading-text-1"><p>Opening.</p></section>
+<section><title><p>One</p></title><p>Inside.</p></section>
+<p>Closing.</p></section></body>`,
+		},
+		{
+			name:   "empty",
+			bodies: `<body><section><title><p>Only</p></title></section></body>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := fb2Doc(tt.bodies)
+			fast, err := fingerprintFromStream(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("fingerprintFromStream: %v", err)
+			}
+			for _, depth := range []int{1, 2, 3, 10} {
+				for _, notes := range []bool{false, true} {
+					p := NewParser()
+					p.TOCMaxDepth, p.ParseNotes = depth, notes
+					book, err := p.ParseReader(bytes.NewReader(data), int64(len(data)))
+					if err != nil {
+						t.Fatalf("ParseReader: %v", err)
+					}
+					if full := book.Fingerprint(); full != fast {
+						var titles []string
+						for _, ch := range book.Content.Chapters {
+							titles = append(titles, ch.Title)
+						}
+						t.Errorf("TOCMaxDepth %d, ParseNotes %v: fingerprint %s, streamed %s; chapters %q",
+							depth, notes, full, fast, strings.Join(titles, ", "))
+					}
+				}
+			}
+		})
+	}
+}
@@ -1,7 +1,9 @@
 package fb2
 
 import (
+	"archive/zip"
 	"bytes"
+	"compress/gzip"
 	"encoding/xml"
 	"fmt"
 	"io"
@@ -13,122 +15,206 @@ import (
 // ExtractCoverOnly extracts only the cover image from an FB2 file without parsing the full content.
 // This is much faster than Parse() when you only need the cover.
 func ExtractCoverOnly(filePath string) ([]byte, string, error) {
-	f, err := os.Open(filePath)
+	f, size, err := openFB2File(filePath)
 	if err != nil {
-		return nil, "", fmt.Errorf("failed to open file: %w", err)
+		return nil, "", err
 	}
 	defer f.Close()
 
-	data, err := io.ReadAll(f)
-	if err != nil {
-		return nil, "", fmt.Errorf("failed to read FB2: %w", err)
-	}
-
-	return extractCoverFromBytes(data)
+	return ExtractCoverOnlyReader(f, size)
 }
 
 // ExtractCoverOnlyReader extracts only the cover image from an FB2 reader without parsing the full content.
 func ExtractCoverOnlyReader(r io.ReaderAt, size int64) ([]byte, string, error) {
-	data := make([]byte, size)
-	_, err := r.ReadAt(data, 0)
+	metadata, err := extractMetadataFromReaderAt(r, size, true, false)
 	if err != nil {
-		return nil, "", fmt.Errorf("failed to read FB2: %w", err)
+		return nil, "", err
 	}
-
-	return extractCoverFromBytes(data)
+	return metadata.CoverData, metadata.CoverType, nil
 }
 
 // ExtractAnnotationOnly extracts only the description/annotation from an FB2 file without parsing the full content.
 func ExtractAnnotationOnly(filePath string) (string, error) {
-	f, err := os.Open(filePath)
+	f, size, err := openFB2File(filePath)
 	if err != nil {
-		return "", fmt.Errorf("failed to open file: %w", err)
+		return "", err
 	}
 	defer f.Close()
 
-	data, err := io.ReadAll(f)
-	if err != nil {
-		return "", fmt.Errorf("failed to read FB2: %w", err)
-	}
-
-	return extractAnnotationFromBytes(data)
+	return ExtractAnnotationOnlyReader(f, size)
 }
 
 // ExtractAnnotationOnlyReader extracts only the description/annotation from an FB2 reader without parsing the full content.
 func ExtractAnnotationOnlyReader(r io.ReaderAt, size int64) (string, error) {
-	data := make([]byte, size)
-	_, err := r.ReadAt(data, 0)
+	metadata, err := extractMetadataFromReaderAt(r, size, false, false)
 	if err != nil {
-		return "", fmt.Errorf("failed to read FB2: %w", err)
+		return "", err
 	}
-
-	return extractAnnotationFromBytes(data)
+	return metadata.Description, nil
 }
 
 // ExtractMetadataOnly extracts only metadata from an FB2 file without parsing the full content.
 func ExtractMetadataOnly(filePath string) (parser.Metadata, error) {
-	f, err := os.Open(filePath)
+	return extractMetadataOnly(filePath, false)
+}
+
+// ExtractMetadataOnlyReader extracts only metadata from an FB2 reader without parsing the full content.
+func ExtractMetadataOnlyReader(r io.ReaderAt, size int64) (parser.Metadata, error) {
+	return extractMetadataFromReaderAt(r, size, true, false)
+}
+
+func extractMetadataOnly(filePath string, keepRaw bool) (parser.Metadata, error) {
+	f, size, err := openFB2File(filePath)
 	if err != nil {
-		return parser.Metadata{}, fmt.Errorf("failed to open file: %w", err)
+		return parser.Metadata{}, err
 	}
 	defer f.Close()
 
-	data, err := io.ReadAll(f)
+	return extractMetadataFromReaderAt(f, size, true, keepRaw)
+}
+
+func openFB2File(filePath string) (*os.File, int64, error) {
+	f, err := os.Open(filePath)
 	if err != nil {
-		return parser.Metadata{}, fmt.Errorf("failed to read FB2: %w", err)
+		return nil, 0, fmt.Errorf("failed to open file: %w", err)
 	}
 
-	return extractMetadataFromBytes(data)
-}
-
-// ExtractMetadataOnlyReader extracts only metadata from an FB2 reader without parsing the full content.
-func ExtractMetadataOnlyReader(r io.ReaderAt, size int64) (parser.Metadata, error) {
-	data := make([]byte, size)
-	_, err := r.ReadAt(data, 0)
+	stat, err := f.Stat()
 	if err != nil {
-		return parser.Metadata{}, fmt.Errorf("failed to read FB2: %w", err)
+		f.Close()
+		return nil, 0, err
 	}
 
-	return extractMetadataFromBytes(data)
+	return f, stat.Size(), nil
 }
 
-func extractCoverFromBytes(data []byte) ([]byte, string, error) {
-	var doc fb2Document
-	decoder := xml.NewDecoder(bytes.NewReader(data))
-	decoder.CharsetReader = charsetReader
-	decoder.Strict = false
+// openFB2Stream returns a reader over the FB2 XML. ZIP archives (the largest .fb2 entry)
+// and gzip files are decompressed as a stream, so callers that stop early never
+// decompress the rest.
+func openFB2Stream(r io.ReaderAt, size int64) (io.ReadCloser, error) {
+	signature := make([]byte, 4)
+	n, _ := r.ReadAt(signature, 0)
+	signature = signature[:n]
+
+	if isGzip(signature) {
+		gz, err := gzip.NewReader(io.NewSectionReader(r, 0, size))
+		if err != nil {
+			return nil, fmt.Errorf("failed to open gzip: %w", err)
+		}
+		return gz, nil
+	}
 
-	if err := decoder.Decode(&doc); err != nil {
-		return nil, "", fmt.Errorf("failed to parse FB2: %w", err)
+	if n == 4 && bytes.Equal(signature, []byte{0x50, 0x4B, 0x03, 0x04}) {
+		zipReader, err := zip.NewReader(r, size)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open ZIP: %w", err)
+		}
+		fb2File, err := selectFB2Entry(zipReader, "", 0)
+		if err != nil {
+			return nil, err
+		}
+		rc, err := fb2File.Open()
+		if err != nil {
+			return nil, fmt.Errorf("failed to open FB2 file: %w", err)
+		}
+		return rc, nil
 	}
 
-	metadata := extractMetadata(doc)
-	return metadata.CoverData, metadata.CoverType, nil
+	return io.NopCloser(io.NewSectionReader(r, 0, size)), nil
 }
 
-func extractAnnotationFromBytes(data []byte) (string, error) {
-	var doc fb2Document
-	decoder := xml.NewDecoder(bytes.NewReader(data))
-	decoder.CharsetReader = charsetReader
-	decoder.Strict = false
-
-	if err := decoder.Decode(&doc); err != nil {
-		return "", fmt.Errorf("failed to parse FB2: %w", err)
+func extractMetadataFromReaderAt(r io.ReaderAt, size int64, withCover, keepRaw bool) (parser.Metadata, error) {
+	rc, err := openFB2Stream(r, size)
+	if err != nil {
+		return parser.Metadata{}, err
 	}
+	defer rc.Close()
 
-	metadata := extractMetadata(doc)
-	return metadata.Description, nil
+	return extractMetadataFromStream(rc, withCover, keepRaw)
 }
 
-func extractMetadataFromBytes(data []byte) (parser.Metadata, error) {
-	var doc fb2Document
-	decoder := xml.NewDecoder(bytes.NewReader(data))
-	decoder.CharsetReader = charsetReader
-	decoder.Strict = false
+// extractMetadataFromStream reads metadata with an xml.Decoder token stream and stops
+// as soon as it has what it needs: right after the description block, or, when the
+// cover is requested and the coverpage references an image, right after the matching
+// binary element. Body sections and unrelated binaries are skipped without decoding.
+func extractMetadataFromStream(r io.Reader, withCover, keepRaw bool) (parser.Metadata, error) {
+	decoder, _, err := newFB2Decoder(r)
+	if err != nil {
+		return parser.Metadata{}, err
+	}
 
-	if err := decoder.Decode(&doc); err != nil {
-		return parser.Metadata{}, fmt.Errorf("failed to parse FB2: %w", err)
+	var metadata parser.Metadata
+	var cover *coverResolver
+	seenDescription := false
+
+	for {
+		tok, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return parser.Metadata{}, fmt.Errorf("failed to parse FB2: %w", err)
+		}
+
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		switch start.Name.Local {
+		case "FictionBook":
+			// Descend into the root element
+		case "description":
+			var desc fb2Description
+			if err := decoder.DecodeElement(&desc, &start); err != nil {
+				return parser.Metadata{}, fmt.Errorf("failed to parse FB2: %w", err)
+			}
+			metadata = metadataFromDescription(desc)
+			if keepRaw {
+				metadata.Raw = rawMetadata(desc)
+			}
+			seenDescription = true
+			cover = newCoverResolver(desc, false)
+			if !withCover || !cover.enabled() {
+				return metadata, nil
+			}
+		case "binary":
+			if cover == nil || !cover.wants(binaryID(start)) {
+				if err := decoder.Skip(); err != nil {
+					return parser.Metadata{}, fmt.Errorf("failed to parse FB2: %w", err)
+				}
+				continue
+			}
+			var binary fb2Binary
+			if err := decoder.DecodeElement(&binary, &start); err != nil {
+				return parser.Metadata{}, fmt.Errorf("failed to parse FB2: %w", err)
+			}
+			cover.offer(binary)
+			if cover.done() {
+				metadata.SetCover(cover.data, cover.mimeType)
+				return metadata, nil
+			}
+		default:
+			if err := decoder.Skip(); err != nil {
+				return parser.Metadata{}, fmt.Errorf("failed to parse FB2: %w", err)
+			}
+		}
 	}
 
-	return extractMetadata(doc), nil
+	if !seenDescription {
+		return parser.Metadata{}, fmt.Errorf("failed to parse FB2: description not found")
+	}
+	if cover != nil {
+		metadata.SetCover(cover.data, cover.mimeType)
+	}
+	return metadata, nil
+}
+
+func binaryID(start xml.StartElement) string {
+	for _, attr := range start.Attr {
+		if attr.Name.Local == "id" {
+			return attr.Value
+		}
+	}
+	return ""
 }
@@ -0,0 +1,142 @@
+package fb2_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/vpoluyaktov/biblio-ebook-parser/formats/fb2"
+	"github.com/vpoluyaktov/biblio-ebook-parser/testutil/fb2test"
+)
+
+var errPastDescription = errors.New("read past the description")
+
+// descriptionReader serves a document only up to limit, failing the reads
+// past it, so a scan that reads the body fails
+type descriptionReader struct {
+	data  []byte
+	limit int64
+}
+
+func (r *descriptionReader) ReadAt(p []byte, off int64) (int, error) {
+	if off >= r.limit {
+		return 0, errPastDescription
+	}
+	n := copy(p, r.data[off:min(r.limit, int64(len(r.data)))])
+	if n < len(p) {
+		if off+int64(n) >= int64(len(r.data)) {
+			return n, io.EOF
+		}
+		return n, errPastDescription
+	}
+	return n, nil
+}
+
+// bigBook returns an FB2 of about a megabyte, nearly all of it body, and a
+// reader of it that fails past the description and the buffers of the scan
+func bigBook(t *testing.T, b *fb2test.Builder) *descriptionReader {
+	t.Helper()
+	paragraphs := make([]string, 20000)
+	for i := range paragraphs {
+		paragraphs[i] = fmt.Sprintf("Paragraph %d of the body, which the scan must not read.", i)
+	}
+	data := b.WithSection("One", paragraphs...).Bytes()
+
+	end := bytes.Index(data, []byte("</description>"))
+	if end < 0 {
+		t.Fatal("no </description>")
+	}
+	// The encoding sniffer and the XML decoder read ahead in buffers of up
+	// to 8 KB
+	limit := int64(end + len("</description>") + 16<<10)
+	if limit > int64(len(data))/10 {
+		t.Fatalf("the description ends at %d of %d bytes", end, len(data))
+	}
+	return &descriptionReader{data: data, limit: limit}
+}
+
+func TestMetadataScanStopsAtDescription(t *testing.T) {
+	r := bigBook(t, fb2test.New().
+		WithTitle("Scan").
+		WithAuthor("Jane Doe").
+		WithAnnotation("Only the description is read."))
+
+	metadata, err := fb2.ExtractMetadataOnlyReader(r, int64(len(r.data)))
+	if err != nil {
+		t.Fatalf("ExtractMetadataOnlyReader: %v", err)
+	}
+	if metadata.Title != "Scan" || len(metadata.Authors) != 1 || metadata.Description != "Only the description is read." {
+		t.Errorf("metadata = %q by %+v: %q", metadata.Title, metadata.Authors, metadata.Description)
+	}
+
+	// Check the reader: it fails a full read
+	if _, err := io.ReadAll(io.NewSectionReader(r, 0, int64(len(r.data)))); !errors.Is(err, errPastDescription) {
+		t.Errorf("reading the whole document: %v, want %v", err, errPastDescription)
+	}
+}
+
+func TestAnnotationScanSkipsCover(t *testing.T) {
+	// The cover binary is at the end, past the body, and not needed
+	r := bigBook(t, fb2test.New().
+		WithAnnotation("About the book.").
+		WithCover([]byte("\x89PNG\r\n\x1a\n")))
+
+	annotation, err := fb2.ExtractAnnotationOnlyReader(r, int64(len(r.data)))
+	if err != nil {
+		t.Fatalf("ExtractAnnotationOnlyReader: %v", err)
+	}
+	if !strings.Contains(annotation, "About the book.") {
+		t.Errorf("annotation = %q", annotation)
+	}
+}
+
+func BenchmarkExtractMetadata(b *testing.B) {
+	// A few megabytes of text, and a 4 MB cover written after the body
+	builder := fb2test.New().
+		WithTitle("Benchmark").
+		WithAuthor("Jane Doe").
+		WithAnnotation("A book to measure the metadata scan against a full parse.").
+		WithCover(append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte("cover"), 4<<20/5)...))
+	for i := range 200 {
+		paragraphs := make([]string, 100)
+		for j := range paragraphs {
+			paragraphs[j] = fmt.Sprintf("Paragraph %d of chapter %d, with text enough to fill a line or two of the page.", j, i)
+		}
+		builder.WithSection(fmt.Sprintf("Chapter %d", i+1), paragraphs...)
+	}
+	data := builder.Bytes()
+	r := bytes.NewReader(data)
+
+	b.Run("stream", func(b *testing.B) {
+		b.SetBytes(int64(len(data)))
+		b.ReportAllocs()
+		for b.Loop() {
+			metadata, err := fb2.ExtractMetadataOnlyReader(r, int64(len(data)))
+			if err != nil || len(metadata.CoverData) < 4<<20 {
+				b.Fatalf("ExtractMetadataOnlyReader: %d bytes of cover, %v", len(metadata.CoverData), err)
+			}
+		}
+	})
+	b.Run("stream without cover", func(b *testing.B) {
+		b.SetBytes(int64(len(data)))
+		b.ReportAllocs()
+		for b.Loop() {
+			if _, err := fb2.ExtractAnnotationOnlyReader(r, int64(len(data))); err != nil {
+				b.Fatalf("ExtractAnnotationOnlyReader: %v", err)
+			}
+		}
+	})
+	b.Run("full parse", func(b *testing.B) {
+		b.SetBytes(int64(len(data)))
+		b.ReportAllocs()
+		for b.Loop() {
+			book, err := fb2.NewParser().ParseReader(r, int64(len(data)))
+			if err != nil || len(book.Metadata.CoverData) < 4<<20 {
+				b.Fatalf("ParseReader: %v", err)
+			}
+		}
+	})
+}
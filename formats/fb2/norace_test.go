@@ -0,0 +1,7 @@
+//go:build !race
+
+package fb2
+
+// RaceEnabled reports whether the tests run with the race detector, under
+// which code allocates more than it does in a build
+const RaceEnabled = false
@@ -1,38 +1,177 @@
 package fb2
 
-import "regexp"
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
 
-func sanitizeFB2XML(data []byte) []byte {
-	// Don't do any sanitization for now - let XML decoder handle everything
-	// including charset conversion via charsetReader
-	return data
+// verbatimSpans are markup constructs whose content must never be rewritten
+var verbatimSpans = []struct {
+	open, close []byte
+}{
+	{[]byte("<![CDATA["), []byte("]]>")},
+	{[]byte("<!--"), []byte("-->")},
+	{[]byte("<?"), []byte("?>")},
 }
 
-func fixUnescapedAmpersands(data []byte) []byte {
-	result := make([]byte, 0, len(data))
-	i := 0
-	for i < len(data) {
-		if data[i] == '&' {
-			// Check if this is a valid entity - work with bytes directly
-			// to avoid charset corruption from string conversion
-			remaining := data[i:]
-			if isValidEntity(remaining) {
-				// Valid entity, keep as-is
-				result = append(result, data[i])
-			} else {
-				// Invalid/unescaped ampersand, escape it
-				result = append(result, []byte("&amp;")...)
+// Kinds of fixes Sanitize makes
+const (
+	FixInvalidUTF8  = "invalid-utf8"  // A byte not part of valid UTF-8, replaced with U+FFFD
+	FixIllegalChar  = "illegal-char"  // A control character XML doesn't allow, dropped
+	FixAmpersand    = "ampersand"     // An "&" not starting an entity, escaped
+	FixMalformedTag = "malformed-tag" // A "<" not starting a tag (e.g., "<5" or "<..."), escaped
+)
+
+// SanitizeOptions selects the fixes Sanitize makes
+type SanitizeOptions struct {
+	// RepairUTF8 replaces bytes that aren't valid UTF-8 with U+FFFD. Only
+	// for UTF-8 input, as it would destroy text in legacy charsets.
+	RepairUTF8    bool
+	IllegalChars  bool // Drop control characters other than tab, newline and carriage return
+	Ampersands    bool // Escape "&" not starting an entity
+	MalformedTags bool // Escape "<" not starting a tag, end tag, comment or declaration
+}
+
+// DefaultSanitizeOptions returns the fixes the parser makes to an FB2 it
+// fails to decode: all but RepairUTF8, as FB2s come in legacy charsets too
+func DefaultSanitizeOptions() SanitizeOptions {
+	return SanitizeOptions{IllegalChars: true, Ampersands: true, MalformedTags: true}
+}
+
+// SanitizeFix is a change Sanitize made
+type SanitizeFix struct {
+	Kind   string // One of the Fix constants
+	Offset int    // Byte offset in the input
+}
+
+// SanitizeReport tells what Sanitize changed
+type SanitizeReport struct {
+	Fixes []SanitizeFix // In input order
+
+	// UTF16 is set when the input has NUL bytes, as UTF-16 does, and was
+	// left as it is, as byte-level fixes would corrupt it
+	UTF16 bool
+}
+
+// Count returns the number of fixes of a kind
+func (r SanitizeReport) Count(kind string) int {
+	n := 0
+	for _, fix := range r.Fixes {
+		if fix.Kind == kind {
+			n++
+		}
+	}
+	return n
+}
+
+// Changed reports whether Sanitize changed anything
+func (r SanitizeReport) Changed() bool {
+	return len(r.Fixes) > 0
+}
+
+// Sanitize fixes the common faults of hand-made and converted XML that make
+// a parser reject it: stray ampersands and angle brackets in character data,
+// control characters and invalid UTF-8, as the options select. CDATA
+// sections, comments and processing instructions are only cleaned of
+// control characters and invalid UTF-8. The parser sanitizes an FB2 it fails
+// to decode with DefaultSanitizeOptions. The input is not modified.
+func Sanitize(data []byte, opts SanitizeOptions) ([]byte, SanitizeReport) {
+	var report SanitizeReport
+
+	// Byte-level fixes would corrupt UTF-16 documents
+	if bytes.IndexByte(data, 0) >= 0 {
+		report.UTF16 = true
+		return data, report
+	}
+
+	result := make([]byte, 0, len(data)+len(data)/64)
+	offset := 0
+	for offset < len(data) {
+		start, end := nextVerbatimSpan(data[offset:])
+		result = sanitizeSpan(result, data, offset, offset+start, opts, true, &report)
+		result = sanitizeSpan(result, data, offset+start, offset+end, opts, false, &report)
+		offset += end
+	}
+	return result, report
+}
+
+// sanitizeSpan appends data[start:end] to result with the fixes made,
+// escaping ampersands and angle brackets only in markup
+func sanitizeSpan(result, data []byte, start, end int, opts SanitizeOptions, markup bool, report *SanitizeReport) []byte {
+	for i := start; i < end; {
+		c := data[i]
+		switch {
+		case c < 0x20 && c != '\t' && c != '\n' && c != '\r' && opts.IllegalChars:
+			report.Fixes = append(report.Fixes, SanitizeFix{Kind: FixIllegalChar, Offset: i})
+			i++
+			continue
+		case c == '&' && markup && opts.Ampersands && !isValidEntity(data[i:end]):
+			report.Fixes = append(report.Fixes, SanitizeFix{Kind: FixAmpersand, Offset: i})
+			result = append(result, "&amp;"...)
+			i++
+			continue
+		case c == '<' && markup && opts.MalformedTags && !isTagStart(data[i+1:end]):
+			report.Fixes = append(report.Fixes, SanitizeFix{Kind: FixMalformedTag, Offset: i})
+			result = append(result, "&lt;"...)
+			i++
+			continue
+		case c >= utf8.RuneSelf && opts.RepairUTF8:
+			r, size := utf8.DecodeRune(data[i:end])
+			if r == utf8.RuneError && size == 1 {
+				report.Fixes = append(report.Fixes, SanitizeFix{Kind: FixInvalidUTF8, Offset: i})
+				result = utf8.AppendRune(result, utf8.RuneError)
 				i++
 				continue
 			}
-		} else {
-			result = append(result, data[i])
+			result = append(result, data[i:i+size]...)
+			i += size
+			continue
 		}
+		result = append(result, c)
 		i++
 	}
 	return result
 }
 
+// nextVerbatimSpan returns the bounds of the first CDATA section, comment or
+// processing instruction in data, or an empty span at the end when there is none.
+// An unterminated span extends to the end of data.
+func nextVerbatimSpan(data []byte) (int, int) {
+	for i := bytes.IndexByte(data, '<'); i >= 0; {
+		for _, span := range verbatimSpans {
+			if !bytes.HasPrefix(data[i:], span.open) {
+				continue
+			}
+			end := bytes.Index(data[i+len(span.open):], span.close)
+			if end < 0 {
+				return i, len(data)
+			}
+			return i, i + len(span.open) + end + len(span.close)
+		}
+		next := bytes.IndexByte(data[i+1:], '<')
+		if next < 0 {
+			break
+		}
+		i += 1 + next
+	}
+	return len(data), len(data)
+}
+
+// isTagStart reports whether the bytes after a "<" can start a tag: a
+// letter, "/", "!", "?" or "_"
+func isTagStart(data []byte) bool {
+	if len(data) == 0 {
+		return false
+	}
+	c := data[0]
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '/' || c == '!' || c == '?' || c == '_'
+}
+
 // isValidEntity checks if bytes start with a valid XML entity (ASCII-only check)
 func isValidEntity(data []byte) bool {
 	if len(data) < 4 {
@@ -73,41 +212,78 @@ func isValidEntity(data []byte) bool {
 	return false
 }
 
-func fixMalformedTags(data []byte) []byte {
-	// Fix tags starting with numbers, dots, or dashes
-	reInvalidTagStart := regexp.MustCompile(`<([0-9]|\.\.\.|--?[^a-zA-Z>])`)
-	data = reInvalidTagStart.ReplaceAllFunc(data, func(match []byte) []byte {
-		return append([]byte("&lt;"), match[1:]...)
-	})
-
-	// Fix unescaped < followed by non-ASCII characters
-	result := make([]byte, 0, len(data))
-	i := 0
-	for i < len(data) {
-		if data[i] == '<' {
-			// Check if this is a valid XML tag start
-			if i+1 >= len(data) {
-				// Bare < at end of file
-				result = append(result, []byte("&lt;")...)
-				i++
-				continue
+// cutAtError cuts a document the tokenizer fails on, such as one truncated
+// by a broken download, before the failing markup and closes the elements
+// left open, so the content before the damage can still be read. Returns the
+// path of the innermost section open at the cut (e.g., "body[0]/section[3]")
+// and the failure, or a nil error if the document is whole.
+func cutAtError(data []byte) ([]byte, string, error) {
+	// Offsets into UTF-16 documents would need decoding first
+	if bytes.IndexByte(data, 0) >= 0 {
+		return nil, "", nil
+	}
+
+	type openElement struct {
+		name   string // Qualified name as written
+		local  string
+		index  int            // Position among the siblings of the same name
+		counts map[string]int // Children seen so far, by name
+	}
+	stack := []openElement{{counts: make(map[string]int)}}
+
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.Strict = false
+	var failure error
+	end := 0
+	for {
+		offset := int(decoder.InputOffset())
+		token, err := decoder.RawToken()
+		if errors.Is(err, io.EOF) && len(stack) > 1 {
+			failure, end = fmt.Errorf("document ends inside <%s>: %w", stack[len(stack)-1].local, io.ErrUnexpectedEOF), offset
+			break
+		}
+		if err != nil {
+			failure, end = err, offset
+			break
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			name := t.Name.Local
+			if t.Name.Space != "" {
+				name = t.Name.Space + ":" + name
 			}
-			nextByte := data[i+1]
-			// Valid tag starts: a-z, A-Z, /, !, ?, _
-			isValidTagStart := (nextByte >= 'a' && nextByte <= 'z') ||
-				(nextByte >= 'A' && nextByte <= 'Z') ||
-				nextByte == '/' || nextByte == '!' || nextByte == '?' || nextByte == '_'
-
-			if !isValidTagStart {
-				// Invalid tag start - escape the <
-				result = append(result, []byte("&lt;")...)
-				i++
-				continue
+			parent := stack[len(stack)-1]
+			stack = append(stack, openElement{name: name, local: t.Name.Local, index: parent.counts[t.Name.Local], counts: make(map[string]int)})
+			parent.counts[t.Name.Local]++
+		case xml.EndElement:
+			// Mismatched end tags close the elements opened since, as the
+			// lenient decoder does
+			for i := len(stack) - 1; i > 0; i-- {
+				if stack[i].local == t.Name.Local {
+					stack = stack[:i]
+					break
+				}
 			}
 		}
-		result = append(result, data[i])
-		i++
+	}
+	if errors.Is(failure, io.EOF) {
+		return nil, "", nil
 	}
 
-	return result
+	var cut bytes.Buffer
+	cut.Write(data[:end])
+	var path []string
+	for i := len(stack) - 1; i > 0; i-- {
+		cut.WriteString("</" + stack[i].name + ">")
+	}
+	for _, e := range stack[1:] {
+		if e.local == "body" || e.local == "section" {
+			path = append(path, fmt.Sprintf("%s[%d]", e.local, e.index))
+		}
+	}
+	if len(path) == 0 {
+		path = []string{"document"}
+	}
+	return cut.Bytes(), strings.Join(path, "/"), failure
 }
@@ -0,0 +1,159 @@
+package fb2
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestSanitize(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+		fixes []string
+	}{
+		{
+			name:  "ampersands",
+			input: "<p>Tom & Jerry &amp; &#169; &#xA9; &nbsp;</p>",
+			want:  "<p>Tom &amp; Jerry &amp; &#169; &#xA9; &amp;nbsp;</p>",
+			fixes: []string{FixAmpersand, FixAmpersand},
+		},
+		{
+			name:  "malformed tags",
+			input: "<p>x <5 y, a < b, wait<...</p>",
+			want:  "<p>x &lt;5 y, a &lt; b, wait&lt;...</p>",
+			fixes: []string{FixMalformedTag, FixMalformedTag, FixMalformedTag},
+		},
+		{
+			name:  "cdata",
+			input: "<p><![CDATA[a & b < c <5]]> & after</p>",
+			want:  "<p><![CDATA[a & b < c <5]]> &amp; after</p>",
+			fixes: []string{FixAmpersand},
+		},
+		{
+			name:  "cdata with markup",
+			input: "<p><![CDATA[<b>bold</b> & <i>]]></p>",
+			want:  "<p><![CDATA[<b>bold</b> & <i>]]></p>",
+		},
+		{
+			name:  "comment",
+			input: "<!-- Tom & Jerry <5 --><p>x</p>",
+			want:  "<!-- Tom & Jerry <5 --><p>x</p>",
+		},
+		{
+			name:  "processing instruction",
+			input: "<?xml-stylesheet href=\"a?b&c\"?><p>&</p>",
+			want:  "<?xml-stylesheet href=\"a?b&c\"?><p>&amp;</p>",
+			fixes: []string{FixAmpersand},
+		},
+		{
+			name:  "control characters everywhere",
+			input: "<p>a\x01b</p><![CDATA[c\x02d]]><!--e\x0bf-->",
+			want:  "<p>ab</p><![CDATA[cd]]><!--ef-->",
+			fixes: []string{FixIllegalChar, FixIllegalChar, FixIllegalChar},
+		},
+		{
+			name:  "unterminated cdata",
+			input: "<p>a & b</p><![CDATA[c & d <",
+			want:  "<p>a &amp; b</p><![CDATA[c & d <",
+			fixes: []string{FixAmpersand},
+		},
+		{
+			name:  "whitespace is kept",
+			input: "<p>\ta\r\n</p>",
+			want:  "<p>\ta\r\n</p>",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, report := Sanitize([]byte(tt.input), DefaultSanitizeOptions())
+			if string(got) != tt.want {
+				t.Errorf("Sanitize(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+			var kinds []string
+			for _, fix := range report.Fixes {
+				kinds = append(kinds, fix.Kind)
+			}
+			if strings.Join(kinds, " ") != strings.Join(tt.fixes, " ") {
+				t.Errorf("fixes = %q, want %q", kinds, tt.fixes)
+			}
+			if report.Changed() != (len(tt.fixes) > 0) {
+				t.Errorf("Changed() = %v with fixes %q", report.Changed(), kinds)
+			}
+		})
+	}
+}
+
+func TestSanitizeMakesWellFormedXML(t *testing.T) {
+	input := []byte(`<?xml version="1.0" encoding="utf-8"?>` +
+		"<FictionBook><body><section><p>Tom & Jerry <5 \x01</p>" +
+		"<p><![CDATA[x & y < z]]></p><!-- a & b --></section></body></FictionBook>")
+	if wellFormed(input) == nil {
+		t.Fatal("input is well-formed")
+	}
+
+	got, report := Sanitize(input, DefaultSanitizeOptions())
+	if err := wellFormed(got); err != nil {
+		t.Errorf("sanitized document: %v\n%s", err, got)
+	}
+	// Offsets are into the input
+	for _, fix := range report.Fixes {
+		c := input[fix.Offset]
+		if fix.Kind == FixAmpersand && c != '&' || fix.Kind == FixMalformedTag && c != '<' || fix.Kind == FixIllegalChar && c != '\x01' {
+			t.Errorf("fix %s at %d is at %q", fix.Kind, fix.Offset, c)
+		}
+	}
+}
+
+func TestSanitizeOptions(t *testing.T) {
+	input := []byte("<p>a & b <5 \x01 \xff</p>")
+
+	got, report := Sanitize(input, SanitizeOptions{})
+	if !bytes.Equal(got, input) || report.Changed() {
+		t.Errorf("no options: %q, %+v", got, report)
+	}
+	got, report = Sanitize(input, SanitizeOptions{RepairUTF8: true})
+	if string(got) != "<p>a & b <5 \x01 �</p>" || report.Count(FixInvalidUTF8) != 1 {
+		t.Errorf("RepairUTF8: %q, %+v", got, report)
+	}
+
+	// UTF-16 is left alone
+	utf16 := []byte("\xff\xfe<\x00p\x00>\x00&\x00")
+	got, report = Sanitize(utf16, DefaultSanitizeOptions())
+	if !bytes.Equal(got, utf16) || !report.UTF16 {
+		t.Errorf("UTF-16: %q, %+v", got, report)
+	}
+}
+
+// wellFormed reports the first XML error of a document, nil if there is none
+func wellFormed(data []byte) error {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		if _, err := d.Token(); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+func BenchmarkSanitize(b *testing.B) {
+	// A megabyte of text with the faults of broken converters
+	var doc strings.Builder
+	doc.WriteString(`<?xml version="1.0" encoding="utf-8"?><FictionBook><body><section>`)
+	for doc.Len() < 1<<20 {
+		doc.WriteString("<p>Tom & Jerry: x <5 y, &nbsp;&amp; \x01 ok <emphasis>text</emphasis></p>\n<![CDATA[a & b]]>\n")
+	}
+	doc.WriteString(`</section></body></FictionBook>`)
+	data := []byte(doc.String())
+	opts := DefaultSanitizeOptions()
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(data)))
+	for b.Loop() {
+		Sanitize(data, opts)
+	}
+}
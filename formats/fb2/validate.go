@@ -0,0 +1,153 @@
+package fb2
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ValidationIssue describes a single problem found by strict validation
+type ValidationIssue struct {
+	Element string // Element the issue refers to, empty for document-level problems
+	Line    int    // 1-based position, 0 when not applicable
+	Column  int
+	Message string
+}
+
+func (i ValidationIssue) String() string {
+	var b strings.Builder
+	if i.Line > 0 {
+		fmt.Fprintf(&b, "%d:%d: ", i.Line, i.Column)
+	}
+	if i.Element != "" {
+		fmt.Fprintf(&b, "<%s>: ", i.Element)
+	}
+	b.WriteString(i.Message)
+	return b.String()
+}
+
+// ValidationError is returned by a strict parser when the document is invalid
+type ValidationError struct {
+	Issues []ValidationIssue
+}
+
+func (e *ValidationError) Error() string {
+	parts := make([]string, len(e.Issues))
+	for i, issue := range e.Issues {
+		parts[i] = issue.String()
+	}
+	return "invalid FB2: " + strings.Join(parts, "; ")
+}
+
+// ValidateFB2 checks that an FB2 file (plain, .fb2.zip or .fb2.gz) is well-formed
+// and has the required elements, without building a Book. An empty list means
+// the document is valid.
+func ValidateFB2(filePath string) ([]ValidationIssue, error) {
+	f, size, err := openFB2File(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	rc, err := openFB2Stream(f, size)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	return validateFB2(rc)
+}
+
+// validateFB2 walks the document with a strict decoder. Well-formedness errors
+// stop the walk; missing required elements are reported after it.
+func validateFB2(r io.Reader) ([]ValidationIssue, error) {
+	decoder, _, err := newFB2Decoder(r)
+	if err != nil {
+		return nil, err
+	}
+	decoder.Strict = true
+
+	var issues []ValidationIssue
+	var stack []string
+	seen := make(map[string]bool)
+	bookTitle := ""
+	bodies := 0
+
+	for {
+		tok, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			line, column := decoder.InputPos()
+			element := ""
+			if len(stack) > 0 {
+				element = stack[len(stack)-1]
+			}
+			var syntaxErr *xml.SyntaxError
+			message := err.Error()
+			if errors.As(err, &syntaxErr) {
+				message = syntaxErr.Msg
+				line = syntaxErr.Line
+			}
+			issues = append(issues, ValidationIssue{
+				Element: element,
+				Line:    line,
+				Column:  column,
+				Message: message,
+			})
+			return issues, nil
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			path := strings.Join(append(stack, t.Name.Local), "/")
+			stack = append(stack, t.Name.Local)
+			switch path {
+			case "FictionBook/description", "FictionBook/description/title-info", "FictionBook/description/title-info/book-title":
+				seen[path] = true
+			case "FictionBook/body":
+				bodies++
+			}
+			if len(stack) == 1 && t.Name.Local != "FictionBook" {
+				line, column := decoder.InputPos()
+				issues = append(issues, ValidationIssue{
+					Element: t.Name.Local,
+					Line:    line,
+					Column:  column,
+					Message: "root element must be FictionBook",
+				})
+			}
+		case xml.CharData:
+			if strings.Join(stack, "/") == "FictionBook/description/title-info/book-title" {
+				bookTitle += string(t)
+			}
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		}
+	}
+
+	required := []struct {
+		path    string
+		element string
+	}{
+		{"FictionBook/description", "description"},
+		{"FictionBook/description/title-info", "title-info"},
+		{"FictionBook/description/title-info/book-title", "book-title"},
+	}
+	for _, req := range required {
+		if !seen[req.path] {
+			issues = append(issues, ValidationIssue{Element: req.element, Message: "required element is missing"})
+		}
+	}
+	if seen["FictionBook/description/title-info/book-title"] && strings.TrimSpace(bookTitle) == "" {
+		issues = append(issues, ValidationIssue{Element: "book-title", Message: "book title is empty"})
+	}
+	if bodies == 0 {
+		issues = append(issues, ValidationIssue{Element: "body", Message: "at least one body is required"})
+	}
+
+	return issues, nil
+}
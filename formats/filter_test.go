@@ -0,0 +1,218 @@
+package formats_test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/vpoluyaktov/biblio-ebook-parser/formats/epub"
+	"github.com/vpoluyaktov/biblio-ebook-parser/formats/fb2"
+	"github.com/vpoluyaktov/biblio-ebook-parser/parser"
+	"github.com/vpoluyaktov/biblio-ebook-parser/testutil/epubtest"
+	"github.com/vpoluyaktov/biblio-ebook-parser/testutil/fb2test"
+)
+
+var elementTypes = []parser.ElementType{
+	parser.ElementTypeParagraph,
+	parser.ElementTypeHeading,
+	parser.ElementTypeImage,
+	parser.ElementTypeTable,
+	parser.ElementTypeEmptyLine,
+	parser.ElementTypeEpigraph,
+	parser.ElementTypeFootnote,
+	parser.ElementTypeBlockquote,
+	parser.ElementTypePreformatted,
+}
+
+// filterFormat parses a book of each element type its parser builds
+type filterFormat struct {
+	name  string
+	data  []byte
+	parse func(filter parser.ElementFilter, data []byte) (*parser.Book, error)
+	// Types the format builds, which the fixture has
+	builds []parser.ElementType
+}
+
+var filterFormats = []filterFormat{
+	{
+		name: "fb2",
+		data: fb2test.New().
+			WithTitle("Filtered").
+			WithSectionMarkup("Everything", `<epigraph><p>An epigraph.</p><text-author>Someone</text-author></epigraph>
+<p>Text with a note<a l:href="#n1" type="note">1</a>.</p>
+<empty-line/>
+<p>After the break.</p>
+<image l:href="#pic"/>
+<table><tr><td>Cell</td></tr></table>
+<cite><p>A quote.</p></cite>
+<subtitle>A subtitle</subtitle>
+<poem><title><p>A poem</p></title><stanza><v>A verse</v></stanza></poem>`).
+			WithSection("Plain", "Only text.").
+			WithNote("n1", "A note.").
+			WithBinary("pic", pngHeader).
+			WithCover(pngHeader).
+			Bytes(),
+		parse: func(filter parser.ElementFilter, data []byte) (*parser.Book, error) {
+			p := fb2.NewParser()
+			p.ParseNotes = true
+			p.ElementFilter = filter
+			return p.ParseReader(bytes.NewReader(data), int64(len(data)))
+		},
+		builds: []parser.ElementType{
+			parser.ElementTypeParagraph, parser.ElementTypeHeading, parser.ElementTypeImage,
+			parser.ElementTypeTable, parser.ElementTypeEmptyLine, parser.ElementTypeEpigraph,
+			parser.ElementTypeFootnote,
+		},
+	},
+	{
+		name: "epub",
+		data: epubtest.New().
+			WithTitle("Filtered").
+			WithChapter("Everything", `<h1>Everything</h1><p>A paragraph.</p><h2>Inner</h2><blockquote><p>A quote.</p></blockquote><ul><li>An item</li></ul>`).
+			WithChapter("Plain", `<p>Only text.</p>`).
+			WithCover(pngHeader).
+			Bytes(),
+		parse: func(filter parser.ElementFilter, data []byte) (*parser.Book, error) {
+			p := epub.NewParser()
+			p.ElementFilter = filter
+			return p.ParseReader(bytes.NewReader(data), int64(len(data)))
+		},
+		builds: []parser.ElementType{parser.ElementTypeParagraph, parser.ElementTypeHeading},
+	},
+}
+
+// countTypes counts the elements of each type in the chapters and notes
+func countTypes(book *parser.Book) map[parser.ElementType]int {
+	counts := make(map[parser.ElementType]int)
+	add := func(elements []parser.Element) {
+		for _, elem := range elements {
+			counts[elem.Type()]++
+		}
+	}
+	for _, ch := range book.Content.Chapters {
+		add(ch.Elements)
+	}
+	for _, note := range book.Notes {
+		add(note.Elements)
+	}
+	return counts
+}
+
+// shape describes what a filter must not change: the chapters, notes and cover
+func shape(book *parser.Book) string {
+	var titles []string
+	for _, ch := range book.Content.Chapters {
+		titles = append(titles, ch.Title)
+	}
+	return fmt.Sprintf("chapters %q, %d notes, %d bytes of cover", titles, len(book.Notes), len(book.Metadata.CoverData))
+}
+
+func TestElementFilter(t *testing.T) {
+	for _, format := range filterFormats {
+		t.Run(format.name, func(t *testing.T) {
+			full, err := format.parse(nil, format.data)
+			if err != nil {
+				t.Fatalf("ParseReader: %v", err)
+			}
+			all := countTypes(full)
+			for _, typ := range format.builds {
+				if all[typ] == 0 {
+					t.Fatalf("the fixture has no element of type %d: %v", typ, all)
+				}
+			}
+
+			for _, excluded := range elementTypes {
+				book, err := format.parse(parser.ExcludeElements(excluded), format.data)
+				if err != nil {
+					t.Fatalf("excluding %d: %v", excluded, err)
+				}
+				if got, want := shape(book), shape(full); got != want {
+					t.Errorf("excluding %d: %s, want %s", excluded, got, want)
+				}
+				counts := countTypes(book)
+				for _, typ := range elementTypes {
+					want := all[typ]
+					switch {
+					case typ == excluded && typ != parser.ElementTypeHeading:
+						want = 0
+					case excluded == parser.ElementTypeParagraph &&
+						(typ == parser.ElementTypeFootnote || typ == parser.ElementTypeEmptyLine):
+						// Footnotes follow the paragraph citing them, and empty
+						// lines only separate kept content
+						continue
+					}
+					if counts[typ] != want {
+						t.Errorf("excluding %d: %d elements of type %d, want %d", excluded, counts[typ], typ, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestElementFilterKeepsHeadings(t *testing.T) {
+	none := parser.ElementFilter(func(parser.ElementType) bool { return false })
+	for _, format := range filterFormats {
+		t.Run(format.name, func(t *testing.T) {
+			full, err := format.parse(nil, format.data)
+			if err != nil {
+				t.Fatalf("ParseReader: %v", err)
+			}
+			book, err := format.parse(none, format.data)
+			if err != nil {
+				t.Fatalf("ParseReader: %v", err)
+			}
+
+			counts := countTypes(book)
+			if counts[parser.ElementTypeHeading] != countTypes(full)[parser.ElementTypeHeading] || len(counts) != 1 {
+				t.Errorf("a filter keeping nothing left %v", counts)
+			}
+			if got, want := shape(book), shape(full); got != want {
+				t.Errorf("%s, want %s", got, want)
+			}
+			if h, ok := book.Content.Chapters[0].Elements[0].(*parser.Heading); !ok || h.Text != "Everything" {
+				t.Errorf("first element = %#v, want the chapter heading", book.Content.Chapters[0].Elements[0])
+			}
+		})
+	}
+}
+
+func BenchmarkElementFilter(b *testing.B) {
+	fb2Book := fb2test.New().WithTitle("Filtered").WithBinary("pic", pngHeader)
+	epubBook := epubtest.New().WithTitle("Filtered")
+	for i := range 500 {
+		fb2Book.WithSectionMarkup(fmt.Sprintf("Chapter %d", i+1), `<epigraph><p>An epigraph.</p><text-author>Someone</text-author></epigraph>
+<p>Text with a note<a l:href="#n1" type="note">1</a>.</p>
+<empty-line/>
+<p>After the break, a longer paragraph of text to read through.</p>
+<image l:href="#pic"/>
+<table><tr><td>Cell</td><td>Cell</td></tr><tr><td>Cell</td><td>Cell</td></tr></table>
+<p>The last paragraph.</p>`)
+		epubBook.WithChapter(fmt.Sprintf("Chapter %d", i+1), `<h1>Chapter</h1><p>A paragraph.</p><p>A longer paragraph of text to read through.</p><blockquote><p>A quote.</p></blockquote>`)
+	}
+	fb2Book.WithNote("n1", "A note.")
+	data := map[string][]byte{"fb2": fb2Book.Bytes(), "epub": epubBook.Bytes()}
+
+	filters := []struct {
+		name   string
+		filter parser.ElementFilter
+	}{
+		{"all", nil},
+		{"text only", parser.ExcludeElements(parser.ElementTypeImage, parser.ElementTypeTable,
+			parser.ElementTypeFootnote, parser.ElementTypeEmptyLine, parser.ElementTypeEpigraph)},
+		{"headings only", parser.ExcludeElements(elementTypes...)},
+	}
+	for _, format := range filterFormats {
+		for _, f := range filters {
+			b.Run(format.name+"/"+f.name, func(b *testing.B) {
+				b.SetBytes(int64(len(data[format.name])))
+				b.ReportAllocs()
+				for b.Loop() {
+					if _, err := format.parse(f.filter, data[format.name]); err != nil {
+						b.Fatalf("ParseReader: %v", err)
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package formats_test
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/vpoluyaktov/biblio-ebook-parser/parser"
+	"github.com/vpoluyaktov/biblio-ebook-parser/renderer/json"
+	"github.com/vpoluyaktov/biblio-ebook-parser/testutil"
+	"github.com/vpoluyaktov/biblio-ebook-parser/testutil/epubtest"
+	"github.com/vpoluyaktov/biblio-ebook-parser/testutil/fb2test"
+)
+
+// The corpus is the books built below plus the files in testdata/corpus.
+// Each parses to the JSON document in testdata/<name>.golden.json; run
+//
+//	UPDATE_GOLDEN=1 go test ./formats -run TestGoldenCorpus
+//
+// after an intended change of the parsers, and review the diff.
+
+type corpusBook struct {
+	name   string
+	format string
+	data   []byte
+}
+
+func builtCorpus() []corpusBook {
+	return []corpusBook{
+		{name: "epub3-nav", format: "epub", data: epub3NavBook().Bytes()},
+		{name: "epub2-ncx", format: "epub", data: epub2NCXBook().Bytes()},
+		// Every chapter file opens with a banner repeating the book title;
+		// the chapters keep their TOC titles
+		{name: "epub-banner-h1", format: "epub", data: epubtest.New().
+			EPUB2().
+			WithTitle("The Long Siege").
+			WithAuthor("Jane Doe").
+			WithChapter("Chapter 1: The Walls", `<h1 class="banner">The Long Siege</h1><h2>I</h2><p>The walls were old.</p>`).
+			WithChapter("Chapter 12: The Siege", `<h1 class="banner">The Long Siege</h1><p>The siege began at dawn.</p>`).
+			Bytes()},
+		{name: "fb2-sections", format: "fb2", data: fb2test.New().
+			WithTitle("Golden FB2").
+			WithAuthor("Jane Doe").
+			WithLanguage("en").
+			WithGenre("sf").
+			WithAnnotation("About the book.").
+			WithDate("2001").
+			WithSequence("Series", 3).
+			WithSection("Prologue", "It begins.", "It goes on.").
+			WithSubsection("Inner", "Nested text.").
+			WithSectionMarkup("Notes", `<p>See<a l:href="#n1" type="note">1</a>.</p>`).
+			WithNote("n1", "A note.").
+			WithCover(pngHeader).
+			Bytes()},
+		{name: "fb2-cp1251", format: "fb2", data: fb2test.New().
+			WithTitle("Кодировка").
+			WithAuthor("Иван Петров").
+			WithLanguage("ru").
+			WithSection("Глава", "Текст в windows-1251.").
+			WithEncoding("windows-1251").
+			Bytes()},
+	}
+}
+
+// epub3NavBook and epub2NCXBook also have UTF-16 twins
+func epub3NavBook() *epubtest.Builder {
+	return epubtest.New().
+		WithTitle("The Golden Book").
+		WithAuthor("Jane Doe").
+		WithAuthor("John van der Berg").
+		WithLanguage("en").
+		WithIdentifier("urn:isbn:9780000000001").
+		WithSubject("Fiction").
+		WithMetadata(`<dc:description>A book &lt;b&gt;about&lt;/b&gt; gold.</dc:description>`).
+		WithChapter("Chapter One", `<p>It was a <em>bright</em> day.</p><p>“Is it?” she asked.</p>`).
+		WithChapter("Chapter Two", `<h2>Part A</h2><p>First part.</p><blockquote><p>Quoted.</p></blockquote><h2>Part B</h2><ul><li>One</li><li>Two</li></ul>`).
+		WithCover(pngHeader)
+}
+
+func epub2NCXBook() *epubtest.Builder {
+	return epubtest.New().
+		EPUB2().
+		WithTitle("Старая книга").
+		WithAuthor("Лев Толстой").
+		WithLanguage("ru").
+		WithChapterFile("text/part 1.xhtml", "Часть первая", `<p>Все счастливые семьи похожи друг на друга.</p>`).
+		WithChapterFile("text/part 2.xhtml", "Часть вторая", `<p>Каждая несчастливая семья несчастлива по-своему.</p>`).
+		WithEncodedHrefs()
+}
+
+func fileCorpus(t *testing.T) []corpusBook {
+	t.Helper()
+	paths, err := filepath.Glob(filepath.Join("testdata", "corpus", "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var books []corpusBook
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		name := filepath.Base(path)
+		books = append(books, corpusBook{
+			name:   strings.TrimSuffix(name, filepath.Ext(name)),
+			format: strings.TrimPrefix(filepath.Ext(name), "."),
+			data:   data,
+		})
+	}
+	if len(books) == 0 {
+		t.Fatal("testdata/corpus is empty")
+	}
+	return books
+}
+
+func TestGoldenCorpus(t *testing.T) {
+	for _, cb := range append(builtCorpus(), fileCorpus(t)...) {
+		t.Run(cb.name, func(t *testing.T) {
+			book, err := parser.ParseReader(cb.format, bytes.NewReader(cb.data), int64(len(cb.data)))
+			if err != nil {
+				t.Fatalf("ParseReader: %v", err)
+			}
+			testutil.Golden(t, cb.name, book)
+		})
+	}
+}
+
+func TestGoldenCorpusUTF16(t *testing.T) {
+	books := map[string]func() *epubtest.Builder{"epub3-nav": epub3NavBook, "epub2-ncx": epub2NCXBook}
+	for name, book := range books {
+		want := renderJSON(t, book().Bytes())
+		for _, encoding := range []string{"utf-16le", "utf-16be", "utf-8"} {
+			for _, bom := range []bool{false, true} {
+				if encoding == "utf-8" && !bom {
+					continue
+				}
+				t.Run(fmt.Sprintf("%s/%s/bom=%v", name, encoding, bom), func(t *testing.T) {
+					got := renderJSON(t, book().WithXMLEncoding(encoding, bom).Bytes())
+					if got != want {
+						t.Errorf("parses to:\n%s\nwant as the UTF-8 original:\n%s", got, want)
+					}
+				})
+			}
+		}
+	}
+}
+
+// renderJSON parses an EPUB and renders the book as the golden files hold
+// it, but for the chapters' byte ranges: a file declaring UTF-16 is a byte
+// longer once decoded than one declaring UTF-8
+func renderJSON(t *testing.T, data []byte) string {
+	t.Helper()
+	book, err := parser.ParseReader("epub", bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("ParseReader: %v", err)
+	}
+	for i := range book.Content.Chapters {
+		book.Content.Chapters[i].SourceStart, book.Content.Chapters[i].SourceEnd = 0, 0
+	}
+	var doc bytes.Buffer
+	if err := json.NewRenderer(json.Config{Pretty: true}).RenderTo(&doc, book); err != nil {
+		t.Fatalf("failed to render: %v", err)
+	}
+	return doc.String()
+}
@@ -1,8 +1,12 @@
 package formats
 
 import (
+	"github.com/vpoluyaktov/biblio-ebook-parser/formats/cbz"
 	"github.com/vpoluyaktov/biblio-ebook-parser/formats/epub"
 	"github.com/vpoluyaktov/biblio-ebook-parser/formats/fb2"
+	"github.com/vpoluyaktov/biblio-ebook-parser/formats/markdown"
+	"github.com/vpoluyaktov/biblio-ebook-parser/formats/mobi"
+	"github.com/vpoluyaktov/biblio-ebook-parser/formats/txt"
 	"github.com/vpoluyaktov/biblio-ebook-parser/parser"
 )
 
@@ -14,4 +18,19 @@ func init() {
 	// Register FB2 parser
 	parser.Register("fb2", fb2.NewParser())
 	parser.Register("fb2.zip", fb2.NewParser())
+	parser.Register("fb2.gz", fb2.NewParser())
+
+	// Register TXT parser
+	parser.Register("txt", txt.NewParser())
+
+	// Register CBZ parser
+	parser.Register("cbz", cbz.NewParser())
+
+	// Register MOBI parser
+	parser.Register("mobi", mobi.NewParser())
+	parser.Register("azw", mobi.NewParser())
+
+	// Register Markdown parser
+	parser.Register("markdown", markdown.NewParser())
+	parser.Register("md", markdown.NewParser())
 }
@@ -0,0 +1,263 @@
+package formats_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/vpoluyaktov/biblio-ebook-parser/formats/epub"
+	"github.com/vpoluyaktov/biblio-ebook-parser/formats/fb2"
+	"github.com/vpoluyaktov/biblio-ebook-parser/formats/txt"
+	"github.com/vpoluyaktov/biblio-ebook-parser/parser"
+	"github.com/vpoluyaktov/biblio-ebook-parser/testutil/epubtest"
+	"github.com/vpoluyaktov/biblio-ebook-parser/testutil/fb2test"
+)
+
+// logRecord is a record captured by recordHandler, its attributes as text
+type logRecord struct {
+	level   slog.Level
+	message string
+	attrs   map[string]string
+}
+
+// recordHandler captures the records of every level
+type recordHandler struct {
+	mu      sync.Mutex
+	records []logRecord
+}
+
+func (h *recordHandler) Enabled(context.Context, slog.Level) bool { return true }
+func (h *recordHandler) WithAttrs([]slog.Attr) slog.Handler       { return h }
+func (h *recordHandler) WithGroup(string) slog.Handler            { return h }
+
+func (h *recordHandler) Handle(_ context.Context, r slog.Record) error {
+	rec := logRecord{level: r.Level, message: r.Message, attrs: make(map[string]string)}
+	r.Attrs(func(a slog.Attr) bool {
+		rec.attrs[a.Key] = a.Value.String()
+		return true
+	})
+	h.mu.Lock()
+	h.records = append(h.records, rec)
+	h.mu.Unlock()
+	return nil
+}
+
+// find returns the first record of a level with the message
+func (h *recordHandler) find(level slog.Level, message string) (logRecord, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, rec := range h.records {
+		if rec.level == level && rec.message == message {
+			return rec, true
+		}
+	}
+	return logRecord{}, false
+}
+
+// warnings returns the messages of the warn records
+func (h *recordHandler) warnings() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var messages []string
+	for _, rec := range h.records {
+		if rec.level == slog.LevelWarn {
+			messages = append(messages, rec.message)
+		}
+	}
+	return messages
+}
+
+// captureLogs sets a logger capturing records for a test, and turns logging
+// off after it
+func captureLogs(t *testing.T) *recordHandler {
+	h := &recordHandler{}
+	parser.SetLogger(slog.New(h))
+	t.Cleanup(func() { parser.SetLogger(nil) })
+	return h
+}
+
+// withoutCoverBinary returns a book whose coverpage refers to a missing
+// binary, which the parser warns about
+func withoutCoverBinary(b *fb2test.Builder) []byte {
+	return bytes.Replace(b.WithCover(pngHeader).Bytes(), []byte(`<binary id="cover"`), []byte(`<binary id="other"`), 1)
+}
+
+func TestLoggerDebugEvents(t *testing.T) {
+	truncated := fb2test.New().WithTitle("Truncated").WithSection("One", "Kept.").WithSection("Two", "Lost.").Bytes()
+	tests := []struct {
+		name    string
+		parse   func() error
+		message string
+		attrs   map[string]string
+	}{
+		{
+			name:    "fb2 charset",
+			parse:   parseFB2(fb2test.New().WithTitle("Кодировка").WithSection("Глава", "Текст.").WithEncoding("windows-1251").Bytes()),
+			message: "FB2 charset detected",
+			attrs:   map[string]string{"charset": "windows-1251", "declared": "windows-1251"},
+		},
+		{
+			name:    "fb2 sanitized",
+			parse:   parseFB2(fb2test.New().WithTitle("Broken").WithSection("One", "Take x <5 y.").WithInvalidTagStarts().Bytes()),
+			message: "FB2 is malformed, parsing it sanitized",
+		},
+		{
+			name:    "fb2 cut short",
+			parse:   parseFB2(truncated[:bytes.Index(truncated, []byte("Lost"))]),
+			message: "sanitized FB2 is still malformed, parsing it up to the error",
+		},
+		{
+			name:    "epub nav",
+			parse:   parseEPUB(epubtest.New().WithTitle("Nav").WithChapter("One", "<p>Text.</p>").WithNav().Bytes()),
+			message: "EPUB chapters from navigation document",
+			attrs:   map[string]string{"path": "OEBPS/nav.xhtml", "entries": "1"},
+		},
+		{
+			name:    "epub ncx",
+			parse:   parseEPUB(epubtest.New().WithTitle("NCX").WithChapter("One", "<p>Text.</p>").WithChapter("Two", "<p>More.</p>").EPUB2().Bytes()),
+			message: "EPUB chapters from NCX",
+			attrs:   map[string]string{"path": "OEBPS/toc.ncx", "entries": "2"},
+		},
+		{
+			name:    "epub spine",
+			parse:   parseEPUB(epubtest.New().WithTitle("Spine").WithChapter("", "<h1>One</h1><p>Text.</p>").Bytes()),
+			message: "EPUB has no usable TOC, chapters from spine",
+			attrs:   map[string]string{"items": "1"},
+		},
+		{
+			name:    "epub cover by name",
+			parse:   parseEPUB(epubtest.New().WithTitle("Cover").WithChapter("One", "<p>Text.</p>").WithFile("images/cover.png", pngHeader).Bytes()),
+			message: "EPUB cover found by manifest name",
+			attrs:   map[string]string{"href": "images/cover.png"},
+		},
+		{
+			name: "txt charset",
+			parse: func() error {
+				data := []byte("Plain text.\n\nAnother paragraph.\n")
+				_, err := txt.NewParser().ParseReader(bytes.NewReader(data), int64(len(data)))
+				return err
+			},
+			message: "TXT charset detected",
+			attrs:   map[string]string{"charset": "utf-8"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := captureLogs(t)
+			if err := tt.parse(); err != nil {
+				t.Logf("parse: %v", err)
+			}
+			rec, ok := h.find(slog.LevelDebug, tt.message)
+			if !ok {
+				t.Fatalf("no debug record %q in %v", tt.message, h.records)
+			}
+			for key, want := range tt.attrs {
+				if got := rec.attrs[key]; !strings.EqualFold(got, want) {
+					t.Errorf("%s = %q, want %q", key, got, want)
+				}
+			}
+		})
+	}
+}
+
+func parseFB2(data []byte) func() error {
+	return func() error {
+		_, err := fb2.NewParser().ParseReader(bytes.NewReader(data), int64(len(data)))
+		return err
+	}
+}
+
+func parseEPUB(data []byte) func() error {
+	return func() error {
+		_, err := epub.NewParser().ParseReader(bytes.NewReader(data), int64(len(data)))
+		return err
+	}
+}
+
+func TestLoggerWarnsOnce(t *testing.T) {
+	book := fb2test.New().WithTitle("Warnings")
+	for i := range 200 {
+		book.WithSection(fmt.Sprintf("Chapter %d", i), fmt.Sprintf("Paragraph %d of %x, never the same twice.", i, i*7919))
+	}
+	data := withoutCoverBinary(book)
+
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	w.Write(data)
+	w.Close()
+
+	inputs := map[string][]byte{
+		"fb2": data,
+		// The book passes through the parser twice, once per layer
+		"fb2.gz": gz.Bytes(),
+		// A stream cut short adds an issue after the inner parse logged its
+		// warnings
+		"fb2.gz cut short": gz.Bytes()[:gz.Len()*2/3],
+		// A title page in the TOC, named after the book
+		"epub": epubtest.New().WithTitle("Warnings").
+			WithChapter("Warnings", `<h1>Warnings</h1>`).
+			WithChapter("One", `<p>Text.</p>`).
+			WithNav().Bytes(),
+	}
+	for name, data := range inputs {
+		t.Run(name, func(t *testing.T) {
+			h := captureLogs(t)
+			var p parser.Parser = fb2.NewParser()
+			format := "fb2"
+			if name == "epub" {
+				p, format = epub.NewParser(), "epub"
+			}
+			book, _ := p.ParseReader(bytes.NewReader(data), int64(len(data)))
+			if book == nil {
+				t.Fatal("no book")
+			}
+			if len(book.Warnings) == 0 {
+				t.Fatal("the book has no warnings; the test needs some")
+			}
+			if got := h.warnings(); !slices.Equal(got, book.Warnings) {
+				t.Errorf("logged warnings:\n%s\nwant the book's:\n%s", strings.Join(got, "\n"), strings.Join(book.Warnings, "\n"))
+			}
+			for _, rec := range h.records {
+				if rec.level == slog.LevelWarn && rec.attrs["format"] != format {
+					t.Errorf("warning %q has format %q, want %q", rec.message, rec.attrs["format"], format)
+				}
+			}
+
+			// Logging again only logs what was added since
+			book.LogWarnings(format)
+			book.Warnings = append(book.Warnings, "added later")
+			book.LogWarnings(format)
+			if got := h.warnings(); !slices.Equal(got, book.Warnings) {
+				t.Errorf("after LogWarnings, logged:\n%s", strings.Join(got, "\n"))
+			}
+		})
+	}
+}
+
+func TestLoggerOff(t *testing.T) {
+	parser.SetLogger(nil)
+	data := withoutCoverBinary(fb2test.New().WithTitle("Quiet").WithSection("One", "Text."))
+	book, err := fb2.NewParser().ParseReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("ParseReader: %v", err)
+	}
+	if len(book.Warnings) == 0 {
+		t.Fatal("the book has no warnings; the test needs some")
+	}
+	if allocs := testing.AllocsPerRun(100, func() { book.LogWarnings("fb2") }); allocs != 0 {
+		t.Errorf("LogWarnings without a logger allocates %.0f times", allocs)
+	}
+
+	// Warnings from while logging was off aren't logged once it is on
+	h := captureLogs(t)
+	book.LogWarnings("fb2")
+	if got := h.warnings(); len(got) != 0 {
+		t.Errorf("logged %q from before the logger was set", got)
+	}
+}
@@ -0,0 +1,62 @@
+package markdown
+
+import (
+	"io"
+
+	"github.com/vpoluyaktov/biblio-ebook-parser/parser"
+)
+
+// Extractor implements the FastExtractor interface for Markdown files. The
+// cover and annotation come from the front matter, which needs a full parse.
+type Extractor struct{}
+
+// ExtractCoverFromFile extracts the cover named in the front matter
+func (e *Extractor) ExtractCoverFromFile(filePath string) ([]byte, string, error) {
+	book, err := NewParser().Parse(filePath)
+	if err != nil {
+		return nil, "", err
+	}
+	return book.Metadata.CoverData, book.Metadata.CoverType, nil
+}
+
+// ExtractCoverFromReader returns no cover, as images can't be resolved
+// without the file's directory
+func (e *Extractor) ExtractCoverFromReader(r io.ReaderAt, size int64) ([]byte, string, error) {
+	return nil, "", nil
+}
+
+// ExtractAnnotationFromFile extracts the front matter description
+func (e *Extractor) ExtractAnnotationFromFile(filePath string) (string, error) {
+	book, err := NewParser().Parse(filePath)
+	if err != nil {
+		return "", err
+	}
+	return book.Metadata.Description, nil
+}
+
+// ExtractAnnotationFromReader extracts the front matter description
+func (e *Extractor) ExtractAnnotationFromReader(r io.ReaderAt, size int64) (string, error) {
+	book, err := NewParser().ParseReader(r, size)
+	if err != nil {
+		return "", err
+	}
+	return book.Metadata.Description, nil
+}
+
+// ExtractMetadataFromFile extracts metadata from a Markdown file
+func (e *Extractor) ExtractMetadataFromFile(filePath string) (parser.Metadata, error) {
+	book, err := NewParser().Parse(filePath)
+	if err != nil {
+		return parser.Metadata{}, err
+	}
+	return book.Metadata, nil
+}
+
+// ExtractMetadataFromReader extracts metadata from a Markdown reader
+func (e *Extractor) ExtractMetadataFromReader(r io.ReaderAt, size int64) (parser.Metadata, error) {
+	book, err := NewParser().ParseReader(r, size)
+	if err != nil {
+		return parser.Metadata{}, err
+	}
+	return book.Metadata, nil
+}
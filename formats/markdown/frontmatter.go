@@ -0,0 +1,155 @@
+package markdown
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/vpoluyaktov/biblio-ebook-parser/parser"
+)
+
+// splitFrontMatter separates a leading YAML front matter block ("---" ...
+// "---") from the document. ok is false when the document has none.
+func splitFrontMatter(lines []string) (frontMatter, body []string, ok bool) {
+	if len(lines) == 0 || strings.TrimRight(lines[0], " \t") != "---" {
+		return nil, lines, false
+	}
+	for i := 1; i < len(lines); i++ {
+		if end := strings.TrimRight(lines[i], " \t"); end == "---" || end == "..." {
+			return lines[1:i], lines[i+1:], true
+		}
+	}
+	return nil, lines, false
+}
+
+// parseFrontMatter reads the flat subset of YAML used by front matter: scalar
+// values (plain or quoted), "[a, b]" lists, "- item" lists, and "|" or ">"
+// block scalars. Nested mappings are skipped.
+func parseFrontMatter(lines []string) map[string][]string {
+	values := make(map[string][]string)
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			continue // Belongs to a key we don't read
+		}
+
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch {
+		case value == "":
+			// A "- item" list may follow
+			for i+1 < len(lines) {
+				item := strings.TrimSpace(lines[i+1])
+				if !strings.HasPrefix(item, "- ") && item != "-" {
+					break
+				}
+				if item = unquote(strings.TrimSpace(strings.TrimPrefix(item, "-"))); item != "" {
+					values[key] = append(values[key], item)
+				}
+				i++
+			}
+
+		case value == "|" || value == ">" || value == "|-" || value == ">-":
+			var block []string
+			for i+1 < len(lines) {
+				next := lines[i+1]
+				if strings.TrimSpace(next) != "" && next[0] != ' ' && next[0] != '\t' {
+					break
+				}
+				block = append(block, strings.TrimSpace(next))
+				i++
+			}
+			sep := "\n"
+			if value[0] == '>' {
+				sep = " "
+			}
+			values[key] = []string{strings.TrimSpace(strings.Join(block, sep))}
+
+		case strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]"):
+			for _, item := range strings.Split(value[1:len(value)-1], ",") {
+				if item = unquote(strings.TrimSpace(item)); item != "" {
+					values[key] = append(values[key], item)
+				}
+			}
+
+		default:
+			values[key] = []string{unquote(value)}
+		}
+	}
+
+	return values
+}
+
+// unquote removes YAML quotes from a scalar, or a trailing comment from a
+// plain one
+func unquote(value string) string {
+	switch {
+	case strings.HasPrefix(value, `"`):
+		if s, err := strconv.Unquote(value); err == nil {
+			return s
+		}
+		return strings.Trim(value, `"`)
+	case strings.HasPrefix(value, "'"):
+		return strings.ReplaceAll(strings.Trim(value, "'"), "''", "'")
+	}
+	if idx := strings.Index(value, " #"); idx >= 0 {
+		value = strings.TrimSpace(value[:idx])
+	}
+	return value
+}
+
+// applyFrontMatter fills metadata from front matter values
+func applyFrontMatter(m *parser.Metadata, values map[string][]string) {
+	first := func(keys ...string) string {
+		for _, key := range keys {
+			if v := values[key]; len(v) > 0 {
+				return v[0]
+			}
+		}
+		return ""
+	}
+
+	m.Title = first("title")
+	m.Description = first("description", "summary", "abstract")
+	m.Language = first("language", "lang")
+	m.Publisher = first("publisher")
+
+	for _, key := range []string{"author", "authors", "creator"} {
+		for _, name := range values[key] {
+			if author := parser.ParseAuthor(name, ""); !author.IsEmpty() {
+				m.Authors = append(m.Authors, author)
+			}
+		}
+	}
+
+	for _, key := range []string{"genres", "tags", "keywords"} {
+		m.Genres = append(m.Genres, values[key]...)
+	}
+
+	if date := first("date"); date != "" {
+		m.PublicationDate = date
+		m.PublicationTime = parser.ParseDate(date)
+		if year, err := strconv.Atoi(strings.SplitN(date, "-", 2)[0]); err == nil {
+			m.PublicationYear = year
+		}
+	}
+
+	if series := first("series"); series != "" {
+		index, _ := strconv.Atoi(first("seriesindex", "series_index", "series-index"))
+		m.Series = series
+		m.SeriesIndex = index
+		m.Sequences = []parser.Sequence{{Name: series, Number: index}}
+	}
+
+	if isbn := first("isbn"); isbn != "" {
+		m.Identifiers = append(m.Identifiers, parser.Identifier{Scheme: "isbn", Value: isbn})
+	}
+}
@@ -0,0 +1,289 @@
+package markdown
+
+import (
+	"html"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// span is a piece of inline content. Text spans are literal, delimiter spans
+// are runs of '*' or '_' that may turn into emphasis.
+type span struct {
+	text string // Plain text
+	html string // Markup, escaped
+
+	delim     byte // '*' or '_' for delimiter runs
+	count     int  // Delimiters left unmatched
+	canOpen   bool
+	canClose  bool
+	openTags  string // Tags written after the run when it opens emphasis
+	closeTags string // Tags written before the run when it closes emphasis
+}
+
+// renderInline converts inline Markdown to plain text and HTML. Emphasis
+// (both the '*' and '_' forms), code spans, links, images, backslash escapes
+// and hard line breaks are recognized; anything else is kept as text.
+func renderInline(src string) (string, string) {
+	spans := parseSpans(src)
+	matchEmphasis(spans)
+
+	var text, markup strings.Builder
+	for _, s := range spans {
+		if s.delim == 0 {
+			text.WriteString(s.text)
+			markup.WriteString(s.html)
+			continue
+		}
+		literal := strings.Repeat(string(s.delim), s.count)
+		text.WriteString(literal)
+		markup.WriteString(s.closeTags)
+		markup.WriteString(literal)
+		markup.WriteString(s.openTags)
+	}
+	return text.String(), markup.String()
+}
+
+// parseSpans splits inline Markdown into text and delimiter spans
+func parseSpans(src string) []*span {
+	var spans []*span
+	var text strings.Builder
+
+	flush := func() {
+		if text.Len() > 0 {
+			spans = append(spans, &span{text: text.String(), html: html.EscapeString(text.String())})
+			text.Reset()
+		}
+	}
+	add := func(plain, markup string) {
+		flush()
+		spans = append(spans, &span{text: plain, html: markup})
+	}
+
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '\\' && i+1 < len(src) && src[i+1] == '\n':
+			add("\n", "<br/>\n")
+			i += 2
+			continue
+
+		case c == '\\' && i+1 < len(src) && isASCIIPunct(src[i+1]):
+			text.WriteByte(src[i+1])
+			i += 2
+			continue
+
+		case c == '\n':
+			// Two trailing spaces make a hard break, otherwise lines are joined
+			trimmed := strings.TrimRight(text.String(), " ")
+			hard := text.Len()-len(trimmed) >= 2
+			text.Reset()
+			text.WriteString(trimmed)
+			if hard {
+				add("\n", "<br/>\n")
+			} else {
+				text.WriteByte(' ')
+			}
+			i++
+			continue
+
+		case c == '`':
+			if code, next, ok := codeSpan(src, i); ok {
+				add(code, "<code>"+html.EscapeString(code)+"</code>")
+				i = next
+				continue
+			}
+			// An unmatched run is literal
+			n := runLength(src, i, '`')
+			text.WriteString(src[i : i+n])
+			i += n
+			continue
+
+		case c == '!' && i+1 < len(src) && src[i+1] == '[':
+			if alt, href, next, ok := link(src, i+1); ok {
+				altText, _ := renderInline(alt)
+				add(altText, `<img src="`+html.EscapeString(href)+`" alt="`+html.EscapeString(altText)+`"/>`)
+				i = next
+				continue
+			}
+
+		case c == '[':
+			if label, href, next, ok := link(src, i); ok {
+				labelText, labelHTML := renderInline(label)
+				add(labelText, `<a href="`+html.EscapeString(href)+`">`+labelHTML+`</a>`)
+				i = next
+				continue
+			}
+
+		case c == '*' || c == '_':
+			n := runLength(src, i, c)
+			canOpen, canClose := flanking(src, i, n)
+			if c == '_' {
+				// Underscores don't emphasize inside words
+				before, after := runeBefore(src, i), runeAfter(src, i+n)
+				canOpen, canClose = canOpen && (!canClose || isPunct(before)),
+					canClose && (!canOpen || isPunct(after))
+			}
+			flush()
+			spans = append(spans, &span{delim: c, count: n, canOpen: canOpen, canClose: canClose})
+			i += n
+			continue
+		}
+
+		text.WriteByte(c)
+		i++
+	}
+	flush()
+
+	return spans
+}
+
+// matchEmphasis pairs delimiter runs following the CommonMark rules: each
+// closer is matched with the nearest opener of the same character, two
+// delimiters on each side making <strong> and one making <em>
+func matchEmphasis(spans []*span) {
+	for ci, closer := range spans {
+		if closer.delim == 0 || !closer.canClose {
+			continue
+		}
+		for oi := ci - 1; oi >= 0 && closer.count > 0; oi-- {
+			opener := spans[oi]
+			if opener.delim != closer.delim || !opener.canOpen || opener.count == 0 {
+				continue
+			}
+			// Runs that can both open and close only pair up when their
+			// lengths don't add up to a multiple of three
+			if (opener.canClose || closer.canOpen) &&
+				(opener.count+closer.count)%3 == 0 && (opener.count%3 != 0 || closer.count%3 != 0) {
+				continue
+			}
+
+			for opener.count > 0 && closer.count > 0 {
+				tag := "em"
+				used := 1
+				if opener.count >= 2 && closer.count >= 2 {
+					tag, used = "strong", 2
+				}
+				opener.count -= used
+				closer.count -= used
+				opener.openTags = "<" + tag + ">" + opener.openTags
+				closer.closeTags += "</" + tag + ">"
+			}
+
+			// Delimiters between the pair can no longer match
+			for _, s := range spans[oi+1 : ci] {
+				s.canOpen, s.canClose = false, false
+			}
+		}
+	}
+}
+
+// flanking reports whether the delimiter run src[i:i+n] is left-flanking
+// (can open) and right-flanking (can close)
+func flanking(src string, i, n int) (bool, bool) {
+	before, after := runeBefore(src, i), runeAfter(src, i+n)
+	leftFlanking := !unicode.IsSpace(after) &&
+		(!isPunct(after) || unicode.IsSpace(before) || isPunct(before))
+	rightFlanking := !unicode.IsSpace(before) &&
+		(!isPunct(before) || unicode.IsSpace(after) || isPunct(after))
+	return leftFlanking, rightFlanking
+}
+
+// codeSpan returns the content of the code span starting at src[i]
+func codeSpan(src string, i int) (string, int, bool) {
+	n := runLength(src, i, '`')
+	for j := i + n; j < len(src); {
+		if src[j] != '`' {
+			j++
+			continue
+		}
+		m := runLength(src, j, '`')
+		if m == n {
+			code := strings.ReplaceAll(src[i+n:j], "\n", " ")
+			// One surrounding space is stripped so code can start with a backtick
+			if len(code) > 2 && code[0] == ' ' && code[len(code)-1] == ' ' && strings.TrimSpace(code) != "" {
+				code = code[1 : len(code)-1]
+			}
+			return code, j + m, true
+		}
+		j += m
+	}
+	return "", 0, false
+}
+
+// link parses "[label](href)" or "[label](<href> "title")" starting at the
+// opening bracket src[i]
+func link(src string, i int) (string, string, int, bool) {
+	depth := 0
+	end := -1
+	for j := i; j < len(src) && end < 0; j++ {
+		switch src[j] {
+		case '\\':
+			j++
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth == 0 {
+				end = j
+			}
+		}
+	}
+	if end < 0 || end+1 >= len(src) || src[end+1] != '(' {
+		return "", "", 0, false
+	}
+
+	closing := strings.IndexByte(src[end+2:], ')')
+	if closing < 0 {
+		return "", "", 0, false
+	}
+	dest := strings.TrimSpace(src[end+2 : end+2+closing])
+
+	var href string
+	if strings.HasPrefix(dest, "<") {
+		gt := strings.IndexByte(dest, '>')
+		if gt < 0 {
+			return "", "", 0, false
+		}
+		href = dest[1:gt]
+	} else if fields := strings.Fields(dest); len(fields) > 0 {
+		// Anything after the destination is the title, which is not kept
+		href = fields[0]
+	}
+
+	return src[i+1 : end], href, end + 2 + closing + 1, true
+}
+
+func runLength(src string, i int, c byte) int {
+	n := 0
+	for i+n < len(src) && src[i+n] == c {
+		n++
+	}
+	return n
+}
+
+// runeBefore returns the rune preceding src[i], a space at the start of the text
+func runeBefore(src string, i int) rune {
+	if i == 0 {
+		return ' '
+	}
+	r, _ := utf8.DecodeLastRuneInString(src[:i])
+	return r
+}
+
+// runeAfter returns the rune at src[i], a space at the end of the text
+func runeAfter(src string, i int) rune {
+	if i >= len(src) {
+		return ' '
+	}
+	r, _ := utf8.DecodeRuneInString(src[i:])
+	return r
+}
+
+func isPunct(r rune) bool {
+	return unicode.IsPunct(r) || unicode.IsSymbol(r)
+}
+
+func isASCIIPunct(c byte) bool {
+	return c < utf8.RuneSelf && isPunct(rune(c))
+}
@@ -0,0 +1,387 @@
+// Package markdown parses Markdown manuscripts, with optional YAML front
+// matter for the book metadata
+package markdown
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/vpoluyaktov/biblio-ebook-parser/parser"
+)
+
+// DefaultChapterLevel is the deepest heading level that starts a chapter
+const DefaultChapterLevel = 2
+
+// Parser implements the parser.Parser interface for Markdown files
+type Parser struct {
+	// ChapterLevel is the deepest heading level that starts a new chapter
+	// (2 means h1 and h2). Deeper headings stay inside the chapter.
+	ChapterLevel int
+}
+
+// NewParser creates a new Markdown parser
+func NewParser() *Parser {
+	return &Parser{ChapterLevel: DefaultChapterLevel}
+}
+
+func init() {
+	// Register Markdown fast extractor
+	parser.RegisterExtractor("markdown", &Extractor{})
+}
+
+// Clone returns a copy of the parser, to configure without changing p
+func (p *Parser) Clone() parser.Parser {
+	clone := *p
+	return &clone
+}
+
+// Format returns the format identifier
+func (p *Parser) Format() string {
+	return "markdown"
+}
+
+// Parse extracts book structure from a Markdown file. Images with relative
+// paths are loaded from the file's directory.
+func (p *Parser) Parse(filePath string) (*parser.Book, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open Markdown: %w", err)
+	}
+
+	name := filepath.Base(filePath)
+	doc := &document{
+		chapterLevel: p.chapterLevel(),
+		baseDir:      filepath.Dir(filePath),
+		fileTitle:    strings.TrimSuffix(name, filepath.Ext(name)),
+	}
+	return doc.parse(string(data)), nil
+}
+
+// ParseReader extracts book structure from an io.ReaderAt. Images are not
+// loaded, as there is no directory to resolve them against.
+func (p *Parser) ParseReader(r io.ReaderAt, size int64) (*parser.Book, error) {
+	data, err := io.ReadAll(io.NewSectionReader(r, 0, size))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Markdown: %w", err)
+	}
+
+	doc := &document{chapterLevel: p.chapterLevel()}
+	return doc.parse(string(data)), nil
+}
+
+func (p *Parser) chapterLevel() int {
+	if p.ChapterLevel < 1 {
+		return DefaultChapterLevel
+	}
+	return p.ChapterLevel
+}
+
+var (
+	reATXHeading  = regexp.MustCompile(`^ {0,3}(#{1,6})(?:[ \t]+(.*?))?(?:[ \t]+#+)?[ \t]*$`)
+	reSetextLine  = regexp.MustCompile(`^ {0,3}(=+|-+)[ \t]*$`)
+	reThematic    = regexp.MustCompile(`^ {0,3}(?:(?:\*[ \t]*){3,}|(?:-[ \t]*){3,}|(?:_[ \t]*){3,})$`)
+	reFence       = regexp.MustCompile("^ {0,3}(`{3,}|~{3,})[ \t]*([^`\\s]*)")
+	reBulletItem  = regexp.MustCompile(`^ {0,3}[-+*][ \t]+(.*)$`)
+	reOrderedItem = regexp.MustCompile(`^ {0,3}([0-9]{1,9})[.)][ \t]+(.*)$`)
+	reQuoteMarker = regexp.MustCompile(`^ {0,3}> ?`)
+	reAttribution = regexp.MustCompile(`^(?:\x{2014}|\x{2015}|--)\s*`)
+)
+
+// document holds the parsing state of one Markdown file
+type document struct {
+	chapterLevel int
+	baseDir      string // Directory images are loaded from, empty to skip them
+	fileTitle    string
+
+	book     *parser.Book
+	chapters []parser.Chapter
+	levels   []int // Heading level that started each chapter, 0 for none
+}
+
+func (d *document) parse(src string) *parser.Book {
+	src = strings.ReplaceAll(src, "\r\n", "\n")
+	src = strings.TrimPrefix(src, "\uFEFF")
+	lines := strings.Split(src, "\n")
+
+	d.book = &parser.Book{}
+	if frontMatter, body, ok := splitFrontMatter(lines); ok {
+		values := parseFrontMatter(frontMatter)
+		applyFrontMatter(&d.book.Metadata, values)
+		d.loadCover(values)
+		lines = body
+	}
+
+	d.parseBlocks(lines)
+	d.finish()
+
+	return d.book
+}
+
+// parseBlocks walks the lines, collecting paragraphs and emitting the block
+// elements they form
+func (d *document) parseBlocks(lines []string) {
+	var para []string
+
+	flush := func() {
+		if len(para) > 0 {
+			d.paragraph(para)
+			para = nil
+		}
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+
+		if strings.TrimSpace(line) == "" {
+			flush()
+			continue
+		}
+
+		if m := reFence.FindStringSubmatch(line); m != nil {
+			flush()
+			fence := m[1]
+			var code []string
+			for i++; i < len(lines); i++ {
+				closing := strings.TrimSpace(lines[i])
+				if strings.HasPrefix(closing, fence) && strings.Trim(closing, fence[:1]) == "" {
+					break
+				}
+				code = append(code, lines[i])
+			}
+			d.add(&parser.Preformatted{Text: strings.Join(code, "\n"), Language: m[2]})
+			continue
+		}
+
+		if m := reATXHeading.FindStringSubmatch(line); m != nil {
+			flush()
+			d.heading(len(m[1]), m[2])
+			continue
+		}
+
+		if m := reSetextLine.FindStringSubmatch(line); m != nil && len(para) > 0 {
+			level := 2
+			if m[1][0] == '=' {
+				level = 1
+			}
+			d.heading(level, strings.Join(para, "\n"))
+			para = nil
+			continue
+		}
+
+		if reThematic.MatchString(line) {
+			// Scene breaks
+			flush()
+			d.add(&parser.EmptyLine{})
+			continue
+		}
+
+		if reQuoteMarker.MatchString(line) {
+			flush()
+			var quote []string
+			for ; i < len(lines); i++ {
+				if loc := reQuoteMarker.FindStringIndex(lines[i]); loc != nil {
+					quote = append(quote, lines[i][loc[1]:])
+				} else if strings.TrimSpace(lines[i]) != "" && len(quote) > 0 && strings.TrimSpace(quote[len(quote)-1]) != "" {
+					// Lazy continuation of the quoted paragraph
+					quote = append(quote, lines[i])
+				} else {
+					break
+				}
+			}
+			i--
+			d.blockquote(quote)
+			continue
+		}
+
+		if m := reBulletItem.FindStringSubmatch(line); m != nil {
+			flush()
+			para = []string{"• " + m[1]}
+			continue
+		}
+		if m := reOrderedItem.FindStringSubmatch(line); m != nil {
+			flush()
+			para = []string{m[1] + ". " + m[2]}
+			continue
+		}
+
+		para = append(para, strings.TrimLeft(line, " \t"))
+	}
+	flush()
+}
+
+// heading starts a new chapter, or adds a heading inside the current one
+func (d *document) heading(level int, src string) {
+	text, _ := renderInline(strings.TrimSpace(src))
+	heading := &parser.Heading{Text: text, Level: level}
+
+	if level > d.chapterLevel {
+		d.add(heading)
+		return
+	}
+
+	d.chapters = append(d.chapters, parser.Chapter{
+		ID:       fmt.Sprintf("chapter-%d", len(d.chapters)+1),
+		Title:    text,
+		Elements: []parser.Element{heading},
+		Role:     parser.RoleChapter,
+	})
+	d.levels = append(d.levels, level)
+}
+
+// paragraph adds a paragraph, or the images of a paragraph that holds
+// nothing else
+func (d *document) paragraph(lines []string) {
+	if images := d.images(lines); images != nil {
+		for _, img := range images {
+			d.add(img)
+		}
+		return
+	}
+
+	text, markup := renderInline(strings.TrimRight(strings.Join(lines, "\n"), " \t"))
+	d.add(&parser.Paragraph{Text: text, HTML: markup})
+}
+
+// images returns the images of a paragraph made only of "![alt](href)" lines
+func (d *document) images(lines []string) []parser.Element {
+	var images []parser.Element
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "![") {
+			return nil
+		}
+		alt, href, next, ok := link(line, 1)
+		if !ok || next != len(line) {
+			return nil
+		}
+		altText, _ := renderInline(alt)
+		images = append(images, &parser.Image{Alt: altText, Href: href, Data: d.loadImage(href)})
+	}
+	return images
+}
+
+// blockquote adds a quote. A quote opening a chapter is its epigraph, with a
+// last paragraph starting with a dash taken as the attribution.
+func (d *document) blockquote(lines []string) {
+	var paras []parser.Paragraph
+	var current []string
+
+	flush := func() {
+		if len(current) > 0 {
+			text, markup := renderInline(strings.Join(current, "\n"))
+			paras = append(paras, parser.Paragraph{Text: text, HTML: markup})
+			current = nil
+		}
+	}
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			flush()
+			continue
+		}
+		current = append(current, strings.TrimLeft(line, " \t"))
+	}
+	flush()
+
+	if len(paras) == 0 {
+		return
+	}
+
+	if !d.atChapterStart() {
+		d.add(&parser.Blockquote{Paragraphs: paras})
+		return
+	}
+
+	epigraph := &parser.Epigraph{Paragraphs: paras}
+	if last := paras[len(paras)-1].Text; len(paras) > 1 && reAttribution.MatchString(last) {
+		epigraph.Author = strings.TrimSpace(reAttribution.ReplaceAllString(last, ""))
+		epigraph.Paragraphs = paras[:len(paras)-1]
+	}
+	d.add(epigraph)
+}
+
+// atChapterStart reports whether nothing but the chapter heading was added yet
+func (d *document) atChapterStart() bool {
+	if len(d.chapters) == 0 {
+		return true
+	}
+	elements := d.chapters[len(d.chapters)-1].Elements
+	return len(elements) == 0 || (len(elements) == 1 && elements[0].Type() == parser.ElementTypeHeading)
+}
+
+// add appends an element to the current chapter. Text before the first
+// heading goes into an untitled opening chapter.
+func (d *document) add(elem parser.Element) {
+	if len(d.chapters) == 0 {
+		d.chapters = append(d.chapters, parser.Chapter{ID: "chapter-1", Role: parser.RoleChapter})
+		d.levels = append(d.levels, 0)
+	}
+	ch := &d.chapters[len(d.chapters)-1]
+	ch.Elements = append(ch.Elements, elem)
+}
+
+// finish sets the chapter TOC levels and the book title
+func (d *document) finish() {
+	m := &d.book.Metadata
+
+	// A lone h1 with nothing under it before the first chapter is the book title
+	h1 := 0
+	for _, level := range d.levels {
+		if level == 1 {
+			h1++
+		}
+	}
+	if h1 == 1 && d.chapterLevel > 1 && len(d.chapters) > 1 && d.levels[0] == 1 && len(d.chapters[0].Elements) == 1 {
+		if m.Title == "" {
+			m.Title = d.chapters[0].Title
+		}
+		d.chapters = d.chapters[1:]
+		d.levels = d.levels[1:]
+		for i := range d.chapters {
+			d.chapters[i].ID = fmt.Sprintf("chapter-%d", i+1)
+		}
+	}
+	if m.Title == "" {
+		m.Title = d.fileTitle
+	}
+
+	top := 0
+	for _, level := range d.levels {
+		if level > 0 && (top == 0 || level < top) {
+			top = level
+		}
+	}
+	for i, level := range d.levels {
+		if level > top {
+			d.chapters[i].Level = level - top
+		}
+	}
+
+	d.book.Content.Chapters = d.chapters
+}
+
+// loadImage reads an image referenced by a relative path
+func (d *document) loadImage(href string) []byte {
+	if d.baseDir == "" || href == "" || strings.Contains(href, ":") || filepath.IsAbs(href) {
+		return nil
+	}
+	data, err := os.ReadFile(filepath.Join(d.baseDir, filepath.FromSlash(href)))
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+// loadCover reads the image named by the "cover" front matter key
+func (d *document) loadCover(values map[string][]string) {
+	if len(values["cover"]) == 0 {
+		return
+	}
+	if data := d.loadImage(values["cover"][0]); len(data) > 0 {
+		d.book.SetCover(data, http.DetectContentType(data))
+	}
+}
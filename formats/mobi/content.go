@@ -0,0 +1,55 @@
+package mobi
+
+import (
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/vpoluyaktov/biblio-ebook-parser/parser"
+)
+
+var (
+	reHeadingStart = regexp.MustCompile(`(?i)<h([1-6])\b[^>]*>`)
+	reBlockEnd     = regexp.MustCompile(`(?i)</h[1-6]>|</?(?:p|div|blockquote|li|tr)\b[^>]*>|<br\s*/?>|<mbp:pagebreak\s*/?>`)
+	reTag          = regexp.MustCompile(`(?s)<[^>]*>`)
+	reSpaces       = regexp.MustCompile(`[ \t\x{00A0}]+`)
+)
+
+// headingMark starts a line that holds a heading, followed by its level
+const headingMark = "\uE000"
+
+// textElements converts the book markup to headings and paragraphs
+func textElements(markup string) []parser.Element {
+	// Drop everything before the body, such as the guide in <head>
+	if idx := strings.Index(strings.ToLower(markup), "<body"); idx >= 0 {
+		markup = markup[idx:]
+	}
+
+	markup = reHeadingStart.ReplaceAllString(markup, "\n"+headingMark+"$1")
+	markup = reBlockEnd.ReplaceAllString(markup, "\n")
+	markup = reTag.ReplaceAllString(markup, "")
+
+	var elements []parser.Element
+	for _, line := range strings.Split(markup, "\n") {
+		line = strings.TrimSpace(reSpaces.ReplaceAllString(html.UnescapeString(line), " "))
+
+		if strings.HasPrefix(line, headingMark) {
+			rest := strings.TrimPrefix(line, headingMark)
+			if rest == "" {
+				continue
+			}
+			level, _ := strconv.Atoi(rest[:1])
+			if text := strings.TrimSpace(rest[1:]); text != "" {
+				elements = append(elements, &parser.Heading{Text: text, Level: level})
+			}
+			continue
+		}
+
+		if line != "" {
+			elements = append(elements, &parser.Paragraph{Text: line})
+		}
+	}
+
+	return elements
+}
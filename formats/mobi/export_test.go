@@ -0,0 +1,6 @@
+package mobi
+
+// FixtureBook builds the book fixture, for the tests of package mobi_test
+func FixtureBook() []byte {
+	return book().build()
+}
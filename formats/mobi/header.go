@@ -0,0 +1,232 @@
+package mobi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/vpoluyaktov/biblio-ebook-parser/internal/charset"
+)
+
+// Compression types of the text records
+const (
+	compressionNone     = 1
+	compressionPalmDOC  = 2
+	compressionHuffCDIC = 17480
+)
+
+// EXTH record types
+const (
+	exthAuthor      = 100
+	exthPublisher   = 101
+	exthDescription = 103
+	exthISBN        = 104
+	exthSubject     = 105
+	exthPublished   = 106
+	exthCoverOffset = 201
+	exthTitle       = 503
+	exthLanguage    = 524
+)
+
+// noImage marks an unset image index or offset
+const noImage = 0xFFFFFFFF
+
+var (
+	// ErrUnsupportedCompression is returned when the text is HUFF/CDIC compressed
+	ErrUnsupportedCompression = errors.New("HUFF/CDIC compression is not supported")
+	// ErrEncrypted is returned for DRM-protected books
+	ErrEncrypted = errors.New("book is encrypted")
+)
+
+// database gives access to the records of a PalmDB file
+type database struct {
+	r       io.ReaderAt
+	name    string
+	offsets []uint32 // Record offsets, followed by the file size
+}
+
+// openDatabase reads the PalmDB header and record list
+func openDatabase(r io.ReaderAt, size int64) (*database, error) {
+	header := make([]byte, 78)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return nil, fmt.Errorf("failed to read PalmDB header: %w", err)
+	}
+
+	typeCreator := string(header[60:68])
+	if typeCreator != "BOOKMOBI" && typeCreator != "TEXtREAd" {
+		return nil, fmt.Errorf("not a MOBI file: type %q", typeCreator)
+	}
+
+	if size > math.MaxUint32 {
+		return nil, fmt.Errorf("MOBI file is too large: %d bytes", size)
+	}
+	count := int(binary.BigEndian.Uint16(header[76:]))
+	list := make([]byte, count*8)
+	if _, err := r.ReadAt(list, 78); err != nil {
+		return nil, fmt.Errorf("failed to read PalmDB record list: %w", err)
+	}
+
+	db := &database{
+		r:       r,
+		name:    string(bytes.TrimRight(header[:32], "\x00")),
+		offsets: make([]uint32, count+1),
+	}
+	// Records lie after the list, in order and within the file, so a
+	// crafted offset can't make record allocate more than the file size
+	prev := uint32(78 + count*8)
+	for i := 0; i < count; i++ {
+		offset := binary.BigEndian.Uint32(list[i*8:])
+		if offset < prev || int64(offset) > size {
+			return nil, fmt.Errorf("invalid offset %d of PalmDB record %d", offset, i)
+		}
+		db.offsets[i] = offset
+		prev = offset
+	}
+	db.offsets[count] = uint32(size)
+
+	return db, nil
+}
+
+// record returns the data of record i
+func (db *database) record(i int) ([]byte, error) {
+	if i < 0 || i >= len(db.offsets)-1 {
+		return nil, fmt.Errorf("record %d out of range", i)
+	}
+	start, end := db.offsets[i], db.offsets[i+1]
+	if end < start {
+		return nil, fmt.Errorf("record %d has invalid bounds", i)
+	}
+	data := make([]byte, end-start)
+	if _, err := db.r.ReadAt(data, int64(start)); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to read record %d: %w", i, err)
+	}
+	return data, nil
+}
+
+// header holds the fields of record 0 the parser uses
+type header struct {
+	compression   int
+	textLength    int
+	textRecords   int
+	encrypted     bool
+	encoding      string // Charset label of the text and EXTH strings
+	fullName      string
+	locale        uint32
+	firstImage    uint32
+	trailingFlags uint16 // Extra data appended to each text record
+	exth          map[int][][]byte
+}
+
+// readHeader parses the PalmDOC, MOBI and EXTH headers from record 0
+func readHeader(db *database) (*header, error) {
+	rec0, err := db.record(0)
+	if err != nil {
+		return nil, err
+	}
+	if len(rec0) < 16 {
+		return nil, fmt.Errorf("PalmDOC header is truncated")
+	}
+
+	h := &header{
+		compression: int(binary.BigEndian.Uint16(rec0[0:])),
+		textLength:  int(binary.BigEndian.Uint32(rec0[4:])),
+		textRecords: int(binary.BigEndian.Uint16(rec0[8:])),
+		encrypted:   binary.BigEndian.Uint16(rec0[12:]) != 0,
+		encoding:    "windows-1252",
+		fullName:    db.name,
+		firstImage:  noImage,
+	}
+
+	// Plain PalmDOC files end here
+	if len(rec0) < 132 || string(rec0[16:20]) != "MOBI" {
+		return h, nil
+	}
+
+	mobiLength := int(binary.BigEndian.Uint32(rec0[20:]))
+	if binary.BigEndian.Uint32(rec0[28:]) == 65001 {
+		h.encoding = "utf-8"
+	}
+	nameOffset := int(binary.BigEndian.Uint32(rec0[84:]))
+	nameLength := int(binary.BigEndian.Uint32(rec0[88:]))
+	if nameOffset > 0 && nameOffset+nameLength <= len(rec0) {
+		h.fullName = h.decode(rec0[nameOffset : nameOffset+nameLength])
+	}
+	h.locale = binary.BigEndian.Uint32(rec0[92:])
+	h.firstImage = binary.BigEndian.Uint32(rec0[108:])
+	if mobiLength >= 228 && len(rec0) >= 244 {
+		h.trailingFlags = binary.BigEndian.Uint16(rec0[242:])
+	}
+
+	exthFlags := binary.BigEndian.Uint32(rec0[128:])
+	if exthFlags&0x40 != 0 && 16+mobiLength < len(rec0) {
+		h.exth = parseEXTH(rec0[16+mobiLength:])
+	}
+
+	return h, nil
+}
+
+// parseEXTH parses the EXTH records, keyed by type. Malformed data ends the list.
+func parseEXTH(data []byte) map[int][][]byte {
+	records := make(map[int][][]byte)
+	if len(data) < 12 || string(data[:4]) != "EXTH" {
+		return records
+	}
+
+	count := int(binary.BigEndian.Uint32(data[8:]))
+	pos := 12
+	for i := 0; i < count && pos+8 <= len(data); i++ {
+		recType := int(binary.BigEndian.Uint32(data[pos:]))
+		length := int(binary.BigEndian.Uint32(data[pos+4:]))
+		if length < 8 || pos+length > len(data) {
+			break
+		}
+		records[recType] = append(records[recType], data[pos+8:pos+length])
+		pos += length
+	}
+	return records
+}
+
+// decode converts a string from the book encoding to UTF-8
+func (h *header) decode(data []byte) string {
+	r, err := charset.NewReader(h.encoding, bytes.NewReader(data))
+	if err != nil {
+		return string(data)
+	}
+	decoded, err := io.ReadAll(r)
+	if err != nil {
+		return string(data)
+	}
+	return strings.TrimSpace(string(decoded))
+}
+
+// exthString returns the first EXTH string of a type
+func (h *header) exthString(recType int) string {
+	if values := h.exth[recType]; len(values) > 0 {
+		return h.decode(values[0])
+	}
+	return ""
+}
+
+// exthStrings returns all EXTH strings of a type
+func (h *header) exthStrings(recType int) []string {
+	var values []string
+	for _, value := range h.exth[recType] {
+		if s := h.decode(value); s != "" {
+			values = append(values, s)
+		}
+	}
+	return values
+}
+
+// exthUint returns the first EXTH number of a type
+func (h *header) exthUint(recType int) (uint32, bool) {
+	values := h.exth[recType]
+	if len(values) == 0 || len(values[0]) < 4 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint32(values[0]), true
+}
@@ -0,0 +1,179 @@
+package mobi
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/vpoluyaktov/biblio-ebook-parser/parser"
+)
+
+// localeLanguages maps Windows primary language IDs, the low byte of the MOBI
+// locale, to language codes
+var localeLanguages = map[uint32]string{
+	0x04: "zh",
+	0x05: "cs",
+	0x06: "da",
+	0x07: "de",
+	0x08: "el",
+	0x09: "en",
+	0x0a: "es",
+	0x0b: "fi",
+	0x0c: "fr",
+	0x0e: "hu",
+	0x10: "it",
+	0x11: "ja",
+	0x12: "ko",
+	0x13: "nl",
+	0x14: "no",
+	0x15: "pl",
+	0x16: "pt",
+	0x19: "ru",
+	0x1d: "sv",
+	0x1f: "tr",
+	0x22: "uk",
+}
+
+// ExtractCoverOnly extracts only the cover image from a MOBI file without decompressing the text
+func ExtractCoverOnly(filePath string) ([]byte, string, error) {
+	f, size, err := openFile(filePath)
+	if err != nil {
+		return nil, "", err
+	}
+	defer f.Close()
+
+	return ExtractCoverOnlyReader(f, size)
+}
+
+// ExtractCoverOnlyReader extracts only the cover image from a MOBI reader without decompressing the text
+func ExtractCoverOnlyReader(r io.ReaderAt, size int64) ([]byte, string, error) {
+	db, err := openDatabase(r, size)
+	if err != nil {
+		return nil, "", err
+	}
+	h, err := readHeader(db)
+	if err != nil {
+		return nil, "", err
+	}
+	data, mimeType := cover(db, h)
+	return data, mimeType, nil
+}
+
+// ExtractAnnotationOnly extracts only the description from a MOBI file
+func ExtractAnnotationOnly(filePath string) (string, error) {
+	m, err := ExtractMetadataOnly(filePath)
+	return m.Description, err
+}
+
+// ExtractAnnotationOnlyReader extracts only the description from a MOBI reader
+func ExtractAnnotationOnlyReader(r io.ReaderAt, size int64) (string, error) {
+	m, err := ExtractMetadataOnlyReader(r, size)
+	return m.Description, err
+}
+
+// ExtractMetadataOnly extracts only metadata from a MOBI file without decompressing the text
+func ExtractMetadataOnly(filePath string) (parser.Metadata, error) {
+	f, size, err := openFile(filePath)
+	if err != nil {
+		return parser.Metadata{}, err
+	}
+	defer f.Close()
+
+	return ExtractMetadataOnlyReader(f, size)
+}
+
+// ExtractMetadataOnlyReader extracts only metadata from a MOBI reader without decompressing the text
+func ExtractMetadataOnlyReader(r io.ReaderAt, size int64) (parser.Metadata, error) {
+	db, err := openDatabase(r, size)
+	if err != nil {
+		return parser.Metadata{}, err
+	}
+	h, err := readHeader(db)
+	if err != nil {
+		return parser.Metadata{}, err
+	}
+
+	m := metadata(h)
+	m.SetCover(cover(db, h))
+	return m, nil
+}
+
+// metadata converts the header fields to book metadata. EXTH values take
+// precedence over the MOBI header.
+func metadata(h *header) parser.Metadata {
+	m := parser.Metadata{
+		Title:       h.exthString(exthTitle),
+		Description: h.exthString(exthDescription),
+		Publisher:   h.exthString(exthPublisher),
+		Language:    h.exthString(exthLanguage),
+		Genres:      h.exthStrings(exthSubject),
+	}
+
+	if m.Title == "" {
+		m.Title = h.fullName
+	}
+	if m.Language == "" {
+		m.Language = localeLanguages[h.locale&0xFF]
+	}
+
+	for _, name := range h.exthStrings(exthAuthor) {
+		// Several authors may share one record ("Author One & Author Two")
+		for _, part := range strings.Split(name, "&") {
+			if author := parser.ParseAuthor(part, ""); !author.IsEmpty() {
+				m.Authors = append(m.Authors, author)
+			}
+		}
+	}
+
+	for _, isbn := range h.exthStrings(exthISBN) {
+		m.Identifiers = append(m.Identifiers, parser.Identifier{Scheme: "isbn", Value: isbn})
+	}
+
+	if published := h.exthString(exthPublished); published != "" {
+		// Dates are usually ISO 8601 timestamps, only the date is kept
+		date, _, _ := strings.Cut(published, "T")
+		m.PublicationDate = date
+		m.PublicationTime = parser.ParseDate(date)
+		if year, err := strconv.Atoi(strings.SplitN(date, "-", 2)[0]); err == nil {
+			m.PublicationYear = year
+		}
+	}
+
+	return m
+}
+
+// cover returns the image the EXTH cover offset points to, relative to the
+// first image record
+func cover(db *database, h *header) ([]byte, string) {
+	offset, ok := h.exthUint(exthCoverOffset)
+	if !ok || offset == noImage || h.firstImage == noImage {
+		return nil, ""
+	}
+
+	data, err := db.record(int(h.firstImage) + int(offset))
+	if err != nil {
+		return nil, ""
+	}
+	mimeType := parser.ImageType(data, "")
+	if mimeType == "" {
+		return nil, ""
+	}
+	return data, mimeType
+}
+
+// openFile opens a file for reading as an io.ReaderAt
+func openFile(filePath string) (*os.File, int64, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to open MOBI: %w", err)
+	}
+
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	return f, stat.Size(), nil
+}
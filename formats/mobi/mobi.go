@@ -0,0 +1,71 @@
+// Package mobi reads Mobipocket (MOBI, AZW) books: metadata and cover from
+// the PalmDB, MOBI and EXTH headers, and the text of uncompressed and
+// PalmDOC-compressed books
+package mobi
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/vpoluyaktov/biblio-ebook-parser/parser"
+)
+
+// Parser implements the parser.Parser interface for MOBI files
+type Parser struct{}
+
+// NewParser creates a new MOBI parser
+func NewParser() *Parser {
+	return &Parser{}
+}
+
+func init() {
+	// Register MOBI fast extractor
+	parser.RegisterExtractor("mobi", &Extractor{})
+}
+
+// Format returns the format identifier
+func (p *Parser) Format() string {
+	return "mobi"
+}
+
+// Parse extracts book structure from a MOBI file. The text is returned as a
+// single chapter; HUFF/CDIC compressed books fail with ErrUnsupportedCompression,
+// but their metadata can still be read with ExtractMetadataOnly.
+func (p *Parser) Parse(filePath string) (*parser.Book, error) {
+	f, size, err := openFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return p.ParseReader(f, size)
+}
+
+// ParseReader extracts book structure from an io.ReaderAt
+func (p *Parser) ParseReader(r io.ReaderAt, size int64) (*parser.Book, error) {
+	db, err := openDatabase(r, size)
+	if err != nil {
+		return nil, err
+	}
+	h, err := readHeader(db)
+	if err != nil {
+		return nil, err
+	}
+
+	text, err := readText(db, h)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read MOBI text: %w", err)
+	}
+
+	book := &parser.Book{Metadata: metadata(h)}
+	book.SetCover(cover(db, h))
+
+	book.Content.Chapters = []parser.Chapter{{
+		ID:       "chapter-1",
+		Title:    book.Metadata.Title,
+		Elements: textElements(h.decode(text)),
+		Role:     parser.RoleChapter,
+	}}
+
+	return book, nil
+}
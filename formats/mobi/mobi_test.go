@@ -0,0 +1,355 @@
+package mobi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/vpoluyaktov/biblio-ebook-parser/parser"
+)
+
+// pngData is the start of a PNG, enough for type detection
+var pngData = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR\x00\x00\x00\x01\x00\x00\x00\x01\x08\x06\x00\x00\x00\x1f\x15\xc4\x89")
+
+// exthRecord is an EXTH record of a fixture
+type exthRecord struct {
+	Type int
+	Data []byte
+}
+
+// fixture describes a MOBI file to build
+type fixture struct {
+	Name        string // PalmDB name
+	FullName    string // MOBI full name
+	Compression int    // compressionNone if 0
+	Encrypted   bool
+	Locale      uint32
+	// Text records, written as given, so PalmDOC ones must be compressed
+	Text          [][]byte
+	TextLength    int // Length of the whole decompressed text
+	TrailingFlags uint16
+	EXTH          []exthRecord
+	Images        [][]byte
+}
+
+// build writes the fixture as a PalmDB file with a MOBI header
+func (f fixture) build() []byte {
+	compression := f.Compression
+	if compression == 0 {
+		compression = compressionNone
+	}
+	firstImage := uint32(1 + len(f.Text))
+
+	var exth []byte
+	for _, rec := range f.EXTH {
+		exth = binary.BigEndian.AppendUint32(exth, uint32(rec.Type))
+		exth = binary.BigEndian.AppendUint32(exth, uint32(len(rec.Data)+8))
+		exth = append(exth, rec.Data...)
+	}
+	exthHeader := append([]byte("EXTH"), make([]byte, 8)...)
+	binary.BigEndian.PutUint32(exthHeader[4:], uint32(12+len(exth)))
+	binary.BigEndian.PutUint32(exthHeader[8:], uint32(len(f.EXTH)))
+	exth = append(exthHeader, exth...)
+
+	mobi := make([]byte, 232)
+	copy(mobi, "MOBI")
+	binary.BigEndian.PutUint32(mobi[4:], 232)
+	binary.BigEndian.PutUint32(mobi[12:], 65001)
+	binary.BigEndian.PutUint32(mobi[68:], uint32(16+len(mobi)+len(exth)))
+	binary.BigEndian.PutUint32(mobi[72:], uint32(len(f.FullName)))
+	binary.BigEndian.PutUint32(mobi[76:], f.Locale)
+	binary.BigEndian.PutUint32(mobi[92:], firstImage)
+	binary.BigEndian.PutUint32(mobi[112:], 0x40)
+	binary.BigEndian.PutUint16(mobi[226:], f.TrailingFlags)
+
+	rec0 := make([]byte, 16)
+	binary.BigEndian.PutUint16(rec0[0:], uint16(compression))
+	binary.BigEndian.PutUint32(rec0[4:], uint32(f.TextLength))
+	binary.BigEndian.PutUint16(rec0[8:], uint16(len(f.Text)))
+	binary.BigEndian.PutUint16(rec0[10:], 4096)
+	if f.Encrypted {
+		binary.BigEndian.PutUint16(rec0[12:], 2)
+	}
+	rec0 = append(rec0, mobi...)
+	rec0 = append(rec0, exth...)
+	rec0 = append(rec0, f.FullName...)
+	rec0 = append(rec0, 0, 0)
+
+	records := append([][]byte{rec0}, f.Text...)
+	records = append(records, f.Images...)
+
+	header := make([]byte, 78)
+	copy(header, f.Name)
+	copy(header[60:], "BOOKMOBI")
+	binary.BigEndian.PutUint16(header[76:], uint16(len(records)))
+
+	offset := 78 + 8*len(records) + 2
+	data := header
+	for i, rec := range records {
+		data = binary.BigEndian.AppendUint32(data, uint32(offset))
+		data = binary.BigEndian.AppendUint32(data, uint32(i))
+		offset += len(rec)
+	}
+	data = append(data, 0, 0)
+	for _, rec := range records {
+		data = append(data, rec...)
+	}
+	return data
+}
+
+// book returns a fixture with full metadata, an uncompressed text and a cover
+func book() fixture {
+	text := "<html><body><h1>Chapter One</h1><p>It was a dark &amp; stormy night.</p><p>Second paragraph.</p></body></html>"
+	return fixture{
+		Name:       "Test_Book",
+		FullName:   "Full Name Title",
+		Locale:     0x409,
+		Text:       [][]byte{[]byte(text)},
+		TextLength: len(text),
+		EXTH: []exthRecord{
+			{exthAuthor, []byte("Jane Q. Public & John Doe")},
+			{exthPublisher, []byte("ACME")},
+			{exthDescription, []byte("A description")},
+			{exthISBN, []byte("9780000000001")},
+			{exthSubject, []byte("Fiction")},
+			{exthPublished, []byte("2010-05-01T00:00:00+00:00")},
+			{exthCoverOffset, binary.BigEndian.AppendUint32(nil, 0)},
+		},
+		Images: [][]byte{pngData},
+	}
+}
+
+func parse(data []byte) (*parser.Book, error) {
+	return NewParser().ParseReader(bytes.NewReader(data), int64(len(data)))
+}
+
+// chapterText joins the text of a chapter's headings and paragraphs by lines
+func chapterText(ch parser.Chapter) string {
+	var lines []string
+	for _, elem := range ch.Elements {
+		switch e := elem.(type) {
+		case *parser.Heading:
+			lines = append(lines, e.Text)
+		case *parser.Paragraph:
+			lines = append(lines, e.Text)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestExtractMetadata(t *testing.T) {
+	data := book().build()
+	m, err := ExtractMetadataOnlyReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("ExtractMetadataOnlyReader: %v", err)
+	}
+
+	if m.Title != "Full Name Title" {
+		t.Errorf("Title = %q, want the full name", m.Title)
+	}
+	if len(m.Authors) != 2 || m.Authors[0].FullName() != "Jane Q. Public" || m.Authors[1].LastName != "Doe" {
+		t.Errorf("Authors = %+v, want Jane Q. Public and John Doe", m.Authors)
+	}
+	if m.Publisher != "ACME" || m.Description != "A description" {
+		t.Errorf("Publisher, Description = %q, %q", m.Publisher, m.Description)
+	}
+	if len(m.Identifiers) != 1 || m.Identifiers[0].Scheme != "isbn" || m.Identifiers[0].Value != "9780000000001" {
+		t.Errorf("Identifiers = %+v, want the ISBN", m.Identifiers)
+	}
+	if len(m.Genres) != 1 || m.Genres[0] != "Fiction" {
+		t.Errorf("Genres = %v, want [Fiction]", m.Genres)
+	}
+	if m.Language != "en" {
+		t.Errorf("Language = %q, want en from the locale", m.Language)
+	}
+	if m.PublicationDate != "2010-05-01" || m.PublicationYear != 2010 {
+		t.Errorf("PublicationDate, PublicationYear = %q, %d", m.PublicationDate, m.PublicationYear)
+	}
+	if !bytes.Equal(m.CoverData, pngData) || m.CoverType != "image/png" {
+		t.Errorf("cover = %d bytes of %q, want the PNG", len(m.CoverData), m.CoverType)
+	}
+}
+
+func TestExtractMetadataEXTHOverrides(t *testing.T) {
+	f := book()
+	f.EXTH = append(f.EXTH, exthRecord{exthTitle, []byte("EXTH Title")}, exthRecord{exthLanguage, []byte("ru")})
+	data := f.build()
+
+	m, err := ExtractMetadataOnlyReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("ExtractMetadataOnlyReader: %v", err)
+	}
+	if m.Title != "EXTH Title" || m.Language != "ru" {
+		t.Errorf("Title, Language = %q, %q; want the EXTH values", m.Title, m.Language)
+	}
+}
+
+func TestExtractCover(t *testing.T) {
+	jpeg := []byte("\xff\xd8\xff\xe0\x00\x10JFIF\x00")
+	tests := []struct {
+		name     string
+		images   [][]byte
+		offset   uint32
+		wantData []byte
+		wantType string
+	}{
+		{"png", [][]byte{pngData}, 0, pngData, "image/png"},
+		{"jpeg second image", [][]byte{pngData, jpeg}, 1, jpeg, "image/jpeg"},
+		{"not an image", [][]byte{[]byte("plain text")}, 0, nil, ""},
+		{"offset past the records", [][]byte{pngData}, 5, nil, ""},
+		{"unset offset", [][]byte{pngData}, noImage, nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := book()
+			f.Images = tt.images
+			f.EXTH = append(f.EXTH[:len(f.EXTH)-1], exthRecord{exthCoverOffset, binary.BigEndian.AppendUint32(nil, tt.offset)})
+			data := f.build()
+
+			cover, mimeType, err := ExtractCoverOnlyReader(bytes.NewReader(data), int64(len(data)))
+			if err != nil {
+				t.Fatalf("ExtractCoverOnlyReader: %v", err)
+			}
+			if !bytes.Equal(cover, tt.wantData) || mimeType != tt.wantType {
+				t.Errorf("cover = %d bytes of %q, want %d bytes of %q", len(cover), mimeType, len(tt.wantData), tt.wantType)
+			}
+		})
+	}
+}
+
+func TestParseUncompressed(t *testing.T) {
+	data := book().build()
+	b, err := parse(data)
+	if err != nil {
+		t.Fatalf("ParseReader: %v", err)
+	}
+	if len(b.Content.Chapters) != 1 {
+		t.Fatalf("got %d chapters, want 1", len(b.Content.Chapters))
+	}
+	text := chapterText(b.Content.Chapters[0])
+	for _, want := range []string{"Chapter One", "It was a dark & stormy night.", "Second paragraph."} {
+		if !strings.Contains(text, want) {
+			t.Errorf("text %q does not contain %q", text, want)
+		}
+	}
+	if strings.Contains(text, "<p>") {
+		t.Errorf("text %q keeps markup", text)
+	}
+}
+
+func TestParsePalmDOC(t *testing.T) {
+	want := "<p>abcabcabc Hello world.</p>"
+	// Literals, a back reference of distance 3 and length 6, a space and
+	// character pair for " H", an escaped literal run and a trailing
+	// multibyte entry of one byte
+	compressed := []byte("<p>abc")
+	compressed = append(compressed, 0x80|byte((3<<3|3)>>8), byte(3<<3|3))
+	compressed = append(compressed, 'H'^0x80)
+	compressed = append(compressed, []byte("ello")...)
+	compressed = append(compressed, 0x02, ' ', 'w')
+	compressed = append(compressed, []byte("orld.</p>")...)
+	compressed = append(compressed, 0x00)
+
+	f := book()
+	f.Compression = compressionPalmDOC
+	f.TrailingFlags = 1
+	f.Text = [][]byte{compressed}
+	f.TextLength = len(want)
+	data := f.build()
+
+	if got := string(decompressPalmDOC(compressed[:len(compressed)-1])); got != want {
+		t.Fatalf("decompressPalmDOC = %q, want %q", got, want)
+	}
+	b, err := parse(data)
+	if err != nil {
+		t.Fatalf("ParseReader: %v", err)
+	}
+	if text := chapterText(b.Content.Chapters[0]); !strings.Contains(text, "abcabcabc Hello world.") {
+		t.Errorf("text = %q, want the decompressed paragraph", text)
+	}
+}
+
+func TestParseUnsupported(t *testing.T) {
+	huff := book()
+	huff.Compression = compressionHuffCDIC
+	encrypted := book()
+	encrypted.Encrypted = true
+
+	tests := []struct {
+		name string
+		f    fixture
+		want error
+	}{
+		{"huff/cdic", huff, ErrUnsupportedCompression},
+		{"encrypted", encrypted, ErrEncrypted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := tt.f.build()
+			if _, err := parse(data); !errors.Is(err, tt.want) {
+				t.Errorf("ParseReader error = %v, want %v", err, tt.want)
+			}
+			// The metadata can still be read
+			m, err := ExtractMetadataOnlyReader(bytes.NewReader(data), int64(len(data)))
+			if err != nil || m.Title != "Full Name Title" {
+				t.Errorf("ExtractMetadataOnlyReader = %q, %v", m.Title, err)
+			}
+		})
+	}
+}
+
+func TestOpenDatabaseRejectsBadOffsets(t *testing.T) {
+	setOffset := func(data []byte, record int, offset uint32) []byte {
+		data = bytes.Clone(data)
+		binary.BigEndian.PutUint32(data[78+record*8:], offset)
+		return data
+	}
+	valid := book().build()
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"offset past the end", setOffset(valid, 1, 0xF0000000)},
+		{"offsets out of order", setOffset(valid, 2, 100)},
+		{"offset inside the record list", setOffset(valid, 0, 10)},
+		{"not a MOBI", append(make([]byte, 60), []byte("TEXTtest")...)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var before, after runtime.MemStats
+			runtime.ReadMemStats(&before)
+			_, err := ExtractMetadataOnlyReader(bytes.NewReader(tt.data), int64(len(tt.data)))
+			runtime.ReadMemStats(&after)
+			if err == nil {
+				t.Error("ExtractMetadataOnlyReader succeeded")
+			}
+			if alloc := after.TotalAlloc - before.TotalAlloc; alloc > 1<<20 {
+				t.Errorf("allocated %d bytes for a %d byte file", alloc, len(tt.data))
+			}
+		})
+	}
+}
+
+func TestTrimTrailingEntries(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  []byte
+		flags uint16
+		want  string
+	}{
+		{"none", []byte("text"), 0, "text"},
+		{"multibyte", []byte("text\x01\x01"), 1, "text"},
+		{"size entry", []byte("text\x00\x82"), 2, "text"},
+		{"both", []byte("text\x00\x00\x82"), 3, "text"},
+		{"entry larger than record", []byte("t\x8f"), 2, ""},
+	}
+	for _, tt := range tests {
+		if got := string(trimTrailingEntries(tt.data, tt.flags)); got != tt.want {
+			t.Errorf("%s: trimTrailingEntries = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
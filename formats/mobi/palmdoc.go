@@ -0,0 +1,126 @@
+package mobi
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// readText decompresses the text records into the raw book markup
+func readText(db *database, h *header) ([]byte, error) {
+	if h.encrypted {
+		return nil, ErrEncrypted
+	}
+	if h.compression != compressionNone && h.compression != compressionPalmDOC {
+		if h.compression == compressionHuffCDIC {
+			return nil, ErrUnsupportedCompression
+		}
+		return nil, fmt.Errorf("unknown MOBI compression: %d", h.compression)
+	}
+
+	var text bytes.Buffer
+	for i := 1; i <= h.textRecords; i++ {
+		data, err := db.record(i)
+		if err != nil {
+			return nil, err
+		}
+		data = trimTrailingEntries(data, h.trailingFlags)
+		if h.compression == compressionPalmDOC {
+			data = decompressPalmDOC(data)
+		}
+		text.Write(data)
+	}
+
+	if h.textLength > 0 && text.Len() > h.textLength {
+		text.Truncate(h.textLength)
+	}
+	return text.Bytes(), nil
+}
+
+// trimTrailingEntries removes the extra data the flags say follows the text
+// of a record. Each flag above bit 0 adds an entry whose size is stored at its
+// end; bit 0 adds the bytes of a multibyte character split across records.
+func trimTrailingEntries(data []byte, flags uint16) []byte {
+	for flag := flags >> 1; flag != 0; flag >>= 1 {
+		if flag&1 == 0 {
+			continue
+		}
+		size := trailingEntrySize(data)
+		if size > len(data) {
+			return nil
+		}
+		data = data[:len(data)-size]
+	}
+
+	if flags&1 != 0 && len(data) > 0 {
+		size := int(data[len(data)-1]&0x3) + 1
+		if size > len(data) {
+			return nil
+		}
+		data = data[:len(data)-size]
+	}
+	return data
+}
+
+// trailingEntrySize decodes the backward-encoded size at the end of data
+func trailingEntrySize(data []byte) int {
+	start := len(data) - 4
+	if start < 0 {
+		start = 0
+	}
+	size := 0
+	for _, b := range data[start:] {
+		if b&0x80 != 0 {
+			size = 0
+		}
+		size = size<<7 | int(b&0x7F)
+	}
+	return size
+}
+
+// decompressPalmDOC expands PalmDOC LZ77 compressed data
+func decompressPalmDOC(data []byte) []byte {
+	out := make([]byte, 0, len(data)*2)
+
+	for i := 0; i < len(data); {
+		c := data[i]
+		i++
+
+		switch {
+		case c >= 0x01 && c <= 0x08:
+			// The next c bytes are literals
+			end := i + int(c)
+			if end > len(data) {
+				end = len(data)
+			}
+			out = append(out, data[i:end]...)
+			i = end
+
+		case c < 0x80:
+			out = append(out, c)
+
+		case c >= 0xC0:
+			// A space followed by a character
+			out = append(out, ' ', c^0x80)
+
+		default:
+			// A distance and length pair back into the output
+			if i >= len(data) {
+				return out
+			}
+			pair := int(c)<<8 | int(data[i])
+			i++
+			distance := (pair & 0x3FFF) >> 3
+			length := pair&0x07 + 3
+			if distance == 0 || distance > len(out) {
+				continue
+			}
+			// Copies can overlap the bytes they produce
+			start := len(out) - distance
+			for j := 0; j < length; j++ {
+				out = append(out, out[start+j])
+			}
+		}
+	}
+
+	return out
+}
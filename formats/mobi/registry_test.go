@@ -0,0 +1,34 @@
+package mobi_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/vpoluyaktov/biblio-ebook-parser/formats"
+	"github.com/vpoluyaktov/biblio-ebook-parser/formats/mobi"
+	"github.com/vpoluyaktov/biblio-ebook-parser/parser"
+)
+
+func TestRegistered(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "x.mobi")
+	if err := os.WriteFile(path, mobi.FixtureBook(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if format, err := parser.DetectFormat(path); err != nil || format != "mobi" {
+		t.Errorf("DetectFormat = %q, %v; want mobi", format, err)
+	}
+	m, err := parser.ExtractMetadataFromFile(path)
+	if err != nil || m.Title != "Full Name Title" {
+		t.Errorf("ExtractMetadataFromFile = %q, %v", m.Title, err)
+	}
+	cover, mimeType, err := parser.ExtractCoverFromFile(path)
+	if err != nil || len(cover) == 0 || mimeType != "image/png" {
+		t.Errorf("ExtractCoverFromFile = %d bytes of %q, %v", len(cover), mimeType, err)
+	}
+	book, err := parser.Parse("mobi", path)
+	if err != nil || len(book.Content.Chapters) != 1 {
+		t.Errorf("Parse = %v, want one chapter", err)
+	}
+}
@@ -0,0 +1,49 @@
+package txt
+
+import (
+	"io"
+
+	"github.com/vpoluyaktov/biblio-ebook-parser/parser"
+)
+
+// Extractor implements the FastExtractor interface for TXT files. Text files
+// have no cover or annotation, and their metadata needs a full parse.
+type Extractor struct{}
+
+// ExtractCoverFromFile returns no cover, as text files don't have one
+func (e *Extractor) ExtractCoverFromFile(filePath string) ([]byte, string, error) {
+	return nil, "", nil
+}
+
+// ExtractCoverFromReader returns no cover, as text files don't have one
+func (e *Extractor) ExtractCoverFromReader(r io.ReaderAt, size int64) ([]byte, string, error) {
+	return nil, "", nil
+}
+
+// ExtractAnnotationFromFile returns no annotation, as text files don't have one
+func (e *Extractor) ExtractAnnotationFromFile(filePath string) (string, error) {
+	return "", nil
+}
+
+// ExtractAnnotationFromReader returns no annotation, as text files don't have one
+func (e *Extractor) ExtractAnnotationFromReader(r io.ReaderAt, size int64) (string, error) {
+	return "", nil
+}
+
+// ExtractMetadataFromFile extracts metadata from a TXT file
+func (e *Extractor) ExtractMetadataFromFile(filePath string) (parser.Metadata, error) {
+	book, err := NewParser().Parse(filePath)
+	if err != nil {
+		return parser.Metadata{}, err
+	}
+	return book.Metadata, nil
+}
+
+// ExtractMetadataFromReader extracts metadata from a TXT reader
+func (e *Extractor) ExtractMetadataFromReader(r io.ReaderAt, size int64) (parser.Metadata, error) {
+	book, err := NewParser().ParseReader(r, size)
+	if err != nil {
+		return parser.Metadata{}, err
+	}
+	return book.Metadata, nil
+}
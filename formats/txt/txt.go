@@ -0,0 +1,277 @@
+// Package txt parses plain text books, recovering paragraphs and chapters
+// with conservative heuristics
+package txt
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/vpoluyaktov/biblio-ebook-parser/internal/charset"
+	"github.com/vpoluyaktov/biblio-ebook-parser/parser"
+)
+
+// Parser implements the parser.Parser interface for plain text files
+type Parser struct {
+	// DetectLanguage classifies the text to set the book language, which
+	// plain text doesn't declare
+	DetectLanguage bool
+}
+
+// NewParser creates a new TXT parser
+func NewParser() *Parser {
+	return &Parser{}
+}
+
+func init() {
+	// Register TXT fast extractor
+	parser.RegisterExtractor("txt", &Extractor{})
+}
+
+// Clone returns a copy of the parser, to configure without changing p
+func (p *Parser) Clone() parser.Parser {
+	clone := *p
+	return &clone
+}
+
+// Format returns the format identifier
+func (p *Parser) Format() string {
+	return "txt"
+}
+
+// Parse extracts book structure from a text file. The file name is used as
+// the title when the text doesn't start with one.
+func (p *Parser) Parse(filePath string) (*parser.Book, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open TXT: %w", err)
+	}
+
+	name := filepath.Base(filePath)
+	return p.parse(data, strings.TrimSuffix(name, filepath.Ext(name)))
+}
+
+// ParseReader extracts book structure from an io.ReaderAt
+func (p *Parser) ParseReader(r io.ReaderAt, size int64) (*parser.Book, error) {
+	data, err := io.ReadAll(io.NewSectionReader(r, 0, size))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read TXT: %w", err)
+	}
+
+	return p.parse(data, "")
+}
+
+func (p *Parser) parse(data []byte, fileTitle string) (*parser.Book, error) {
+	book, err := parseText(data, fileTitle)
+	if err != nil {
+		return nil, err
+	}
+	if p.DetectLanguage {
+		book.DetectLanguage()
+	}
+	book.LogWarnings("txt")
+	return book, nil
+}
+
+var (
+	// "Chapter 1", "Chapter IV. The Return", "Глава первая", "Part Two"
+	reChapterHeading = regexp.MustCompile(`(?i)^(chapter|part|book|prologue|epilogue|глава|часть|книга|пролог|эпилог)(\s+([0-9]+|[ivxlcdm]+|\p{L}+))?\s*([.:—–-]\s*(\S.*)?)?$`)
+	// "IV", "IV.", "12."
+	reNumberHeading = regexp.MustCompile(`^([IVXLCDM]+|[0-9]{1,3})\.?$`)
+	reBlankLines    = regexp.MustCompile(`\n[ \t]*\n`)
+	reIndent        = regexp.MustCompile(`^(\t| {2,})`)
+)
+
+// dialogueMarks start lines of dialogue
+const dialogueMarks = "—–-\"'«“„‘"
+
+// Limits that keep heading detection conservative
+const (
+	maxHeadingRunes = 80
+	maxCapsWords    = 8
+	maxTitleRunes   = 100
+)
+
+func parseText(data []byte, fileTitle string) (*parser.Book, error) {
+	text, err := decode(data)
+	if err != nil {
+		return nil, err
+	}
+
+	blocks := splitBlocks(text)
+	book := &parser.Book{}
+	book.Metadata.Title = fileTitle
+
+	// A short first line that isn't a chapter heading is taken as the title
+	if len(blocks) > 0 && isTitle(blocks[0]) {
+		book.Metadata.Title = strings.TrimSpace(blocks[0])
+		blocks = blocks[1:]
+	}
+
+	var chapters []parser.Chapter
+	var current *parser.Chapter
+
+	for _, block := range blocks {
+		if heading, ok := headingText(block); ok {
+			chapters = append(chapters, parser.Chapter{
+				ID:       fmt.Sprintf("chapter-%d", len(chapters)+1),
+				Title:    heading,
+				Elements: []parser.Element{&parser.Heading{Text: heading, Level: 1}},
+				Role:     parser.RoleChapter,
+			})
+			current = &chapters[len(chapters)-1]
+			continue
+		}
+
+		if current == nil {
+			// Text before the first heading goes into an untitled opening chapter
+			chapters = append(chapters, parser.Chapter{ID: "chapter-1", Role: parser.RoleChapter})
+			current = &chapters[len(chapters)-1]
+		}
+		for _, para := range splitParagraphs(block) {
+			current.Elements = append(current.Elements, &parser.Paragraph{Text: para})
+		}
+	}
+
+	book.Content.Chapters = chapters
+	return book, nil
+}
+
+// decode converts the text to UTF-8 using the detected encoding
+func decode(data []byte) (string, error) {
+	sample := data
+	if len(sample) > charset.SampleSize {
+		sample = sample[:charset.SampleSize]
+	}
+
+	label, bomLength := charset.Detect(sample, "")
+	if log := parser.Logger(); log != nil {
+		log.Debug("TXT charset detected", "charset", label)
+	}
+	r, err := charset.NewReader(label, bytes.NewReader(data[bomLength:]))
+	if err != nil {
+		return "", err
+	}
+
+	decoded, err := io.ReadAll(r)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode TXT: %w", err)
+	}
+
+	text := strings.ReplaceAll(string(decoded), "\r\n", "\n")
+	return strings.ReplaceAll(text, "\r", "\n"), nil
+}
+
+// splitBlocks splits the text on blank lines
+func splitBlocks(text string) []string {
+	var blocks []string
+	for _, block := range reBlankLines.Split(text, -1) {
+		if strings.TrimSpace(block) != "" {
+			blocks = append(blocks, strings.Trim(block, "\n"))
+		}
+	}
+	return blocks
+}
+
+// splitParagraphs splits a block into paragraphs. Indented lines start new
+// paragraphs; other lines are hard-wrapped continuations.
+func splitParagraphs(block string) []string {
+	var paras []string
+	var current []string
+
+	flush := func() {
+		if len(current) > 0 {
+			paras = append(paras, strings.Join(current, " "))
+			current = nil
+		}
+	}
+
+	for _, line := range strings.Split(block, "\n") {
+		if reIndent.MatchString(line) {
+			flush()
+		}
+		if line = strings.TrimSpace(line); line != "" {
+			current = append(current, line)
+		}
+	}
+	flush()
+
+	return paras
+}
+
+// headingText returns the chapter heading a block holds, if any: a single
+// short line that names a chapter, is a bare number, or is written in capitals.
+// A chapter line may be followed by a title line ("Chapter 1" / "The Return").
+func headingText(block string) (string, bool) {
+	lines := strings.Split(strings.TrimSpace(block), "\n")
+	for i := range lines {
+		lines[i] = strings.TrimSpace(lines[i])
+		if utf8.RuneCountInString(lines[i]) > maxHeadingRunes {
+			return "", false
+		}
+	}
+
+	switch {
+	case len(lines) == 1:
+		line := lines[0]
+		if reChapterHeading.MatchString(line) || reNumberHeading.MatchString(line) || isCapsLine(line) {
+			return line, true
+		}
+	case len(lines) == 2:
+		title := lines[1]
+		if strings.HasSuffix(title, ".") || strings.HasSuffix(title, ",") {
+			return "", false // More likely the first line of a paragraph
+		}
+		if reChapterHeading.MatchString(lines[0]) || reNumberHeading.MatchString(lines[0]) {
+			return strings.TrimRight(lines[0], ".") + ". " + title, true
+		}
+	}
+
+	return "", false
+}
+
+// isCapsLine reports whether a line is a short run of capitalized words
+// (e.g., "THE RETURN"), not a sentence, an abbreviation or shouted dialogue
+// ("— STOP!")
+func isCapsLine(line string) bool {
+	if len(strings.Fields(line)) > maxCapsWords || strings.HasSuffix(line, ",") {
+		return false
+	}
+	if strings.HasSuffix(line, "!") || strings.HasSuffix(line, "?") {
+		return false
+	}
+	if first, _ := utf8.DecodeRuneInString(line); strings.ContainsRune(dialogueMarks, first) {
+		return false
+	}
+
+	letters := 0
+	for _, r := range line {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		if !unicode.IsUpper(r) {
+			return false
+		}
+		letters++
+	}
+
+	return letters >= 3
+}
+
+// isTitle reports whether the first block looks like the book title
+func isTitle(block string) bool {
+	line := strings.TrimSpace(block)
+	if strings.Contains(line, "\n") || utf8.RuneCountInString(line) > maxTitleRunes {
+		return false
+	}
+	if reChapterHeading.MatchString(line) || reNumberHeading.MatchString(line) {
+		return false
+	}
+	return !strings.HasSuffix(line, ".") || strings.HasSuffix(line, "...")
+}
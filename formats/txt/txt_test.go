@@ -0,0 +1,209 @@
+package txt
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/text/encoding/charmap"
+
+	"github.com/vpoluyaktov/biblio-ebook-parser/parser"
+)
+
+// outline describes a book as its title, then each chapter's title and
+// paragraphs, one per line
+func outline(book *parser.Book) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "title: %s\n", book.Metadata.Title)
+	for _, ch := range book.Content.Chapters {
+		fmt.Fprintf(&b, "chapter %q\n", ch.Title)
+		for _, elem := range ch.Elements {
+			if p, ok := elem.(*parser.Paragraph); ok {
+				fmt.Fprintf(&b, "  %s\n", p.Text)
+			}
+		}
+	}
+	return b.String()
+}
+
+func parseBytes(t *testing.T, data []byte) *parser.Book {
+	t.Helper()
+	book, err := NewParser().ParseReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("ParseReader: %v", err)
+	}
+	return book
+}
+
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+const englishOutline = `title: The Hollow Road
+chapter ""
+  The wind had not let up for three days, and nobody on the farm remembered a spring like it.
+chapter "Chapter 1. The Return"
+  He came back on a Tuesday. The road was wet and the gate hung open.
+  Nobody came out to meet him.
+  "STOP!"
+  She did not stop.
+  "WHO'S THERE?"
+  OK.
+chapter "CHAPTER II. THE HILL"
+  The hill was higher than he remembered.
+chapter "III"
+  He slept in the barn.
+chapter "THE LAST HARVEST"
+  The rain came at last.
+chapter "Epilogue"
+  Nothing more was said of it.
+`
+
+const russianOutline = `title: Тихий берег
+chapter "Глава 1"
+  Утро выдалось холодным, и над рекой стоял густой туман.
+  — СТОЙ!
+  — КТО ИДЁТ?
+  Он остановился.
+chapter "Глава вторая. Возвращение"
+  Дорога шла вдоль берега.
+chapter "XII."
+  Ночью пошёл снег.
+chapter "ЧАСТЬ ТРЕТЬЯ"
+  Весной река разлилась.
+chapter "Эпилог"
+  Больше о нём не говорили.
+`
+
+func TestParseFixtures(t *testing.T) {
+	russian := readFixture(t, "russian.txt")
+	// KOI8-R has no dashes but the hyphen
+	koi8Text := bytes.ReplaceAll(russian, []byte("—"), []byte("-"))
+	koi8Outline := strings.ReplaceAll(russianOutline, "—", "-")
+	encode := func(cm *charmap.Charmap, text []byte) []byte {
+		data, err := cm.NewEncoder().Bytes(text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"english", readFixture(t, "english.txt"), englishOutline},
+		{"english with CRLF", bytes.ReplaceAll(readFixture(t, "english.txt"), []byte("\n"), []byte("\r\n")), englishOutline},
+		{"russian", russian, russianOutline},
+		{"russian with BOM", append([]byte{0xEF, 0xBB, 0xBF}, russian...), russianOutline},
+		{"russian in windows-1251", encode(charmap.Windows1251, russian), russianOutline},
+		{"russian in koi8-r", encode(charmap.KOI8R, koi8Text), koi8Outline},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := outline(parseBytes(t, tt.data)); got != tt.want {
+				t.Errorf("outline:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTitle(t *testing.T) {
+	tests := []struct {
+		name, text, want string
+	}{
+		{"first line", "The Title\n\nText.\n", "The Title"},
+		{"ellipsis", "Wait...\n\nText.\n", "Wait..."},
+		// Not a title: a sentence, a chapter heading, a wrapped paragraph
+		{"sentence", "It was a dark night.\n\nText.\n", ""},
+		{"chapter", "Chapter 1\n\nText.\n", ""},
+		{"number", "1.\n\nText.\n", ""},
+		{"two lines", "The Title\nand more\n\nText.\n", ""},
+		{"too long", strings.Repeat("Long ", 21) + "\n\nText.\n", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseBytes(t, []byte(tt.text)).Metadata.Title; got != tt.want {
+				t.Errorf("title = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// Without a title line, Parse falls back to the file name
+	path := filepath.Join(t.TempDir(), "Quiet Shore.txt")
+	if err := os.WriteFile(path, []byte("Chapter 1\n\nIt was a dark night.\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	book, err := NewParser().Parse(path)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if book.Metadata.Title != "Quiet Shore" {
+		t.Errorf("title = %q, want the file name", book.Metadata.Title)
+	}
+}
+
+func TestHeadingText(t *testing.T) {
+	tests := []struct {
+		block string
+		want  string // Empty if the block isn't a heading
+	}{
+		// Chapter names
+		{"Chapter 1", "Chapter 1"},
+		{"CHAPTER IV. The Return", "CHAPTER IV. The Return"},
+		{"Part Two", "Part Two"},
+		{"Prologue", "Prologue"},
+		{"Глава 12", "Глава 12"},
+		{"Глава первая: Начало", "Глава первая: Начало"},
+		{"Глава 3.", "Глава 3."},
+		{"Часть II", "Часть II"},
+		{"Эпилог", "Эпилог"},
+		{"Chapter 1\nThe Return", "Chapter 1. The Return"},
+		{"Глава 3.\nВстреча", "Глава 3. Встреча"},
+
+		// Roman and Arabic numbers
+		{"IV", "IV"},
+		{"XII.", "XII."},
+		{"12.", "12."},
+		{"  7  ", "7"},
+
+		// Capitals
+		{"THE RETURN", "THE RETURN"},
+		{"ВОЗВРАЩЕНИЕ ДОМОЙ", "ВОЗВРАЩЕНИЕ ДОМОЙ"},
+
+		// Shouted dialogue
+		{"— СТОЙ!", ""},
+		{"– КТО ТАМ?", ""},
+		{"- НАЗАД", ""},
+		{`"STOP!"`, ""},
+		{"«СТОЙ»", ""},
+		{"HELP!", ""},
+		{"WHO?", ""},
+
+		// Abbreviations, sentences and paragraphs
+		{"OK.", ""},
+		{"USA,", ""},
+		{"NATO, UN, EU,", ""},
+		{"Chapter and verse were quoted at him.", ""},
+		{"Chapter 1\nHe walked in.", ""},
+		{"The road was wet.", ""},
+		{"ONE TWO THREE FOUR FIVE SIX SEVEN EIGHT NINE", ""},
+		{"Chapter 1 " + strings.Repeat("x", maxHeadingRunes), ""},
+		{"Chapter 1\nThe Return\nThird line", ""},
+		{"MCMLXXXIV and more", ""},
+	}
+	for _, tt := range tests {
+		got, ok := headingText(tt.block)
+		if got != tt.want || ok != (tt.want != "") {
+			t.Errorf("headingText(%q) = %q, %v, want %q", tt.block, got, ok, tt.want)
+		}
+	}
+}
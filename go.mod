@@ -5,7 +5,6 @@ go 1.24.0
 require (
 	github.com/fogleman/gg v1.3.0
 	github.com/golang/freetype v0.0.0-20170609003504-e2365dfdc4a0
+	golang.org/x/image v0.36.0
 	golang.org/x/text v0.34.0
 )
-
-require golang.org/x/image v0.36.0 // indirect
@@ -0,0 +1,216 @@
+// Package charset detects and decodes the legacy encodings found in ebook
+// files, with heuristics tuned for Cyrillic texts
+package charset
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/ianaindex"
+	xunicode "golang.org/x/text/encoding/unicode"
+)
+
+// SampleSize is how much of a document is inspected to detect its encoding
+const SampleSize = 8192
+
+// cyrillicCandidates are the single-byte encodings considered when the declared
+// encoding doesn't decode the content
+var cyrillicCandidates = []struct {
+	label   string
+	charmap *charmap.Charmap
+}{
+	{"windows-1251", charmap.Windows1251},
+	{"koi8-r", charmap.KOI8R},
+	{"ibm866", charmap.CodePage866},
+}
+
+var reXMLEncoding = regexp.MustCompile(`^\s*<\?xml[^>]*?encoding\s*=\s*["']([^"']+)["']`)
+
+// DeclaredXML returns the canonical encoding an XML document declares in its
+// prolog, or "" if none. UTF-16 without a BOM is recognized from the zero
+// bytes of its "<?" start, as its declaration can't be read as ASCII.
+func DeclaredXML(sample []byte) string {
+	switch {
+	case bytes.HasPrefix(sample, []byte{'<', 0, '?', 0}):
+		return "utf-16le"
+	case bytes.HasPrefix(sample, []byte{0, '<', 0, '?'}):
+		return "utf-16be"
+	}
+	if m := reXMLEncoding.FindSubmatch(sample); m != nil {
+		return Canonical(string(m[1]))
+	}
+	return ""
+}
+
+// DecodeXML converts a whole XML document to UTF-8 and drops its BOM. The
+// encoding comes from the BOM or the declaration, checked against the content
+// as Detect does. The declaration is left as it is, so decoders must ignore it.
+func DecodeXML(data []byte) ([]byte, error) {
+	sample := data[:min(len(data), SampleSize)]
+	label, bomLength := Detect(sample, DeclaredXML(sample))
+	data = data[bomLength:]
+	if label == "utf-8" {
+		return data, nil
+	}
+
+	r, err := NewReader(label, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+// Detect determines the encoding of a document from a sample of its first
+// bytes and the encoding it declares (empty if none). A BOM wins, and its
+// length is returned; otherwise the declared encoding is validated against the
+// content and replaced by the best-scoring candidate when it clearly doesn't fit.
+func Detect(sample []byte, declared string) (label string, bomLength int) {
+	switch {
+	case bytes.HasPrefix(sample, []byte{0xEF, 0xBB, 0xBF}):
+		return "utf-8", 3
+	case bytes.HasPrefix(sample, []byte{0xFF, 0xFE}):
+		return "utf-16le", 2
+	case bytes.HasPrefix(sample, []byte{0xFE, 0xFF}):
+		return "utf-16be", 2
+	}
+
+	detected := declared
+	if detected == "" {
+		detected = "utf-8"
+	}
+
+	// UTF-16 without a BOM: the null bytes would break every heuristic below
+	if strings.HasPrefix(detected, "utf-16") || bytes.IndexByte(sample, 0) >= 0 {
+		return detected, 0
+	}
+
+	if isASCII(sample) {
+		return detected, 0
+	}
+	if validUTF8Prefix(sample) {
+		// Valid multi-byte UTF-8 is practically never produced by single-byte encodings
+		return "utf-8", 0
+	}
+
+	// Only second-guess declarations that commonly lie on Cyrillic books
+	if detected != "utf-8" && !isCyrillicEncoding(detected) {
+		return detected, 0
+	}
+
+	best, bestScore := "", -1
+	for _, c := range cyrillicCandidates {
+		score := cyrillicScore(c.charmap, sample)
+		if score > bestScore || (score == bestScore && c.label == detected) {
+			best, bestScore = c.label, score
+		}
+	}
+
+	return best, 0
+}
+
+// NewReader returns a reader that converts input from the given encoding to UTF-8.
+// Unknown encodings are passed through unchanged.
+func NewReader(label string, input io.Reader) (io.Reader, error) {
+	label = strings.ToLower(label)
+
+	switch label {
+	case "windows-1251":
+		return charmap.Windows1251.NewDecoder().Reader(input), nil
+	case "windows-1252":
+		return charmap.Windows1252.NewDecoder().Reader(input), nil
+	case "iso-8859-1", "latin1":
+		return charmap.ISO8859_1.NewDecoder().Reader(input), nil
+	case "koi8-r":
+		return charmap.KOI8R.NewDecoder().Reader(input), nil
+	case "koi8-u":
+		return charmap.KOI8U.NewDecoder().Reader(input), nil
+	case "utf-8", "":
+		return input, nil
+	case "utf-16", "utf-16le":
+		return xunicode.UTF16(xunicode.LittleEndian, xunicode.IgnoreBOM).NewDecoder().Reader(input), nil
+	case "utf-16be":
+		return xunicode.UTF16(xunicode.BigEndian, xunicode.IgnoreBOM).NewDecoder().Reader(input), nil
+	default:
+		enc, err := ianaindex.IANA.Encoding(label)
+		if err != nil {
+			return input, nil
+		}
+		if enc == nil {
+			return input, nil
+		}
+		return enc.NewDecoder().Reader(input), nil
+	}
+}
+
+// Canonical normalizes common aliases of an encoding label
+func Canonical(label string) string {
+	label = strings.ToLower(strings.TrimSpace(label))
+	switch label {
+	case "utf8":
+		return "utf-8"
+	case "cp1251", "win-1251", "windows1251", "x-cp1251":
+		return "windows-1251"
+	case "koi8r", "koi8":
+		return "koi8-r"
+	case "cp866", "866", "ibm-866":
+		return "ibm866"
+	case "latin1", "latin-1":
+		return "iso-8859-1"
+	}
+	return label
+}
+
+func isCyrillicEncoding(label string) bool {
+	for _, c := range cyrillicCandidates {
+		if c.label == label {
+			return true
+		}
+	}
+	return label == "koi8-u"
+}
+
+func isASCII(data []byte) bool {
+	for _, b := range data {
+		if b >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+// validUTF8Prefix reports whether data is valid UTF-8, tolerating a rune cut off at the end
+func validUTF8Prefix(data []byte) bool {
+	for cut := 0; cut < utf8.UTFMax && cut < len(data); cut++ {
+		if utf8.Valid(data[:len(data)-cut]) {
+			return true
+		}
+	}
+	return false
+}
+
+// cyrillicScore rates how plausible the decoded sample is as Cyrillic text.
+// Real text is dominated by lowercase letters, while decoding with the wrong
+// single-byte table swaps case or produces box-drawing and symbol characters.
+func cyrillicScore(cm *charmap.Charmap, sample []byte) int {
+	score := 0
+	for _, b := range sample {
+		if b < 0x80 {
+			continue
+		}
+		r := cm.DecodeByte(b)
+		switch {
+		case unicode.Is(unicode.Cyrillic, r) && unicode.IsLower(r):
+			score += 2
+		case unicode.Is(unicode.Cyrillic, r):
+			// Capitals are rare in running text
+		default:
+			score -= 2
+		}
+	}
+	return score
+}
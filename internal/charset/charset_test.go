@@ -0,0 +1,176 @@
+package charset_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"golang.org/x/text/encoding/charmap"
+
+	"github.com/vpoluyaktov/biblio-ebook-parser/internal/charset"
+)
+
+const russian = "Всё смешалось в доме Облонских. Жена узнала, что муж был в связи с бывшею в их доме француженкою-гувернанткой."
+
+func encode(t *testing.T, cm *charmap.Charmap, s string) []byte {
+	t.Helper()
+	data, err := cm.NewEncoder().Bytes([]byte(s))
+	if err != nil {
+		t.Fatalf("failed to encode: %v", err)
+	}
+	return data
+}
+
+func TestDetect(t *testing.T) {
+	cp1251 := encode(t, charmap.Windows1251, russian)
+	koi8 := encode(t, charmap.KOI8R, russian)
+	cp866 := encode(t, charmap.CodePage866, russian)
+	utf8 := []byte(russian)
+	tests := []struct {
+		name      string
+		sample    []byte
+		declared  string
+		want      string
+		bomLength int
+	}{
+		// Declarations that lie
+		{"utf-8 declared over windows-1251", cp1251, "utf-8", "windows-1251", 0},
+		{"windows-1251 declared over utf-8", utf8, "windows-1251", "utf-8", 0},
+		{"koi8-r declared over windows-1251", cp1251, "koi8-r", "windows-1251", 0},
+		{"windows-1251 declared over koi8-r", koi8, "windows-1251", "koi8-r", 0},
+
+		// Declarations that hold
+		{"windows-1251", cp1251, "windows-1251", "windows-1251", 0},
+		{"koi8-r", koi8, "koi8-r", "koi8-r", 0},
+		{"ibm866", cp866, "ibm866", "ibm866", 0},
+		{"utf-8", utf8, "utf-8", "utf-8", 0},
+
+		// No declaration
+		{"undeclared utf-8", utf8, "", "utf-8", 0},
+		{"undeclared windows-1251", cp1251, "", "windows-1251", 0},
+		{"undeclared koi8-r", koi8, "", "koi8-r", 0},
+		{"undeclared ibm866", cp866, "", "ibm866", 0},
+		{"undeclared ascii", []byte("Plain English."), "", "utf-8", 0},
+		{"declared ascii", []byte("Plain English."), "koi8-r", "koi8-r", 0},
+
+		// A UTF-8 rune cut off at the end of the sample
+		{"utf-8 cut short", utf8[:len(utf8)-1], "windows-1251", "utf-8", 0},
+		// Declarations of other scripts aren't second-guessed
+		{"iso-8859-1 over windows-1251", cp1251, "iso-8859-1", "iso-8859-1", 0},
+
+		// BOMs win over any declaration
+		{"utf-8 bom", append([]byte{0xEF, 0xBB, 0xBF}, cp1251...), "windows-1251", "utf-8", 3},
+		{"utf-16le bom", []byte{0xFF, 0xFE, '<', 0}, "utf-8", "utf-16le", 2},
+		{"utf-16be bom", []byte{0xFE, 0xFF, 0, '<'}, "", "utf-16be", 2},
+		{"utf-16 without bom", []byte{'<', 0, '?', 0}, "utf-16le", "utf-16le", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, bomLength := charset.Detect(tt.sample, tt.declared)
+			if got != tt.want || bomLength != tt.bomLength {
+				t.Errorf("Detect = %q, %d, want %q, %d", got, bomLength, tt.want, tt.bomLength)
+			}
+		})
+	}
+}
+
+func TestDeclaredXML(t *testing.T) {
+	tests := []struct {
+		name   string
+		sample string
+		want   string
+	}{
+		{"utf-8", `<?xml version="1.0" encoding="UTF-8"?><FictionBook/>`, "utf-8"},
+		{"alias", `<?xml version="1.0" encoding="cp1251"?>`, "windows-1251"},
+		{"single quotes and spaces", "  \n<?xml version='1.0' encoding = 'KOI8-R' ?>", "koi8-r"},
+		{"no encoding", `<?xml version="1.0"?><FictionBook/>`, ""},
+		{"no declaration", `<FictionBook encoding="utf-8"/>`, ""},
+		{"declaration not first", `<!-- x --><?xml version="1.0" encoding="koi8-r"?>`, ""},
+		{"empty", "", ""},
+		{"utf-16le without bom", "<\x00?\x00x\x00m\x00l\x00", "utf-16le"},
+		{"utf-16be without bom", "\x00<\x00?\x00x\x00m\x00l", "utf-16be"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := charset.DeclaredXML([]byte(tt.sample)); got != tt.want {
+				t.Errorf("DeclaredXML = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCanonical(t *testing.T) {
+	tests := map[string]string{
+		"UTF-8":          "utf-8",
+		"utf8":           "utf-8",
+		" Windows-1251 ": "windows-1251",
+		"CP1251":         "windows-1251",
+		"win-1251":       "windows-1251",
+		"windows1251":    "windows-1251",
+		"x-cp1251":       "windows-1251",
+		"KOI8R":          "koi8-r",
+		"koi8":           "koi8-r",
+		"cp866":          "ibm866",
+		"866":            "ibm866",
+		"IBM-866":        "ibm866",
+		"Latin1":         "iso-8859-1",
+		"latin-1":        "iso-8859-1",
+		"UTF-16LE":       "utf-16le",
+		"":               "",
+	}
+	for label, want := range tests {
+		if got := charset.Canonical(label); got != want {
+			t.Errorf("Canonical(%q) = %q, want %q", label, got, want)
+		}
+	}
+}
+
+func TestDecodeXML(t *testing.T) {
+	body := "<p>" + russian + "</p>"
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"utf-8", []byte(`<?xml version="1.0" encoding="utf-8"?>` + body)},
+		{"utf-8 with bom", []byte("\xEF\xBB\xBF<?xml version=\"1.0\"?>" + body)},
+		{"windows-1251 declared utf-8", append([]byte(`<?xml version="1.0" encoding="utf-8"?>`), encode(t, charmap.Windows1251, body)...)},
+		{"koi8-r undeclared", append([]byte(`<?xml version="1.0"?>`), encode(t, charmap.KOI8R, body)...)},
+		{"ibm866", append([]byte(`<?xml version="1.0" encoding="cp866"?>`), encode(t, charmap.CodePage866, body)...)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := charset.DecodeXML(tt.data)
+			if err != nil {
+				t.Fatalf("DecodeXML: %v", err)
+			}
+			if !bytes.HasSuffix(got, []byte(body)) || !bytes.HasPrefix(got, []byte("<?xml")) {
+				t.Errorf("DecodeXML = %q", got)
+			}
+		})
+	}
+}
+
+func TestNewReader(t *testing.T) {
+	for label, cm := range map[string]*charmap.Charmap{
+		"windows-1251": charmap.Windows1251,
+		"KOI8-R":       charmap.KOI8R,
+		"ibm866":       charmap.CodePage866,
+	} {
+		r, err := charset.NewReader(label, bytes.NewReader(encode(t, cm, russian)))
+		if err != nil {
+			t.Fatalf("NewReader(%q): %v", label, err)
+		}
+		if got, _ := io.ReadAll(r); string(got) != russian {
+			t.Errorf("%s decodes to %q", label, got)
+		}
+	}
+
+	// Unknown encodings pass the input through
+	r, err := charset.NewReader("x-unknown", bytes.NewReader([]byte("as is")))
+	if err != nil {
+		t.Fatalf("NewReader of an unknown encoding: %v", err)
+	}
+	if got, _ := io.ReadAll(r); string(got) != "as is" {
+		t.Errorf("unknown encoding reads %q", got)
+	}
+}
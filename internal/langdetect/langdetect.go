@@ -0,0 +1,140 @@
+// Package langdetect guesses the language of a text sample among a small set
+// of languages, scoring its trigrams and telltale letters against built-in
+// profiles
+package langdetect
+
+import (
+	"strings"
+	"unicode"
+)
+
+// MinLetters is the least number of letters a sample needs to be classified
+const MinLetters = 40
+
+// profile describes a language by its most frequent trigrams, in decreasing
+// order ('_' stands for a word boundary), and the letters that set it apart
+// from the other languages in the same script
+type profile struct {
+	lang     string
+	cyrillic bool
+	trigrams string
+	letters  string
+}
+
+var profiles = []profile{
+	{
+		lang:     "en",
+		trigrams: "_th the he_ _an and nd_ _of of_ _to ing ng_ _in ed_ to_ er_ in_ is_ _ha at_ _wa was es_ _he re_ on_ hat tha _be his ent ion for _fo _it it_ as_ her ere _wh",
+	},
+	{
+		lang:     "de",
+		trigrams: "en_ er_ _de der ie_ _di die sch ich ein che und _un nd_ _ei cht den in_ ine _da te_ gen ch_ es_ _ge _zu auf ung das _ni nic sie _si ber ten",
+		letters:  "äöüß",
+	},
+	{
+		lang:     "fr",
+		trigrams: "es_ _de de_ _le le_ ent _la la_ _et et_ que _qu les nt_ ion ue_ _pa re_ _un ait our _po men _co _en ne_ _il qui ous tio lle _se eur ur_ _au",
+		letters:  "èêçœàùâîûë",
+	},
+	{
+		lang:     "es",
+		trigrams: "de_ _de _la la_ os_ _qu que ue_ _el el_ es_ en_ _en as_ _lo _co ent _se ado _y_ con los _pa par ra_ _un una ien ión _po _es do_ _al",
+		letters:  "ñ¿¡áíóú",
+	},
+	{
+		lang:     "ru",
+		cyrillic: true,
+		trigrams: "_пр _по ого ть_ ени _на на_ то_ _не не_ ост ско ет_ ста про ал_ ся_ _и_ _в_ ова ных го_ ный _ка что _чт ере как ли_ ло_ его ыл_ был",
+		letters:  "ыэёъ",
+	},
+	{
+		lang:     "uk",
+		cyrillic: true,
+		trigrams: "_пр на_ _на ння _по ого _не не_ ати ти_ _за ськ _ви _що що_ ий_ ува _і_ _в_ ної від _ві ком ста про ять ся_ ли_ _ка енн ьки _як",
+		letters:  "іїєґ",
+	},
+}
+
+// letterWeight is how much each telltale letter counts. A trigram counts
+// between 1 and 2, depending on its rank.
+const letterWeight = 6
+
+// Detect returns the language of the text as an ISO 639-1 code ("en", "ru",
+// "uk", "de", "fr" or "es"), and a confidence between 0 and 1 telling how far
+// ahead of the runner-up it scored. The language is empty when the sample is
+// too short or written in another script.
+func Detect(text string) (string, float64) {
+	text = strings.ToLower(text)
+
+	var latin, cyrillic int
+	for _, r := range text {
+		switch {
+		case unicode.Is(unicode.Cyrillic, r):
+			cyrillic++
+		case unicode.Is(unicode.Latin, r):
+			latin++
+		}
+	}
+	if latin+cyrillic < MinLetters {
+		return "", 0
+	}
+	useCyrillic := cyrillic > latin
+
+	counts, total := trigrams(text)
+	if total == 0 {
+		return "", 0
+	}
+
+	best, second := "", 0.0
+	bestScore := 0.0
+	for _, p := range profiles {
+		if p.cyrillic != useCyrillic {
+			continue
+		}
+		score := p.score(text, counts) / float64(total)
+		switch {
+		case score > bestScore:
+			second = bestScore
+			best, bestScore = p.lang, score
+		case score > second:
+			second = score
+		}
+	}
+	if bestScore == 0 {
+		return "", 0
+	}
+
+	return best, (bestScore - second) / bestScore
+}
+
+// score sums the rank-weighted counts of the profile trigrams and telltale
+// letters found in the text
+func (p profile) score(text string, counts map[string]int) float64 {
+	ranked := strings.Fields(p.trigrams)
+	score := 0.0
+	for rank, trigram := range ranked {
+		weight := 1 + float64(len(ranked)-rank)/float64(len(ranked))
+		score += weight * float64(counts[strings.ReplaceAll(trigram, "_", " ")])
+	}
+	for _, r := range text {
+		if strings.ContainsRune(p.letters, r) {
+			score += letterWeight
+		}
+	}
+	return score
+}
+
+// trigrams counts the letter trigrams of the text, words padded with a
+// space on each side
+func trigrams(text string) (map[string]int, int) {
+	counts := make(map[string]int)
+	total := 0
+	for _, word := range strings.FieldsFunc(text, func(r rune) bool { return !unicode.IsLetter(r) }) {
+		runes := []rune(" " + word + " ")
+		for i := 0; i+3 <= len(runes); i++ {
+			counts[string(runes[i:i+3])]++
+			total++
+		}
+	}
+	return counts, total
+}
@@ -0,0 +1,69 @@
+package langdetect
+
+import "testing"
+
+// Short samples, a sentence or two each, as in a book's first paragraphs
+var samples = map[string][]string{
+	"ru": {
+		"Все счастливые семьи похожи друг на друга, каждая несчастливая семья несчастлива по-своему.",
+		"Всё смешалось в доме Облонских. Жена узнала, что муж был в связи с гувернанткой.",
+		"Мой дядя самых честных правил, когда не в шутку занемог.",
+		"В начале июля, в чрезвычайно жаркое время, под вечер, один молодой человек вышел из своей каморки.",
+		"Он не знал, что ему делать, и долго стоял у окна, глядя на пустую улицу.",
+		"Это было давно, ещё до войны, когда мы жили в маленьком городе на берегу реки.",
+		"— Куда ты идёшь? — спросила она. — Домой, — ответил он и ушёл не оглядываясь.",
+		"Профессор поднял глаза от книги и посмотрел на студента с явным неодобрением.",
+	},
+	"uk": {
+		"Реве та стогне Дніпр широкий, сердитий вітер завива, додолу верби гне високі.",
+		"Усі щасливі родини схожі між собою, кожна нещаслива родина нещаслива по-своєму.",
+		"Він не знав, що йому робити, і довго стояв біля вікна, дивлячись на порожню вулицю.",
+		"Це було давно, ще до війни, коли ми жили в маленькому місті на березі річки.",
+		"— Куди ти йдеш? — запитала вона. — Додому, — відповів він і пішов не озираючись.",
+		"Професор підвів очі від книжки й подивився на студента з явним несхваленням.",
+		"Зацвіла в долині червона калина, ніби засміялась дівчина-дитина.",
+		"Я пишу тобі листа, бо не можу більше мовчати про те, що сталося минулого літа.",
+	},
+	"en": {
+		"It was the best of times, it was the worst of times, it was the age of wisdom.",
+		"Happy families are all alike; every unhappy family is unhappy in its own way.",
+		"He did not know what to do, and stood for a long time at the window, looking at the empty street.",
+		"It was a long time ago, before the war, when we lived in a small town on the bank of a river.",
+		"\"Where are you going?\" she asked. \"Home,\" he answered, and left without looking back.",
+		"The professor looked up from his book and regarded the student with open disapproval.",
+		"Call me Ishmael. Some years ago, never mind how long precisely, I thought I would sail about.",
+		"In a hole in the ground there lived a hobbit, and that means comfort.",
+	},
+}
+
+func TestDetectShortSamples(t *testing.T) {
+	for lang, texts := range samples {
+		for _, text := range texts {
+			got, confidence := Detect(text)
+			if got != lang {
+				t.Errorf("Detect(%q) = %q (%.2f), want %q", text, got, confidence, lang)
+			} else if confidence <= 0 || confidence > 1 {
+				t.Errorf("Detect(%q) confidence = %v", text, confidence)
+			}
+		}
+	}
+}
+
+func TestDetectUndetermined(t *testing.T) {
+	tests := map[string]string{
+		"empty":        "",
+		"too short":    "Привет, как дела?",
+		"short latin":  "Hello there, how are you?",
+		"numbers":      "1 2 3 4 5 6 7 8 9 10 11 12 13 14 15 16 17 18 19 20 21 22 23 24 25 26 27 28",
+		"punctuation":  "... --- !!! ??? ... --- !!! ??? ... --- !!! ??? ... --- !!! ??? ... --- !!! ???",
+		"chinese":      "道可道，非常道。名可名，非常名。無名天地之始；有名萬物之母。故常無欲，以觀其妙；常有欲，以觀其徼。",
+		"greek":        "Ἄνδρα μοι ἔννεπε, μοῦσα, πολύτροπον, ὃς μάλα πολλὰ πλάγχθη, ἐπεὶ Τροίης ἱερὸν πτολίεθρον ἔπερσεν",
+		"hebrew":       "בְּרֵאשִׁית בָּרָא אֱלֹהִים אֵת הַשָּׁמַיִם וְאֵת הָאָרֶץ וְהָאָרֶץ הָיְתָה תֹהוּ וָבֹהוּ",
+		"one repeated": "ззззззззззззззззззззззззззззззззззззззззззззз",
+	}
+	for name, text := range tests {
+		if got, confidence := Detect(text); got != "" || confidence != 0 {
+			t.Errorf("%s: Detect(%q) = %q, %v, want undetermined", name, text, got, confidence)
+		}
+	}
+}
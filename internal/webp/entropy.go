@@ -0,0 +1,396 @@
+package webp
+
+import (
+	"container/heap"
+	"math/bits"
+)
+
+// token is a literal pixel, or a backward reference when length is non-zero
+type token struct {
+	argb   uint32
+	length int
+	dist   int // Distance code
+}
+
+// writeImage writes an entropy-coded image. The main image has a flag for
+// meta prefix codes, which sub-images don't.
+func writeImage(bw *bitWriter, argb []uint32, width int, main bool) {
+	tokens := backwardReferences(argb, width)
+
+	green := make([]uint32, 256+numLengthCodes)
+	red := make([]uint32, 256)
+	blue := make([]uint32, 256)
+	alpha := make([]uint32, 256)
+	dist := make([]uint32, numDistanceCodes)
+	for _, t := range tokens {
+		if t.length > 0 {
+			code, _, _ := prefixEncode(t.length)
+			green[256+code]++
+			code, _, _ = prefixEncode(t.dist)
+			dist[code]++
+			continue
+		}
+		green[(t.argb>>8)&0xff]++
+		red[(t.argb>>16)&0xff]++
+		blue[t.argb&0xff]++
+		alpha[t.argb>>24]++
+	}
+
+	bw.write(0, 1) // No color cache
+	if main {
+		bw.write(0, 1) // No meta prefix codes
+	}
+
+	codes := make([]*prefixCode, 5)
+	for i, histogram := range [][]uint32{green, red, blue, alpha, dist} {
+		codes[i] = writePrefixCode(bw, histogram)
+	}
+
+	for _, t := range tokens {
+		if t.length > 0 {
+			code, extraBits, extra := prefixEncode(t.length)
+			codes[0].write(bw, 256+code)
+			bw.write(extra, extraBits)
+			code, extraBits, extra = prefixEncode(t.dist)
+			codes[4].write(bw, code)
+			bw.write(extra, extraBits)
+			continue
+		}
+		codes[0].write(bw, int((t.argb>>8)&0xff))
+		codes[1].write(bw, int((t.argb>>16)&0xff))
+		codes[2].write(bw, int(t.argb&0xff))
+		codes[3].write(bw, int(t.argb>>24))
+	}
+}
+
+// backwardReferences finds repeated pixel runs with a greedy LZ77 search over
+// hash chains, also trying the pixel to the left and the one above
+func backwardReferences(argb []uint32, width int) []token {
+	const (
+		hashBits = 16
+		maxChain = 32
+	)
+
+	n := len(argb)
+	head := make([]int32, 1<<hashBits)
+	for i := range head {
+		head[i] = -1
+	}
+	prev := make([]int32, n)
+
+	hash := func(i int) uint32 {
+		return (argb[i]*0x1e35a7bd + argb[i+1]*0x9e3779b1) >> (32 - hashBits)
+	}
+	insert := func(i int) {
+		if i+1 < n {
+			h := hash(i)
+			prev[i] = head[h]
+			head[h] = int32(i)
+		}
+	}
+	matchLength := func(j, i int) int {
+		limit := min(maxMatchLength, n-i)
+		l := 0
+		for l < limit && argb[j+l] == argb[i+l] {
+			l++
+		}
+		return l
+	}
+
+	var tokens []token
+	for i := 0; i < n; {
+		bestLength, bestDist := 0, 0
+		try := func(j int) {
+			if j >= 0 && j < i && i-j <= maxDistance {
+				if l := matchLength(j, i); l > bestLength {
+					bestLength, bestDist = l, i-j
+				}
+			}
+		}
+		try(i - 1)
+		try(i - width)
+		if i+1 < n {
+			for j, depth := head[hash(i)], 0; j >= 0 && depth < maxChain; j, depth = prev[j], depth+1 {
+				try(int(j))
+			}
+		}
+
+		if bestLength < minMatchLength {
+			tokens = append(tokens, token{argb: argb[i]})
+			insert(i)
+			i++
+			continue
+		}
+
+		tokens = append(tokens, token{length: bestLength, dist: distanceCode(bestDist, width)})
+		for k := 0; k < bestLength; k++ {
+			insert(i + k)
+		}
+		i += bestLength
+	}
+	return tokens
+}
+
+// distanceCode maps a distance in pixels to a distance code. The two most
+// common neighbours have short codes, the others are offset by 120.
+func distanceCode(dist, width int) int {
+	switch dist {
+	case width:
+		return 1
+	case 1:
+		return 2
+	}
+	return dist + 120
+}
+
+// prefixEncode splits a length or distance code into its prefix symbol and
+// extra bits
+func prefixEncode(v int) (int, uint, uint32) {
+	d := v - 1
+	if d < 4 {
+		return d, 0, 0
+	}
+	high := bits.Len(uint(d)) - 1
+	second := (d >> (high - 1)) & 1
+	extraBits := uint(high - 1)
+	return 2*high + second, extraBits, uint32(d) & (1<<extraBits - 1)
+}
+
+// prefixCode is a canonical Huffman code
+type prefixCode struct {
+	lengths []uint8
+	codes   []uint16 // Bit-reversed, to be written least significant bit first
+}
+
+func (c *prefixCode) write(bw *bitWriter, symbol int) {
+	bw.write(uint32(c.codes[symbol]), uint(c.lengths[symbol]))
+}
+
+// Order in which code length code lengths are written
+var codeLengthOrder = [19]int{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+// writePrefixCode builds a prefix code for a histogram and writes it. One
+// or two symbols below 256 use the simple form; a single one takes no bits.
+func writePrefixCode(bw *bitWriter, histogram []uint32) *prefixCode {
+	var used []int
+	for symbol, count := range histogram {
+		if count > 0 {
+			used = append(used, symbol)
+		}
+	}
+
+	if len(used) <= 2 && (len(used) == 0 || used[len(used)-1] < 256) {
+		code := &prefixCode{lengths: make([]uint8, len(histogram)), codes: make([]uint16, len(histogram))}
+		if len(used) == 0 {
+			used = []int{0}
+		}
+		bw.write(1, 1)
+		bw.write(uint32(len(used)-1), 1)
+		if used[0] < 2 {
+			bw.write(0, 1)
+			bw.write(uint32(used[0]), 1)
+		} else {
+			bw.write(1, 1)
+			bw.write(uint32(used[0]), 8)
+		}
+		if len(used) == 2 {
+			bw.write(uint32(used[1]), 8)
+			code.lengths[used[0]], code.lengths[used[1]] = 1, 1
+			code.codes[used[1]] = 1
+		}
+		return code
+	}
+
+	if len(used) == 1 {
+		// A lone symbol would be coded with no bits, which the simple form
+		// can't express above 255: pair it with an unused one
+		histogram = append([]uint32(nil), histogram...)
+		histogram[(used[0]+1)%len(histogram)] = 1
+	}
+	code := newPrefixCode(histogram, 15)
+
+	// Code lengths are run-length coded with symbols 16-18
+	type clToken struct {
+		symbol    int
+		extraBits uint
+		extra     uint32
+	}
+	var tokens []clToken
+	prevLength := uint8(8)
+	for i := 0; i < len(code.lengths); {
+		length := code.lengths[i]
+		run := 1
+		for i+run < len(code.lengths) && code.lengths[i+run] == length {
+			run++
+		}
+		i += run
+
+		if length == 0 {
+			for run >= 3 {
+				if run >= 11 {
+					k := min(run, 138)
+					tokens = append(tokens, clToken{18, 7, uint32(k - 11)})
+					run -= k
+				} else {
+					tokens = append(tokens, clToken{17, 3, uint32(run - 3)})
+					run = 0
+				}
+			}
+		} else {
+			if length != prevLength {
+				tokens = append(tokens, clToken{symbol: int(length)})
+				prevLength = length
+				run--
+			}
+			for run >= 3 {
+				k := min(run, 6)
+				tokens = append(tokens, clToken{16, 2, uint32(k - 3)})
+				run -= k
+			}
+		}
+		for ; run > 0; run-- {
+			tokens = append(tokens, clToken{symbol: int(length)})
+		}
+	}
+
+	clHistogram := make([]uint32, 19)
+	for _, t := range tokens {
+		clHistogram[t.symbol]++
+	}
+	clUsed := 0
+	for _, count := range clHistogram {
+		if count > 0 {
+			clUsed++
+		}
+	}
+	if clUsed == 1 {
+		// Same as above, a single code length symbol would take no bits
+		for _, symbol := range codeLengthOrder {
+			if clHistogram[symbol] == 0 {
+				clHistogram[symbol] = 1
+				break
+			}
+		}
+	}
+	clCode := newPrefixCode(clHistogram, 7)
+
+	numCodes := 4
+	for i, symbol := range codeLengthOrder {
+		if clCode.lengths[symbol] > 0 {
+			numCodes = max(numCodes, i+1)
+		}
+	}
+
+	bw.write(0, 1) // Normal code
+	bw.write(uint32(numCodes-4), 4)
+	for _, symbol := range codeLengthOrder[:numCodes] {
+		bw.write(uint32(clCode.lengths[symbol]), 3)
+	}
+	bw.write(0, 1) // Lengths for the whole alphabet
+	for _, t := range tokens {
+		clCode.write(bw, t.symbol)
+		bw.write(t.extra, t.extraBits)
+	}
+
+	return code
+}
+
+// newPrefixCode builds a length-limited Huffman code for a histogram with at
+// least two used symbols. Small counts are raised until the limit holds.
+func newPrefixCode(histogram []uint32, limit int) *prefixCode {
+	lengths := make([]uint8, len(histogram))
+	for floor := uint32(1); ; floor *= 2 {
+		if huffmanLengths(histogram, floor, lengths) <= limit {
+			break
+		}
+	}
+
+	// Canonical codes, shorter first and by symbol within a length
+	code := &prefixCode{lengths: lengths, codes: make([]uint16, len(histogram))}
+	var count [16]int
+	for _, l := range lengths {
+		count[l]++
+	}
+	count[0] = 0
+	var next [16]int
+	c := 0
+	for l := 1; l < 16; l++ {
+		c = (c + count[l-1]) << 1
+		next[l] = c
+	}
+	for symbol, l := range lengths {
+		if l > 0 {
+			code.codes[symbol] = uint16(bits.Reverse16(uint16(next[l])) >> (16 - l))
+			next[l]++
+		}
+	}
+	return code
+}
+
+// huffmanLengths computes code lengths for the histogram, with counts below
+// floor raised to it, and returns the longest
+func huffmanLengths(histogram []uint32, floor uint32, lengths []uint8) int {
+	type node struct {
+		count       uint32
+		left, right int // Children, -1 for leaves
+		symbol      int
+	}
+
+	var nodes []node
+	h := &nodeHeap{}
+	for symbol, count := range histogram {
+		lengths[symbol] = 0
+		if count > 0 {
+			nodes = append(nodes, node{count: max(count, floor), left: -1, right: -1, symbol: symbol})
+			h.items = append(h.items, heapItem{len(nodes) - 1, max(count, floor)})
+		}
+	}
+	heap.Init(h)
+
+	for h.Len() > 1 {
+		a := heap.Pop(h).(heapItem)
+		b := heap.Pop(h).(heapItem)
+		nodes = append(nodes, node{count: a.count + b.count, left: a.node, right: b.node})
+		heap.Push(h, heapItem{len(nodes) - 1, a.count + b.count})
+	}
+
+	longest := 0
+	var walk func(i, depth int)
+	walk = func(i, depth int) {
+		if nodes[i].left < 0 {
+			lengths[nodes[i].symbol] = uint8(depth)
+			longest = max(longest, depth)
+			return
+		}
+		walk(nodes[i].left, depth+1)
+		walk(nodes[i].right, depth+1)
+	}
+	walk(len(nodes)-1, 0)
+	return longest
+}
+
+type heapItem struct {
+	node  int
+	count uint32
+}
+
+// nodeHeap orders tree nodes by count, then by index so equal counts give
+// the same code every time
+type nodeHeap struct {
+	items []heapItem
+}
+
+func (h *nodeHeap) Len() int { return len(h.items) }
+func (h *nodeHeap) Less(i, j int) bool {
+	if h.items[i].count != h.items[j].count {
+		return h.items[i].count < h.items[j].count
+	}
+	return h.items[i].node < h.items[j].node
+}
+func (h *nodeHeap) Swap(i, j int)      { h.items[i], h.items[j] = h.items[j], h.items[i] }
+func (h *nodeHeap) Push(x interface{}) { h.items = append(h.items, x.(heapItem)) }
+func (h *nodeHeap) Pop() interface{} {
+	item := h.items[len(h.items)-1]
+	h.items = h.items[:len(h.items)-1]
+	return item
+}
@@ -0,0 +1,161 @@
+package webp
+
+// predict applies the predictor transform. Each block picks the predictor
+// mode with the smallest residuals. It returns the mode image, with the mode
+// in the green channel, and the residual image.
+func predict(argb []uint32, width, height int) ([]uint32, []uint32) {
+	blocksX, blocksY := subSampleSize(width), subSampleSize(height)
+	modes := make([]uint32, blocksX*blocksY)
+	residuals := make([]uint32, len(argb))
+
+	for by := 0; by < blocksY; by++ {
+		for bx := 0; bx < blocksX; bx++ {
+			x0, y0 := bx<<predictorBits, by<<predictorBits
+			x1, y1 := min(x0+1<<predictorBits, width), min(y0+1<<predictorBits, height)
+
+			best, bestCost := 0, -1
+			for mode := 0; mode < 14; mode++ {
+				cost := 0
+				for y := y0; y < y1 && (bestCost < 0 || cost < bestCost); y++ {
+					for x := x0; x < x1; x++ {
+						cost += residualCost(subPixels(argb[y*width+x], predictPixel(argb, width, x, y, mode)))
+					}
+				}
+				if bestCost < 0 || cost < bestCost {
+					best, bestCost = mode, cost
+				}
+			}
+
+			modes[by*blocksX+bx] = 0xff000000 | uint32(best)<<8
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					i := y*width + x
+					residuals[i] = subPixels(argb[i], predictPixel(argb, width, x, y, best))
+				}
+			}
+		}
+	}
+
+	return modes, residuals
+}
+
+// predictPixel returns the prediction for the pixel at x, y. The top row and
+// left column use fixed predictors whatever the mode.
+func predictPixel(argb []uint32, width, x, y, mode int) uint32 {
+	i := y*width + x
+	switch {
+	case x == 0 && y == 0:
+		return 0xff000000
+	case y == 0:
+		return argb[i-1]
+	case x == 0:
+		return argb[i-width]
+	}
+
+	// For the last column, the top-right pixel is the first of the current
+	// row, which is where the index lands
+	l, t, tl, tr := argb[i-1], argb[i-width], argb[i-width-1], argb[i-width+1]
+	switch mode {
+	case 0:
+		return 0xff000000
+	case 1:
+		return l
+	case 2:
+		return t
+	case 3:
+		return tr
+	case 4:
+		return tl
+	case 5:
+		return average2(average2(l, tr), t)
+	case 6:
+		return average2(l, tl)
+	case 7:
+		return average2(l, t)
+	case 8:
+		return average2(tl, t)
+	case 9:
+		return average2(t, tr)
+	case 10:
+		return average2(average2(l, tl), average2(t, tr))
+	case 11:
+		return selectPixel(l, t, tl)
+	case 12:
+		return clampAddSubtractFull(l, t, tl)
+	default:
+		return clampAddSubtractHalf(average2(l, t), tl)
+	}
+}
+
+func channel(p uint32, shift uint) int {
+	return int(p>>shift) & 0xff
+}
+
+func average2(a, b uint32) uint32 {
+	var p uint32
+	for shift := uint(0); shift < 32; shift += 8 {
+		p |= uint32((channel(a, shift)+channel(b, shift))/2) << shift
+	}
+	return p
+}
+
+func selectPixel(l, t, tl uint32) uint32 {
+	predL, predT := 0, 0
+	for shift := uint(0); shift < 32; shift += 8 {
+		estimate := channel(l, shift) + channel(t, shift) - channel(tl, shift)
+		predL += abs(estimate - channel(l, shift))
+		predT += abs(estimate - channel(t, shift))
+	}
+	if predL < predT {
+		return l
+	}
+	return t
+}
+
+func clampAddSubtractFull(a, b, c uint32) uint32 {
+	var p uint32
+	for shift := uint(0); shift < 32; shift += 8 {
+		p |= uint32(clamp(channel(a, shift)+channel(b, shift)-channel(c, shift))) << shift
+	}
+	return p
+}
+
+func clampAddSubtractHalf(a, b uint32) uint32 {
+	var p uint32
+	for shift := uint(0); shift < 32; shift += 8 {
+		ca := channel(a, shift)
+		p |= uint32(clamp(ca+(ca-channel(b, shift))/2)) << shift
+	}
+	return p
+}
+
+// subPixels subtracts b from a channel by channel, modulo 256
+func subPixels(a, b uint32) uint32 {
+	var p uint32
+	for shift := uint(0); shift < 32; shift += 8 {
+		p |= uint32((channel(a, shift)-channel(b, shift))&0xff) << shift
+	}
+	return p
+}
+
+// residualCost estimates how well a residual compresses: small values in
+// either direction are cheap
+func residualCost(p uint32) int {
+	cost := 0
+	for shift := uint(0); shift < 32; shift += 8 {
+		v := channel(p, shift)
+		cost += min(v, 256-v)
+	}
+	return cost
+}
+
+func clamp(v int) int {
+	return max(0, min(v, 255))
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,128 @@
+// Package webp encodes images as lossless WebP (VP8L). It implements the
+// subset of the format needed for good compression of generated images: the
+// subtract-green and predictor transforms, LZ77 backward references and
+// canonical Huffman codes, without color caches or meta prefix codes.
+package webp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+)
+
+const (
+	maxDimension = 1 << 14
+
+	// Log2 of the predictor transform block size
+	predictorBits = 5
+
+	numLengthCodes   = 24
+	numDistanceCodes = 40
+	maxMatchLength   = 4096
+	maxDistance      = 1<<20 - 120 // Largest distance the 40 distance codes reach
+	minMatchLength   = 3
+)
+
+// EncodeLossless writes img to w as a lossless WebP file
+func EncodeLossless(w io.Writer, img image.Image) error {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width < 1 || height < 1 || width > maxDimension || height > maxDimension {
+		return fmt.Errorf("invalid WebP image size: %dx%d", width, height)
+	}
+
+	argb := make([]uint32, width*height)
+	opaque := true
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := color.NRGBAModel.Convert(img.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.NRGBA)
+			argb[y*width+x] = uint32(c.A)<<24 | uint32(c.R)<<16 | uint32(c.G)<<8 | uint32(c.B)
+			opaque = opaque && c.A == 0xff
+		}
+	}
+
+	bw := &bitWriter{}
+	bw.write(0x2f, 8) // Signature
+	bw.write(uint32(width-1), 14)
+	bw.write(uint32(height-1), 14)
+	if opaque {
+		bw.write(0, 1)
+	} else {
+		bw.write(1, 1)
+	}
+	bw.write(0, 3) // Version
+
+	// Transforms, inverted by the decoder in reverse order
+	subtractGreen(argb)
+	bw.write(1, 1)
+	bw.write(2, 2)
+
+	modes, residuals := predict(argb, width, height)
+	bw.write(1, 1)
+	bw.write(0, 2)
+	bw.write(predictorBits-2, 3)
+	writeImage(bw, modes, subSampleSize(width), false)
+
+	bw.write(0, 1) // No more transforms
+
+	writeImage(bw, residuals, width, true)
+
+	data := bw.bytes()
+	padded := len(data) + len(data)&1
+
+	header := make([]byte, 20)
+	copy(header[0:], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], uint32(12+padded))
+	copy(header[8:], "WEBPVP8L")
+	binary.LittleEndian.PutUint32(header[16:], uint32(len(data)))
+	if len(data)&1 == 1 {
+		data = append(data, 0)
+	}
+
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+// subtractGreen subtracts the green channel from red and blue
+func subtractGreen(argb []uint32) {
+	for i, p := range argb {
+		g := (p >> 8) & 0xff
+		r := ((p >> 16) - g) & 0xff
+		b := (p - g) & 0xff
+		argb[i] = p&0xff00ff00 | r<<16 | b
+	}
+}
+
+func subSampleSize(size int) int {
+	return (size + 1<<predictorBits - 1) >> predictorBits
+}
+
+// bitWriter packs bits least significant first
+type bitWriter struct {
+	buf  []byte
+	acc  uint64
+	nbit uint
+}
+
+func (w *bitWriter) write(v uint32, n uint) {
+	w.acc |= uint64(v) << w.nbit
+	w.nbit += n
+	for w.nbit >= 8 {
+		w.buf = append(w.buf, byte(w.acc))
+		w.acc >>= 8
+		w.nbit -= 8
+	}
+}
+
+func (w *bitWriter) bytes() []byte {
+	if w.nbit > 0 {
+		w.buf = append(w.buf, byte(w.acc))
+		w.acc, w.nbit = 0, 0
+	}
+	return w.buf
+}
@@ -0,0 +1,108 @@
+package webp_test
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"math/rand/v2"
+	"testing"
+
+	xwebp "golang.org/x/image/webp"
+
+	"github.com/vpoluyaktov/biblio-ebook-parser/internal/webp"
+)
+
+// fill returns a width×height image with the colors f gives
+func fill(width, height int, f func(x, y int) color.NRGBA) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := range height {
+		for x := range width {
+			img.SetNRGBA(x, y, f(x, y))
+		}
+	}
+	return img
+}
+
+func TestEncodeLosslessRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	noise := func(int, int) color.NRGBA {
+		v := rng.Uint32()
+		return color.NRGBA{uint8(v), uint8(v >> 8), uint8(v >> 16), 0xff}
+	}
+	gray := image.NewGray(image.Rect(0, 0, 40, 30))
+	for i := range gray.Pix {
+		gray.Pix[i] = uint8(i * 7)
+	}
+
+	tests := []struct {
+		name string
+		img  image.Image
+	}{
+		{"single pixel", fill(1, 1, func(int, int) color.NRGBA { return color.NRGBA{0x12, 0x34, 0x56, 0xff} })},
+		{"solid", fill(64, 64, func(int, int) color.NRGBA { return color.NRGBA{0xc0, 0x30, 0x20, 0xff} })},
+		{"gradient", fill(256, 64, func(x, y int) color.NRGBA { return color.NRGBA{uint8(x), uint8(y * 4), uint8(x + y), 0xff} })},
+		{"alpha", fill(48, 48, func(x, y int) color.NRGBA {
+			// Colors under transparent pixels are kept too
+			return color.NRGBA{uint8(x * 5), 0x80, uint8(y * 5), uint8(x * y)}
+		})},
+		{"odd size", fill(33, 17, func(x, y int) color.NRGBA { return color.NRGBA{uint8(x * y), uint8(x), uint8(y), 0xff} })},
+		{"one row", fill(1000, 1, func(x, _ int) color.NRGBA { return color.NRGBA{uint8(x / 4), 0, 0xff, 0xff} })},
+		{"one column", fill(1, 1000, func(_, y int) color.NRGBA { return color.NRGBA{0, uint8(y / 4), 0, 0xff} })},
+		// Several predictor blocks each way, with a partial block at the edges
+		{"several tiles", fill(100, 70, func(x, y int) color.NRGBA {
+			if (x/32+y/32)%2 == 0 {
+				return color.NRGBA{uint8(x), uint8(y), 0, 0xff}
+			}
+			return color.NRGBA{0, uint8(x * 3), uint8(y * 3), uint8(200 + x%50)}
+		})},
+		{"noise", fill(97, 61, noise)},
+		// Repeats longer than the longest match, far back
+		{"stripes", fill(640, 200, func(x, y int) color.NRGBA { return color.NRGBA{uint8(y % 3 * 90), uint8(x % 7), 0x40, 0xff} })},
+		{"gray", gray},
+		{"offset bounds", fill(50, 40, func(x, y int) color.NRGBA { return color.NRGBA{uint8(x), uint8(y), 0x99, 0xff} }).SubImage(image.Rect(10, 5, 45, 31))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := webp.EncodeLossless(&buf, tt.img); err != nil {
+				t.Fatalf("EncodeLossless: %v", err)
+			}
+			decoded, err := xwebp.Decode(bytes.NewReader(buf.Bytes()))
+			if err != nil {
+				t.Fatalf("failed to decode: %v", err)
+			}
+
+			bounds := tt.img.Bounds()
+			if decoded.Bounds().Dx() != bounds.Dx() || decoded.Bounds().Dy() != bounds.Dy() {
+				t.Fatalf("decoded size %v, want %v", decoded.Bounds().Size(), bounds.Size())
+			}
+			for y := range bounds.Dy() {
+				for x := range bounds.Dx() {
+					want := color.NRGBAModel.Convert(tt.img.At(bounds.Min.X+x, bounds.Min.Y+y))
+					got := color.NRGBAModel.Convert(decoded.At(decoded.Bounds().Min.X+x, decoded.Bounds().Min.Y+y))
+					if got != want {
+						t.Fatalf("pixel (%d, %d) = %v, want %v", x, y, got, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestEncodeLosslessSize(t *testing.T) {
+	for _, size := range []image.Point{{0, 0}, {0, 10}, {10, 0}, {1<<14 + 1, 1}, {1, 1<<14 + 1}} {
+		var buf bytes.Buffer
+		if err := webp.EncodeLossless(&buf, image.NewNRGBA(image.Rectangle{Max: size})); err == nil {
+			t.Errorf("EncodeLossless of a %v image succeeded", size)
+		}
+	}
+
+	// Flat images compress to almost nothing
+	var buf bytes.Buffer
+	if err := webp.EncodeLossless(&buf, fill(512, 512, func(int, int) color.NRGBA { return color.NRGBA{1, 2, 3, 0xff} })); err != nil {
+		t.Fatalf("EncodeLossless: %v", err)
+	}
+	if buf.Len() > 512 {
+		t.Errorf("a solid 512×512 image takes %d bytes", buf.Len())
+	}
+}
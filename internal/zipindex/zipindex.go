@@ -0,0 +1,101 @@
+// Package zipindex looks up the entries of untrusted zip archives by
+// normalized name, leaving out entries whose names could make the wrong file
+// be read or a file be written outside a directory
+package zipindex
+
+import (
+	"archive/zip"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Index holds the usable entries of a zip archive by normalized name
+type Index struct {
+	files  []*zip.File
+	byName map[string]*zip.File
+	names  map[*zip.File]string
+	// Problems describes the entries left out and the names that differ only
+	// by case, in archive order
+	Problems []string
+}
+
+// New indexes a zip archive. Entries with unsafe names (absolute, with ".."
+// elements or empty) and symbolic links are left out, and of entries with the
+// same normalized name only the first is kept, as a lookup scanning the
+// archive would find.
+func New(zr *zip.Reader) *Index {
+	ix := &Index{
+		byName: make(map[string]*zip.File, len(zr.File)),
+		names:  make(map[*zip.File]string, len(zr.File)),
+	}
+	folded := make(map[string]string)
+	for _, f := range zr.File {
+		name, ok := CleanName(f.Name)
+		if !ok {
+			ix.Problems = append(ix.Problems, fmt.Sprintf("zip entry %q skipped: unsafe name", f.Name))
+			continue
+		}
+		if f.Mode()&fs.ModeSymlink != 0 {
+			// Its content is a path, which extracting could follow anywhere
+			ix.Problems = append(ix.Problems, fmt.Sprintf("zip entry %q skipped: symbolic link", f.Name))
+			continue
+		}
+		if _, dup := ix.byName[name]; dup {
+			ix.Problems = append(ix.Problems, fmt.Sprintf("zip entry %q skipped: duplicate of an earlier entry", f.Name))
+			continue
+		}
+		if other, ok := folded[strings.ToLower(name)]; ok {
+			ix.Problems = append(ix.Problems, fmt.Sprintf("zip entries %q and %q differ only by case", other, name))
+		} else {
+			folded[strings.ToLower(name)] = name
+		}
+		ix.byName[name] = f
+		ix.names[f] = name
+		ix.files = append(ix.files, f)
+	}
+	return ix
+}
+
+// CleanName returns the normalized form of an entry name or a name looked up:
+// slash-separated, cleaned and in Unicode NFC. Reports false for names that
+// are absolute, have ".." elements or are empty.
+func CleanName(name string) (string, bool) {
+	name = norm.NFC.String(strings.ReplaceAll(name, `\`, "/"))
+	if strings.HasPrefix(name, "/") || (len(name) >= 2 && name[1] == ':') {
+		return "", false
+	}
+	for _, elem := range strings.Split(name, "/") {
+		if elem == ".." {
+			return "", false
+		}
+	}
+	name = path.Clean(name)
+	if name == "." {
+		return "", false
+	}
+	return name, true
+}
+
+// Find returns the entry with a name, normalized as CleanName does
+func (ix *Index) Find(name string) (*zip.File, bool) {
+	name, ok := CleanName(name)
+	if !ok {
+		return nil, false
+	}
+	f, ok := ix.byName[name]
+	return f, ok
+}
+
+// Files returns the usable entries in archive order
+func (ix *Index) Files() []*zip.File {
+	return ix.files
+}
+
+// Name returns the normalized name of a usable entry
+func (ix *Index) Name(f *zip.File) string {
+	return ix.names[f]
+}
@@ -0,0 +1,167 @@
+package zipindex
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"io/fs"
+	"strings"
+	"testing"
+)
+
+// entry is a zip entry to write
+type entry struct {
+	name    string
+	content string
+	mode    fs.FileMode // Regular file if zero
+}
+
+func archive(t testing.TB, entries ...entry) *zip.Reader {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, e := range entries {
+		header := &zip.FileHeader{Name: e.name, Method: zip.Store}
+		if e.mode != 0 {
+			header.SetMode(e.mode)
+		}
+		w, err := zw.CreateHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(w, e.content)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return zr
+}
+
+func TestCleanName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+		ok   bool
+	}{
+		{"OEBPS/content.opf", "OEBPS/content.opf", true},
+		{"./OEBPS//text/../content.opf", "", false},
+		{`OEBPS\text\ch1.xhtml`, "OEBPS/text/ch1.xhtml", true},
+		{"OEBPS/./ch1.xhtml", "OEBPS/ch1.xhtml", true},
+		{"cafe\u0301.xhtml", "caf\u00e9.xhtml", true},
+		{"../evil.xhtml", "", false},
+		{"OEBPS/../../evil.xhtml", "", false},
+		{`..\evil.xhtml`, "", false},
+		{"/etc/passwd", "", false},
+		{`\windows\system.ini`, "", false},
+		{"C:/evil.xhtml", "", false},
+		{`C:\evil.xhtml`, "", false},
+		{"", "", false},
+		{".", "", false},
+		{"./", "", false},
+		{"..hidden/ok.xhtml", "..hidden/ok.xhtml", true},
+	}
+	for _, tt := range tests {
+		got, ok := CleanName(tt.name)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("CleanName(%q) = %q, %v; want %q, %v", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestNewSkipsUnsafeEntries(t *testing.T) {
+	zr := archive(t,
+		entry{name: "mimetype", content: "application/epub+zip"},
+		entry{name: "../../etc/passwd", content: "evil"},
+		entry{name: "/abs/file.txt", content: "evil"},
+		entry{name: "C:/windows/file.txt", content: "evil"},
+		entry{name: "OEBPS/cover.jpg", content: "/etc/passwd", mode: fs.ModeSymlink | 0o777},
+		entry{name: "OEBPS/ch1.xhtml", content: "first"},
+		entry{name: "OEBPS//ch1.xhtml", content: "duplicate"},
+		entry{name: "OEBPS/CH1.xhtml", content: "case"},
+		entry{name: "OEBPS/cafe\u0301.xhtml", content: "nfd"},
+		entry{name: "OEBPS/caf\u00e9.xhtml", content: "nfc duplicate"},
+	)
+	ix := New(zr)
+
+	var names []string
+	for _, f := range ix.Files() {
+		names = append(names, ix.Name(f))
+	}
+	want := "mimetype OEBPS/ch1.xhtml OEBPS/CH1.xhtml OEBPS/caf\u00e9.xhtml"
+	if got := strings.Join(names, " "); got != want {
+		t.Errorf("Files = %q, want %q", got, want)
+	}
+
+	read := func(name string) string {
+		f, ok := ix.Find(name)
+		if !ok {
+			return ""
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rc.Close()
+		data, _ := io.ReadAll(rc)
+		return string(data)
+	}
+	lookups := map[string]string{
+		"OEBPS/ch1.xhtml":         "first",
+		"OEBPS/text/../ch1.xhtml": "",
+		"OEBPS/CH1.xhtml":         "case",
+		"OEBPS/caf\u00e9.xhtml":   "nfd",
+		"OEBPS/cafe\u0301.xhtml":  "nfd",
+		"OEBPS/cover.jpg":         "",
+		"../../etc/passwd":        "",
+		"etc/passwd":              "",
+		"/abs/file.txt":           "",
+		"abs/file.txt":            "",
+	}
+	for name, want := range lookups {
+		if got := read(name); got != want {
+			t.Errorf("Find(%q) reads %q, want %q", name, got, want)
+		}
+	}
+
+	problems := strings.Join(ix.Problems, "\n")
+	for _, want := range []string{
+		`"../../etc/passwd" skipped: unsafe name`,
+		`"/abs/file.txt" skipped: unsafe name`,
+		`"C:/windows/file.txt" skipped: unsafe name`,
+		`"OEBPS/cover.jpg" skipped: symbolic link`,
+		`"OEBPS//ch1.xhtml" skipped: duplicate`,
+		"\"OEBPS/caf\u00e9.xhtml\" skipped: duplicate",
+		`"OEBPS/ch1.xhtml" and "OEBPS/CH1.xhtml" differ only by case`,
+	} {
+		if !strings.Contains(problems, want) {
+			t.Errorf("Problems do not mention %s:\n%s", want, problems)
+		}
+	}
+}
+
+func FuzzCleanName(f *testing.F) {
+	for _, seed := range []string{"OEBPS/a.xhtml", "../a", "/a", "C:/a", `a\..\..\b`, "a/./b//c", "cafe\u0301", ""} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, name string) {
+		clean, ok := CleanName(name)
+		if !ok {
+			return
+		}
+		if clean == "" || clean == "." || strings.HasPrefix(clean, "/") || (len(clean) >= 2 && clean[1] == ':') {
+			t.Fatalf("CleanName(%q) = %q, an unsafe name", name, clean)
+		}
+		for _, elem := range strings.Split(clean, "/") {
+			if elem == ".." {
+				t.Fatalf("CleanName(%q) = %q, with a .. element", name, clean)
+			}
+		}
+		if again, ok := CleanName(clean); !ok || again != clean {
+			t.Fatalf("CleanName(%q) = %q, but CleanName(%q) = %q, %v", name, clean, clean, again, ok)
+		}
+	})
+}
@@ -0,0 +1,124 @@
+package parser
+
+import (
+	"fmt"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// AssetOptions controls which assets ExtractAssets writes
+type AssetOptions struct {
+	// MediaTypes keeps only assets of these media types, or of a type ending
+	// in "/" such as "image/"; all assets if empty
+	MediaTypes []string
+	MaxSize    int64 // Skips assets larger than this many bytes; no limit if zero
+	DryRun     bool  // Lists the assets and the paths they would get without writing them
+}
+
+// AssetInfo describes an asset extracted by ExtractAssets
+type AssetInfo struct {
+	ID        string // Manifest id (EPUB) or binary id (FB2)
+	Href      string // Manifest href as written (EPUB), empty for FB2
+	MediaType string
+	Size      int64
+	Path      string // File written under the destination directory
+}
+
+// AssetExtractor is an optional interface a FastExtractor can implement to
+// write the images, fonts and stylesheets of a book to a directory
+type AssetExtractor interface {
+	ExtractAssetsFromFile(filePath, destDir string, opts AssetOptions) ([]AssetInfo, error)
+}
+
+// ExtractAssets writes the embedded resources of an ebook file under destDir:
+// for EPUB every manifest item but content documents, keeping their paths in
+// the container, and for FB2 every binary, named by its id.
+// Supported formats: EPUB, FB2
+func ExtractAssets(filePath, destDir string, opts AssetOptions) ([]AssetInfo, error) {
+	format := detectFormat(filePath)
+	extractor, err := getExtractor(format)
+	if err != nil {
+		return nil, err
+	}
+	ae, ok := extractor.(AssetExtractor)
+	if !ok {
+		return nil, fmt.Errorf("asset extraction not supported for format: %s", format)
+	}
+	return ae.ExtractAssetsFromFile(filePath, destDir, opts)
+}
+
+// Keeps reports whether an asset of the media type and size passes the options
+func (o AssetOptions) Keeps(mediaType string, size int64) bool {
+	if o.MaxSize > 0 && size > o.MaxSize {
+		return false
+	}
+	if len(o.MediaTypes) == 0 {
+		return true
+	}
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	for _, t := range o.MediaTypes {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if mediaType == t || (strings.HasSuffix(t, "/") && strings.HasPrefix(mediaType, t)) {
+			return true
+		}
+	}
+	return false
+}
+
+// AssetPath returns where an asset named by a relative slash-separated path
+// goes under destDir. Leading "/" and ".." elements are dropped, so names
+// such as "../../etc/passwd" stay inside destDir.
+func AssetPath(destDir, name string) (string, error) {
+	name = path.Clean("/" + strings.ReplaceAll(name, `\`, "/"))
+	name = strings.TrimPrefix(name, "/")
+	if name == "" {
+		return "", fmt.Errorf("invalid asset name")
+	}
+	return filepath.Join(destDir, filepath.FromSlash(name)), nil
+}
+
+// WriteAsset writes an asset to the path AssetPath gives for its name,
+// creating the directories it needs, and returns the path. Nothing is written
+// in a dry run.
+func WriteAsset(destDir, name string, data []byte, opts AssetOptions) (string, error) {
+	assetPath, err := AssetPath(destDir, name)
+	if err != nil {
+		return "", fmt.Errorf("%w: %q", err, name)
+	}
+	if opts.DryRun {
+		return assetPath, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(assetPath), 0o755); err != nil {
+		return "", fmt.Errorf("failed to create directory: %w", err)
+	}
+	if err := os.WriteFile(assetPath, data, 0o644); err != nil {
+		return "", fmt.Errorf("failed to write asset: %w", err)
+	}
+	return assetPath, nil
+}
+
+// AssetExtension returns the file extension for an asset: the one of the
+// image type its bytes show, else of its declared media type, else ".bin"
+func AssetExtension(data []byte, declared string) string {
+	switch ImageType(data, declared) {
+	case "image/jpeg":
+		return ".jpg"
+	case "image/png":
+		return ".png"
+	case "image/gif":
+		return ".gif"
+	case "image/webp":
+		return ".webp"
+	case "image/bmp":
+		return ".bmp"
+	case "image/svg+xml":
+		return ".svg"
+	}
+	if exts, err := mime.ExtensionsByType(strings.TrimSpace(declared)); err == nil && len(exts) > 0 {
+		return exts[0]
+	}
+	return ".bin"
+}
@@ -1,16 +1,211 @@
 package parser
 
-import "strings"
+import (
+	"strings"
+	"unicode"
+)
 
 // Author represents a book author with name components
 type Author struct {
 	FirstName  string
 	LastName   string
 	MiddleName string
+	// DisplayName is the name as the book gives it, set when the components
+	// can't reproduce it: a suffix such as "Jr.", a name the source files
+	// under another form, or one too ambiguous to split (then LastName holds
+	// the whole name)
+	DisplayName string
+}
+
+// nameSuffixes are generational and similar suffixes following a surname
+var nameSuffixes = map[string]bool{
+	"jr": true, "jr.": true, "sr": true, "sr.": true,
+	"jnr": true, "jnr.": true, "snr": true, "snr.": true,
+	"ii": true, "iii": true, "iv": true,
+}
+
+// surnameParticles are words that belong to the surname that follows them
+var surnameParticles = map[string]bool{
+	"van": true, "von": true, "der": true, "den": true, "ter": true, "ten": true,
+	"de": true, "del": true, "della": true, "di": true, "da": true, "dos": true,
+	"das": true, "du": true, "des": true, "la": true, "le": true, "les": true,
+	"st.": true, "bin": true, "ibn": true, "al": true, "el": true,
+}
+
+// ParseAuthor splits a "First Middle Last" or "Last, First Middle" name into
+// its components. fileAs is the sort form of the name some formats carry,
+// such as the EPUB file-as ("Le Guin, Ursula K."), and settles where the
+// surname starts when given. Surname particles (van, de, Le...) stay with
+// the surname and suffixes (Jr., III) are kept in DisplayName. Names too
+// ambiguous to split are kept whole in LastName and DisplayName.
+func ParseAuthor(name, fileAs string) Author {
+	name = strings.Join(strings.Fields(name), " ")
+	fileAs = strings.Join(strings.Fields(fileAs), " ")
+	if name == "" {
+		if fileAs == "" {
+			return Author{}
+		}
+		name = fileAs
+	}
+
+	if fileAs != "" && fileAs != name {
+		if author, ok := splitByFileAs(name, fileAs); ok {
+			return author
+		}
+	}
+
+	if isAmbiguousName(name) {
+		return Author{LastName: name, DisplayName: name}
+	}
+
+	// "Last, First Middle", possibly followed by ", Jr."
+	base, suffix := cutNameSuffix(name)
+	if last, given, found := strings.Cut(base, ","); found {
+		author := splitGiven(strings.TrimSpace(last), given)
+		if strings.Contains(given, ",") || author.LastName == "" {
+			return Author{LastName: name, DisplayName: name}
+		}
+		if suffix != "" {
+			author.DisplayName = author.FullName() + " " + suffix
+		}
+		return author
+	}
+
+	author := splitNatural(base)
+	if suffix != "" {
+		author.DisplayName = name
+	}
+	return author
+}
+
+// splitByFileAs splits a name at the surname its sort form gives. When the
+// name doesn't contain that surname, such as a transliteration, the
+// components come from the sort form and DisplayName keeps the name.
+func splitByFileAs(name, fileAs string) (Author, bool) {
+	sortBase, _ := cutNameSuffix(fileAs)
+	last, given, _ := strings.Cut(sortBase, ",")
+	last = strings.TrimSpace(last)
+	if last == "" || strings.Contains(given, ",") {
+		return Author{}, false
+	}
+
+	base, suffix := cutNameSuffix(name)
+	var author Author
+	switch {
+	case strings.EqualFold(base, last):
+		author = Author{LastName: base}
+	case hasWordSuffix(base, last):
+		author = splitGiven(base[len(base)-len(last):], base[:len(base)-len(last)])
+	case hasWordPrefix(base, last+","):
+		author = splitGiven(base[:len(last)], base[len(last)+1:])
+		if suffix != "" {
+			author.DisplayName = author.FullName() + " " + suffix
+		}
+		return author, true
+	default:
+		author = splitGiven(last, given)
+		author.DisplayName = name
+		return author, true
+	}
+
+	if suffix != "" {
+		author.DisplayName = name
+	}
+	return author, true
+}
+
+// splitNatural splits a "First Middle Last" name, keeping surname particles
+// with the surname. A name of particles and a surname alone ("van Gogh") is
+// all surname, and the Russian "Last First Patronymic" order is recognized
+// by the patronymic at the end.
+func splitNatural(name string) Author {
+	parts := strings.Fields(name)
+	if len(parts) <= 1 {
+		return Author{LastName: name}
+	}
+	if len(parts) == 3 && isPatronymic(parts[2]) && !isPatronymic(parts[1]) {
+		return Author{LastName: parts[0], FirstName: parts[1], MiddleName: parts[2]}
+	}
+
+	// A capitalized first word is a given name, as in "Al Gore"
+	start := len(parts) - 1
+	for start > 0 && surnameParticles[strings.ToLower(parts[start-1])] && (start > 1 || parts[0] == strings.ToLower(parts[0])) {
+		start--
+	}
+	if start == 0 {
+		return Author{LastName: name}
+	}
+	return splitGiven(strings.Join(parts[start:], " "), strings.Join(parts[:start], " "))
+}
+
+// patronymicEndings end Russian and Ukrainian patronymics, and their usual
+// transliterations
+var patronymicEndings = []string{"вич", "вна", "ична", "ьич", "vich", "vna", "ichna"}
+
+// isPatronymic reports whether a word looks like a patronymic, such as
+// "Николаевич" or "Ивановна"
+func isPatronymic(word string) bool {
+	word = strings.ToLower(word)
+	for _, ending := range patronymicEndings {
+		if strings.HasSuffix(word, ending) && len([]rune(word)) > len([]rune(ending))+1 {
+			return true
+		}
+	}
+	return false
+}
+
+// splitGiven returns an author with a surname and the given names that go
+// with it, the first of them being the first name
+func splitGiven(last, given string) Author {
+	author := Author{LastName: strings.TrimSpace(last)}
+	if parts := strings.Fields(given); len(parts) > 0 {
+		author.FirstName = parts[0]
+		author.MiddleName = strings.Join(parts[1:], " ")
+	}
+	return author
+}
+
+// cutNameSuffix removes a trailing suffix, with or without a comma before it
+func cutNameSuffix(name string) (string, string) {
+	i := strings.LastIndexAny(name, " ,")
+	if i <= 0 || !nameSuffixes[strings.ToLower(name[i+1:])] {
+		return name, ""
+	}
+	return strings.TrimRight(name[:i], " ,"), name[i+1:]
+}
+
+// isAmbiguousName reports whether a name is unlikely to be a single person's
+// name made of given names and a surname, such as "Smith & Jones" or
+// "Team 42"
+func isAmbiguousName(name string) bool {
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsMark(r) && !unicode.IsSpace(r) && !strings.ContainsRune(".,'’-", r) {
+			return true
+		}
+	}
+	for _, word := range strings.Fields(strings.ToLower(name)) {
+		if word == "and" {
+			return true
+		}
+	}
+	return false
+}
+
+// hasWordSuffix reports whether s ends with the words of suffix, ignoring case
+func hasWordSuffix(s, suffix string) bool {
+	return len(s) > len(suffix) && strings.EqualFold(s[len(s)-len(suffix):], suffix) && s[len(s)-len(suffix)-1] == ' '
+}
+
+// hasWordPrefix reports whether s starts with prefix, ignoring case
+func hasWordPrefix(s, prefix string) bool {
+	return len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix)
 }
 
 // FullName returns the complete author name
 func (a Author) FullName() string {
+	if a.DisplayName != "" {
+		return a.DisplayName
+	}
 	parts := []string{}
 	if a.FirstName != "" {
 		parts = append(parts, a.FirstName)
@@ -24,7 +219,19 @@ func (a Author) FullName() string {
 	return strings.Join(parts, " ")
 }
 
+// SortName returns the "Last, First Middle" form of the name used for sorting
+func (a Author) SortName() string {
+	if a.LastName == "" {
+		return a.FullName()
+	}
+	given := strings.TrimSpace(a.FirstName + " " + a.MiddleName)
+	if given == "" {
+		return a.LastName
+	}
+	return a.LastName + ", " + given
+}
+
 // IsEmpty returns true if the author has no name components
 func (a Author) IsEmpty() bool {
-	return a.FirstName == "" && a.LastName == "" && a.MiddleName == ""
+	return a.FirstName == "" && a.LastName == "" && a.MiddleName == "" && a.DisplayName == ""
 }
@@ -0,0 +1,88 @@
+package parser
+
+import "testing"
+
+func TestParseAuthor(t *testing.T) {
+	tests := []struct {
+		name, fileAs              string
+		first, middle, last, disp string
+		full, sort                string
+	}{
+		// Plain names, in both orders
+		{name: "Jane Doe", first: "Jane", last: "Doe", full: "Jane Doe", sort: "Doe, Jane"},
+		{name: "Doe, Jane Mary", first: "Jane", middle: "Mary", last: "Doe", full: "Jane Mary Doe", sort: "Doe, Jane Mary"},
+		{name: "  Jane   Doe ", first: "Jane", last: "Doe", full: "Jane Doe", sort: "Doe, Jane"},
+		{name: "Homer", last: "Homer", full: "Homer", sort: "Homer"},
+		{name: "", full: "", sort: ""},
+
+		// The sort form settles where the surname starts
+		{name: "Ursula K. Le Guin", fileAs: "Le Guin, Ursula K.", first: "Ursula", middle: "K.", last: "Le Guin", full: "Ursula K. Le Guin", sort: "Le Guin, Ursula K."},
+		{name: "Gabriel García Márquez", fileAs: "García Márquez, Gabriel", first: "Gabriel", last: "García Márquez", full: "Gabriel García Márquez", sort: "García Márquez, Gabriel"},
+		{name: "Gabriel García Márquez", first: "Gabriel", middle: "García", last: "Márquez", full: "Gabriel García Márquez", sort: "Márquez, Gabriel García"},
+		{name: "", fileAs: "Doe, Jane", first: "Jane", last: "Doe", full: "Jane Doe", sort: "Doe, Jane"},
+		{name: "Jane Doe", fileAs: "Jane Doe", first: "Jane", last: "Doe", full: "Jane Doe", sort: "Doe, Jane"},
+		{name: "Лев Толстой", fileAs: "Tolstoy, Leo", first: "Leo", last: "Tolstoy", disp: "Лев Толстой", full: "Лев Толстой", sort: "Tolstoy, Leo"},
+		{name: "Martin Luther King Jr.", fileAs: "King, Martin Luther, Jr.", first: "Martin", middle: "Luther", last: "King", disp: "Martin Luther King Jr.", full: "Martin Luther King Jr.", sort: "King, Martin Luther"},
+
+		// Suffixes stay out of the surname
+		{name: "Martin Luther King Jr.", first: "Martin", middle: "Luther", last: "King", disp: "Martin Luther King Jr.", full: "Martin Luther King Jr.", sort: "King, Martin Luther"},
+		{name: "King, Martin Luther, Jr.", first: "Martin", middle: "Luther", last: "King", disp: "Martin Luther King Jr.", full: "Martin Luther King Jr.", sort: "King, Martin Luther"},
+		{name: "Henry Ford II", first: "Henry", last: "Ford", disp: "Henry Ford II", full: "Henry Ford II", sort: "Ford, Henry"},
+		{name: "John Smith Sr", first: "John", last: "Smith", disp: "John Smith Sr", full: "John Smith Sr", sort: "Smith, John"},
+
+		// Particles belong to the surname
+		{name: "Ludwig van Beethoven", first: "Ludwig", last: "van Beethoven", full: "Ludwig van Beethoven", sort: "van Beethoven, Ludwig"},
+		{name: "John van der Berg", first: "John", last: "van der Berg", full: "John van der Berg", sort: "van der Berg, John"},
+		{name: "Juana Inés de la Cruz", first: "Juana", middle: "Inés", last: "de la Cruz", full: "Juana Inés de la Cruz", sort: "de la Cruz, Juana Inés"},
+		{name: "Ursula K. Le Guin", first: "Ursula", middle: "K.", last: "Le Guin", full: "Ursula K. Le Guin", sort: "Le Guin, Ursula K."},
+		{name: "van der Berg, John", first: "John", last: "van der Berg", full: "John van der Berg", sort: "van der Berg, John"},
+		{name: "van Gogh", last: "van Gogh", full: "van Gogh", sort: "van Gogh"},
+		{name: "Al Gore", first: "Al", last: "Gore", full: "Al Gore", sort: "Gore, Al"},
+		{name: "Van Morrison", first: "Van", last: "Morrison", full: "Van Morrison", sort: "Morrison, Van"},
+
+		// Russian names with patronymics, in both orders
+		{name: "Лев Николаевич Толстой", first: "Лев", middle: "Николаевич", last: "Толстой", full: "Лев Николаевич Толстой", sort: "Толстой, Лев Николаевич"},
+		{name: "Толстой Лев Николаевич", first: "Лев", middle: "Николаевич", last: "Толстой", full: "Лев Николаевич Толстой", sort: "Толстой, Лев Николаевич"},
+		{name: "Толстой, Лев Николаевич", first: "Лев", middle: "Николаевич", last: "Толстой", full: "Лев Николаевич Толстой", sort: "Толстой, Лев Николаевич"},
+		{name: "Ахматова Анна Андреевна", first: "Анна", middle: "Андреевна", last: "Ахматова", full: "Анна Андреевна Ахматова", sort: "Ахматова, Анна Андреевна"},
+		{name: "Ульянов Владимир Ильич", first: "Владимир", middle: "Ильич", last: "Ульянов", full: "Владимир Ильич Ульянов", sort: "Ульянов, Владимир Ильич"},
+		{name: "Леся Українка", first: "Леся", last: "Українка", full: "Леся Українка", sort: "Українка, Леся"},
+		{name: "Dostoevsky Fyodor Mikhailovich", first: "Fyodor", middle: "Mikhailovich", last: "Dostoevsky", full: "Fyodor Mikhailovich Dostoevsky", sort: "Dostoevsky, Fyodor Mikhailovich"},
+		{name: "Dmitri Dmitriyevich Shostakovich", first: "Dmitri", middle: "Dmitriyevich", last: "Shostakovich", full: "Dmitri Dmitriyevich Shostakovich", sort: "Shostakovich, Dmitri Dmitriyevich"},
+
+		// Names too ambiguous to split are kept whole
+		{name: "Smith & Jones", last: "Smith & Jones", disp: "Smith & Jones", full: "Smith & Jones", sort: "Smith & Jones"},
+		{name: "Ilf and Petrov", last: "Ilf and Petrov", disp: "Ilf and Petrov", full: "Ilf and Petrov", sort: "Ilf and Petrov"},
+		{name: "Team 42", last: "Team 42", disp: "Team 42", full: "Team 42", sort: "Team 42"},
+		{name: "Doe, Jane, Mary", last: "Doe, Jane, Mary", disp: "Doe, Jane, Mary", full: "Doe, Jane, Mary", sort: "Doe, Jane, Mary"},
+	}
+	for _, tt := range tests {
+		a := ParseAuthor(tt.name, tt.fileAs)
+		if a.FirstName != tt.first || a.MiddleName != tt.middle || a.LastName != tt.last || a.DisplayName != tt.disp {
+			t.Errorf("ParseAuthor(%q, %q) = %+v, want first %q, middle %q, last %q, display %q",
+				tt.name, tt.fileAs, a, tt.first, tt.middle, tt.last, tt.disp)
+		}
+		if got := a.FullName(); got != tt.full {
+			t.Errorf("ParseAuthor(%q, %q).FullName() = %q, want %q", tt.name, tt.fileAs, got, tt.full)
+		}
+		if got := a.SortName(); got != tt.sort {
+			t.Errorf("ParseAuthor(%q, %q).SortName() = %q, want %q", tt.name, tt.fileAs, got, tt.sort)
+		}
+		if a.IsEmpty() != (tt.name == "" && tt.fileAs == "") {
+			t.Errorf("ParseAuthor(%q, %q).IsEmpty() = %v", tt.name, tt.fileAs, a.IsEmpty())
+		}
+	}
+}
+
+func TestParseAuthorKeepsNameInFullName(t *testing.T) {
+	// Whatever the split, the full name reads as the book gives it
+	names := []string{
+		"Ursula K. Le Guin", "Martin Luther King Jr.", "John van der Berg",
+		"Лев Николаевич Толстой", "Smith & Jones", "Henry Ford II", "van Gogh",
+	}
+	for _, name := range names {
+		if got := ParseAuthor(name, "").FullName(); got != name {
+			t.Errorf("ParseAuthor(%q).FullName() = %q", name, got)
+		}
+	}
+}
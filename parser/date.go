@@ -0,0 +1,41 @@
+package parser
+
+import (
+	"strings"
+	"time"
+)
+
+// dateLayouts are the date forms ParseDate tries, most precise first
+var dateLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+	"2006-01",
+	"2006",
+	"02.01.2006", // Common in FB2 document-info
+	"2.1.2006",
+	"January 2, 2006",
+	"2 January 2006",
+	"Jan 2, 2006",
+	"2 Jan 2006",
+	"January 2006",
+}
+
+// ParseDate reads a date as books write it, such as "2005", "2005-03-14",
+// "2005-03-14T10:00:00Z" or "14.03.2005". Dates without a zone are taken as
+// UTC, and missing months and days as the first. Returns the zero time if
+// the date isn't in a known form.
+func ParseDate(s string) time.Time {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}
+	}
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,128 @@
+package parser
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// sniffSize is how much of a file is read to recognize its format
+const sniffSize = 4096
+
+// DetectFormat identifies the format of an ebook file from its content, so
+// misnamed files and plain .zip uploads are recognized. Text formats, which
+// have no signature, fall back to the file extension. An unrecognized file
+// is reported as "unknown".
+func DetectFormat(filePath string) (string, error) {
+	if info, err := os.Stat(filePath); err == nil && info.IsDir() {
+		return detectFormat(filePath), nil
+	}
+
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	if format := DetectFormatReader(f, stat.Size()); format != "unknown" {
+		return format, nil
+	}
+	return detectFormat(filePath), nil
+}
+
+// DetectFormatReader identifies the format of an ebook from its content
+// alone: "epub", "fb2" (plain, zipped or gzipped), "mobi", "cbz", or
+// "unknown"
+func DetectFormatReader(r io.ReaderAt, size int64) string {
+	header := make([]byte, sniffSize)
+	n, _ := r.ReadAt(header, 0)
+	header = header[:n]
+
+	switch {
+	case bytes.HasPrefix(header, []byte("PK\x03\x04")):
+		return sniffZip(r, size)
+
+	case bytes.HasPrefix(header, []byte{0x1f, 0x8b}):
+		gz, err := gzip.NewReader(io.NewSectionReader(r, 0, size))
+		if err != nil {
+			return "unknown"
+		}
+		defer gz.Close()
+		data, _ := io.ReadAll(io.LimitReader(gz, sniffSize))
+		if isFB2(data) {
+			return "fb2"
+		}
+
+	case len(header) >= 68 && (string(header[60:68]) == "BOOKMOBI" || string(header[60:68]) == "TEXtREAd"):
+		return "mobi"
+
+	case isFB2(header):
+		return "fb2"
+	}
+
+	return "unknown"
+}
+
+// FormatAuto asks the reader-based functions, such as ExtractMetadataFromReader
+// and ParseReader, to detect the format from the content. An empty format
+// does the same.
+const FormatAuto = "auto"
+
+// resolveFormat returns format, or the format detected from the content when
+// it is FormatAuto or empty
+func resolveFormat(r io.ReaderAt, size int64, format string) (string, error) {
+	format = strings.ToLower(strings.TrimSpace(format))
+	if format != "" && format != FormatAuto {
+		return format, nil
+	}
+	if detected := DetectFormatReader(r, size); detected != "unknown" {
+		return detected, nil
+	}
+	return "", fmt.Errorf("unrecognized ebook format")
+}
+
+// sniffZip tells EPUBs, zipped FB2 files and comic archives apart by the
+// entries they hold
+func sniffZip(r io.ReaderAt, size int64) string {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return "unknown"
+	}
+
+	images := 0
+	for _, f := range zr.File {
+		name := strings.ToLower(f.Name)
+		switch {
+		case name == "mimetype" || name == "meta-inf/container.xml":
+			return "epub"
+		case strings.HasSuffix(name, ".fb2"):
+			return "fb2"
+		case path.Base(name) == "comicinfo.xml":
+			return "cbz"
+		}
+		switch path.Ext(name) {
+		case ".jpg", ".jpeg", ".png", ".gif", ".webp":
+			images++
+		}
+	}
+
+	if images > 0 && images*2 >= len(zr.File) {
+		return "cbz"
+	}
+	return "unknown"
+}
+
+// isFB2 reports whether a document starts like FictionBook XML
+func isFB2(header []byte) bool {
+	return bytes.Contains(header, []byte("<FictionBook"))
+}
@@ -12,8 +12,31 @@ const (
 	ElementTypeTable
 	ElementTypeEmptyLine
 	ElementTypeEpigraph
+	ElementTypeFootnote
+	ElementTypeBlockquote
+	ElementTypePreformatted
 )
 
+// ElementFilter reports whether parsers should build elements of a type.
+// Elements it rejects are never constructed.
+type ElementFilter func(ElementType) bool
+
+// Keeps reports whether the filter keeps elements of type t. A nil filter
+// keeps everything, and headings are always kept as they give chapters their
+// structure.
+func (f ElementFilter) Keeps(t ElementType) bool {
+	return f == nil || t == ElementTypeHeading || f(t)
+}
+
+// ExcludeElements returns a filter dropping elements of the given types
+func ExcludeElements(types ...ElementType) ElementFilter {
+	excluded := make(map[ElementType]bool, len(types))
+	for _, t := range types {
+		excluded[t] = true
+	}
+	return func(t ElementType) bool { return !excluded[t] }
+}
+
 // Element represents a content building block
 type Element interface {
 	Type() ElementType
@@ -23,10 +46,22 @@ type Element interface {
 
 // Paragraph represents a text paragraph
 type Paragraph struct {
-	Text string
-	HTML string // Original HTML if available
+	Text  string
+	HTML  string // Original HTML if available
+	Links []Link // Hyperlinks within Text, in order
+}
+
+// Link is a hyperlink over part of a paragraph's text
+type Link struct {
+	Start int    // Byte offset of the link text in Paragraph.Text
+	End   int    // Byte offset just past the link text
+	Href  string // "#id" for a place in the book, otherwise a URL
 }
 
+// Internal reports whether the link points to a place in the book, such as
+// a section id found in Content.ChapterIndex
+func (l Link) Internal() bool { return strings.HasPrefix(l.Href, "#") }
+
 func (p *Paragraph) Type() ElementType { return ElementTypeParagraph }
 func (p *Paragraph) CharCount() int    { return len(p.Text) }
 func (p *Paragraph) WordCount() int    { return len(strings.Fields(p.Text)) }
@@ -43,9 +78,10 @@ func (h *Heading) WordCount() int    { return len(strings.Fields(h.Text)) }
 
 // Image represents an image reference
 type Image struct {
-	Alt  string
-	Href string
-	Data []byte // Embedded image data if available
+	Alt     string
+	Href    string
+	Caption string // Visible caption, such as a figcaption, if any
+	Data    []byte // Embedded image data if available
 }
 
 func (i *Image) Type() ElementType { return ElementTypeImage }
@@ -71,6 +107,7 @@ func (e *EmptyLine) WordCount() int    { return 0 }
 // Epigraph represents an epigraph section
 type Epigraph struct {
 	Paragraphs []Paragraph
+	Author     string // Attribution (FB2 text-author), empty if none
 }
 
 func (e *Epigraph) Type() ElementType { return ElementTypeEpigraph }
@@ -88,3 +125,59 @@ func (e *Epigraph) WordCount() int {
 	}
 	return total
 }
+
+// Blockquote represents a quotation inside the text
+type Blockquote struct {
+	Paragraphs []Paragraph
+}
+
+func (b *Blockquote) Type() ElementType { return ElementTypeBlockquote }
+func (b *Blockquote) CharCount() int {
+	total := 0
+	for _, p := range b.Paragraphs {
+		total += p.CharCount()
+	}
+	return total
+}
+func (b *Blockquote) WordCount() int {
+	total := 0
+	for _, p := range b.Paragraphs {
+		total += p.WordCount()
+	}
+	return total
+}
+
+// Preformatted represents text whose line breaks and spacing must be kept,
+// such as a code block
+type Preformatted struct {
+	Text     string
+	Language string // Language hint of a code block, empty if unknown
+}
+
+func (p *Preformatted) Type() ElementType { return ElementTypePreformatted }
+func (p *Preformatted) CharCount() int    { return len(p.Text) }
+func (p *Preformatted) WordCount() int    { return len(strings.Fields(p.Text)) }
+
+// Footnote represents a resolved note reference, placed right after the
+// paragraph that references it. Its text is not counted towards the chapter
+// totals since it belongs to the book's notes.
+type Footnote struct {
+	ID       string // ID of the referenced note
+	Label    string // Reference text as shown in the paragraph (e.g., "1", "*")
+	Elements []Element
+}
+
+func (f *Footnote) Type() ElementType { return ElementTypeFootnote }
+func (f *Footnote) CharCount() int    { return 0 }
+func (f *Footnote) WordCount() int    { return 0 }
+
+// Text returns the plain text of the note, paragraphs separated by newlines
+func (f *Footnote) Text() string {
+	parts := []string{}
+	for _, elem := range f.Elements {
+		if p, ok := elem.(*Paragraph); ok && p.Text != "" {
+			parts = append(parts, p.Text)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
@@ -3,6 +3,7 @@ package parser
 import (
 	"fmt"
 	"io"
+	"os"
 	"path/filepath"
 	"strings"
 	"sync"
@@ -49,7 +50,7 @@ func getExtractor(format string) (FastExtractor, error) {
 
 // ExtractCoverFromFile extracts only the cover image from an ebook file without parsing the full content.
 // This is much faster than Parse() when you only need the cover.
-// Supported formats: EPUB, FB2
+// Supported formats: EPUB, FB2, MOBI, CBZ, TXT, Markdown
 func ExtractCoverFromFile(filePath string) ([]byte, string, error) {
 	format := detectFormat(filePath)
 	extractor, err := getExtractor(format)
@@ -59,13 +60,68 @@ func ExtractCoverFromFile(filePath string) ([]byte, string, error) {
 	return extractor.ExtractCoverFromFile(filePath)
 }
 
+// CoverInfo is a cover image with the facts a client needs to lay it out
+type CoverInfo struct {
+	Data     []byte
+	MimeType string
+	Width    int    // In pixels, zero if unknown
+	Height   int    // In pixels, zero if unknown
+	ByteSize int    // Size of Data
+	Warning  string // Why the dimensions are unknown, if they are
+}
+
+// ExtractCoverInfo extracts the cover image as ExtractCoverFromFile does,
+// with its dimensions read from the image header, so clients don't have to
+// decode it again. Data the dimensions can't be read from leaves them zero
+// with a Warning rather than failing.
+func ExtractCoverInfo(filePath string) (CoverInfo, error) {
+	data, mimeType, err := ExtractCoverFromFile(filePath)
+	if err != nil {
+		return CoverInfo{}, err
+	}
+	return coverInfo(data, mimeType), nil
+}
+
+// ExtractCoverInfoFromReader is ExtractCoverInfo for a reader. A format of
+// FormatAuto or "" is detected from the content.
+func ExtractCoverInfoFromReader(r io.ReaderAt, size int64, format string) (CoverInfo, error) {
+	data, mimeType, err := ExtractCoverFromReader(r, size, format)
+	if err != nil {
+		return CoverInfo{}, err
+	}
+	return coverInfo(data, mimeType), nil
+}
+
+func coverInfo(data []byte, mimeType string) CoverInfo {
+	var m Metadata
+	info := CoverInfo{Data: data, MimeType: mimeType, ByteSize: len(data)}
+	if err := m.SetCover(data, mimeType); err != nil {
+		info.Warning = err.Error()
+	}
+	info.Width, info.Height = m.CoverWidth, m.CoverHeight
+	return info
+}
+
 // ExtractCoverFromReader extracts only the cover image from an ebook reader without parsing the full content.
+// A format of FormatAuto or "" is detected from the content.
 func ExtractCoverFromReader(r io.ReaderAt, size int64, format string) ([]byte, string, error) {
+	data, mimeType, _, err := ExtractCoverFromReaderDetect(r, size, format)
+	return data, mimeType, err
+}
+
+// ExtractCoverFromReaderDetect is ExtractCoverFromReader that also returns
+// the format used, as detected when format is FormatAuto or ""
+func ExtractCoverFromReaderDetect(r io.ReaderAt, size int64, format string) ([]byte, string, string, error) {
+	format, err := resolveFormat(r, size, format)
+	if err != nil {
+		return nil, "", "", err
+	}
 	extractor, err := getExtractor(format)
 	if err != nil {
-		return nil, "", err
+		return nil, "", format, err
 	}
-	return extractor.ExtractCoverFromReader(r, size)
+	data, mimeType, err := extractor.ExtractCoverFromReader(r, size)
+	return data, mimeType, format, err
 }
 
 // ExtractAnnotationFromFile extracts only the description/annotation from an ebook file without parsing the full content.
@@ -79,12 +135,25 @@ func ExtractAnnotationFromFile(filePath string) (string, error) {
 }
 
 // ExtractAnnotationFromReader extracts only the description/annotation from an ebook reader without parsing the full content.
+// A format of FormatAuto or "" is detected from the content.
 func ExtractAnnotationFromReader(r io.ReaderAt, size int64, format string) (string, error) {
+	annotation, _, err := ExtractAnnotationFromReaderDetect(r, size, format)
+	return annotation, err
+}
+
+// ExtractAnnotationFromReaderDetect is ExtractAnnotationFromReader that also
+// returns the format used, as detected when format is FormatAuto or ""
+func ExtractAnnotationFromReaderDetect(r io.ReaderAt, size int64, format string) (string, string, error) {
+	format, err := resolveFormat(r, size, format)
+	if err != nil {
+		return "", "", err
+	}
 	extractor, err := getExtractor(format)
 	if err != nil {
-		return "", err
+		return "", format, err
 	}
-	return extractor.ExtractAnnotationFromReader(r, size)
+	annotation, err := extractor.ExtractAnnotationFromReader(r, size)
+	return annotation, format, err
 }
 
 // ExtractMetadataFromFile extracts only metadata from an ebook file without parsing the full content.
@@ -98,22 +167,59 @@ func ExtractMetadataFromFile(filePath string) (Metadata, error) {
 }
 
 // ExtractMetadataFromReader extracts only metadata from an ebook reader without parsing the full content.
+// A format of FormatAuto or "" is detected from the content.
 func ExtractMetadataFromReader(r io.ReaderAt, size int64, format string) (Metadata, error) {
+	metadata, _, err := ExtractMetadataFromReaderDetect(r, size, format)
+	return metadata, err
+}
+
+// ExtractMetadataFromReaderDetect is ExtractMetadataFromReader that also
+// returns the format used, as detected when format is FormatAuto or ""
+func ExtractMetadataFromReaderDetect(r io.ReaderAt, size int64, format string) (Metadata, string, error) {
+	format, err := resolveFormat(r, size, format)
+	if err != nil {
+		return Metadata{}, "", err
+	}
 	extractor, err := getExtractor(format)
 	if err != nil {
-		return Metadata{}, err
+		return Metadata{}, format, err
 	}
-	return extractor.ExtractMetadataFromReader(r, size)
+	metadata, err := extractor.ExtractMetadataFromReader(r, size)
+	return metadata, format, err
 }
 
 // detectFormat detects the ebook format from file extension
 func detectFormat(filePath string) string {
+	// An unzipped EPUB is a directory holding META-INF/container.xml
+	if info, err := os.Stat(filePath); err == nil && info.IsDir() {
+		if _, err := os.Stat(filepath.Join(filePath, "META-INF", "container.xml")); err == nil {
+			return "epub"
+		}
+		return "unknown"
+	}
+
+	return formatFromExtension(filePath)
+}
+
+// formatFromExtension maps a file name's extension to a format
+func formatFromExtension(filePath string) string {
 	ext := strings.ToLower(filepath.Ext(filePath))
 	switch ext {
 	case ".epub":
 		return "epub"
 	case ".fb2":
 		return "fb2"
+	case ".txt":
+		return "txt"
+	case ".md", ".markdown":
+		return "markdown"
+	case ".mobi", ".azw", ".prc":
+		return "mobi"
+	case ".cbz":
+		return "cbz"
+	case ".cbr":
+		// Needs a RAR reader registered through cbz.NewArchiveParser
+		return "cbr"
 	case ".zip":
 		// Could be fb2.zip or epub.zip, need to check
 		if strings.HasSuffix(strings.ToLower(filePath), ".fb2.zip") {
@@ -122,6 +228,11 @@ func detectFormat(filePath string) string {
 			return "epub"
 		}
 		return "unknown"
+	case ".gz":
+		if strings.HasSuffix(strings.ToLower(filePath), ".fb2.gz") {
+			return "fb2"
+		}
+		return "unknown"
 	default:
 		return "unknown"
 	}
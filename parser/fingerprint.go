@@ -0,0 +1,136 @@
+package parser
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// FingerprintVersion identifies the normalization rules used to compute fingerprints.
+// It is embedded in every fingerprint string ("v1:sha256:<hex>") so that values
+// produced by different library versions are never silently compared.
+//
+// Version 1 normalization:
+//   - only paragraph text is hashed (headings, epigraphs, images and tables are ignored)
+//   - text is lowercased
+//   - punctuation and symbol characters are removed
+//   - runs of whitespace are collapsed to a single space and the result is trimmed
+//   - paragraphs that are empty after normalization are skipped
+//   - paragraphs are concatenated in reading order, separated by a newline
+//
+// The metadata fingerprint hashes the normalized title followed by the normalized
+// full names of all authors, sorted, and keeps only the first 16 hex digits.
+const FingerprintVersion = "v1"
+
+// FingerprintExtractor is an optional interface a FastExtractor can implement to
+// compute the content fingerprint without building the full element tree.
+type FingerprintExtractor interface {
+	ExtractFingerprintFromFile(filePath string) (string, error)
+}
+
+// FingerprintHasher incrementally computes a content fingerprint.
+// Format-specific fast paths feed paragraph text in reading order and
+// get the same value Book.Fingerprint() would return.
+type FingerprintHasher struct {
+	h     hash.Hash
+	first bool
+}
+
+// NewFingerprintHasher creates an empty content fingerprint hasher
+func NewFingerprintHasher() *FingerprintHasher {
+	return &FingerprintHasher{h: sha256.New(), first: true}
+}
+
+// AddParagraph normalizes and adds a paragraph of text to the fingerprint
+func (f *FingerprintHasher) AddParagraph(text string) {
+	normalized := NormalizeFingerprintText(text)
+	if normalized == "" {
+		return
+	}
+	if !f.first {
+		f.h.Write([]byte{'\n'})
+	}
+	f.first = false
+	f.h.Write([]byte(normalized))
+}
+
+// Sum returns the versioned fingerprint string
+func (f *FingerprintHasher) Sum() string {
+	return FingerprintVersion + ":sha256:" + hex.EncodeToString(f.h.Sum(nil))
+}
+
+// NormalizeFingerprintText applies the fingerprint normalization rules to a string
+func NormalizeFingerprintText(s string) string {
+	var b strings.Builder
+	b.Grow(len(s))
+	space := false
+	for _, r := range s {
+		switch {
+		case unicode.IsSpace(r):
+			space = b.Len() > 0
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			continue
+		default:
+			if space {
+				b.WriteByte(' ')
+				space = false
+			}
+			b.WriteRune(unicode.ToLower(r))
+		}
+	}
+	return b.String()
+}
+
+// Fingerprint returns a stable hash of the normalized body text.
+// Books with identical text produce the same value regardless of packaging.
+func (b *Book) Fingerprint() string {
+	hasher := NewFingerprintHasher()
+	for _, ch := range b.Content.Chapters {
+		for _, elem := range ch.Elements {
+			if p, ok := elem.(*Paragraph); ok {
+				hasher.AddParagraph(p.Text)
+			}
+		}
+	}
+	return hasher.Sum()
+}
+
+// Fingerprint returns a short hash of the normalized title and author names
+func (m Metadata) Fingerprint() string {
+	authors := make([]string, 0, len(m.Authors))
+	for _, a := range m.Authors {
+		if name := NormalizeFingerprintText(a.FullName()); name != "" {
+			authors = append(authors, name)
+		}
+	}
+	sort.Strings(authors)
+
+	h := sha256.New()
+	h.Write([]byte(NormalizeFingerprintText(m.Title)))
+	for _, a := range authors {
+		h.Write([]byte{'\n'})
+		h.Write([]byte(a))
+	}
+	return FingerprintVersion + ":sha256:" + hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// ExtractFingerprint computes the content fingerprint of an ebook file.
+// Formats that provide a streaming implementation avoid building the element
+// tree; others fall back to a full parse.
+func ExtractFingerprint(filePath string) (string, error) {
+	format := detectFormat(filePath)
+	if extractor, err := getExtractor(format); err == nil {
+		if fe, ok := extractor.(FingerprintExtractor); ok {
+			return fe.ExtractFingerprintFromFile(filePath)
+		}
+	}
+
+	book, err := Parse(format, filePath)
+	if err != nil {
+		return "", err
+	}
+	return book.Fingerprint(), nil
+}
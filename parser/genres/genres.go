@@ -0,0 +1,246 @@
+// Package genres maps the controlled genre codes of FB2 and the free-text
+// subjects of EPUB onto one taxonomy of canonical genres, for faceted search
+// and for converting between the formats. The tables are data: the embedded
+// genres.csv, which Extend adds to.
+package genres
+
+import (
+	_ "embed"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+)
+
+//go:embed genres.csv
+var defaultTable string
+
+// Genre is a canonical genre
+type Genre struct {
+	Label    string   // Canonical English label (e.g., "Science Fiction"), or the value as given if uncategorized
+	FB2      []string // FB2 genre codes, the first preferred when writing FB2
+	Subjects []string // Typical EPUB subjects, BISAC first, the first preferred when writing EPUB
+
+	// Uncategorized is set for values the tables don't know, which are
+	// passed through as their Label
+	Uncategorized bool
+}
+
+var (
+	mu      sync.RWMutex
+	entries []*Genre          // In table order
+	index   map[string]*Genre // By folded FB2 code, label and subject
+	loaded  sync.Once
+)
+
+// load reads the embedded table on first use
+func load() {
+	loaded.Do(func() {
+		mu.Lock()
+		defer mu.Unlock()
+		index = make(map[string]*Genre)
+		if err := readTable(strings.NewReader(defaultTable)); err != nil {
+			panic(fmt.Sprintf("genres: embedded table: %v", err))
+		}
+	})
+}
+
+// Extend adds the rows of a CSV table to the taxonomy. The table has the
+// columns label, fb2 and subjects, the last two with values separated by
+// "|", and a header row. A row with a known label adds its codes and
+// subjects to the genre; a code or subject already mapped moves to the genre
+// of the row. Safe to call at any time.
+func Extend(r io.Reader) error {
+	load()
+	mu.Lock()
+	defer mu.Unlock()
+	return readTable(r)
+}
+
+// readTable adds the rows of a table to the index, holding mu
+func readTable(r io.Reader) error {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = 3
+	cr.TrimLeadingSpace = true
+	rows, err := cr.ReadAll()
+	if err != nil {
+		return fmt.Errorf("failed to read genre table: %w", err)
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+
+	for _, row := range rows[1:] {
+		label := strings.TrimSpace(row[0])
+		if label == "" {
+			return fmt.Errorf("genre table row %q has no label", strings.Join(row, ","))
+		}
+		genre := index[fold(label)]
+		if genre == nil || fold(genre.Label) != fold(label) {
+			genre = &Genre{Label: label}
+			entries = append(entries, genre)
+		}
+		genre.FB2 = appendNew(genre.FB2, splitList(row[1]))
+		genre.Subjects = appendNew(genre.Subjects, splitList(row[2]))
+
+		values := append([]string{label}, splitList(row[1])...)
+		for _, value := range append(values, splitList(row[2])...) {
+			if previous := index[fold(value)]; previous != nil && previous != genre {
+				previous.FB2 = slices.DeleteFunc(previous.FB2, func(v string) bool { return fold(v) == fold(value) })
+				previous.Subjects = slices.DeleteFunc(previous.Subjects, func(v string) bool { return fold(v) == fold(value) })
+			}
+			index[fold(value)] = genre
+		}
+	}
+	return nil
+}
+
+// Lookup returns the canonical genre of an FB2 code, a label or an EPUB
+// subject. A subject not in the tables is looked up by its broader BISAC
+// parts, so "FICTION / Fantasy / Epic" finds Fantasy through
+// "FICTION / Fantasy / General" if not listed itself.
+func Lookup(value string) (Genre, bool) {
+	load()
+	mu.RLock()
+	defer mu.RUnlock()
+
+	key := fold(value)
+	if key == "" {
+		return Genre{}, false
+	}
+	if genre := index[key]; genre != nil {
+		return clone(genre), true
+	}
+	parts := strings.Split(key, " / ")
+	for n := len(parts) - 1; n > 0; n-- {
+		broader := strings.Join(parts[:n], " / ")
+		for _, key := range []string{broader + " / general", broader} {
+			if genre := index[key]; genre != nil {
+				return clone(genre), true
+			}
+		}
+	}
+	return Genre{}, false
+}
+
+// All returns the canonical genres in table order
+func All() []Genre {
+	load()
+	mu.RLock()
+	defer mu.RUnlock()
+
+	genres := make([]Genre, len(entries))
+	for i, genre := range entries {
+		genres[i] = clone(genre)
+	}
+	return genres
+}
+
+// Normalize returns the canonical genres of FB2 codes or EPUB subjects, or
+// a mix of them, in order and without duplicates. Values the tables don't
+// know are kept as uncategorized genres. Subjects that list several genres
+// in one value, such as "Fantasy; Adventure", are split.
+func Normalize(values []string) []Genre {
+	var genres []Genre
+	seen := make(map[string]bool)
+	for _, value := range values {
+		for _, part := range splitSubjects(value) {
+			genre, ok := Lookup(part)
+			if !ok {
+				genre = Genre{Label: part, Uncategorized: true}
+			}
+			if key := fold(genre.Label); !seen[key] {
+				seen[key] = true
+				genres = append(genres, genre)
+			}
+		}
+	}
+	return genres
+}
+
+// FB2Codes returns the FB2 codes for the genres of a book in any format,
+// for writing FB2. Uncategorized values, which FB2 readers wouldn't know,
+// are left out.
+func FB2Codes(values []string) []string {
+	var codes []string
+	for _, genre := range Normalize(values) {
+		if !genre.Uncategorized && len(genre.FB2) > 0 {
+			codes = append(codes, genre.FB2[0])
+		}
+	}
+	return codes
+}
+
+// EPUBSubjects returns the EPUB subjects for the genres of a book in any
+// format, for writing EPUB. Uncategorized values are kept as they are.
+func EPUBSubjects(values []string) []string {
+	var subjects []string
+	for _, genre := range Normalize(values) {
+		if genre.Uncategorized || len(genre.Subjects) == 0 {
+			subjects = append(subjects, genre.Label)
+			continue
+		}
+		subjects = append(subjects, genre.Subjects[0])
+	}
+	return subjects
+}
+
+// Labels returns the canonical labels of the genres, for facets
+func Labels(values []string) []string {
+	genres := Normalize(values)
+	labels := make([]string, len(genres))
+	for i, genre := range genres {
+		labels[i] = genre.Label
+	}
+	return labels
+}
+
+// fold returns the lookup key of a value: lowercased, with whitespace
+// collapsed and slashes spaced as BISAC writes them
+func fold(value string) string {
+	value = strings.ReplaceAll(strings.ToLower(value), "/", " / ")
+	return strings.Join(strings.Fields(value), " ")
+}
+
+// splitList splits a "|" separated table cell
+func splitList(cell string) []string {
+	var values []string
+	for _, value := range strings.Split(cell, "|") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// splitSubjects splits a subject listing several genres at semicolons,
+// which BISAC headings don't use
+func splitSubjects(value string) []string {
+	var parts []string
+	for _, part := range strings.Split(value, ";") {
+		if part = strings.TrimSpace(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return parts
+}
+
+// appendNew appends the values not in list yet, ignoring case
+func appendNew(list, values []string) []string {
+	for _, value := range values {
+		if !slices.ContainsFunc(list, func(v string) bool { return fold(v) == fold(value) }) {
+			list = append(list, value)
+		}
+	}
+	return list
+}
+
+// clone returns a copy of a genre that callers can't change the tables through
+func clone(genre *Genre) Genre {
+	c := *genre
+	c.FB2 = slices.Clone(genre.FB2)
+	c.Subjects = slices.Clone(genre.Subjects)
+	return c
+}
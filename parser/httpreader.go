@@ -0,0 +1,323 @@
+package parser
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// DefaultHTTPBlockSize is the size of the ranges HTTPReaderAt requests
+	DefaultHTTPBlockSize = 64 * 1024
+
+	// DefaultHTTPCacheBlocks is the number of blocks HTTPReaderAt keeps cached
+	DefaultHTTPCacheBlocks = 64
+)
+
+// HTTPStatusError is returned when a server answers with an unexpected status
+type HTTPStatusError struct {
+	URL        string
+	StatusCode int
+}
+
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("unexpected HTTP status %d for %s", e.StatusCode, e.URL)
+}
+
+// HTTPReaderAt is an io.ReaderAt over a remote file, reading it with HTTP
+// Range requests so the fast extractors only download the parts they need.
+//
+// Reads are served from a cache of fixed-size blocks; consecutive missing
+// blocks are fetched with a single request. Opening costs one request, which
+// also fills the first block. A ZIP-based book (EPUB, CBZ) then typically
+// needs 2-4 more: the central directory at the end of the file, the OPF or
+// ComicInfo.xml, and the cover. FB2 and MOBI metadata usually sits in the
+// first blocks.
+//
+// When the server ignores ranges (answers 200 instead of 206), the opening
+// request downloads the whole file and later reads cost no requests.
+//
+// HTTPReaderAt is safe for concurrent use. Requests are canceled with the
+// context passed to NewHTTPReaderAt.
+type HTTPReaderAt struct {
+	ctx    context.Context
+	client *http.Client
+	url    string
+	size   int64
+
+	blockSize int64
+	maxBlocks int
+
+	mu     sync.Mutex
+	blocks map[int64][]byte // Cached blocks by index
+	order  []int64          // Block indexes, oldest first
+	full   []byte           // Whole file, when the server ignores ranges
+}
+
+// NewHTTPReaderAt opens a remote file for reading with Range requests. A nil
+// client uses http.DefaultClient.
+func NewHTTPReaderAt(ctx context.Context, rawURL string, client *http.Client) (*HTTPReaderAt, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	r := &HTTPReaderAt{
+		ctx:       ctx,
+		client:    client,
+		url:       rawURL,
+		blockSize: DefaultHTTPBlockSize,
+		maxBlocks: DefaultHTTPCacheBlocks,
+		blocks:    make(map[int64][]byte),
+	}
+
+	// The first block is requested right away: a 206 answer gives the size,
+	// a 200 answer means ranges are not supported
+	data, total, err := r.fetch(0, r.blockSize-1)
+	if err != nil {
+		return nil, err
+	}
+	if r.full != nil {
+		r.size = int64(len(r.full))
+		return r, nil
+	}
+	r.size = total
+	r.store(0, data, 0, 0)
+
+	return r, nil
+}
+
+// Size returns the size of the remote file
+func (r *HTTPReaderAt) Size() int64 {
+	return r.size
+}
+
+// ReadAt implements io.ReaderAt
+func (r *HTTPReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("negative offset: %d", off)
+	}
+	if off >= r.size {
+		return 0, io.EOF
+	}
+
+	end := off + int64(len(p))
+	if end > r.size {
+		end = r.size
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Reads larger than the cache bypass it
+	if r.full == nil && (end-1)/r.blockSize-off/r.blockSize >= int64(r.maxBlocks) {
+		data, _, err := r.fetch(off, end-1)
+		if err != nil {
+			return 0, err
+		}
+		if r.full != nil {
+			data = r.full[off:end]
+		}
+		n := copy(p, data)
+		if n < len(p) {
+			return n, io.EOF
+		}
+		return n, nil
+	}
+
+	if err := r.load(off/r.blockSize, (end-1)/r.blockSize); err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for pos := off; pos < end; {
+		var chunk []byte
+		if r.full != nil {
+			chunk = r.full[pos:end]
+		} else {
+			index := pos / r.blockSize
+			block := r.blocks[index]
+			if pos-index*r.blockSize >= int64(len(block)) {
+				return n, fmt.Errorf("failed to read %s: short range response", r.url)
+			}
+			chunk = block[pos-index*r.blockSize:]
+			if int64(len(chunk)) > end-pos {
+				chunk = chunk[:end-pos]
+			}
+		}
+		copied := copy(p[n:], chunk)
+		n += copied
+		pos += int64(copied)
+	}
+
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// load makes sure the blocks first..last are cached, fetching each run of
+// missing blocks with one request
+func (r *HTTPReaderAt) load(first, last int64) error {
+	for index := first; index <= last && r.full == nil; {
+		if _, ok := r.blocks[index]; ok {
+			index++
+			continue
+		}
+
+		runEnd := index
+		for runEnd < last {
+			if _, ok := r.blocks[runEnd+1]; ok {
+				break
+			}
+			runEnd++
+		}
+
+		start := index * r.blockSize
+		stop := (runEnd+1)*r.blockSize - 1
+		if stop >= r.size {
+			stop = r.size - 1
+		}
+		data, _, err := r.fetch(start, stop)
+		if err != nil {
+			return err
+		}
+		if r.full != nil {
+			return nil
+		}
+		for i := index; i <= runEnd; i++ {
+			from := (i - index) * r.blockSize
+			if from >= int64(len(data)) {
+				return fmt.Errorf("failed to read %s: short range response", r.url)
+			}
+			to := from + r.blockSize
+			if to > int64(len(data)) {
+				to = int64(len(data))
+			}
+			r.store(i, data[from:to], first, last)
+		}
+		index = runEnd + 1
+	}
+	return nil
+}
+
+// store caches a block, dropping the oldest one when the cache is full. The
+// blocks first..last of the read in progress are never dropped; reads span
+// fewer blocks than the cache holds, so there is always another to drop.
+func (r *HTTPReaderAt) store(index int64, data []byte, first, last int64) {
+	if len(r.order) >= r.maxBlocks {
+		for i, old := range r.order {
+			if old < first || old > last {
+				delete(r.blocks, old)
+				r.order = append(r.order[:i], r.order[i+1:]...)
+				break
+			}
+		}
+	}
+	r.blocks[index] = data
+	r.order = append(r.order, index)
+}
+
+// fetch requests the bytes start..stop (inclusive) and returns them with the
+// total size of the file. A 200 answer stores the whole file in r.full.
+func (r *HTTPReaderAt) fetch(start, stop int64) ([]byte, int64, error) {
+	req, err := http.NewRequestWithContext(r.ctx, http.MethodGet, r.url, nil)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, stop))
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to fetch %s: %w", r.url, err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		total, err := contentRangeTotal(resp.Header.Get("Content-Range"))
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to fetch %s: %w", r.url, err)
+		}
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to read %s: %w", r.url, err)
+		}
+		return data, total, nil
+
+	case http.StatusOK:
+		// Ranges are not supported, fall back to the whole file
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to read %s: %w", r.url, err)
+		}
+		r.full = data
+		r.blocks, r.order = nil, nil
+		return data, int64(len(data)), nil
+
+	case http.StatusRequestedRangeNotSatisfiable:
+		// Empty file: there is no first block to request
+		if total, err := contentRangeTotal(resp.Header.Get("Content-Range")); err == nil && total == 0 {
+			r.full = []byte{}
+			return nil, 0, nil
+		}
+	}
+
+	return nil, 0, &HTTPStatusError{URL: r.url, StatusCode: resp.StatusCode}
+}
+
+// contentRangeTotal returns the total size from a "bytes 0-99/1234" or
+// "bytes */1234" Content-Range header
+func contentRangeTotal(header string) (int64, error) {
+	_, total, found := strings.Cut(header, "/")
+	if !found || !strings.HasPrefix(header, "bytes ") {
+		return 0, fmt.Errorf("invalid Content-Range: %q", header)
+	}
+	size, err := strconv.ParseInt(total, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid Content-Range: %q", header)
+	}
+	return size, nil
+}
+
+// openURL opens a remote book and detects its format from the content,
+// falling back to the extension in the URL path
+func openURL(ctx context.Context, rawURL string) (*HTTPReaderAt, string, error) {
+	r, err := NewHTTPReaderAt(ctx, rawURL, nil)
+	if err != nil {
+		return nil, "", err
+	}
+
+	format := DetectFormatReader(r, r.Size())
+	if format == "unknown" {
+		if u, err := url.Parse(rawURL); err == nil {
+			format = formatFromExtension(path.Base(u.Path))
+		}
+	}
+	return r, format, nil
+}
+
+// ExtractMetadataFromURL extracts metadata from a remote book with HTTP
+// Range requests, without downloading the whole file
+func ExtractMetadataFromURL(ctx context.Context, rawURL string) (Metadata, error) {
+	r, format, err := openURL(ctx, rawURL)
+	if err != nil {
+		return Metadata{}, err
+	}
+	return ExtractMetadataFromReader(r, r.Size(), format)
+}
+
+// ExtractCoverFromURL extracts the cover image from a remote book with HTTP
+// Range requests, without downloading the whole file
+func ExtractCoverFromURL(ctx context.Context, rawURL string) ([]byte, string, error) {
+	r, format, err := openURL(ctx, rawURL)
+	if err != nil {
+		return nil, "", err
+	}
+	return ExtractCoverFromReader(r, r.Size(), format)
+}
@@ -0,0 +1,234 @@
+package parser
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// rangeServer serves data with Range support and counts the requests
+func rangeServer(t *testing.T, data []byte) (*httptest.Server, *atomic.Int64) {
+	t.Helper()
+	var requests atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests.Add(1)
+		http.ServeContent(w, req, "book.bin", time.Time{}, bytes.NewReader(data))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+// testData returns n bytes that differ at every offset within a block
+func testData(n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(i*7 + i/DefaultHTTPBlockSize)
+	}
+	return data
+}
+
+func TestHTTPReaderAtReadsRanges(t *testing.T) {
+	data := testData(5*DefaultHTTPBlockSize + 123)
+	srv, requests := rangeServer(t, data)
+
+	r, err := NewHTTPReaderAt(context.Background(), srv.URL, nil)
+	if err != nil {
+		t.Fatalf("NewHTTPReaderAt: %v", err)
+	}
+	if r.Size() != int64(len(data)) {
+		t.Fatalf("Size = %d, want %d", r.Size(), len(data))
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("opening made %d requests, want 1", n)
+	}
+
+	tests := []struct {
+		name string
+		off  int64
+		n    int
+	}{
+		{"first block", 10, 100},
+		{"across a block boundary", DefaultHTTPBlockSize - 10, 20},
+		{"several blocks", DefaultHTTPBlockSize + 5, 2*DefaultHTTPBlockSize + 7},
+		{"tail", int64(len(data)) - 50, 50},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := make([]byte, tt.n)
+			n, err := r.ReadAt(p, tt.off)
+			if err != nil || n != tt.n {
+				t.Fatalf("ReadAt = %d, %v; want %d, nil", n, err, tt.n)
+			}
+			if !bytes.Equal(p, data[tt.off:tt.off+int64(tt.n)]) {
+				t.Errorf("ReadAt(%d) returned wrong bytes", tt.off)
+			}
+		})
+	}
+
+	// Cached blocks cost no requests
+	before := requests.Load()
+	if _, err := r.ReadAt(make([]byte, 20), DefaultHTTPBlockSize-10); err != nil {
+		t.Fatalf("ReadAt: %v", err)
+	}
+	if n := requests.Load() - before; n != 0 {
+		t.Errorf("cached read made %d requests, want 0", n)
+	}
+
+	// Reads past the end return what is there and io.EOF
+	p := make([]byte, 100)
+	n, err := r.ReadAt(p, int64(len(data))-10)
+	if n != 10 || err != io.EOF {
+		t.Errorf("ReadAt past the end = %d, %v; want 10, io.EOF", n, err)
+	}
+	if _, err := r.ReadAt(p, int64(len(data))); err != io.EOF {
+		t.Errorf("ReadAt at the end = %v, want io.EOF", err)
+	}
+}
+
+// A read that loads blocks into a full cache must not drop the blocks it
+// still needs
+func TestHTTPReaderAtKeepsBlocksOfTheRead(t *testing.T) {
+	data := testData(170 * DefaultHTTPBlockSize)
+	srv, _ := rangeServer(t, data)
+
+	r, err := NewHTTPReaderAt(context.Background(), srv.URL, nil)
+	if err != nil {
+		t.Fatalf("NewHTTPReaderAt: %v", err)
+	}
+	one := make([]byte, 1)
+	for block := int64(100); block <= 162; block++ {
+		if _, err := r.ReadAt(one, block*DefaultHTTPBlockSize); err != nil {
+			t.Fatalf("ReadAt block %d: %v", block, err)
+		}
+	}
+
+	for _, off := range []int64{100, 0, 150 * DefaultHTTPBlockSize} {
+		p := make([]byte, 64*1024)
+		done := make(chan error, 1)
+		go func() {
+			_, err := r.ReadAt(p, off)
+			done <- err
+		}()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("ReadAt(%d): %v", off, err)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatalf("ReadAt(%d) did not return", off)
+		}
+		if !bytes.Equal(p, data[off:off+int64(len(p))]) {
+			t.Errorf("ReadAt(%d) returned wrong bytes", off)
+		}
+	}
+	if len(r.order) > r.maxBlocks || len(r.blocks) != len(r.order) {
+		t.Errorf("cache holds %d blocks in %d entries, max %d", len(r.blocks), len(r.order), r.maxBlocks)
+	}
+}
+
+func TestHTTPReaderAtLargeReadBypassesCache(t *testing.T) {
+	data := testData((DefaultHTTPCacheBlocks + 3) * DefaultHTTPBlockSize)
+	srv, requests := rangeServer(t, data)
+
+	r, err := NewHTTPReaderAt(context.Background(), srv.URL, nil)
+	if err != nil {
+		t.Fatalf("NewHTTPReaderAt: %v", err)
+	}
+	before := requests.Load()
+	p := make([]byte, len(data)-1)
+	if _, err := r.ReadAt(p, 1); err != nil {
+		t.Fatalf("ReadAt: %v", err)
+	}
+	if !bytes.Equal(p, data[1:]) {
+		t.Error("large read returned wrong bytes")
+	}
+	if n := requests.Load() - before; n != 1 {
+		t.Errorf("large read made %d requests, want 1", n)
+	}
+	if len(r.blocks) != 1 {
+		t.Errorf("large read cached %d blocks, want the first only", len(r.blocks))
+	}
+}
+
+func TestHTTPReaderAtWithoutRangeSupport(t *testing.T) {
+	data := testData(3*DefaultHTTPBlockSize + 1)
+	var requests atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests.Add(1)
+		w.Write(data)
+	}))
+	defer srv.Close()
+
+	r, err := NewHTTPReaderAt(context.Background(), srv.URL, nil)
+	if err != nil {
+		t.Fatalf("NewHTTPReaderAt: %v", err)
+	}
+	if r.Size() != int64(len(data)) {
+		t.Fatalf("Size = %d, want %d", r.Size(), len(data))
+	}
+	p := make([]byte, 2*DefaultHTTPBlockSize)
+	if _, err := r.ReadAt(p, 17); err != nil {
+		t.Fatalf("ReadAt: %v", err)
+	}
+	if !bytes.Equal(p, data[17:17+len(p)]) {
+		t.Error("ReadAt returned wrong bytes")
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("made %d requests, want 1", n)
+	}
+}
+
+func TestHTTPReaderAtEmptyFile(t *testing.T) {
+	srv, _ := rangeServer(t, nil)
+
+	r, err := NewHTTPReaderAt(context.Background(), srv.URL, nil)
+	if err != nil {
+		t.Fatalf("NewHTTPReaderAt: %v", err)
+	}
+	if r.Size() != 0 {
+		t.Errorf("Size = %d, want 0", r.Size())
+	}
+	if _, err := r.ReadAt(make([]byte, 1), 0); err != io.EOF {
+		t.Errorf("ReadAt = %v, want io.EOF", err)
+	}
+}
+
+func TestHTTPReaderAtStatusError(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	_, err := NewHTTPReaderAt(context.Background(), srv.URL, nil)
+	statusErr, ok := err.(*HTTPStatusError)
+	if !ok || statusErr.StatusCode != http.StatusNotFound {
+		t.Fatalf("NewHTTPReaderAt error = %v, want *HTTPStatusError 404", err)
+	}
+	if !strings.Contains(err.Error(), "404") {
+		t.Errorf("error %q does not name the status", err)
+	}
+}
+
+func TestContentRangeTotal(t *testing.T) {
+	tests := []struct {
+		header  string
+		want    int64
+		wantErr bool
+	}{
+		{"bytes 0-99/1234", 1234, false},
+		{"bytes */0", 0, false},
+		{"bytes 0-99/*", 0, true},
+		{"0-99/1234", 0, true},
+		{"", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := contentRangeTotal(tt.header)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("contentRangeTotal(%q) = %d, %v; want %d, error %v", tt.header, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package parser_test
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	_ "github.com/vpoluyaktov/biblio-ebook-parser/formats"
+	"github.com/vpoluyaktov/biblio-ebook-parser/parser"
+	"github.com/vpoluyaktov/biblio-ebook-parser/testutil/epubtest"
+)
+
+// pngHeader is the start of a PNG, enough for type detection
+var pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR\x00\x00\x00\x01\x00\x00\x00\x01\x08\x06\x00\x00\x00\x1f\x15\xc4\x89")
+
+func TestExtractFromURLWithRanges(t *testing.T) {
+	// A large incompressible file in the middle, so the metadata and the
+	// cover take a few ranges of a much larger book
+	filler := make([]byte, 2<<20)
+	rand.New(rand.NewSource(1)).Read(filler)
+	data := epubtest.New().
+		WithTitle("Remote Book").
+		WithAuthor("Jane Doe").
+		WithChapter("One", "<p>Text.</p>").
+		WithFile("images/filler.bin", filler).
+		WithCover(pngHeader).
+		Bytes()
+
+	var requests, served atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests.Add(1)
+		rec := &countingWriter{ResponseWriter: w, n: &served}
+		http.ServeContent(rec, req, "book.epub", time.Time{}, bytes.NewReader(data))
+	}))
+	defer srv.Close()
+
+	meta, err := parser.ExtractMetadataFromURL(context.Background(), srv.URL+"/book.epub")
+	if err != nil {
+		t.Fatalf("ExtractMetadataFromURL: %v", err)
+	}
+	if meta.Title != "Remote Book" {
+		t.Errorf("Title = %q, want %q", meta.Title, "Remote Book")
+	}
+	if n := requests.Load(); n > 5 {
+		t.Errorf("metadata took %d requests, want at most 5", n)
+	}
+	if n := served.Load(); n >= int64(len(data))/2 {
+		t.Errorf("metadata downloaded %d of %d bytes", n, len(data))
+	}
+
+	cover, mimeType, err := parser.ExtractCoverFromURL(context.Background(), srv.URL+"/book.epub")
+	if err != nil {
+		t.Fatalf("ExtractCoverFromURL: %v", err)
+	}
+	if !bytes.Equal(cover, pngHeader) || mimeType != "image/png" {
+		t.Errorf("cover = %d bytes of %s, want the PNG", len(cover), mimeType)
+	}
+}
+
+func TestExtractFromURLCanceled(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		<-req.Context().Done()
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := parser.ExtractMetadataFromURL(ctx, srv.URL); err == nil {
+		t.Fatal("ExtractMetadataFromURL succeeded after the context was canceled")
+	}
+}
+
+// countingWriter counts the body bytes written
+type countingWriter struct {
+	http.ResponseWriter
+	n *atomic.Int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n.Add(int64(len(p)))
+	return w.ResponseWriter.Write(p)
+}
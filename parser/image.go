@@ -0,0 +1,83 @@
+package parser
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"  // Image dimensions
+	_ "image/jpeg" // Image dimensions
+	_ "image/png"  // Image dimensions
+	"net/http"
+	"strings"
+
+	_ "golang.org/x/image/bmp"  // Image dimensions
+	_ "golang.org/x/image/webp" // Image dimensions
+)
+
+// ErrNoCover is returned by cover extraction when the file a book names as
+// its cover is not a recognizable image, such as an XHTML wrapper page
+var ErrNoCover = errors.New("cover is not an image")
+
+// ImageSize returns the dimensions of image data in pixels, read from its
+// header without decoding the image. JPEG, PNG, GIF, WebP and BMP are read.
+func ImageSize(data []byte) (width, height int, err error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read image dimensions: %w", err)
+	}
+	return config.Width, config.Height, nil
+}
+
+// SetCover sets the cover image and its dimensions, read from the image
+// header. If they can't be read, as for damaged data, the cover is still set
+// with zero dimensions and the error tells why. SVG covers have no pixel
+// dimensions and give no error.
+func (m *Metadata) SetCover(data []byte, mimeType string) error {
+	m.CoverData, m.CoverType = data, mimeType
+	m.CoverWidth, m.CoverHeight = 0, 0
+	if len(data) == 0 || mimeType == "image/svg+xml" {
+		return nil
+	}
+	width, height, err := ImageSize(data)
+	if err != nil {
+		return fmt.Errorf("cover: %w", err)
+	}
+	m.CoverWidth, m.CoverHeight = width, height
+	return nil
+}
+
+// SetCover sets the cover of the book as Metadata.SetCover does, noting in
+// Warnings when its dimensions can't be read
+func (b *Book) SetCover(data []byte, mimeType string) {
+	if err := b.Metadata.SetCover(data, mimeType); err != nil {
+		b.Warnings = append(b.Warnings, err.Error())
+	}
+}
+
+// ImageType returns the MIME type of image data from its magic bytes, or ""
+// if the data is not an image. The declared type, such as the EPUB manifest
+// media-type, settles what the bytes can't: SVG, which has no magic bytes.
+func ImageType(data []byte, declared string) string {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFF, 0xD8, 0xFF}):
+		return "image/jpeg"
+	case bytes.HasPrefix(data, []byte{0x89, 'P', 'N', 'G', 0x0D, 0x0A, 0x1A, 0x0A}):
+		return "image/png"
+	case bytes.HasPrefix(data, []byte("GIF87a")), bytes.HasPrefix(data, []byte("GIF89a")):
+		return "image/gif"
+	case len(data) >= 12 && bytes.HasPrefix(data, []byte("RIFF")) && string(data[8:12]) == "WEBP":
+		return "image/webp"
+	}
+
+	// Less common formats, such as BMP
+	if mimeType := http.DetectContentType(data); strings.HasPrefix(mimeType, "image/") {
+		return mimeType
+	}
+
+	// SVG is XML, so only an SVG declaration tells it from an XHTML page
+	if strings.ToLower(strings.TrimSpace(declared)) == "image/svg+xml" && bytes.Contains(data[:min(len(data), 1024)], []byte("<svg")) {
+		return "image/svg+xml"
+	}
+	return ""
+}
@@ -0,0 +1,60 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Issue is a part of a book that failed to parse and was left out, such as a
+// corrupt chapter file
+type Issue struct {
+	Part string // Container entry (EPUB) or element path such as "body[0]/section[3]" (FB2)
+	Err  error
+}
+
+func (i Issue) Error() string {
+	return fmt.Sprintf("%s: %v", i.Part, i.Err)
+}
+
+func (i Issue) Unwrap() error {
+	return i.Err
+}
+
+// PartialError is returned together with a book when parts of it failed to
+// parse. The book holds everything else, so callers that can do with partial
+// content check for it with errors.As and go on.
+type PartialError struct {
+	Issues []Issue
+}
+
+func (e *PartialError) Error() string {
+	messages := make([]string, len(e.Issues))
+	for i, issue := range e.Issues {
+		messages[i] = issue.Error()
+	}
+	return fmt.Sprintf("book parsed in part, %d part(s) failed: %s", len(e.Issues), strings.Join(messages, "; "))
+}
+
+// Unwrap returns the issues, so errors.Is finds their causes
+func (e *PartialError) Unwrap() []error {
+	errs := make([]error, len(e.Issues))
+	for i, issue := range e.Issues {
+		errs[i] = issue
+	}
+	return errs
+}
+
+// AddIssue records a part of the book that failed to parse, noting it in
+// Warnings too
+func (b *Book) AddIssue(part string, err error) {
+	b.Issues = append(b.Issues, Issue{Part: part, Err: err})
+	b.Warnings = append(b.Warnings, b.Issues[len(b.Issues)-1].Error())
+}
+
+// Err returns a *PartialError listing the Issues, nil if there are none
+func (b *Book) Err() error {
+	if len(b.Issues) == 0 {
+		return nil
+	}
+	return &PartialError{Issues: b.Issues}
+}
@@ -0,0 +1,81 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/vpoluyaktov/biblio-ebook-parser/internal/langdetect"
+)
+
+// languageSampleSize is how much body text the language detector reads
+const languageSampleSize = 4000
+
+// Confidence the detector needs to fill in a missing language, and the higher
+// confidence it needs to dispute a declared one
+const (
+	minFillConfidence    = 0.1
+	minWarningConfidence = 0.3
+)
+
+// DetectLanguage classifies the body text among the languages the detector
+// knows (English, Russian, Ukrainian, German, French and Spanish). An empty
+// Metadata.Language is filled in; a declared language the text contradicts
+// is kept, and the conflict is added to Warnings.
+func (b *Book) DetectLanguage() {
+	detected, confidence := langdetect.Detect(b.textSample(languageSampleSize))
+	if detected == "" {
+		return
+	}
+
+	declared := b.Metadata.Language
+	if declared == "" {
+		if confidence >= minFillConfidence {
+			b.Metadata.Language = detected
+		}
+		return
+	}
+
+	primary, _, _ := strings.Cut(strings.ToLower(strings.ReplaceAll(declared, "_", "-")), "-")
+	if primary != detected && confidence >= minWarningConfidence && isDetectable(primary) {
+		b.Warnings = append(b.Warnings, fmt.Sprintf("declared language %q contradicts the text, which looks like %q", declared, detected))
+	}
+}
+
+// isDetectable reports whether the detector could recognize a language. Text
+// in any other language is classified as the closest known one, which says
+// nothing about the declared value.
+func isDetectable(lang string) bool {
+	switch lang {
+	case "en", "ru", "uk", "de", "fr", "es":
+		return true
+	}
+	return false
+}
+
+// textSample returns about size bytes of body text from the start of the book
+func (b *Book) textSample(size int) string {
+	var sample strings.Builder
+	add := func(text string) bool {
+		sample.WriteString(text)
+		sample.WriteString("\n")
+		return sample.Len() < size
+	}
+
+	for _, ch := range b.Content.Chapters {
+		for _, elem := range ch.Elements {
+			switch e := elem.(type) {
+			case *Paragraph:
+				if !add(e.Text) {
+					return sample.String()
+				}
+			case *Blockquote:
+				for _, p := range e.Paragraphs {
+					if !add(p.Text) {
+						return sample.String()
+					}
+				}
+			}
+		}
+	}
+	return sample.String()
+}
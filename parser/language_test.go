@@ -0,0 +1,53 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+)
+
+func bookWithText(language string, paragraphs ...string) *Book {
+	var elements []Element
+	for _, p := range paragraphs {
+		elements = append(elements, &Paragraph{Text: p})
+	}
+	return &Book{
+		Metadata: Metadata{Language: language},
+		Content:  Content{Chapters: []Chapter{{ID: "ch1", Elements: elements}}},
+	}
+}
+
+func TestDetectLanguage(t *testing.T) {
+	const (
+		russian   = "Все счастливые семьи похожи друг на друга, каждая несчастливая семья несчастлива по-своему."
+		ukrainian = "Усі щасливі родини схожі між собою, кожна нещаслива родина нещаслива по-своєму."
+	)
+	tests := []struct {
+		name       string
+		book       *Book
+		language   string
+		conflicted bool
+	}{
+		{name: "filled in", book: bookWithText("", russian), language: "ru"},
+		{name: "ukrainian filled in", book: bookWithText("", ukrainian), language: "uk"},
+		{name: "declared and agreeing", book: bookWithText("ru-RU", russian), language: "ru-RU"},
+		{name: "declared and contradicted", book: bookWithText("uk", russian), language: "uk", conflicted: true},
+		{name: "declared undetectable", book: bookWithText("be", russian), language: "be"},
+		// Undetermined text changes nothing
+		{name: "too short", book: bookWithText("", "Привет, мир."), language: ""},
+		{name: "other script", book: bookWithText("", "道可道，非常道。名可名，非常名。無名天地之始；有名萬物之母。故常無欲，以觀其妙。"), language: ""},
+		{name: "too short to dispute", book: bookWithText("en", "Привет, мир."), language: "en"},
+		{name: "no text", book: bookWithText(""), language: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.book.DetectLanguage()
+			if got := tt.book.Metadata.Language; got != tt.language {
+				t.Errorf("language = %q, want %q", got, tt.language)
+			}
+			conflicted := len(tt.book.Warnings) > 0 && strings.Contains(tt.book.Warnings[0], "contradicts")
+			if conflicted != tt.conflicted || len(tt.book.Warnings) > 1 {
+				t.Errorf("warnings = %q", tt.book.Warnings)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package parser
+
+import (
+	"log/slog"
+	"sync/atomic"
+)
+
+// logger is the logger set by SetLogger, nil when logging is off
+var logger atomic.Pointer[slog.Logger]
+
+// SetLogger sets the logger the parsers report to: debug records for the
+// fallbacks they take, such as sanitizing a malformed FB2, the TOC an EPUB's
+// chapters come from or a detected charset, and a warn record for each
+// warning of a parsed book. A nil logger, the default, turns logging off.
+// Safe to call while books are being parsed.
+func SetLogger(l *slog.Logger) {
+	logger.Store(l)
+}
+
+// Logger returns the logger set by SetLogger, or nil. Check for nil before
+// building the record, so nothing is allocated when logging is off:
+//
+//	if log := parser.Logger(); log != nil {
+//		log.Debug("sanitized FB2", "path", path)
+//	}
+func Logger() *slog.Logger {
+	return logger.Load()
+}
+
+// LogWarnings logs the warnings of the book not logged yet at warn level,
+// with the format as an attribute. Parsers call it before returning a book,
+// so each warning is logged once even when a book passes through several
+// parsers (e.g., a .fb2.gz).
+func (b *Book) LogWarnings(format string) {
+	log := Logger()
+	if log == nil {
+		b.loggedWarnings = len(b.Warnings)
+		return
+	}
+	for _, warning := range b.Warnings[min(b.loggedWarnings, len(b.Warnings)):] {
+		log.Warn(warning, "format", format)
+	}
+	b.loggedWarnings = len(b.Warnings)
+}
@@ -0,0 +1,198 @@
+package parser
+
+import (
+	"bytes"
+	"image"
+	"strconv"
+	"strings"
+)
+
+// MergeStrategy decides how Metadata.Merge combines two sets of metadata
+type MergeStrategy int
+
+const (
+	// MergeFillEmpty keeps the fields already set and fills the empty ones
+	// from the other metadata
+	MergeFillEmpty MergeStrategy = iota
+	// MergeOverride takes every field the other metadata sets, keeping the
+	// current value only where the other is empty
+	MergeOverride
+	// MergeUnion fills empty fields as MergeFillEmpty does, and combines
+	// authors, genres, sequences and identifiers without duplicates
+	MergeUnion
+)
+
+// Merge returns the metadata combined with other by the strategy. Fields
+// that go together, such as Description and DescriptionHTML or the cover
+// data and type, are taken from the same side. Whatever the strategy, a
+// cover that is a valid image is preferred to one that isn't, and of two
+// valid covers the one with more pixels is kept.
+func (m Metadata) Merge(other Metadata, strategy MergeStrategy) Metadata {
+	merged := m
+	override := strategy == MergeOverride
+
+	// takes reports whether a field set as incoming is taken over current
+	takes := func(current, incoming bool) bool {
+		return incoming && (override || !current)
+	}
+	pick := func(current, incoming string) string {
+		if takes(strings.TrimSpace(current) != "", strings.TrimSpace(incoming) != "") {
+			return incoming
+		}
+		return current
+	}
+	merged.Title = pick(m.Title, other.Title)
+	merged.Language = pick(m.Language, other.Language)
+	merged.Publisher = pick(m.Publisher, other.Publisher)
+	merged.PublishCity = pick(m.PublishCity, other.PublishCity)
+
+	if takes(strings.TrimSpace(m.Description) != "", strings.TrimSpace(other.Description) != "") {
+		merged.Description, merged.DescriptionHTML = other.Description, other.DescriptionHTML
+	}
+	if takes(m.PublicationDate != "" || m.PublicationYear != 0, other.PublicationDate != "" || other.PublicationYear != 0) {
+		merged.PublicationDate, merged.PublicationTime, merged.PublicationYear = other.PublicationDate, other.PublicationTime, other.PublicationYear
+	}
+	if takes(m.ModifiedDate != "" || !m.ModifiedTime.IsZero(), other.ModifiedDate != "" || !other.ModifiedTime.IsZero()) {
+		merged.ModifiedDate, merged.ModifiedTime = other.ModifiedDate, other.ModifiedTime
+	}
+
+	switch strategy {
+	case MergeUnion:
+		merged.Authors = unionBy(m.Authors, other.Authors, func(a Author) string { return normalizeName(a.FullName()) })
+		merged.Genres = unionBy(m.Genres, other.Genres, normalizeName)
+		merged.Sequences = unionBy(m.Sequences, other.Sequences, func(s Sequence) string { return normalizeName(s.Name) })
+		merged.Identifiers = unionBy(m.Identifiers, other.Identifiers, identifierKey)
+	default:
+		merged.Authors = pickList(m.Authors, other.Authors, override)
+		merged.Genres = pickList(m.Genres, other.Genres, override)
+		merged.Sequences = pickList(m.Sequences, other.Sequences, override)
+		merged.Identifiers = pickList(m.Identifiers, other.Identifiers, override)
+	}
+
+	// Series mirrors the first sequence, or else is merged as a pair with
+	// its number
+	if len(merged.Sequences) > 0 {
+		merged.Series, merged.SeriesIndex = merged.Sequences[0].Name, merged.Sequences[0].Number
+	} else if takes(strings.TrimSpace(m.Series) != "", strings.TrimSpace(other.Series) != "") {
+		merged.Series, merged.SeriesIndex = other.Series, other.SeriesIndex
+	}
+
+	if takes(m.DocumentInfo != nil, other.DocumentInfo != nil) {
+		merged.DocumentInfo = other.DocumentInfo
+	}
+	if takes(m.Raw != nil, other.Raw != nil) {
+		merged.Raw = other.Raw
+	}
+
+	if betterCover(other.CoverData, other.CoverType, m.CoverData, m.CoverType) {
+		merged.CoverData, merged.CoverType = other.CoverData, other.CoverType
+		merged.CoverWidth, merged.CoverHeight = other.CoverWidth, other.CoverHeight
+	}
+	return merged
+}
+
+// Equal reports whether two sets of metadata describe the book the same way,
+// ignoring case and surrounding or repeated whitespace. Authors, genres,
+// sequences and identifiers are compared as sets, authors by full name.
+// Raw, DocumentInfo and the modification date, which describe the file
+// rather than the book, and DescriptionHTML and PublicationTime, which
+// follow Description and PublicationDate, are not compared.
+func (m Metadata) Equal(other Metadata) bool {
+	return normalizeName(m.Title) == normalizeName(other.Title) &&
+		normalizeName(m.Language) == normalizeName(other.Language) &&
+		normalizeName(m.Description) == normalizeName(other.Description) &&
+		normalizeName(m.Series) == normalizeName(other.Series) &&
+		m.SeriesIndex == other.SeriesIndex &&
+		normalizeName(m.Publisher) == normalizeName(other.Publisher) &&
+		normalizeName(m.PublishCity) == normalizeName(other.PublishCity) &&
+		normalizeName(m.PublicationDate) == normalizeName(other.PublicationDate) &&
+		m.PublicationYear == other.PublicationYear &&
+		bytes.Equal(m.CoverData, other.CoverData) &&
+		sameSet(m.Authors, other.Authors, func(a Author) string { return normalizeName(a.FullName()) }) &&
+		sameSet(m.Genres, other.Genres, normalizeName) &&
+		sameSet(m.Sequences, other.Sequences, func(s Sequence) string { return normalizeName(s.Name) + "\x00" + strconv.Itoa(s.Number) }) &&
+		sameSet(m.Identifiers, other.Identifiers, identifierKey)
+}
+
+// normalizeName lowercases a value and collapses its whitespace
+func normalizeName(s string) string {
+	return strings.ToLower(strings.Join(strings.Fields(s), " "))
+}
+
+// identifierKey compares identifiers by scheme and value, ignoring the
+// hyphens and spaces ISBNs are often written with
+func identifierKey(id Identifier) string {
+	value := normalizeName(id.Value)
+	if normalizeName(id.Scheme) == "isbn" {
+		value = strings.NewReplacer("-", "", " ", "").Replace(value)
+	}
+	return normalizeName(id.Scheme) + "\x00" + value
+}
+
+// pickList returns incoming if it is set and replaces or fills current
+func pickList[T any](current, incoming []T, override bool) []T {
+	if len(incoming) > 0 && (override || len(current) == 0) {
+		return incoming
+	}
+	return current
+}
+
+// unionBy returns current followed by the items of incoming whose key is
+// not yet present. Items with an empty key are dropped from incoming.
+func unionBy[T any](current, incoming []T, key func(T) string) []T {
+	seen := make(map[string]bool, len(current))
+	for _, item := range current {
+		seen[key(item)] = true
+	}
+	union := append([]T(nil), current...)
+	for _, item := range incoming {
+		if k := key(item); k != "" && !seen[k] {
+			seen[k] = true
+			union = append(union, item)
+		}
+	}
+	return union
+}
+
+// sameSet reports whether two lists hold the same keys, ignoring order and
+// repeats
+func sameSet[T any](a, b []T, key func(T) string) bool {
+	keys := make(map[string]bool, len(a))
+	for _, item := range a {
+		keys[key(item)] = true
+	}
+	other := make(map[string]bool, len(b))
+	for _, item := range b {
+		k := key(item)
+		if !keys[k] {
+			return false
+		}
+		other[k] = true
+	}
+	return len(other) == len(keys)
+}
+
+// betterCover reports whether a candidate cover should replace the current
+// one: a valid image replaces an invalid or missing one, and of two valid
+// images the one with more pixels (or, if that can't be told, more bytes)
+// wins
+func betterCover(candidate []byte, candidateType string, current []byte, currentType string) bool {
+	if len(candidate) == 0 {
+		return false
+	}
+	candidateValid := ImageType(candidate, candidateType) != ""
+	currentValid := ImageType(current, currentType) != ""
+	switch {
+	case len(current) == 0:
+		return true
+	case candidateValid != currentValid:
+		return candidateValid
+	}
+
+	a, _, errA := image.DecodeConfig(bytes.NewReader(candidate))
+	b, _, errB := image.DecodeConfig(bytes.NewReader(current))
+	if errA == nil && errB == nil && a.Width*a.Height != b.Width*b.Height {
+		return a.Width*a.Height > b.Width*b.Height
+	}
+	return len(candidate) > len(current)
+}
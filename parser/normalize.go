@@ -0,0 +1,144 @@
+package parser
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// titleQuotes are the quotation marks TrimTitleQuotes removes around titles
+const titleQuotes = "\"'«»„“”‘’‚‹›"
+
+// leadingArticles are the articles NormalizeTitle drops from the start of a
+// title (or from its end, in "Hobbit, The"), by language. An article ending
+// in an apostrophe is elided onto the next word, as in "L'Étranger".
+// Russian has no articles.
+var leadingArticles = map[string][]string{
+	"en": {"the", "a", "an"},
+	"de": {"der", "die", "das", "ein", "eine"},
+	"fr": {"le", "la", "les", "l'", "un", "une"},
+	"ru": {},
+}
+
+// TrimTitleQuotes removes the quotation marks around a title, such as
+// «Мастер и Маргарита», „Der Process“ or "The Hobbit", and the spaces
+// around it. Marks are only removed in pairs, so a title that merely starts
+// or ends with one is kept whole.
+func TrimTitleQuotes(title string) string {
+	title = strings.TrimSpace(title)
+	for {
+		first, n := utf8.DecodeRuneInString(title)
+		last, m := utf8.DecodeLastRuneInString(title)
+		if len(title) <= n || !strings.ContainsRune(titleQuotes, first) || !strings.ContainsRune(titleQuotes, last) {
+			return title
+		}
+		title = strings.TrimSpace(title[n : len(title)-m])
+	}
+}
+
+// NormalizeTitle returns a key for grouping the editions of a work by title:
+// quotes are trimmed, case and whitespace folded, and leading articles of the
+// language (a BCP 47 tag such as "en" or "de-AT") dropped, wherever they
+// are, so "The Hobbit", "Hobbit, The" and "THE HOBBIT  " give the same key.
+// With a language that has no article table, such as "", the articles of
+// every language listed are dropped.
+func NormalizeTitle(title, language string) string {
+	key := foldKey(TrimTitleQuotes(title))
+	articles, ok := leadingArticles[baseLanguage(language)]
+	if !ok {
+		articles = allArticles()
+	}
+
+	for _, article := range articles {
+		if strings.HasSuffix(article, "'") {
+			rest := strings.TrimPrefix(key, article)
+			if rest != key && rest != "" {
+				key = rest
+				break
+			}
+			continue
+		}
+		if rest, ok := strings.CutPrefix(key, article+" "); ok && rest != "" {
+			key = rest
+			break
+		}
+		if rest, ok := strings.CutSuffix(key, ", "+article); ok && rest != "" {
+			key = rest
+			break
+		}
+	}
+	return key
+}
+
+// NormalizeAuthorName returns a key for grouping books by author, the same
+// for "J. R. R. Tolkien", "Tolkien, J.R.R." and "J.R.R. TOLKIEN": the name is
+// split as ParseAuthor does, then case, whitespace and the dots of initials
+// are folded. A full given name and its initial give different keys.
+func NormalizeAuthorName(name string) string {
+	return authorKey(ParseAuthor(name, ""))
+}
+
+// GroupingKey returns a key shared by the editions of a work: the normalized
+// title and the normalized names of its authors, in any order. Empty if the
+// metadata has no title.
+func (m Metadata) GroupingKey() string {
+	title := NormalizeTitle(m.Title, m.Language)
+	if title == "" {
+		return ""
+	}
+	authors := make([]string, 0, len(m.Authors))
+	for _, a := range m.Authors {
+		if key := authorKey(a); key != "" {
+			authors = append(authors, key)
+		}
+	}
+	sort.Strings(authors)
+	return title + "\x00" + strings.Join(authors, ";")
+}
+
+// authorKey returns the grouping key of an author, "last|given names" or
+// the last name alone
+func authorKey(a Author) string {
+	if a.LastName == "" || a.LastName == a.DisplayName {
+		// Names too ambiguous to split are kept whole
+		return foldKey(strings.ReplaceAll(a.FullName(), ".", " "))
+	}
+	given := foldKey(strings.ReplaceAll(a.FirstName+" "+a.MiddleName, ".", " "))
+	if given == "" {
+		return foldKey(a.LastName)
+	}
+	return foldKey(a.LastName) + "|" + given
+}
+
+// foldKey folds case and whitespace, and ё to е as Russian texts often do,
+// after composing the text
+func foldKey(s string) string {
+	s = strings.ToLower(norm.NFC.String(s))
+	s = strings.ReplaceAll(s, "ё", "е")
+	s = strings.ReplaceAll(s, "’", "'")
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// allArticles returns the articles of every language, in the order of the
+// language codes so keys don't depend on map order
+func allArticles() []string {
+	languages := make([]string, 0, len(leadingArticles))
+	for lang := range leadingArticles {
+		languages = append(languages, lang)
+	}
+	sort.Strings(languages)
+	var articles []string
+	for _, lang := range languages {
+		articles = append(articles, leadingArticles[lang]...)
+	}
+	return articles
+}
+
+// baseLanguage returns the primary subtag of a language tag, lowercased
+func baseLanguage(tag string) string {
+	base, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+	base, _, _ = strings.Cut(base, "_")
+	return base
+}
@@ -0,0 +1,157 @@
+package parser
+
+import "testing"
+
+func TestTrimTitleQuotes(t *testing.T) {
+	tests := map[string]string{
+		`"The Hobbit"`:         "The Hobbit",
+		"«Мастер и Маргарита»": "Мастер и Маргарита",
+		"„Der Process“":        "Der Process",
+		" « „Nested“ » ":       "Nested",
+		"‘Single’":             "Single",
+		`"Unclosed`:            `"Unclosed`,
+		`Quoted "word"`:        `Quoted "word"`,
+		`"`:                    `"`,
+		"«»":                   "",
+		"  Plain title  ":      "Plain title",
+		"":                     "",
+	}
+	for title, want := range tests {
+		if got := TrimTitleQuotes(title); got != want {
+			t.Errorf("TrimTitleQuotes(%q) = %q, want %q", title, got, want)
+		}
+	}
+}
+
+func TestNormalizeTitle(t *testing.T) {
+	tests := []struct {
+		title, language, want string
+	}{
+		// Case, whitespace and quotes
+		{"The Hobbit", "en", "hobbit"},
+		{"Hobbit, The", "en", "hobbit"},
+		{"THE HOBBIT  ", "en", "hobbit"},
+		{"  the\thobbit\n", "en-GB", "hobbit"},
+		{`"The Hobbit"`, "en", "hobbit"},
+		{"«Мастер и  Маргарита»", "ru", "мастер и маргарита"},
+		{"Ёжик в тумане", "ru", "ежик в тумане"},
+		{"Café Society", "en", "café society"},
+
+		// Articles of each language
+		{"A Tale of Two Cities", "en", "tale of two cities"},
+		{"An Instance of the Fingerpost", "en", "instance of the fingerpost"},
+		{"Der Process", "de", "process"},
+		{"Die Verwandlung", "de-AT", "verwandlung"},
+		{"Das Boot", "de", "boot"},
+		{"Eine kleine Nachtmusik", "de", "kleine nachtmusik"},
+		{"Les Misérables", "fr", "misérables"},
+		{"La Peste", "fr_FR", "peste"},
+		{"L'Étranger", "fr", "étranger"},
+		{"L’Étranger", "fr", "étranger"},
+		{"Le Petit Prince", "FR", "petit prince"},
+
+		// Only one article, and only as a word of its own
+		{"The The", "en", "the"},
+		{"The", "en", "the"},
+		{"Theory of Everything", "en", "theory of everything"},
+		{"Another Country", "en", "another country"},
+		{"L'", "fr", "l'"},
+
+		// Articles of other languages are kept
+		{"Das Boot", "en", "das boot"},
+		{"The Hobbit", "de", "the hobbit"},
+		{"The Hobbit", "ru", "the hobbit"},
+		{"А зори здесь тихие", "ru", "а зори здесь тихие"},
+
+		// Without a known language, every listed article goes
+		{"Das Boot", "", "boot"},
+		{"Les Misérables", "", "misérables"},
+		{"The Hobbit", "xx", "hobbit"},
+		{"Hobbit, The", "", "hobbit"},
+
+		// Nothing but quotes is no title
+		{"", "en", ""},
+		{"« »", "en", ""},
+	}
+	for _, tt := range tests {
+		if got := NormalizeTitle(tt.title, tt.language); got != tt.want {
+			t.Errorf("NormalizeTitle(%q, %q) = %q, want %q", tt.title, tt.language, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeAuthorName(t *testing.T) {
+	// Names in a group give the same key, and names of different groups
+	// different keys
+	groups := [][]string{
+		{"J. R. R. Tolkien", "Tolkien, J.R.R.", "J.R.R. TOLKIEN", "j r r tolkien"},
+		{"John Ronald Reuel Tolkien", "Tolkien, John Ronald Reuel"},
+		{"Christopher Tolkien", "TOLKIEN, Christopher"},
+		{"Лев Николаевич Толстой", "Толстой, Лев Николаевич", "Толстой Лев Николаевич", "лев  николаевич толстой"},
+		{"Фёдор Достоевский", "Федор Достоевский", "Достоевский, Фёдор"},
+		{"Ursula K. Le Guin", "Le Guin, Ursula K.", "Ursula K Le Guin"},
+		{"Homer", "HOMER", " homer "},
+	}
+	keys := make(map[string]int)
+	for i, group := range groups {
+		want := NormalizeAuthorName(group[0])
+		if want == "" {
+			t.Fatalf("NormalizeAuthorName(%q) is empty", group[0])
+		}
+		for _, name := range group[1:] {
+			if got := NormalizeAuthorName(name); got != want {
+				t.Errorf("NormalizeAuthorName(%q) = %q, want %q as for %q", name, got, want, group[0])
+			}
+		}
+		if j, ok := keys[want]; ok {
+			t.Errorf("%q and %q share the key %q", group[0], groups[j][0], want)
+		}
+		keys[want] = i
+	}
+	if got := NormalizeAuthorName("  "); got != "" {
+		t.Errorf("NormalizeAuthorName of a blank name = %q", got)
+	}
+}
+
+func TestGroupingKey(t *testing.T) {
+	tolkien := []Author{ParseAuthor("J. R. R. Tolkien", "")}
+	editions := []Metadata{
+		{Title: "The Hobbit", Language: "en", Authors: tolkien},
+		{Title: "Hobbit, The", Language: "en-US", Authors: []Author{ParseAuthor("Tolkien, J.R.R.", "")}},
+		{Title: "«THE HOBBIT»", Authors: []Author{ParseAuthor("J.R.R. TOLKIEN", "")}},
+	}
+	want := editions[0].GroupingKey()
+	for _, m := range editions[1:] {
+		if got := m.GroupingKey(); got != want {
+			t.Errorf("GroupingKey of %q by %q = %q, want %q", m.Title, m.Authors[0].DisplayName, got, want)
+		}
+	}
+
+	// Authors in any order, with blank ones left out
+	a, b := ParseAuthor("Arkady Strugatsky", ""), ParseAuthor("Boris Strugatsky", "")
+	picnic := Metadata{Title: "Roadside Picnic", Language: "en", Authors: []Author{a, b}}
+	reversed := Metadata{Title: "Roadside Picnic", Language: "en", Authors: []Author{b, {}, a}}
+	if picnic.GroupingKey() != reversed.GroupingKey() {
+		t.Errorf("author order changes the key: %q and %q", picnic.GroupingKey(), reversed.GroupingKey())
+	}
+
+	// Different works, or the same title by someone else
+	others := []Metadata{
+		{Title: "The Hobbit", Language: "en"},
+		{Title: "The Hobbit", Language: "en", Authors: []Author{ParseAuthor("Christopher Tolkien", "")}},
+		{Title: "The Silmarillion", Language: "en", Authors: tolkien},
+		{Title: "Roadside Picnic", Language: "en", Authors: []Author{a}},
+	}
+	seen := map[string]string{want: "The Hobbit", picnic.GroupingKey(): "Roadside Picnic"}
+	for _, m := range others {
+		key := m.GroupingKey()
+		if title, ok := seen[key]; ok {
+			t.Errorf("%q with %d authors shares the key %q of %q", m.Title, len(m.Authors), key, title)
+		}
+		seen[key] = m.Title
+	}
+
+	if got := (Metadata{Title: "  ", Authors: tolkien}).GroupingKey(); got != "" {
+		t.Errorf("GroupingKey without a title = %q", got)
+	}
+}
@@ -1,8 +1,16 @@
 package parser
 
-import "io"
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
 
-// Parser defines the interface for ebook parsers
+// Parser defines the interface for ebook parsers. When parts of a book
+// fail to parse, such as a corrupt chapter file, Parse and ParseReader
+// return the rest of the book together with a *PartialError; a file that
+// can't be opened at all gives a nil book.
 type Parser interface {
 	// Parse extracts book structure from a file path
 	Parse(filePath string) (*Book, error)
@@ -18,24 +26,102 @@ type Parser interface {
 type Book struct {
 	Metadata Metadata
 	Content  Content
+	Notes    map[string]Note // Footnotes and comments keyed by note ID
+	PageList []PageTarget    // Print page map (EPUB page-list), nil if the book has none
+	Warnings []string        // Non-fatal problems found while parsing
+	Issues   []Issue         // Parts that failed to parse, also noted in Warnings
+
+	loggedWarnings int // Warnings already logged by LogWarnings
+}
+
+// PageTarget is where a page of the print edition starts
+type PageTarget struct {
+	Label     string // Page number as printed (e.g., "12", "xiv")
+	ChapterID string
+	// ElementOffset is the index in the chapter's Elements of the element the
+	// page starts in, len(Elements) for a page starting after the last one
+	ElementOffset int
+	Anchor        string // Id of the page break in the source file, if any
+}
+
+// Note represents a footnote or comment referenced from the book text
+type Note struct {
+	ID       string
+	Title    string
+	Elements []Element
 }
 
 // Metadata represents format-agnostic book metadata
 type Metadata struct {
-	Title       string
-	Authors     []Author
-	Language    string
-	Description string
-	Genres      []string
-	Series      string
-	SeriesIndex int
-	CoverData   []byte
-	CoverType   string // MIME type (e.g., "image/jpeg", "image/png")
+	Title           string
+	Authors         []Author
+	Language        string
+	Description     string
+	DescriptionHTML string // Cleaned HTML rendition of the description (p, em and strong only)
+	Genres          []string
+	Series          string // First entry of Sequences, kept for compatibility
+	SeriesIndex     int
+	Sequences       []Sequence
+	CoverData       []byte
+	CoverType       string // MIME type (e.g., "image/jpeg", "image/png")
+	CoverWidth      int    // Cover dimensions in pixels, read from the image header by SetCover; zero if unknown
+	CoverHeight     int
+
+	Publisher       string
+	PublishCity     string
+	PublicationDate string    // As found in the source (e.g., "2005", "2005-03-14")
+	PublicationTime time.Time // PublicationDate read by ParseDate, zero if unknown
+	PublicationYear int
+	ModifiedDate    string    // Last modification of the file, as found in the source
+	ModifiedTime    time.Time // ModifiedDate read by ParseDate, zero if unknown
+	Identifiers     []Identifier
+
+	DocumentInfo *DocumentInfo // Provenance of the electronic document, nil if unknown
+
+	// Raw is the source metadata, kept only when the parser or extractor is
+	// asked to (KeepRawMetadata)
+	Raw *RawMetadata
+}
+
+// RawMetadata holds a book's metadata as found in the file, for fields this
+// library doesn't model (e.g., custom meta namespaces or store-specific
+// tags). The contents are format-specific and may change between versions.
+type RawMetadata struct {
+	Format   string // Format identifier (e.g., "epub", "fb2")
+	Data     []byte // EPUB: the OPF package document; FB2: the inner XML of the description element, in UTF-8
+	RootFile string // EPUB: path of the OPF in the container
+}
+
+// DocumentInfo describes who produced the electronic document and from what source
+type DocumentInfo struct {
+	ID          string // Document identifier, shared by re-uploads of the same file
+	Version     string
+	Date        string   // Machine-readable value when available, otherwise the displayed text
+	Authors     []string // Document authors (nickname, or full name if no nickname)
+	ProgramUsed string
+	SrcURLs     []string
+	SrcOCR      string
+}
+
+// Sequence represents a series the book belongs to
+type Sequence struct {
+	Name      string
+	Number    int
+	Publisher bool // Sequence assigned by the publisher rather than the author
+}
+
+// Identifier represents a book identifier such as an ISBN
+type Identifier struct {
+	Scheme string // Lowercase scheme name (e.g., "isbn", "uuid")
+	Value  string
 }
 
 // Content represents the structured content of a book
 type Content struct {
 	Chapters []Chapter
+	// ChapterIndex maps ids from the source document (e.g., FB2 section ids) to
+	// the index of the chapter containing them, for resolving cross-references
+	ChapterIndex map[string]int
 }
 
 // Chapter represents a book chapter or section
@@ -44,6 +130,90 @@ type Chapter struct {
 	Title    string
 	Level    int       // TOC depth (0 = top level, 1 = subsection, etc.)
 	Elements []Element // Content elements
+	// Role is the semantic role of the chapter: RoleChapter, RoleFootnotes
+	// or, in EPUB, another structural semantics type such as "dedication",
+	// "copyright-page" or "titlepage"
+	Role string
+
+	// Where the chapter comes from in the original file, for debugging and
+	// re-extracting a single chapter
+	SourcePath   string // Container entry (EPUB) or element path such as "body[0]/section[3]" (FB2)
+	SourceAnchor string // Id of the element the chapter starts at, if any
+	SourceStart  int    // Byte range of the chapter within SourcePath (EPUB); both 0 if unknown
+	SourceEnd    int
+}
+
+// Roles of chapters every format uses
+const (
+	RoleChapter   = "chapter"
+	RoleFootnotes = "footnotes"
+)
+
+// ChapterNotFoundError is returned when a chapter ID is not in the book
+type ChapterNotFoundError struct {
+	ID string
+}
+
+func (e *ChapterNotFoundError) Error() string {
+	return fmt.Sprintf("chapter not found: %q", e.ID)
+}
+
+// FindChapter returns the chapter with the given ID
+func (b *Book) FindChapter(id string) (*Chapter, error) {
+	for i := range b.Content.Chapters {
+		if b.Content.Chapters[i].ID == id {
+			return &b.Content.Chapters[i], nil
+		}
+	}
+	return nil, &ChapterNotFoundError{ID: id}
+}
+
+// BodyElements returns the elements of a chapter without the leading
+// headings that only repeat the chapter or book title, ignoring case and
+// whitespace. A heading that adds to the title, such as "Chapter 3 — The
+// Road" for "Chapter 3", is kept.
+func (ch Chapter) BodyElements(bookTitle string) []Element {
+	elements := ch.Elements
+	for len(elements) > 0 {
+		heading, ok := elements[0].(*Heading)
+		if !ok || !(sameTitle(heading.Text, ch.Title) || sameTitle(heading.Text, bookTitle)) {
+			break
+		}
+		elements = elements[1:]
+	}
+	return elements
+}
+
+// DescribeImages returns elements with a description given as alt text to
+// the images that have none, "Illustration N in chapter Title" where N
+// counts the images of elements from 1. Images are copied, not changed.
+func DescribeImages(elements []Element, chapterTitle string) []Element {
+	described := make([]Element, len(elements))
+	n := 0
+	for i, elem := range elements {
+		described[i] = elem
+		img, ok := elem.(*Image)
+		if !ok {
+			continue
+		}
+		n++
+		if strings.TrimSpace(img.Alt) != "" {
+			continue
+		}
+		copied := *img
+		copied.Alt = fmt.Sprintf("Illustration %d", n)
+		if title := strings.Join(strings.Fields(chapterTitle), " "); title != "" {
+			copied.Alt += " in chapter " + title
+		}
+		described[i] = &copied
+	}
+	return described
+}
+
+// sameTitle reports whether two titles are equal ignoring case and whitespace
+func sameTitle(a, b string) bool {
+	a, b = strings.Join(strings.Fields(a), " "), strings.Join(strings.Fields(b), " ")
+	return a != "" && strings.EqualFold(a, b)
 }
 
 // GetTotalCharacters returns the total character count across all chapters
@@ -0,0 +1,96 @@
+package parser
+
+// Positions are character offsets into the whole book, counted the same way
+// as GetTotalCharacters: the CharCount of each element in reading order.
+// They are stable for a parsed book, but may shift between versions of this
+// library as the parsers build elements differently, so store them with the
+// book they were taken from.
+
+// Locate returns the chapter, the element in it and the offset in the element
+// a character offset falls in. Offsets out of range are clamped to the start
+// or end of the book, and elements without text, such as images, are never
+// returned. Returns 0, 0, 0 for a book without text.
+func (b *Book) Locate(charOffset int) (chapterIdx, elementIdx, offsetInElement int) {
+	charOffset = b.ClampOffset(charOffset)
+
+	lastChapter, lastElement, lastCount := 0, 0, 0
+	pos := 0
+	for i, ch := range b.Content.Chapters {
+		for j, elem := range ch.Elements {
+			count := elem.CharCount()
+			if count == 0 {
+				continue
+			}
+			if charOffset < pos+count {
+				return i, j, charOffset - pos
+			}
+			pos += count
+			lastChapter, lastElement, lastCount = i, j, count
+		}
+	}
+
+	// The end of the book is the end of its last element with text
+	return lastChapter, lastElement, lastCount
+}
+
+// Offset returns the character offset of a position in the book, the
+// inverse of Locate. A chapter index out of range is clamped to the first or
+// last chapter, an element index to the start or end of the chapter, and the
+// offset in the element to its text.
+func (b *Book) Offset(chapterIdx, elementIdx, offsetInElement int) int {
+	chapters := b.Content.Chapters
+	if len(chapters) == 0 {
+		return 0
+	}
+	chapterIdx = clamp(chapterIdx, 0, len(chapters)-1)
+	elementIdx = clamp(elementIdx, 0, len(chapters[chapterIdx].Elements))
+
+	pos := 0
+	for _, ch := range chapters[:chapterIdx] {
+		for _, elem := range ch.Elements {
+			pos += elem.CharCount()
+		}
+	}
+	elements := chapters[chapterIdx].Elements
+	for _, elem := range elements[:elementIdx] {
+		pos += elem.CharCount()
+	}
+	if elementIdx < len(elements) {
+		pos += clamp(offsetInElement, 0, elements[elementIdx].CharCount())
+	}
+	return pos
+}
+
+// ClampOffset limits a character offset to the book, from 0 to
+// GetTotalCharacters
+func (b *Book) ClampOffset(charOffset int) int {
+	return clamp(charOffset, 0, b.GetTotalCharacters())
+}
+
+// OffsetPercent returns how far into the book a character offset is, from 0
+// to 100. Returns 0 for a book without text.
+func (b *Book) OffsetPercent(charOffset int) float64 {
+	total := b.GetTotalCharacters()
+	if total == 0 {
+		return 0
+	}
+	return float64(clamp(charOffset, 0, total)) * 100 / float64(total)
+}
+
+// PercentOffset returns the character offset a percentage of the book, from
+// 0 to 100, falls at. Percentages out of range are clamped.
+func (b *Book) PercentOffset(percent float64) int {
+	total := b.GetTotalCharacters()
+	switch {
+	case !(percent > 0): // Also NaN
+		return 0
+	case percent >= 100:
+		return total
+	}
+	return min(int(percent*float64(total)/100), total)
+}
+
+// clamp limits v to the range from lo to hi
+func clamp(v, lo, hi int) int {
+	return max(lo, min(v, hi))
+}
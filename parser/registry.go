@@ -26,7 +26,15 @@ func Register(format string, parser Parser) {
 	globalRegistry.parsers[strings.ToLower(format)] = parser
 }
 
-// GetParser returns a parser for the specified format from the global registry
+// Cloner is implemented by parsers with configuration fields, so GetParser
+// can return copies that callers may configure without affecting each other
+type Cloner interface {
+	Clone() Parser
+}
+
+// GetParser returns a parser for the specified format from the global registry.
+// Parsers implementing Cloner are returned as copies, so changing the fields
+// of one never changes the registered parser.
 func GetParser(format string) (Parser, error) {
 	registryMutex.RLock()
 	defer registryMutex.RUnlock()
@@ -35,6 +43,9 @@ func GetParser(format string) (Parser, error) {
 	if !ok {
 		return nil, fmt.Errorf("no parser registered for format: %s", format)
 	}
+	if cloner, ok := parser.(Cloner); ok {
+		return cloner.Clone(), nil
+	}
 	return parser, nil
 }
 
@@ -47,13 +58,26 @@ func Parse(format, filePath string) (*Book, error) {
 	return parser.Parse(filePath)
 }
 
-// ParseReader is a convenience function to parse from a reader using the global registry
+// ParseReader is a convenience function to parse from a reader using the global registry.
+// A format of FormatAuto or "" is detected from the content.
 func ParseReader(format string, r io.ReaderAt, size int64) (*Book, error) {
+	book, _, err := ParseReaderDetect(format, r, size)
+	return book, err
+}
+
+// ParseReaderDetect is ParseReader that also returns the format used, as
+// detected when format is FormatAuto or ""
+func ParseReaderDetect(format string, r io.ReaderAt, size int64) (*Book, string, error) {
+	format, err := resolveFormat(r, size, format)
+	if err != nil {
+		return nil, "", err
+	}
 	parser, err := GetParser(format)
 	if err != nil {
-		return nil, err
+		return nil, format, err
 	}
-	return parser.ParseReader(r, size)
+	book, err := parser.ParseReader(r, size)
+	return book, format, err
 }
 
 // RegisteredFormats returns a list of all registered format identifiers
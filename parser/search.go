@@ -0,0 +1,223 @@
+package parser
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// DefaultSearchContext is the text on either side of a match in its snippet,
+// in runes, when SearchOptions.ContextRunes is zero
+const DefaultSearchContext = 40
+
+// SearchOptions controls how Book.Search matches text
+type SearchOptions struct {
+	CaseSensitive bool
+	WholeWord     bool // Matches must not start or end inside a word
+	// Normalize matches the composed and decomposed forms of the same text,
+	// such as "й" and "и" followed by a combining breve (NFC)
+	Normalize    bool
+	ContextRunes int // Text on either side of a match in its snippet, in runes
+}
+
+// SearchHit is a match of Book.Search
+type SearchHit struct {
+	ChapterID string
+	Element   int // Index of the element in Chapter.Elements
+	// Paragraph is the index of the paragraph in an Epigraph or Blockquote,
+	// 0 for other elements
+	Paragraph int
+	Start     int    // Rune offset of the match in the text searched
+	End       int    // Rune offset just past the match
+	Snippet   string // The match with the text around it, "…" where it is cut
+}
+
+// Search finds query in the text of headings, paragraphs, epigraph and
+// blockquote paragraphs, preformatted text and image alt text, in reading
+// order. Matches don't overlap and never end before a combining mark, so
+// "и" doesn't match the decomposed "й". Returns nil for an empty query.
+func (b *Book) Search(query string, opts SearchOptions) []SearchHit {
+	s := newSearcher(query, opts)
+	if s == nil {
+		return nil
+	}
+
+	var hits []SearchHit
+	for _, ch := range b.Content.Chapters {
+		for i, elem := range ch.Elements {
+			add := func(paragraph int, text string) {
+				for _, m := range s.find(text) {
+					hits = append(hits, SearchHit{
+						ChapterID: ch.ID,
+						Element:   i,
+						Paragraph: paragraph,
+						Start:     m[0],
+						End:       m[1],
+						Snippet:   snippet(text, m[0], m[1], s.context),
+					})
+				}
+			}
+
+			switch e := elem.(type) {
+			case *Paragraph:
+				add(0, e.Text)
+			case *Heading:
+				add(0, e.Text)
+			case *Preformatted:
+				add(0, e.Text)
+			case *Image:
+				add(0, e.Alt)
+			case *Epigraph:
+				for j, p := range e.Paragraphs {
+					add(j, p.Text)
+				}
+			case *Blockquote:
+				for j, p := range e.Paragraphs {
+					add(j, p.Text)
+				}
+			}
+		}
+	}
+	return hits
+}
+
+// searcher matches a folded query against text folded one element at a
+// time, reusing its buffers
+type searcher struct {
+	opts    SearchOptions
+	context int
+	query   []rune
+
+	// Folded text of the current element, and the rune offset in the element
+	// each folded rune comes from, with the rune count of the element last
+	text   []rune
+	source []int
+	iter   norm.Iter
+}
+
+func newSearcher(query string, opts SearchOptions) *searcher {
+	s := &searcher{opts: opts, context: opts.ContextRunes}
+	if s.context <= 0 {
+		s.context = DefaultSearchContext
+	}
+	s.fold(query)
+	if len(s.text) == 0 {
+		return nil
+	}
+	s.query = append([]rune(nil), s.text...)
+	return s
+}
+
+// fold sets the searcher's text to the folded form of text
+func (s *searcher) fold(text string) {
+	s.text, s.source = s.text[:0], s.source[:0]
+
+	if !s.opts.Normalize {
+		n := 0
+		for _, r := range text {
+			s.text = append(s.text, s.foldRune(r))
+			s.source = append(s.source, n)
+			n++
+		}
+		s.source = append(s.source, n)
+		return
+	}
+
+	// A normalized segment, such as a letter and its combining marks, maps
+	// to the runes of the text it comes from
+	it := &s.iter
+	it.InitString(norm.NFC, text)
+	n, pos := 0, 0
+	for !it.Done() {
+		segment := it.Next()
+		for len(segment) > 0 {
+			r, size := utf8.DecodeRune(segment)
+			s.text = append(s.text, s.foldRune(r))
+			s.source = append(s.source, n)
+			segment = segment[size:]
+		}
+		n += utf8.RuneCountInString(text[pos:it.Pos()])
+		pos = it.Pos()
+	}
+	s.source = append(s.source, n)
+}
+
+// foldRune returns the same rune for all cases of a letter, unless the
+// search is case sensitive
+func (s *searcher) foldRune(r rune) rune {
+	if s.opts.CaseSensitive {
+		return r
+	}
+	folded := r
+	for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+		folded = min(folded, f)
+	}
+	return folded
+}
+
+// find returns the rune offsets of the start and end of the matches in text
+func (s *searcher) find(text string) [][2]int {
+	s.fold(text)
+
+	var matches [][2]int
+	for i := 0; i+len(s.query) <= len(s.text); i++ {
+		end := i + len(s.query)
+		if !s.matchAt(i) || !s.boundary(i) || !s.boundary(end) {
+			continue
+		}
+		matches = append(matches, [2]int{s.source[i], s.source[end]})
+		i = end - 1
+	}
+	return matches
+}
+
+// matchAt reports whether the query matches the text at i
+func (s *searcher) matchAt(i int) bool {
+	for j, r := range s.query {
+		if s.text[i+j] != r {
+			return false
+		}
+	}
+	return true
+}
+
+// boundary reports whether a match can start or end before the folded rune
+// at i: not inside a normalized segment or before a combining mark, and for
+// whole-word searches not inside a word
+func (s *searcher) boundary(i int) bool {
+	if i == 0 || i == len(s.text) {
+		return true
+	}
+	if s.source[i] == s.source[i-1] || unicode.Is(unicode.Mn, s.text[i]) {
+		return false
+	}
+	return !s.opts.WholeWord || !isWordRune(s.text[i-1]) || !isWordRune(s.text[i])
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r) || r == '_'
+}
+
+// snippet returns the runes of text from start to end with up to context
+// runes on either side
+func snippet(text string, start, end, context int) string {
+	from, to := max(0, start-context), end+context
+	var sb strings.Builder
+	if from > 0 {
+		sb.WriteString("…")
+	}
+	n := 0
+	for _, r := range text {
+		if n == to {
+			sb.WriteString("…")
+			break
+		}
+		if n >= from {
+			sb.WriteRune(r)
+		}
+		n++
+	}
+	return sb.String()
+}
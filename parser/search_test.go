@@ -0,0 +1,183 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// searchBook has the text of each element type Search looks into
+func searchBook() *Book {
+	return &Book{Content: Content{Chapters: []Chapter{
+		{ID: "ch1", Elements: []Element{
+			&Heading{Text: "Глава первая. Ёлка", Level: 1},
+			&Paragraph{Text: "В лесу родилась ёлочка, в лесу она росла. ЁЛКА!"},
+			&Epigraph{Paragraphs: []Paragraph{{Text: "Мир — театр."}, {Text: "Весь мировой театр."}}},
+		}},
+		{ID: "ch2", Elements: []Element{
+			&Image{Alt: "Ёлка в снегу"},
+			&Blockquote{Paragraphs: []Paragraph{{Text: "Мой дядя самых честных правил"}}},
+			&Preformatted{Text: "ёлка := true"},
+			&Table{},
+		}},
+	}}}
+}
+
+// describe lists hits as "chapter/element/paragraph start-end snippet"
+func describe(hits []SearchHit) string {
+	var lines []string
+	for _, h := range hits {
+		lines = append(lines, fmt.Sprintf("%s/%d/%d %d-%d %s", h.ChapterID, h.Element, h.Paragraph, h.Start, h.End, h.Snippet))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestSearchCyrillic(t *testing.T) {
+	book := searchBook()
+	tests := []struct {
+		query string
+		opts  SearchOptions
+		want  []string
+	}{
+		{
+			query: "ёлка",
+			want: []string{
+				"ch1/0/0 14-18 Глава первая. Ёлка",
+				"ch1/1/0 42-46 …лесу родилась ёлочка, в лесу она росла. ЁЛКА!",
+				"ch2/0/0 0-4 Ёлка в снегу",
+				"ch2/2/0 0-4 ёлка := true",
+			},
+		},
+		{
+			query: "ёлка",
+			opts:  SearchOptions{CaseSensitive: true},
+			want:  []string{"ch2/2/0 0-4 ёлка := true"},
+		},
+		{
+			query: "ЁЛ",
+			want: []string{
+				"ch1/0/0 14-16 Глава первая. Ёлка",
+				"ch1/1/0 16-18 В лесу родилась ёлочка, в лесу она росла. ЁЛКА!",
+				"ch1/1/0 42-44 …лесу родилась ёлочка, в лесу она росла. ЁЛКА!",
+				"ch2/0/0 0-2 Ёлка в снегу",
+				"ch2/2/0 0-2 ёлка := true",
+			},
+		},
+		{
+			query: "ЁЛ",
+			opts:  SearchOptions{WholeWord: true},
+		},
+		{
+			query: "мир",
+			want: []string{
+				"ch1/2/0 0-3 Мир — театр.",
+				"ch1/2/1 5-8 Весь мировой театр.",
+			},
+		},
+		{
+			query: "мир",
+			opts:  SearchOptions{WholeWord: true},
+			want:  []string{"ch1/2/0 0-3 Мир — театр."},
+		},
+		{
+			query: "в лесу",
+			opts:  SearchOptions{ContextRunes: 3},
+			want: []string{
+				"ch1/1/0 0-6 В лесу ро…",
+				"ch1/1/0 24-30 …а, в лесу он…",
+			},
+		},
+		{
+			query: "дядя",
+			want:  []string{"ch2/1/0 4-8 Мой дядя самых честных правил"},
+		},
+		{query: "ёлочки"},
+	}
+	for _, tt := range tests {
+		got := describe(book.Search(tt.query, tt.opts))
+		if want := strings.Join(tt.want, "\n"); got != want {
+			t.Errorf("Search(%q, %+v):\n%s\nwant:\n%s", tt.query, tt.opts, got, want)
+		}
+	}
+	if hits := book.Search("", SearchOptions{}); hits != nil {
+		t.Errorf("empty query: %d hits", len(hits))
+	}
+}
+
+func TestSearchCombiningCharacters(t *testing.T) {
+	const (
+		composed   = "йод"    // й as one rune
+		decomposed = "йод"   // и and a combining breve
+		accented   = "cafés" // é decomposed, in a word
+	)
+	book := &Book{Content: Content{Chapters: []Chapter{{ID: "ch", Elements: []Element{
+		&Paragraph{Text: "Это " + composed + "."},
+		&Paragraph{Text: "Это " + decomposed + "."},
+		&Paragraph{Text: "Two " + accented + " and one café."},
+	}}}}}
+
+	tests := []struct {
+		query string
+		opts  SearchOptions
+		want  []string
+	}{
+		// Each form finds itself without normalization
+		{query: composed, want: []string{"ch/0/0 4-7 Это йод."}},
+		{query: decomposed, want: []string{"ch/1/0 4-8 Это йод."}},
+
+		// With it, both forms find both, with offsets in the runes of the text
+		{query: composed, opts: SearchOptions{Normalize: true}, want: []string{"ch/0/0 4-7 Это йод.", "ch/1/0 4-8 Это йод."}},
+		{query: decomposed, opts: SearchOptions{Normalize: true}, want: []string{"ch/0/0 4-7 Это йод.", "ch/1/0 4-8 Это йод."}},
+		{query: "ЙОД", opts: SearchOptions{Normalize: true, WholeWord: true}, want: []string{"ch/0/0 4-7 Это йод.", "ch/1/0 4-8 Это йод."}},
+
+		// A base letter never matches without its combining mark
+		{query: "и", opts: SearchOptions{}},
+		{query: "и", opts: SearchOptions{Normalize: true}},
+		{query: "cafe", opts: SearchOptions{}},
+		{query: "cafe", opts: SearchOptions{Normalize: true}},
+
+		// The mark stays inside a match, also at a word boundary
+		{query: "café", opts: SearchOptions{Normalize: true}, want: []string{"ch/2/0 4-9 Two cafés and one café.", "ch/2/0 19-23 Two cafés and one café."}},
+		{query: "CAFÉ", opts: SearchOptions{Normalize: true, WholeWord: true}, want: []string{"ch/2/0 19-23 Two cafés and one café."}},
+		{query: "café", want: []string{"ch/2/0 4-9 Two cafés and one café."}},
+	}
+	for _, tt := range tests {
+		got := describe(book.Search(tt.query, tt.opts))
+		if want := strings.Join(tt.want, "\n"); got != want {
+			t.Errorf("Search(%q, %+v):\n%s\nwant:\n%s", tt.query, tt.opts, got, want)
+		}
+	}
+}
+
+func TestSearchFoldsIncrementally(t *testing.T) {
+	paragraph := strings.Repeat("Съешь же ещё этих мягких французских булок, да выпей чаю. ", 20)
+	book := func(paragraphs int) *Book {
+		var elements []Element
+		for range paragraphs {
+			elements = append(elements, &Paragraph{Text: paragraph})
+		}
+		return &Book{Content: Content{Chapters: []Chapter{{ID: "ch", Elements: elements}}}}
+	}
+	small, large := book(2), book(20)
+
+	// The folded text buffers are reused from element to element, so a search
+	// without hits allocates the same for a book of any length
+	for _, opts := range []SearchOptions{{}, {Normalize: true}, {CaseSensitive: true, WholeWord: true}} {
+		search := func(b *Book) func() {
+			return func() {
+				if hits := b.Search("ЧАЙ", opts); len(hits) != 0 {
+					t.Fatalf("%d hits", len(hits))
+				}
+			}
+		}
+		smallAllocs := testing.AllocsPerRun(5, search(small))
+		largeAllocs := testing.AllocsPerRun(5, search(large))
+		if largeAllocs > smallAllocs {
+			t.Errorf("%+v: search made %.0f allocations in 2 paragraphs, %.0f in 20", opts, smallAllocs, largeAllocs)
+		}
+	}
+
+	if hits := large.Search("ЧАЮ", SearchOptions{Normalize: true}); len(hits) != 20*20 {
+		t.Errorf("%d hits, want %d", len(hits), 20*20)
+	}
+}
@@ -0,0 +1,257 @@
+package parser
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Transliteration is a scheme for writing Cyrillic in Latin letters
+type Transliteration int
+
+const (
+	// TranslitPassport follows the passport rules: ICAO 9303 for Russian
+	// ("Щедрин" → "shchedrin", "Юрий" → "iurii") and the 2010 national
+	// rules for Ukrainian ("Київ" → "kyiv")
+	TranslitPassport Transliteration = iota
+	// TranslitGOST follows GOST 7.79-2000 system B without its apostrophes
+	// ("Щедрин" → "shhedrin", "Юрий" → "yurij")
+	TranslitGOST
+)
+
+// DefaultFileStemLength caps the stems FileStem makes, in bytes
+const DefaultFileStemLength = 100
+
+// SlugOptions controls Slug
+type SlugOptions struct {
+	Transliteration Transliteration
+	// Language of the text: "uk" picks the Ukrainian readings of г, и and
+	// the iotated letters, "de" writes umlauts as ae, oe and ue
+	Language  string
+	Separator string // Replaces each run of other characters, "-" if empty
+	MaxLength int    // Cap in bytes, cut at a separator where possible; 0 for none
+}
+
+// passportLatin transliterates Russian and Belarusian by ICAO 9303
+var passportLatin = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e",
+	'ж': "zh", 'з': "z", 'и': "i", 'й': "i", 'к': "k", 'л': "l", 'м': "m",
+	'н': "n", 'о': "o", 'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u",
+	'ф': "f", 'х': "kh", 'ц': "ts", 'ч': "ch", 'ш': "sh", 'щ': "shch",
+	'ъ': "ie", 'ы': "y", 'ь': "", 'э': "e", 'ю': "iu", 'я': "ia",
+	'є': "ie", 'і': "i", 'ї': "i", 'ґ': "g", 'ў': "u",
+}
+
+// ukrainianPassportLatin holds the Ukrainian passport readings that differ,
+// and ukrainianInitialLatin those at the start of a word
+var (
+	ukrainianPassportLatin = map[rune]string{'г': "h", 'и': "y"}
+	ukrainianInitialLatin  = map[rune]string{'є': "ye", 'ї': "yi", 'й': "y", 'ю': "yu", 'я': "ya"}
+)
+
+// gostLatin transliterates by GOST 7.79-2000 system B, with its apostrophes
+// left out
+var gostLatin = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "yo",
+	'ж': "zh", 'з': "z", 'и': "i", 'й': "j", 'к': "k", 'л': "l", 'м': "m",
+	'н': "n", 'о': "o", 'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u",
+	'ф': "f", 'х': "x", 'ц': "cz", 'ч': "ch", 'ш': "sh", 'щ': "shh",
+	'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu", 'я': "ya",
+	'є': "ye", 'і': "i", 'ї': "yi", 'ґ': "g", 'ў': "u",
+}
+
+// latinLetters spells Latin letters that don't decompose into a base letter
+// and marks
+var latinLetters = map[rune]string{
+	'ß': "ss", 'æ': "ae", 'œ': "oe", 'ø': "o", 'đ': "d", 'ð': "d", 'þ': "th",
+	'ł': "l", 'ı': "i",
+}
+
+// germanLatin spells umlauts as German does
+var germanLatin = map[rune]string{'ä': "ae", 'ö': "oe", 'ü': "ue"}
+
+// wordApostrophes are left out of slugs without breaking the word, as in
+// "O'Brien" or "м'ята"
+const wordApostrophes = "'’ʼ`"
+
+// Slug returns a lowercase ASCII form of s for file names and URLs:
+// Cyrillic is transliterated, other letters lose their accents after NFKD
+// decomposition, and each run of other characters becomes the separator.
+// Slugs that Windows reserves as device names, such as "con" or "lpt1", get
+// a "_" after the name (e.g., "con_"). Returns "" if s has no letters or
+// digits it can keep.
+func Slug(s string, opts SlugOptions) string {
+	return unreserved(slug(s, opts), opts.MaxLength)
+}
+
+// slug makes the slug of s, which may be a reserved name
+func slug(s string, opts SlugOptions) string {
+	separator := opts.separator()
+	lang := baseLanguage(opts.Language)
+
+	var slug strings.Builder
+	pending := false // A separator is due before the next letter
+	write := func(part string) {
+		if part == "" {
+			return
+		}
+		if pending && slug.Len() > 0 {
+			slug.WriteString(separator)
+		}
+		pending = false
+		slug.WriteString(part)
+	}
+
+	runes := []rune(strings.ToLower(norm.NFC.String(s)))
+	for i, r := range runes {
+		initial := i == 0 || !unicode.IsLetter(runes[i-1]) && !strings.ContainsRune(wordApostrophes, runes[i-1])
+		var next rune
+		if i+1 < len(runes) {
+			next = runes[i+1]
+		}
+		switch {
+		case unicode.Is(unicode.Cyrillic, r):
+			write(cyrillicToLatin(r, next, initial, lang, opts.Transliteration))
+		case strings.ContainsRune(wordApostrophes, r):
+		case lang == "de" && germanLatin[r] != "":
+			write(germanLatin[r])
+		case latinLetters[r] != "":
+			write(latinLetters[r])
+		case r < utf8.RuneSelf && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			write(string(r))
+		case unicode.IsLetter(r) || unicode.IsNumber(r) || unicode.IsMark(r):
+			// Accented letters and compatibility forms (e.g., "ﬁ", "²") by
+			// their ASCII parts
+			kept := false
+			for _, d := range norm.NFKD.String(string(r)) {
+				if d < utf8.RuneSelf && (unicode.IsLetter(d) || unicode.IsDigit(d)) {
+					write(string(unicode.ToLower(d)))
+					kept = true
+				}
+			}
+			if !kept && !unicode.IsMark(r) {
+				pending = true
+			}
+		default:
+			pending = true
+		}
+	}
+
+	return capSlug(slug.String(), separator, opts.MaxLength)
+}
+
+// cyrillicToLatin transliterates a lowercase Cyrillic letter, given the
+// letter after it and whether it starts a word
+func cyrillicToLatin(r, next rune, initial bool, lang string, scheme Transliteration) string {
+	if scheme == TranslitGOST {
+		if r == 'ц' && strings.ContainsRune("иеыйіє", next) {
+			return "c"
+		}
+		if lang == "uk" && r == 'и' {
+			return "y"
+		}
+		return gostLatin[r]
+	}
+	if lang == "uk" {
+		if latin, ok := ukrainianInitialLatin[r]; ok && initial {
+			return latin
+		}
+		if latin, ok := ukrainianPassportLatin[r]; ok {
+			return latin
+		}
+	}
+	return passportLatin[r]
+}
+
+// capSlug cuts a slug to at most maxLength bytes, at the last separator if
+// that keeps at least half of it, unless the cut already falls at one
+func capSlug(slug, separator string, maxLength int) string {
+	if maxLength <= 0 || len(slug) <= maxLength {
+		return slug
+	}
+	if strings.HasPrefix(slug[maxLength:], separator) {
+		return slug[:maxLength]
+	}
+	slug = slug[:maxLength]
+	if i := strings.LastIndex(slug, separator); i >= maxLength/2 {
+		slug = slug[:i]
+	}
+	return strings.TrimSuffix(slug, separator)
+}
+
+// unreserved returns a slug Windows accepts as a file name: one whose part
+// before any dot is a reserved device name gets a "_" after that part, within
+// maxLength bytes if it is positive
+func unreserved(slug string, maxLength int) string {
+	name, _, _ := strings.Cut(slug, ".")
+	if !reservedName(name) {
+		return slug
+	}
+	slug = name + "_" + slug[len(name):]
+	if maxLength > 0 && len(slug) > maxLength {
+		if maxLength <= len(name) {
+			return name[:maxLength-1] + "_"
+		}
+		slug = strings.TrimSuffix(slug[:maxLength], ".")
+	}
+	return slug
+}
+
+// reservedName reports whether a name is a device name Windows reserves,
+// whatever its case and extension
+func reservedName(name string) bool {
+	switch strings.ToLower(name) {
+	case "con", "prn", "aux", "nul":
+		return true
+	}
+	return len(name) == 4 && (strings.EqualFold(name[:3], "com") || strings.EqualFold(name[:3], "lpt")) &&
+		name[3] >= '0' && name[3] <= '9'
+}
+
+// FileStem returns a file name stem for the book, without an extension:
+// the slugs of the first author's last name and of the title joined by "_"
+// (e.g., "tolstoi_voina-i-mir"), in the book's language unless the options
+// give one, and capped at opts.MaxLength or DefaultFileStemLength bytes.
+// Returns "book" if the metadata gives neither.
+func (m Metadata) FileStem(opts SlugOptions) string {
+	if opts.Language == "" {
+		opts.Language = m.Language
+	}
+	maxLength := opts.MaxLength
+	if maxLength <= 0 {
+		maxLength = DefaultFileStemLength
+	}
+	opts.MaxLength = 0
+
+	var author string
+	if len(m.Authors) > 0 {
+		a := m.Authors[0]
+		author = a.LastName
+		if author == "" {
+			author = a.FullName()
+		}
+	}
+	// Joined, neither part can make a reserved name
+	author, title := slug(author, opts), slug(m.Title, opts)
+
+	switch {
+	case author == "" && title == "":
+		return "book"
+	case author == "":
+		return unreserved(capSlug(title, opts.separator(), maxLength), maxLength)
+	case title == "":
+		return unreserved(capSlug(author, opts.separator(), maxLength), maxLength)
+	}
+	// The author keeps at most half of the length, unless the title is shorter
+	author = capSlug(author, opts.separator(), max(maxLength/2, maxLength-len(title)-1))
+	return author + "_" + capSlug(title, opts.separator(), maxLength-len(author)-1)
+}
+
+func (o SlugOptions) separator() string {
+	if o.Separator == "" {
+		return "-"
+	}
+	return o.Separator
+}
@@ -0,0 +1,178 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSlug(t *testing.T) {
+	gost := SlugOptions{Transliteration: TranslitGOST}
+	tests := []struct {
+		s    string
+		opts SlugOptions
+		want string
+	}{
+		// Russian
+		{"Лев Толстой", SlugOptions{}, "lev-tolstoi"},
+		{"Война и мир", SlugOptions{}, "voina-i-mir"},
+		{"Щедрин", SlugOptions{}, "shchedrin"},
+		{"Юрий Гагарин", SlugOptions{}, "iurii-gagarin"},
+		{"Ёлка", SlugOptions{}, "elka"},
+		{"Подъезд", SlugOptions{}, "podieezd"},
+		{"Хрущёв", SlugOptions{}, "khrushchev"},
+		{"Щедрин", gost, "shhedrin"},
+		{"Юрий", gost, "yurij"},
+		{"Ёлка", gost, "yolka"},
+		{"Цирк", gost, "cirk"},
+		{"Царь", gost, "czar"},
+		{"Подъезд", gost, "podezd"},
+
+		// Ukrainian
+		{"Київ", SlugOptions{Language: "uk"}, "kyiv"},
+		{"Їжак", SlugOptions{Language: "uk"}, "yizhak"},
+		{"Євген", SlugOptions{Language: "uk"}, "yevhen"},
+		{"Україна", SlugOptions{Language: "uk"}, "ukraina"},
+		{"Гоголь", SlugOptions{Language: "uk-UA"}, "hohol"},
+		{"Юрій Яковенко", SlugOptions{Language: "uk"}, "yurii-yakovenko"},
+		{"м'ята", SlugOptions{Language: "uk"}, "miata"},
+		{"Ґанок", SlugOptions{Language: "uk"}, "ganok"},
+		{"Київ", SlugOptions{Transliteration: TranslitGOST, Language: "uk"}, "kyyiv"},
+		{"Київ", SlugOptions{}, "kiiv"},
+
+		// German and other Latin scripts
+		{"Müller Größe", SlugOptions{Language: "de"}, "mueller-groesse"},
+		{"Ärger", SlugOptions{Language: "de"}, "aerger"},
+		{"Müller Größe", SlugOptions{}, "muller-grosse"},
+		{"Café Ørsted", SlugOptions{}, "cafe-orsted"},
+		{"Café", SlugOptions{}, "cafe"},
+		{"ﬁnal x²", SlugOptions{}, "final-x2"},
+		{"Łódź", SlugOptions{}, "lodz"},
+		{"O'Brien’s", SlugOptions{}, "obriens"},
+
+		// Separators
+		{"  Hello,   World!! ", SlugOptions{}, "hello-world"},
+		{"War & Peace", SlugOptions{Separator: "_"}, "war_peace"},
+		{"Book 2: Vol. 3", SlugOptions{}, "book-2-vol-3"},
+		{"中文 Title", SlugOptions{}, "title"},
+
+		// Nothing to keep
+		{"", SlugOptions{}, ""},
+		{"!!! ---", SlugOptions{}, ""},
+		{"中文書名", SlugOptions{}, ""},
+	}
+	for _, tt := range tests {
+		if got := Slug(tt.s, tt.opts); got != tt.want {
+			t.Errorf("Slug(%q, %+v) = %q, want %q", tt.s, tt.opts, got, tt.want)
+		}
+	}
+}
+
+func TestSlugMaxLength(t *testing.T) {
+	tests := []struct {
+		s         string
+		maxLength int
+		separator string
+		want      string
+	}{
+		{"Война и мир", 0, "", "voina-i-mir"},
+		{"Война и мир", 11, "", "voina-i-mir"},
+		// Cut at the last separator in the second half
+		{"Война и мир", 10, "", "voina-i"},
+		{"Война и мир", 6, "", "voina"},
+		// Or right at a word's end
+		{"Война и мир", 7, "", "voina-i"},
+		// Or in the middle of a word, without a separator left at the end
+		{"Достоевский и другие", 8, "", "dostoevs"},
+		{"Война и мир", 8, "__", "voina__i"},
+		{"ab cd", 3, "", "ab"},
+	}
+	for _, tt := range tests {
+		got := Slug(tt.s, SlugOptions{MaxLength: tt.maxLength, Separator: tt.separator})
+		if got != tt.want {
+			t.Errorf("Slug(%q) capped at %d = %q, want %q", tt.s, tt.maxLength, got, tt.want)
+		}
+		if tt.maxLength > 0 && len(got) > tt.maxLength {
+			t.Errorf("Slug(%q) = %q, longer than %d", tt.s, got, tt.maxLength)
+		}
+	}
+}
+
+func TestSlugReservedNames(t *testing.T) {
+	tests := []struct {
+		s    string
+		opts SlugOptions
+		want string
+	}{
+		{"Con", SlugOptions{}, "con_"},
+		{"NUL", SlugOptions{}, "nul_"},
+		{"«Aux»", SlugOptions{}, "aux_"},
+		{"PRN!", SlugOptions{}, "prn_"},
+		{"COM1", SlugOptions{}, "com1_"},
+		{"lpt9", SlugOptions{}, "lpt9_"},
+		{"Кон", SlugOptions{}, "kon"},
+		{"Нуль", SlugOptions{}, "nul_"},
+
+		// Only the name itself
+		{"Console", SlugOptions{}, "console"},
+		{"COM10", SlugOptions{}, "com10"},
+		{"Con Air", SlugOptions{}, "con-air"},
+		{"Comx", SlugOptions{}, "comx"},
+
+		// Reserved whatever the extension a dot starts
+		{"Con Air", SlugOptions{Separator: "."}, "con_.air"},
+		{"Con Airline", SlugOptions{Separator: ".", MaxLength: 8}, "con_.air"},
+		{"Con Air", SlugOptions{Separator: ".", MaxLength: 5}, "con_"},
+		// A cap that makes the name
+		{"Con Air", SlugOptions{MaxLength: 3}, "co_"},
+		{"Nullify", SlugOptions{MaxLength: 3}, "nu_"},
+	}
+	for _, tt := range tests {
+		got := Slug(tt.s, tt.opts)
+		if got != tt.want {
+			t.Errorf("Slug(%q, %+v) = %q, want %q", tt.s, tt.opts, got, tt.want)
+		}
+		if tt.opts.MaxLength > 0 && len(got) > tt.opts.MaxLength {
+			t.Errorf("Slug(%q) = %q, longer than %d", tt.s, got, tt.opts.MaxLength)
+		}
+	}
+}
+
+func TestFileStem(t *testing.T) {
+	tolstoy := []Author{{FirstName: "Лев", LastName: "Толстой"}}
+	long := strings.Repeat("Очень длинное название ", 10)
+	tests := []struct {
+		name string
+		m    Metadata
+		opts SlugOptions
+		want string
+	}{
+		{"author and title", Metadata{Title: "Война и мир", Authors: tolstoy, Language: "ru"}, SlugOptions{}, "tolstoi_voina-i-mir"},
+		{"gost", Metadata{Title: "Война и мир", Authors: tolstoy}, SlugOptions{Transliteration: TranslitGOST}, "tolstoj_vojna-i-mir"},
+		{"book language", Metadata{Title: "Київ", Authors: []Author{{LastName: "Шевченко"}}, Language: "uk"}, SlugOptions{}, "shevchenko_kyiv"},
+		{"option language wins", Metadata{Title: "Київ", Language: "uk"}, SlugOptions{Language: "ru"}, "kiiv"},
+		{"umlauts", Metadata{Title: "Über Größe", Authors: []Author{{LastName: "Müller"}}, Language: "de-DE"}, SlugOptions{}, "mueller_ueber-groesse"},
+		{"author without last name", Metadata{Title: "Odyssey", Authors: []Author{{DisplayName: "Homer"}}}, SlugOptions{}, "homer_odyssey"},
+		{"title only", Metadata{Title: "Война и мир"}, SlugOptions{}, "voina-i-mir"},
+		{"author only", Metadata{Authors: tolstoy}, SlugOptions{}, "tolstoi"},
+		{"nothing", Metadata{Title: "中文"}, SlugOptions{}, "book"},
+		{"reserved title", Metadata{Title: "Con"}, SlugOptions{}, "con_"},
+		{"reserved author", Metadata{Authors: []Author{{LastName: "Aux"}}}, SlugOptions{}, "aux_"},
+		{"reserved author with title", Metadata{Title: "Air", Authors: []Author{{LastName: "Con"}}}, SlugOptions{}, "con_air"},
+		{"reserved after the cap", Metadata{Title: "Nullify"}, SlugOptions{MaxLength: 3}, "nu_"},
+		{"capped", Metadata{Title: "Война и мир", Authors: tolstoy}, SlugOptions{MaxLength: 15}, "tolstoi_voina-i"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.m.FileStem(tt.opts); got != tt.want {
+				t.Errorf("FileStem = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// The default cap, with the author kept to half of it
+	stem := Metadata{Title: long, Authors: []Author{{LastName: long}}}.FileStem(SlugOptions{})
+	author, title, _ := strings.Cut(stem, "_")
+	if len(stem) > DefaultFileStemLength || len(author) > DefaultFileStemLength/2 || len(title) < DefaultFileStemLength/3 {
+		t.Errorf("FileStem of a long author and title = %q (%d bytes)", stem, len(stem))
+	}
+}
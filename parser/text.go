@@ -0,0 +1,30 @@
+package parser
+
+import "regexp"
+
+var (
+	// reSoftHyphen matches a soft hyphen (U+00AD) and the line break it may
+	// precede, which it marks as a hyphenation point
+	reSoftHyphen = regexp.MustCompile(`\x{00AD}(?:[ \t]*\r?\n[ \t]*)?`)
+
+	// reLineEndHyphen matches a word broken by a hyphen at the end of a line,
+	// with lowercase letters on both sides. Blank lines and the page numbers
+	// of a scan may come between the parts.
+	reLineEndHyphen = regexp.MustCompile(`(\p{Ll})[-\x{2010}][ \t]*\r?\n(?:[ \t]*(?:\d{1,4}[ \t]*)?\r?\n)*[ \t]*(\p{Ll})`)
+)
+
+// RemoveSoftHyphens strips soft hyphens, joining the word parts when a soft
+// hyphen is followed by a line break
+func RemoveSoftHyphens(s string) string {
+	return reSoftHyphen.ReplaceAllString(s, "")
+}
+
+// Dehyphenate rejoins words hyphenated across line breaks ("beauti-\nful") and
+// strips soft hyphens. Only breaks between two lowercase letters are joined, so
+// hyphenated compounds within a line and proper names are left intact. A line
+// holding only a page number between the parts, as OCR leaves at page ends, is
+// dropped with the break.
+func Dehyphenate(s string) string {
+	s = RemoveSoftHyphens(s)
+	return reLineEndHyphen.ReplaceAllString(s, "$1$2")
+}
@@ -0,0 +1,33 @@
+package parser
+
+import "testing"
+
+func TestDehyphenate(t *testing.T) {
+	tests := []struct {
+		name, text, want string
+	}{
+		{"line end", "It was a beauti-\nful day.", "It was a beautiful day."},
+		{"spaces and CRLF", "a beauti- \r\n  ful day", "a beautiful day"},
+		{"unicode hyphen", "the wea‐\nther", "the weather"},
+		{"cyrillic", "пре-\nкрасный день", "прекрасный день"},
+		{"soft hyphen", "beau\u00adti\u00adful", "beautiful"},
+		{"soft hyphen at line end", "beauti\u00ad\nful", "beautiful"},
+
+		// OCR page ends
+		{"page number", "It was a beauti-\n17\nful day.", "It was a beautiful day."},
+		{"page number in blank lines", "It was a beauti-\n\n 17 \n\nful day.", "It was a beautiful day."},
+
+		// Left alone
+		{"compound", "a well-known fact", "a well-known fact"},
+		{"proper name", "Jean-\nPaul", "Jean-\nPaul"},
+		{"capital after", "the end-\nThe start", "the end-\nThe start"},
+		{"number after", "pages 10-\n12 and", "pages 10-\n12 and"},
+		{"dash list", "items:\n- one\n- two", "items:\n- one\n- two"},
+		{"longer number", "the year-\n20245\nlater", "the year-\n20245\nlater"},
+	}
+	for _, tt := range tests {
+		if got := Dehyphenate(tt.text); got != tt.want {
+			t.Errorf("%s: Dehyphenate(%q) = %q, want %q", tt.name, tt.text, got, tt.want)
+		}
+	}
+}
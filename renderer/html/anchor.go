@@ -0,0 +1,174 @@
+package html
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+
+	"github.com/vpoluyaktov/biblio-ebook-parser/parser"
+)
+
+// maxSlugLength caps generated heading ids, in bytes
+const maxSlugLength = 64
+
+// cyrillicLatin transliterates Cyrillic letters for heading ids, after
+// Russian, Ukrainian and Belarusian passport rules
+var cyrillicLatin = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e",
+	'ж': "zh", 'з': "z", 'и': "i", 'й': "i", 'к': "k", 'л': "l", 'м': "m",
+	'н': "n", 'о': "o", 'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u",
+	'ф': "f", 'х': "kh", 'ц': "ts", 'ч': "ch", 'ш': "sh", 'щ': "shch",
+	'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "iu", 'я': "ia",
+	'є': "ie", 'і': "i", 'ї': "i", 'ґ': "g", 'ў': "u",
+}
+
+// headingAnchors holds the ids given to a chapter's headings and the
+// sections its mini table of contents lists
+type headingAnchors struct {
+	ids      map[int]string // Index of a heading element to its id
+	sections []section
+}
+
+// section is a heading linked from a table of contents
+type section struct {
+	ID    string
+	Title string
+	Level int // Rendered heading level, 2 or 3
+}
+
+// headingAnchors gives each heading of a chapter an id when HeadingAnchors
+// or ChapterMiniTOC is on: a slug of its text with prefix, made unique
+// against taken. The h2 and h3 headings after the leading one are the
+// chapter's sections, if there are at least two.
+func (r *Renderer) headingAnchors(elements []parser.Element, prefix string, taken map[string]bool) headingAnchors {
+	if !r.Config.HeadingAnchors && !r.Config.ChapterMiniTOC {
+		return headingAnchors{}
+	}
+
+	anchors := headingAnchors{ids: make(map[int]string)}
+	n := 0
+	for i, elem := range elements {
+		heading, ok := elem.(*parser.Heading)
+		if !ok {
+			continue
+		}
+		n++
+		slug := slugify(heading.Text)
+		if slug == "" {
+			slug = fmt.Sprintf("h-%d", n)
+		}
+		id := prefix + slug
+		for k := 2; taken[id]; k++ {
+			id = fmt.Sprintf("%s%s-%d", prefix, slug, k)
+		}
+		taken[id] = true
+		anchors.ids[i] = id
+
+		if level := headingLevel(heading); i > 0 && (level == 2 || level == 3) {
+			anchors.sections = append(anchors.sections, section{ID: id, Title: heading.Text, Level: level})
+		}
+	}
+	if len(anchors.sections) < 2 {
+		anchors.sections = nil
+	}
+	return anchors
+}
+
+// window returns the anchors of n elements from start, renumbered from 0.
+// The sections are kept for the window at the start of the chapter only.
+func (a headingAnchors) window(start, n int) headingAnchors {
+	if a.ids == nil {
+		return a
+	}
+	window := headingAnchors{ids: make(map[int]string)}
+	for i, id := range a.ids {
+		if i >= start && i < start+n {
+			window.ids[i-start] = id
+		}
+	}
+	if start == 0 {
+		window.sections = a.sections
+	}
+	return window
+}
+
+// slugify returns a lowercase ASCII id for heading text: Cyrillic is
+// transliterated, accents are dropped and other characters become hyphens.
+// Returns "" for text with no letters or digits it can keep.
+func slugify(text string) string {
+	var slug strings.Builder
+	hyphen := false
+	write := func(s string) {
+		if hyphen && slug.Len() > 0 {
+			slug.WriteByte('-')
+		}
+		hyphen = false
+		slug.WriteString(s)
+	}
+
+	for _, r := range norm.NFD.String(text) {
+		lower := unicode.ToLower(r)
+		switch {
+		case unicode.Is(unicode.Mn, r):
+			// Accents, and the breve of a decomposed й
+		case lower < unicode.MaxASCII && (unicode.IsLetter(lower) || unicode.IsDigit(lower)):
+			write(string(lower))
+		case cyrillicLatin[lower] != "":
+			write(cyrillicLatin[lower])
+		case unicode.Is(unicode.Cyrillic, lower):
+			// Hard and soft signs
+		default:
+			hyphen = true
+		}
+		if slug.Len() >= maxSlugLength {
+			break
+		}
+	}
+	return strings.TrimRight(slug.String()[:min(slug.Len(), maxSlugLength)], "-")
+}
+
+// writeSections writes a nested list of links to sections in page ("" for
+// the current one), an h3 going under the h2 before it
+func writeSections(html *strings.Builder, sections []section, page string) {
+	html.WriteString("<ol>\n")
+	depth, seenH2 := 0, false
+	for i, s := range sections {
+		d := 0
+		if s.Level == 3 && seenH2 {
+			d = 1
+		}
+		seenH2 = seenH2 || s.Level == 2
+
+		if i > 0 {
+			if d > depth {
+				html.WriteString("\n<ol>\n")
+			} else {
+				html.WriteString("</li>\n")
+				if depth > d {
+					html.WriteString("</ol>\n</li>\n")
+				}
+			}
+		}
+		depth = d
+		fmt.Fprintf(html, "<li><a href=\"%s#%s\">%s</a>", htmlEscape(page), htmlEscape(s.ID), htmlEscape(s.Title))
+	}
+	html.WriteString("</li>\n")
+	if depth > 0 {
+		html.WriteString("</ol>\n</li>\n")
+	}
+	html.WriteString("</ol>\n")
+}
+
+// writeMiniTOC writes the navigation block listing a chapter's sections
+func writeMiniTOC(html *strings.Builder, sections []section) {
+	html.WriteString("<nav class=\"chapter-toc\">\n")
+	writeSections(html, sections, "")
+	html.WriteString("</nav>\n")
+}
+
+// headingLevel returns the level a heading is rendered at
+func headingLevel(h *parser.Heading) int {
+	return min(max(h.Level, 1), 6)
+}
@@ -0,0 +1,229 @@
+package html
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/vpoluyaktov/biblio-ebook-parser/parser"
+)
+
+// DefaultCSS is embedded in documents when Config.InlineCSS is empty
+const DefaultCSS = `body { max-width: 40em; margin: 0 auto; padding: 1em; font-family: Georgia, serif; line-height: 1.5; }
+h1, h2, h3, h4, h5, h6 { line-height: 1.2; }
+nav.toc ol { list-style: none; padding-left: 1.5em; }
+img.cover { display: block; max-width: 100%; margin: 0 auto 2em; }
+blockquote.epigraph { margin-left: 40%; font-style: italic; }
+blockquote.epigraph .text-author { text-align: right; }
+aside.footnote { font-size: 0.9em; border-top: 1px solid #ccc; }
+section.chapter { margin-bottom: 3em; }
+nav.pager { display: flex; justify-content: space-between; margin: 1em 0; }`
+
+var reInvalidIDChars = regexp.MustCompile(`[^\pL\pN_.:-]+`)
+
+// RenderDocument renders the whole book as a single standalone HTML5 document
+func (r *Renderer) RenderDocument(book *parser.Book) (string, error) {
+	var doc strings.Builder
+	if err := r.RenderTo(&doc, book); err != nil {
+		return "", err
+	}
+	return doc.String(), nil
+}
+
+// RenderTo writes the same document as RenderDocument to w one chapter at a
+// time, so the whole document never has to be held in memory
+func (r *Renderer) RenderTo(w io.Writer, book *parser.Book) error {
+	var doc strings.Builder
+
+	// flush writes out what has been rendered so far
+	flush := func() error {
+		_, err := io.WriteString(w, doc.String())
+		doc.Reset()
+		if err != nil {
+			return fmt.Errorf("failed to write HTML: %w", err)
+		}
+		return nil
+	}
+
+	r.writeHead(&doc, book, book.Metadata.Title)
+
+	if r.Config.IncludeCover && len(book.Metadata.CoverData) > 0 {
+		coverType := book.Metadata.CoverType
+		if coverType == "" {
+			coverType = "image/jpeg"
+		}
+		fmt.Fprintf(&doc, "<img class=\"cover\" src=\"data:%s;base64,%s\" alt=\"%s\">\n",
+			htmlEscape(coverType), base64.StdEncoding.EncodeToString(book.Metadata.CoverData), htmlEscape(book.Metadata.Title))
+	}
+
+	writeTitle(&doc, book)
+
+	chapters := book.Content.Chapters
+	ids := chapterAnchors(chapters)
+	targets := linkTargets(book)
+
+	// Heading ids are prefixed with the chapter anchor and checked against
+	// all ids of the document, so the table of contents can link to them
+	taken := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		taken[id] = true
+	}
+	anchors := make([]headingAnchors, len(chapters))
+	for i, ch := range chapters {
+		anchors[i] = r.headingAnchors(r.chapterElements(book, ch), ids[i]+"-", taken)
+	}
+
+	if r.Config.IncludeTOC && len(chapters) > 0 {
+		hrefs := make([]string, len(ids))
+		for i, id := range ids {
+			hrefs[i] = "#" + id
+		}
+		doc.WriteString(tableOfContents(chapters, hrefs, anchors, nil))
+	}
+
+	if err := flush(); err != nil {
+		return err
+	}
+
+	for i, ch := range chapters {
+		fmt.Fprintf(&doc, "<section class=\"chapter\" id=\"%s\">\n", htmlEscape(ids[i]))
+		elements := r.chapterElements(book, ch)
+		if !startsWithHeading(elements) && ch.Title != "" {
+			level := ch.Level + 2
+			if level > 6 {
+				level = 6
+			}
+			fmt.Fprintf(&doc, "<h%d>%s</h%d>\n", level, htmlEscape(ch.Title), level)
+		}
+		doc.WriteString(r.elementsToHTML(elements, targets, r.pageBreaks(book, ch, elements), anchors[i]))
+		doc.WriteString("</section>\n")
+
+		if err := flush(); err != nil {
+			return err
+		}
+	}
+
+	doc.WriteString("</body>\n</html>\n")
+	return flush()
+}
+
+// chapterAnchors returns a unique anchor for each chapter, derived from its ID
+func chapterAnchors(chapters []parser.Chapter) []string {
+	ids := make([]string, len(chapters))
+	seen := make(map[string]bool, len(chapters))
+
+	for i, ch := range chapters {
+		id := strings.Trim(reInvalidIDChars.ReplaceAllString(ch.ID, "-"), "-")
+		if id == "" || seen[id] {
+			id = fmt.Sprintf("chapter-%d", i+1)
+		}
+		for seen[id] {
+			id += "-" + fmt.Sprint(i+1)
+		}
+		seen[id] = true
+		ids[i] = id
+	}
+
+	return ids
+}
+
+// tableOfContents builds a navigation list linking to the chapters at hrefs, nesting entries by chapter level.
+// The sections of each chapter are listed under it, their anchors in the pages given (the document itself if nil).
+func tableOfContents(chapters []parser.Chapter, hrefs []string, anchors []headingAnchors, pages []string) string {
+	var toc strings.Builder
+
+	toc.WriteString("<nav class=\"toc\">\n<h2>Contents</h2>\n<ol>\n")
+
+	depth := 0
+	for i, ch := range chapters {
+		// A level can only go one deeper than the previous entry
+		level := ch.Level
+		if level < 0 {
+			level = 0
+		}
+		if level > depth+1 {
+			level = depth + 1
+		}
+
+		if i > 0 {
+			if level > depth {
+				toc.WriteString("\n<ol>\n")
+			} else {
+				toc.WriteString("</li>\n")
+				for ; depth > level; depth-- {
+					toc.WriteString("</ol>\n</li>\n")
+				}
+			}
+		} else {
+			level = 0
+		}
+		depth = level
+
+		fmt.Fprintf(&toc, "<li><a href=\"%s\">%s</a>", htmlEscape(hrefs[i]), htmlEscape(chapterTitle(ch, i)))
+		if sections := anchors[i].sections; len(sections) > 0 {
+			page := ""
+			if pages != nil {
+				page = pages[i]
+			}
+			toc.WriteString("\n")
+			writeSections(&toc, sections, page)
+		}
+	}
+	toc.WriteString("</li>\n")
+	for ; depth > 0; depth-- {
+		toc.WriteString("</ol>\n</li>\n")
+	}
+
+	toc.WriteString("</ol>\n</nav>\n")
+	return toc.String()
+}
+
+// writeHead writes the document up to the opening body tag, with title in
+// the title element
+func (r *Renderer) writeHead(doc *strings.Builder, book *parser.Book, title string) {
+	css := r.Config.InlineCSS
+	if css == "" {
+		css = DefaultCSS
+	}
+
+	doc.WriteString("<!DOCTYPE html>\n")
+	if book.Metadata.Language != "" {
+		fmt.Fprintf(doc, "<html lang=\"%s\">\n", htmlEscape(book.Metadata.Language))
+	} else {
+		doc.WriteString("<html>\n")
+	}
+	doc.WriteString("<head>\n<meta charset=\"utf-8\">\n")
+	fmt.Fprintf(doc, "<title>%s</title>\n", htmlEscape(title))
+	if author := firstAuthor(book); author != "" {
+		fmt.Fprintf(doc, "<meta name=\"author\" content=\"%s\">\n", htmlEscape(author))
+	}
+	fmt.Fprintf(doc, "<style>\n%s\n</style>\n", strings.ReplaceAll(css, "</", "<\\/"))
+	doc.WriteString("</head>\n<body>\n")
+}
+
+// writeTitle writes the header with the book title and first author
+func writeTitle(doc *strings.Builder, book *parser.Book) {
+	doc.WriteString("<header>\n")
+	fmt.Fprintf(doc, "<h1 class=\"title\">%s</h1>\n", htmlEscape(book.Metadata.Title))
+	if author := firstAuthor(book); author != "" {
+		fmt.Fprintf(doc, "<p class=\"author\">%s</p>\n", htmlEscape(author))
+	}
+	doc.WriteString("</header>\n")
+}
+
+func firstAuthor(book *parser.Book) string {
+	if len(book.Metadata.Authors) == 0 {
+		return ""
+	}
+	return book.Metadata.Authors[0].FullName()
+}
+
+func startsWithHeading(elements []parser.Element) bool {
+	if len(elements) == 0 {
+		return false
+	}
+	_, ok := elements[0].(*parser.Heading)
+	return ok
+}
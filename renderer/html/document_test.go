@@ -0,0 +1,212 @@
+package html
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/vpoluyaktov/biblio-ebook-parser/parser"
+)
+
+// HTML elements that have no end tag
+var voidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true, "hr": true, "img": true,
+	"input": true, "link": true, "meta": true, "source": true, "track": true, "wbr": true,
+}
+
+// Elements that close an open p, or can't be in a heading, when the HTML5
+// parser meets them
+var blockElements = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true, "div": true, "dl": true,
+	"figure": true, "footer": true, "h1": true, "h2": true, "h3": true, "h4": true, "h5": true,
+	"h6": true, "header": true, "hr": true, "main": true, "nav": true, "ol": true, "p": true,
+	"pre": true, "section": true, "table": true, "ul": true,
+}
+
+// validateHTML5 checks a document with a tokenizer for the faults that make
+// an HTML5 parser restructure it: mismatched or missing end tags, end tags
+// of void elements, blocks in paragraphs and headings, and nested links. It
+// also checks that ids are unique and fragment links lead to one.
+func validateHTML5(doc string) []string {
+	var problems []string
+	if !strings.HasPrefix(doc, "<!DOCTYPE html>") {
+		problems = append(problems, "no <!DOCTYPE html> at the start")
+	}
+
+	d := xml.NewDecoder(strings.NewReader(doc))
+	d.Strict = true // Attribute values quoted, entities known
+	d.Entity = xml.HTMLEntity
+
+	var open []string
+	ids := make(map[string]bool)
+	var fragments []string
+	for {
+		tok, err := d.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return append(problems, fmt.Sprintf("tokenizer: %v", err))
+		}
+		line, _ := d.InputPos()
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			name := t.Name.Local
+			for _, parent := range open {
+				switch {
+				case parent == "p" && blockElements[name]:
+					problems = append(problems, fmt.Sprintf("line %d: <%s> in <p>", line, name))
+				case len(parent) == 2 && parent[0] == 'h' && parent[1] >= '1' && parent[1] <= '6' && blockElements[name]:
+					problems = append(problems, fmt.Sprintf("line %d: <%s> in <%s>", line, name, parent))
+				case parent == "a" && name == "a":
+					problems = append(problems, fmt.Sprintf("line %d: <a> in <a>", line))
+				}
+			}
+			for _, attr := range t.Attr {
+				switch attr.Name.Local {
+				case "id":
+					if ids[attr.Value] {
+						problems = append(problems, fmt.Sprintf("line %d: duplicate id %q", line, attr.Value))
+					}
+					ids[attr.Value] = true
+				case "href":
+					if strings.HasPrefix(attr.Value, "#") {
+						fragments = append(fragments, attr.Value[1:])
+					}
+				}
+			}
+			if !voidElements[name] {
+				open = append(open, name)
+			}
+		case xml.EndElement:
+			name := t.Name.Local
+			if voidElements[name] {
+				// "<br/>" gives an end element too
+				continue
+			}
+			if len(open) == 0 || open[len(open)-1] != name {
+				problems = append(problems, fmt.Sprintf("line %d: </%s> closes %v", line, name, open))
+				continue
+			}
+			open = open[:len(open)-1]
+		}
+	}
+	if len(open) > 0 {
+		problems = append(problems, fmt.Sprintf("elements left open: %v", open))
+	}
+	for _, id := range fragments {
+		if !ids[id] {
+			problems = append(problems, fmt.Sprintf("link to missing id %q", id))
+		}
+	}
+	return problems
+}
+
+// richBook has every element type, links, notes and a page list
+func richBook() *parser.Book {
+	book := &parser.Book{
+		Metadata: parser.Metadata{
+			Title:    `Tom & Jerry's "Book" <1>`,
+			Authors:  []parser.Author{{FirstName: "Jane", LastName: "Doe"}},
+			Language: "en",
+		},
+		Content: parser.Content{
+			Chapters: []parser.Chapter{
+				{ID: "ch1", Title: "One", Elements: []parser.Element{
+					&parser.Heading{Text: "One", Level: 1},
+					&parser.Epigraph{Paragraphs: []parser.Paragraph{{Text: "To be <or> not"}}, Author: "W. S."},
+					&parser.Heading{Text: "Part A", Level: 2},
+					&parser.Paragraph{Text: "See chapter two and the site.", Links: []parser.Link{
+						{Start: 4, End: 15, Href: "#ch2-anchor"},
+						{Start: 24, End: 28, Href: "https://example.com/?a=1&b=2"},
+					}},
+					&parser.Footnote{ID: "n1", Label: "1", Elements: []parser.Element{&parser.Paragraph{Text: "A note."}}},
+					&parser.Heading{Text: "Part A", Level: 2},
+					&parser.Paragraph{Text: "Line one\nLine two"},
+					&parser.EmptyLine{},
+					&parser.Blockquote{Paragraphs: []parser.Paragraph{{Text: "Quoted\ntext"}}},
+					&parser.Heading{Text: "Part B", Level: 3},
+					&parser.Preformatted{Text: "if a < b && c > d {}", Language: "go"},
+					&parser.Image{Href: "images/map.png", Alt: "Map", Caption: "The map"},
+					&parser.Image{Href: "images/plain.png"},
+					&parser.Image{},
+					&parser.Table{Caption: "Data"},
+				}},
+				{ID: "ch2", Title: "Two & Three", Level: 1, Elements: []parser.Element{
+					&parser.Paragraph{Text: "No heading here."},
+					&parser.Paragraph{Text: "Inline", HTML: `<p>Some <em>em</em> and <a href="#ch1-anchor">a link</a><script>alert(1)</script></p>`},
+					&parser.Paragraph{Text: "Bare", HTML: `Bare <strong>FB2</strong> markup`},
+					&parser.Paragraph{Text: "Blocks", HTML: `<div><p>In a div</p><table><tr><td>cell</td></tr></table></div>`},
+				}},
+				{ID: "ch2", Title: "Duplicate id", Elements: []parser.Element{
+					&parser.Paragraph{Text: "Same chapter id as the one before."},
+				}},
+			},
+			ChapterIndex: map[string]int{"ch1-anchor": 0, "ch2-anchor": 1},
+		},
+		PageList: []parser.PageTarget{
+			{Label: "1", ChapterID: "ch1", ElementOffset: 0},
+			{Label: "2", ChapterID: "ch1", ElementOffset: 6},
+			{Label: "3", ChapterID: "ch2", ElementOffset: 4},
+		},
+	}
+	book.SetCover([]byte("\x89PNG\r\n\x1a\n"), "image/png")
+	return book
+}
+
+func TestRenderDocumentIsValidHTML5(t *testing.T) {
+	configs := map[string]Config{
+		"default": {},
+		"everything": {
+			IncludeTOC: true, IncludeCover: true, HeadingAnchors: true, ChapterMiniTOC: true,
+			PageBreaks: true, DescribeImages: true, SkipRepeatedHeadings: true,
+		},
+		"preserved structure": {PreserveStructure: true, IncludeTOC: true, HeadingAnchors: true},
+	}
+	for name, config := range configs {
+		t.Run(name, func(t *testing.T) {
+			r := NewRenderer(config)
+			doc, err := r.RenderDocument(richBook())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if problems := validateHTML5(doc); len(problems) > 0 {
+				t.Errorf("invalid HTML5:\n%s\n\n%s", strings.Join(problems, "\n"), doc)
+			}
+
+			// RenderTo writes the same document
+			var buf bytes.Buffer
+			if err := r.RenderTo(&buf, richBook()); err != nil {
+				t.Fatal(err)
+			}
+			if buf.String() != doc {
+				t.Error("RenderTo differs from RenderDocument")
+			}
+		})
+	}
+}
+
+func TestValidateHTML5(t *testing.T) {
+	// The checker itself finds the faults it looks for
+	tests := map[string]string{
+		"mismatched":  "<!DOCTYPE html><html><body><p><em>x</p></em></body></html>",
+		"block in p":  "<!DOCTYPE html><html><body><p><div>x</div></p></body></html>",
+		"duplicate":   `<!DOCTYPE html><html><body><p id="a">x</p><p id="a">y</p></body></html>`,
+		"broken link": `<!DOCTYPE html><html><body><a href="#nowhere">x</a></body></html>`,
+		"unclosed":    "<!DOCTYPE html><html><body><section></body></html>",
+		"no doctype":  "<html></html>",
+		"unquoted":    "<!DOCTYPE html><html lang=en></html>",
+	}
+	for name, doc := range tests {
+		if problems := validateHTML5(doc); len(problems) == 0 {
+			t.Errorf("%s: no problems found in %s", name, doc)
+		}
+	}
+	if problems := validateHTML5(`<!DOCTYPE html><html><head><meta charset="utf-8"></head><body><p>a<br/>b<img src="x" alt=""></p></body></html>`); len(problems) > 0 {
+		t.Errorf("valid document: %q", problems)
+	}
+}
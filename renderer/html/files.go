@@ -0,0 +1,240 @@
+package html
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/vpoluyaktov/biblio-ebook-parser/parser"
+)
+
+// IndexFile is the name of the page RenderToFiles writes the table of
+// contents to
+const IndexFile = "index.html"
+
+// maxFileSlugLength caps the title slugs of chapter file names, in bytes
+const maxFileSlugLength = 48
+
+// FilesOptions controls RenderToFiles
+type FilesOptions struct {
+	// NumberedNames names chapter files by their ordinal only ("003.html")
+	// instead of ordinal and title slug ("003-the-road.html")
+	NumberedNames bool
+	// Slug controls the title slugs, in the book's language unless it gives
+	// one and capped at 48 bytes unless it gives a MaxLength
+	Slug parser.SlugOptions
+	// SkipCover leaves the cover image out
+	SkipCover bool
+}
+
+// coverExtensions maps cover MIME types to file extensions
+var coverExtensions = map[string]string{
+	"image/jpeg":    ".jpg",
+	"image/png":     ".png",
+	"image/gif":     ".gif",
+	"image/webp":    ".webp",
+	"image/bmp":     ".bmp",
+	"image/svg+xml": ".svg",
+}
+
+// RenderToFiles renders the book as a set of pages for static sites, one per
+// chapter plus IndexFile with the title, the cover and a table of contents
+// linking to the chapters. Each file is passed to sink by name, so it can be
+// written to a directory, a zip or object storage. Chapter files are named
+// by ordinal and title slug (e.g., "003-the-road.html") and link to the
+// previous and next chapters; internal links between chapters lead to their
+// files. The cover is written as "cover" with the extension of its type,
+// "cover.jpg" for JPEG.
+func (r *Renderer) RenderToFiles(book *parser.Book, sink func(name string, content []byte) error, opts FilesOptions) error {
+	write := func(name string, content []byte) error {
+		if err := sink(name, content); err != nil {
+			return fmt.Errorf("failed to write %s: %w", name, err)
+		}
+		return nil
+	}
+
+	chapters := book.Content.Chapters
+	files := chapterFiles(book, opts)
+
+	targets := linkTargets(book)
+	for id, index := range book.Content.ChapterIndex {
+		if target, ok := targets[id]; ok {
+			target.File = files[index]
+			targets[id] = target
+		}
+	}
+
+	anchors := make([]headingAnchors, len(chapters))
+	for i, ch := range chapters {
+		anchors[i] = r.headingAnchors(r.chapterElements(book, ch), "", make(map[string]bool))
+	}
+
+	cover := ""
+	if !opts.SkipCover && len(book.Metadata.CoverData) > 0 {
+		cover = coverFile(book.Metadata.CoverType, book.Metadata.CoverData)
+		if err := write(cover, book.Metadata.CoverData); err != nil {
+			return err
+		}
+	}
+
+	var doc strings.Builder
+	r.writeHead(&doc, book, book.Metadata.Title)
+	if cover != "" {
+		fmt.Fprintf(&doc, "<img class=\"cover\" src=\"%s\" alt=\"%s\">\n", htmlEscape(cover), htmlEscape(book.Metadata.Title))
+	}
+	writeTitle(&doc, book)
+	if len(chapters) > 0 {
+		doc.WriteString(tableOfContents(chapters, files, anchors, files))
+	}
+	doc.WriteString("</body>\n</html>\n")
+	if err := write(IndexFile, []byte(doc.String())); err != nil {
+		return err
+	}
+
+	for i, ch := range chapters {
+		doc.Reset()
+		title := chapterTitle(ch, i)
+		if book.Metadata.Title != "" {
+			title += " - " + book.Metadata.Title
+		}
+		r.writeHead(&doc, book, title)
+
+		pager := chapterPager(files, i)
+		doc.WriteString(pager)
+		doc.WriteString("<section class=\"chapter\">\n")
+		elements := r.chapterElements(book, ch)
+		if !startsWithHeading(elements) && ch.Title != "" {
+			level := min(ch.Level+2, 6)
+			fmt.Fprintf(&doc, "<h%d>%s</h%d>\n", level, htmlEscape(ch.Title), level)
+		}
+		doc.WriteString(r.elementsToHTML(elements, sourceFileTargets(targets, chapters, files, i), r.pageBreaks(book, ch, elements), anchors[i]))
+		doc.WriteString("</section>\n")
+		doc.WriteString(pager)
+		doc.WriteString("</body>\n</html>\n")
+
+		if err := write(files[i], []byte(doc.String())); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sourceFileTargets adds to targets the source files of the chapters (e.g.,
+// the content documents of an EPUB), keyed by their paths relative to the
+// source file of chapter i and, for chapters starting at an anchor, by path
+// and anchor. Links between the files in preserved HTML then lead to the
+// chapter files.
+func sourceFileTargets(targets map[string]linkTarget, chapters []parser.Chapter, files []string, i int) map[string]linkTarget {
+	if path.Ext(chapters[i].SourcePath) == "" {
+		// Not a file, e.g., the element path of an FB2 section
+		return targets
+	}
+	dir := path.Dir(chapters[i].SourcePath)
+
+	withFiles := make(map[string]linkTarget, len(targets)+len(chapters))
+	for id, target := range targets {
+		withFiles[id] = target
+	}
+	for j, ch := range chapters {
+		if path.Ext(ch.SourcePath) == "" {
+			continue
+		}
+		rel, err := filepath.Rel(dir, ch.SourcePath)
+		if err != nil {
+			continue
+		}
+		rel = filepath.ToSlash(rel)
+		target := linkTarget{ID: ch.ID, File: files[j]}
+		if _, ok := withFiles[rel]; !ok {
+			// A file split into several chapters leads to the first
+			withFiles[rel] = target
+		}
+		if ch.SourceAnchor != "" {
+			withFiles[rel+"#"+ch.SourceAnchor] = target
+		}
+	}
+	return withFiles
+}
+
+// sourceFileTarget returns the chapter file a link to a source file leads
+// to, by path and anchor or, if no chapter starts at the anchor, by path
+func sourceFileTarget(targets map[string]linkTarget, href string) (linkTarget, bool) {
+	if unescaped, err := url.PathUnescape(href); err == nil {
+		href = unescaped
+	}
+	target, ok := targets[href]
+	if !ok {
+		file, _, _ := strings.Cut(href, "#")
+		target, ok = targets[file]
+	}
+	return target, ok && target.File != ""
+}
+
+// chapterFiles returns the file name of each chapter: its ordinal, padded to
+// at least three digits so the names sort in reading order, and the slug of
+// its title
+func chapterFiles(book *parser.Book, opts FilesOptions) []string {
+	chapters := book.Content.Chapters
+	width := max(3, len(fmt.Sprint(len(chapters))))
+
+	slugOpts := opts.Slug
+	if slugOpts.Language == "" {
+		slugOpts.Language = book.Metadata.Language
+	}
+	if slugOpts.MaxLength <= 0 {
+		slugOpts.MaxLength = maxFileSlugLength
+	}
+
+	files := make([]string, len(chapters))
+	for i, ch := range chapters {
+		files[i] = fmt.Sprintf("%0*d.html", width, i+1)
+		if opts.NumberedNames {
+			continue
+		}
+		if slug := parser.Slug(ch.Title, slugOpts); slug != "" {
+			files[i] = fmt.Sprintf("%0*d-%s.html", width, i+1, slug)
+		}
+	}
+	return files
+}
+
+// coverFile returns the file name of the cover, by its type or, if that is
+// unknown, its sniffed bytes
+func coverFile(mimeType string, data []byte) string {
+	if ext, ok := coverExtensions[strings.ToLower(mimeType)]; ok {
+		return "cover" + ext
+	}
+	sniffed, _, _ := strings.Cut(http.DetectContentType(data), ";")
+	if ext, ok := coverExtensions[sniffed]; ok {
+		return "cover" + ext
+	}
+	return "cover.jpg"
+}
+
+// chapterPager returns the navigation block linking a chapter file to the
+// previous and next chapters and the index
+func chapterPager(files []string, i int) string {
+	var pager strings.Builder
+	pager.WriteString("<nav class=\"pager\">\n")
+	if i > 0 {
+		fmt.Fprintf(&pager, "<a rel=\"prev\" href=\"%s\">Previous</a>\n", htmlEscape(files[i-1]))
+	}
+	fmt.Fprintf(&pager, "<a href=\"%s\">Contents</a>\n", IndexFile)
+	if i+1 < len(files) {
+		fmt.Fprintf(&pager, "<a rel=\"next\" href=\"%s\">Next</a>\n", htmlEscape(files[i+1]))
+	}
+	pager.WriteString("</nav>\n")
+	return pager.String()
+}
+
+// chapterTitle returns the chapter title, or "Chapter N" if it has none
+func chapterTitle(ch parser.Chapter, i int) string {
+	if ch.Title != "" {
+		return ch.Title
+	}
+	return fmt.Sprintf("Chapter %d", i+1)
+}
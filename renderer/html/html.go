@@ -1,7 +1,9 @@
 package html
 
 import (
+	"encoding/base64"
 	"fmt"
+	"net/http"
 	"strings"
 
 	"github.com/vpoluyaktov/biblio-ebook-parser/parser"
@@ -14,7 +16,39 @@ type Renderer struct {
 
 // Config holds configuration for HTML rendering
 type Config struct {
-	PreserveStructure bool // Preserve HTML structure from original
+	PreserveStructure   bool // Preserve HTML structure from original
+	DisableSanitization bool // Emit preserved HTML verbatim instead of reducing it to safe inline markup
+	InlineImages        bool // Embed images with data as data URIs
+	DescribeImages      bool // Give images without alt text one naming their place, e.g. "Illustration 2 in chapter The Road"
+
+	// SkipRepeatedHeadings leaves out the leading headings of a chapter that
+	// only repeat its title or the book title (e.g., a banner on every
+	// chapter). Off by default.
+	SkipRepeatedHeadings bool
+
+	// ImageSrcRewriter returns the src for an image, given its href in the source
+	// book and its data if available (e.g., after uploading the data to a CDN).
+	// Also applied to img tags in sanitized HTML, with nil data.
+	ImageSrcRewriter func(href string, data []byte) string
+
+	// PageBreaks marks where the pages of the print edition start, from the
+	// book's PageList, with invisible page-break spans that screen readers
+	// can navigate by
+	PageBreaks bool
+
+	// HeadingAnchors gives each heading an id made from its text, unique
+	// within the chapter (and in RenderDocument, prefixed with the chapter
+	// anchor to be unique within the document)
+	HeadingAnchors bool
+	// ChapterMiniTOC adds a navigation block after the title of chapters
+	// with two or more h2/h3 sections, linking to them. Implies
+	// HeadingAnchors.
+	ChapterMiniTOC bool
+
+	// Options used by RenderDocument only (RenderToFiles uses InlineCSS too)
+	IncludeTOC   bool   // Add a table of contents linking to the chapters
+	IncludeCover bool   // Inline the cover image as a data URI at the top
+	InlineCSS    string // Stylesheet embedded in the head, DefaultCSS if empty
 }
 
 // NewRenderer creates a new HTML renderer
@@ -56,6 +90,22 @@ func (r *Renderer) RenderMetadata(book *parser.Book) (interface{}, error) {
 		metadata["authors"] = authors
 	}
 
+	if book.Metadata.DescriptionHTML != "" {
+		metadata["descriptionHTML"] = book.Metadata.DescriptionHTML
+	}
+
+	if len(book.Metadata.Sequences) > 0 {
+		sequences := make([]map[string]interface{}, len(book.Metadata.Sequences))
+		for i, seq := range book.Metadata.Sequences {
+			sequences[i] = map[string]interface{}{
+				"name":      seq.Name,
+				"number":    seq.Number,
+				"publisher": seq.Publisher,
+			}
+		}
+		metadata["sequences"] = sequences
+	}
+
 	if book.Metadata.CoverData != nil {
 		metadata["hasCover"] = true
 		metadata["coverType"] = book.Metadata.CoverType
@@ -64,8 +114,13 @@ func (r *Renderer) RenderMetadata(book *parser.Book) (interface{}, error) {
 	return metadata, nil
 }
 
-// RenderContent converts book content to HTML format
+// RenderContent converts book content to HTML format, returning a *BookContent
 func (r *Renderer) RenderContent(book *parser.Book) (interface{}, error) {
+	return r.Render(book)
+}
+
+// Render converts book content to HTML format
+func (r *Renderer) Render(book *parser.Book) (*BookContent, error) {
 	content := &BookContent{
 		Title:    book.Metadata.Title,
 		Format:   "html",
@@ -76,8 +131,11 @@ func (r *Renderer) RenderContent(book *parser.Book) (interface{}, error) {
 		content.Author = book.Metadata.Authors[0].FullName()
 	}
 
+	targets := linkTargets(book)
 	for _, ch := range book.Content.Chapters {
-		htmlContent := r.elementsToHTML(ch.Elements)
+		elements := r.chapterElements(book, ch)
+		anchors := r.headingAnchors(elements, "", make(map[string]bool))
+		htmlContent := r.elementsToHTML(elements, targets, r.pageBreaks(book, ch, elements), anchors)
 		content.Chapters = append(content.Chapters, Chapter{
 			ID:      ch.ID,
 			Title:   ch.Title,
@@ -88,64 +146,285 @@ func (r *Renderer) RenderContent(book *parser.Book) (interface{}, error) {
 	return content, nil
 }
 
-func (r *Renderer) elementsToHTML(elements []parser.Element) string {
+// RenderChapter renders a single chapter, returning a *parser.ChapterNotFoundError for unknown IDs
+func (r *Renderer) RenderChapter(book *parser.Book, chapterID string) (Chapter, error) {
+	ch, err := book.FindChapter(chapterID)
+	if err != nil {
+		return Chapter{}, err
+	}
+
+	elements := r.chapterElements(book, *ch)
+	return Chapter{
+		ID:      ch.ID,
+		Title:   ch.Title,
+		Content: r.elementsToHTML(elements, linkTargets(book), r.pageBreaks(book, *ch, elements), r.headingAnchors(elements, "", make(map[string]bool))),
+	}, nil
+}
+
+// chapterElements returns the elements to render for a chapter
+func (r *Renderer) chapterElements(book *parser.Book, ch parser.Chapter) []parser.Element {
+	elements := ch.Elements
+	if r.Config.SkipRepeatedHeadings {
+		elements = ch.BodyElements(book.Metadata.Title)
+	}
+	if r.Config.DescribeImages {
+		elements = parser.DescribeImages(elements, ch.Title)
+	}
+	return elements
+}
+
+// elementsToHTML renders elements with the page breaks and heading ids
+// given, and the chapter's mini table of contents after its leading heading
+// if it has sections and ChapterMiniTOC is on
+func (r *Renderer) elementsToHTML(elements []parser.Element, targets map[string]linkTarget, breaks pageBreaks, anchors headingAnchors) string {
 	var html strings.Builder
 
-	for _, elem := range elements {
-		switch e := elem.(type) {
-		case *parser.Heading:
-			level := e.Level
-			if level < 1 {
-				level = 1
-			}
-			if level > 6 {
-				level = 6
-			}
-			html.WriteString(fmt.Sprintf("<h%d>%s</h%d>\n", level, htmlEscape(e.Text), level))
-
-		case *parser.Paragraph:
-			if r.Config.PreserveStructure && e.HTML != "" {
-				html.WriteString(e.HTML)
-				html.WriteString("\n")
-			} else {
-				html.WriteString("<p>")
-				html.WriteString(htmlEscape(e.Text))
-				html.WriteString("</p>\n")
-			}
+	miniTOC := r.Config.ChapterMiniTOC && len(anchors.sections) > 0
+	if miniTOC && !startsWithHeading(elements) {
+		writeMiniTOC(&html, anchors.sections)
+	}
+	for i, elem := range elements {
+		writePageBreaks(&html, breaks[i])
+		if heading, ok := elem.(*parser.Heading); ok {
+			writeHeading(&html, heading, anchors.ids[i])
+		} else {
+			r.writeElement(&html, elem, targets)
+		}
+		if i == 0 && miniTOC && startsWithHeading(elements) {
+			writeMiniTOC(&html, anchors.sections)
+		}
+	}
+	writePageBreaks(&html, breaks[len(elements)])
 
-		case *parser.Image:
-			alt := htmlEscape(e.Alt)
-			if e.Href != "" {
-				html.WriteString(fmt.Sprintf(`<img src="%s" alt="%s">`, htmlEscape(e.Href), alt))
-			} else {
-				html.WriteString(fmt.Sprintf(`<p><em>[Image: %s]</em></p>`, alt))
-			}
+	return html.String()
+}
+
+// writeHeading writes a heading with the id, if any
+func writeHeading(html *strings.Builder, h *parser.Heading, id string) {
+	level := headingLevel(h)
+	if id != "" {
+		html.WriteString(fmt.Sprintf("<h%d id=\"%s\">%s</h%d>\n", level, htmlEscape(id), htmlEscape(h.Text), level))
+		return
+	}
+	html.WriteString(fmt.Sprintf("<h%d>%s</h%d>\n", level, htmlEscape(h.Text), level))
+}
+
+// writeElement writes the HTML for a single content element. Internal links
+// are resolved through targets.
+func (r *Renderer) writeElement(html *strings.Builder, elem parser.Element, targets map[string]linkTarget) {
+	switch e := elem.(type) {
+	case *parser.Heading:
+		writeHeading(html, e, "")
+
+	case *parser.Paragraph:
+		if markup, ok := r.preservedHTML(e, targets); ok {
+			html.WriteString(markup)
 			html.WriteString("\n")
+		} else {
+			// Multi-line paragraphs (e.g., poem stanzas) keep their line breaks
+			html.WriteString("<p>")
+			html.WriteString(strings.ReplaceAll(linkedText(e, targets), "\n", "<br/>\n"))
+			html.WriteString("</p>\n")
+		}
 
-		case *parser.Table:
-			caption := htmlEscape(e.Caption)
-			if caption != "" {
-				html.WriteString(fmt.Sprintf("<p><em>[Table: %s]</em></p>\n", caption))
-			} else {
-				html.WriteString("<p><em>[Table]</em></p>\n")
+	case *parser.Image:
+		alt, caption := htmlEscape(e.Alt), htmlEscape(e.Caption)
+		src := r.imageSrc(e)
+		switch {
+		case src != "" && caption != "":
+			label := alt
+			if label == "" {
+				label = caption
 			}
+			html.WriteString(fmt.Sprintf(`<figure role="img" aria-label="%s"><img src="%s" alt="%s"><figcaption>%s</figcaption></figure>`, label, htmlEscape(src), alt, caption))
+		case src != "":
+			html.WriteString(fmt.Sprintf(`<img src="%s" alt="%s">`, htmlEscape(src), alt))
+		case alt != "":
+			html.WriteString(fmt.Sprintf(`<p><em>[Image: %s]</em></p>`, alt))
+		case caption != "":
+			html.WriteString(fmt.Sprintf(`<p><em>[Image: %s]</em></p>`, caption))
+		default:
+			html.WriteString("<p><em>[Image]</em></p>")
+		}
+		html.WriteString("\n")
 
-		case *parser.EmptyLine:
-			html.WriteString("<br/>\n")
+	case *parser.Table:
+		caption := htmlEscape(e.Caption)
+		if caption != "" {
+			html.WriteString(fmt.Sprintf("<p><em>[Table: %s]</em></p>\n", caption))
+		} else {
+			html.WriteString("<p><em>[Table]</em></p>\n")
+		}
 
-		case *parser.Epigraph:
-			html.WriteString(`<blockquote class="epigraph">`)
-			html.WriteString("\n")
-			for _, p := range e.Paragraphs {
-				html.WriteString("<p>")
-				html.WriteString(htmlEscape(p.Text))
-				html.WriteString("</p>\n")
+	case *parser.EmptyLine:
+		html.WriteString("<br/>\n")
+
+	case *parser.Epigraph:
+		html.WriteString(`<blockquote class="epigraph">`)
+		html.WriteString("\n")
+		for _, p := range e.Paragraphs {
+			html.WriteString("<p>")
+			html.WriteString(linkedText(&p, targets))
+			html.WriteString("</p>\n")
+		}
+		if e.Author != "" {
+			html.WriteString(`<p class="text-author"><em>`)
+			html.WriteString(htmlEscape(e.Author))
+			html.WriteString("</em></p>\n")
+		}
+		html.WriteString("</blockquote>\n")
+
+	case *parser.Blockquote:
+		html.WriteString("<blockquote>\n")
+		for _, p := range e.Paragraphs {
+			html.WriteString("<p>")
+			html.WriteString(strings.ReplaceAll(htmlEscape(p.Text), "\n", "<br/>\n"))
+			html.WriteString("</p>\n")
+		}
+		html.WriteString("</blockquote>\n")
+
+	case *parser.Preformatted:
+		if e.Language != "" {
+			html.WriteString(fmt.Sprintf(`<pre><code class="language-%s">`, htmlEscape(e.Language)))
+		} else {
+			html.WriteString("<pre><code>")
+		}
+		html.WriteString(htmlEscape(e.Text))
+		html.WriteString("</code></pre>\n")
+
+	case *parser.Footnote:
+		html.WriteString(fmt.Sprintf(`<aside class="footnote" data-note="%s">`, htmlEscape(e.ID)))
+		html.WriteString("\n")
+		// The label opens the first paragraph written
+		label := ""
+		if e.Label != "" {
+			label = fmt.Sprintf("<sup>%s</sup> ", htmlEscape(e.Label))
+		}
+		for _, note := range e.Elements {
+			p, ok := note.(*parser.Paragraph)
+			if !ok {
+				continue
 			}
-			html.WriteString("</blockquote>\n")
+			html.WriteString("<p>")
+			html.WriteString(label)
+			label = ""
+			html.WriteString(htmlEscape(p.Text))
+			html.WriteString("</p>\n")
 		}
+		html.WriteString("</aside>\n")
 	}
+}
 
-	return html.String()
+// preservedHTML returns the paragraph's original markup when PreserveStructure is on,
+// sanitized unless DisableSanitization is set
+func (r *Renderer) preservedHTML(p *parser.Paragraph, targets map[string]linkTarget) (string, bool) {
+	if !r.Config.PreserveStructure || p.HTML == "" {
+		return "", false
+	}
+	if r.Config.DisableSanitization {
+		return p.HTML, true
+	}
+
+	var rewriteImage func(string) string
+	if r.Config.ImageSrcRewriter != nil {
+		rewriteImage = func(src string) string { return r.Config.ImageSrcRewriter(src, nil) }
+	}
+
+	rewriteLink := func(href string) string {
+		if target, ok := targets[strings.TrimPrefix(href, "#")]; ok && strings.HasPrefix(href, "#") {
+			return target.href()
+		}
+		if target, ok := sourceFileTarget(targets, href); ok {
+			return target.href()
+		}
+		return href
+	}
+
+	markup, ok := sanitizeHTML(p.HTML, rewriteImage, rewriteLink)
+	if !ok || strings.TrimSpace(markup) == "" {
+		return "", false
+	}
+	// FB2 markup holds the paragraph's content only
+	if !strings.HasPrefix(markup, "<p") {
+		markup = "<p>" + markup + "</p>"
+	}
+	return markup, true
+}
+
+// imageSrc returns the src for an image element, or "" to render a placeholder
+func (r *Renderer) imageSrc(img *parser.Image) string {
+	switch {
+	case r.Config.ImageSrcRewriter != nil:
+		return r.Config.ImageSrcRewriter(img.Href, img.Data)
+	case r.Config.InlineImages && len(img.Data) > 0:
+		return "data:" + http.DetectContentType(img.Data) + ";base64," + base64.StdEncoding.EncodeToString(img.Data)
+	default:
+		return img.Href
+	}
+}
+
+// linkTarget is the chapter an internal link leads to
+type linkTarget struct {
+	ID     string // Chapter ID
+	Anchor string // Anchor of the chapter section in RenderDocument
+	File   string // Chapter file in RenderToFiles, linked instead of the anchor
+}
+
+func (t linkTarget) href() string {
+	if t.File != "" {
+		return t.File
+	}
+	return "#" + t.Anchor
+}
+
+// linkTargets maps the ids of the source document (e.g., FB2 section ids) to
+// the chapters containing them
+func linkTargets(book *parser.Book) map[string]linkTarget {
+	if len(book.Content.ChapterIndex) == 0 {
+		return nil
+	}
+	anchors := chapterAnchors(book.Content.Chapters)
+	targets := make(map[string]linkTarget, len(book.Content.ChapterIndex))
+	for id, index := range book.Content.ChapterIndex {
+		if index >= 0 && index < len(anchors) {
+			targets[id] = linkTarget{ID: book.Content.Chapters[index].ID, Anchor: anchors[index]}
+		}
+	}
+	return targets
+}
+
+// linkedText returns the escaped paragraph text with its links as anchors.
+// Internal links point to the chapter anchors of RenderDocument, or the
+// chapter files of RenderToFiles, and carry the chapter ID in data-chapter;
+// those to unknown places and links other than http(s) are left as plain text.
+func linkedText(p *parser.Paragraph, targets map[string]linkTarget) string {
+	var out strings.Builder
+	pos := 0
+	for _, link := range p.Links {
+		if link.Start < pos || link.End > len(p.Text) || link.Start >= link.End {
+			continue
+		}
+
+		var open string
+		if link.Internal() {
+			if target, ok := targets[strings.TrimPrefix(link.Href, "#")]; ok {
+				open = fmt.Sprintf(`<a href="%s" data-chapter="%s">`, htmlEscape(target.href()), htmlEscape(target.ID))
+			}
+		} else if scheme := strings.ToLower(strings.SplitN(link.Href, ":", 2)[0]); scheme == "http" || scheme == "https" {
+			open = fmt.Sprintf(`<a href="%s">`, htmlEscape(link.Href))
+		}
+		if open == "" {
+			continue
+		}
+
+		out.WriteString(htmlEscape(p.Text[pos:link.Start]))
+		out.WriteString(open)
+		out.WriteString(htmlEscape(p.Text[link.Start:link.End]))
+		out.WriteString("</a>")
+		pos = link.End
+	}
+	out.WriteString(htmlEscape(p.Text[pos:]))
+	return out.String()
 }
 
 func htmlEscape(s string) string {
@@ -0,0 +1,66 @@
+package html
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/vpoluyaktov/biblio-ebook-parser/parser"
+)
+
+func writeElement(elem parser.Element) string {
+	var b strings.Builder
+	NewRenderer(Config{}).writeElement(&b, elem, nil)
+	return b.String()
+}
+
+func TestWriteFootnote(t *testing.T) {
+	first, second := &parser.Paragraph{Text: "A note."}, &parser.Paragraph{Text: "More <of> it."}
+	tests := []struct {
+		name string
+		note *parser.Footnote
+		want string
+	}{
+		{
+			name: "paragraphs",
+			note: &parser.Footnote{ID: "n1", Label: "1", Elements: []parser.Element{first, second}},
+			want: "<p><sup>1</sup> A note.</p>\n<p>More &lt;of&gt; it.</p>\n",
+		},
+		{
+			// The label goes to the first paragraph written, whatever comes
+			// before it
+			name: "after other elements",
+			note: &parser.Footnote{ID: "n2", Label: "*", Elements: []parser.Element{&parser.EmptyLine{}, &parser.Heading{Text: "Note"}, first, second}},
+			want: "<p><sup>*</sup> A note.</p>\n<p>More &lt;of&gt; it.</p>\n",
+		},
+		{
+			name: "no label",
+			note: &parser.Footnote{ID: "n3", Elements: []parser.Element{first}},
+			want: "<p>A note.</p>\n",
+		},
+		{
+			name: "nothing to write",
+			note: &parser.Footnote{ID: "n4", Label: "4", Elements: []parser.Element{&parser.EmptyLine{}}},
+			want: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := `<aside class="footnote" data-note="` + tt.note.ID + "\">\n" + tt.want + "</aside>\n"
+			if got := writeElement(tt.note); got != want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, want)
+			}
+		})
+	}
+}
+
+func TestWriteEpigraph(t *testing.T) {
+	got := writeElement(&parser.Epigraph{Paragraphs: []parser.Paragraph{{Text: "To be"}}, Author: "W. S."})
+	want := "<blockquote class=\"epigraph\">\n<p>To be</p>\n<p class=\"text-author\"><em>W. S.</em></p>\n</blockquote>\n"
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	// Its alignment comes from the style sheet
+	if !strings.Contains(DefaultCSS, ".text-author { text-align: right; }") {
+		t.Error("DefaultCSS does not align the epigraph author")
+	}
+}
@@ -0,0 +1,8 @@
+package html
+
+import "github.com/vpoluyaktov/biblio-ebook-parser/renderer"
+
+func init() {
+	// Register with the default configuration
+	renderer.Register("html", NewRenderer(Config{}))
+}
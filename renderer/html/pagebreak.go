@@ -0,0 +1,61 @@
+package html
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/vpoluyaktov/biblio-ebook-parser/parser"
+)
+
+// pageBreaks maps the indexes of a chapter's rendered elements to the labels
+// of the print pages starting at them. The index after the last element
+// holds the pages starting at the end of the chapter.
+type pageBreaks map[int][]string
+
+// pageBreaks returns the print pages starting in a chapter, nil unless
+// PageBreaks is on
+func (r *Renderer) pageBreaks(book *parser.Book, ch parser.Chapter, elements []parser.Element) pageBreaks {
+	if !r.Config.PageBreaks {
+		return nil
+	}
+
+	// Leading headings left out by SkipRepeatedHeadings shift the offsets
+	skipped := len(ch.Elements) - len(elements)
+	var breaks pageBreaks
+	for _, page := range book.PageList {
+		if page.ChapterID != ch.ID {
+			continue
+		}
+		if breaks == nil {
+			breaks = make(pageBreaks)
+		}
+		i := min(max(page.ElementOffset-skipped, 0), len(elements))
+		breaks[i] = append(breaks[i], page.Label)
+	}
+	return breaks
+}
+
+// window returns the page breaks of n elements from start, renumbered from
+// 0. Those after the last of them are kept only if last is set, as they are
+// otherwise the breaks before the next element.
+func (b pageBreaks) window(start, n int, last bool) pageBreaks {
+	if b == nil {
+		return nil
+	}
+	window := make(pageBreaks)
+	for i, labels := range b {
+		if i >= start && (i < start+n || (i == start+n && last)) {
+			window[i-start] = labels
+		}
+	}
+	return window
+}
+
+// writePageBreaks writes invisible markers of the print pages starting at
+// the current position, which screen readers let users navigate by
+func writePageBreaks(html *strings.Builder, labels []string) {
+	for _, label := range labels {
+		html.WriteString(fmt.Sprintf(`<span class="page-break" role="doc-pagebreak" aria-label="%s"></span>`, htmlEscape(label)))
+		html.WriteString("\n")
+	}
+}
@@ -0,0 +1,118 @@
+package html
+
+import (
+	"fmt"
+
+	"github.com/vpoluyaktov/biblio-ebook-parser/parser"
+)
+
+// PaginatedContent represents a book split into pages of roughly equal size
+type PaginatedContent struct {
+	Title  string     `json:"title"`
+	Author string     `json:"author"`
+	Pages  []Page     `json:"pages"`
+	TOC    []TOCEntry `json:"toc"`
+}
+
+// Page is a run of whole elements from one chapter
+type Page struct {
+	ChapterID string `json:"chapterId"`
+	Ordinal   int    `json:"ordinal"` // Page number within the chapter, starting at 1
+	Number    int    `json:"number"`  // Page number within the book, starting at 1
+	Content   string `json:"content"`
+}
+
+// TOCEntry maps a chapter to its first page
+type TOCEntry struct {
+	ChapterID string `json:"chapterId"`
+	Title     string `json:"title"`
+	Level     int    `json:"level"`
+	Page      int    `json:"page"`
+}
+
+// RenderPaginated splits each chapter into pages of about charsPerPage
+// characters. Pages break only between elements and never end with a heading.
+// The same book and page size always give the same pages.
+func (r *Renderer) RenderPaginated(book *parser.Book, charsPerPage int) (*PaginatedContent, error) {
+	if charsPerPage <= 0 {
+		return nil, fmt.Errorf("invalid page size: %d", charsPerPage)
+	}
+
+	content := &PaginatedContent{
+		Title: book.Metadata.Title,
+		Pages: []Page{},
+		TOC:   make([]TOCEntry, 0, len(book.Content.Chapters)),
+	}
+
+	if len(book.Metadata.Authors) > 0 {
+		content.Author = book.Metadata.Authors[0].FullName()
+	}
+
+	targets := linkTargets(book)
+	for _, ch := range book.Content.Chapters {
+		content.TOC = append(content.TOC, TOCEntry{
+			ChapterID: ch.ID,
+			Title:     ch.Title,
+			Level:     ch.Level,
+			Page:      len(content.Pages) + 1,
+		})
+
+		chapterElements := r.chapterElements(book, ch)
+		breaks := r.pageBreaks(book, ch, chapterElements)
+		anchors := r.headingAnchors(chapterElements, "", make(map[string]bool))
+		pages := paginate(chapterElements, charsPerPage)
+		start := 0
+		for i, elements := range pages {
+			content.Pages = append(content.Pages, Page{
+				ChapterID: ch.ID,
+				Ordinal:   i + 1,
+				Number:    len(content.Pages) + 1,
+				Content: r.elementsToHTML(elements, targets,
+					breaks.window(start, len(elements), i == len(pages)-1), anchors.window(start, len(elements))),
+			})
+			start += len(elements)
+		}
+	}
+
+	return content, nil
+}
+
+// paginate groups elements into pages of about charsPerPage characters.
+// A chapter always has at least one page, even if it is empty.
+func paginate(elements []parser.Element, charsPerPage int) [][]parser.Element {
+	var pages [][]parser.Element
+	var page []parser.Element
+	size := 0
+
+	for _, elem := range elements {
+		count := elem.CharCount()
+		if len(page) > 0 && size+count > charsPerPage {
+			// Carry trailing headings over to the next page with their content
+			cut := len(page)
+			for cut > 0 && isHeading(page[cut-1]) {
+				cut--
+			}
+			if cut > 0 {
+				pages = append(pages, page[:cut])
+				page = append([]parser.Element{}, page[cut:]...)
+				size = 0
+				for _, e := range page {
+					size += e.CharCount()
+				}
+			}
+		}
+		page = append(page, elem)
+		size += count
+	}
+
+	if len(page) > 0 || len(pages) == 0 {
+		pages = append(pages, page)
+	}
+
+	return pages
+}
+
+func isHeading(elem parser.Element) bool {
+	_, ok := elem.(*parser.Heading)
+	return ok
+}
@@ -0,0 +1,219 @@
+package html
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// allowedTags maps source tags to the tags kept in sanitized HTML. FB2 inline
+// markup is translated to its HTML equivalent.
+var allowedTags = map[string]string{
+	"p":        "p",
+	"em":       "em",
+	"strong":   "strong",
+	"i":        "i",
+	"b":        "b",
+	"span":     "span",
+	"br":       "br",
+	"a":        "a",
+	"img":      "img",
+	"emphasis": "em",  // FB2
+	"image":    "img", // FB2
+}
+
+// droppedTags are removed together with their content
+var droppedTags = map[string]bool{
+	"script":   true,
+	"style":    true,
+	"iframe":   true,
+	"frame":    true,
+	"frameset": true,
+	"object":   true,
+	"embed":    true,
+	"applet":   true,
+	"noscript": true,
+	"template": true,
+	"svg":      true,
+	"math":     true,
+	"head":     true,
+	"title":    true,
+	"textarea": true,
+	"select":   true,
+}
+
+// sanitizeHTML reduces markup to an allow-list of inline tags and safe
+// attributes. Tags outside the list are dropped but their text is kept.
+// Image sources are passed through rewriteImage and link targets through
+// rewriteLink when they are not nil. Returns false if the markup cannot be
+// tokenized.
+func sanitizeHTML(markup string, rewriteImage, rewriteLink func(string) string) (string, bool) {
+	decoder := xml.NewDecoder(strings.NewReader(markup))
+	decoder.Strict = false
+	decoder.AutoClose = xml.HTMLAutoClose
+	decoder.Entity = xml.HTMLEntity
+
+	var out strings.Builder
+	var open []string
+	skip, skipDepth := "", 0
+
+	for {
+		token, err := decoder.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", false
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			name := strings.ToLower(t.Name.Local)
+			if skip != "" {
+				if name == skip {
+					skipDepth++
+				}
+				continue
+			}
+			// FB2 uses <style name="..."> for inline named styles, which only carry text
+			if droppedTags[name] && !(name == "style" && attr(t, "name") != "") {
+				skip, skipDepth = name, 1
+				continue
+			}
+
+			tag, ok := allowedTags[name]
+			if !ok {
+				continue
+			}
+			out.WriteString("<" + tag)
+			for _, a := range allowedAttributes(tag, t) {
+				if a.Name.Local == "src" && rewriteImage != nil {
+					a.Value = rewriteImage(a.Value)
+				}
+				if a.Name.Local == "href" && rewriteLink != nil {
+					a.Value = rewriteLink(a.Value)
+				}
+				fmt.Fprintf(&out, ` %s="%s"`, a.Name.Local, htmlEscape(a.Value))
+			}
+			if tag == "br" || tag == "img" {
+				out.WriteString("/>")
+				continue
+			}
+			out.WriteString(">")
+			open = append(open, tag)
+
+		case xml.EndElement:
+			name := strings.ToLower(t.Name.Local)
+			if skip != "" {
+				if name == skip {
+					skipDepth--
+					if skipDepth == 0 {
+						skip = ""
+					}
+				}
+				continue
+			}
+
+			tag, ok := allowedTags[name]
+			if !ok {
+				continue
+			}
+			// Close everything opened since the matching start tag
+			for i := len(open) - 1; i >= 0; i-- {
+				if open[i] != tag {
+					continue
+				}
+				for j := len(open) - 1; j >= i; j-- {
+					out.WriteString("</" + open[j] + ">")
+				}
+				open = open[:i]
+				break
+			}
+
+		case xml.CharData:
+			if skip == "" {
+				out.WriteString(htmlEscape(string(t)))
+			}
+		}
+	}
+
+	for i := len(open) - 1; i >= 0; i-- {
+		out.WriteString("</" + open[i] + ">")
+	}
+
+	return out.String(), true
+}
+
+// allowedAttributes returns the attributes kept for a sanitized tag
+func allowedAttributes(tag string, t xml.StartElement) []xml.Attr {
+	var attrs []xml.Attr
+
+	switch tag {
+	case "a":
+		// FB2 links use l:href or xlink:href
+		if href := attr(t, "href"); href != "" && safeURL(href, false) {
+			attrs = append(attrs, xml.Attr{Name: xml.Name{Local: "href"}, Value: href})
+		}
+	case "img":
+		src := attr(t, "src")
+		if src == "" {
+			src = attr(t, "href")
+		}
+		if src != "" && safeURL(src, true) {
+			attrs = append(attrs, xml.Attr{Name: xml.Name{Local: "src"}, Value: src})
+		}
+		if alt := attr(t, "alt"); alt != "" {
+			attrs = append(attrs, xml.Attr{Name: xml.Name{Local: "alt"}, Value: alt})
+		}
+	}
+
+	if class := attr(t, "class"); class != "" {
+		attrs = append(attrs, xml.Attr{Name: xml.Name{Local: "class"}, Value: class})
+	}
+
+	return attrs
+}
+
+// attr returns the value of the attribute with the given local name, ignoring its namespace
+func attr(t xml.StartElement, name string) string {
+	for _, a := range t.Attr {
+		if strings.EqualFold(a.Name.Local, name) {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// safeURL reports whether a link is a fragment, a relative path or an https URL.
+// Images may also use data URIs.
+func safeURL(link string, image bool) bool {
+	// Browsers ignore whitespace and control characters inside the scheme,
+	// and read backslashes as slashes ("\\host" is "//host")
+	normalized := strings.Map(func(r rune) rune {
+		if r <= ' ' || r == 0x7f {
+			return -1
+		}
+		if r == '\\' {
+			return '/'
+		}
+		return r
+	}, strings.ToLower(link))
+
+	if normalized == "" || strings.HasPrefix(normalized, "//") {
+		return false
+	}
+
+	i := strings.IndexAny(normalized, ":/?#")
+	if i < 0 || normalized[i] != ':' {
+		return true // Relative path or fragment
+	}
+
+	switch scheme := normalized[:i]; {
+	case scheme == "https":
+		return true
+	case scheme == "data" && image:
+		return strings.HasPrefix(normalized, "data:image/") && !strings.HasPrefix(normalized, "data:image/svg")
+	}
+	return false
+}
@@ -0,0 +1,115 @@
+package html
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestSafeURL(t *testing.T) {
+	tests := []struct {
+		url   string
+		image bool
+		want  bool
+	}{
+		{"#note1", false, true},
+		{"chapter2.xhtml#top", false, true},
+		{"images/map.png", true, true},
+		{"https://example.com/", false, true},
+		{"data:image/png;base64,iVBORw0KGgo=", true, true},
+
+		{"javascript:alert(1)", false, false},
+		{"JavaScript:alert(1)", false, false},
+		{" javascript:alert(1)", false, false},
+		{"java\tscript:alert(1)", false, false},
+		{"java\nscript:alert(1)", false, false},
+		{"java\x00script:alert(1)", false, false},
+		{"vbscript:msgbox(1)", false, false},
+		{"http://example.com/", false, false},
+		{"//evil.example/x.js", false, false},
+		{"\\\\evil.example/x.js", false, false},
+		{"/\\evil.example/x.js", false, false},
+		{"data:text/html;base64,PHNjcmlwdD4=", false, false},
+		{"data:text/html,<script>alert(1)</script>", true, false},
+		{"data:image/png;base64,iVBORw0KGgo=", false, false},
+		{"data:image/svg+xml;base64,PHN2Zz4=", true, false},
+		{"DATA:IMAGE/SVG+XML,<svg onload=alert(1)>", true, false},
+		{"data: image/svg+xml,<svg/>", true, false},
+		{"", false, false},
+	}
+	for _, tt := range tests {
+		if got := safeURL(tt.url, tt.image); got != tt.want {
+			t.Errorf("safeURL(%q, %v) = %v, want %v", tt.url, tt.image, got, tt.want)
+		}
+	}
+}
+
+func TestSanitizeHTMLBlocksXSS(t *testing.T) {
+	tests := []struct {
+		name, markup, want string
+	}{
+		{"script", `<p>a<script>alert(1)</script>b</p>`, `<p>ab</p>`},
+		{"script in capitals", `<p>a<SCRIPT>alert(1)</SCRIPT>b</p>`, `<p>ab</p>`},
+		{"nested scripts", `<p><script><script>x</script>alert(1)</script>b</p>`, `<p>b</p>`},
+		{"javascript link", `<a href="javascript:alert(1)">x</a>`, `<a>x</a>`},
+		{"entity-encoded scheme", `<a href="jav&#x61;script&#58;alert(1)">x</a>`, `<a>x</a>`},
+		{"entity-encoded tab", `<a href="java&#9;script:alert(1)">x</a>`, `<a>x</a>`},
+		{"named entity scheme", `<a href="javascript&colon;alert(1)">x</a>`, `<a href="javascript&amp;colon;alert(1)">x</a>`},
+		{"xlink javascript", `<a xmlns:l="http://www.w3.org/1999/xlink" l:href="javascript:alert(1)">x</a>`, `<a>x</a>`},
+		{"event attributes", `<p onclick="alert(1)"><img src="a.png" onerror="alert(1)" alt="A"/><a href="#n" onmouseover="alert(1)">x</a></p>`, `<p><img src="a.png" alt="A"/><a href="#n">x</a></p>`},
+		{"style attribute", `<span style="background:url(javascript:alert(1))">x</span>`, `<span>x</span>`},
+		{"svg data image", `<img src="data:image/svg+xml;base64,PHN2ZyBvbmxvYWQ9YWxlcnQoMSk+"/>`, `<img/>`},
+		{"inline svg", `<p><svg onload="alert(1)"><script>alert(1)</script></svg>x</p>`, `<p>x</p>`},
+		{"iframe", `<iframe src="https://evil.example/"></iframe><p>x</p>`, `<p>x</p>`},
+		{"object and embed", `<object data="x.swf"><embed src="x.swf"/></object><p>x</p>`, `<p>x</p>`},
+		{"cdata", `<p><![CDATA[<script>alert(1)</script>]]></p>`, `<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>`},
+		{"comment", `<p><!--<script>alert(1)</script>-->x</p>`, `<p>x</p>`},
+		{"quote in attribute", `<img src="a.png" alt="&quot; onerror=&quot;alert(1)"/>`, `<img src="a.png" alt="&quot; onerror=&quot;alert(1)"/>`},
+		{"text that looks like markup", `<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>`, `<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>`},
+		{"form", `<form action="https://evil.example/"><input name="pw"/></form>x`, `x`},
+		{"meta refresh", `<meta http-equiv="refresh" content="0;url=javascript:alert(1)"/>x`, `x`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := sanitizeHTML(tt.markup, nil, nil)
+			if !ok {
+				t.Fatalf("sanitizeHTML(%q) failed", tt.markup)
+			}
+			if got != tt.want {
+				t.Errorf("sanitizeHTML(%q)\n= %q\nwant %q", tt.markup, got, tt.want)
+			}
+			checkNoScript(t, got)
+		})
+	}
+}
+
+// checkNoScript fails if sanitized markup has a script element, an event
+// handler attribute or a javascript: URL
+func checkNoScript(t *testing.T, markup string) {
+	t.Helper()
+	d := xml.NewDecoder(strings.NewReader("<root>" + markup + "</root>"))
+	d.Entity = xml.HTMLEntity
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			t.Errorf("output is not well-formed: %v: %q", err, markup)
+			return
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if strings.EqualFold(start.Name.Local, "script") {
+			t.Errorf("output keeps a script: %q", markup)
+		}
+		for _, a := range start.Attr {
+			if strings.HasPrefix(strings.ToLower(a.Name.Local), "on") || strings.Contains(strings.ToLower(a.Value), "javascript:") {
+				t.Errorf("output keeps %s=%q: %q", a.Name.Local, a.Value, markup)
+			}
+		}
+	}
+}
@@ -0,0 +1,8 @@
+package json
+
+import "github.com/vpoluyaktov/biblio-ebook-parser/renderer"
+
+func init() {
+	// Register with the default configuration
+	renderer.Register("json", NewRenderer(Config{}))
+}
@@ -0,0 +1,390 @@
+// Package json renders parsed books as a stable, versioned JSON document.
+//
+// The document has the shape of Document:
+//
+//	{
+//	  "schemaVersion": "1",
+//	  "metadata": { "title": ..., "authors": [...], ... },
+//	  "wordCount": 12345,
+//	  "charCount": 67890,
+//	  "chapters": [
+//	    { "id": ..., "title": ..., "level": 0, "wordCount": ..., "charCount": ...,
+//	      "source": { "path": ..., "anchor": ..., "start": ..., "end": ... },
+//	      "elements": [ { "type": "paragraph", "text": ... }, ... ] }
+//	  ]
+//	}
+//
+// Element "type" is one of "paragraph", "heading", "image", "table",
+// "emptyLine", "epigraph" and "footnote". Fields that don't apply to an
+// element type are omitted. New fields may be added within a schema version;
+// renaming or removing fields bumps SchemaVersion.
+package json
+
+import (
+	"bytes"
+	stdjson "encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/vpoluyaktov/biblio-ebook-parser/parser"
+)
+
+// SchemaVersion identifies the layout of the rendered document
+const SchemaVersion = "1"
+
+// Renderer converts parsed books to JSON documents
+type Renderer struct {
+	Config Config
+}
+
+// Config holds configuration for JSON rendering
+type Config struct {
+	Pretty       bool // Indent the output
+	IncludeHTML  bool // Include original HTML of paragraphs and the description
+	IncludeCover bool // Include cover image bytes (base64) in the metadata
+}
+
+// NewRenderer creates a new JSON renderer
+func NewRenderer(config Config) *Renderer {
+	return &Renderer{Config: config}
+}
+
+// Document is the rendered JSON document
+type Document struct {
+	SchemaVersion string    `json:"schemaVersion"`
+	Metadata      Metadata  `json:"metadata"`
+	WordCount     int       `json:"wordCount"`
+	CharCount     int       `json:"charCount"`
+	Chapters      []Chapter `json:"chapters"`
+}
+
+// Metadata is the JSON rendition of parser.Metadata
+type Metadata struct {
+	Title           string        `json:"title"`
+	Authors         []Author      `json:"authors"`
+	Language        string        `json:"language,omitempty"`
+	Description     string        `json:"description,omitempty"`
+	DescriptionHTML string        `json:"descriptionHTML,omitempty"`
+	Genres          []string      `json:"genres,omitempty"`
+	Series          string        `json:"series,omitempty"`
+	SeriesIndex     int           `json:"seriesIndex,omitempty"`
+	Sequences       []Sequence    `json:"sequences,omitempty"`
+	Publisher       string        `json:"publisher,omitempty"`
+	PublishCity     string        `json:"publishCity,omitempty"`
+	PublicationDate string        `json:"publicationDate,omitempty"`
+	PublicationYear int           `json:"publicationYear,omitempty"`
+	ModifiedDate    string        `json:"modifiedDate,omitempty"`
+	Identifiers     []Identifier  `json:"identifiers,omitempty"`
+	DocumentInfo    *DocumentInfo `json:"documentInfo,omitempty"`
+	Cover           *Cover        `json:"cover,omitempty"`
+}
+
+// Author is a book author
+type Author struct {
+	FirstName   string `json:"firstName,omitempty"`
+	MiddleName  string `json:"middleName,omitempty"`
+	LastName    string `json:"lastName,omitempty"`
+	DisplayName string `json:"displayName,omitempty"`
+	FullName    string `json:"fullName"`
+}
+
+// Sequence is a series the book belongs to
+type Sequence struct {
+	Name      string `json:"name"`
+	Number    int    `json:"number,omitempty"`
+	Publisher bool   `json:"publisher,omitempty"`
+}
+
+// Identifier is a book identifier such as an ISBN
+type Identifier struct {
+	Scheme string `json:"scheme"`
+	Value  string `json:"value"`
+}
+
+// DocumentInfo describes the provenance of the electronic document
+type DocumentInfo struct {
+	ID          string   `json:"id,omitempty"`
+	Version     string   `json:"version,omitempty"`
+	Date        string   `json:"date,omitempty"`
+	Authors     []string `json:"authors,omitempty"`
+	ProgramUsed string   `json:"programUsed,omitempty"`
+	SrcURLs     []string `json:"srcUrls,omitempty"`
+	SrcOCR      string   `json:"srcOcr,omitempty"`
+}
+
+// Cover describes the cover image. Data is only set when Config.IncludeCover is enabled.
+type Cover struct {
+	Type   string `json:"type"`
+	Size   int    `json:"size"`
+	Width  int    `json:"width,omitempty"`  // In pixels, omitted if unknown
+	Height int    `json:"height,omitempty"` // In pixels, omitted if unknown
+	Data   []byte `json:"data,omitempty"`   // Encoded as base64
+}
+
+// Chapter is a chapter with its ordered elements
+type Chapter struct {
+	ID        string    `json:"id"`
+	Title     string    `json:"title"`
+	Level     int       `json:"level"`
+	Role      string    `json:"role,omitempty"`
+	WordCount int       `json:"wordCount"`
+	CharCount int       `json:"charCount"`
+	Source    *Source   `json:"source,omitempty"`
+	Elements  []Element `json:"elements"`
+}
+
+// Source locates a chapter in the original file, see parser.Chapter
+type Source struct {
+	Path   string `json:"path"`
+	Anchor string `json:"anchor,omitempty"`
+	Start  int    `json:"start,omitempty"`
+	End    int    `json:"end,omitempty"`
+}
+
+// Element is a typed content element
+type Element struct {
+	Type       string    `json:"type"`
+	Text       string    `json:"text,omitempty"`       // paragraph, heading, preformatted
+	HTML       string    `json:"html,omitempty"`       // paragraph, with Config.IncludeHTML
+	Level      int       `json:"level,omitempty"`      // heading
+	Alt        string    `json:"alt,omitempty"`        // image
+	Href       string    `json:"href,omitempty"`       // image
+	Caption    string    `json:"caption,omitempty"`    // table, image
+	Paragraphs []string  `json:"paragraphs,omitempty"` // epigraph, blockquote
+	Author     string    `json:"author,omitempty"`     // epigraph
+	ID         string    `json:"id,omitempty"`         // footnote
+	Label      string    `json:"label,omitempty"`      // footnote
+	Language   string    `json:"language,omitempty"`   // preformatted
+	Elements   []Element `json:"elements,omitempty"`   // footnote
+	Links      []Link    `json:"links,omitempty"`      // paragraph
+}
+
+// Link is a hyperlink over the bytes start to end of the UTF-8 text of a
+// paragraph. Internal links have an href of "#id".
+type Link struct {
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+	Href  string `json:"href"`
+}
+
+// RenderMetadata converts book metadata to a *Metadata value
+func (r *Renderer) RenderMetadata(book *parser.Book) (interface{}, error) {
+	metadata := r.metadata(book)
+	return &metadata, nil
+}
+
+// RenderContent renders the whole book and returns the JSON document as []byte
+func (r *Renderer) RenderContent(book *parser.Book) (interface{}, error) {
+	var buf bytes.Buffer
+	if err := r.RenderTo(&buf, book); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// RenderTo writes the JSON document to w one chapter at a time, so the whole
+// document never has to be held in memory
+func (r *Renderer) RenderTo(w io.Writer, book *parser.Book) error {
+	nl, indent := "", ""
+	if r.Config.Pretty {
+		nl, indent = "\n", "  "
+	}
+
+	metadata, err := r.marshal(r.metadata(book), indent)
+	if err != nil {
+		return err
+	}
+
+	// Field order must match Document
+	if _, err := fmt.Fprintf(w, "{%s%s\"schemaVersion\": %q,%s%s\"metadata\": %s,%s%s\"wordCount\": %d,%s%s\"charCount\": %d,%s%s\"chapters\": [",
+		nl, indent, SchemaVersion, nl,
+		indent, metadata, nl,
+		indent, book.GetTotalWords(), nl,
+		indent, book.GetTotalCharacters(), nl,
+		indent); err != nil {
+		return fmt.Errorf("failed to write JSON: %w", err)
+	}
+
+	for i, ch := range book.Content.Chapters {
+		chapter, err := r.marshal(r.chapter(ch), indent+indent)
+		if err != nil {
+			return err
+		}
+		sep := ""
+		if i > 0 {
+			sep = ","
+		}
+		if _, err := fmt.Fprintf(w, "%s%s%s%s", sep, nl, indent+indent, chapter); err != nil {
+			return fmt.Errorf("failed to write JSON: %w", err)
+		}
+	}
+
+	closing := "]}"
+	if r.Config.Pretty {
+		closing = "]\n}\n"
+		if len(book.Content.Chapters) > 0 {
+			closing = "\n" + indent + "]\n}\n"
+		}
+	}
+	if _, err := io.WriteString(w, closing); err != nil {
+		return fmt.Errorf("failed to write JSON: %w", err)
+	}
+
+	return nil
+}
+
+// marshal encodes v, indented as if nested at the given prefix in pretty mode
+func (r *Renderer) marshal(v interface{}, prefix string) ([]byte, error) {
+	var data []byte
+	var err error
+	if r.Config.Pretty {
+		data, err = stdjson.MarshalIndent(v, prefix, "  ")
+	} else {
+		data, err = stdjson.Marshal(v)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode JSON: %w", err)
+	}
+	return data, nil
+}
+
+func (r *Renderer) metadata(book *parser.Book) Metadata {
+	m := book.Metadata
+	metadata := Metadata{
+		Title:           m.Title,
+		Authors:         make([]Author, len(m.Authors)),
+		Language:        m.Language,
+		Description:     m.Description,
+		Genres:          m.Genres,
+		Series:          m.Series,
+		SeriesIndex:     m.SeriesIndex,
+		Publisher:       m.Publisher,
+		PublishCity:     m.PublishCity,
+		PublicationDate: m.PublicationDate,
+		PublicationYear: m.PublicationYear,
+		ModifiedDate:    m.ModifiedDate,
+	}
+
+	if r.Config.IncludeHTML {
+		metadata.DescriptionHTML = m.DescriptionHTML
+	}
+
+	for i, a := range m.Authors {
+		metadata.Authors[i] = Author{
+			FirstName:   a.FirstName,
+			MiddleName:  a.MiddleName,
+			LastName:    a.LastName,
+			DisplayName: a.DisplayName,
+			FullName:    a.FullName(),
+		}
+	}
+
+	for _, seq := range m.Sequences {
+		metadata.Sequences = append(metadata.Sequences, Sequence(seq))
+	}
+
+	for _, id := range m.Identifiers {
+		metadata.Identifiers = append(metadata.Identifiers, Identifier(id))
+	}
+
+	if info := m.DocumentInfo; info != nil {
+		metadata.DocumentInfo = &DocumentInfo{
+			ID:          info.ID,
+			Version:     info.Version,
+			Date:        info.Date,
+			Authors:     info.Authors,
+			ProgramUsed: info.ProgramUsed,
+			SrcURLs:     info.SrcURLs,
+			SrcOCR:      info.SrcOCR,
+		}
+	}
+
+	if m.CoverData != nil {
+		metadata.Cover = &Cover{Type: m.CoverType, Size: len(m.CoverData), Width: m.CoverWidth, Height: m.CoverHeight}
+		if r.Config.IncludeCover {
+			metadata.Cover.Data = m.CoverData
+		}
+	}
+
+	return metadata
+}
+
+func (r *Renderer) chapter(ch parser.Chapter) Chapter {
+	chapter := Chapter{
+		ID:       ch.ID,
+		Title:    ch.Title,
+		Level:    ch.Level,
+		Role:     ch.Role,
+		Elements: r.elements(ch.Elements),
+	}
+	if ch.SourcePath != "" {
+		chapter.Source = &Source{
+			Path:   ch.SourcePath,
+			Anchor: ch.SourceAnchor,
+			Start:  ch.SourceStart,
+			End:    ch.SourceEnd,
+		}
+	}
+	for _, elem := range ch.Elements {
+		chapter.WordCount += elem.WordCount()
+		chapter.CharCount += elem.CharCount()
+	}
+	return chapter
+}
+
+func (r *Renderer) elements(elements []parser.Element) []Element {
+	result := make([]Element, 0, len(elements))
+
+	for _, elem := range elements {
+		switch e := elem.(type) {
+		case *parser.Paragraph:
+			el := Element{Type: "paragraph", Text: e.Text}
+			if r.Config.IncludeHTML {
+				el.HTML = e.HTML
+			}
+			for _, link := range e.Links {
+				el.Links = append(el.Links, Link{Start: link.Start, End: link.End, Href: link.Href})
+			}
+			result = append(result, el)
+
+		case *parser.Heading:
+			result = append(result, Element{Type: "heading", Text: e.Text, Level: e.Level})
+
+		case *parser.Image:
+			result = append(result, Element{Type: "image", Alt: e.Alt, Href: e.Href, Caption: e.Caption})
+
+		case *parser.Table:
+			result = append(result, Element{Type: "table", Caption: e.Caption})
+
+		case *parser.EmptyLine:
+			result = append(result, Element{Type: "emptyLine"})
+
+		case *parser.Epigraph:
+			el := Element{Type: "epigraph", Author: e.Author}
+			for _, p := range e.Paragraphs {
+				el.Paragraphs = append(el.Paragraphs, p.Text)
+			}
+			result = append(result, el)
+
+		case *parser.Blockquote:
+			el := Element{Type: "blockquote"}
+			for _, p := range e.Paragraphs {
+				el.Paragraphs = append(el.Paragraphs, p.Text)
+			}
+			result = append(result, el)
+
+		case *parser.Preformatted:
+			result = append(result, Element{Type: "preformatted", Text: e.Text, Language: e.Language})
+
+		case *parser.Footnote:
+			result = append(result, Element{
+				Type:     "footnote",
+				ID:       e.ID,
+				Label:    e.Label,
+				Elements: r.elements(e.Elements),
+			})
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,9 @@
+package markdown
+
+import "github.com/vpoluyaktov/biblio-ebook-parser/renderer"
+
+func init() {
+	// Register with the default configuration
+	renderer.Register("markdown", NewRenderer(Config{}))
+	renderer.Register("md", NewRenderer(Config{}))
+}
@@ -0,0 +1,376 @@
+package markdown
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/vpoluyaktov/biblio-ebook-parser/parser"
+)
+
+// Flavor selects the Markdown dialect the output targets
+type Flavor int
+
+const (
+	// FlavorCommonMark emits plain CommonMark: backslash hard line breaks, notes as blockquotes
+	FlavorCommonMark Flavor = iota
+	// FlavorGitHub emits GitHub Flavored Markdown: two-space hard line breaks, [^note] footnotes
+	FlavorGitHub
+)
+
+// Renderer converts parsed books to Markdown for static-site generators
+type Renderer struct {
+	Config Config
+}
+
+// Config holds configuration for Markdown rendering
+type Config struct {
+	Flavor           Flavor
+	FrontMatter      bool   // Start the document rendered by Render with YAML front matter
+	ChapterSeparator string // Markdown placed between chapters, e.g. "---"; empty for none
+	ChapterHeadings  bool   // Add the chapter title as a heading when the chapter doesn't start with one
+}
+
+// NewRenderer creates a new Markdown renderer
+func NewRenderer(config Config) *Renderer {
+	return &Renderer{Config: config}
+}
+
+// BookContent represents Markdown-formatted book content, one entry per chapter
+type BookContent struct {
+	Title    string    `json:"title"`
+	Author   string    `json:"author"`
+	Format   string    `json:"format"`
+	Chapters []Chapter `json:"chapters"`
+}
+
+// Chapter represents a Markdown chapter
+type Chapter struct {
+	ID      string `json:"id"`
+	Title   string `json:"title"`
+	Content string `json:"content"`
+}
+
+// RenderMetadata returns the book metadata as YAML front matter, including the --- delimiters
+func (r *Renderer) RenderMetadata(book *parser.Book) (interface{}, error) {
+	return r.frontMatter(book), nil
+}
+
+// RenderContent converts book content to Markdown, one string per chapter
+func (r *Renderer) RenderContent(book *parser.Book) (interface{}, error) {
+	content := &BookContent{
+		Title:    book.Metadata.Title,
+		Format:   "markdown",
+		Chapters: make([]Chapter, 0, len(book.Content.Chapters)),
+	}
+
+	if len(book.Metadata.Authors) > 0 {
+		content.Author = book.Metadata.Authors[0].FullName()
+	}
+
+	for _, ch := range book.Content.Chapters {
+		content.Chapters = append(content.Chapters, Chapter{
+			ID:      ch.ID,
+			Title:   ch.Title,
+			Content: r.chapterToMarkdown(ch),
+		})
+	}
+
+	return content, nil
+}
+
+// Render converts the whole book to a single Markdown document
+func (r *Renderer) Render(book *parser.Book) (string, error) {
+	var md strings.Builder
+	if err := r.RenderTo(&md, book); err != nil {
+		return "", err
+	}
+	return md.String(), nil
+}
+
+// RenderTo writes the same document as Render to w one chapter at a time,
+// so the whole document never has to be held in memory
+func (r *Renderer) RenderTo(w io.Writer, book *parser.Book) error {
+	// Trailing newlines are held back so the document ends with exactly one
+	pending := ""
+	write := func(s string) error {
+		trimmed := strings.TrimRight(s, "\n")
+		if trimmed != "" {
+			if _, err := io.WriteString(w, pending+trimmed); err != nil {
+				return fmt.Errorf("failed to write Markdown: %w", err)
+			}
+			pending = ""
+		}
+		pending += s[len(trimmed):]
+		return nil
+	}
+
+	if r.Config.FrontMatter {
+		if err := write(r.frontMatter(book) + "\n"); err != nil {
+			return err
+		}
+	}
+
+	for i, ch := range book.Content.Chapters {
+		if i > 0 && r.Config.ChapterSeparator != "" {
+			if err := write(r.Config.ChapterSeparator + "\n\n"); err != nil {
+				return err
+			}
+		}
+		if chapter := r.chapterToMarkdown(ch); chapter != "" {
+			if err := write(chapter + "\n\n"); err != nil {
+				return err
+			}
+		}
+	}
+
+	if _, err := io.WriteString(w, "\n"); err != nil {
+		return fmt.Errorf("failed to write Markdown: %w", err)
+	}
+	return nil
+}
+
+func (r *Renderer) frontMatter(book *parser.Book) string {
+	var fm strings.Builder
+
+	fm.WriteString("---\n")
+	fmt.Fprintf(&fm, "title: %s\n", strconv.Quote(book.Metadata.Title))
+	if len(book.Metadata.Authors) > 0 {
+		fm.WriteString("authors:\n")
+		for _, author := range book.Metadata.Authors {
+			fmt.Fprintf(&fm, "  - %s\n", strconv.Quote(author.FullName()))
+		}
+	}
+	if book.Metadata.Series != "" {
+		fmt.Fprintf(&fm, "series: %s\n", strconv.Quote(book.Metadata.Series))
+		if book.Metadata.SeriesIndex > 0 {
+			fmt.Fprintf(&fm, "seriesIndex: %d\n", book.Metadata.SeriesIndex)
+		}
+	}
+	if book.Metadata.Language != "" {
+		fmt.Fprintf(&fm, "language: %s\n", strconv.Quote(book.Metadata.Language))
+	}
+	fm.WriteString("---\n")
+
+	return fm.String()
+}
+
+func (r *Renderer) chapterToMarkdown(ch parser.Chapter) string {
+	elements := ch.Elements
+	if r.Config.ChapterHeadings && ch.Title != "" {
+		if len(elements) == 0 || elements[0].Type() != parser.ElementTypeHeading {
+			heading := &parser.Heading{Text: ch.Title, Level: 2}
+			elements = append([]parser.Element{heading}, elements...)
+		}
+	}
+	return r.elementsToMarkdown(elements)
+}
+
+func (r *Renderer) elementsToMarkdown(elements []parser.Element) string {
+	var blocks []string
+	var notes []*parser.Footnote
+
+	block := func(s string) {
+		blocks = append(blocks, s)
+	}
+
+	for _, elem := range elements {
+		switch e := elem.(type) {
+		case *parser.Heading:
+			level := e.Level
+			if level < 1 {
+				level = 1
+			}
+			if level > 6 {
+				level = 6
+			}
+			text := strings.Join(strings.Fields(e.Text), " ")
+			if text != "" {
+				block(strings.Repeat("#", level) + " " + escapeInline(text))
+			}
+
+		case *parser.Paragraph:
+			if text := r.lines(e.Text); text != "" {
+				block(text)
+			}
+
+		case *parser.Image:
+			if e.Href != "" {
+				block(fmt.Sprintf("![%s](<%s>)", escapeInline(e.Alt), e.Href))
+			} else if e.Alt != "" {
+				block(fmt.Sprintf("*[Image: %s]*", escapeInline(e.Alt)))
+			} else {
+				block("*[Image]*")
+			}
+
+		case *parser.Table:
+			if e.Caption != "" {
+				block(fmt.Sprintf("*[Table: %s]*", escapeInline(e.Caption)))
+			} else {
+				block("*[Table]*")
+			}
+
+		case *parser.EmptyLine:
+			// Paragraphs are already separated by blank lines
+
+		case *parser.Epigraph:
+			var quote []string
+			for _, p := range e.Paragraphs {
+				if text := r.lines(p.Text); text != "" {
+					quote = append(quote, text)
+				}
+			}
+			if e.Author != "" {
+				quote = append(quote, "*— "+escapeInline(e.Author)+"*")
+			}
+			if len(quote) > 0 {
+				block(blockquote(strings.Join(quote, "\n\n")))
+			}
+
+		case *parser.Blockquote:
+			var quote []string
+			for _, p := range e.Paragraphs {
+				if text := r.lines(p.Text); text != "" {
+					quote = append(quote, text)
+				}
+			}
+			if len(quote) > 0 {
+				block(blockquote(strings.Join(quote, "\n\n")))
+			}
+
+		case *parser.Preformatted:
+			if code := strings.TrimRight(e.Text, "\n"); code != "" {
+				fence := codeFence(code)
+				block(fence + e.Language + "\n" + code + "\n" + fence)
+			}
+
+		case *parser.Footnote:
+			if r.Config.Flavor == FlavorGitHub {
+				// Reference the note from the paragraph it follows and
+				// collect its definition for the end of the chapter
+				if len(blocks) > 0 && e.Text() != "" {
+					blocks[len(blocks)-1] += "[^" + footnoteLabel(e) + "]"
+					notes = append(notes, e)
+				}
+				continue
+			}
+			if text := r.lines(e.Text()); text != "" {
+				if e.Label != "" {
+					text = "**" + escapeInline(e.Label) + "** " + text
+				}
+				block(blockquote(text))
+			}
+		}
+	}
+
+	for _, note := range notes {
+		text := r.lines(note.Text())
+		if text == "" {
+			continue
+		}
+		// Continuation lines of a footnote definition are indented
+		block(fmt.Sprintf("[^%s]: %s", footnoteLabel(note), strings.ReplaceAll(text, "\n", "\n    ")))
+	}
+
+	return strings.Join(blocks, "\n\n")
+}
+
+// lines escapes paragraph text and turns its newlines into hard line breaks
+func (r *Renderer) lines(text string) string {
+	var parts []string
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			parts = append(parts, escapeLine(line))
+		}
+	}
+
+	lineBreak := "\\\n"
+	if r.Config.Flavor == FlavorGitHub {
+		lineBreak = "  \n"
+	}
+	return strings.Join(parts, lineBreak)
+}
+
+func blockquote(s string) string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		if line == "" {
+			lines[i] = ">"
+		} else {
+			lines[i] = "> " + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// codeFence returns a backtick fence longer than any backtick run in code
+func codeFence(code string) string {
+	longest, run := 0, 0
+	for _, c := range code {
+		if c == '`' {
+			run++
+			if run > longest {
+				longest = run
+			}
+		} else {
+			run = 0
+		}
+	}
+	if longest < 3 {
+		return "```"
+	}
+	return strings.Repeat("`", longest+1)
+}
+
+// footnoteLabel returns a label usable in a [^label] reference
+func footnoteLabel(note *parser.Footnote) string {
+	label := note.ID
+	if label == "" {
+		label = note.Label
+	}
+	return strings.Map(func(r rune) rune {
+		if r == ' ' || r == ']' || r == '[' || r == '^' {
+			return '-'
+		}
+		return r
+	}, label)
+}
+
+// escapeLine escapes inline markup and characters that would start a block
+// construct (heading, list, quote, thematic break) at the beginning of a line
+func escapeLine(s string) string {
+	s = escapeInline(s)
+
+	switch s[0] {
+	case '#', '>', '+', '-', '=', '|':
+		return "\\" + s
+	}
+
+	// Ordered list markers: digits followed by "." or ")"
+	digits := 0
+	for digits < len(s) && digits < 9 && s[digits] >= '0' && s[digits] <= '9' {
+		digits++
+	}
+	if digits > 0 && digits < len(s) && (s[digits] == '.' || s[digits] == ')') {
+		return s[:digits] + "\\" + s[digits:]
+	}
+
+	return s
+}
+
+var inlineEscaper = strings.NewReplacer(
+	"\\", "\\\\",
+	"*", "\\*",
+	"_", "\\_",
+	"`", "\\`",
+	"[", "\\[",
+	"]", "\\]",
+	"<", "\\<",
+	">", "\\>",
+)
+
+// escapeInline escapes characters that have inline meaning in Markdown
+func escapeInline(s string) string {
+	return inlineEscaper.Replace(s)
+}
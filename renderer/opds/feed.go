@@ -0,0 +1,91 @@
+package opds
+
+import (
+	"encoding/xml"
+	"time"
+)
+
+// Feed is an OPDS acquisition feed
+type Feed struct {
+	XMLName         xml.Name `xml:"feed"`
+	Xmlns           string   `xml:"xmlns,attr"`
+	XmlnsDC         string   `xml:"xmlns:dc,attr"`
+	XmlnsOPDS       string   `xml:"xmlns:opds,attr"`
+	XmlnsOpenSearch string   `xml:"xmlns:opensearch,attr"`
+	XmlnsOPF        string   `xml:"xmlns:opf,attr"`
+	ID              string   `xml:"id"`
+	Title           string   `xml:"title"`
+	Updated         string   `xml:"updated"`
+	Authors         []Author `xml:"author"`
+	Links           []Link   `xml:"link"`
+	TotalResults    int      `xml:"opensearch:totalResults,omitempty"`
+	ItemsPerPage    int      `xml:"opensearch:itemsPerPage,omitempty"`
+	StartIndex      int      `xml:"opensearch:startIndex,omitempty"`
+	Entries         []*Entry `xml:"entry"`
+}
+
+// FeedOptions describes an acquisition feed and its place in a paged listing
+type FeedOptions struct {
+	ID      string
+	Title   string
+	Author  string    // Feed author, e.g. the library name
+	Updated time.Time // Last update time, now if zero
+
+	SelfURL     string // URL of this page
+	StartURL    string // URL of the catalog root
+	FirstURL    string // Paging links, omitted if empty
+	PreviousURL string
+	NextURL     string
+	LastURL     string
+
+	TotalResults int // Number of entries across all pages, 0 if not paged
+	ItemsPerPage int
+	StartIndex   int // Index of the first entry on this page, starting at 1
+}
+
+// NewFeed builds an acquisition feed holding the given entries
+func NewFeed(opts FeedOptions, entries []*Entry) *Feed {
+	feed := &Feed{
+		Xmlns:           NamespaceAtom,
+		XmlnsDC:         NamespaceDC,
+		XmlnsOPDS:       NamespaceOPDS,
+		XmlnsOpenSearch: NamespaceOpenSearch,
+		XmlnsOPF:        NamespaceOPF,
+		ID:              opts.ID,
+		Title:           opts.Title,
+		Updated:         formatTime(opts.Updated),
+		TotalResults:    opts.TotalResults,
+		ItemsPerPage:    opts.ItemsPerPage,
+		StartIndex:      opts.StartIndex,
+		Entries:         entries,
+	}
+
+	if opts.Author != "" {
+		feed.Authors = []Author{{Name: opts.Author}}
+	}
+
+	for _, link := range []Link{
+		{Rel: "self", Href: opts.SelfURL},
+		{Rel: "start", Href: opts.StartURL},
+		{Rel: "first", Href: opts.FirstURL},
+		{Rel: "previous", Href: opts.PreviousURL},
+		{Rel: "next", Href: opts.NextURL},
+		{Rel: "last", Href: opts.LastURL},
+	} {
+		if link.Href == "" {
+			continue
+		}
+		link.Type = TypeAcquisitionFeed
+		if link.Rel == "start" {
+			link.Type = TypeNavigationFeed
+		}
+		feed.Links = append(feed.Links, link)
+	}
+
+	return feed
+}
+
+// Marshal encodes the feed as an XML document
+func (f *Feed) Marshal() ([]byte, error) {
+	return marshal(f)
+}
@@ -0,0 +1,270 @@
+// Package opds builds OPDS 1.2 catalog entries and acquisition feeds from
+// parsed book metadata.
+package opds
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/vpoluyaktov/biblio-ebook-parser/cover"
+	"github.com/vpoluyaktov/biblio-ebook-parser/parser"
+)
+
+// XML namespaces used in OPDS documents
+const (
+	NamespaceAtom       = "http://www.w3.org/2005/Atom"
+	NamespaceDC         = "http://purl.org/dc/terms/"
+	NamespaceOPDS       = "http://opds-spec.org/2010/catalog"
+	NamespaceOpenSearch = "http://a9.com/-/spec/opensearch/1.1/"
+	NamespaceOPF        = "http://www.idpf.org/2007/opf"
+)
+
+// Link relations and types
+const (
+	RelAcquisition = "http://opds-spec.org/acquisition"
+	RelImage       = "http://opds-spec.org/image"
+	RelThumbnail   = "http://opds-spec.org/image/thumbnail"
+
+	TypeAcquisitionFeed = "application/atom+xml;profile=opds-catalog;kind=acquisition"
+	TypeNavigationFeed  = "application/atom+xml;profile=opds-catalog;kind=navigation"
+)
+
+// Default thumbnail bounds in pixels
+const (
+	DefaultThumbnailWidth  = 160
+	DefaultThumbnailHeight = 240
+)
+
+// formatTypes maps format identifiers to MIME types for acquisition links
+var formatTypes = map[string]string{
+	"epub":     "application/epub+zip",
+	"epub.zip": "application/epub+zip",
+	"fb2":      "application/x-fictionbook+xml",
+	"fb2.zip":  "application/x-zip-compressed-fb2",
+	"fb2.gz":   "application/x-gzip-compressed-fb2",
+	"mobi":     "application/x-mobipocket-ebook",
+	"azw3":     "application/vnd.amazon.ebook",
+	"pdf":      "application/pdf",
+	"txt":      "text/plain",
+	"html":     "text/html",
+	"cbz":      "application/vnd.comicbook+zip",
+}
+
+// Entry is an OPDS catalog entry for a single book
+type Entry struct {
+	XMLName xml.Name `xml:"entry"`
+
+	// Namespace declarations, set when the entry is marshaled on its own
+	Xmlns    string `xml:"xmlns,attr,omitempty"`
+	XmlnsDC  string `xml:"xmlns:dc,attr,omitempty"`
+	XmlnsOPF string `xml:"xmlns:opf,attr,omitempty"`
+
+	Title       string     `xml:"title"`
+	ID          string     `xml:"id"`
+	Updated     string     `xml:"updated"`
+	Authors     []Author   `xml:"author"`
+	Language    string     `xml:"dc:language,omitempty"`
+	Publisher   string     `xml:"dc:publisher,omitempty"`
+	Issued      string     `xml:"dc:issued,omitempty"`
+	Identifiers []string   `xml:"dc:identifier"`
+	Categories  []Category `xml:"category"`
+	Summary     *Text      `xml:"summary"`
+	Links       []Link     `xml:"link"`
+}
+
+// Author is an Atom person with the sort form of the name
+type Author struct {
+	FileAs string `xml:"opf:file-as,attr,omitempty"`
+	Name   string `xml:"name"`
+}
+
+// Category is an Atom category, used for genres
+type Category struct {
+	Term  string `xml:"term,attr"`
+	Label string `xml:"label,attr,omitempty"`
+}
+
+// Text is an Atom text construct
+type Text struct {
+	Type  string `xml:"type,attr,omitempty"`
+	Value string `xml:",chardata"`
+}
+
+// Link is an Atom link
+type Link struct {
+	Rel   string `xml:"rel,attr,omitempty"`
+	Href  string `xml:"href,attr"`
+	Type  string `xml:"type,attr,omitempty"`
+	Title string `xml:"title,attr,omitempty"`
+}
+
+// EntryOptions holds the parts of an entry that don't come from the book
+type EntryOptions struct {
+	ID      string    // Entry ID, derived from the book identifiers if empty
+	Updated time.Time // Last update time, now if zero
+
+	Formats        []string                   // Formats the book is available in (e.g., "epub", "fb2.zip") or MIME types
+	AcquisitionURL func(format string) string // Returns the download URL for a format, "" to skip it
+
+	CoverURL        string // Link to the full-size cover
+	ThumbnailURL    string // Link to the thumbnail, otherwise it is inlined as a data URI from CoverData
+	ThumbnailWidth  int    // Bounds of an inlined thumbnail, DefaultThumbnailWidth if 0
+	ThumbnailHeight int    // Bounds of an inlined thumbnail, DefaultThumbnailHeight if 0
+}
+
+// NewEntry builds a catalog entry from book metadata
+func NewEntry(m *parser.Metadata, opts EntryOptions) (*Entry, error) {
+	entry := &Entry{
+		Title:     m.Title,
+		ID:        opts.ID,
+		Updated:   formatTime(opts.Updated),
+		Language:  m.Language,
+		Publisher: m.Publisher,
+		Issued:    m.PublicationDate,
+	}
+
+	if entry.ID == "" {
+		entry.ID = entryID(m)
+	}
+
+	for _, a := range m.Authors {
+		if a.IsEmpty() {
+			continue
+		}
+		entry.Authors = append(entry.Authors, Author{Name: a.FullName(), FileAs: a.SortName()})
+	}
+
+	for _, id := range m.Identifiers {
+		entry.Identifiers = append(entry.Identifiers, identifierURN(id))
+	}
+
+	for _, genre := range m.Genres {
+		entry.Categories = append(entry.Categories, Category{Term: genre, Label: genre})
+	}
+
+	if m.Description != "" {
+		entry.Summary = &Text{Type: "text", Value: m.Description}
+	}
+
+	if opts.CoverURL != "" {
+		entry.Links = append(entry.Links, Link{Rel: RelImage, Href: opts.CoverURL, Type: m.CoverType})
+	}
+
+	switch {
+	case opts.ThumbnailURL != "":
+		entry.Links = append(entry.Links, Link{Rel: RelThumbnail, Href: opts.ThumbnailURL, Type: "image/jpeg"})
+	case len(m.CoverData) > 0:
+		width, height := opts.ThumbnailWidth, opts.ThumbnailHeight
+		if width <= 0 {
+			width = DefaultThumbnailWidth
+		}
+		if height <= 0 {
+			height = DefaultThumbnailHeight
+		}
+		thumbnail, err := cover.Thumbnail(m.CoverData, width, height)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create thumbnail: %w", err)
+		}
+		entry.Links = append(entry.Links, Link{
+			Rel:  RelThumbnail,
+			Href: "data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(thumbnail),
+			Type: "image/jpeg",
+		})
+	}
+
+	if opts.AcquisitionURL != nil {
+		for _, format := range opts.Formats {
+			href := opts.AcquisitionURL(format)
+			if href == "" {
+				continue
+			}
+			entry.Links = append(entry.Links, Link{Rel: RelAcquisition, Href: href, Type: formatType(format)})
+		}
+	}
+
+	return entry, nil
+}
+
+// NewBookEntry builds a catalog entry for a book, using the text fingerprint
+// as the ID when the book has no identifiers
+func NewBookEntry(book *parser.Book, opts EntryOptions) (*Entry, error) {
+	if opts.ID == "" && len(book.Metadata.Identifiers) == 0 {
+		opts.ID = "urn:fingerprint:" + book.Fingerprint()
+	}
+	return NewEntry(&book.Metadata, opts)
+}
+
+// Marshal encodes the entry as a standalone XML document
+func (e *Entry) Marshal() ([]byte, error) {
+	standalone := *e
+	standalone.Xmlns = NamespaceAtom
+	standalone.XmlnsDC = NamespaceDC
+	standalone.XmlnsOPF = NamespaceOPF
+	return marshal(&standalone)
+}
+
+// entryID derives a stable entry ID from the book identifiers, or from the
+// title and authors if there are none
+func entryID(m *parser.Metadata) string {
+	for _, scheme := range []string{"uuid", "isbn"} {
+		for _, id := range m.Identifiers {
+			if id.Scheme == scheme {
+				return identifierURN(id)
+			}
+		}
+	}
+	if len(m.Identifiers) > 0 {
+		return identifierURN(m.Identifiers[0])
+	}
+
+	hash := sha1.New()
+	hash.Write([]byte(m.Title))
+	for _, a := range m.Authors {
+		hash.Write([]byte{0})
+		hash.Write([]byte(a.FullName()))
+	}
+	return "urn:sha1:" + hex.EncodeToString(hash.Sum(nil))
+}
+
+// identifierURN returns the identifier as a URN (e.g., "urn:isbn:9780000000000")
+func identifierURN(id parser.Identifier) string {
+	value := id.Value
+	if strings.HasPrefix(strings.ToLower(value), "urn:") || strings.Contains(value, "://") {
+		return value
+	}
+	if id.Scheme == "" {
+		return value
+	}
+	return "urn:" + id.Scheme + ":" + value
+}
+
+// formatType returns the MIME type for a format identifier
+func formatType(format string) string {
+	if strings.Contains(format, "/") {
+		return format
+	}
+	if mime, ok := formatTypes[strings.ToLower(format)]; ok {
+		return mime
+	}
+	return "application/octet-stream"
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		t = time.Now()
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func marshal(v interface{}) ([]byte, error) {
+	data, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode OPDS: %w", err)
+	}
+	return append([]byte(xml.Header), append(data, '\n')...), nil
+}
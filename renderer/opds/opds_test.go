@@ -0,0 +1,266 @@
+package opds_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vpoluyaktov/biblio-ebook-parser/parser"
+	"github.com/vpoluyaktov/biblio-ebook-parser/renderer/opds"
+)
+
+// The documents are read back with the namespaces resolved, as a client
+// would read them
+
+type atomEntry struct {
+	Title    string `xml:"http://www.w3.org/2005/Atom title"`
+	ID       string `xml:"http://www.w3.org/2005/Atom id"`
+	Updated  string `xml:"http://www.w3.org/2005/Atom updated"`
+	Language string `xml:"http://purl.org/dc/terms/ language"`
+	Issued   string `xml:"http://purl.org/dc/terms/ issued"`
+	Authors  []struct {
+		FileAs string `xml:"http://www.idpf.org/2007/opf file-as,attr"`
+		Name   string `xml:"http://www.w3.org/2005/Atom name"`
+	} `xml:"http://www.w3.org/2005/Atom author"`
+	Identifiers []string `xml:"http://purl.org/dc/terms/ identifier"`
+	Categories  []struct {
+		Term string `xml:"term,attr"`
+	} `xml:"http://www.w3.org/2005/Atom category"`
+	Summary struct {
+		Type  string `xml:"type,attr"`
+		Value string `xml:",chardata"`
+	} `xml:"http://www.w3.org/2005/Atom summary"`
+	Links []atomLink `xml:"http://www.w3.org/2005/Atom link"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr"`
+	Href string `xml:"href,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type atomFeed struct {
+	XMLName      xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID           string      `xml:"http://www.w3.org/2005/Atom id"`
+	Title        string      `xml:"http://www.w3.org/2005/Atom title"`
+	Author       string      `xml:"http://www.w3.org/2005/Atom author>name"`
+	Links        []atomLink  `xml:"http://www.w3.org/2005/Atom link"`
+	TotalResults int         `xml:"http://a9.com/-/spec/opensearch/1.1/ totalResults"`
+	ItemsPerPage int         `xml:"http://a9.com/-/spec/opensearch/1.1/ itemsPerPage"`
+	StartIndex   int         `xml:"http://a9.com/-/spec/opensearch/1.1/ startIndex"`
+	Entries      []atomEntry `xml:"http://www.w3.org/2005/Atom entry"`
+}
+
+var updated = time.Date(2024, 1, 2, 3, 4, 5, 0, time.FixedZone("", 3*3600))
+
+func coverPNG(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 600, 900))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func metadata(t *testing.T) *parser.Metadata {
+	m := &parser.Metadata{
+		Title:           `Tom & Jerry <"Book">`,
+		Authors:         []parser.Author{{FirstName: "Лев", LastName: "Толстой"}, {}},
+		Language:        "ru",
+		Description:     "About <b>cats</b> & mice.",
+		Genres:          []string{"prose_classic"},
+		PublicationDate: "1869",
+		Identifiers: []parser.Identifier{
+			{Scheme: "isbn", Value: "9780000000002"},
+			{Scheme: "uuid", Value: "urn:uuid:0000-1111"},
+		},
+	}
+	m.SetCover(coverPNG(t), "image/png")
+	return m
+}
+
+func entryOptions() opds.EntryOptions {
+	return opds.EntryOptions{
+		Updated:  updated,
+		Formats:  []string{"epub", "fb2.zip", "application/x-custom", "pdf"},
+		CoverURL: "/covers/1.png",
+		AcquisitionURL: func(format string) string {
+			if format == "pdf" {
+				return ""
+			}
+			return "/books/1?format=" + format
+		},
+	}
+}
+
+func TestEntryXML(t *testing.T) {
+	entry, err := opds.NewEntry(metadata(t), entryOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := entry.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(data, []byte(xml.Header)) {
+		t.Errorf("no XML declaration:\n%s", data)
+	}
+
+	var got atomEntry
+	if err := xml.Unmarshal(data, &got); err != nil {
+		t.Fatalf("%v\n%s", err, data)
+	}
+	if got.Title != `Tom & Jerry <"Book">` || got.Language != "ru" || got.Issued != "1869" {
+		t.Errorf("title, language, issued = %q, %q, %q", got.Title, got.Language, got.Issued)
+	}
+	if got.Updated != "2024-01-02T00:04:05Z" {
+		t.Errorf("updated = %q, want UTC RFC 3339", got.Updated)
+	}
+	// The uuid wins as the id; an empty author is left out
+	if got.ID != "urn:uuid:0000-1111" {
+		t.Errorf("id = %q", got.ID)
+	}
+	if len(got.Authors) != 1 || got.Authors[0].Name != "Лев Толстой" || got.Authors[0].FileAs != "Толстой, Лев" {
+		t.Errorf("authors = %+v", got.Authors)
+	}
+	if strings.Join(got.Identifiers, " ") != "urn:isbn:9780000000002 urn:uuid:0000-1111" {
+		t.Errorf("identifiers = %q", got.Identifiers)
+	}
+	if len(got.Categories) != 1 || got.Categories[0].Term != "prose_classic" {
+		t.Errorf("categories = %+v", got.Categories)
+	}
+	if got.Summary.Type != "text" || got.Summary.Value != "About <b>cats</b> & mice." {
+		t.Errorf("summary = %+v", got.Summary)
+	}
+
+	var links []string
+	for _, l := range got.Links {
+		href := l.Href
+		if strings.HasPrefix(href, "data:") {
+			href = "data"
+		}
+		links = append(links, l.Rel+" "+href+" "+l.Type)
+	}
+	want := []string{
+		opds.RelImage + " /covers/1.png image/png",
+		opds.RelThumbnail + " data image/jpeg",
+		opds.RelAcquisition + " /books/1?format=epub application/epub+zip",
+		opds.RelAcquisition + " /books/1?format=fb2.zip application/x-zip-compressed-fb2",
+		opds.RelAcquisition + " /books/1?format=application/x-custom application/x-custom",
+	}
+	if strings.Join(links, "\n") != strings.Join(want, "\n") {
+		t.Errorf("links:\n%s\nwant:\n%s", strings.Join(links, "\n"), strings.Join(want, "\n"))
+	}
+
+	// The inlined thumbnail is a JPEG within the default bounds
+	thumbnail, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(got.Links[1].Href, "data:image/jpeg;base64,"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := jpeg.DecodeConfig(bytes.NewReader(thumbnail))
+	if err != nil {
+		t.Fatalf("thumbnail: %v", err)
+	}
+	if config.Width > opds.DefaultThumbnailWidth || config.Height > opds.DefaultThumbnailHeight {
+		t.Errorf("thumbnail is %dx%d", config.Width, config.Height)
+	}
+}
+
+func TestEntryIDs(t *testing.T) {
+	m := &parser.Metadata{Title: "Untitled", Authors: []parser.Author{{FirstName: "A", LastName: "B"}}}
+	entry, err := opds.NewEntry(m, opds.EntryOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, _ := opds.NewEntry(m, opds.EntryOptions{})
+	if !strings.HasPrefix(entry.ID, "urn:sha1:") || entry.ID != again.ID {
+		t.Errorf("ids = %q, %q, want one stable urn:sha1", entry.ID, again.ID)
+	}
+
+	book := &parser.Book{Metadata: *m, Content: parser.Content{Chapters: []parser.Chapter{
+		{Elements: []parser.Element{&parser.Paragraph{Text: "Text."}}},
+	}}}
+	entry, err = opds.NewBookEntry(book, opds.EntryOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.ID != "urn:fingerprint:"+book.Fingerprint() {
+		t.Errorf("book entry id = %q", entry.ID)
+	}
+}
+
+func TestFeedXML(t *testing.T) {
+	entry, err := opds.NewEntry(metadata(t), entryOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	feed := opds.NewFeed(opds.FeedOptions{
+		ID:           "urn:catalog:new",
+		Title:        "New & noteworthy",
+		Author:       "Library",
+		Updated:      updated,
+		SelfURL:      "/new?page=2",
+		StartURL:     "/",
+		FirstURL:     "/new?page=1",
+		PreviousURL:  "/new?page=1",
+		NextURL:      "/new?page=3",
+		TotalResults: 41,
+		ItemsPerPage: 20,
+		StartIndex:   21,
+	}, []*opds.Entry{entry, entry})
+	data, err := feed.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got atomFeed
+	if err := xml.Unmarshal(data, &got); err != nil {
+		t.Fatalf("%v\n%s", err, data)
+	}
+	if got.ID != "urn:catalog:new" || got.Title != "New & noteworthy" || got.Author != "Library" {
+		t.Errorf("id, title, author = %q, %q, %q", got.ID, got.Title, got.Author)
+	}
+	if got.TotalResults != 41 || got.ItemsPerPage != 20 || got.StartIndex != 21 {
+		t.Errorf("opensearch = %d, %d, %d", got.TotalResults, got.ItemsPerPage, got.StartIndex)
+	}
+	var links []string
+	for _, l := range got.Links {
+		links = append(links, l.Rel+" "+l.Href+" "+l.Type)
+	}
+	want := []string{
+		"self /new?page=2 " + opds.TypeAcquisitionFeed,
+		"start / " + opds.TypeNavigationFeed,
+		"first /new?page=1 " + opds.TypeAcquisitionFeed,
+		"previous /new?page=1 " + opds.TypeAcquisitionFeed,
+		"next /new?page=3 " + opds.TypeAcquisitionFeed,
+	}
+	if strings.Join(links, "\n") != strings.Join(want, "\n") {
+		t.Errorf("links:\n%s\nwant:\n%s", strings.Join(links, "\n"), strings.Join(want, "\n"))
+	}
+
+	// Entries in a feed use the namespaces the feed declares
+	if len(got.Entries) != 2 || got.Entries[0].Language != "ru" || len(got.Entries[1].Identifiers) != 2 {
+		t.Errorf("entries = %+v", got.Entries)
+	}
+	if bytes.Count(data, []byte(`xmlns="`+opds.NamespaceAtom+`"`)) != 1 {
+		t.Errorf("the Atom namespace is declared more than once:\n%s", data)
+	}
+}
+
+func TestFeedWithoutPaging(t *testing.T) {
+	data, err := opds.NewFeed(opds.FeedOptions{ID: "urn:x", Title: "All", SelfURL: "/all"}, nil).Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"totalResults", "itemsPerPage", "startIndex", "<entry", "<author", `rel="next"`} {
+		if bytes.Contains(data, []byte(name)) {
+			t.Errorf("feed has %s:\n%s", name, data)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package plaintext
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/vpoluyaktov/biblio-ebook-parser/parser"
+)
+
+// Default templates for the spoken chapter announcements and book intro
+const (
+	DefaultChapterAnnouncement = "Chapter {index}. {title}."
+	DefaultBookIntro           = "{title}[, by {author}][, book {seriesIndex} of {series}|, from the series {series}]."
+)
+
+var (
+	rePlaceholder = regexp.MustCompile(`\{(\w+)\}`)
+	// Punctuation left doubled, or after a space, by empty placeholders
+	reStrayPunctuation = regexp.MustCompile(`\s*([.,;:!?])(?:\s*[.,;:])+|\s+([.,;:!?])`)
+)
+
+// expandTemplate fills the {name} placeholders of a template from values. A
+// part in square brackets is kept only if all its placeholders have values;
+// alternatives separated by "|" inside the brackets are tried in order. The
+// punctuation and spaces empty placeholders leave behind are cleaned up.
+func expandTemplate(tmpl string, values map[string]string) string {
+	var out strings.Builder
+	for tmpl != "" {
+		start := strings.IndexByte(tmpl, '[')
+		end := strings.IndexByte(tmpl[max(start, 0):], ']') + max(start, 0)
+		if start < 0 || end < start {
+			out.WriteString(fillPlaceholders(tmpl, values))
+			break
+		}
+		out.WriteString(fillPlaceholders(tmpl[:start], values))
+		for _, alt := range strings.Split(tmpl[start+1:end], "|") {
+			if hasAllPlaceholders(alt, values) {
+				out.WriteString(fillPlaceholders(alt, values))
+				break
+			}
+		}
+		tmpl = tmpl[end+1:]
+	}
+
+	text := strings.Join(strings.Fields(out.String()), " ")
+	text = reStrayPunctuation.ReplaceAllString(text, "$1$2")
+	return strings.TrimLeft(text, ".,;:!? ")
+}
+
+// fillPlaceholders replaces placeholders with their values, "" if unset
+func fillPlaceholders(s string, values map[string]string) string {
+	return rePlaceholder.ReplaceAllStringFunc(s, func(m string) string {
+		return values[m[1:len(m)-1]]
+	})
+}
+
+// hasAllPlaceholders reports whether every placeholder of s has a value
+func hasAllPlaceholders(s string, values map[string]string) bool {
+	for _, m := range rePlaceholder.FindAllStringSubmatch(s, -1) {
+		if strings.TrimSpace(values[m[1]]) == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// chapterAnnouncement returns the announcement of the chapter at a 0-based
+// index, or "" unless AnnounceChapters is on.
+// Placeholders: {index}, {title}.
+func (r *Renderer) chapterAnnouncement(ch parser.Chapter, index int) string {
+	if !r.Config.AnnounceChapters {
+		return ""
+	}
+	tmpl := r.Config.ChapterAnnouncement
+	if tmpl == "" {
+		tmpl = DefaultChapterAnnouncement
+	}
+	return expandTemplate(tmpl, map[string]string{
+		"index": strconv.Itoa(index + 1),
+		"title": strings.TrimSpace(ch.Title),
+	})
+}
+
+// bookIntro returns the spoken introduction of the book, or "" unless
+// IncludeBookIntro is on.
+// Placeholders: {title}, {author} (all authors), {series}, {seriesIndex}.
+func (r *Renderer) bookIntro(m parser.Metadata) string {
+	if !r.Config.IncludeBookIntro {
+		return ""
+	}
+	tmpl := r.Config.BookIntro
+	if tmpl == "" {
+		tmpl = DefaultBookIntro
+	}
+
+	names := make([]string, 0, len(m.Authors))
+	for _, a := range m.Authors {
+		if name := strings.TrimSpace(a.FullName()); name != "" {
+			names = append(names, name)
+		}
+	}
+
+	seriesIndex := ""
+	if m.SeriesIndex > 0 {
+		seriesIndex = strconv.Itoa(m.SeriesIndex)
+	}
+	return expandTemplate(tmpl, map[string]string{
+		"title":       strings.TrimSpace(m.Title),
+		"author":      strings.Join(names, ", "),
+		"series":      strings.TrimSpace(m.Series),
+		"seriesIndex": seriesIndex,
+	})
+}
+
+// announced returns the chapter elements preceded by the chapter's
+// announcement as a paragraph, so it is normalized like the text
+func (r *Renderer) announced(elements []parser.Element, ch parser.Chapter, index int) []parser.Element {
+	announcement := r.chapterAnnouncement(ch, index)
+	if announcement == "" {
+		return elements
+	}
+	return append([]parser.Element{&parser.Paragraph{Text: announcement}}, elements...)
+}
@@ -0,0 +1,171 @@
+package plaintext
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Chunk is a size-bounded piece of a chapter's text, e.g. for a TTS request
+type Chunk struct {
+	ChapterID string
+	Ordinal   int    // 1-based position within the chapter
+	Text      string // Includes trailing separators, so concatenating the chunks (minus overlap) gives the chapter text
+	Overlap   int    // Bytes at the start of Text repeated from the previous chunk (with Config.ChunkOverlap)
+}
+
+var reParagraphBreak = regexp.MustCompile(`\n{2,}`)
+
+// ChunkChapter splits a rendered chapter into chunks of at most maxChars
+// characters. It breaks between paragraphs where possible, then between lines
+// and sentences, then between words; a single word longer than maxChars is the
+// only thing ever cut. With Config.ChunkOverlap, each chunk starts with the
+// last sentence of the previous one when it fits.
+func (r *Renderer) ChunkChapter(ch Chapter, maxChars int) []Chunk {
+	if ch.Content == "" {
+		return nil
+	}
+	if maxChars <= 0 || utf8.RuneCountInString(ch.Content) <= maxChars {
+		return []Chunk{{ChapterID: ch.ID, Ordinal: 1, Text: ch.Content}}
+	}
+
+	var chunks []Chunk
+	var cur strings.Builder
+	curLen, overlap := 0, 0
+
+	flush := func() {
+		chunks = append(chunks, Chunk{
+			ChapterID: ch.ID,
+			Ordinal:   len(chunks) + 1,
+			Text:      cur.String(),
+			Overlap:   overlap,
+		})
+		cur.Reset()
+		curLen, overlap = 0, 0
+	}
+
+	for _, seg := range splitSegments(ch.Content, maxChars, 0) {
+		segLen := utf8.RuneCountInString(seg)
+		if curLen > 0 && curLen+segLen > maxChars {
+			prev := cur.String()
+			flush()
+			if r.Config.ChunkOverlap {
+				if prefix := lastSentence(prev); prefix != "" && utf8.RuneCountInString(prefix)+segLen <= maxChars {
+					cur.WriteString(prefix)
+					curLen = utf8.RuneCountInString(prefix)
+					overlap = len(prefix)
+				}
+			}
+		}
+		cur.WriteString(seg)
+		curLen += segLen
+	}
+	if cur.Len() > 0 {
+		flush()
+	}
+
+	return chunks
+}
+
+// splitSegments splits text into consecutive pieces of at most maxChars
+// characters whose concatenation is text, using the coarsest boundaries that
+// work: paragraphs, lines, sentences, words, and finally characters
+func splitSegments(text string, maxChars, level int) []string {
+	if utf8.RuneCountInString(text) <= maxChars {
+		return []string{text}
+	}
+
+	var pieces []string
+	switch level {
+	case 0:
+		pieces = splitAfter(text, reParagraphBreak.FindAllStringIndex(text, -1))
+	case 1:
+		pieces = strings.SplitAfter(text, "\n")
+	case 2:
+		pieces = splitSentencesExact(text)
+	case 3:
+		pieces = splitWordsExact(text)
+	default:
+		return splitRunes(text, maxChars)
+	}
+
+	var segments []string
+	for _, p := range pieces {
+		if p == "" {
+			continue
+		}
+		segments = append(segments, splitSegments(p, maxChars, level+1)...)
+	}
+	return segments
+}
+
+// splitAfter cuts text after each of the given [start, end) matches
+func splitAfter(text string, matches [][]int) []string {
+	var pieces []string
+	last := 0
+	for _, m := range matches {
+		pieces = append(pieces, text[last:m[1]])
+		last = m[1]
+	}
+	return append(pieces, text[last:])
+}
+
+// splitSentencesExact splits a line into sentences, keeping the whitespace
+// after each sentence with it
+func splitSentencesExact(text string) []string {
+	runes := []rune(text)
+	var pieces []string
+	start := 0
+	for _, end := range sentenceEnds(runes, allSentenceAbbreviations) {
+		for end < len(runes) && unicode.IsSpace(runes[end]) {
+			end++
+		}
+		pieces = append(pieces, string(runes[start:end]))
+		start = end
+	}
+	return append(pieces, string(runes[start:]))
+}
+
+// splitWordsExact splits text into words, each followed by its whitespace
+func splitWordsExact(text string) []string {
+	var pieces []string
+	start := 0
+	inSpace := false
+	for i, r := range text {
+		space := unicode.IsSpace(r)
+		if inSpace && !space {
+			pieces = append(pieces, text[start:i])
+			start = i
+		}
+		inSpace = space
+	}
+	return append(pieces, text[start:])
+}
+
+// splitRunes cuts text into pieces of maxChars characters
+func splitRunes(text string, maxChars int) []string {
+	var pieces []string
+	runes := []rune(text)
+	for len(runes) > maxChars {
+		pieces = append(pieces, string(runes[:maxChars]))
+		runes = runes[maxChars:]
+	}
+	return append(pieces, string(runes))
+}
+
+// lastSentence returns the last sentence of text with the whitespace after it
+func lastSentence(text string) string {
+	trimmed := strings.TrimRightFunc(text, unicode.IsSpace)
+	lineStart := strings.LastIndex(trimmed, "\n") + 1
+	runes := []rune(trimmed[lineStart:])
+
+	start := 0
+	if ends := sentenceEnds(runes, allSentenceAbbreviations); len(ends) > 0 {
+		start = ends[len(ends)-1]
+	}
+	for start < len(runes) && unicode.IsSpace(runes[start]) {
+		start++
+	}
+	return string(runes[start:]) + text[len(trimmed):]
+}
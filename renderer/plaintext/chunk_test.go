@@ -0,0 +1,150 @@
+package plaintext
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// joinChunks concatenates chunks without their overlap
+func joinChunks(chunks []Chunk) string {
+	var b strings.Builder
+	for _, c := range chunks {
+		b.WriteString(c.Text[c.Overlap:])
+	}
+	return b.String()
+}
+
+func checkChunks(t *testing.T, ch Chapter, chunks []Chunk, maxChars int) {
+	t.Helper()
+	for i, c := range chunks {
+		if n := utf8.RuneCountInString(c.Text); n > maxChars {
+			t.Errorf("chunk %d has %d characters, more than %d: %q", i+1, n, maxChars, c.Text)
+		}
+		if c.Ordinal != i+1 || c.ChapterID != ch.ID {
+			t.Errorf("chunk %d is %d of %q", i+1, c.Ordinal, c.ChapterID)
+		}
+		if !utf8.ValidString(c.Text) {
+			t.Errorf("chunk %d is not valid UTF-8: %q", i+1, c.Text)
+		}
+	}
+	if got := joinChunks(chunks); got != ch.Content {
+		t.Errorf("chunks join to\n%q\nwant\n%q", got, ch.Content)
+	}
+}
+
+func texts(chunks []Chunk) []string {
+	var out []string
+	for _, c := range chunks {
+		out = append(out, c.Text)
+	}
+	return out
+}
+
+func TestChunkSizeBound(t *testing.T) {
+	ch := Chapter{ID: "ch1", Content: strings.Repeat(russianParagraph+".\n\n", 10)}
+	for _, maxChars := range []int{20, 50, 100, 333, 1000} {
+		chunks := NewRenderer(Config{}).ChunkChapter(ch, maxChars)
+		if len(chunks) < 2 {
+			t.Errorf("%d characters: %d chunks", maxChars, len(chunks))
+		}
+		checkChunks(t, ch, chunks, maxChars)
+	}
+
+	// Text that fits is one chunk, as is any text without a limit
+	for _, maxChars := range []int{0, len(ch.Content)} {
+		if chunks := NewRenderer(Config{}).ChunkChapter(ch, maxChars); len(chunks) != 1 || chunks[0].Text != ch.Content {
+			t.Errorf("%d characters: %d chunks", maxChars, len(chunks))
+		}
+	}
+}
+
+func TestChunkSentenceBoundaries(t *testing.T) {
+	ch := Chapter{ID: "ch1", Content: "Первое предложение. Второе предложение! Третье предложение? Четвёртое, последнее."}
+
+	chunks := NewRenderer(Config{}).ChunkChapter(ch, 45)
+	checkChunks(t, ch, chunks, 45)
+	want := []string{
+		"Первое предложение. Второе предложение! ",
+		"Третье предложение? Четвёртое, последнее.",
+	}
+	if got := texts(chunks); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("chunks = %q, want %q", got, want)
+	}
+
+	// Paragraphs go whole before sentences are split
+	ch.Content = "Один абзац.\n\nДругой абзац. Ещё предложение."
+	chunks = NewRenderer(Config{}).ChunkChapter(ch, 30)
+	checkChunks(t, ch, chunks, 30)
+	want = []string{"Один абзац.\n\n", "Другой абзац. Ещё предложение."}
+	if got := texts(chunks); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("chunks = %q, want %q", got, want)
+	}
+
+	// Abbreviations don't end sentences
+	ch.Content = "Мы видели т. е. слышали его. Это был проф. Иванов."
+	chunks = NewRenderer(Config{}).ChunkChapter(ch, 30)
+	checkChunks(t, ch, chunks, 30)
+	if got := chunks[0].Text; got != "Мы видели т. е. слышали его. " {
+		t.Errorf("first chunk = %q", got)
+	}
+}
+
+func TestChunkOverlongSentence(t *testing.T) {
+	sentence := "Это очень длинное предложение без единой точки до самого конца которое не помещается"
+	ch := Chapter{ID: "ch1", Content: "Короткое. " + sentence + ". Конец."}
+
+	chunks := NewRenderer(Config{}).ChunkChapter(ch, 30)
+	checkChunks(t, ch, chunks, 30)
+	// The sentence is split between words
+	if len(chunks) < 4 {
+		t.Errorf("chunks = %q", texts(chunks))
+	}
+	for _, c := range chunks[:len(chunks)-1] {
+		if !strings.HasSuffix(c.Text, " ") {
+			t.Errorf("chunk %d = %q ends inside a word", c.Ordinal, c.Text)
+		}
+	}
+
+	// A word longer than the limit is the only thing cut
+	word := strings.Repeat("д", 25)
+	ch.Content = "Слово " + word + " конец"
+	chunks = NewRenderer(Config{}).ChunkChapter(ch, 10)
+	checkChunks(t, ch, chunks, 10)
+	want := []string{"Слово ", "дддддддддд", "дддддддддд", "ддддд ", "конец"}
+	if got := texts(chunks); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("chunks = %q, want %q", got, want)
+	}
+}
+
+func TestChunkOverlap(t *testing.T) {
+	ch := Chapter{ID: "ch1", Content: "Первое. Второе предложение. Третье предложение. Четвёртое."}
+
+	chunks := NewRenderer(Config{ChunkOverlap: true}).ChunkChapter(ch, 45)
+	checkChunks(t, ch, chunks, 45)
+	want := []string{
+		"Первое. Второе предложение. ",
+		"Второе предложение. Третье предложение. ",
+		"Третье предложение. Четвёртое.",
+	}
+	if got := texts(chunks); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("chunks = %q, want %q", got, want)
+	}
+	for _, c := range chunks[1:] {
+		prev := chunks[c.Ordinal-2].Text
+		if c.Overlap == 0 || !strings.HasSuffix(prev, c.Text[:c.Overlap]) {
+			t.Errorf("chunk %d = %q repeats %d bytes of %q", c.Ordinal, c.Text, c.Overlap, prev)
+		}
+	}
+}
+
+func TestChunkOverlapThatDoesNotFit(t *testing.T) {
+	ch := Chapter{ID: "ch1", Content: "Первое. Второе предложение. Третье предложение. Четвёртое."}
+
+	// "Второе предложение. " and "Третье предложение. " don't fit together
+	chunks := NewRenderer(Config{ChunkOverlap: true}).ChunkChapter(ch, 30)
+	checkChunks(t, ch, chunks, 30)
+	if chunks[1].Overlap != 0 {
+		t.Errorf("chunk 2 = %q repeats %d bytes", chunks[1].Text, chunks[1].Overlap)
+	}
+}
@@ -0,0 +1,98 @@
+package plaintext
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/vpoluyaktov/biblio-ebook-parser/parser"
+)
+
+// rePageNumber matches a paragraph holding only a page number, such as "17"
+// or "- 17 -", as OCR leaves between the pages of a scan
+var rePageNumber = regexp.MustCompile(`^[-–—\s]*\d{1,4}[-–—\s]*$`)
+
+// joinBrokenParagraphs rejoins paragraphs OCR broke at page ends: one that
+// stops mid-word or mid-sentence continues in the next when that starts with
+// a lowercase letter. Page numbers between the two are dropped. The book's
+// paragraphs are left as they are.
+func joinBrokenParagraphs(elements []parser.Element) []parser.Element {
+	var joined []parser.Element
+	for i := 0; i < len(elements); i++ {
+		p, ok := elements[i].(*parser.Paragraph)
+		if !ok {
+			joined = append(joined, elements[i])
+			continue
+		}
+		for {
+			next := i + 1
+			for next < len(elements) && isPageNumber(elements[next]) {
+				next++
+			}
+			if next == len(elements) {
+				break
+			}
+			rest, ok := elements[next].(*parser.Paragraph)
+			if !ok || !continues(p.Text, rest.Text) {
+				break
+			}
+			p = joinParagraphs(p, rest)
+			i = next
+		}
+		joined = append(joined, p)
+	}
+	return joined
+}
+
+func isPageNumber(elem parser.Element) bool {
+	p, ok := elem.(*parser.Paragraph)
+	return ok && rePageNumber.MatchString(p.Text)
+}
+
+// continues reports whether paragraph text b carries on a sentence, or a
+// hyphenated word, that a leaves unfinished
+func continues(a, b string) bool {
+	a = strings.TrimRightFunc(a, unicode.IsSpace)
+	first, _ := utf8.DecodeRuneInString(strings.TrimLeftFunc(b, unicode.IsSpace))
+	if !unicode.IsLower(first) {
+		return false
+	}
+	last, _ := utf8.DecodeLastRuneInString(a)
+	return brokenWord(a) || unicode.IsLetter(last) || last == ','
+}
+
+// brokenWord reports whether text ends with a word hyphenated at the line end
+func brokenWord(text string) bool {
+	hyphen, size := utf8.DecodeLastRuneInString(text)
+	if hyphen != '-' && hyphen != '‐' {
+		return false
+	}
+	before, _ := utf8.DecodeLastRuneInString(text[:len(text)-size])
+	return unicode.IsLower(before)
+}
+
+// joinParagraphs returns a paragraph of the text of a followed by b's, with a
+// broken word rejoined and the links of both kept
+func joinParagraphs(a, b *parser.Paragraph) *parser.Paragraph {
+	head := strings.TrimRightFunc(a.Text, unicode.IsSpace)
+	if brokenWord(head) {
+		_, size := utf8.DecodeLastRuneInString(head)
+		head = head[:len(head)-size]
+	} else {
+		head += " "
+	}
+	tail := strings.TrimLeftFunc(b.Text, unicode.IsSpace)
+	offset := len(head) - (len(b.Text) - len(tail))
+
+	joined := &parser.Paragraph{Text: head + tail}
+	for _, link := range a.Links {
+		link.End = min(link.End, len(head))
+		joined.Links = append(joined.Links, link)
+	}
+	for _, link := range b.Links {
+		link.Start, link.End = max(link.Start+offset, len(head)), link.End+offset
+		joined.Links = append(joined.Links, link)
+	}
+	return joined
+}
@@ -0,0 +1,9 @@
+package plaintext
+
+import "github.com/vpoluyaktov/biblio-ebook-parser/renderer"
+
+func init() {
+	// Register with the default configuration
+	renderer.Register("text", NewRenderer(Config{}))
+	renderer.Register("plaintext", NewRenderer(Config{}))
+}
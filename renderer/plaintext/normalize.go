@@ -0,0 +1,393 @@
+package plaintext
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// NormalizationRules describe how text in one language is expanded for speech
+// synthesis when Config.NormalizeText is enabled
+type NormalizationRules struct {
+	// Number spells out a non-negative integer
+	Number func(n int64) string
+	// Year spells out a four-digit year the way it is read aloud; returning
+	// false falls back to Number. Optional.
+	Year func(n int64) (string, bool)
+	// Ordinal spells out n followed by an ordinal suffix at the start of rest
+	// (e.g., "rd" in "3rd", "-й" in "3-й") and reports how many bytes of rest
+	// the suffix used; 0 means rest doesn't start with an ordinal suffix. Optional.
+	Ordinal func(n int64, rest string) (string, int)
+	// Abbreviations maps abbreviations, as written, to their spoken form
+	Abbreviations map[string]string
+	// Prefixes lists abbreviations that are expanded only before a word or
+	// number, such as titles ("Dr." in "Dr. Watson" but not in "the Dr.")
+	Prefixes []string
+	// Units maps unit symbols to their spoken forms, indexed by Plural
+	Units map[string][]string
+	// Currencies maps currency symbols, before or after a number, to their
+	// spoken forms, indexed by Plural ("$5" is read "five dollars")
+	Currencies map[string][]string
+	// Plural returns the index of the plural form used after n
+	Plural func(n int64) int
+	// RomanContext lists words (lowercase) after which Roman numerals are read as numbers
+	RomanContext []string
+}
+
+var (
+	normalizationMu    sync.RWMutex
+	normalizationRules = map[string]*NormalizationRules{
+		"en": englishRules,
+		"ru": russianRules,
+	}
+)
+
+// RegisterNormalizationRules adds or replaces the normalization rules for a
+// language, identified by its primary subtag (e.g., "en", "ru")
+func RegisterNormalizationRules(lang string, rules *NormalizationRules) {
+	normalizationMu.Lock()
+	defer normalizationMu.Unlock()
+	normalizationRules[strings.ToLower(lang)] = rules
+}
+
+// getNormalizationRules returns the rules for a book language, English when
+// the language is unknown, or nil when no rules are registered for it
+func getNormalizationRules(lang string) *NormalizationRules {
+	lang = primaryLanguage(lang)
+	if lang == "" {
+		lang = "en"
+	}
+
+	normalizationMu.RLock()
+	defer normalizationMu.RUnlock()
+	return normalizationRules[lang]
+}
+
+// normalizer applies a language's rules to text. A nil normalizer leaves text unchanged.
+type normalizer struct {
+	rules          *NormalizationRules
+	yearsAsNumbers bool
+	abbreviations  *regexp.Regexp
+	prefixes       map[string]bool
+	roman          *regexp.Regexp
+}
+
+// newNormalizer prepares text normalization for the book language, or returns
+// nil when normalization is disabled or the language is not supported
+func (r *Renderer) newNormalizer(lang string) *normalizer {
+	if !r.Config.NormalizeText {
+		return nil
+	}
+	rules := getNormalizationRules(lang)
+	if rules == nil || rules.Number == nil {
+		return nil
+	}
+
+	n := &normalizer{rules: rules, yearsAsNumbers: r.Config.YearsAsNumbers}
+
+	if len(rules.Abbreviations) > 0 {
+		abbrs := make([]string, 0, len(rules.Abbreviations))
+		for abbr := range rules.Abbreviations {
+			abbrs = append(abbrs, regexp.QuoteMeta(abbr))
+		}
+		// Longest first so "т. е." wins over shorter overlapping entries
+		sort.Slice(abbrs, func(i, j int) bool { return len(abbrs[i]) > len(abbrs[j]) })
+		n.abbreviations = regexp.MustCompile(`(?:^|[^\p{L}\p{N}.])(` + strings.Join(abbrs, "|") + `)`)
+
+		n.prefixes = make(map[string]bool, len(rules.Prefixes))
+		for _, abbr := range rules.Prefixes {
+			n.prefixes[abbr] = true
+		}
+	}
+
+	if len(rules.RomanContext) > 0 {
+		words := make([]string, len(rules.RomanContext))
+		for i, w := range rules.RomanContext {
+			words[i] = regexp.QuoteMeta(w)
+		}
+		n.roman = regexp.MustCompile(`(?:^|[^\p{L}])(?i:` + strings.Join(words, "|") + `)\s+([IVXLCDM]+)`)
+	}
+
+	return n
+}
+
+// normalize expands Roman numerals, abbreviations, numbers, ordinals and units.
+// Headings that consist of a single Roman numeral are read as a number.
+func (n *normalizer) normalize(text string, heading bool) string {
+	if n == nil {
+		return text
+	}
+
+	if heading {
+		if v, ok := parseRoman(strings.TrimSuffix(strings.TrimSpace(text), ".")); ok {
+			return n.rules.Number(int64(v))
+		}
+	}
+
+	if n.roman != nil {
+		text = replaceGroup(n.roman, text, func(numeral, rest string) (string, bool) {
+			v, ok := parseRoman(numeral)
+			if !ok || startsWithLetter(rest) {
+				return "", false
+			}
+			return n.rules.Number(int64(v)), true
+		})
+	}
+
+	if n.abbreviations != nil {
+		text = replaceGroup(n.abbreviations, text, func(abbr, rest string) (string, bool) {
+			if !strings.HasSuffix(abbr, ".") && startsWithLetter(rest) {
+				return "", false
+			}
+			next, _ := utf8.DecodeRuneInString(strings.TrimLeft(rest, " \u00a0"))
+			if n.prefixes[abbr] && !unicode.IsLetter(next) && !unicode.IsDigit(next) {
+				return "", false
+			}
+			// The period of an abbreviation that ends the text also ends the sentence
+			if strings.HasSuffix(abbr, ".") && strings.TrimLeftFunc(rest, isClosing) == "" {
+				return n.rules.Abbreviations[abbr] + ".", true
+			}
+			return n.rules.Abbreviations[abbr], true
+		})
+	}
+
+	return n.expandNumbers(text)
+}
+
+// replaceGroup replaces the first capture group of every match of re with the
+// result of fn, which also gets the text following the match
+func replaceGroup(re *regexp.Regexp, text string, fn func(group, rest string) (string, bool)) string {
+	matches := re.FindAllStringSubmatchIndex(text, -1)
+	if matches == nil {
+		return text
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		start, end := m[2], m[3]
+		replacement, ok := fn(text[start:end], text[end:])
+		if !ok {
+			continue
+		}
+		b.WriteString(text[last:start])
+		b.WriteString(replacement)
+		last = end
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+// isClosing reports whether r may follow the end of a sentence
+func isClosing(r rune) bool {
+	return unicode.IsSpace(r) || unicode.In(r, unicode.Pe, unicode.Pf) || r == '"' || r == '\''
+}
+
+// expandNumbers spells out standalone integers along with ordinal suffixes and
+// units that follow them, and reads currency symbols next to a number after
+// it ("$5" as "five dollars"); other currency symbols are left as they are.
+// Decimals, numbers with separators or leading zeros, and numbers glued to
+// letters (e.g., "A4", "3D") are left as they are.
+func (n *normalizer) expandNumbers(text string) string {
+	var b strings.Builder
+	var currency []string // Spoken forms of a currency symbol before the number
+	symbol := ""
+	i := 0
+	for i < len(text) {
+		if !isDigit(text[i]) {
+			if forms, size := n.currency(text[i:]); size > 0 && i+size < len(text) && isDigit(text[i+size]) {
+				currency, symbol = forms, text[i:i+size]
+				i += size
+				continue
+			}
+			b.WriteByte(text[i])
+			i++
+			continue
+		}
+
+		start := i
+		for i < len(text) && isDigit(text[i]) {
+			i++
+		}
+		digits := text[start:i]
+
+		prev, _ := utf8.DecodeLastRuneInString(text[:start])
+		separated := i+1 < len(text) && (text[i] == '.' || text[i] == ',') && isDigit(text[i+1])
+		if start > 0 && (unicode.IsLetter(prev) || prev == '.' || prev == ',') ||
+			separated || (len(digits) > 1 && digits[0] == '0') || len(digits) > 15 {
+			// Copy the whole numeric token unchanged
+			for i < len(text) && (isDigit(text[i]) || ((text[i] == '.' || text[i] == ',') && i+1 < len(text) && isDigit(text[i+1]))) {
+				i++
+			}
+			b.WriteString(text[start:i])
+			if currency != nil {
+				// Fractions take the form that follows 2: "1.5 dollars", "1,5 рубля"
+				b.WriteString(" " + pluralForm(n.rules, currency, 2))
+				currency = nil
+			}
+			continue
+		}
+
+		value, _ := strconv.ParseInt(digits, 10, 64)
+		rest := text[i:]
+		if currency != nil {
+			if startsWithLetter(rest) {
+				// "$5k" and the like
+				b.WriteString(symbol + digits)
+			} else {
+				b.WriteString(n.rules.Number(value) + " " + pluralForm(n.rules, currency, value))
+			}
+			currency = nil
+			continue
+		}
+
+		if n.rules.Ordinal != nil {
+			if words, used := n.rules.Ordinal(value, rest); used > 0 {
+				b.WriteString(words)
+				i += used
+				continue
+			}
+		}
+		if startsWithLetter(rest) {
+			b.WriteString(digits)
+			continue
+		}
+
+		words := ""
+		if len(digits) == 4 && !n.yearsAsNumbers && n.rules.Year != nil {
+			if y, ok := n.rules.Year(value); ok {
+				words = y
+			}
+		}
+		if words == "" {
+			words = n.rules.Number(value)
+		}
+		b.WriteString(words)
+
+		if unit, used := n.unit(value, rest); used > 0 {
+			b.WriteString(" ")
+			b.WriteString(unit)
+			i += used
+		} else if forms, used := n.currency(strings.TrimPrefix(rest, " ")); used > 0 {
+			b.WriteString(" " + pluralForm(n.rules, forms, value))
+			i += len(rest) - len(strings.TrimPrefix(rest, " ")) + used
+		}
+	}
+	return b.String()
+}
+
+// currency returns the spoken forms of the currency symbol at the start of s
+// and its length in bytes, or 0 if s doesn't start with a known one
+func (n *normalizer) currency(s string) ([]string, int) {
+	if len(n.rules.Currencies) == 0 {
+		return nil, 0
+	}
+	r, size := utf8.DecodeRuneInString(s)
+	if !unicode.Is(unicode.Sc, r) {
+		return nil, 0
+	}
+	forms := n.rules.Currencies[s[:size]]
+	if len(forms) == 0 {
+		return nil, 0
+	}
+	return forms, size
+}
+
+// pluralForm returns the form of forms used after value
+func pluralForm(rules *NormalizationRules, forms []string, value int64) string {
+	form := 0
+	if rules.Plural != nil {
+		form = rules.Plural(value)
+	}
+	return forms[min(form, len(forms)-1)]
+}
+
+// unit returns the spoken unit that follows a number in rest, optionally after
+// one space, and how many bytes of rest it used
+func (n *normalizer) unit(value int64, rest string) (string, int) {
+	if len(n.rules.Units) == 0 {
+		return "", 0
+	}
+	offset := 0
+	if strings.HasPrefix(rest, " ") {
+		offset = 1
+	}
+	end := offset
+	for end < len(rest) {
+		r, size := utf8.DecodeRuneInString(rest[end:])
+		if !unicode.IsLetter(r) {
+			break
+		}
+		end += size
+	}
+	if end == offset {
+		return "", 0
+	}
+	forms, ok := n.rules.Units[rest[offset:end]]
+	if !ok || len(forms) == 0 {
+		return "", 0
+	}
+	// "km/h" and the like are compound units we don't know how to read
+	if end < len(rest) && rest[end] == '/' {
+		return "", 0
+	}
+
+	return pluralForm(n.rules, forms, value), end
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func startsWithLetter(s string) bool {
+	r, _ := utf8.DecodeRuneInString(s)
+	return unicode.IsLetter(r)
+}
+
+var romanValues = map[byte]int{'I': 1, 'V': 5, 'X': 10, 'L': 50, 'C': 100, 'D': 500, 'M': 1000}
+
+// parseRoman converts a canonical uppercase Roman numeral to its value
+func parseRoman(s string) (int, bool) {
+	if s == "" || len(s) > 15 {
+		return 0, false
+	}
+	total := 0
+	for i := 0; i < len(s); i++ {
+		v, ok := romanValues[s[i]]
+		if !ok {
+			return 0, false
+		}
+		if i+1 < len(s) && romanValues[s[i+1]] > v {
+			total -= v
+		} else {
+			total += v
+		}
+	}
+	// Reject non-canonical spellings such as "IIII" or "VX"
+	if total <= 0 || toRoman(total) != s {
+		return 0, false
+	}
+	return total, true
+}
+
+func toRoman(n int) string {
+	numerals := []struct {
+		value int
+		text  string
+	}{
+		{1000, "M"}, {900, "CM"}, {500, "D"}, {400, "CD"}, {100, "C"}, {90, "XC"},
+		{50, "L"}, {40, "XL"}, {10, "X"}, {9, "IX"}, {5, "V"}, {4, "IV"}, {1, "I"},
+	}
+	var b strings.Builder
+	for _, num := range numerals {
+		for n >= num.value {
+			b.WriteString(num.text)
+			n -= num.value
+		}
+	}
+	return b.String()
+}
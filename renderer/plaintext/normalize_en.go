@@ -0,0 +1,157 @@
+package plaintext
+
+import "strings"
+
+var englishRules = &NormalizationRules{
+	Number:  englishNumber,
+	Year:    englishYear,
+	Ordinal: englishOrdinal,
+	Abbreviations: map[string]string{
+		"Mr.":   "Mister",
+		"Mrs.":  "Missus",
+		"Dr.":   "Doctor",
+		"St.":   "Saint",
+		"Prof.": "Professor",
+		"Jr.":   "Junior",
+		"Sr.":   "Senior",
+		"Capt.": "Captain",
+		"Gen.":  "General",
+		"Lt.":   "Lieutenant",
+		"Col.":  "Colonel",
+		"Sgt.":  "Sergeant",
+		"e.g.":  "for example",
+		"i.e.":  "that is",
+		"etc.":  "et cetera",
+		"vs.":   "versus",
+		"No.":   "number",
+	},
+	Prefixes: []string{"Mr.", "Mrs.", "Dr.", "St.", "Prof.", "Capt.", "Gen.", "Lt.", "Col.", "Sgt.", "No."},
+	Units: map[string][]string{
+		"km":  {"kilometer", "kilometers"},
+		"m":   {"meter", "meters"},
+		"cm":  {"centimeter", "centimeters"},
+		"mm":  {"millimeter", "millimeters"},
+		"kg":  {"kilogram", "kilograms"},
+		"g":   {"gram", "grams"},
+		"mg":  {"milligram", "milligrams"},
+		"lb":  {"pound", "pounds"},
+		"lbs": {"pounds", "pounds"},
+		"oz":  {"ounce", "ounces"},
+		"ft":  {"foot", "feet"},
+		"mi":  {"mile", "miles"},
+		"mph": {"mile per hour", "miles per hour"},
+	},
+	Currencies: map[string][]string{
+		"$": {"dollar", "dollars"},
+		"€": {"euro", "euros"},
+		"£": {"pound", "pounds"},
+		"¥": {"yen", "yen"},
+		"₽": {"ruble", "rubles"},
+	},
+	Plural: func(n int64) int {
+		if n == 1 {
+			return 0
+		}
+		return 1
+	},
+	RomanContext: []string{"chapter", "part", "book", "volume", "section", "act", "scene"},
+}
+
+var (
+	englishOnes = []string{
+		"zero", "one", "two", "three", "four", "five", "six", "seven", "eight", "nine",
+		"ten", "eleven", "twelve", "thirteen", "fourteen", "fifteen", "sixteen",
+		"seventeen", "eighteen", "nineteen",
+	}
+	englishTens = []string{
+		"", "", "twenty", "thirty", "forty", "fifty", "sixty", "seventy", "eighty", "ninety",
+	}
+	englishScales = []struct {
+		value int64
+		name  string
+	}{
+		{1_000_000_000_000, "trillion"},
+		{1_000_000_000, "billion"},
+		{1_000_000, "million"},
+		{1_000, "thousand"},
+	}
+)
+
+// englishNumber spells out n, e.g. 1984 as "one thousand nine hundred eighty-four"
+func englishNumber(n int64) string {
+	if n < 20 {
+		return englishOnes[n]
+	}
+
+	var parts []string
+	for _, scale := range englishScales {
+		if n >= scale.value {
+			parts = append(parts, englishNumber(n/scale.value), scale.name)
+			n %= scale.value
+		}
+	}
+	if n >= 100 {
+		parts = append(parts, englishOnes[n/100], "hundred")
+		n %= 100
+	}
+	if n > 0 {
+		switch {
+		case n < 20:
+			parts = append(parts, englishOnes[n])
+		case n%10 == 0:
+			parts = append(parts, englishTens[n/10])
+		default:
+			parts = append(parts, englishTens[n/10]+"-"+englishOnes[n%10])
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// englishYear reads years in pairs: 1984 as "nineteen eighty-four", 1905 as
+// "nineteen oh five", 2019 as "twenty nineteen". 2000-2009 read as plain numbers.
+func englishYear(n int64) (string, bool) {
+	if n < 1100 || n > 2099 || (n >= 2000 && n < 2010) {
+		return "", false
+	}
+	hi, lo := n/100, n%100
+	switch {
+	case lo == 0:
+		return englishNumber(hi) + " hundred", true
+	case lo < 10:
+		return englishNumber(hi) + " oh " + englishNumber(lo), true
+	default:
+		return englishNumber(hi) + " " + englishNumber(lo), true
+	}
+}
+
+var englishOrdinalWords = map[string]string{
+	"one": "first", "two": "second", "three": "third", "five": "fifth",
+	"eight": "eighth", "nine": "ninth", "twelve": "twelfth",
+}
+
+// englishOrdinal handles "1st", "2nd", "3rd" and "4th" style suffixes
+func englishOrdinal(n int64, rest string) (string, int) {
+	if len(rest) < 2 {
+		return "", 0
+	}
+	suffix := strings.ToLower(rest[:2])
+	if suffix != "st" && suffix != "nd" && suffix != "rd" && suffix != "th" {
+		return "", 0
+	}
+	if startsWithLetter(rest[2:]) {
+		return "", 0
+	}
+
+	words := englishNumber(n)
+	cut := strings.LastIndexAny(words, " -") + 1
+	last := words[cut:]
+	switch {
+	case englishOrdinalWords[last] != "":
+		last = englishOrdinalWords[last]
+	case strings.HasSuffix(last, "y"):
+		last = strings.TrimSuffix(last, "y") + "ieth"
+	default:
+		last += "th"
+	}
+	return words[:cut] + last, 2
+}
@@ -0,0 +1,247 @@
+package plaintext
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var russianRules = &NormalizationRules{
+	Number:  russianNumber,
+	Ordinal: russianOrdinal,
+	Abbreviations: map[string]string{
+		"т.е.":  "то есть",
+		"т. е.": "то есть",
+		"т.д.":  "так далее",
+		"т. д.": "так далее",
+		"т.п.":  "тому подобное",
+		"т. п.": "тому подобное",
+		"др.":   "другие",
+		"см.":   "смотри",
+		"стр.":  "страница",
+		"ул.":   "улица",
+		"тыс.":  "тысяч",
+		"млн":   "миллионов",
+		"млрд":  "миллиардов",
+		"руб.":  "рублей",
+		"коп.":  "копеек",
+		"проф.": "профессор",
+		"акад.": "академик",
+		"им.":   "имени",
+		"напр.": "например",
+	},
+	Prefixes: []string{"ул.", "проф.", "акад.", "им."},
+	Units: map[string][]string{
+		"км": {"километр", "километра", "километров"},
+		"м":  {"метр", "метра", "метров"},
+		"см": {"сантиметр", "сантиметра", "сантиметров"},
+		"мм": {"миллиметр", "миллиметра", "миллиметров"},
+		"кг": {"килограмм", "килограмма", "килограммов"},
+		"мг": {"миллиграмм", "миллиграмма", "миллиграммов"},
+		"л":  {"литр", "литра", "литров"},
+	},
+	Currencies: map[string][]string{
+		"$": {"доллар", "доллара", "долларов"},
+		"€": {"евро", "евро", "евро"},
+		"£": {"фунт", "фунта", "фунтов"},
+		"¥": {"иена", "иены", "иен"},
+		"₽": {"рубль", "рубля", "рублей"},
+	},
+	Plural:       russianPlural,
+	RomanContext: []string{"глава", "часть", "книга", "том", "раздел", "действие"},
+}
+
+var (
+	russianOnes = []string{
+		"ноль", "один", "два", "три", "четыре", "пять", "шесть", "семь", "восемь", "девять",
+		"десять", "одиннадцать", "двенадцать", "тринадцать", "четырнадцать", "пятнадцать",
+		"шестнадцать", "семнадцать", "восемнадцать", "девятнадцать",
+	}
+	russianTens = []string{
+		"", "", "двадцать", "тридцать", "сорок", "пятьдесят", "шестьдесят", "семьдесят",
+		"восемьдесят", "девяносто",
+	}
+	russianHundreds = []string{
+		"", "сто", "двести", "триста", "четыреста", "пятьсот", "шестьсот", "семьсот",
+		"восемьсот", "девятьсот",
+	}
+	russianScales = []struct {
+		value    int64
+		forms    [3]string
+		feminine bool
+	}{
+		{1_000_000_000_000, [3]string{"триллион", "триллиона", "триллионов"}, false},
+		{1_000_000_000, [3]string{"миллиард", "миллиарда", "миллиардов"}, false},
+		{1_000_000, [3]string{"миллион", "миллиона", "миллионов"}, false},
+		{1_000, [3]string{"тысяча", "тысячи", "тысяч"}, true},
+	}
+
+	russianOrdinalOnes = []string{
+		"", "первый", "второй", "третий", "четвёртый", "пятый", "шестой", "седьмой",
+		"восьмой", "девятый", "десятый", "одиннадцатый", "двенадцатый", "тринадцатый",
+		"четырнадцатый", "пятнадцатый", "шестнадцатый", "семнадцатый", "восемнадцатый",
+		"девятнадцатый",
+	}
+	russianOrdinalTens = []string{
+		"", "", "двадцатый", "тридцатый", "сороковой", "пятидесятый", "шестидесятый",
+		"семидесятый", "восьмидесятый", "девяностый",
+	}
+	russianOrdinalHundreds = []string{
+		"", "сотый", "двухсотый", "трёхсотый", "четырёхсотый", "пятисотый", "шестисотый",
+		"семисотый", "восьмисотый", "девятисотый",
+	}
+)
+
+// russianPlural returns the index of the form used after n: 1 (один километр),
+// 2-4 (два километра) or 5-20 (пять километров)
+func russianPlural(n int64) int {
+	switch {
+	case n%10 == 1 && n%100 != 11:
+		return 0
+	case n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14):
+		return 1
+	default:
+		return 2
+	}
+}
+
+// russianNumber spells out n in the nominative case
+func russianNumber(n int64) string {
+	if n == 0 {
+		return russianOnes[0]
+	}
+
+	var parts []string
+	for _, scale := range russianScales {
+		if n >= scale.value {
+			count := n / scale.value
+			// "тысяча девятьсот", not "одна тысяча девятьсот"
+			if count != 1 || !scale.feminine {
+				parts = append(parts, russianBelowThousand(count, scale.feminine)...)
+			}
+			parts = append(parts, scale.forms[russianPlural(count)])
+			n %= scale.value
+		}
+	}
+	parts = append(parts, russianBelowThousand(n, false)...)
+	return strings.Join(parts, " ")
+}
+
+// russianBelowThousand spells out n < 1000 (larger counts of a scale recurse),
+// using feminine forms of one and two for thousands
+func russianBelowThousand(n int64, feminine bool) []string {
+	if n >= 1000 {
+		return []string{russianNumber(n)}
+	}
+
+	var parts []string
+	if n >= 100 {
+		parts = append(parts, russianHundreds[n/100])
+		n %= 100
+	}
+	if n >= 20 {
+		parts = append(parts, russianTens[n/10])
+		n %= 10
+	}
+	if n > 0 {
+		word := russianOnes[n]
+		if feminine && n == 1 {
+			word = "одна"
+		} else if feminine && n == 2 {
+			word = "две"
+		}
+		parts = append(parts, word)
+	}
+	return parts
+}
+
+// russianOrdinal handles suffixes like "-й", "-я", "-е" and "-го" (e.g., "3-й")
+func russianOrdinal(n int64, rest string) (string, int) {
+	if !strings.HasPrefix(rest, "-") || n <= 0 {
+		return "", 0
+	}
+
+	end := 1
+	for end < len(rest) {
+		r, size := utf8.DecodeRuneInString(rest[end:])
+		if !unicode.Is(unicode.Cyrillic, r) {
+			break
+		}
+		end += size
+	}
+	suffix := rest[1:end]
+	if suffix == "" || startsWithLetter(rest[end:]) {
+		return "", 0
+	}
+
+	words, ok := russianOrdinalWords(n)
+	if !ok {
+		return "", 0
+	}
+
+	// Inflect the last word according to the suffix
+	cut := strings.LastIndex(words, " ") + 1
+	last := words[cut:]
+	stem := last[:len(last)-len("ый")]
+	if last == "третий" {
+		// The only ordinal with a soft stem: третьего, третья, третье
+		stem = "треть"
+	}
+	switch {
+	case strings.HasSuffix(suffix, "го"):
+		if last == "третий" {
+			last = stem + "его"
+		} else {
+			last = stem + "ого"
+		}
+	case strings.HasSuffix(suffix, "я"):
+		if last == "третий" {
+			last = stem + "я"
+		} else {
+			last = stem + "ая"
+		}
+	case strings.HasSuffix(suffix, "е"):
+		if last == "третий" {
+			last = stem + "е"
+		} else {
+			last = stem + "ое"
+		}
+	case strings.HasSuffix(suffix, "й"):
+		// Masculine nominative, already in place
+	default:
+		return "", 0
+	}
+	return words[:cut] + last, end
+}
+
+// russianOrdinalWords spells out n as a masculine ordinal: only the last
+// component becomes ordinal (двадцать первый, сто сороковой)
+func russianOrdinalWords(n int64) (string, bool) {
+	var prefix int64
+	var last string
+
+	switch low := n % 100; {
+	case low == 0 && n%1000 == 0:
+		if n != 1000 {
+			return "", false
+		}
+		last = "тысячный"
+	case low == 0:
+		prefix = n - n%1000
+		last = russianOrdinalHundreds[(n%1000)/100]
+	case low < 20:
+		prefix = n - low
+		last = russianOrdinalOnes[low]
+	case low%10 == 0:
+		prefix = n - low
+		last = russianOrdinalTens[low/10]
+	default:
+		prefix = n - low%10
+		last = russianOrdinalOnes[low%10]
+	}
+
+	if prefix > 0 {
+		return russianNumber(prefix) + " " + last, true
+	}
+	return last, true
+}
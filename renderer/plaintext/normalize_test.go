@@ -0,0 +1,50 @@
+package plaintext
+
+import "testing"
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		lang, text, want string
+	}{
+		// Titles are expanded only before a name
+		{"en", "Dr. Watson came in.", "Doctor Watson came in."},
+		{"en", "He went to see the Dr.", "He went to see the Dr."},
+		{"en", "“Ask the Dr.”", "“Ask the Dr.”"},
+		{"en", "No. 5", "number five"},
+		{"en", "He said No.", "He said No."},
+		{"ru", "Он жил на ул. Ленина.", "Он жил на улица Ленина."},
+		{"ru", "Это была ул.", "Это была ул."},
+
+		// Other abbreviations keep the period that ends the sentence
+		{"en", "apples, pears, etc.", "apples, pears, et cetera."},
+		{"en", "apples, etc. and more", "apples, et cetera and more"},
+		{"en", "e.g. this", "for example this"},
+		{"ru", "столы, стулья и т. д.", "столы, стулья и так далее."},
+
+		// Currency symbols are read after the amount
+		{"en", "It cost $100.", "It cost one hundred dollars."},
+		{"en", "Only $1 left", "Only one dollar left"},
+		{"en", "£3 and €21", "three pounds and twenty-one euros"},
+		{"en", "It cost 5 €.", "It cost five euros."},
+		{"en", "$1.50 each", "1.50 dollars each"},
+		{"en", "A $ sign", "A $ sign"},
+		{"en", "$5k", "$5k"},
+		{"ru", "Всего $1", "Всего один доллар"},
+		{"ru", "Цена 22₽", "Цена двадцать два рубля"},
+		{"ru", "Цена 5 ₽", "Цена пять рублей"},
+		{"ru", "Всего €1,5", "Всего 1,5 евро"},
+		{"ru", "Всего $1,5", "Всего 1,5 доллара"},
+
+		// Units and numbers as before
+		{"en", "We walked 5 km.", "We walked five kilometers."},
+		{"en", "In 1984 he was 21st.", "In nineteen eighty-four he was twenty-first."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.lang+" "+tt.text, func(t *testing.T) {
+			n := NewRenderer(Config{NormalizeText: true}).newNormalizer(tt.lang)
+			if got := n.normalize(tt.text, false); got != tt.want {
+				t.Errorf("normalize(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
@@ -1,45 +1,65 @@
 package plaintext
 
-import "strings"
+import (
+	"strings"
+	"unicode"
+)
 
-// addPeriods adds periods at the end of paragraphs that don't have punctuation
-func addPeriods(text string) string {
+// headingEnd ends heading lines, and other lines that must not be given a
+// period such as epigraph attributions, until AddPeriods has run
+const headingEnd = "\uE001"
+
+// addPeriods adds periods at the end of paragraphs that don't have punctuation.
+// Lines containing any of the given markers are left alone. Leading
+// whitespace, the indent of epigraphs and blockquotes, is kept.
+func addPeriods(text string, markers []string) string {
 	lines := strings.Split(text, "\n")
 	var result []string
-	
+
 	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if line == "" {
+		line = strings.TrimRightFunc(line, unicode.IsSpace)
+		if strings.TrimSpace(line) == "" {
 			result = append(result, "")
 			continue
 		}
-		
-		// Skip marker lines (TITLE_BREAK, etc.)
-		if strings.Contains(line, "{{") && strings.Contains(line, "}}") {
+
+		// Skip headings and marker lines (TITLE_BREAK, etc.)
+		if strings.Contains(line, headingEnd) || containsMarker(line, markers) {
 			result = append(result, line)
 			continue
 		}
-		
+
 		// Get last rune to handle multi-byte characters
 		runes := []rune(line)
-		if len(runes) == 0 {
-			result = append(result, line)
-			continue
+		if !isTerminalPunct(runes[len(runes)-1]) {
+			line = line + "."
 		}
-		
-		lastRune := runes[len(runes)-1]
-		
-		// Check for sentence-ending punctuation (including curly quotes)
-		if lastRune != '.' && lastRune != '?' && lastRune != '!' &&
-			lastRune != ':' && lastRune != '"' && lastRune != 0x201C && lastRune != 0x201D {
-			// Check for ellipsis
-			if !strings.HasSuffix(line, "...") {
-				line = line + "."
-			}
-		}
-		
+
 		result = append(result, line)
 	}
-	
+
 	return strings.Join(result, "\n")
 }
+
+// isTerminalPunct reports whether a line ending in r needs no period.
+// Combinations like "?!", "?.." and "!»" end in one of these too. Opening
+// quotes (« “ ‘ „) are not among them: a line ending in one is cut short.
+func isTerminalPunct(r rune) bool {
+	switch r {
+	case '.', '?', '!', ':', ';', '…',
+		'"', '\'', ')', ']',
+		'”', '’', '»', // closing curly quotes and guillemets
+		'–', '—': // en and em dash, e.g. "— Иди сюда —"
+		return true
+	}
+	return false
+}
+
+func containsMarker(line string, markers []string) bool {
+	for _, marker := range markers {
+		if strings.Contains(line, marker) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,39 @@
+package plaintext
+
+import "testing"
+
+func TestAddPeriods(t *testing.T) {
+	tests := []struct {
+		name, text, want string
+	}{
+		{"plain", "Он ушёл", "Он ушёл."},
+		{"ended", "Он ушёл!", "Он ушёл!"},
+		{"ellipsis", "Он ушёл…", "Он ушёл…"},
+		{"question in guillemets", "«Куда ты?»", "«Куда ты?»"},
+		{"closing guillemet", "Он сказал «нет»", "Он сказал «нет»"},
+		{"closing curly quote", "He said “no”", "He said “no”"},
+
+		// Dialogue: a dash opens a line, and one ends an interrupted line
+		{"dialogue", "— Иди сюда", "— Иди сюда."},
+		{"dialogue with attribution", "— Иди сюда, — сказал он", "— Иди сюда, — сказал он."},
+		{"interrupted", "— Иди сюда —", "— Иди сюда —"},
+		{"en dash", "Wait –", "Wait –"},
+
+		// A line ending in an opening quote is cut short, not ended
+		{"opening guillemet", "Он сказал: «", "Он сказал: «."},
+		{"opening curly quote", "He said “", "He said “."},
+		{"opening single quote", "He said ‘", "He said ‘."},
+		{"low opening quote", "Er sagte „", "Er sagte „."},
+
+		{"indent kept", "    Мне отмщение", "    Мне отмщение."},
+		{"heading", "Глава" + headingEnd, "Глава" + headingEnd},
+		{"marker", "[[pause]]", "[[pause]]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := addPeriods(tt.text, []string{"[[pause]]"}); got != tt.want {
+				t.Errorf("addPeriods(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
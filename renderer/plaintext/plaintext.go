@@ -1,7 +1,12 @@
 package plaintext
 
 import (
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
 	"strings"
+	"unicode"
 
 	"github.com/vpoluyaktov/biblio-ebook-parser/parser"
 )
@@ -13,11 +18,78 @@ type Renderer struct {
 
 // Config holds configuration for plain text rendering
 type Config struct {
-	AddPeriods    bool // Add periods to paragraphs that don't end with punctuation
-	InsertMarkers bool // Insert SSML markers for TTS pauses
-	NormalizeText bool // Normalize text for speech synthesis
+	AddPeriods      bool    // Add periods to paragraphs that don't end with punctuation
+	InsertMarkers   bool    // Deprecated: use Markers. Same as Markers.HeadingBreak = "{{TITLE_BREAK}}"
+	Markers         Markers // Pause markers for TTS, empty markers are not emitted
+	NormalizeText   bool    // Normalize text for speech synthesis (numbers, abbreviations, units, currencies) in the book's language
+	YearsAsNumbers  bool    // With NormalizeText, read years as plain numbers instead of in pairs ("nineteen eighty-four")
+	InlineNotes     bool    // Read footnotes right after the paragraph that references them
+	WrapColumn      int     // Word-wrap paragraphs at this width in columns, 0 to disable
+	SentencePerLine bool    // Put each sentence of a paragraph on its own line
+	Dehyphenate     bool    // Strip soft hyphens, rejoin words hyphenated across line breaks and paragraphs broken at page ends
+	DescribeImages  bool    // Give images without alt text one naming their place, e.g. "Illustration 2 in chapter The Road"
+	ChunkOverlap    bool    // ChunkChapter repeats the last sentence of each chunk at the start of the next
+
+	// AnnounceChapters opens each chapter with a spoken announcement made
+	// from ChapterAnnouncement, DefaultChapterAnnouncement if empty. Its
+	// placeholders are {index} and {title}.
+	AnnounceChapters    bool
+	ChapterAnnouncement string
+	// IncludeBookIntro opens the book with an introduction made from
+	// BookIntro, DefaultBookIntro if empty, in Book.Intro or at the start
+	// of the full text. Its placeholders are {title}, {author}, {series}
+	// and {seriesIndex}. In templates, a part in square brackets is left
+	// out unless all its placeholders are set, and "|" separates
+	// alternatives tried in order.
+	IncludeBookIntro bool
+	BookIntro        string
+
+	// Options used by RenderFullText only
+	ChapterSeparator  string // Text between chapters, "\n\n\n" if empty
+	TitlePrefix       string // Written before each heading (e.g., "=== ")
+	TitleSuffix       string // Written after each heading (e.g., " ===")
+	IncludeBookHeader bool   // Start with a title/author/series block
+	SkipEmptyChapters bool   // Leave out chapters without text
+
+	// SkipRepeatedHeadings leaves out the leading headings of a chapter that
+	// only repeat its title or the book title (e.g., a banner on every
+	// chapter), so they aren't read twice. Off by default.
+	SkipRepeatedHeadings bool
+
+	// SkipRoles leaves the chapters with these roles (e.g.,
+	// "copyright-page", "dedication") out of Render and RenderFullText, see
+	// parser.Chapter.Role. RenderChapter still renders them.
+	SkipRoles []string
 }
 
+// Markers are tokens inserted into the text for a TTS pipeline to turn into
+// pauses (e.g., "{{TITLE_BREAK}}" or "[[pause:800]]"). The heading marker is
+// appended to the heading line; the others are written on a line of their own.
+type Markers struct {
+	HeadingBreak   string // After each heading
+	ParagraphBreak string // After each paragraph
+	EpigraphBreak  string // After each epigraph
+	ChapterBreak   string // At the end of each chapter
+}
+
+// list returns the configured markers
+func (m Markers) list() []string {
+	var markers []string
+	for _, marker := range []string{m.HeadingBreak, m.ParagraphBreak, m.EpigraphBreak, m.ChapterBreak} {
+		if marker != "" {
+			markers = append(markers, marker)
+		}
+	}
+	return markers
+}
+
+// Internal markers around headings in full-text mode, replaced by TitlePrefix
+// and TitleSuffix once AddPeriods has run so titles aren't given a period
+const (
+	titleStartMarker = "{{TITLE_START}}"
+	titleEndMarker   = "{{TITLE_END}}"
+)
+
 // NewRenderer creates a new plain text renderer
 func NewRenderer(config Config) *Renderer {
 	return &Renderer{Config: config}
@@ -30,6 +102,7 @@ type Book struct {
 	Series       string
 	SeriesNumber string
 	Description  string
+	Intro        string // Spoken introduction, with IncludeBookIntro
 	Chapters     []Chapter
 	Metadata     map[string]string
 }
@@ -40,6 +113,7 @@ type Chapter struct {
 	Content  string
 	ID       string
 	TOCDepth int
+	Role     string
 }
 
 // RenderMetadata converts book metadata to a simple map
@@ -61,8 +135,13 @@ func (r *Renderer) RenderMetadata(book *parser.Book) (interface{}, error) {
 	return metadata, nil
 }
 
-// RenderContent converts book content to plain text format
+// RenderContent converts book content to plain text format, returning a *Book
 func (r *Renderer) RenderContent(book *parser.Book) (interface{}, error) {
+	return r.Render(book)
+}
+
+// Render converts book content to plain text format
+func (r *Renderer) Render(book *parser.Book) (*Book, error) {
 	result := &Book{
 		Title:       book.Metadata.Title,
 		Series:      book.Metadata.Series,
@@ -77,40 +156,247 @@ func (r *Renderer) RenderContent(book *parser.Book) (interface{}, error) {
 		result.Author = book.Metadata.Authors[0].FullName()
 	}
 
-	for _, ch := range book.Content.Chapters {
-		plainText := r.elementsToPlainText(ch.Elements)
-		
-		if r.Config.AddPeriods {
-			plainText = addPeriods(plainText)
+	ctx := r.newRenderContext(book, false)
+	result.Intro = r.introText(book, ctx)
+	for i, ch := range book.Content.Chapters {
+		if r.skipped(ch) {
+			continue
 		}
-
 		result.Chapters = append(result.Chapters, Chapter{
 			Title:    ch.Title,
-			Content:  plainText,
+			Content:  r.chapterText(r.announced(r.chapterElements(book, ch), ch, i), ctx),
 			ID:       ch.ID,
 			TOCDepth: ch.Level,
+			Role:     ch.Role,
 		})
 	}
 
 	return result, nil
 }
 
-func (r *Renderer) elementsToPlainText(elements []parser.Element) string {
+// RenderChapter renders a single chapter, returning a *parser.ChapterNotFoundError for unknown IDs
+func (r *Renderer) RenderChapter(book *parser.Book, chapterID string) (Chapter, error) {
+	ch, err := book.FindChapter(chapterID)
+	if err != nil {
+		return Chapter{}, err
+	}
+
+	index := 0
+	for i := range book.Content.Chapters {
+		if &book.Content.Chapters[i] == ch {
+			index = i
+		}
+	}
+
+	return Chapter{
+		Title:    ch.Title,
+		Content:  r.chapterText(r.announced(r.chapterElements(book, *ch), *ch, index), r.newRenderContext(book, false)),
+		ID:       ch.ID,
+		TOCDepth: ch.Level,
+		Role:     ch.Role,
+	}, nil
+}
+
+// RenderFullText renders the whole book as a single text, using the
+// ChapterSeparator, TitlePrefix, TitleSuffix, IncludeBookHeader and
+// SkipEmptyChapters options
+func (r *Renderer) RenderFullText(book *parser.Book) (string, error) {
+	var text strings.Builder
+	if err := r.RenderTo(&text, book); err != nil {
+		return "", err
+	}
+	return text.String(), nil
+}
+
+// RenderTo writes the same text as RenderFullText to w one chapter at a time,
+// so the whole text never has to be held in memory
+func (r *Renderer) RenderTo(w io.Writer, book *parser.Book) error {
+	separator := r.Config.ChapterSeparator
+	if separator == "" {
+		separator = "\n\n\n"
+	}
+
+	first := true
+	write := func(part string) error {
+		if !first {
+			part = separator + part
+		}
+		first = false
+		if _, err := io.WriteString(w, part); err != nil {
+			return fmt.Errorf("failed to write text: %w", err)
+		}
+		return nil
+	}
+
+	if r.Config.IncludeBookHeader {
+		if header := bookHeader(book.Metadata); header != "" {
+			if err := write(header); err != nil {
+				return err
+			}
+		}
+	}
+
+	ctx := r.newRenderContext(book, true)
+	if intro := r.introText(book, ctx); intro != "" {
+		if err := write(intro); err != nil {
+			return err
+		}
+	}
+
+	for i, ch := range book.Content.Chapters {
+		if r.skipped(ch) {
+			continue
+		}
+		elements := r.chapterElements(book, ch)
+		// An announcement reads the title, so none is added
+		if ch.Title != "" && !r.Config.AnnounceChapters && (len(elements) == 0 || elements[0].Type() != parser.ElementTypeHeading) {
+			elements = append([]parser.Element{&parser.Heading{Text: ch.Title, Level: ch.Level + 1}}, elements...)
+		}
+
+		if r.Config.SkipEmptyChapters && !hasText(ch.Elements) {
+			continue
+		}
+		elements = r.announced(elements, ch, i)
+
+		if content := r.chapterText(elements, ctx); content != "" {
+			if err := write(content); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// skipped reports whether SkipRoles leaves a chapter out
+func (r *Renderer) skipped(ch parser.Chapter) bool {
+	return ch.Role != "" && slices.Contains(r.Config.SkipRoles, ch.Role)
+}
+
+// chapterElements returns the elements to render for a chapter
+func (r *Renderer) chapterElements(book *parser.Book, ch parser.Chapter) []parser.Element {
+	elements := ch.Elements
+	if r.Config.SkipRepeatedHeadings {
+		elements = ch.BodyElements(book.Metadata.Title)
+	}
+	if r.Config.DescribeImages {
+		elements = parser.DescribeImages(elements, ch.Title)
+	}
+	return elements
+}
+
+// introText returns the book intro rendered as the text is, or ""
+func (r *Renderer) introText(book *parser.Book, ctx *renderContext) string {
+	intro := r.bookIntro(book.Metadata)
+	if intro == "" {
+		return ""
+	}
+	return r.chapterText([]parser.Element{&parser.Paragraph{Text: intro}}, ctx)
+}
+
+// bookHeader returns the title, authors and series lines of the book
+func bookHeader(m parser.Metadata) string {
+	var lines []string
+	if m.Title != "" {
+		lines = append(lines, m.Title)
+	}
+	if len(m.Authors) > 0 {
+		names := make([]string, len(m.Authors))
+		for i, a := range m.Authors {
+			names[i] = a.FullName()
+		}
+		lines = append(lines, strings.Join(names, ", "))
+	}
+	if m.Series != "" {
+		series := m.Series
+		if m.SeriesIndex > 0 {
+			series += " #" + strconv.Itoa(m.SeriesIndex)
+		}
+		lines = append(lines, series)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// hasText reports whether elements contain any text besides headings
+func hasText(elements []parser.Element) bool {
+	for _, elem := range elements {
+		if elem.Type() != parser.ElementTypeHeading && elem.CharCount() > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// renderContext holds per-book rendering state
+type renderContext struct {
+	lang         string
+	norm         *normalizer
+	markers      Markers
+	formatTitles bool // Wrap headings in TitlePrefix and TitleSuffix
+}
+
+func (r *Renderer) newRenderContext(book *parser.Book, fullText bool) *renderContext {
+	markers := r.Config.Markers
+	if r.Config.InsertMarkers && markers.HeadingBreak == "" {
+		markers.HeadingBreak = "{{TITLE_BREAK}}"
+	}
+
+	return &renderContext{
+		lang:         book.Metadata.Language,
+		norm:         r.newNormalizer(book.Metadata.Language),
+		markers:      markers,
+		formatTitles: fullText && (r.Config.TitlePrefix != "" || r.Config.TitleSuffix != ""),
+	}
+}
+
+// chapterText renders chapter elements and applies AddPeriods and title formatting
+func (r *Renderer) chapterText(elements []parser.Element, ctx *renderContext) string {
+	plainText := r.elementsToPlainText(elements, ctx)
+
+	if r.Config.AddPeriods {
+		plainText = addPeriods(plainText, append(ctx.markers.list(), titleStartMarker, titleEndMarker))
+	}
+
+	if ctx.markers.ChapterBreak != "" && plainText != "" {
+		plainText += "\n\n" + ctx.markers.ChapterBreak
+	}
+
+	plainText = strings.ReplaceAll(plainText, softBreak, "\n")
+	plainText = strings.ReplaceAll(plainText, headingEnd, "")
+
+	if ctx.formatTitles {
+		plainText = strings.ReplaceAll(plainText, titleStartMarker, r.Config.TitlePrefix)
+		plainText = strings.ReplaceAll(plainText, titleEndMarker, r.Config.TitleSuffix)
+	}
+
+	return plainText
+}
+
+func (r *Renderer) elementsToPlainText(elements []parser.Element, ctx *renderContext) string {
 	var text strings.Builder
+	if r.Config.Dehyphenate {
+		elements = joinBrokenParagraphs(elements)
+	}
 
 	for _, elem := range elements {
 		switch e := elem.(type) {
 		case *parser.Heading:
+			heading := ctx.norm.normalize(e.Text, true)
 			text.WriteString("\n")
-			text.WriteString(e.Text)
-			if r.Config.InsertMarkers {
-				text.WriteString("{{TITLE_BREAK}}")
+			if ctx.formatTitles {
+				text.WriteString(titleStartMarker + heading + titleEndMarker)
+			} else {
+				text.WriteString(heading)
 			}
+			text.WriteString(ctx.markers.HeadingBreak)
+			text.WriteString(headingEnd)
 			text.WriteString("\n\n")
 
 		case *parser.Paragraph:
-			text.WriteString(e.Text)
-			text.WriteString("\n\n")
+			text.WriteString(r.wrap(r.paragraphText(linkedText(e), ctx), ""))
+			text.WriteString("\n")
+			writeMarker(&text, ctx.markers.ParagraphBreak)
+			text.WriteString("\n")
 
 		case *parser.Image:
 			if e.Alt != "" {
@@ -118,6 +404,10 @@ func (r *Renderer) elementsToPlainText(elements []parser.Element) string {
 				text.WriteString(e.Alt)
 				text.WriteString("]\n\n")
 			}
+			if e.Caption != "" && e.Caption != e.Alt {
+				text.WriteString(r.wrap(r.paragraphText(e.Caption, ctx), ""))
+				text.WriteString("\n\n")
+			}
 
 		case *parser.Table:
 			if e.Caption != "" {
@@ -132,13 +422,92 @@ func (r *Renderer) elementsToPlainText(elements []parser.Element) string {
 			text.WriteString("\n")
 
 		case *parser.Epigraph:
-			for _, p := range e.Paragraphs {
-				text.WriteString("    ") // Indent epigraphs
-				text.WriteString(p.Text)
+			for i := range e.Paragraphs {
+				text.WriteString(r.wrap(r.paragraphText(linkedText(&e.Paragraphs[i]), ctx), "    ")) // Indent epigraphs
+				text.WriteString("\n\n")
+			}
+			if e.Author != "" {
+				text.WriteString(r.wrap("\u2014 "+e.Author, "    "))
+				text.WriteString(headingEnd) // An attribution, not a sentence
 				text.WriteString("\n\n")
 			}
+			if ctx.markers.EpigraphBreak != "" {
+				text.WriteString(ctx.markers.EpigraphBreak)
+				text.WriteString("\n\n")
+			}
+
+		case *parser.Blockquote:
+			for i := range e.Paragraphs {
+				text.WriteString(r.wrap(r.paragraphText(linkedText(&e.Paragraphs[i]), ctx), "    "))
+				text.WriteString("\n\n")
+			}
+
+		case *parser.Preformatted:
+			// Code keeps its layout and is never wrapped or normalized
+			text.WriteString(strings.TrimRight(e.Text, "\n"))
+			text.WriteString("\n\n")
+
+		case *parser.Footnote:
+			if r.Config.InlineNotes {
+				if noteText := e.Text(); noteText != "" {
+					text.WriteString(r.wrap("Note: "+r.paragraphText(noteText, ctx), ""))
+					text.WriteString("\n\n")
+				}
+			}
 		}
 	}
 
-	return strings.TrimSpace(text.String())
+	// Keep the indent of a leading epigraph
+	return strings.TrimRightFunc(strings.TrimLeft(text.String(), "\n"), unicode.IsSpace)
+}
+
+// linkedText returns the paragraph text with the target of each http(s)
+// link in parentheses after its text, unless the text already shows it.
+// Internal links are a place in the book with nothing to read out.
+func linkedText(p *parser.Paragraph) string {
+	var out strings.Builder
+	pos := 0
+	for _, link := range p.Links {
+		if link.Start < pos || link.End > len(p.Text) || link.Start >= link.End || link.Internal() {
+			continue
+		}
+		if scheme := strings.ToLower(strings.SplitN(link.Href, ":", 2)[0]); scheme != "http" && scheme != "https" {
+			continue
+		}
+		// The address without its scheme, as link text often gives it
+		_, address, _ := strings.Cut(link.Href, "://")
+		if address == "" || strings.Contains(p.Text[link.Start:link.End], strings.TrimSuffix(address, "/")) {
+			continue
+		}
+		out.WriteString(p.Text[pos:link.End])
+		out.WriteString(" (")
+		out.WriteString(link.Href)
+		out.WriteString(")")
+		pos = link.End
+	}
+	if pos == 0 {
+		return p.Text
+	}
+	out.WriteString(p.Text[pos:])
+	return out.String()
+}
+
+// writeMarker writes a marker on a line of its own
+func writeMarker(text *strings.Builder, marker string) {
+	if marker != "" {
+		text.WriteString(marker)
+		text.WriteString("\n")
+	}
+}
+
+// paragraphText cleans up and normalizes paragraph text and, with SentencePerLine, puts each sentence on its own line
+func (r *Renderer) paragraphText(s string, ctx *renderContext) string {
+	if r.Config.Dehyphenate {
+		s = parser.Dehyphenate(s)
+	}
+	s = ctx.norm.normalize(s, false)
+	if r.Config.SentencePerLine {
+		s = strings.Join(SplitSentences(s, ctx.lang), "\n")
+	}
+	return s
 }
@@ -0,0 +1,73 @@
+package plaintext
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/vpoluyaktov/biblio-ebook-parser/parser"
+	"github.com/vpoluyaktov/biblio-ebook-parser/testutil"
+)
+
+func TestLinkTargets(t *testing.T) {
+	text := "See the site, chapter two, example.com and the mail."
+	link := func(word, href string) parser.Link {
+		start := strings.Index(text, word)
+		return parser.Link{Start: start, End: start + len(word), Href: href}
+	}
+	p := &parser.Paragraph{Text: text, Links: []parser.Link{
+		link("the site", "https://example.org/book"),
+		link("chapter two", "#ch2"),
+		link("example.com", "http://example.com/"),
+		link("the mail", "mailto:author@example.org"),
+	}}
+	want := "See the site (https://example.org/book), chapter two, example.com and the mail."
+
+	if got := render(Config{}, p); got != want {
+		t.Errorf("paragraph:\n%s\nwant:\n%s", got, want)
+	}
+	quote := &parser.Blockquote{Paragraphs: []parser.Paragraph{*p}}
+	if got := render(Config{}, quote); got != "    "+want {
+		t.Errorf("blockquote:\n%s\nwant:\n    %s", got, want)
+	}
+}
+
+// ocrChapter reads the OCR'd chapter fixture, a heading and paragraphs
+// separated by blank lines, with the page numbers of the scan as paragraphs
+func ocrChapter(t *testing.T) []parser.Element {
+	data, err := os.ReadFile(filepath.Join("testdata", "ocr-chapter.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocks := strings.Split(strings.TrimSpace(string(data)), "\n\n")
+	elements := []parser.Element{&parser.Heading{Text: blocks[0], Level: 1}}
+	for _, block := range blocks[1:] {
+		elements = append(elements, &parser.Paragraph{Text: block})
+	}
+	return elements
+}
+
+func TestDehyphenateOCRChapter(t *testing.T) {
+	elements := ocrChapter(t)
+	got := render(Config{Dehyphenate: true, WrapColumn: 72}, elements...)
+	testutil.GoldenBytes(t, filepath.Join("testdata", "ocr-chapter.golden.txt"), []byte(got+"\n"))
+
+	// Without the option, the text is as OCR left it
+	if got := render(Config{}, elements...); !strings.Contains(got, "posses-\nsion") || !strings.Contains(got, "impa-\n\n2\n\ntiently") {
+		t.Errorf("text changed without Dehyphenate:\n%s", got)
+	}
+}
+
+func TestJoinBrokenParagraphsKeepsLinks(t *testing.T) {
+	first := &parser.Paragraph{Text: "See the site of the pub-", Links: []parser.Link{{Start: 4, End: 12, Href: "https://example.org"}}}
+	second := &parser.Paragraph{Text: "  lisher for the list.", Links: []parser.Link{{Start: 19, End: 21, Href: "https://example.com/list"}}}
+	got := render(Config{Dehyphenate: true}, first, &parser.Paragraph{Text: "12"}, second)
+	want := "See the site (https://example.org) of the publisher for the list (https://example.com/list)."
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	if first.Text != "See the site of the pub-" || len(first.Links) != 1 {
+		t.Errorf("the book's paragraph changed: %+v", first)
+	}
+}
@@ -0,0 +1,242 @@
+package plaintext
+
+import (
+	"strings"
+	"unicode"
+)
+
+// sentenceAbbreviations lists, per language, lowercase abbreviations (without
+// the final period) after which a period doesn't end a sentence
+var sentenceAbbreviations = map[string]map[string]bool{
+	"en": wordSet(
+		"mr", "mrs", "ms", "dr", "prof", "st", "jr", "sr", "vs", "e.g", "i.e", "cf",
+		"no", "capt", "gen", "lt", "col", "sgt", "mt", "fig", "vol", "ch", "pp",
+		"approx", "dept", "inc", "ltd", "co", "rev", "hon", "gov", "sen", "rep",
+	),
+	"ru": wordSet(
+		"т.е", "т.к", "т.н", "т.ч", "им", "ул", "г", "гг", "см", "стр", "рис", "проф",
+		"акад", "напр", "тов", "гр", "ст", "с", "ок", "пр", "доц", "млн", "млрд", "тыс",
+	),
+}
+
+func wordSet(words ...string) map[string]bool {
+	set := make(map[string]bool, len(words))
+	for _, w := range words {
+		set[w] = true
+	}
+	return set
+}
+
+// SplitSentences splits text into sentences. A sentence ends at ".", "!", "?"
+// or "…" (with any closing quotes and brackets that follow) when the next
+// sentence starts with something other than a lowercase letter. Known
+// abbreviations of the language ("Mr.", "т.е."), initials ("J. R. R.") and
+// dialogue continuations ("Stop! — he said", "«Стой!» — крикнул он") don't end
+// a sentence, nor do terminators inside quoted speech. Line breaks always do.
+// When lang is empty, the abbreviations of all known languages are used.
+func SplitSentences(text string, lang string) []string {
+	abbreviations := abbreviationsFor(lang)
+
+	var sentences []string
+	for _, line := range strings.Split(text, "\n") {
+		runes := []rune(line)
+		start := 0
+		for _, end := range append(sentenceEnds(runes, abbreviations), len(runes)) {
+			if s := strings.TrimSpace(string(runes[start:end])); s != "" {
+				sentences = append(sentences, s)
+			}
+			start = end
+		}
+	}
+	return sentences
+}
+
+// abbreviationsFor returns the sentence abbreviations of a language, those of
+// all languages when lang is empty, or the English ones when it is unknown
+func abbreviationsFor(lang string) map[string]bool {
+	lang = primaryLanguage(lang)
+	if lang == "" {
+		return allSentenceAbbreviations
+	}
+	if abbreviations := sentenceAbbreviations[lang]; abbreviations != nil {
+		return abbreviations
+	}
+	return sentenceAbbreviations["en"]
+}
+
+var allSentenceAbbreviations = func() map[string]bool {
+	all := make(map[string]bool)
+	for _, abbreviations := range sentenceAbbreviations {
+		for abbr := range abbreviations {
+			all[abbr] = true
+		}
+	}
+	return all
+}()
+
+// sentenceEnds returns the positions in a single line where sentences end,
+// not counting the end of the line. Whitespace after a sentence belongs to
+// the next one.
+func sentenceEnds(runes []rune, abbreviations map[string]bool) []int {
+	var ends []int
+	start := 0
+	for i := 0; i < len(runes); i++ {
+		if !isSentenceEnd(runes[i]) {
+			continue
+		}
+
+		// Take the whole run of terminators ("?!", "...") and closing punctuation
+		end := i + 1
+		for end < len(runes) && isSentenceEnd(runes[end]) {
+			end++
+		}
+		for end < len(runes) && isClosingPunct(runes[end]) {
+			end++
+		}
+		i = end - 1
+
+		if end == len(runes) || !unicode.IsSpace(runes[end]) {
+			continue
+		}
+		if !startsSentence(runes[end:]) {
+			continue
+		}
+		if runes[end-1] == '.' && isAbbreviation(runes[start:end], abbreviations) {
+			continue
+		}
+		if insideQuote(runes[:end]) && hasClosingQuote(runes[end:]) {
+			// Sentences within quoted speech stay with the sentence quoting them
+			continue
+		}
+
+		ends = append(ends, end)
+		start = end
+	}
+	return ends
+}
+
+// startsSentence reports whether the text after a terminator begins a new
+// sentence: it must not start with a lowercase letter, directly or after a
+// dialogue dash
+func startsSentence(rest []rune) bool {
+	i := 0
+	for i < len(rest) && unicode.IsSpace(rest[i]) {
+		i++
+	}
+	if i == len(rest) {
+		return true
+	}
+	if isDash(rest[i]) {
+		j := i + 1
+		for j < len(rest) && unicode.IsSpace(rest[j]) {
+			j++
+		}
+		if j < len(rest) && unicode.IsLower(rest[j]) {
+			return false
+		}
+		return true
+	}
+	return !unicode.IsLower(rest[i]) && rest[i] != ',' && rest[i] != ';'
+}
+
+// isAbbreviation reports whether the sentence candidate ends with a known
+// abbreviation or an initial
+func isAbbreviation(candidate []rune, abbreviations map[string]bool) bool {
+	end := len(candidate)
+	for end > 0 && isClosingPunct(candidate[end-1]) {
+		end--
+	}
+	if end == 0 || candidate[end-1] != '.' {
+		return false
+	}
+	wordEnd := end - 1
+	wordStart := wordEnd
+	for wordStart > 0 && !unicode.IsSpace(candidate[wordStart-1]) && !isOpeningPunct(candidate[wordStart-1]) {
+		wordStart--
+	}
+	word := candidate[wordStart:wordEnd]
+	if len(word) == 0 {
+		return false
+	}
+
+	// Initials such as "J." in "J. R. R. Tolkien"
+	if len(word) == 1 && unicode.IsUpper(word[0]) {
+		return true
+	}
+	return abbreviations[strings.ToLower(string(word))]
+}
+
+// insideQuote reports whether a quotation opened in runes is still open at its end
+func insideQuote(runes []rune) bool {
+	depth := 0
+	straight := false
+	lowOpen := false // „ is closed by “
+	for _, r := range runes {
+		switch r {
+		case '«':
+			depth++
+		case '»', '”':
+			if depth > 0 {
+				depth--
+			}
+		case '„':
+			depth++
+			lowOpen = true
+		case '“':
+			if lowOpen {
+				lowOpen = false
+				if depth > 0 {
+					depth--
+				}
+			} else {
+				depth++
+			}
+		case '"':
+			straight = !straight
+		}
+	}
+	return depth > 0 || straight
+}
+
+func hasClosingQuote(runes []rune) bool {
+	for _, r := range runes {
+		switch r {
+		case '"', '»', '”', '“':
+			return true
+		}
+	}
+	return false
+}
+
+func isSentenceEnd(r rune) bool {
+	return r == '.' || r == '!' || r == '?' || r == '…'
+}
+
+func isClosingPunct(r rune) bool {
+	switch r {
+	case '"', '\'', '»', '”', '’', ')', ']':
+		return true
+	}
+	return false
+}
+
+func isOpeningPunct(r rune) bool {
+	switch r {
+	case '"', '\'', '«', '“', '„', '‘', '(', '[':
+		return true
+	}
+	return false
+}
+
+func isDash(r rune) bool {
+	return r == '—' || r == '–' || r == '-'
+}
+
+// primaryLanguage returns the primary subtag of a language tag, lowercased
+func primaryLanguage(lang string) string {
+	lang = strings.ToLower(strings.TrimSpace(lang))
+	if i := strings.IndexAny(lang, "-_"); i >= 0 {
+		lang = lang[:i]
+	}
+	return lang
+}
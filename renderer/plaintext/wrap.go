@@ -0,0 +1,120 @@
+package plaintext
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// softBreak separates wrapped lines of one paragraph until AddPeriods has run,
+// so that only the paragraph's last line can be given a period
+const softBreak = "\uE000"
+
+// wrapToken is a piece of a line that must not be broken
+type wrapToken struct {
+	text  string
+	width int
+	space bool // Separated from the previous token by a space
+}
+
+// wrap word-wraps each line of s at Config.WrapColumn, prefixing every
+// resulting line with indent. Without a wrap column it only indents s.
+func (r *Renderer) wrap(s, indent string) string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		if r.Config.WrapColumn <= 0 {
+			lines[i] = indent + line
+			continue
+		}
+		lines[i] = strings.Join(wrapLine(line, r.Config.WrapColumn, indent), softBreak)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// wrapLine breaks a line at spaces (or between CJK characters) so that no
+// line is wider than width columns, unless a single word is wider
+func wrapLine(line string, width int, indent string) []string {
+	tokens := wrapTokens(line)
+	if len(tokens) == 0 {
+		return []string{indent}
+	}
+
+	indentWidth := textWidth(indent)
+	var lines []string
+	var cur strings.Builder
+	curWidth := 0
+
+	for _, tok := range tokens {
+		need := tok.width
+		if cur.Len() > 0 && tok.space {
+			need++
+		}
+		if cur.Len() > 0 && indentWidth+curWidth+need > width {
+			lines = append(lines, indent+cur.String())
+			cur.Reset()
+			curWidth = 0
+			need = tok.width
+		}
+		if cur.Len() > 0 && tok.space {
+			cur.WriteByte(' ')
+		}
+		cur.WriteString(tok.text)
+		curWidth += need
+	}
+	lines = append(lines, indent+cur.String())
+
+	return lines
+}
+
+// wrapTokens splits a line into unbreakable tokens. Words are separated by
+// whitespace; CJK characters can be broken between without a space.
+func wrapTokens(line string) []wrapToken {
+	var tokens []wrapToken
+	for _, word := range strings.Fields(line) {
+		space := true
+		start := 0
+		for i, r := range word {
+			if !isWide(r) {
+				continue
+			}
+			if i > start {
+				tokens = append(tokens, wrapToken{text: word[start:i], width: textWidth(word[start:i]), space: space})
+				space = false
+			}
+			end := i + utf8.RuneLen(r)
+			// Keep closing punctuation with the character before it
+			for end < len(word) {
+				next, size := utf8.DecodeRuneInString(word[end:])
+				if isWide(next) || !unicode.IsPunct(next) {
+					break
+				}
+				end += size
+			}
+			tokens = append(tokens, wrapToken{text: word[i:end], width: textWidth(word[i:end]), space: space})
+			space = false
+			start = end
+		}
+		if start < len(word) {
+			tokens = append(tokens, wrapToken{text: word[start:], width: textWidth(word[start:]), space: space})
+		}
+	}
+	return tokens
+}
+
+// textWidth returns the display width of s in columns, counting CJK characters as two
+func textWidth(s string) int {
+	width := 0
+	for _, r := range s {
+		if isWide(r) {
+			width += 2
+		} else {
+			width++
+		}
+	}
+	return width
+}
+
+func isWide(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) ||
+		(r >= 0x3000 && r <= 0x303F) || (r >= 0xFF01 && r <= 0xFF60)
+}
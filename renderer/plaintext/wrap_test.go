@@ -0,0 +1,104 @@
+package plaintext
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/vpoluyaktov/biblio-ebook-parser/parser"
+)
+
+// render renders elements as the content of a chapter
+func render(config Config, elements ...parser.Element) string {
+	r := NewRenderer(config)
+	return r.chapterText(elements, r.newRenderContext(&parser.Book{}, false))
+}
+
+const russianParagraph = "Все счастливые семьи похожи друг на друга, каждая несчастливая семья " +
+	"несчастлива по-своему. Все смешалось в доме Облонских. Жена узнала, что муж был в связи " +
+	"с бывшею в их доме француженкою-гувернанткой, и объявила мужу, что не может жить с ним в одном доме"
+
+func TestWrapRussianParagraph(t *testing.T) {
+	got := render(Config{WrapColumn: 40, AddPeriods: true}, &parser.Paragraph{Text: russianParagraph})
+
+	lines := strings.Split(got, "\n")
+	if len(lines) < 5 {
+		t.Fatalf("got %d lines, want the paragraph wrapped:\n%s", len(lines), got)
+	}
+	for i, line := range lines {
+		// Columns are runes, not bytes: each Cyrillic letter is two bytes
+		if width := textWidth(line); width > 40 {
+			t.Errorf("line %d is %d columns wide: %q", i+1, width, line)
+		}
+	}
+	// Only the paragraph's last line is given a period
+	if joined := strings.Join(lines, " "); joined != russianParagraph+"." {
+		t.Errorf("wrapped text does not join back to the paragraph:\n%s", joined)
+	}
+}
+
+func TestWrapOverlongToken(t *testing.T) {
+	url := "https://example.com/" + strings.Repeat("very-long-path/", 4) + "index.html"
+	got := render(Config{WrapColumn: 20, AddPeriods: true}, &parser.Paragraph{Text: "See " + url + " for more"})
+
+	want := "See\n" + url + "\nfor more."
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestWrapCJK(t *testing.T) {
+	got := render(Config{WrapColumn: 10}, &parser.Paragraph{Text: "吾輩は猫である。名前はまだ無い。"})
+	for _, line := range strings.Split(got, "\n") {
+		if width := textWidth(line); width > 10 {
+			t.Errorf("line is %d columns wide: %q", width, line)
+		}
+	}
+	if strings.ReplaceAll(got, "\n", "") != "吾輩は猫である。名前はまだ無い。" {
+		t.Errorf("wrapped text lost characters: %q", got)
+	}
+}
+
+func TestEpigraphIndentWithPeriods(t *testing.T) {
+	epigraph := &parser.Epigraph{
+		Paragraphs: []parser.Paragraph{{Text: "Мне отмщение, и Аз воздам"}},
+		Author:     "Послание к Римлянам",
+	}
+	tests := []struct {
+		name   string
+		config Config
+		want   string
+	}{
+		{
+			name:   "unwrapped",
+			config: Config{AddPeriods: true},
+			want:   "    Мне отмщение, и Аз воздам.\n\n    — Послание к Римлянам",
+		},
+		{
+			name:   "wrapped",
+			config: Config{AddPeriods: true, WrapColumn: 20},
+			want:   "    Мне отмщение, и\n    Аз воздам.\n\n    — Послание к\n    Римлянам",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The epigraph comes first, so its indent is also the chapter's
+			if got := render(tt.config, epigraph); got != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBlockquoteIndent(t *testing.T) {
+	got := render(Config{AddPeriods: true, WrapColumn: 30, SentencePerLine: true},
+		&parser.Heading{Text: "Глава", Level: 1},
+		&parser.Blockquote{Paragraphs: []parser.Paragraph{{Text: "Первая фраза цитаты, довольно длинная. Вторая фраза"}}},
+		&parser.Paragraph{Text: "Обычный абзац"},
+	)
+	want := "Глава\n\n" +
+		"    Первая фраза цитаты,\n    довольно длинная.\n    Вторая фраза.\n\n" +
+		"Обычный абзац."
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
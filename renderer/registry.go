@@ -0,0 +1,63 @@
+package renderer
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/vpoluyaktov/biblio-ebook-parser/parser"
+)
+
+var (
+	globalRegistry = &Registry{
+		renderers: make(map[string]Renderer),
+	}
+	registryMutex sync.RWMutex
+)
+
+// Registry holds registered renderers for different output formats
+type Registry struct {
+	renderers map[string]Renderer
+}
+
+// Register adds a renderer for a specific output format to the global registry
+func Register(name string, r Renderer) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	globalRegistry.renderers[strings.ToLower(name)] = r
+}
+
+// GetRenderer returns a renderer for the specified output format from the global registry
+func GetRenderer(name string) (Renderer, error) {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+
+	r, ok := globalRegistry.renderers[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("no renderer registered for format: %s", name)
+	}
+	return r, nil
+}
+
+// Render is a convenience function to render book content using the global registry
+func Render(name string, book *parser.Book) (interface{}, error) {
+	r, err := GetRenderer(name)
+	if err != nil {
+		return nil, err
+	}
+	return r.RenderContent(book)
+}
+
+// RegisteredRenderers returns a sorted list of all registered output formats
+func RegisteredRenderers() []string {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+
+	names := make([]string, 0, len(globalRegistry.renderers))
+	for name := range globalRegistry.renderers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
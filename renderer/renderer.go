@@ -1,6 +1,10 @@
 package renderer
 
-import "github.com/vpoluyaktov/biblio-ebook-parser/parser"
+import (
+	"fmt"
+
+	"github.com/vpoluyaktov/biblio-ebook-parser/parser"
+)
 
 // Renderer converts a parsed Book into a specific output format
 type Renderer interface {
@@ -10,3 +14,20 @@ type Renderer interface {
 	// RenderContent converts book content to the target format
 	RenderContent(book *parser.Book) (interface{}, error)
 }
+
+// RenderAs renders book content with r and asserts the result to T, e.g.
+// RenderAs[*html.BookContent](r, book)
+func RenderAs[T any](r Renderer, book *parser.Book) (T, error) {
+	var zero T
+
+	content, err := r.RenderContent(book)
+	if err != nil {
+		return zero, err
+	}
+
+	typed, ok := content.(T)
+	if !ok {
+		return zero, fmt.Errorf("renderer %T returned %T, not %T", r, content, zero)
+	}
+	return typed, nil
+}
@@ -0,0 +1,441 @@
+// Package testutil builds small EPUB and FB2 books in memory for tests, and
+// compares parsed books to golden JSON snapshots, so tests of extraction
+// need no binary fixtures.
+package testutil
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"html"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// TOCFormat is the kind of table of contents an EPUB has
+type TOCFormat int
+
+const (
+	TOCDefault TOCFormat = iota // A navigation document for version 3, an NCX for 2
+	TOCNav                      // EPUB 3 navigation document
+	TOCNCX                      // EPUB 2 NCX
+	TOCBoth                     // Both, as EPUB 3 books readable by EPUB 2 readers have
+)
+
+// EPUB describes a minimal EPUB to build. The zero value builds a valid
+// EPUB 3 with one empty chapter.
+type EPUB struct {
+	Title      string   // "Untitled" if empty
+	Authors    []string // dc:creator values
+	Language   string   // "en" if empty
+	Identifier string   // "urn:uuid:00000000-0000-0000-0000-000000000000" if empty
+	Subjects   []string // dc:subject values
+	Metadata   string   // Raw elements added to the OPF metadata (e.g., a dc:date)
+
+	// Version is the EPUB version the package and its metadata follow, 2
+	// or 3, 3 if 0
+	Version int
+	TOC     TOCFormat
+
+	Chapters []EPUBChapter
+	Cover    []byte // Cover image, its type sniffed from its bytes
+
+	// Files are added to the package as they are, by path relative to the
+	// OPF (e.g., "images/map.png" or "css/book.css"), and to the manifest
+	// with a type guessed from the extension
+	Files map[string][]byte
+
+	// XMLEncoding is the encoding the container, OPF, TOC and chapters are
+	// written in: "utf-8" (the default), "utf-16le" or "utf-16be", which
+	// they declare as UTF-16
+	XMLEncoding string
+	XMLBOM      bool // Start those files with a byte order mark
+
+	// Broken modes, for testing error handling
+	OmitContainer bool // Leave out META-INF/container.xml
+	EncodeHrefs   bool // Percent-encode every character of the hrefs but letters, digits and "/"
+}
+
+// EPUBChapter is a content document of an EPUB, in spine order
+type EPUBChapter struct {
+	// Title is the entry in the table of contents; the chapter is left out
+	// of it if empty
+	Title string
+	// Body is the XHTML inside <body>. If empty, the title as <h1>
+	// and the paragraphs are used.
+	Body       string
+	Paragraphs []string // Plain text paragraphs, escaped
+	Type       string   // epub:type of <body> (e.g., "bodymatter")
+	File       string   // File name relative to the OPF, "chapterN.xhtml" if empty
+	Level      int      // Nesting level in the table of contents, 0 for top
+}
+
+// Bytes builds the EPUB. The result only depends on the description, so it
+// can be compared or hashed.
+func (e EPUB) Bytes() []byte {
+	data, err := e.build()
+	if err != nil {
+		// Building in memory only fails for file names a zip can't hold
+		panic(fmt.Sprintf("testutil: %v", err))
+	}
+	return data
+}
+
+// WriteFile builds the EPUB and writes it to a file
+func (e EPUB) WriteFile(filePath string) error {
+	data, err := e.build()
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filePath, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write EPUB: %w", err)
+	}
+	return nil
+}
+
+func (e EPUB) build() ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+
+	// The mimetype must be the first entry and stored uncompressed
+	mimetype, err := zw.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	if err != nil {
+		return nil, fmt.Errorf("failed to write mimetype: %w", err)
+	}
+	if _, err := mimetype.Write([]byte("application/epub+zip")); err != nil {
+		return nil, fmt.Errorf("failed to write mimetype: %w", err)
+	}
+
+	chapters := e.chapters()
+	var files []zipFile
+	if !e.OmitContainer {
+		files = append(files, zipFile{"META-INF/container.xml", []byte(epubContainer)})
+	}
+	files = append(files, zipFile{"OEBPS/content.opf", []byte(e.packageDocument(chapters))})
+	if e.hasNav() {
+		files = append(files, zipFile{"OEBPS/nav.xhtml", []byte(e.navDocument(chapters))})
+	}
+	if e.hasNCX() {
+		files = append(files, zipFile{"OEBPS/toc.ncx", []byte(e.ncx(chapters))})
+	}
+	for _, ch := range chapters {
+		files = append(files, zipFile{"OEBPS/" + ch.File, []byte(e.chapterDocument(ch))})
+	}
+	for i := range files {
+		if files[i].data, err = e.encodeXML(files[i].data); err != nil {
+			return nil, err
+		}
+	}
+	if len(e.Cover) > 0 {
+		files = append(files, zipFile{"OEBPS/" + e.coverFile(), e.Cover})
+	}
+	for _, name := range sortedKeys(e.Files) {
+		files = append(files, zipFile{"OEBPS/" + name, e.Files[name]})
+	}
+
+	for _, f := range files {
+		fw, err := zw.Create(f.name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", f.name, err)
+		}
+		if _, err := fw.Write(f.data); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", f.name, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finish EPUB: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// encodeXML converts an XML document written in UTF-8 to XMLEncoding
+func (e EPUB) encodeXML(doc []byte) ([]byte, error) {
+	var enc encoding.Encoding
+	bom := []byte{0xEF, 0xBB, 0xBF}
+	switch strings.ToLower(e.XMLEncoding) {
+	case "", "utf-8":
+	case "utf-16le":
+		enc, bom = unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM), []byte{0xFF, 0xFE}
+	case "utf-16be":
+		enc, bom = unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM), []byte{0xFE, 0xFF}
+	default:
+		return nil, fmt.Errorf("unsupported XML encoding %q", e.XMLEncoding)
+	}
+
+	if enc != nil {
+		doc = bytes.Replace(doc, []byte(`encoding="UTF-8"`), []byte(`encoding="UTF-16"`), 1)
+		var err error
+		if doc, err = enc.NewEncoder().Bytes(doc); err != nil {
+			return nil, fmt.Errorf("failed to encode XML as %s: %w", e.XMLEncoding, err)
+		}
+	}
+	if e.XMLBOM {
+		doc = append(bom, doc...)
+	}
+	return doc, nil
+}
+
+// zipFile is an entry of a built archive
+type zipFile struct {
+	name string
+	data []byte
+}
+
+const epubContainer = `<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>
+`
+
+func (e EPUB) version() int {
+	if e.Version == 2 {
+		return 2
+	}
+	return 3
+}
+
+func (e EPUB) hasNav() bool {
+	return e.TOC == TOCNav || e.TOC == TOCBoth || e.TOC == TOCDefault && e.version() == 3
+}
+
+func (e EPUB) hasNCX() bool {
+	return e.TOC == TOCNCX || e.TOC == TOCBoth || e.TOC == TOCDefault && e.version() == 2
+}
+
+// href returns the href of a package file, percent-encoded with EncodeHrefs
+func (e EPUB) href(name string) string {
+	if !e.EncodeHrefs {
+		return name
+	}
+	var href strings.Builder
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c == '/' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' {
+			href.WriteByte(c)
+		} else {
+			fmt.Fprintf(&href, "%%%02X", c)
+		}
+	}
+	return href.String()
+}
+
+// chapters returns the chapters with defaults filled in, at least one
+func (e EPUB) chapters() []EPUBChapter {
+	chapters := append([]EPUBChapter(nil), e.Chapters...)
+	if len(chapters) == 0 {
+		chapters = []EPUBChapter{{}}
+	}
+	for i := range chapters {
+		if chapters[i].File == "" {
+			chapters[i].File = fmt.Sprintf("chapter%d.xhtml", i+1)
+		}
+	}
+	return chapters
+}
+
+func (e EPUB) coverFile() string {
+	ext := ".jpg"
+	switch http.DetectContentType(e.Cover) {
+	case "image/png":
+		ext = ".png"
+	case "image/gif":
+		ext = ".gif"
+	case "image/webp":
+		ext = ".webp"
+	}
+	return "images/cover" + ext
+}
+
+func (e EPUB) packageDocument(chapters []EPUBChapter) string {
+	var opf strings.Builder
+	fmt.Fprintf(&opf, "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<package xmlns=\"http://www.idpf.org/2007/opf\" version=\"%d.0\" unique-identifier=\"book-id\">\n", e.version())
+	opf.WriteString("<metadata xmlns:dc=\"http://purl.org/dc/elements/1.1/\" xmlns:opf=\"http://www.idpf.org/2007/opf\">\n")
+	fmt.Fprintf(&opf, "<dc:identifier id=\"book-id\">%s</dc:identifier>\n", escape(orDefault(e.Identifier, "urn:uuid:00000000-0000-0000-0000-000000000000")))
+	fmt.Fprintf(&opf, "<dc:title>%s</dc:title>\n", escape(orDefault(e.Title, "Untitled")))
+	fmt.Fprintf(&opf, "<dc:language>%s</dc:language>\n", escape(orDefault(e.Language, "en")))
+	for i, author := range e.Authors {
+		if e.version() == 2 {
+			fmt.Fprintf(&opf, "<dc:creator opf:role=\"aut\">%s</dc:creator>\n", escape(author))
+			continue
+		}
+		fmt.Fprintf(&opf, "<dc:creator id=\"creator%d\">%s</dc:creator>\n", i+1, escape(author))
+		fmt.Fprintf(&opf, "<meta refines=\"#creator%d\" property=\"role\" scheme=\"marc:relators\">aut</meta>\n", i+1)
+	}
+	for _, subject := range e.Subjects {
+		fmt.Fprintf(&opf, "<dc:subject>%s</dc:subject>\n", escape(subject))
+	}
+	if e.version() == 3 {
+		opf.WriteString("<meta property=\"dcterms:modified\">2000-01-01T00:00:00Z</meta>\n")
+	}
+	if len(e.Cover) > 0 {
+		opf.WriteString("<meta name=\"cover\" content=\"cover-image\"/>\n")
+	}
+	opf.WriteString(e.Metadata)
+	opf.WriteString("</metadata>\n<manifest>\n")
+
+	if e.hasNav() {
+		fmt.Fprintf(&opf, "<item id=\"nav\" href=\"%s\" media-type=\"application/xhtml+xml\" properties=\"nav\"/>\n", e.href("nav.xhtml"))
+	}
+	if e.hasNCX() {
+		fmt.Fprintf(&opf, "<item id=\"ncx\" href=\"%s\" media-type=\"application/x-dtbncx+xml\"/>\n", e.href("toc.ncx"))
+	}
+	for i, ch := range chapters {
+		fmt.Fprintf(&opf, "<item id=\"chapter%d\" href=\"%s\" media-type=\"application/xhtml+xml\"/>\n", i+1, escape(e.href(ch.File)))
+	}
+	if len(e.Cover) > 0 {
+		properties := ""
+		if e.version() == 3 {
+			properties = ` properties="cover-image"`
+		}
+		fmt.Fprintf(&opf, "<item id=\"cover-image\" href=\"%s\" media-type=\"%s\"%s/>\n", e.href(e.coverFile()), http.DetectContentType(e.Cover), properties)
+	}
+	for i, name := range sortedKeys(e.Files) {
+		fmt.Fprintf(&opf, "<item id=\"file%d\" href=\"%s\" media-type=\"%s\"/>\n", i+1, escape(e.href(name)), mediaType(name, e.Files[name]))
+	}
+
+	spine := "<spine>\n"
+	if e.hasNCX() {
+		spine = "<spine toc=\"ncx\">\n"
+	}
+	opf.WriteString("</manifest>\n" + spine)
+	for i := range chapters {
+		fmt.Fprintf(&opf, "<itemref idref=\"chapter%d\"/>\n", i+1)
+	}
+	opf.WriteString("</spine>\n</package>\n")
+	return opf.String()
+}
+
+func (e EPUB) chapterDocument(ch EPUBChapter) string {
+	var doc strings.Builder
+	doc.WriteString(xhtmlHeader(orDefault(e.Language, "en"), ch.Title))
+	if ch.Type != "" {
+		fmt.Fprintf(&doc, "<body epub:type=\"%s\">\n", escape(ch.Type))
+	} else {
+		doc.WriteString("<body>\n")
+	}
+	if ch.Body != "" {
+		doc.WriteString(ch.Body)
+	} else {
+		if ch.Title != "" {
+			fmt.Fprintf(&doc, "<h1>%s</h1>\n", escape(ch.Title))
+		}
+		for _, p := range ch.Paragraphs {
+			fmt.Fprintf(&doc, "<p>%s</p>\n", escape(p))
+		}
+	}
+	doc.WriteString("\n</body>\n</html>\n")
+	return doc.String()
+}
+
+// navDocument lists the titled chapters, nested by their Level
+func (e EPUB) navDocument(chapters []EPUBChapter) string {
+	var nav strings.Builder
+	nav.WriteString(xhtmlHeader(orDefault(e.Language, "en"), "Contents"))
+	nav.WriteString("<body>\n<nav epub:type=\"toc\" id=\"toc\">\n<ol>\n")
+
+	depth, open := 0, false
+	for _, ch := range chapters {
+		if ch.Title == "" {
+			continue
+		}
+		level := max(ch.Level, 0)
+		if !open {
+			level = 0
+		}
+		switch {
+		case level > depth:
+			level = depth + 1
+			nav.WriteString("\n<ol>\n")
+		case open:
+			nav.WriteString("</li>\n")
+			for ; depth > level; depth-- {
+				nav.WriteString("</ol>\n</li>\n")
+			}
+		}
+		depth, open = level, true
+		fmt.Fprintf(&nav, "<li><a href=\"%s\">%s</a>", escape(e.href(ch.File)), escape(ch.Title))
+	}
+	if open {
+		nav.WriteString("</li>\n")
+	}
+	for ; depth > 0; depth-- {
+		nav.WriteString("</ol>\n</li>\n")
+	}
+
+	nav.WriteString("</ol>\n</nav>\n</body>\n</html>\n")
+	return nav.String()
+}
+
+// ncx lists the titled chapters as flat navPoints
+func (e EPUB) ncx(chapters []EPUBChapter) string {
+	var ncx strings.Builder
+	ncx.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<ncx xmlns=\"http://www.daisy.org/z3986/2005/ncx/\" version=\"2005-1\">\n<head>\n")
+	fmt.Fprintf(&ncx, "<meta name=\"dtb:uid\" content=\"%s\"/>\n</head>\n", escape(orDefault(e.Identifier, "urn:uuid:00000000-0000-0000-0000-000000000000")))
+	fmt.Fprintf(&ncx, "<docTitle><text>%s</text></docTitle>\n<navMap>\n", escape(orDefault(e.Title, "Untitled")))
+	order := 0
+	for _, ch := range chapters {
+		if ch.Title == "" {
+			continue
+		}
+		order++
+		fmt.Fprintf(&ncx, "<navPoint id=\"navpoint-%d\" playOrder=\"%d\"><navLabel><text>%s</text></navLabel><content src=\"%s\"/></navPoint>\n",
+			order, order, escape(ch.Title), escape(e.href(ch.File)))
+	}
+	ncx.WriteString("</navMap>\n</ncx>\n")
+	return ncx.String()
+}
+
+func xhtmlHeader(lang, title string) string {
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" xml:lang="` + escape(lang) + `" lang="` + escape(lang) + `">
+<head>
+<title>` + escape(title) + `</title>
+</head>
+`
+}
+
+// mediaType guesses the media type of a package file from its extension,
+// or else its bytes
+func mediaType(name string, data []byte) string {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".xhtml", ".html", ".htm":
+		return "application/xhtml+xml"
+	case ".css":
+		return "text/css"
+	case ".svg":
+		return "image/svg+xml"
+	case ".ncx":
+		return "application/x-dtbncx+xml"
+	}
+	mediaType, _, _ := strings.Cut(http.DetectContentType(data), ";")
+	return mediaType
+}
+
+func escape(s string) string {
+	return html.EscapeString(s)
+}
+
+func orDefault(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
+
+func sortedKeys(m map[string][]byte) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,171 @@
+// Package epubtest builds EPUBs in memory with a chained builder, for unit
+// tests of code that reads EPUBs. It is a separate package from the parsers,
+// so production binaries don't include it.
+//
+//	data := epubtest.New().
+//		WithTitle("Fixture").
+//		WithChapter("One", "<p>First paragraph.</p>").
+//		WithCover(png).
+//		Bytes()
+package epubtest
+
+import (
+	"bytes"
+
+	"github.com/vpoluyaktov/biblio-ebook-parser/testutil"
+)
+
+// Builder builds an EPUB. Its methods change the builder and return it, for
+// chaining
+type Builder struct {
+	epub testutil.EPUB
+}
+
+// New returns a builder of a valid EPUB 3 with a navigation document
+func New() *Builder {
+	return &Builder{}
+}
+
+// WithTitle sets the dc:title
+func (b *Builder) WithTitle(title string) *Builder {
+	b.epub.Title = title
+	return b
+}
+
+// WithAuthor adds a dc:creator
+func (b *Builder) WithAuthor(name string) *Builder {
+	b.epub.Authors = append(b.epub.Authors, name)
+	return b
+}
+
+// WithLanguage sets the dc:language
+func (b *Builder) WithLanguage(lang string) *Builder {
+	b.epub.Language = lang
+	return b
+}
+
+// WithIdentifier sets the dc:identifier
+func (b *Builder) WithIdentifier(id string) *Builder {
+	b.epub.Identifier = id
+	return b
+}
+
+// WithSubject adds a dc:subject
+func (b *Builder) WithSubject(subject string) *Builder {
+	b.epub.Subjects = append(b.epub.Subjects, subject)
+	return b
+}
+
+// WithMetadata adds raw elements to the OPF metadata (e.g.,
+// `<dc:date>2001-05-01</dc:date>`)
+func (b *Builder) WithMetadata(xml string) *Builder {
+	b.epub.Metadata += xml
+	return b
+}
+
+// WithChapter adds a chapter listed in the table of contents under title,
+// with body as the XHTML inside <body>
+func (b *Builder) WithChapter(title, body string) *Builder {
+	b.epub.Chapters = append(b.epub.Chapters, testutil.EPUBChapter{Title: title, Body: body})
+	return b
+}
+
+// WithChapterFile adds a chapter as WithChapter does, in a content document
+// of the given name relative to the OPF (e.g., "text/chapter 1.xhtml")
+func (b *Builder) WithChapterFile(file, title, body string) *Builder {
+	b.epub.Chapters = append(b.epub.Chapters, testutil.EPUBChapter{Title: title, Body: body, File: file})
+	return b
+}
+
+// WithCover sets the cover image
+func (b *Builder) WithCover(image []byte) *Builder {
+	b.epub.Cover = image
+	return b
+}
+
+// WithFile adds a file to the package and its manifest, by path relative to
+// the OPF
+func (b *Builder) WithFile(name string, data []byte) *Builder {
+	if b.epub.Files == nil {
+		b.epub.Files = make(map[string][]byte)
+	}
+	b.epub.Files[name] = data
+	return b
+}
+
+// WithXMLEncoding writes the container, OPF, TOC and chapters in encoding,
+// "utf-8", "utf-16le" or "utf-16be", with a byte order mark if bom
+func (b *Builder) WithXMLEncoding(encoding string, bom bool) *Builder {
+	b.epub.XMLEncoding = encoding
+	b.epub.XMLBOM = bom
+	return b
+}
+
+// EPUB2 writes the package and its metadata the EPUB 2 way, with an NCX
+// unless a table of contents is picked
+func (b *Builder) EPUB2() *Builder {
+	b.epub.Version = 2
+	return b
+}
+
+// EPUB3 writes the package and its metadata the EPUB 3 way, the default,
+// with a navigation document unless a table of contents is picked
+func (b *Builder) EPUB3() *Builder {
+	b.epub.Version = 3
+	return b
+}
+
+// WithNCX makes the table of contents an NCX only
+func (b *Builder) WithNCX() *Builder {
+	b.epub.TOC = testutil.TOCNCX
+	return b
+}
+
+// WithNav makes the table of contents a navigation document only
+func (b *Builder) WithNav() *Builder {
+	b.epub.TOC = testutil.TOCNav
+	return b
+}
+
+// WithNavAndNCX writes both a navigation document and an NCX
+func (b *Builder) WithNavAndNCX() *Builder {
+	b.epub.TOC = testutil.TOCBoth
+	return b
+}
+
+// WithoutContainer leaves out META-INF/container.xml, which parsers need to
+// find the OPF
+func (b *Builder) WithoutContainer() *Builder {
+	b.epub.OmitContainer = true
+	return b
+}
+
+// WithEncodedHrefs percent-encodes the hrefs of the manifest and the table
+// of contents, so "chapter1.xhtml" is written "chapter1%2Exhtml"
+func (b *Builder) WithEncodedHrefs() *Builder {
+	b.epub.EncodeHrefs = true
+	return b
+}
+
+// EPUB returns the description the builder holds, for changes the builder
+// has no method for
+func (b *Builder) EPUB() testutil.EPUB {
+	return b.epub
+}
+
+// Bytes builds the EPUB
+func (b *Builder) Bytes() []byte {
+	return b.epub.Bytes()
+}
+
+// Reader builds the EPUB for the ParseReader functions of the parsers and
+// fast extractors, which take the reader and its size
+func (b *Builder) Reader() (*bytes.Reader, int64) {
+	data := b.Bytes()
+	return bytes.NewReader(data), int64(len(data))
+}
+
+// WriteFile builds the EPUB and writes it to a file, for Parse
+func (b *Builder) WriteFile(filePath string) error {
+	return b.epub.WriteFile(filePath)
+}
@@ -0,0 +1,230 @@
+package testutil
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/ianaindex"
+)
+
+// FB2 describes a minimal FictionBook 2 document to build. The zero value
+// builds a valid FB2 with one empty section.
+type FB2 struct {
+	Title      string   // "Untitled" if empty
+	Authors    []string // "First Last" or "First Middle Last"; a single word is a nickname
+	Language   string   // "en" if empty
+	Genres     []string // FB2 genre codes
+	Annotation string   // Plain text, escaped
+	Date       string   // title-info date (e.g., "2001")
+	Sequence   string   // Series name
+	SeqNumber  int      // Number in the series, with Sequence
+
+	Sections []FB2Section
+	Notes    []FB2Note         // Notes body entries, linked from Markup as #ID
+	Cover    []byte            // Cover image, its type sniffed from its bytes
+	Binaries map[string][]byte // Images by id, shown by FB2Section.Images or Markup
+
+	// Encoding is the charset the document is written in and declares (e.g.,
+	// "windows-1251"), UTF-8 if empty. Characters it lacks are written as
+	// character references.
+	Encoding string
+
+	// Broken modes, for exercising the parser's sanitizer
+	UnescapedAmpersands bool // Write "&" in text as is
+	InvalidTagStarts    bool // Write "<" in text as is (e.g., "x <5 y")
+}
+
+// FB2Section is a section of the main body
+type FB2Section struct {
+	Title      string
+	Paragraphs []string // Plain text paragraphs, escaped
+	// Markup is raw FB2 markup written after the paragraphs (e.g.,
+	// `<p>See<a l:href="#n1">1</a></p>`)
+	Markup   string
+	Images   []string     // Ids of Binaries shown after the markup
+	Sections []FB2Section // Nested sections
+}
+
+// FB2Note is a section of the notes body
+type FB2Note struct {
+	ID    string
+	Title string
+	Text  string // Plain text, escaped
+}
+
+// Bytes builds the FB2 document. It panics if the Encoding is unknown.
+func (f FB2) Bytes() []byte {
+	data, err := f.build()
+	if err != nil {
+		panic(fmt.Sprintf("testutil: %v", err))
+	}
+	return data
+}
+
+// Zip builds the FB2 document stored in a zip as book.fb2, as .fb2.zip
+// files are. It panics if the Encoding is unknown.
+func (f FB2) Zip() []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	fw, err := zw.Create("book.fb2")
+	if err == nil {
+		_, err = fw.Write(f.Bytes())
+	}
+	if err == nil {
+		err = zw.Close()
+	}
+	if err != nil {
+		panic(fmt.Sprintf("testutil: failed to zip FB2: %v", err))
+	}
+	return buf.Bytes()
+}
+
+// WriteFile builds the FB2 document and writes it to a file
+func (f FB2) WriteFile(filePath string) error {
+	data, err := f.build()
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filePath, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write FB2: %w", err)
+	}
+	return nil
+}
+
+func (f FB2) build() ([]byte, error) {
+	var enc encoding.Encoding
+	if f.Encoding != "" && !strings.EqualFold(f.Encoding, "utf-8") {
+		var err error
+		if enc, err = ianaindex.IANA.Encoding(f.Encoding); err != nil || enc == nil {
+			return nil, fmt.Errorf("unsupported encoding %q", f.Encoding)
+		}
+	}
+
+	var doc strings.Builder
+	fmt.Fprintf(&doc, "<?xml version=\"1.0\" encoding=\"%s\"?>\n", escape(orDefault(f.Encoding, "UTF-8")))
+	doc.WriteString("<FictionBook xmlns=\"http://www.gribuser.ru/xml/fictionbook/2.0\" xmlns:l=\"http://www.w3.org/1999/xlink\">\n")
+	doc.WriteString("<description>\n<title-info>\n")
+	for _, genre := range f.Genres {
+		fmt.Fprintf(&doc, "<genre>%s</genre>\n", escape(genre))
+	}
+	for _, author := range f.Authors {
+		doc.WriteString(fb2Author(author))
+	}
+	fmt.Fprintf(&doc, "<book-title>%s</book-title>\n", f.text(orDefault(f.Title, "Untitled")))
+	if f.Annotation != "" {
+		fmt.Fprintf(&doc, "<annotation><p>%s</p></annotation>\n", f.text(f.Annotation))
+	}
+	if f.Date != "" {
+		fmt.Fprintf(&doc, "<date>%s</date>\n", escape(f.Date))
+	}
+	if len(f.Cover) > 0 {
+		doc.WriteString("<coverpage><image l:href=\"#cover\"/></coverpage>\n")
+	}
+	fmt.Fprintf(&doc, "<lang>%s</lang>\n", escape(orDefault(f.Language, "en")))
+	if f.Sequence != "" {
+		number := ""
+		if f.SeqNumber > 0 {
+			number = fmt.Sprintf(" number=\"%d\"", f.SeqNumber)
+		}
+		fmt.Fprintf(&doc, "<sequence name=\"%s\"%s/>\n", escape(f.Sequence), number)
+	}
+	doc.WriteString("</title-info>\n</description>\n<body>\n")
+
+	sections := f.Sections
+	if len(sections) == 0 {
+		sections = []FB2Section{{}}
+	}
+	for _, section := range sections {
+		f.writeSection(&doc, section)
+	}
+	doc.WriteString("</body>\n")
+
+	if len(f.Notes) > 0 {
+		doc.WriteString("<body name=\"notes\">\n")
+		for _, note := range f.Notes {
+			fmt.Fprintf(&doc, "<section id=\"%s\">", escape(note.ID))
+			if note.Title != "" {
+				fmt.Fprintf(&doc, "<title><p>%s</p></title>", f.text(note.Title))
+			}
+			fmt.Fprintf(&doc, "<p>%s</p></section>\n", f.text(note.Text))
+		}
+		doc.WriteString("</body>\n")
+	}
+
+	if len(f.Cover) > 0 {
+		writeBinary(&doc, "cover", f.Cover)
+	}
+	for _, id := range sortedKeys(f.Binaries) {
+		writeBinary(&doc, id, f.Binaries[id])
+	}
+	doc.WriteString("</FictionBook>\n")
+
+	if enc == nil {
+		return []byte(doc.String()), nil
+	}
+	data, err := encoding.HTMLEscapeUnsupported(enc.NewEncoder()).String(doc.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode FB2 as %s: %w", f.Encoding, err)
+	}
+	return []byte(data), nil
+}
+
+// text escapes text for the document, but for what the broken modes leave
+func (f FB2) text(s string) string {
+	s = escape(s)
+	if f.UnescapedAmpersands {
+		s = strings.ReplaceAll(s, "&amp;", "&")
+	}
+	if f.InvalidTagStarts {
+		s = strings.ReplaceAll(s, "&lt;", "<")
+	}
+	return s
+}
+
+func (f FB2) writeSection(doc *strings.Builder, section FB2Section) {
+	doc.WriteString("<section>\n")
+	if section.Title != "" {
+		fmt.Fprintf(doc, "<title><p>%s</p></title>\n", f.text(section.Title))
+	}
+	for _, p := range section.Paragraphs {
+		fmt.Fprintf(doc, "<p>%s</p>\n", f.text(p))
+	}
+	doc.WriteString(section.Markup)
+	for _, id := range section.Images {
+		fmt.Fprintf(doc, "<image l:href=\"#%s\"/>\n", escape(id))
+	}
+	for _, sub := range section.Sections {
+		f.writeSection(doc, sub)
+	}
+	if section.Title == "" && len(section.Paragraphs) == 0 && section.Markup == "" && len(section.Images) == 0 && len(section.Sections) == 0 {
+		// A section needs content
+		doc.WriteString("<empty-line/>\n")
+	}
+	doc.WriteString("</section>\n")
+}
+
+func writeBinary(doc *strings.Builder, id string, data []byte) {
+	contentType, _, _ := strings.Cut(http.DetectContentType(data), ";")
+	fmt.Fprintf(doc, "<binary id=\"%s\" content-type=\"%s\">%s</binary>\n", escape(id), contentType, base64.StdEncoding.EncodeToString(data))
+}
+
+// fb2Author writes an author from a full name
+func fb2Author(name string) string {
+	parts := strings.Fields(name)
+	switch len(parts) {
+	case 0:
+		return ""
+	case 1:
+		return fmt.Sprintf("<author><nickname>%s</nickname></author>\n", escape(parts[0]))
+	case 2:
+		return fmt.Sprintf("<author><first-name>%s</first-name><last-name>%s</last-name></author>\n", escape(parts[0]), escape(parts[1]))
+	}
+	return fmt.Sprintf("<author><first-name>%s</first-name><middle-name>%s</middle-name><last-name>%s</last-name></author>\n",
+		escape(parts[0]), escape(strings.Join(parts[1:len(parts)-1], " ")), escape(parts[len(parts)-1]))
+}
@@ -0,0 +1,188 @@
+// Package fb2test builds FictionBook 2 documents in memory with a chained
+// builder, for unit tests of code that reads FB2. It is a separate package
+// from the parsers, so production binaries don't include it.
+//
+//	data := fb2test.New().
+//		WithTitle("Fixture").
+//		WithAuthor("Lev Tolstoy").
+//		WithSection("One", "First paragraph.").
+//		WithEncoding("windows-1251").
+//		Bytes()
+package fb2test
+
+import (
+	"bytes"
+
+	"github.com/vpoluyaktov/biblio-ebook-parser/testutil"
+)
+
+// Builder builds an FB2 document. Its methods change the builder and return
+// it, for chaining.
+type Builder struct {
+	fb2 testutil.FB2
+}
+
+// New returns a builder of a valid UTF-8 FB2 document
+func New() *Builder {
+	return &Builder{}
+}
+
+// WithTitle sets the book-title
+func (b *Builder) WithTitle(title string) *Builder {
+	b.fb2.Title = title
+	return b
+}
+
+// WithAuthor adds an author by full name, "First Last" or "First Middle
+// Last"; a single word is a nickname
+func (b *Builder) WithAuthor(name string) *Builder {
+	b.fb2.Authors = append(b.fb2.Authors, name)
+	return b
+}
+
+// WithLanguage sets the lang
+func (b *Builder) WithLanguage(lang string) *Builder {
+	b.fb2.Language = lang
+	return b
+}
+
+// WithGenre adds an FB2 genre code
+func (b *Builder) WithGenre(code string) *Builder {
+	b.fb2.Genres = append(b.fb2.Genres, code)
+	return b
+}
+
+// WithAnnotation sets the annotation, as plain text
+func (b *Builder) WithAnnotation(text string) *Builder {
+	b.fb2.Annotation = text
+	return b
+}
+
+// WithDate sets the title-info date
+func (b *Builder) WithDate(date string) *Builder {
+	b.fb2.Date = date
+	return b
+}
+
+// WithSequence sets the series and the number of the book in it, 0 for none
+func (b *Builder) WithSequence(name string, number int) *Builder {
+	b.fb2.Sequence, b.fb2.SeqNumber = name, number
+	return b
+}
+
+// WithSection adds a section of the main body with plain text paragraphs
+func (b *Builder) WithSection(title string, paragraphs ...string) *Builder {
+	b.fb2.Sections = append(b.fb2.Sections, testutil.FB2Section{Title: title, Paragraphs: paragraphs})
+	return b
+}
+
+// WithSectionMarkup adds a section of the main body with raw FB2 markup
+// (e.g., `<p>See<a l:href="#n1" type="note">1</a></p>`)
+func (b *Builder) WithSectionMarkup(title, markup string) *Builder {
+	b.fb2.Sections = append(b.fb2.Sections, testutil.FB2Section{Title: title, Markup: markup})
+	return b
+}
+
+// WithSubsection adds a section nested in the last section of the main
+// body, which it adds first if there is none
+func (b *Builder) WithSubsection(title string, paragraphs ...string) *Builder {
+	if len(b.fb2.Sections) == 0 {
+		b.fb2.Sections = append(b.fb2.Sections, testutil.FB2Section{})
+	}
+	last := &b.fb2.Sections[len(b.fb2.Sections)-1]
+	last.Sections = append(last.Sections, testutil.FB2Section{Title: title, Paragraphs: paragraphs})
+	return b
+}
+
+// WithSections adds sections of any depth to the main body
+func (b *Builder) WithSections(sections ...testutil.FB2Section) *Builder {
+	b.fb2.Sections = append(b.fb2.Sections, sections...)
+	return b
+}
+
+// WithNote adds a note to the notes body, linked as "#" + id
+func (b *Builder) WithNote(id, text string) *Builder {
+	b.fb2.Notes = append(b.fb2.Notes, testutil.FB2Note{ID: id, Title: id, Text: text})
+	return b
+}
+
+// WithCover sets the cover image
+func (b *Builder) WithCover(image []byte) *Builder {
+	b.fb2.Cover = image
+	return b
+}
+
+// WithBinary adds a binary, for images referenced from markup as "#" + id
+func (b *Builder) WithBinary(id string, data []byte) *Builder {
+	if b.fb2.Binaries == nil {
+		b.fb2.Binaries = make(map[string][]byte)
+	}
+	b.fb2.Binaries[id] = data
+	return b
+}
+
+// WithImage adds an image as a binary and shows it at the end of the last
+// section of the main body, which it adds first if there is none
+func (b *Builder) WithImage(id string, data []byte) *Builder {
+	b.WithBinary(id, data)
+	if len(b.fb2.Sections) == 0 {
+		b.fb2.Sections = append(b.fb2.Sections, testutil.FB2Section{})
+	}
+	last := &b.fb2.Sections[len(b.fb2.Sections)-1]
+	last.Images = append(last.Images, id)
+	return b
+}
+
+// WithEncoding writes and declares the document in a charset (e.g.,
+// "windows-1251" or "KOI8-R")
+func (b *Builder) WithEncoding(charset string) *Builder {
+	b.fb2.Encoding = charset
+	return b
+}
+
+// WithUnescapedAmpersands writes "&" in text as is, as broken converters do
+func (b *Builder) WithUnescapedAmpersands() *Builder {
+	b.fb2.UnescapedAmpersands = true
+	return b
+}
+
+// WithInvalidTagStarts writes "<" in text as is, so "x <5 y" looks like the
+// start of a tag
+func (b *Builder) WithInvalidTagStarts() *Builder {
+	b.fb2.InvalidTagStarts = true
+	return b
+}
+
+// FB2 returns the description the builder holds, for changes the builder
+// has no method for
+func (b *Builder) FB2() testutil.FB2 {
+	return b.fb2
+}
+
+// Bytes builds the FB2 document. It panics if the encoding is unknown.
+func (b *Builder) Bytes() []byte {
+	return b.fb2.Bytes()
+}
+
+// Zip builds the FB2 document in a zip, as a .fb2.zip file
+func (b *Builder) Zip() []byte {
+	return b.fb2.Zip()
+}
+
+// Reader builds the FB2 document for the ParseReader functions of the parser
+// and fast extractor, which take the reader and its size
+func (b *Builder) Reader() (*bytes.Reader, int64) {
+	data := b.Bytes()
+	return bytes.NewReader(data), int64(len(data))
+}
+
+// ZipReader builds the FB2 document in a zip, as Reader does
+func (b *Builder) ZipReader() (*bytes.Reader, int64) {
+	data := b.Zip()
+	return bytes.NewReader(data), int64(len(data))
+}
+
+// WriteFile builds the FB2 document and writes it to a file, for Parse
+func (b *Builder) WriteFile(filePath string) error {
+	return b.fb2.WriteFile(filePath)
+}
@@ -0,0 +1,153 @@
+package fb2test_test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+
+	fb2parser "github.com/vpoluyaktov/biblio-ebook-parser/formats/fb2"
+	"github.com/vpoluyaktov/biblio-ebook-parser/parser"
+	"github.com/vpoluyaktov/biblio-ebook-parser/testutil/fb2test"
+)
+
+var pngImage = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR\x00\x00\x00\x01\x00\x00\x00\x01\x08\x06\x00\x00\x00\x1f\x15\xc4\x89")
+
+func fixture() *fb2test.Builder {
+	return fb2test.New().
+		WithTitle("Война & мир").
+		WithAuthor("Лев Николаевич Толстой").
+		WithLanguage("ru").
+		WithGenre("prose_classic").
+		WithAnnotation("Роман в четырёх томах (<5).").
+		WithDate("1869").
+		WithSequence("Эпопея", 2).
+		WithSection("Часть первая", "Первый абзац.", "Второй абзац.").
+		WithSubsection("Глава I", "Вложенный текст.").
+		WithSectionMarkup("Часть вторая", `<p>Ссылка<a l:href="#n1" type="note">1</a>.</p>`).
+		WithImage("map.png", pngImage).
+		WithNote("n1", "Примечание.").
+		WithCover(pngImage)
+}
+
+// parse parses the document; the strict parser fails on malformed markup
+// instead of repairing it
+func parse(t *testing.T, data []byte, strict bool) (*parser.Book, error) {
+	t.Helper()
+	p := fb2parser.NewParser()
+	p.Strict = strict
+	p.ParseNotes = true
+	return p.ParseReader(bytes.NewReader(data), int64(len(data)))
+}
+
+// wellFormed reports the first XML error of a UTF-8 document, nil if there
+// is none
+func wellFormed(data []byte) error {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		if _, err := d.Token(); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+func checkBook(t *testing.T, book *parser.Book) {
+	t.Helper()
+	m := book.Metadata
+	if m.Title != "Война & мир" || m.Language != "ru" || m.Series != "Эпопея" || m.SeriesIndex != 2 {
+		t.Errorf("metadata = %q, %q, %q #%d", m.Title, m.Language, m.Series, m.SeriesIndex)
+	}
+	if len(m.Authors) != 1 || m.Authors[0].FullName() != "Лев Николаевич Толстой" {
+		t.Errorf("authors = %+v", m.Authors)
+	}
+	if m.Description != "Роман в четырёх томах (<5)." {
+		t.Errorf("description = %q", m.Description)
+	}
+	if !bytes.Equal(m.CoverData, pngImage) {
+		t.Errorf("cover has %d bytes, want %d", len(m.CoverData), len(pngImage))
+	}
+
+	var titles []string
+	for _, ch := range book.Content.Chapters {
+		titles = append(titles, ch.Title)
+	}
+	if got := strings.Join(titles, ", "); got != "Часть первая, Глава I, Часть вторая" {
+		t.Errorf("chapters = %q", got)
+	}
+	if len(book.Search("Второй абзац", parser.SearchOptions{})) != 1 {
+		t.Error("the paragraphs of the first section are missing")
+	}
+	if len(book.Notes) != 1 {
+		t.Errorf("notes = %+v", book.Notes)
+	}
+}
+
+func TestBuildsValidFB2(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"utf-8", fixture().Bytes()},
+		{"windows-1251", fixture().WithEncoding("windows-1251").Bytes()},
+		{"koi8-r", fixture().WithEncoding("KOI8-R").Bytes()},
+		{"zip", fixture().Zip()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			book, err := parse(t, tt.data, true)
+			if err != nil {
+				t.Fatalf("strict ParseReader: %v", err)
+			}
+			if len(book.Warnings) > 0 {
+				t.Errorf("warnings: %q", book.Warnings)
+			}
+			checkBook(t, book)
+		})
+	}
+}
+
+func TestEncodingIsDeclaredAndUsed(t *testing.T) {
+	data := fixture().WithEncoding("windows-1251").Bytes()
+	if !bytes.HasPrefix(data, []byte(`<?xml version="1.0" encoding="windows-1251"?>`)) {
+		t.Errorf("declaration: %q", data[:min(len(data), 60)])
+	}
+	// "Война" in windows-1251
+	if !bytes.Contains(data, []byte("\xc2\xee\xe9\xed\xe0")) || bytes.Contains(data, []byte("Война")) {
+		t.Error("the title is not written in windows-1251")
+	}
+}
+
+func TestBrokenModes(t *testing.T) {
+	tests := []struct {
+		name   string
+		build  *fb2test.Builder
+		broken string
+	}{
+		{"unescaped ampersands", fixture().WithUnescapedAmpersands(), "Война & мир"},
+		{"invalid tag starts", fixture().WithInvalidTagStarts(), "(<5)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := tt.build.Bytes()
+			if !bytes.Contains(data, []byte(tt.broken)) {
+				t.Errorf("document does not contain %q as is", tt.broken)
+			}
+			if wellFormed(data) == nil {
+				t.Fatal("document is well-formed XML")
+			}
+			if _, err := parse(t, data, true); err == nil {
+				t.Error("strict ParseReader accepted the document")
+			}
+
+			// The default parser repairs it
+			book, err := parse(t, data, false)
+			if err != nil {
+				t.Fatalf("ParseReader: %v", err)
+			}
+			checkBook(t, book)
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package testutil
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/vpoluyaktov/biblio-ebook-parser/parser"
+	"github.com/vpoluyaktov/biblio-ebook-parser/renderer/json"
+)
+
+// UpdateGoldenEnv is the environment variable that makes Golden and
+// GoldenBytes write the golden files instead of comparing to them:
+//
+//	UPDATE_GOLDEN=1 go test ./...
+const UpdateGoldenEnv = "UPDATE_GOLDEN"
+
+// Golden compares a book, as the pretty-printed JSON document of the json
+// renderer, to the golden file testdata/<name>.golden.json of the test's
+// package
+func Golden(t testing.TB, name string, book *parser.Book) {
+	t.Helper()
+	var doc bytes.Buffer
+	if err := json.NewRenderer(json.Config{Pretty: true}).RenderTo(&doc, book); err != nil {
+		t.Fatalf("failed to render %s: %v", name, err)
+	}
+	GoldenBytes(t, filepath.Join("testdata", name+".golden.json"), doc.Bytes())
+}
+
+// GoldenBytes compares got to the golden file at goldenPath, failing the
+// test at the first differing line. With UPDATE_GOLDEN set, it writes got
+// to the file instead.
+func GoldenBytes(t testing.TB, goldenPath string, got []byte) {
+	t.Helper()
+	if os.Getenv(UpdateGoldenEnv) != "" {
+		if err := os.MkdirAll(filepath.Dir(goldenPath), 0o755); err != nil {
+			t.Fatalf("failed to create golden directory: %v", err)
+		}
+		if err := os.WriteFile(goldenPath, got, 0o644); err != nil {
+			t.Fatalf("failed to write golden file: %v", err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(goldenPath)
+	if err != nil {
+		t.Fatalf("failed to read golden file (run with %s=1 to create it): %v", UpdateGoldenEnv, err)
+	}
+	if diff := firstDiff(want, got); diff != "" {
+		t.Errorf("%s differs (run with %s=1 to update it):\n%s", goldenPath, UpdateGoldenEnv, diff)
+	}
+}
+
+// firstDiff describes the first line where got differs from want, empty if
+// they are the same
+func firstDiff(want, got []byte) string {
+	if bytes.Equal(want, got) {
+		return ""
+	}
+	wantLines := strings.Split(string(want), "\n")
+	gotLines := strings.Split(string(got), "\n")
+	for i := 0; i < max(len(wantLines), len(gotLines)); i++ {
+		var w, g string
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if w != g {
+			return fmt.Sprintf("line %d:\n  want: %s\n  got:  %s", i+1, w, g)
+		}
+	}
+	return "contents differ"
+}
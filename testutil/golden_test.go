@@ -0,0 +1,101 @@
+package testutil
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/vpoluyaktov/biblio-ebook-parser/parser"
+)
+
+// recorder is a testing.TB that records failures instead of reporting them
+type recorder struct {
+	testing.TB
+	failures []string
+	fatal    bool
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...any) {
+	r.failures = append(r.failures, fmt.Sprintf(format, args...))
+}
+
+func (r *recorder) Fatalf(format string, args ...any) {
+	r.Errorf(format, args...)
+	r.fatal = true
+}
+
+func TestGoldenBytesUpdateFlow(t *testing.T) {
+	goldenPath := filepath.Join(t.TempDir(), "testdata", "book.golden.json")
+
+	// A missing golden file fails and says how to create it
+	rec := &recorder{TB: t}
+	GoldenBytes(rec, goldenPath, []byte("one\ntwo\n"))
+	if !rec.fatal || !strings.Contains(strings.Join(rec.failures, ""), "UPDATE_GOLDEN=1") {
+		t.Errorf("missing golden file: failures %q", rec.failures)
+	}
+
+	// UPDATE_GOLDEN writes it, creating the directory
+	t.Setenv(UpdateGoldenEnv, "1")
+	rec = &recorder{TB: t}
+	GoldenBytes(rec, goldenPath, []byte("one\ntwo\n"))
+	if len(rec.failures) > 0 {
+		t.Errorf("update failed: %q", rec.failures)
+	}
+	if data, err := os.ReadFile(goldenPath); err != nil || string(data) != "one\ntwo\n" {
+		t.Errorf("golden file = %q, %v", data, err)
+	}
+
+	// Without it, the same output passes and a change fails at its line
+	t.Setenv(UpdateGoldenEnv, "")
+	rec = &recorder{TB: t}
+	GoldenBytes(rec, goldenPath, []byte("one\ntwo\n"))
+	if len(rec.failures) > 0 {
+		t.Errorf("unchanged output failed: %q", rec.failures)
+	}
+	rec = &recorder{TB: t}
+	GoldenBytes(rec, goldenPath, []byte("one\nthree\n"))
+	if len(rec.failures) != 1 || rec.fatal || !strings.Contains(rec.failures[0], "line 2:\n  want: two\n  got:  three") {
+		t.Errorf("changed output: failures %q", rec.failures)
+	}
+}
+
+func TestGoldenRendersJSON(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+
+	book := &parser.Book{Metadata: parser.Metadata{Title: "Golden"}}
+	t.Setenv(UpdateGoldenEnv, "1")
+	Golden(t, "book", book)
+	data, err := os.ReadFile(filepath.Join(dir, "testdata", "book.golden.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "\n    \"title\": \"Golden\"") {
+		t.Errorf("golden file is not the pretty JSON document:\n%s", data)
+	}
+
+	t.Setenv(UpdateGoldenEnv, "")
+	Golden(t, "book", book)
+}
+
+func TestFirstDiff(t *testing.T) {
+	tests := []struct {
+		want, got string
+		diff      string
+	}{
+		{"a\nb", "a\nb", ""},
+		{"a\nb", "a\nc", "line 2:\n  want: b\n  got:  c"},
+		{"a", "a\nb", "line 2:\n  want: \n  got:  b"},
+		{"a\nb", "a", "line 2:\n  want: b\n  got:  "},
+		{"a\n", "a", "contents differ"},
+	}
+	for _, tt := range tests {
+		if diff := firstDiff([]byte(tt.want), []byte(tt.got)); diff != tt.diff {
+			t.Errorf("firstDiff(%q, %q) = %q, want %q", tt.want, tt.got, diff, tt.diff)
+		}
+	}
+}
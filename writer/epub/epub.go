@@ -0,0 +1,325 @@
+// Package epub serializes parsed books into EPUB 3 files.
+package epub
+
+import (
+	"archive/zip"
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/vpoluyaktov/biblio-ebook-parser/parser"
+)
+
+// Options controls EPUB generation
+type Options struct {
+	// Identifier is used as dc:identifier when the book has no ISBN or UUID.
+	// If empty, a stable urn:uuid is derived from the book's fingerprints.
+	Identifier string
+	// Modified is written as dcterms:modified; the current time is used if zero
+	Modified time.Time
+	// Subjects maps the book's genres to the dc:subject values written, such
+	// as genres.EPUBSubjects for books from FB2; as they are if nil
+	Subjects func(genres []string) []string
+}
+
+// imageTypes maps supported EPUB core media types to file extensions
+var imageTypes = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// resource is a file in the package other than a chapter
+type resource struct {
+	ID         string
+	Href       string // Relative to the OPF
+	MediaType  string
+	Properties string
+	Data       []byte
+}
+
+// chapterFile is a chapter rendered to XHTML
+type chapterFile struct {
+	ID    string
+	Href  string
+	Title string
+	Level int
+	Body  string
+}
+
+// writer accumulates package contents before they are zipped
+type writer struct {
+	book     *parser.Book
+	opts     Options
+	lang     string
+	images   []resource
+	chapters []chapterFile
+}
+
+// FileName returns a file name for the book written by WriteEPUB, made
+// from its author and title by parser.Metadata.FileStem (e.g.,
+// "tolstoi_voina-i-mir.epub")
+func FileName(book *parser.Book) string {
+	return book.Metadata.FileStem(parser.SlugOptions{}) + ".epub"
+}
+
+// WriteEPUB writes book to w as an EPUB 3 container
+func WriteEPUB(book *parser.Book, w io.Writer, opts Options) error {
+	ew := &writer{book: book, opts: opts, lang: book.Metadata.Language}
+	if ew.lang == "" {
+		ew.lang = "und"
+	}
+	if ew.opts.Modified.IsZero() {
+		ew.opts.Modified = time.Now()
+	}
+
+	ew.buildChapters()
+
+	zw := zip.NewWriter(w)
+
+	// The mimetype must be the first entry and stored uncompressed
+	mimetype, err := zw.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	if err != nil {
+		return fmt.Errorf("failed to write mimetype: %w", err)
+	}
+	if _, err := io.WriteString(mimetype, "application/epub+zip"); err != nil {
+		return fmt.Errorf("failed to write mimetype: %w", err)
+	}
+
+	files := []struct {
+		name string
+		data []byte
+	}{
+		{"META-INF/container.xml", []byte(containerXML)},
+		{"OEBPS/content.opf", []byte(ew.packageDocument())},
+		{"OEBPS/nav.xhtml", []byte(ew.navDocument())},
+	}
+	for _, ch := range ew.chapters {
+		files = append(files, struct {
+			name string
+			data []byte
+		}{"OEBPS/" + ch.Href, []byte(ew.chapterDocument(ch))})
+	}
+	for _, res := range ew.images {
+		files = append(files, struct {
+			name string
+			data []byte
+		}{"OEBPS/" + res.Href, res.Data})
+	}
+
+	for _, f := range files {
+		fw, err := zw.Create(f.name)
+		if err != nil {
+			return fmt.Errorf("failed to write %s: %w", f.name, err)
+		}
+		if _, err := fw.Write(f.data); err != nil {
+			return fmt.Errorf("failed to write %s: %w", f.name, err)
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("failed to finish EPUB: %w", err)
+	}
+	return nil
+}
+
+const containerXML = `<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>
+`
+
+// buildChapters renders every chapter and collects embedded images
+func (w *writer) buildChapters() {
+	if cover := w.book.Metadata.CoverData; len(cover) > 0 {
+		mediaType := parser.ImageType(cover, "")
+		if ext, ok := imageTypes[mediaType]; ok {
+			w.images = append(w.images, resource{
+				ID:         "cover-image",
+				Href:       "images/cover" + ext,
+				MediaType:  mediaType,
+				Properties: "cover-image",
+				Data:       cover,
+			})
+		}
+	}
+
+	chapters := w.book.Content.Chapters
+	if len(chapters) == 0 {
+		// The navigation document needs at least one entry
+		chapters = []parser.Chapter{{Title: w.book.Metadata.Title}}
+	}
+
+	for i, ch := range chapters {
+		title := strings.TrimSpace(ch.Title)
+		if title == "" {
+			title = fmt.Sprintf("Section %d", i+1)
+		}
+		body := w.elementsToXHTML(ch.Elements)
+		if body == "" {
+			body = fmt.Sprintf("<h1>%s</h1>\n", escape(title))
+		}
+		w.chapters = append(w.chapters, chapterFile{
+			ID:    fmt.Sprintf("chapter-%03d", i+1),
+			Href:  fmt.Sprintf("text/chapter-%03d.xhtml", i+1),
+			Title: title,
+			Level: ch.Level,
+			Body:  body,
+		})
+	}
+}
+
+// addImage stores embedded image data and returns its href relative to the
+// chapter files, or an empty string if the format isn't supported
+func (w *writer) addImage(data []byte) string {
+	mediaType := parser.ImageType(data, "")
+	ext, ok := imageTypes[mediaType]
+	if !ok {
+		return ""
+	}
+	n := len(w.images) + 1
+	res := resource{
+		ID:        fmt.Sprintf("image-%03d", n),
+		Href:      fmt.Sprintf("images/image-%03d%s", n, ext),
+		MediaType: mediaType,
+		Data:      data,
+	}
+	w.images = append(w.images, res)
+	return "../" + res.Href
+}
+
+// identifier returns the dc:identifier value, preferring the book's own ISBN or UUID
+func (w *writer) identifier() string {
+	for _, scheme := range []string{"isbn", "uuid"} {
+		for _, id := range w.book.Metadata.Identifiers {
+			if id.Scheme == scheme && id.Value != "" {
+				if scheme == "isbn" {
+					return "urn:isbn:" + id.Value
+				}
+				return "urn:uuid:" + strings.TrimPrefix(id.Value, "urn:uuid:")
+			}
+		}
+	}
+	if w.opts.Identifier != "" {
+		return w.opts.Identifier
+	}
+
+	// Name-based (version 5 style) UUID so re-exports of the same book keep their identifier
+	sum := sha1.Sum([]byte(w.book.Metadata.Fingerprint() + "\n" + w.book.Fingerprint()))
+	sum[6] = sum[6]&0x0f | 0x50
+	sum[8] = sum[8]&0x3f | 0x80
+	return fmt.Sprintf("urn:uuid:%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
+
+func (w *writer) packageDocument() string {
+	m := w.book.Metadata
+	var opf strings.Builder
+
+	opf.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="book-id" xml:lang="` + escape(w.lang) + `">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+`)
+	fmt.Fprintf(&opf, "    <dc:identifier id=\"book-id\">%s</dc:identifier>\n", escape(w.identifier()))
+
+	title := m.Title
+	if title == "" {
+		title = "Untitled"
+	}
+	fmt.Fprintf(&opf, "    <dc:title>%s</dc:title>\n", escape(title))
+	fmt.Fprintf(&opf, "    <dc:language>%s</dc:language>\n", escape(w.lang))
+
+	for i, a := range m.Authors {
+		id := fmt.Sprintf("creator-%d", i+1)
+		fmt.Fprintf(&opf, "    <dc:creator id=\"%s\">%s</dc:creator>\n", id, escape(a.FullName()))
+		fmt.Fprintf(&opf, "    <meta refines=\"#%s\" property=\"role\" scheme=\"marc:relators\">aut</meta>\n", id)
+		fmt.Fprintf(&opf, "    <meta refines=\"#%s\" property=\"file-as\">%s</meta>\n", id, escape(a.SortName()))
+	}
+
+	if m.Description != "" {
+		fmt.Fprintf(&opf, "    <dc:description>%s</dc:description>\n", escape(m.Description))
+	}
+	subjects := m.Genres
+	if w.opts.Subjects != nil {
+		subjects = w.opts.Subjects(subjects)
+	}
+	for _, subject := range subjects {
+		fmt.Fprintf(&opf, "    <dc:subject>%s</dc:subject>\n", escape(subject))
+	}
+	if m.Publisher != "" {
+		fmt.Fprintf(&opf, "    <dc:publisher>%s</dc:publisher>\n", escape(m.Publisher))
+	}
+	if m.PublicationDate != "" {
+		fmt.Fprintf(&opf, "    <dc:date>%s</dc:date>\n", escape(m.PublicationDate))
+	}
+
+	if m.Series != "" {
+		opf.WriteString("    <meta property=\"belongs-to-collection\" id=\"series\">" + escape(m.Series) + "</meta>\n")
+		opf.WriteString("    <meta refines=\"#series\" property=\"collection-type\">series</meta>\n")
+		if m.SeriesIndex > 0 {
+			fmt.Fprintf(&opf, "    <meta refines=\"#series\" property=\"group-position\">%d</meta>\n", m.SeriesIndex)
+		}
+		// Calibre-style series for readers that don't support collections
+		fmt.Fprintf(&opf, "    <meta name=\"calibre:series\" content=\"%s\"/>\n", escape(m.Series))
+		if m.SeriesIndex > 0 {
+			fmt.Fprintf(&opf, "    <meta name=\"calibre:series_index\" content=\"%d\"/>\n", m.SeriesIndex)
+		}
+	}
+
+	for _, res := range w.images {
+		if res.Properties == "cover-image" {
+			fmt.Fprintf(&opf, "    <meta name=\"cover\" content=\"%s\"/>\n", res.ID)
+		}
+	}
+	fmt.Fprintf(&opf, "    <meta property=\"dcterms:modified\">%s</meta>\n", w.opts.Modified.UTC().Format("2006-01-02T15:04:05Z"))
+	opf.WriteString("  </metadata>\n  <manifest>\n")
+
+	opf.WriteString("    <item id=\"nav\" href=\"nav.xhtml\" media-type=\"application/xhtml+xml\" properties=\"nav\"/>\n")
+	for _, ch := range w.chapters {
+		fmt.Fprintf(&opf, "    <item id=\"%s\" href=\"%s\" media-type=\"application/xhtml+xml\"/>\n", ch.ID, ch.Href)
+	}
+	for _, res := range w.images {
+		properties := ""
+		if res.Properties != "" {
+			properties = fmt.Sprintf(" properties=\"%s\"", res.Properties)
+		}
+		fmt.Fprintf(&opf, "    <item id=\"%s\" href=\"%s\" media-type=\"%s\"%s/>\n", res.ID, res.Href, res.MediaType, properties)
+	}
+	opf.WriteString("  </manifest>\n  <spine>\n")
+
+	for _, ch := range w.chapters {
+		fmt.Fprintf(&opf, "    <itemref idref=\"%s\"/>\n", ch.ID)
+	}
+	opf.WriteString("  </spine>\n</package>\n")
+
+	return opf.String()
+}
+
+// navDocument builds the EPUB 3 navigation document, nesting entries by chapter level
+func (w *writer) navDocument() string {
+	entries := make([]navEntry, len(w.chapters))
+	for i, ch := range w.chapters {
+		entries[i] = navEntry{Href: ch.Href, Title: ch.Title, Level: ch.Level}
+	}
+	return navXHTML(w.lang, "Contents", entries)
+}
+
+func (w *writer) chapterDocument(ch chapterFile) string {
+	return xhtmlHeader(w.lang, ch.Title) + ch.Body + "</body>\n</html>\n"
+}
+
+func xhtmlHeader(lang, title string) string {
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" xml:lang="` + escape(lang) + `" lang="` + escape(lang) + `">
+<head>
+<meta charset="UTF-8"/>
+<title>` + escape(title) + `</title>
+</head>
+<body>
+`
+}
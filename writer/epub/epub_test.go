@@ -0,0 +1,258 @@
+package epub_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/png"
+	"io"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	epubparser "github.com/vpoluyaktov/biblio-ebook-parser/formats/epub"
+	"github.com/vpoluyaktov/biblio-ebook-parser/parser"
+	"github.com/vpoluyaktov/biblio-ebook-parser/writer/epub"
+)
+
+var (
+	pngImage = encode(png.Encode, 2, 3)
+	gifImage = encode(func(w io.Writer, m image.Image) error { return gif.Encode(w, m, nil) }, 1, 1)
+)
+
+func encode(enc func(io.Writer, image.Image) error, width, height int) []byte {
+	var buf bytes.Buffer
+	if err := enc(&buf, image.NewRGBA(image.Rect(0, 0, width, height))); err != nil {
+		panic(err)
+	}
+	return buf.Bytes()
+}
+
+func sourceBook() *parser.Book {
+	book := &parser.Book{
+		Metadata: parser.Metadata{
+			Title: "Война и мир",
+			Authors: []parser.Author{
+				{FirstName: "Лев", MiddleName: "Николаевич", LastName: "Толстой"},
+				{FirstName: "Jane", LastName: "Doe"},
+			},
+			Language:        "ru",
+			Description:     "Роман-эпопея & <история>.",
+			Genres:          []string{"Fiction", "Classics"},
+			Series:          "Эпопея",
+			SeriesIndex:     2,
+			Publisher:       "Издательство",
+			PublicationDate: "1869",
+			Identifiers:     []parser.Identifier{{Scheme: "isbn", Value: "9780000000002"}},
+		},
+		Content: parser.Content{Chapters: []parser.Chapter{
+			{ID: "part1", Title: "Том первый", Level: 0, Elements: []parser.Element{
+				&parser.Heading{Text: "Том первый", Level: 1},
+				&parser.Epigraph{Paragraphs: []parser.Paragraph{{Text: "Эпиграф тома."}}, Author: "Автор"},
+			}},
+			{ID: "ch1", Title: "Часть первая", Level: 1, Elements: []parser.Element{
+				&parser.Heading{Text: "Часть первая", Level: 2},
+				&parser.Paragraph{Text: "— Eh bien, mon prince. Gênes et Lucques ne sont plus que des apanages."},
+				&parser.Image{Alt: "Карта", Data: gifImage},
+				&parser.Blockquote{Paragraphs: []parser.Paragraph{{Text: "Цитата в тексте."}}},
+			}},
+			{ID: "ch2", Title: "Часть вторая", Level: 2, Elements: []parser.Element{
+				&parser.Heading{Text: "Часть вторая", Level: 3},
+				&parser.Paragraph{Text: "Текст второй части."},
+				&parser.EmptyLine{},
+				&parser.Preformatted{Text: "code line"},
+			}},
+			{ID: "part2", Title: "Том второй", Level: 0, Elements: []parser.Element{
+				&parser.Heading{Text: "Том второй", Level: 1},
+				&parser.Paragraph{Text: "Последний абзац."},
+			}},
+		}},
+	}
+	book.SetCover(pngImage, "image/png")
+	return book
+}
+
+func write(t *testing.T, book *parser.Book) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	opts := epub.Options{Modified: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}
+	if err := epub.WriteEPUB(book, &buf, opts); err != nil {
+		t.Fatalf("WriteEPUB: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func parse(t *testing.T, data []byte) *parser.Book {
+	t.Helper()
+	p := epubparser.NewParser()
+	book, err := p.ParseReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("ParseReader: %v", err)
+	}
+	return book
+}
+
+// outline describes the chapters of a book, one per line, with their text.
+// EPUB has no epigraph element, so an epigraph's author is part of its text.
+func outline(chapters []parser.Chapter) string {
+	var b strings.Builder
+	for _, ch := range chapters {
+		var text []string
+		for _, elem := range ch.Elements {
+			switch e := elem.(type) {
+			case *parser.Heading:
+				text = append(text, e.Text)
+			case *parser.Paragraph:
+				text = append(text, e.Text)
+			case *parser.Epigraph:
+				for _, p := range e.Paragraphs {
+					text = append(text, p.Text)
+				}
+				text = append(text, e.Author)
+			case *parser.Blockquote:
+				for _, p := range e.Paragraphs {
+					text = append(text, p.Text)
+				}
+			case *parser.Preformatted:
+				text = append(text, e.Text)
+			}
+		}
+		fmt.Fprintf(&b, "%q level %d: %s\n", ch.Title, ch.Level, strings.Join(strings.Fields(strings.Join(text, " ")), " "))
+	}
+	return b.String()
+}
+
+// textChapters leaves out the cover page, which has only the cover image
+func textChapters(book *parser.Book) []parser.Chapter {
+	var chapters []parser.Chapter
+	for _, ch := range book.Content.Chapters {
+		if len(ch.Elements) == 1 && ch.Elements[0].Type() == parser.ElementTypeImage {
+			continue
+		}
+		chapters = append(chapters, ch)
+	}
+	return chapters
+}
+
+// readEntry returns a file of an EPUB
+func readEntry(t *testing.T, data []byte, name string) []byte {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range zr.File {
+		if f.Name == name {
+			rc, err := f.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rc.Close()
+			b, err := io.ReadAll(rc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return b
+		}
+	}
+	t.Fatalf("no %s in the EPUB", name)
+	return nil
+}
+
+func TestRoundTripMetadata(t *testing.T) {
+	src := sourceBook()
+	m := parse(t, write(t, src)).Metadata
+
+	if m.Title != src.Metadata.Title || m.Language != "ru" || m.Description != src.Metadata.Description {
+		t.Errorf("title, language, description = %q, %q, %q", m.Title, m.Language, m.Description)
+	}
+	var authors []string
+	for _, a := range m.Authors {
+		authors = append(authors, a.FullName())
+	}
+	if got := strings.Join(authors, ", "); got != "Лев Николаевич Толстой, Jane Doe" {
+		t.Errorf("authors = %q", got)
+	}
+	if strings.Join(m.Genres, ", ") != "Fiction, Classics" {
+		t.Errorf("genres = %q", m.Genres)
+	}
+	if m.Series != "Эпопея" || m.SeriesIndex != 2 {
+		t.Errorf("series = %q #%d", m.Series, m.SeriesIndex)
+	}
+	if m.Publisher != "Издательство" || m.PublicationYear != 1869 {
+		t.Errorf("publisher, year = %q, %d", m.Publisher, m.PublicationYear)
+	}
+	var isbn string
+	for _, id := range m.Identifiers {
+		if id.Scheme == "isbn" {
+			isbn = id.Value
+		}
+	}
+	if isbn != "9780000000002" {
+		t.Errorf("identifiers = %+v", m.Identifiers)
+	}
+	if !bytes.Equal(m.CoverData, pngImage) || m.CoverType != "image/png" || m.CoverWidth != 2 || m.CoverHeight != 3 {
+		t.Errorf("cover = %d bytes of %q, %dx%d", len(m.CoverData), m.CoverType, m.CoverWidth, m.CoverHeight)
+	}
+}
+
+func TestRoundTripContent(t *testing.T) {
+	src := sourceBook()
+	data := write(t, src)
+	book := parse(t, data)
+
+	got := outline(textChapters(book))
+	if want := outline(src.Content.Chapters); got != want {
+		t.Errorf("outline after the round trip:\n%s\nwant:\n%s", got, want)
+	}
+
+	// The parser leaves image data in the package, where the href leads
+	var images []string
+	for _, ch := range book.Content.Chapters {
+		for _, elem := range ch.Elements {
+			if img, ok := elem.(*parser.Image); ok {
+				images = append(images, img.Alt)
+				name := path.Join(path.Dir(ch.SourcePath), img.Href)
+				if got := readEntry(t, data, name); !bytes.Equal(got, gifImage) {
+					t.Errorf("image %q at %s has %d bytes, want %d", img.Alt, name, len(got), len(gifImage))
+				}
+			}
+		}
+	}
+	if len(images) != 1 || images[0] != "Карта" {
+		t.Errorf("images = %q, want the map", images)
+	}
+}
+
+func TestNavDocument(t *testing.T) {
+	nav := readEntry(t, write(t, sourceBook()), "OEBPS/nav.xhtml")
+
+	// The entries nest by chapter level in one ordered list per level
+	want := "Том первый -> text/chapter-001.xhtml\n" +
+		"  Часть первая -> text/chapter-002.xhtml\n" +
+		"    Часть вторая -> text/chapter-003.xhtml\n" +
+		"Том второй -> text/chapter-004.xhtml\n"
+	if got := navOutline(t, nav); got != want {
+		t.Errorf("nav entries:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestRoundTripIsStable(t *testing.T) {
+	// Without the inline image: the parser does not load image data, so a
+	// second write would render the map as its alt text
+	book := sourceBook()
+	ch := &book.Content.Chapters[1]
+	ch.Elements = append(ch.Elements[:2], ch.Elements[3:]...)
+
+	first := parse(t, write(t, book))
+	second := parse(t, write(t, first))
+	if got, want := outline(textChapters(second)), outline(textChapters(first)); got != want {
+		t.Errorf("second round trip:\n%s\nfirst:\n%s", got, want)
+	}
+	if got, want := second.Metadata.Fingerprint(), first.Metadata.Fingerprint(); got != want {
+		t.Errorf("metadata fingerprint changed from %s to %s", want, got)
+	}
+}
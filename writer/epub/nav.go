@@ -0,0 +1,186 @@
+package epub
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/vpoluyaktov/biblio-ebook-parser/parser"
+)
+
+// NavOptions controls standalone navigation documents
+type NavOptions struct {
+	// Href maps a chapter ID to the href of its content document, relative
+	// to the navigation document (e.g., "text/ch1.xhtml#part2"). Chapters
+	// mapped to "" are left out. Required.
+	Href func(chapterID string) string
+	// Title heads the table of contents; "Contents" if empty
+	Title string
+	// Identifier is written as the NCX dtb:uid, which must match the
+	// package's dc:identifier. If empty, it is chosen as WriteEPUB does.
+	Identifier string
+}
+
+// navEntry is an entry of a table of contents
+type navEntry struct {
+	Href  string
+	Title string
+	Level int
+}
+
+// WriteNav writes an EPUB 3 navigation document listing the book's
+// chapters, nested by their Level, for packaging the book by other means
+// than WriteEPUB
+func WriteNav(book *parser.Book, w io.Writer, opts NavOptions) error {
+	entries, err := navEntries(book, opts)
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, navXHTML(bookLanguage(book), opts.title(), entries)); err != nil {
+		return fmt.Errorf("failed to write navigation document: %w", err)
+	}
+	return nil
+}
+
+// WriteNCX writes an EPUB 2 NCX listing the book's chapters, nested by
+// their Level
+func WriteNCX(book *parser.Book, w io.Writer, opts NavOptions) error {
+	entries, err := navEntries(book, opts)
+	if err != nil {
+		return err
+	}
+	uid := (&writer{book: book, opts: Options{Identifier: opts.Identifier}}).identifier()
+	title := strings.TrimSpace(book.Metadata.Title)
+	if title == "" {
+		title = opts.title()
+	}
+	if _, err := io.WriteString(w, ncxDocument(uid, title, entries)); err != nil {
+		return fmt.Errorf("failed to write NCX: %w", err)
+	}
+	return nil
+}
+
+func (o NavOptions) title() string {
+	if title := strings.TrimSpace(o.Title); title != "" {
+		return title
+	}
+	return "Contents"
+}
+
+// navEntries returns the entries for the chapters the options give an href
+func navEntries(book *parser.Book, opts NavOptions) ([]navEntry, error) {
+	if opts.Href == nil {
+		return nil, errors.New("no Href function for the chapters")
+	}
+	var entries []navEntry
+	for i, ch := range book.Content.Chapters {
+		href := strings.TrimSpace(opts.Href(ch.ID))
+		if href == "" {
+			continue
+		}
+		title := strings.TrimSpace(ch.Title)
+		if title == "" {
+			title = fmt.Sprintf("Section %d", i+1)
+		}
+		entries = append(entries, navEntry{Href: href, Title: title, Level: ch.Level})
+	}
+	if len(entries) == 0 {
+		// Both formats need at least one entry
+		return nil, errors.New("no chapters to list")
+	}
+	return entries, nil
+}
+
+// bookLanguage returns the language of the book for xml:lang, "und" if unknown
+func bookLanguage(book *parser.Book) string {
+	if book.Metadata.Language == "" {
+		return "und"
+	}
+	return book.Metadata.Language
+}
+
+// nestLevels returns the depth of each entry in the tree: its level, but no
+// more than one deeper than the entry before it and 0 for the first
+func nestLevels(entries []navEntry) []int {
+	levels := make([]int, len(entries))
+	depth := 0
+	for i, entry := range entries {
+		level := min(max(entry.Level, 0), depth+1)
+		if i == 0 {
+			level = 0
+		}
+		levels[i], depth = level, level
+	}
+	return levels
+}
+
+// navXHTML builds an EPUB 3 navigation document with nested lists
+func navXHTML(lang, title string, entries []navEntry) string {
+	var nav strings.Builder
+
+	nav.WriteString(xhtmlHeader(lang, title))
+	fmt.Fprintf(&nav, "<nav epub:type=\"toc\" id=\"toc\">\n<h1>%s</h1>\n<ol>\n", escape(title))
+
+	depth := 0
+	for i, level := range nestLevels(entries) {
+		if i > 0 {
+			if level > depth {
+				nav.WriteString("\n<ol>\n")
+			} else {
+				nav.WriteString("</li>\n")
+				for ; depth > level; depth-- {
+					nav.WriteString("</ol>\n</li>\n")
+				}
+			}
+		}
+		depth = level
+
+		fmt.Fprintf(&nav, "<li><a href=\"%s\">%s</a>", escape(entries[i].Href), escape(entries[i].Title))
+	}
+	nav.WriteString("</li>\n")
+	for ; depth > 0; depth-- {
+		nav.WriteString("</ol>\n</li>\n")
+	}
+
+	nav.WriteString("</ol>\n</nav>\n</body>\n</html>\n")
+	return nav.String()
+}
+
+// ncxDocument builds an EPUB 2 NCX with nested navPoints in reading order
+func ncxDocument(uid, title string, entries []navEntry) string {
+	levels := nestLevels(entries)
+	maxDepth := 0
+	for _, level := range levels {
+		maxDepth = max(maxDepth, level+1)
+	}
+
+	var ncx strings.Builder
+	ncx.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<ncx xmlns="http://www.daisy.org/z3986/2005/ncx/" version="2005-1">
+<head>
+`)
+	fmt.Fprintf(&ncx, "<meta name=\"dtb:uid\" content=\"%s\"/>\n", escape(uid))
+	fmt.Fprintf(&ncx, "<meta name=\"dtb:depth\" content=\"%d\"/>\n", maxDepth)
+	ncx.WriteString("<meta name=\"dtb:totalPageCount\" content=\"0\"/>\n<meta name=\"dtb:maxPageNumber\" content=\"0\"/>\n</head>\n")
+	fmt.Fprintf(&ncx, "<docTitle><text>%s</text></docTitle>\n<navMap>\n", escape(title))
+
+	depth := 0
+	for i, level := range levels {
+		if i > 0 {
+			for ; depth >= level; depth-- {
+				ncx.WriteString("</navPoint>\n")
+			}
+		}
+		depth = level
+
+		fmt.Fprintf(&ncx, "<navPoint id=\"navpoint-%d\" playOrder=\"%d\"><navLabel><text>%s</text></navLabel><content src=\"%s\"/>\n",
+			i+1, i+1, escape(entries[i].Title), escape(entries[i].Href))
+	}
+	for ; depth >= 0; depth-- {
+		ncx.WriteString("</navPoint>\n")
+	}
+
+	ncx.WriteString("</navMap>\n</ncx>\n")
+	return ncx.String()
+}
@@ -0,0 +1,273 @@
+package epub_test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/vpoluyaktov/biblio-ebook-parser/parser"
+	"github.com/vpoluyaktov/biblio-ebook-parser/writer/epub"
+)
+
+// node is an element of an XML document with what's in it
+type node struct {
+	XMLName xml.Name
+	Attrs   []xml.Attr `xml:",any,attr"`
+	Nodes   []node     `xml:",any"`
+	Text    string     `xml:",chardata"`
+}
+
+func (n node) attr(local string) string {
+	for _, a := range n.Attrs {
+		if a.Name.Local == local {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// find returns the first element named local, depth first
+func (n *node) find(local string) *node {
+	if n.XMLName.Local == local {
+		return n
+	}
+	for i := range n.Nodes {
+		if found := n.Nodes[i].find(local); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func parseXML(t *testing.T, doc []byte) node {
+	t.Helper()
+	var root node
+	if err := xml.Unmarshal(doc, &root); err != nil {
+		t.Fatalf("not well-formed: %v\n%s", err, doc)
+	}
+	return root
+}
+
+// navOutline checks that a navigation document is a toc nav holding one
+// list, whose items each have a link and at most one nested, non-empty
+// list, and describes its entries one per line, indented by depth
+func navOutline(t *testing.T, doc []byte) string {
+	t.Helper()
+	root := parseXML(t, doc)
+	const epubNS = "http://www.idpf.org/2007/ops"
+	if root.XMLName.Space != "http://www.w3.org/1999/xhtml" || root.XMLName.Local != "html" {
+		t.Errorf("root element is %v", root.XMLName)
+	}
+	nav := root.find("nav")
+	if nav == nil {
+		t.Fatalf("no nav:\n%s", doc)
+	}
+	if !hasAttr(nav.Attrs, epubNS, "type", "toc") {
+		t.Errorf("nav attributes %v, want epub:type toc", nav.Attrs)
+	}
+	var lists []node
+	for _, child := range nav.Nodes {
+		switch child.XMLName.Local {
+		case "ol":
+			lists = append(lists, child)
+		case "h1", "h2":
+		default:
+			t.Errorf("nav has a %s", child.XMLName.Local)
+		}
+	}
+	if len(lists) != 1 {
+		t.Fatalf("nav has %d lists, want 1", len(lists))
+	}
+
+	var b strings.Builder
+	var walk func(ol node, depth int)
+	walk = func(ol node, depth int) {
+		if len(ol.Nodes) == 0 {
+			t.Errorf("empty list at depth %d", depth)
+		}
+		for _, li := range ol.Nodes {
+			if li.XMLName.Local != "li" {
+				t.Errorf("list holds a %s", li.XMLName.Local)
+				continue
+			}
+			if len(li.Nodes) == 0 || li.Nodes[0].XMLName.Local != "a" || len(li.Nodes) > 2 ||
+				(len(li.Nodes) == 2 && li.Nodes[1].XMLName.Local != "ol") {
+				t.Errorf("list item %+v is not a link and an optional list", li)
+				continue
+			}
+			a := li.Nodes[0]
+			fmt.Fprintf(&b, "%s%s -> %s\n", strings.Repeat("  ", depth), a.Text, a.attr("href"))
+			if len(li.Nodes) == 2 {
+				walk(li.Nodes[1], depth+1)
+			}
+		}
+	}
+	walk(lists[0], 0)
+	return b.String()
+}
+
+func hasAttr(attrs []xml.Attr, space, local, value string) bool {
+	for _, a := range attrs {
+		if a.Name.Space == space && a.Name.Local == local && a.Value == value {
+			return true
+		}
+	}
+	return false
+}
+
+// ncxOutline describes the nested navPoints of an NCX as navOutline does,
+// checking that play orders count up from 1
+func ncxOutline(t *testing.T, doc []byte) string {
+	t.Helper()
+	root := parseXML(t, doc)
+	navMap := root.find("navMap")
+	if navMap == nil {
+		t.Fatalf("no navMap:\n%s", doc)
+	}
+	var b strings.Builder
+	order := 0
+	var walk func(points []node, depth int)
+	walk = func(points []node, depth int) {
+		for _, point := range points {
+			if point.XMLName.Local != "navPoint" {
+				continue
+			}
+			order++
+			if got := point.attr("playOrder"); got != fmt.Sprint(order) {
+				t.Errorf("navPoint %d has playOrder %s", order, got)
+			}
+			label, content := point.find("text"), point.find("content")
+			if label == nil || content == nil {
+				t.Errorf("navPoint %d has no label or content", order)
+				continue
+			}
+			fmt.Fprintf(&b, "%s%s -> %s\n", strings.Repeat("  ", depth), label.Text, content.attr("src"))
+			walk(point.Nodes, depth+1)
+		}
+	}
+	walk(navMap.Nodes, 0)
+	return b.String()
+}
+
+// leveledBook returns a book with a chapter of each level, titled by its
+// position and level
+func leveledBook(levels ...int) *parser.Book {
+	book := &parser.Book{Metadata: parser.Metadata{Title: "Levels", Language: "en"}}
+	for i, level := range levels {
+		book.Content.Chapters = append(book.Content.Chapters, parser.Chapter{
+			ID:       fmt.Sprintf("c%d", i+1),
+			Title:    fmt.Sprintf("C%d/L%d", i+1, level),
+			Level:    level,
+			Elements: []parser.Element{&parser.Paragraph{Text: "Text."}},
+		})
+	}
+	return book
+}
+
+var nestingTests = []struct {
+	name   string
+	levels []int
+	want   string // Titles indented by depth
+}{
+	{"flat", []int{0, 0, 0}, "C1/L0 C2/L0 C3/L0"},
+	{"nested", []int{0, 1, 2, 0}, "C1/L0 _C2/L1 __C3/L2 C4/L0"},
+	{"back up several levels", []int{0, 1, 2, 3, 1, 0}, "C1/L0 _C2/L1 __C3/L2 ___C4/L3 _C5/L1 C6/L0"},
+	// A level skipped nests one deeper only
+	{"skipped level", []int{0, 2, 3, 1}, "C1/L0 _C2/L2 __C3/L3 _C4/L1"},
+	{"first chapter deep", []int{2, 2, 0}, "C1/L2 _C2/L2 C3/L0"},
+	{"negative level", []int{0, -1, 1}, "C1/L0 C2/L-1 _C3/L1"},
+	{"ends deep", []int{0, 1, 2}, "C1/L0 _C2/L1 __C3/L2"},
+}
+
+// titlesByDepth shortens an outline to its titles, with a _ per depth
+func titlesByDepth(outline string) string {
+	var titles []string
+	for line := range strings.Lines(outline) {
+		title, _, _ := strings.Cut(line, " -> ")
+		trimmed := strings.TrimLeft(title, " ")
+		titles = append(titles, strings.Repeat("_", (len(title)-len(trimmed))/2)+trimmed)
+	}
+	return strings.Join(titles, " ")
+}
+
+func TestNavNesting(t *testing.T) {
+	for _, tt := range nestingTests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := write(t, leveledBook(tt.levels...))
+			outline := navOutline(t, readEntry(t, data, "OEBPS/nav.xhtml"))
+			if got := titlesByDepth(outline); got != tt.want {
+				t.Errorf("nav entries %q, want %q\n%s", got, tt.want, outline)
+			}
+
+			// Every entry links to a chapter file of the EPUB, in reading order
+			i := 0
+			for line := range strings.Lines(outline) {
+				i++
+				_, href, _ := strings.Cut(strings.TrimSpace(line), " -> ")
+				if want := fmt.Sprintf("text/chapter-%03d.xhtml", i); href != want {
+					t.Errorf("entry %d links to %q, want %q", i, href, want)
+				}
+				readEntry(t, data, path.Join("OEBPS", href))
+			}
+		})
+	}
+}
+
+func TestWriteNavAndNCX(t *testing.T) {
+	opts := epub.NavOptions{Href: func(id string) string { return id + ".xhtml" }}
+	for _, tt := range nestingTests {
+		t.Run(tt.name, func(t *testing.T) {
+			book := leveledBook(tt.levels...)
+			var nav, ncx bytes.Buffer
+			if err := epub.WriteNav(book, &nav, opts); err != nil {
+				t.Fatalf("WriteNav: %v", err)
+			}
+			if err := epub.WriteNCX(book, &ncx, opts); err != nil {
+				t.Fatalf("WriteNCX: %v", err)
+			}
+
+			navEntries, ncxEntries := navOutline(t, nav.Bytes()), ncxOutline(t, ncx.Bytes())
+			if got := titlesByDepth(navEntries); got != tt.want {
+				t.Errorf("nav entries %q, want %q", got, tt.want)
+			}
+			if navEntries != ncxEntries {
+				t.Errorf("NCX entries:\n%s\nnav entries:\n%s", ncxEntries, navEntries)
+			}
+		})
+	}
+}
+
+func TestWriteNavEntries(t *testing.T) {
+	book := leveledBook(0, 1, 0)
+	book.Content.Chapters[0].Title = "Tom & Jerry <1>"
+	book.Content.Chapters[1].Title = "  "
+	hrefs := map[string]string{"c1": "text/a.xhtml#x&y", "c2": "text/a.xhtml#two", "c3": ""}
+	opts := epub.NavOptions{Title: "Inhalt", Href: func(id string) string { return hrefs[id] }}
+
+	var nav bytes.Buffer
+	if err := epub.WriteNav(book, &nav, opts); err != nil {
+		t.Fatalf("WriteNav: %v", err)
+	}
+	// Titles and hrefs are escaped, blank titles numbered and chapters
+	// without an href left out
+	want := "Tom & Jerry <1> -> text/a.xhtml#x&y\n  Section 2 -> text/a.xhtml#two\n"
+	if got := navOutline(t, nav.Bytes()); got != want {
+		t.Errorf("nav entries:\n%s\nwant:\n%s", got, want)
+	}
+	root := parseXML(t, nav.Bytes())
+	if h1 := root.find("h1"); h1 == nil || h1.Text != "Inhalt" {
+		t.Errorf("nav heading = %+v, want Inhalt", h1)
+	}
+
+	// Both formats need an entry
+	none := epub.NavOptions{Href: func(string) string { return "" }}
+	if err := epub.WriteNav(book, &nav, none); err == nil {
+		t.Error("WriteNav without entries succeeded")
+	}
+	if err := epub.WriteNCX(book, &nav, epub.NavOptions{}); err == nil {
+		t.Error("WriteNCX without Href succeeded")
+	}
+}
@@ -0,0 +1,114 @@
+package epub
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/vpoluyaktov/biblio-ebook-parser/parser"
+)
+
+var xmlEscaper = strings.NewReplacer(
+	"&", "&amp;",
+	"<", "&lt;",
+	">", "&gt;",
+	`"`, "&quot;",
+	"'", "&#39;",
+)
+
+// escape escapes text for XML content and attribute values, dropping
+// characters that are not allowed in XML 1.0
+func escape(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r < 0x20 && r != '\t' && r != '\n' && r != '\r' {
+			return -1
+		}
+		if r == 0xFFFE || r == 0xFFFF {
+			return -1
+		}
+		return r
+	}, s)
+	return xmlEscaper.Replace(s)
+}
+
+// elementsToXHTML renders chapter elements as the body of an XHTML content document
+func (w *writer) elementsToXHTML(elements []parser.Element) string {
+	var x strings.Builder
+
+	for _, elem := range elements {
+		switch e := elem.(type) {
+		case *parser.Heading:
+			level := e.Level
+			if level < 1 {
+				level = 1
+			}
+			if level > 6 {
+				level = 6
+			}
+			fmt.Fprintf(&x, "<h%d>%s</h%d>\n", level, escape(e.Text), level)
+
+		case *parser.Paragraph:
+			x.WriteString("<p>")
+			x.WriteString(strings.ReplaceAll(escape(e.Text), "\n", "<br/>\n"))
+			x.WriteString("</p>\n")
+
+		case *parser.Image:
+			src := ""
+			if len(e.Data) > 0 {
+				src = w.addImage(e.Data)
+			}
+			if src != "" {
+				fmt.Fprintf(&x, "<p><img src=\"%s\" alt=\"%s\"/></p>\n", src, escape(e.Alt))
+			} else if e.Alt != "" {
+				fmt.Fprintf(&x, "<p><em>[Image: %s]</em></p>\n", escape(e.Alt))
+			}
+
+		case *parser.Table:
+			if e.Caption != "" {
+				fmt.Fprintf(&x, "<p><em>[Table: %s]</em></p>\n", escape(e.Caption))
+			} else {
+				x.WriteString("<p><em>[Table]</em></p>\n")
+			}
+
+		case *parser.EmptyLine:
+			x.WriteString("<p><br/></p>\n")
+
+		case *parser.Epigraph:
+			x.WriteString("<blockquote class=\"epigraph\">\n")
+			for _, p := range e.Paragraphs {
+				fmt.Fprintf(&x, "<p>%s</p>\n", escape(p.Text))
+			}
+			if e.Author != "" {
+				fmt.Fprintf(&x, "<p class=\"text-author\"><em>%s</em></p>\n", escape(e.Author))
+			}
+			x.WriteString("</blockquote>\n")
+
+		case *parser.Blockquote:
+			x.WriteString("<blockquote>\n")
+			for _, p := range e.Paragraphs {
+				fmt.Fprintf(&x, "<p>%s</p>\n", strings.ReplaceAll(escape(p.Text), "\n", "<br/>\n"))
+			}
+			x.WriteString("</blockquote>\n")
+
+		case *parser.Preformatted:
+			fmt.Fprintf(&x, "<pre><code>%s</code></pre>\n", escape(e.Text))
+
+		case *parser.Footnote:
+			x.WriteString("<aside epub:type=\"footnote\">\n")
+			for i, note := range e.Elements {
+				p, ok := note.(*parser.Paragraph)
+				if !ok {
+					continue
+				}
+				x.WriteString("<p>")
+				if i == 0 && e.Label != "" {
+					fmt.Fprintf(&x, "<sup>%s</sup> ", escape(e.Label))
+				}
+				x.WriteString(escape(p.Text))
+				x.WriteString("</p>\n")
+			}
+			x.WriteString("</aside>\n")
+		}
+	}
+
+	return x.String()
+}
@@ -0,0 +1,257 @@
+package fb2
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/vpoluyaktov/biblio-ebook-parser/parser"
+)
+
+// body writes the chapters as nested sections following Chapter.Level
+func (w *writer) body() string {
+	var b strings.Builder
+	b.WriteString("<body>\n")
+
+	chapters := w.book.Content.Chapters
+	if len(chapters) > 0 && isBodyTitle(chapters[0]) {
+		writeTitle(&b, chapters[0].Elements[0].(*parser.Heading).Text)
+		chapters = chapters[1:]
+	}
+	if len(chapters) == 0 {
+		// A body needs at least one section
+		b.WriteString("<section><empty-line/></section>\n")
+	}
+
+	open := 0
+	for i, ch := range chapters {
+		// A chapter can only be nested one level deeper than the previous one
+		level := ch.Level
+		if level < 0 {
+			level = 0
+		}
+		if level > open {
+			level = open
+		}
+		for ; open > level; open-- {
+			b.WriteString("</section>\n")
+		}
+
+		b.WriteString(w.sectionStart(ch.ID))
+		open++
+
+		// Only a leading heading becomes the section title; chapter titles
+		// synthesized by parsers for untitled sections are not part of the text
+		elements := ch.Elements
+		title := ""
+		if len(elements) > 0 {
+			if h, ok := elements[0].(*parser.Heading); ok {
+				title = h.Text
+				elements = elements[1:]
+			}
+		}
+		writeTitle(&b, title)
+
+		hasChildren := i+1 < len(chapters) && chapters[i+1].Level > ch.Level
+		if !hasChildren {
+			b.WriteString(w.elementsToFB2(elements))
+			continue
+		}
+		// FB2 doesn't allow text next to subsections, so the chapter's own
+		// text goes into a leading subsection, marked by its id for the
+		// parser to merge back into the chapter. Leading epigraphs may stay
+		// in the section head.
+		head := 0
+		for head < len(elements) && elements[head].Type() == parser.ElementTypeEpigraph {
+			head++
+		}
+		b.WriteString(w.elementsToFB2(elements[:head]))
+		if content := w.elementsToFB2(elements[head:]); content != "" {
+			w.leadingTexts++
+			fmt.Fprintf(&b, "<section id=\"leading-text-%d\">\n%s</section>\n", w.leadingTexts, content)
+		}
+	}
+	for ; open > 0; open-- {
+		b.WriteString("</section>\n")
+	}
+
+	b.WriteString("</body>\n")
+	return b.String()
+}
+
+// writeTitle writes a title element, a paragraph per line, unless title is empty
+func writeTitle(b *strings.Builder, title string) {
+	if title = strings.TrimSpace(title); title == "" {
+		return
+	}
+	b.WriteString("<title>\n")
+	for _, line := range strings.Split(title, "\n") {
+		fmt.Fprintf(b, "<p>%s</p>\n", escape(strings.TrimSpace(line)))
+	}
+	b.WriteString("</title>\n")
+}
+
+// isBodyTitle reports whether a chapter is the body title of a parsed FB2,
+// which is written back as one rather than as a section
+func isBodyTitle(ch parser.Chapter) bool {
+	if !bodyTitleID.MatchString(ch.ID) || len(ch.Elements) != 1 {
+		return false
+	}
+	_, ok := ch.Elements[0].(*parser.Heading)
+	return ok
+}
+
+var bodyTitleID = regexp.MustCompile(`^body-title-\d+$`)
+
+// syntheticID matches the ids the FB2 parser makes up for sections without
+// one, which aren't written so that parsing the output makes the same ones,
+// and those marking leading text subsections
+var syntheticID = regexp.MustCompile(`^(section|body-title|leading-text)-\d+$`)
+
+// sectionStart opens a section, keeping the chapter id when it is unique
+// and not made up by a parser
+func (w *writer) sectionStart(id string) string {
+	if id == "" || w.sectionID[id] || syntheticID.MatchString(id) {
+		return "<section>\n"
+	}
+	w.sectionID[id] = true
+	return fmt.Sprintf("<section id=\"%s\">\n", escape(id))
+}
+
+// elementsToFB2 renders elements as section content. Footnotes are linked from
+// the paragraph they follow and collected for the notes body.
+func (w *writer) elementsToFB2(elements []parser.Element) string {
+	var b strings.Builder
+
+	for i, elem := range elements {
+		switch e := elem.(type) {
+		case *parser.Heading:
+			fmt.Fprintf(&b, "<subtitle>%s</subtitle>\n", escape(e.Text))
+
+		case *parser.Paragraph:
+			if strings.Contains(e.Text, "\n") {
+				// Multi-line paragraphs come from poem stanzas
+				b.WriteString("<poem><stanza>\n")
+				for _, line := range strings.Split(e.Text, "\n") {
+					fmt.Fprintf(&b, "<v>%s</v>\n", escape(line))
+				}
+				b.WriteString("</stanza></poem>\n")
+				continue
+			}
+
+			var notes []*parser.Footnote
+			for _, next := range elements[i+1:] {
+				fn, ok := next.(*parser.Footnote)
+				if !ok {
+					break
+				}
+				notes = append(notes, fn)
+			}
+			fmt.Fprintf(&b, "<p>%s</p>\n", w.linkNotes(e.Text, notes))
+
+		case *parser.Image:
+			if id := w.addBinary(e.Data, ""); id != "" {
+				if e.Alt != "" {
+					fmt.Fprintf(&b, "<image l:href=\"#%s\" alt=\"%s\"/>\n", id, escape(e.Alt))
+				} else {
+					fmt.Fprintf(&b, "<image l:href=\"#%s\"/>\n", id)
+				}
+			}
+
+		case *parser.Table:
+			// Tables are only known by their caption, there are no cells to write
+
+		case *parser.EmptyLine:
+			b.WriteString("<empty-line/>\n")
+
+		case *parser.Epigraph:
+			b.WriteString("<epigraph>\n")
+			for _, p := range e.Paragraphs {
+				fmt.Fprintf(&b, "<p>%s</p>\n", escape(p.Text))
+			}
+			if e.Author != "" {
+				fmt.Fprintf(&b, "<text-author>%s</text-author>\n", escape(e.Author))
+			}
+			b.WriteString("</epigraph>\n")
+
+		case *parser.Blockquote:
+			b.WriteString("<cite>\n")
+			for _, p := range e.Paragraphs {
+				fmt.Fprintf(&b, "<p>%s</p>\n", escape(p.Text))
+			}
+			b.WriteString("</cite>\n")
+
+		case *parser.Preformatted:
+			// FB2 has no preformatted blocks, so each line becomes a code paragraph
+			for _, line := range strings.Split(strings.TrimRight(e.Text, "\n"), "\n") {
+				if line == "" {
+					b.WriteString("<empty-line/>\n")
+					continue
+				}
+				fmt.Fprintf(&b, "<p><code>%s</code></p>\n", escape(line))
+			}
+
+		case *parser.Footnote:
+			w.noteID(e)
+		}
+	}
+
+	return b.String()
+}
+
+// linkNotes escapes paragraph text and turns the footnote labels it contains
+// into note links, in order. Notes whose label is not part of the text (parsed
+// FB2 drops link text from paragraphs) are linked at the end of the paragraph.
+func (w *writer) linkNotes(text string, notes []*parser.Footnote) string {
+	var b strings.Builder
+	var trailing []*parser.Footnote
+	cursor := 0
+	for _, fn := range notes {
+		idx := -1
+		if fn.Label != "" {
+			idx = strings.Index(text[cursor:], fn.Label)
+		}
+		if idx < 0 {
+			trailing = append(trailing, fn)
+			continue
+		}
+		idx += cursor
+		b.WriteString(escape(text[cursor:idx]))
+		b.WriteString(w.noteLink(fn))
+		cursor = idx + len(fn.Label)
+	}
+	b.WriteString(escape(text[cursor:]))
+	for _, fn := range trailing {
+		b.WriteString(w.noteLink(fn))
+	}
+	return b.String()
+}
+
+func (w *writer) noteLink(fn *parser.Footnote) string {
+	label := fn.Label
+	if label == "" {
+		label = "*"
+	}
+	return fmt.Sprintf("<a l:href=\"#%s\" type=\"note\">%s</a>", escape(w.noteID(fn)), escape(label))
+}
+
+// noteID registers the footnote's note for the notes body and returns its id
+func (w *writer) noteID(fn *parser.Footnote) string {
+	id := fn.ID
+	if id == "" {
+		if generated, ok := w.generatedIDs[fn]; ok {
+			return generated
+		}
+		id = fmt.Sprintf("note-%d", len(w.notes)+1)
+		w.generatedIDs[fn] = id
+	}
+	if !w.noteIDs[id] {
+		w.noteIDs[id] = true
+		note, ok := w.book.Notes[id]
+		if !ok {
+			note = parser.Note{ID: id, Title: fn.Label, Elements: fn.Elements}
+		}
+		w.notes = append(w.notes, note)
+	}
+	return id
+}
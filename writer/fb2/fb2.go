@@ -0,0 +1,319 @@
+// Package fb2 serializes parsed books into FictionBook 2 documents.
+package fb2
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/vpoluyaktov/biblio-ebook-parser/parser"
+)
+
+// Options controls FB2 generation
+type Options struct {
+	// ProgramUsed is written to document-info; defaults to "biblio-ebook-parser"
+	ProgramUsed string
+	// Date is written to document-info; the current time is used if zero
+	Date time.Time
+	// Genres maps the book's genres to the genre codes written, such as
+	// genres.FB2Codes for books from other formats; as they are if nil
+	Genres func(genres []string) []string
+}
+
+// binary is an embedded image written as a <binary> element
+type binary struct {
+	ID          string
+	ContentType string
+	Data        []byte
+}
+
+// writer accumulates binaries and notes while the body is generated
+type writer struct {
+	book         *parser.Book
+	opts         Options
+	binaries     []binary
+	notes        []parser.Note
+	noteIDs      map[string]bool
+	generatedIDs map[*parser.Footnote]string
+	sectionID    map[string]bool
+	leadingTexts int // Leading text subsections written
+}
+
+// FileName returns a file name for the book written by WriteFB2, made
+// from its author and title by parser.Metadata.FileStem (e.g.,
+// "tolstoi_voina-i-mir.fb2")
+func FileName(book *parser.Book) string {
+	return book.Metadata.FileStem(parser.SlugOptions{}) + ".fb2"
+}
+
+// WriteFB2 writes book to w as a UTF-8 FictionBook 2 document
+func WriteFB2(book *parser.Book, w io.Writer, opts Options) error {
+	fw := &writer{
+		book:         book,
+		opts:         opts,
+		noteIDs:      make(map[string]bool),
+		generatedIDs: make(map[*parser.Footnote]string),
+		sectionID:    make(map[string]bool),
+	}
+	if fw.opts.ProgramUsed == "" {
+		fw.opts.ProgramUsed = "biblio-ebook-parser"
+	}
+	if fw.opts.Date.IsZero() {
+		fw.opts.Date = time.Now()
+	}
+
+	var doc strings.Builder
+	doc.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	doc.WriteString(`<FictionBook xmlns="http://www.gribuser.ru/xml/fictionbook/2.0" xmlns:l="http://www.w3.org/1999/xlink">` + "\n")
+
+	// The body is generated first so that its images are known when the
+	// binaries are written, but the description only needs the cover
+	coverID := fw.addBinary(book.Metadata.CoverData, "cover")
+	body := fw.body()
+
+	doc.WriteString(fw.description(coverID))
+	doc.WriteString(body)
+	doc.WriteString(fw.notesBody())
+
+	for _, bin := range fw.binaries {
+		fmt.Fprintf(&doc, "<binary id=\"%s\" content-type=\"%s\">", bin.ID, bin.ContentType)
+		doc.WriteString(base64.StdEncoding.EncodeToString(bin.Data))
+		doc.WriteString("</binary>\n")
+	}
+	doc.WriteString("</FictionBook>\n")
+
+	if _, err := io.WriteString(w, doc.String()); err != nil {
+		return fmt.Errorf("failed to write FB2: %w", err)
+	}
+	return nil
+}
+
+// addBinary registers image data and returns its binary id, or an empty string
+// if the data is empty or not a recognized image
+func (w *writer) addBinary(data []byte, id string) string {
+	if len(data) == 0 {
+		return ""
+	}
+	contentType := http.DetectContentType(data)
+	if !strings.HasPrefix(contentType, "image/") {
+		return ""
+	}
+	if id == "" {
+		id = fmt.Sprintf("image-%03d", len(w.binaries)+1)
+	}
+	w.binaries = append(w.binaries, binary{ID: id, ContentType: contentType, Data: data})
+	return id
+}
+
+func (w *writer) description(coverID string) string {
+	m := w.book.Metadata
+	var d strings.Builder
+
+	d.WriteString("<description>\n<title-info>\n")
+
+	genres := m.Genres
+	if w.opts.Genres != nil {
+		genres = w.opts.Genres(genres)
+	}
+	if len(genres) == 0 {
+		genres = []string{"other"}
+	}
+	for _, genre := range genres {
+		fmt.Fprintf(&d, "<genre>%s</genre>\n", escape(genre))
+	}
+
+	if len(m.Authors) == 0 {
+		d.WriteString("<author><first-name></first-name><last-name></last-name></author>\n")
+	}
+	for _, a := range m.Authors {
+		d.WriteString("<author>")
+		fmt.Fprintf(&d, "<first-name>%s</first-name>", escape(a.FirstName))
+		if a.MiddleName != "" {
+			fmt.Fprintf(&d, "<middle-name>%s</middle-name>", escape(a.MiddleName))
+		}
+		fmt.Fprintf(&d, "<last-name>%s</last-name>", escape(a.LastName))
+		d.WriteString("</author>\n")
+	}
+
+	fmt.Fprintf(&d, "<book-title>%s</book-title>\n", escape(m.Title))
+
+	if strings.TrimSpace(m.Description) != "" {
+		d.WriteString("<annotation>\n")
+		for _, para := range strings.Split(m.Description, "\n\n") {
+			if para = strings.TrimSpace(para); para != "" {
+				fmt.Fprintf(&d, "<p>%s</p>\n", escape(para))
+			}
+		}
+		d.WriteString("</annotation>\n")
+	}
+
+	if coverID != "" {
+		fmt.Fprintf(&d, "<coverpage><image l:href=\"#%s\"/></coverpage>\n", coverID)
+	}
+
+	lang := m.Language
+	if lang == "" {
+		lang = "und"
+	}
+	fmt.Fprintf(&d, "<lang>%s</lang>\n", escape(lang))
+
+	sequences := m.Sequences
+	if len(sequences) == 0 && m.Series != "" {
+		sequences = []parser.Sequence{{Name: m.Series, Number: m.SeriesIndex}}
+	}
+	for _, seq := range sequences {
+		if !seq.Publisher {
+			d.WriteString(sequenceElement(seq))
+		}
+	}
+	d.WriteString("</title-info>\n")
+
+	d.WriteString(w.documentInfo())
+
+	var publish strings.Builder
+	if m.Publisher != "" {
+		fmt.Fprintf(&publish, "<publisher>%s</publisher>\n", escape(m.Publisher))
+	}
+	if m.PublishCity != "" {
+		fmt.Fprintf(&publish, "<city>%s</city>\n", escape(m.PublishCity))
+	}
+	if m.PublicationYear > 0 {
+		fmt.Fprintf(&publish, "<year>%d</year>\n", m.PublicationYear)
+	}
+	for _, id := range m.Identifiers {
+		if id.Scheme == "isbn" {
+			fmt.Fprintf(&publish, "<isbn>%s</isbn>\n", escape(id.Value))
+			break
+		}
+	}
+	for _, seq := range sequences {
+		if seq.Publisher {
+			publish.WriteString(sequenceElement(seq))
+		}
+	}
+	if publish.Len() > 0 {
+		d.WriteString("<publish-info>\n")
+		d.WriteString(publish.String())
+		d.WriteString("</publish-info>\n")
+	}
+
+	d.WriteString("</description>\n")
+	return d.String()
+}
+
+func sequenceElement(seq parser.Sequence) string {
+	if seq.Number > 0 {
+		return fmt.Sprintf("<sequence name=\"%s\" number=\"%d\"/>\n", escape(seq.Name), seq.Number)
+	}
+	return fmt.Sprintf("<sequence name=\"%s\"/>\n", escape(seq.Name))
+}
+
+func (w *writer) documentInfo() string {
+	info := w.book.Metadata.DocumentInfo
+	if info == nil {
+		info = &parser.DocumentInfo{}
+	}
+
+	var d strings.Builder
+	d.WriteString("<document-info>\n")
+
+	authors := info.Authors
+	if len(authors) == 0 {
+		authors = []string{w.opts.ProgramUsed}
+	}
+	for _, a := range authors {
+		fmt.Fprintf(&d, "<author><nickname>%s</nickname></author>\n", escape(a))
+	}
+
+	fmt.Fprintf(&d, "<program-used>%s</program-used>\n", escape(w.opts.ProgramUsed))
+	date := w.opts.Date.Format("2006-01-02")
+	fmt.Fprintf(&d, "<date value=\"%s\">%s</date>\n", date, date)
+
+	for _, url := range info.SrcURLs {
+		fmt.Fprintf(&d, "<src-url>%s</src-url>\n", escape(url))
+	}
+	if info.SrcOCR != "" {
+		fmt.Fprintf(&d, "<src-ocr>%s</src-ocr>\n", escape(info.SrcOCR))
+	}
+
+	id := info.ID
+	if id == "" {
+		// Stable id so re-exports of the same book are recognized as one document
+		sum := sha1.Sum([]byte(w.book.Metadata.Fingerprint() + "\n" + w.book.Fingerprint()))
+		id = fmt.Sprintf("%x", sum[:16])
+	}
+	fmt.Fprintf(&d, "<id>%s</id>\n", escape(id))
+
+	version := info.Version
+	if version == "" {
+		version = "1.0"
+	}
+	fmt.Fprintf(&d, "<version>%s</version>\n", escape(version))
+
+	d.WriteString("</document-info>\n")
+	return d.String()
+}
+
+// notesBody writes the notes referenced by footnotes, followed by any other
+// notes of the book, as a notes body
+func (w *writer) notesBody() string {
+	ids := make([]string, 0, len(w.book.Notes))
+	for id := range w.book.Notes {
+		if !w.noteIDs[id] {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	notes := w.notes
+	for _, id := range ids {
+		notes = append(notes, w.book.Notes[id])
+	}
+	if len(notes) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString("<body name=\"notes\">\n")
+	for _, note := range notes {
+		fmt.Fprintf(&b, "<section id=\"%s\">\n", escape(note.ID))
+		if note.Title != "" {
+			fmt.Fprintf(&b, "<title><p>%s</p></title>\n", escape(note.Title))
+		}
+		content := w.elementsToFB2(note.Elements)
+		if content == "" {
+			content = "<p></p>\n"
+		}
+		b.WriteString(content)
+		b.WriteString("</section>\n")
+	}
+	b.WriteString("</body>\n")
+	return b.String()
+}
+
+var xmlEscaper = strings.NewReplacer(
+	"&", "&amp;",
+	"<", "&lt;",
+	">", "&gt;",
+	`"`, "&quot;",
+	"'", "&apos;",
+)
+
+// escape escapes text for XML content and attribute values, dropping
+// characters that are not allowed in XML 1.0
+func escape(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r < 0x20 && r != '\t' && r != '\n' && r != '\r' {
+			return -1
+		}
+		if r == 0xFFFE || r == 0xFFFF {
+			return -1
+		}
+		return r
+	}, s)
+	return xmlEscaper.Replace(s)
+}
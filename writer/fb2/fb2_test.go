@@ -0,0 +1,170 @@
+package fb2_test
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	fb2parser "github.com/vpoluyaktov/biblio-ebook-parser/formats/fb2"
+	"github.com/vpoluyaktov/biblio-ebook-parser/parser"
+	"github.com/vpoluyaktov/biblio-ebook-parser/writer/fb2"
+)
+
+const source = `<?xml version="1.0" encoding="utf-8"?>
+<FictionBook xmlns="http://www.gribuser.ru/xml/fictionbook/2.0" xmlns:l="http://www.w3.org/1999/xlink">
+<description>
+<title-info>
+<genre>prose_classic</genre>
+<author><first-name>Лев</first-name><last-name>Толстой</last-name></author>
+<book-title>Анна Каренина</book-title>
+<lang>ru</lang>
+</title-info>
+</description>
+<body>
+<title><p>Анна Каренина</p></title>
+<section id="part1">
+<title><p>Часть первая</p></title>
+<epigraph><p>Мне отмщение, и аз воздам.</p></epigraph>
+<p>Вступление к первой части.</p>
+<section>
+<title><p>I</p></title>
+<p>Все счастливые семьи похожи друг на друга, каждая несчастливая семья несчастлива по-своему.</p>
+<poem><stanza><v>Первая строка</v><v>Вторая строка</v></stanza></poem>
+</section>
+<section>
+<title><p>II</p></title>
+<p>Степан Аркадьич<a l:href="#n1" type="note">1</a> был человек правдивый.</p>
+<section>
+<title><p>Подглава</p></title>
+<p>Вложенный текст.</p>
+</section>
+</section>
+</section>
+<section>
+<title><p>Часть вторая</p></title>
+<epigraph><p>Только эпиграф перед главами.</p><text-author>Автор</text-author></epigraph>
+<section>
+<p>Глава без названия.</p>
+</section>
+<section>
+<title><p>III</p></title>
+<p>Конец.</p>
+</section>
+</section>
+</body>
+<body name="notes">
+<section id="n1"><title><p>1</p></title><p>Облонский.</p></section>
+</body>
+</FictionBook>
+`
+
+func parse(t *testing.T, data []byte) *parser.Book {
+	t.Helper()
+	p := fb2parser.NewParser()
+	p.ParseNotes = true
+	book, err := p.ParseReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("ParseReader: %v", err)
+	}
+	return book
+}
+
+func write(t *testing.T, book *parser.Book) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	opts := fb2.Options{Date: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)}
+	if err := fb2.WriteFB2(book, &buf, opts); err != nil {
+		t.Fatalf("WriteFB2: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// outline describes the chapters of a book, one per line
+func outline(book *parser.Book) string {
+	var b strings.Builder
+	for _, ch := range book.Content.Chapters {
+		words := 0
+		for _, elem := range ch.Elements {
+			words += elem.WordCount()
+		}
+		fmt.Fprintf(&b, "%s %q level %d, %d words\n", ch.ID, ch.Title, ch.Level, words)
+	}
+	return b.String()
+}
+
+func TestRoundTrip(t *testing.T) {
+	original := parse(t, []byte(source))
+	written := write(t, original)
+	reparsed := parse(t, written)
+
+	want := `body-title-1 "Анна Каренина" level 0, 2 words
+part1 "Часть первая" level 0, 11 words
+section-3 "I" level 1, 17 words
+section-4 "II" level 1, 6 words
+section-5 "Подглава" level 2, 3 words
+section-6 "Часть вторая" level 0, 6 words
+section-7 "Chapter 7" level 1, 3 words
+section-8 "III" level 1, 2 words
+`
+	if got := outline(original); got != want {
+		t.Errorf("original outline:\n%s\nwant:\n%s", got, want)
+	}
+	if got := outline(reparsed); got != want {
+		t.Errorf("outline after the round trip:\n%s\nwant:\n%s\nFB2:\n%s", got, want, written)
+	}
+	if got, want := reparsed.GetTotalWords(), original.GetTotalWords(); got != want {
+		t.Errorf("round trip has %d words, want %d", got, want)
+	}
+	if got, want := len(reparsed.Notes), len(original.Notes); got != want {
+		t.Errorf("round trip has %d notes, want %d", got, want)
+	}
+
+	// Writing the reparsed book gives the same document
+	if again := write(t, reparsed); !bytes.Equal(again, written) {
+		t.Errorf("second round trip differs:\n%s\nfirst:\n%s", again, written)
+	}
+}
+
+func TestEpigraphsStayInSectionHead(t *testing.T) {
+	written := string(write(t, parse(t, []byte(source))))
+
+	// The epigraph of a part with chapters precedes the marked subsection
+	// holding the part's own text
+	want := "<title>\n<p>Часть первая</p>\n</title>\n<epigraph>\n<p>Мне отмщение, и аз воздам.</p>\n</epigraph>\n<section id=\"leading-text-1\">\n<p>Вступление к первой части.</p>\n</section>\n"
+	if !strings.Contains(written, want) {
+		t.Errorf("output does not contain\n%s\n%s", want, written)
+	}
+	for _, id := range []string{`id="section-`, `id="body-title-`} {
+		if strings.Contains(written, id) {
+			t.Errorf("output contains a parser-made id %s", id)
+		}
+	}
+}
+
+func TestWriteBookFromOtherFormat(t *testing.T) {
+	book := &parser.Book{
+		Metadata: parser.Metadata{Title: "Plain", Language: "en"},
+		Content: parser.Content{Chapters: []parser.Chapter{
+			{ID: "ch1", Title: "One", Level: 0, Elements: []parser.Element{
+				&parser.Heading{Text: "One", Level: 1},
+				&parser.Paragraph{Text: "Part text."},
+			}},
+			{ID: "ch2", Title: "Two", Level: 1, Elements: []parser.Element{
+				&parser.Heading{Text: "Two", Level: 2},
+				&parser.Paragraph{Text: "Chapter text."},
+			}},
+			{ID: "ch3", Title: "Three", Level: 0, Elements: []parser.Element{
+				&parser.Heading{Text: "Three", Level: 1},
+				&parser.Paragraph{Text: "More text."},
+			}},
+		}},
+	}
+	reparsed := parse(t, write(t, book))
+
+	want := "ch1 \"One\" level 0, 3 words\nch2 \"Two\" level 1, 3 words\nch3 \"Three\" level 0, 3 words\n"
+	if got := outline(reparsed); got != want {
+		t.Errorf("outline:\n%s\nwant:\n%s", got, want)
+	}
+}